@@ -0,0 +1,314 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/waflog"
+)
+
+// Verdict is the outcome of an assertion
+type Verdict int
+
+const (
+	// NotApplicable is the verdict of an assertion that the test doesn't expect
+	NotApplicable Verdict = iota
+	// Pass means the response or the logs are what the test expects
+	Pass
+	// Fail means the response or the logs are not what the test expects
+	Fail
+)
+
+// String returns the name of the verdict
+func (v Verdict) String() string {
+	switch v {
+	case Pass:
+		return "pass"
+	case Fail:
+		return "fail"
+	default:
+		return "not applicable"
+	}
+}
+
+// Result is the verdict of an assertion, with the evidence it's based on
+type Result struct {
+	Verdict  Verdict
+	Evidence string
+}
+
+// Assertion checks the response and the logs of a test stage against its expected output.
+// The response is nil when the request failed, and the logs can't be read in cloud mode.
+type Assertion interface {
+	// Name identifies the assertion, like the key of the expected output it checks
+	Name() string
+	// Evaluate returns the verdict of the assertion for the stage
+	Evaluate(ctx *AssertionContext, response *ftwhttp.Response) Result
+}
+
+// AssertionContext is what the response of a stage is checked against: the expected output, the
+// logs of the request, and the state of the check
+type AssertionContext struct {
+	Expected *test.Output
+	Logs     *waflog.FTWLogLines
+	// BlockResponses recognize the responses of the WAF blocking a request, the default ones when
+	// empty
+	BlockResponses []config.FTWBlockResponse
+	// Variables are the values captured by the previous stages of the test
+	Variables map[string]string
+}
+
+// Evaluation is the result of an assertion evaluated for a stage
+type Evaluation struct {
+	Name string
+	Result
+}
+
+var (
+	assertionsMutex sync.RWMutex
+	assertions      []Assertion
+)
+
+// RegisterAssertion adds an assertion to the ones evaluated for every stage, after the
+// assertions already registered. The names of the assertions must be unique.
+func RegisterAssertion(a Assertion) error {
+	assertionsMutex.Lock()
+	defer assertionsMutex.Unlock()
+	for _, registered := range assertions {
+		if registered.Name() == a.Name() {
+			return fmt.Errorf("ftw/check: assertion %q is already registered", a.Name())
+		}
+	}
+	assertions = append(assertions, a)
+	return nil
+}
+
+// UnregisterAssertion removes the assertion with the name, if it's registered
+func UnregisterAssertion(name string) {
+	assertionsMutex.Lock()
+	defer assertionsMutex.Unlock()
+	for i, registered := range assertions {
+		if registered.Name() == name {
+			assertions = append(assertions[:i:i], assertions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Assertions returns the registered assertions, in the order they are evaluated
+func Assertions() []Assertion {
+	assertionsMutex.RLock()
+	defer assertionsMutex.RUnlock()
+	return append([]Assertion(nil), assertions...)
+}
+
+// Evaluate evaluates the registered assertions in order, until one of them passes, and returns
+// their results. The groups of the expected output, like all_of, are not evaluated.
+func (c *FTWCheck) Evaluate(response *ftwhttp.Response) []Evaluation {
+	return c.evaluate(c.expected, response)
+}
+
+func (c *FTWCheck) evaluate(expected *test.Output, response *ftwhttp.Response) []Evaluation {
+	ctx := &AssertionContext{Expected: expected, Logs: c.log, BlockResponses: c.blockResponses, Variables: c.variables}
+	var evaluations []Evaluation
+	for _, a := range Assertions() {
+		result := a.Evaluate(ctx, response)
+		evaluations = append(evaluations, Evaluation{Name: a.Name(), Result: result})
+		if result.Verdict == Pass {
+			break
+		}
+	}
+	return evaluations
+}
+
+// builtinAssertion is an assertion of the expected output of the test files, implemented by
+// one of the Assert methods of FTWCheck
+type builtinAssertion struct {
+	name     string
+	expects  func(expected *test.Output) bool
+	assert   func(c *FTWCheck, response *ftwhttp.Response) bool
+	evidence func(c *FTWCheck, response *ftwhttp.Response) string
+	// needsResponse is set for the assertions that are not applicable without response
+	needsResponse bool
+}
+
+// Name returns the key of the expected output
+func (b *builtinAssertion) Name() string {
+	return b.name
+}
+
+// Evaluate runs the Assert method with a check in the context of the stage
+func (b *builtinAssertion) Evaluate(ctx *AssertionContext, response *ftwhttp.Response) Result {
+	c := &FTWCheck{expected: ctx.Expected, log: ctx.Logs, blockResponses: ctx.BlockResponses, variables: ctx.Variables}
+	if !b.expects(c.expected) || (b.needsResponse && response == nil) {
+		return Result{Verdict: NotApplicable}
+	}
+	verdict := Fail
+	if b.assert(c, response) {
+		verdict = Pass
+	}
+	return Result{Verdict: verdict, Evidence: b.evidence(c, response)}
+}
+
+func statusEvidence(_ *FTWCheck, response *ftwhttp.Response) string {
+	return fmt.Sprintf("status %d", response.Parsed.StatusCode)
+}
+
+func rulesEvidence(c *FTWCheck, _ *ftwhttp.Response) string {
+	return fmt.Sprintf("rules %v", c.log.TriggeredRules())
+}
+
+func logEvidence(c *FTWCheck, _ *ftwhttp.Response) string {
+	return fmt.Sprintf("%d log entries", len(c.log.Excerpt()))
+}
+
+// the assertions of the test files, in the order they have always been evaluated
+func init() {
+	builtins := []*builtinAssertion{
+		{
+			name:          "status",
+			expects:       func(e *test.Output) bool { return len(e.Status) > 0 },
+			assert:        func(c *FTWCheck, r *ftwhttp.Response) bool { return c.AssertStatus(r.Parsed.StatusCode) },
+			evidence:      statusEvidence,
+			needsResponse: true,
+		},
+		{
+			name:          "no_expect_status",
+			expects:       func(e *test.Output) bool { return len(e.NoExpectStatus) > 0 },
+			assert:        func(c *FTWCheck, r *ftwhttp.Response) bool { return c.AssertNoStatus(r.Parsed.StatusCode) },
+			evidence:      statusEvidence,
+			needsResponse: true,
+		},
+		{
+			name:    "response_contains",
+			expects: func(e *test.Output) bool { return e.ResponseContains != "" },
+			assert: func(c *FTWCheck, r *ftwhttp.Response) bool {
+				return c.AssertResponseContains(r.GetBodyAsString())
+			},
+			evidence: func(_ *FTWCheck, r *ftwhttp.Response) string {
+				return fmt.Sprintf("response body of %d bytes", len(r.GetBodyAsString()))
+			},
+			needsResponse: true,
+		},
+		{
+			name:    "response_headers",
+			expects: func(e *test.Output) bool { return len(e.ResponseHeaders) > 0 },
+			assert: func(c *FTWCheck, r *ftwhttp.Response) bool {
+				return c.AssertResponseHeaders(r.Parsed.Header)
+			},
+			evidence: func(c *FTWCheck, r *ftwhttp.Response) string {
+				var found []string
+				for name := range c.expected.ResponseHeaders {
+					for _, value := range r.Parsed.Header.Values(name) {
+						found = append(found, name+": "+value)
+					}
+				}
+				sort.Strings(found)
+				return fmt.Sprintf("headers %q", found)
+			},
+			needsResponse: true,
+		},
+		{
+			name:          "blocked",
+			expects:       func(e *test.Output) bool { return e.Blocked != nil },
+			assert:        func(c *FTWCheck, r *ftwhttp.Response) bool { return c.AssertBlocked(r) },
+			evidence:      statusEvidence,
+			needsResponse: true,
+		},
+		{
+			name:     "log_contains",
+			expects:  func(e *test.Output) bool { return len(e.LogContains) > 0 },
+			assert:   func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertLogContains() },
+			evidence: logEvidence,
+		},
+		{
+			name:    "log_contains_count",
+			expects: func(e *test.Output) bool { return e.LogContainsCount != nil && e.LogContainsCount.Pattern != "" },
+			assert:  func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertLogContainsCount() },
+			evidence: func(c *FTWCheck, _ *ftwhttp.Response) string {
+				return fmt.Sprintf("found %d times", c.log.CountMatches(c.expected.LogContainsCount.Pattern))
+			},
+		},
+		{
+			name:     "rule_ids",
+			expects:  func(e *test.Output) bool { return len(e.Log.ExpectIDs) > 0 },
+			assert:   func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertExpectIDs() },
+			evidence: rulesEvidence,
+		},
+		{
+			name: "anomaly_score",
+			expects: func(e *test.Output) bool {
+				return e.Log.AnomalyScore != nil || e.Log.OutboundAnomalyScore != nil
+			},
+			assert: func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertAnomalyScore() },
+			evidence: func(c *FTWCheck, _ *ftwhttp.Response) string {
+				inbound, outbound := c.log.AnomalyScores()
+				return fmt.Sprintf("inbound anomaly score %d, outbound anomaly score %d", inbound, outbound)
+			},
+		},
+		{
+			name:     "match_count",
+			expects:  func(e *test.Output) bool { return e.Log.MatchCount != nil },
+			assert:   func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertMatchCount() },
+			evidence: rulesEvidence,
+		},
+		{
+			name:    "max_severity",
+			expects: func(e *test.Output) bool { return e.Log.MaxSeverity != nil },
+			assert:  func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertMaxSeverity() },
+			evidence: func(c *FTWCheck, _ *ftwhttp.Response) string {
+				level, found := c.log.MaxSeverity()
+				if !found {
+					return "no severity"
+				}
+				return fmt.Sprintf("severity %s", test.Severities[level])
+			},
+		},
+		{
+			name:     "no_log_contains",
+			expects:  func(e *test.Output) bool { return len(e.NoLogContains) > 0 },
+			assert:   func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertNoLogContains() },
+			evidence: logEvidence,
+		},
+		{
+			name:     "no_rule_ids",
+			expects:  func(e *test.Output) bool { return len(e.Log.NoExpectIDs) > 0 },
+			assert:   func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertNoExpectIDs() },
+			evidence: rulesEvidence,
+		},
+		{
+			name:    "audit_parts",
+			expects: func(e *test.Output) bool { return len(e.AuditParts) > 0 },
+			assert:  func(c *FTWCheck, _ *ftwhttp.Response) bool { return c.AssertAuditParts() },
+			evidence: func(c *FTWCheck, _ *ftwhttp.Response) string {
+				var parts []string
+				for _, entry := range c.log.AuditEntries() {
+					var letters []string
+					for part := range entry {
+						letters = append(letters, part)
+					}
+					sort.Strings(letters)
+					parts = append(parts, strings.Join(letters, ""))
+				}
+				return fmt.Sprintf("audit log parts %q", parts)
+			},
+		},
+		{
+			name:          "expr",
+			expects:       func(e *test.Output) bool { return e.Expr != "" },
+			assert:        func(c *FTWCheck, r *ftwhttp.Response) bool { return c.AssertExpr(r) },
+			evidence:      func(c *FTWCheck, _ *ftwhttp.Response) string { return fmt.Sprintf("expression %q", c.expected.Expr) },
+			needsResponse: true,
+		},
+	}
+	for _, b := range builtins {
+		if err := RegisterAssertion(b); err != nil {
+			panic(err)
+		}
+	}
+}
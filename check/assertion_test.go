@@ -0,0 +1,120 @@
+package check
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/waflog"
+)
+
+// headerAssertion passes when the response has a header, like an assertion added by a user
+type headerAssertion struct {
+	header string
+}
+
+func (h *headerAssertion) Name() string {
+	return "header"
+}
+
+func (h *headerAssertion) Evaluate(_ *AssertionContext, response *ftwhttp.Response) Result {
+	if response == nil {
+		return Result{Verdict: NotApplicable}
+	}
+	if value := response.Parsed.Header.Get(h.header); value != "" {
+		return Result{Verdict: Pass, Evidence: h.header + ": " + value}
+	}
+	return Result{Verdict: Fail}
+}
+
+func TestEvaluateBuiltinAssertions(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	c := NewCheck(cfg)
+	c.SetExpectStatus([]int{403})
+	c.SetExpectResponse("blocked")
+	response := &ftwhttp.Response{Parsed: http.Response{StatusCode: 200}}
+
+	evaluations := c.Evaluate(response)
+	var applicable []Evaluation
+	for _, e := range evaluations {
+		if e.Verdict != NotApplicable {
+			applicable = append(applicable, e)
+		}
+	}
+	if len(evaluations) != len(Assertions()) || len(applicable) != 2 {
+		t.Fatalf("unexpected evaluations %+v", evaluations)
+	}
+	if applicable[0].Name != "status" || applicable[0].Verdict != Fail || applicable[0].Evidence != "status 200" {
+		t.Errorf("unexpected status evaluation %+v", applicable[0])
+	}
+	if applicable[1].Name != "response_contains" || applicable[1].Verdict != Fail {
+		t.Errorf("unexpected response evaluation %+v", applicable[1])
+	}
+
+	// without response, only the logs can be checked
+	for _, e := range c.Evaluate(nil) {
+		if e.Verdict != NotApplicable {
+			t.Errorf("%s is not applicable without response", e.Name)
+		}
+	}
+}
+
+func TestEvaluateAssertionContext(t *testing.T) {
+	blocked := true
+	ctx := &AssertionContext{
+		Expected:       &test.Output{Blocked: &blocked, Expr: `vars.transaction == "abc"`},
+		Logs:           &waflog.FTWLogLines{},
+		BlockResponses: []config.FTWBlockResponse{{Status: []int{200}, Body: "denied"}},
+		Variables:      map[string]string{"transaction": "abc"},
+	}
+	response := &ftwhttp.Response{Parsed: http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("denied"))}}
+
+	// the built-in assertions evaluated on their own see the whole context of the check
+	results := make(map[string]Result)
+	for _, a := range Assertions() {
+		results[a.Name()] = a.Evaluate(ctx, response)
+	}
+	if results["blocked"].Verdict != Pass {
+		t.Errorf("blocked must use the block responses of the context, got %+v", results["blocked"])
+	}
+	if results["expr"].Verdict != Pass {
+		t.Errorf("expr must use the variables of the context, got %+v", results["expr"])
+	}
+}
+
+func TestRegisterAssertion(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	if err := RegisterAssertion(&headerAssertion{header: "X-Blocked-By"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UnregisterAssertion("header") })
+	if err := RegisterAssertion(&headerAssertion{}); err == nil {
+		t.Errorf("assertion names must be unique")
+	}
+
+	c := NewCheck(cfg)
+	c.SetExpectStatus([]int{403})
+	response := &ftwhttp.Response{Parsed: http.Response{StatusCode: 200, Header: http.Header{"X-Blocked-By": {"waf"}}}}
+	evaluations := c.Evaluate(response)
+	last := evaluations[len(evaluations)-1]
+	if last.Name != "header" || last.Verdict != Pass || last.Evidence != "X-Blocked-By: waf" {
+		t.Errorf("the registered assertion must be evaluated last, got %+v", last)
+	}
+
+	UnregisterAssertion("header")
+	for _, a := range Assertions() {
+		if a.Name() == "header" {
+			t.Errorf("the assertion was not unregistered")
+		}
+	}
+}
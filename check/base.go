@@ -1,6 +1,8 @@
 package check
 
 import (
+	"time"
+
 	"github.com/coreruleset/go-ftw/config"
 	"github.com/coreruleset/go-ftw/test"
 	"github.com/coreruleset/go-ftw/waflog"
@@ -11,18 +13,28 @@ type FTWCheck struct {
 	log       *waflog.FTWLogLines
 	expected  *test.Output
 	overrides *config.FTWTestOverride
+	runMode   config.RunMode
+	// blockResponses recognize the responses of the WAF blocking a request
+	blockResponses []config.FTWBlockResponse
+	// variables are the values captured by the previous stages
+	variables map[string]string
 }
 
 // NewCheck creates a new FTWCheck, allowing to inject the configuration
 func NewCheck(c *config.FTWConfiguration) *FTWCheck {
 	check := &FTWCheck{
 		log: &waflog.FTWLogLines{
-			FileName:    c.LogFile,
-			StartMarker: nil,
-			EndMarker:   nil,
+			FileName:            c.LogFile,
+			Format:              c.LogFormat,
+			StartMarker:         nil,
+			EndMarker:           nil,
+			RunMode:             c.RunMode,
+			LogMarkerHeaderName: c.LogMarkerHeaderName,
 		},
-		expected:  &test.Output{},
-		overrides: &c.TestOverride,
+		expected:       &test.Output{},
+		overrides:      &c.TestOverride,
+		runMode:        c.RunMode,
+		blockResponses: c.BlockResponses,
 	}
 
 	return check
@@ -38,24 +50,99 @@ func (c *FTWCheck) SetExpectStatus(s []int) {
 	c.expected.Status = s
 }
 
+// SetNoExpectStatus sets the HTTP statuses that the test must not receive
+func (c *FTWCheck) SetNoExpectStatus(s []int) {
+	c.expected.NoExpectStatus = s
+}
+
 // SetExpectResponse sets the response we expect in the text from the server
 func (c *FTWCheck) SetExpectResponse(response string) {
 	c.expected.ResponseContains = response
 }
 
+// SetExpectResponseHeaders sets the regular expressions the response headers must match
+func (c *FTWCheck) SetExpectResponseHeaders(headers map[string]string) {
+	c.expected.ResponseHeaders = headers
+}
+
+// SetExpr sets the expression over the response and the logs that must evaluate to true
+func (c *FTWCheck) SetExpr(expression string) {
+	c.expected.Expr = expression
+}
+
+// SetMaxRTT sets the longest round trip time allowed for the request, in milliseconds
+func (c *FTWCheck) SetMaxRTT(milliseconds int) {
+	c.expected.MaxRTTMs = milliseconds
+}
+
 // SetExpectError sets the boolean if we are expecting an error from the server
 func (c *FTWCheck) SetExpectError(expect bool) {
 	c.expected.ExpectError = expect
 }
 
+// SetLogContainsCount sets the pattern to count in the logs, and the condition on its count
+func (c *FTWCheck) SetLogContainsCount(pattern string, count *test.ScoreCondition) {
+	c.expected.LogContainsCount = &test.LogContainsCount{Pattern: pattern, Count: count}
+}
+
 // SetLogContains sets the string to look for in logs
 func (c *FTWCheck) SetLogContains(contains string) {
-	c.expected.LogContains = contains
+	c.expected.LogContains = patternList(contains)
 }
 
 // SetNoLogContains sets the string to look that should not present in logs
 func (c *FTWCheck) SetNoLogContains(contains string) {
-	c.expected.NoLogContains = contains
+	c.expected.NoLogContains = patternList(contains)
+}
+
+// SetLogContainsAll sets the patterns that must all be found in the logs
+func (c *FTWCheck) SetLogContainsAll(patterns []string) {
+	c.expected.LogContains = patterns
+}
+
+// SetNoLogContainsAny sets the patterns that must not be found in the logs
+func (c *FTWCheck) SetNoLogContainsAny(patterns []string) {
+	c.expected.NoLogContains = patterns
+}
+
+// patternList returns the list with the pattern, or an empty list for an empty pattern
+func patternList(pattern string) test.PatternList {
+	if pattern == "" {
+		return nil
+	}
+	return test.PatternList{pattern}
+}
+
+// SetAuditParts sets the parts of the audit log that must be found, with the regular expressions
+// their content must match
+func (c *FTWCheck) SetAuditParts(parts map[string]string) {
+	c.expected.AuditParts = parts
+}
+
+// SetExpectIDs sets the rule IDs that must be found in logs
+func (c *FTWCheck) SetExpectIDs(ids []int) {
+	c.expected.Log.ExpectIDs = ids
+}
+
+// SetNoExpectIDs sets the rule IDs that must not be found in logs
+func (c *FTWCheck) SetNoExpectIDs(ids test.RuleIDList) {
+	c.expected.Log.NoExpectIDs = ids
+}
+
+// SetAnomalyScore sets the conditions the inbound and outbound anomaly scores in the logs must satisfy
+func (c *FTWCheck) SetAnomalyScore(inbound *test.ScoreCondition, outbound *test.ScoreCondition) {
+	c.expected.Log.AnomalyScore = inbound
+	c.expected.Log.OutboundAnomalyScore = outbound
+}
+
+// SetMatchCount sets the condition the number of rules found in the logs must satisfy
+func (c *FTWCheck) SetMatchCount(count *test.ScoreCondition) {
+	c.expected.Log.MatchCount = count
+}
+
+// SetMaxSeverity sets the condition the highest severity of the rules found in the logs must satisfy
+func (c *FTWCheck) SetMaxSeverity(severity *test.SeverityCondition) {
+	c.expected.Log.MaxSeverity = severity
 }
 
 // ForcedIgnore check if this id need to be ignored from results
@@ -78,21 +165,78 @@ func (c *FTWCheck) ForcedFail(id string) bool {
 
 // CloudMode returns true if we are running in cloud mode
 func (c *FTWCheck) CloudMode() bool {
-	return config.FTWConfig.RunMode == config.CloudRunMode
+	return c.runMode == config.CloudRunMode
 }
 
 // SetCloudMode alters the values for expected logs and status code
 func (c *FTWCheck) SetCloudMode() {
-	var status = c.expected.Status
-
-	if c.expected.LogContains != "" {
-		status = append(status, 403)
-		c.expected.LogContains = ""
-	} else if c.expected.NoLogContains != "" {
-		status = append(status, 200, 404, 405)
-		c.expected.NoLogContains = ""
+	setCloudMode(c.expected, len(c.blockResponses) > 0)
+}
+
+// setCloudMode alters the values for expected logs and status code of the output and of the
+// outputs it combines. With block responses, like the ones of a cloud provider, the expected
+// logs are translated to a blocked response, or a response that is not blocked, instead.
+func setCloudMode(expected *test.Output, blockResponses bool) {
+	var status = expected.Status
+	// the statuses of the blocked requests and of the other ones, expected by the scores and the logs
+	var byScore, byLogs []int
+
+	if expectsBlockingScore(expected) {
+		byScore = []int{403}
+	} else if len(scoreConditions(expected)) > 0 {
+		byScore = []int{200, 404, 405}
+	}
+	expected.Log.AnomalyScore = nil
+	expected.Log.OutboundAnomalyScore = nil
+	expected.Log.MatchCount = nil
+	expected.Log.MaxSeverity = nil
+	expected.LogContainsCount = nil
+	expected.AuditParts = nil
+
+	if len(expected.LogContains) > 0 || len(expected.Log.ExpectIDs) > 0 {
+		byLogs = []int{403}
+		expected.LogContains = nil
+		expected.Log.ExpectIDs = nil
+	} else if len(expected.NoLogContains) > 0 || len(expected.Log.NoExpectIDs) > 0 {
+		byLogs = []int{200, 404, 405}
+		expected.NoLogContains = nil
+		expected.Log.NoExpectIDs = nil
+	}
+
+	blocked := containsStatus(byScore, 403) || containsStatus(byLogs, 403)
+	allowed := containsStatus(byScore, 200) || containsStatus(byLogs, 200)
+	if blockResponses && blocked != allowed {
+		expected.Blocked = &blocked
+	} else {
+		status = append(status, byScore...)
+		status = append(status, byLogs...)
+	}
+	expected.Status = status
+
+	for i := range expected.AllOf {
+		setCloudMode(&expected.AllOf[i], blockResponses)
+	}
+	for i := range expected.AnyOf {
+		setCloudMode(&expected.AnyOf[i], blockResponses)
+	}
+	if expected.Not != nil {
+		setCloudMode(expected.Not, blockResponses)
 	}
-	c.expected.Status = status
+}
+
+// SetVariables sets the values captured by the previous stages, available to expressions
+func (c *FTWCheck) SetVariables(vars map[string]string) {
+	c.variables = vars
+}
+
+// SetLogFile sets the file with the logs to analyze, e.g. the copy of the journal entries
+func (c *FTWCheck) SetLogFile(fileName string) {
+	c.log.FileName = fileName
+}
+
+// SetLogStartOffset sets the offset of the log file where the logs of the run start
+func (c *FTWCheck) SetLogStartOffset(offset int64) {
+	c.log.StartOffset = offset
 }
 
 // SetStartMarker sets the log line that marks the start of the logs to analyze
@@ -104,3 +248,46 @@ func (c *FTWCheck) SetStartMarker(marker []byte) {
 func (c *FTWCheck) SetEndMarker(marker []byte) {
 	c.log.EndMarker = marker
 }
+
+// SetRequestLogs sets the logs of the requests of the stage, queried by their ID from log sources
+// like the Cloudflare firewall events, used instead of the markers
+func (c *FTWCheck) SetRequestLogs(lines [][]byte) {
+	c.log.SetRequestLines(lines)
+}
+
+// SetTimeWindow sets the time the logs to analyze were written in, used when the markers are
+// not found in the logs
+func (c *FTWCheck) SetTimeWindow(since time.Time, until time.Time) {
+	c.log.Since = since
+	c.log.Until = until
+}
+
+// expectsBlockingScore returns true when an anomaly score or match count condition can't be
+// satisfied by a request that didn't trigger any rule
+func expectsBlockingScore(expected *test.Output) bool {
+	for _, condition := range scoreConditions(expected) {
+		if !condition.Matches(0) {
+			return true
+		}
+	}
+	return false
+}
+
+// scoreConditions returns the anomaly score, match count and log count conditions that are set
+func scoreConditions(expected *test.Output) []*test.ScoreCondition {
+	var conditions []*test.ScoreCondition
+	for _, condition := range []*test.ScoreCondition{expected.Log.AnomalyScore, expected.Log.OutboundAnomalyScore, expected.Log.MatchCount} {
+		if condition != nil {
+			conditions = append(conditions, condition)
+		}
+	}
+	if expected.LogContainsCount != nil {
+		count := expected.LogContainsCount.Count
+		if count == nil {
+			// found at least once
+			count = &test.ScoreCondition{Operator: ">", Value: 0}
+		}
+		conditions = append(conditions, count)
+	}
+	return conditions
+}
@@ -24,12 +24,12 @@ mode: "cloud"
 `
 
 func TestNewCheck(t *testing.T) {
-	err := config.NewConfigFromString(yamlNginxConfig)
+	cfg, err := config.NewConfigFromString(yamlNginxConfig)
 	if err != nil {
 		t.Error(err)
 	}
 
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 
 	for _, text := range c.overrides.Ignore {
 		if text != "Ignore Me" {
@@ -40,8 +40,8 @@ func TestNewCheck(t *testing.T) {
 	to := test.Output{
 		Status:           []int{200},
 		ResponseContains: "",
-		LogContains:      "nothing",
-		NoLogContains:    "",
+		LogContains:      test.PatternList{"nothing"},
+		NoLogContains:    nil,
 		ExpectError:      true,
 	}
 	c.SetExpectTestOutput(&to)
@@ -52,18 +52,18 @@ func TestNewCheck(t *testing.T) {
 
 	c.SetNoLogContains("nologcontains")
 
-	if c.expected.NoLogContains != "nologcontains" {
+	if c.expected.NoLogContains.String() != "nologcontains" {
 		t.Error("PRoblem setting nologcontains")
 	}
 }
 
 func TestForced(t *testing.T) {
-	err := config.NewConfigFromString(yamlNginxConfig)
+	cfg, err := config.NewConfigFromString(yamlNginxConfig)
 	if err != nil {
 		t.Error(err)
 	}
 
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 
 	if !c.ForcedIgnore("942200-1") {
 		t.Errorf("Can't find ignored value")
@@ -79,12 +79,12 @@ func TestForced(t *testing.T) {
 }
 
 func TestCloudMode(t *testing.T) {
-	err := config.NewConfigFromString(yamlCloudConfig)
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
 	if err != nil {
 		t.Error(err)
 	}
 
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 
 	if c.CloudMode() != true {
 		t.Errorf("couldn't detect cloud mode")
@@ -103,6 +103,44 @@ func TestCloudMode(t *testing.T) {
 	}
 
 	c.SetLogContains("")
+	c.SetExpectStatus(nil)
+	c.SetExpectIDs([]int{942100})
+	// rule IDs are also translated to a blocking status
+	c.SetCloudMode()
+
+	if cloudStatus = c.expected.Status; len(cloudStatus) != 1 || cloudStatus[0] != 403 {
+		t.Errorf("expected 403 status for rule IDs, got %#v", cloudStatus)
+	}
+
+	c.SetExpectStatus(nil)
+	blocking, _ := test.ParseScoreCondition(">= 5")
+	c.SetAnomalyScore(&blocking, nil)
+	// a score that needs triggered rules is translated to a blocking status
+	c.SetCloudMode()
+
+	if cloudStatus = c.expected.Status; len(cloudStatus) != 1 || cloudStatus[0] != 403 {
+		t.Errorf("expected 403 status for anomaly score %s, got %#v", blocking, cloudStatus)
+	}
+
+	c.SetExpectStatus(nil)
+	passing, _ := test.ParseScoreCondition("< 5")
+	c.SetAnomalyScore(&passing, nil)
+	c.SetCloudMode()
+
+	if cloudStatus = c.expected.Status; len(cloudStatus) == 0 || cloudStatus[0] != 200 {
+		t.Errorf("expected 200 status for anomaly score %s, got %#v", passing, cloudStatus)
+	}
+	c.SetExpectStatus(nil)
+
+	// a pattern found in the logs is translated to a blocking status
+	c.SetLogContainsCount(`id "942100"`, nil)
+	c.SetCloudMode()
+
+	if cloudStatus = c.expected.Status; len(cloudStatus) != 1 || cloudStatus[0] != 403 || c.expected.LogContainsCount != nil {
+		t.Errorf("expected 403 status for log_contains_count, got %#v", cloudStatus)
+	}
+	c.SetExpectStatus(nil)
+
 	c.SetNoLogContains("no log contains")
 	// this should override logcontains
 	c.SetCloudMode()
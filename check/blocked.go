@@ -0,0 +1,65 @@
+package check
+
+import (
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
+
+// defaultBlockResponses recognize the blocked requests when no block response is configured
+var defaultBlockResponses = []config.FTWBlockResponse{{Status: []int{403}}}
+
+// AssertBlocked returns true when the response is a response of the WAF blocking the request, or
+// is not one when the test expects the request not to be blocked
+func (c *FTWCheck) AssertBlocked(response *ftwhttp.Response) bool {
+	if c.expected.Blocked == nil {
+		return false
+	}
+	return c.IsBlockResponse(response) == *c.expected.Blocked
+}
+
+// IsBlockResponse returns true when the response matches one of the block responses of the WAF
+func (c *FTWCheck) IsBlockResponse(response *ftwhttp.Response) bool {
+	blockResponses := c.blockResponses
+	if len(blockResponses) == 0 {
+		blockResponses = defaultBlockResponses
+	}
+	for _, block := range blockResponses {
+		if c.matchesBlockResponse(block, response) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FTWCheck) matchesBlockResponse(block config.FTWBlockResponse, response *ftwhttp.Response) bool {
+	if len(block.Status) > 0 && !containsStatus(block.Status, response.Parsed.StatusCode) {
+		return false
+	}
+	for name, regex := range block.Headers {
+		if !c.AssertResponseHeader(response.Parsed.Header, name, regex) {
+			return false
+		}
+	}
+	if block.Body == "" {
+		return true
+	}
+	re, err := regexp.Compile(block.Body)
+	if err != nil {
+		log.Error().Msgf("ftw/check: bad regexp for the body of the block response: %s", err.Error())
+		return false
+	}
+	return re.MatchString(response.GetBodyAsString())
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
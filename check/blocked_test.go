@@ -0,0 +1,198 @@
+package check
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+func newBlockTestResponse(status int, header http.Header, body string) *ftwhttp.Response {
+	return &ftwhttp.Response{Parsed: http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}}
+}
+
+func TestAssertBlocked(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\ncloudprovider: aws-waf\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		response *ftwhttp.Response
+		blocked  bool
+	}{
+		{"load balancer", newBlockTestResponse(403, http.Header{"Server": {"awselb/2.0"}}, "<html>403 Forbidden</html>"), true},
+		{"cloudfront", newBlockTestResponse(403, http.Header{"X-Cache": {"Error from cloudfront"}}, "Request blocked."), true},
+		{"origin", newBlockTestResponse(403, http.Header{"Server": {"Apache"}}, "Forbidden"), false},
+		{"allowed", newBlockTestResponse(200, http.Header{"Server": {"awselb/2.0"}}, "OK"), false},
+	}
+	for _, tt := range tests {
+		c := NewCheck(cfg)
+		if c.IsBlockResponse(tt.response) != tt.blocked {
+			t.Errorf("%s: expected blocked %v", tt.name, tt.blocked)
+		}
+		c.SetExpectTestOutput(&test.Output{Blocked: &tt.blocked})
+		if !c.AssertBlocked(tt.response) {
+			t.Errorf("%s: the assertion must pass", tt.name)
+		}
+	}
+}
+
+func TestAssertBlockedCustomResponse(t *testing.T) {
+	cfg, err := config.NewConfigFromString(`---
+cloudprovider: aws-waf
+blockresponses:
+  - status: [429]
+    headers:
+      x-amzn-waf-blocked: 'true'
+    body: 'denied'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCheck(cfg)
+	if !c.IsBlockResponse(newBlockTestResponse(429, http.Header{"X-Amzn-Waf-Blocked": {"true"}}, "access denied")) {
+		t.Error("the custom block response must be recognized")
+	}
+	if c.IsBlockResponse(newBlockTestResponse(403, http.Header{"Server": {"awselb/2.0"}}, "")) {
+		t.Error("the block responses replace the ones of the provider")
+	}
+
+	// without block responses, the blocked requests are the ones answered with 403
+	c = NewCheck(config.NewDefaultConfig())
+	if !c.IsBlockResponse(newBlockTestResponse(403, nil, "")) {
+		t.Error("403 must be a block response by default")
+	}
+}
+
+func TestCloudModeBlockResponses(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\ncloudprovider: aws-waf\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCheck(cfg)
+	c.SetExpectTestOutput(&test.Output{LogContains: test.PatternList{"SQLi_BODY"}})
+	c.SetCloudMode()
+	if c.expected.Blocked == nil || !*c.expected.Blocked || len(c.expected.Status) != 0 {
+		t.Errorf("expected a blocked response instead of statuses, got %+v", c.expected)
+	}
+
+	c.SetExpectTestOutput(&test.Output{AnyOf: []test.Output{{NoLogContains: test.PatternList{"SQLi_BODY"}}}})
+	c.SetCloudMode()
+	if blocked := c.expected.AnyOf[0].Blocked; blocked == nil || *blocked {
+		t.Errorf("expected a response that is not blocked, got %+v", c.expected.AnyOf[0])
+	}
+	origin := newBlockTestResponse(403, http.Header{"Server": {"Apache"}}, "Forbidden")
+	if !c.Assert(origin) {
+		t.Error("a 403 of the origin is not blocked by the WAF")
+	}
+}
+
+func TestAssertBlockedCloudflare(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\ncloudprovider: cloudflare\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := func(name, value string) http.Header {
+		return http.Header{"Server": {"cloudflare"}, "Cf-Ray": {"7d1a2b3c4d5e6f70-LHR"}, name: {value}}
+	}
+
+	tests := []struct {
+		name     string
+		response *ftwhttp.Response
+		blocked  bool
+	}{
+		{"block page", newBlockTestResponse(403, header("Content-Type", "text/html"), "Sorry, you have been blocked ... Cloudflare Ray ID: 7d1a2b3c4d5e6f70"), true},
+		{"rate limiting", newBlockTestResponse(429, header("Content-Type", "text/html"), "Error 1015 ... Cloudflare Ray ID: 7d1a2b3c4d5e6f70"), true},
+		{"challenge", newBlockTestResponse(403, header("Cf-Mitigated", "challenge"), "Just a moment..."), true},
+		{"origin", newBlockTestResponse(403, header("Content-Type", "text/html"), "Forbidden"), false},
+	}
+	c := NewCheck(cfg)
+	for _, tt := range tests {
+		if c.IsBlockResponse(tt.response) != tt.blocked {
+			t.Errorf("%s: expected blocked %v", tt.name, tt.blocked)
+		}
+	}
+}
+
+func TestAssertBlockedAzureWAF(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\ncloudprovider: azure-waf\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		response *ftwhttp.Response
+		blocked  bool
+	}{
+		{"application gateway", newBlockTestResponse(403, http.Header{"Server": {"Microsoft-Azure-Application-Gateway/v2"}}, "403 Forbidden"), true},
+		{"front door", newBlockTestResponse(403, http.Header{"X-Azure-Ref": {"0c3T1ZAAAAA"}}, "The request is blocked."), true},
+		{"origin behind front door", newBlockTestResponse(403, http.Header{"X-Azure-Ref": {"0c3T1ZAAAAA"}}, "Forbidden"), false},
+	}
+	c := NewCheck(cfg)
+	for _, tt := range tests {
+		if c.IsBlockResponse(tt.response) != tt.blocked {
+			t.Errorf("%s: expected blocked %v", tt.name, tt.blocked)
+		}
+	}
+}
+
+func TestAssertBlockedCloudArmor(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\ncloudprovider: cloud-armor\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	denyPage := `<!doctype html><meta charset="utf-8"><meta name=viewport content="width=device-width, initial-scale=1"><title>%d</title>%d %s`
+
+	tests := []struct {
+		name     string
+		response *ftwhttp.Response
+		blocked  bool
+	}{
+		{"deny(403)", newBlockTestResponse(403, http.Header{"Via": {"1.1 google"}}, fmt.Sprintf(denyPage, 403, 403, "Forbidden")), true},
+		{"deny(404)", newBlockTestResponse(404, http.Header{"Via": {"1.1 google"}}, fmt.Sprintf(denyPage, 404, 404, "Not Found")), true},
+		{"rate based ban", newBlockTestResponse(429, http.Header{"Via": {"1.1 google"}}, fmt.Sprintf(denyPage, 429, 429, "Too Many Requests")), true},
+		{"backend", newBlockTestResponse(404, http.Header{"Via": {"1.1 google"}}, "<html><title>Not Found</title></html>"), false},
+	}
+	c := NewCheck(cfg)
+	for _, tt := range tests {
+		if c.IsBlockResponse(tt.response) != tt.blocked {
+			t.Errorf("%s: expected blocked %v", tt.name, tt.blocked)
+		}
+	}
+}
+
+func TestAssertBlockedNGWAF(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\ncloudprovider: ngwaf\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		response *ftwhttp.Response
+		blocked  bool
+	}{
+		{"blocked", newBlockTestResponse(406, nil, "406 Not Acceptable"), true},
+		{"forbidden by the backend", newBlockTestResponse(403, nil, "Forbidden"), false},
+		{"allowed", newBlockTestResponse(200, nil, "OK"), false},
+	}
+	c := NewCheck(cfg)
+	for _, tt := range tests {
+		if c.IsBlockResponse(tt.response) != tt.blocked {
+			t.Errorf("%s: expected blocked %v", tt.name, tt.blocked)
+		}
+	}
+}
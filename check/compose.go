@@ -0,0 +1,77 @@
+package check
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// Assert returns true when the response and the logs satisfy the expected output. The keys of
+// the output pass when any of them passes, and its all_of, any_of and not groups, and the
+// maximum round trip time, must be satisfied too.
+func (c *FTWCheck) Assert(response *ftwhttp.Response) bool {
+	passed, _ := c.assertOutput(c.expected, response)
+	return passed
+}
+
+// assertOutput returns true when the output is satisfied, and false as second value when the
+// output doesn't check anything, like a group with keys that don't apply without response
+func (c *FTWCheck) assertOutput(expected *test.Output, response *ftwhttp.Response) (bool, bool) {
+	var parts []bool
+
+	applicable := false
+	evaluations := c.evaluate(expected, response)
+	for _, evaluation := range evaluations {
+		if evaluation.Verdict == NotApplicable {
+			continue
+		}
+		applicable = true
+		log.Debug().Msgf("ftw/check: %s: %s (%s)", evaluation.Name, evaluation.Verdict, evaluation.Evidence)
+	}
+	if applicable {
+		parts = append(parts, evaluations[len(evaluations)-1].Verdict == Pass)
+	}
+
+	if len(expected.AllOf) > 0 {
+		allPassed := true
+		for i := range expected.AllOf {
+			passed, ok := c.assertOutput(&expected.AllOf[i], response)
+			allPassed = allPassed && passed && ok
+		}
+		parts = append(parts, allPassed)
+	}
+	if len(expected.AnyOf) > 0 {
+		anyPassed := false
+		for i := range expected.AnyOf {
+			passed, ok := c.assertOutput(&expected.AnyOf[i], response)
+			anyPassed = anyPassed || (passed && ok)
+		}
+		parts = append(parts, anyPassed)
+	}
+	if expected.MaxRTTMs > 0 {
+		verdict := Fail
+		if response != nil && (&FTWCheck{expected: expected}).AssertMaxRTT(response.RoundTripTime) {
+			verdict = Pass
+		}
+		if response != nil {
+			log.Debug().Msgf("ftw/check: max_rtt_ms: %s (rtt %s)", verdict, response.RoundTripTime)
+		}
+		parts = append(parts, verdict == Pass)
+	}
+	if expected.Not != nil {
+		if passed, ok := c.assertOutput(expected.Not, response); ok {
+			parts = append(parts, !passed)
+		}
+	}
+
+	if len(parts) == 0 {
+		return false, false
+	}
+	for _, passed := range parts {
+		if !passed {
+			return false, true
+		}
+	}
+	return true, true
+}
@@ -0,0 +1,82 @@
+package check
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+func TestAssertComposedOutput(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	response := &ftwhttp.Response{Parsed: http.Response{StatusCode: 403}, RoundTripTime: 20 * time.Millisecond}
+	tests := []struct {
+		name     string
+		output   test.Output
+		expected bool
+	}{
+		// implicitly, any key passing is enough
+		{"any key", test.Output{Status: []int{200}, LogContains: test.PatternList{`id "920300"`}}, true},
+		{"all_of", test.Output{AllOf: []test.Output{{Status: []int{403}}, {LogContains: test.PatternList{`id "920300"`}}}}, true},
+		{"all_of failing", test.Output{AllOf: []test.Output{{Status: []int{200}}, {LogContains: test.PatternList{`id "920300"`}}}}, false},
+		{"any_of", test.Output{AnyOf: []test.Output{{Status: []int{200}}, {Log: test.LogOutput{ExpectIDs: []int{949110}}}}}, true},
+		{"any_of failing", test.Output{AnyOf: []test.Output{{Status: []int{200}}, {Log: test.LogOutput{ExpectIDs: []int{942100}}}}}, false},
+		{"not", test.Output{Not: &test.Output{Log: test.LogOutput{ExpectIDs: []int{942100}}}}, true},
+		{"not failing", test.Output{Not: &test.Output{Status: []int{403}}}, false},
+		// keys and groups must all be satisfied
+		{"keys and not", test.Output{Status: []int{403}, Not: &test.Output{LogContains: test.PatternList{`id "920300"`}}}, false},
+		{"nested", test.Output{AllOf: []test.Output{{Status: []int{403}}, {AnyOf: []test.Output{{Status: []int{200}}, {Not: &test.Output{LogContains: test.PatternList{"ABCDE"}}}}}}}, true},
+		{"empty group", test.Output{AllOf: []test.Output{{}}}, false},
+		// the round trip time must be short enough on top of the keys
+		{"max rtt", test.Output{Status: []int{403}, MaxRTTMs: 100}, true},
+		{"max rtt exceeded", test.Output{Status: []int{403}, MaxRTTMs: 10}, false},
+		{"max rtt only", test.Output{MaxRTTMs: 100}, true},
+		{"max rtt in group", test.Output{AnyOf: []test.Output{{MaxRTTMs: 10}, {Status: []int{200}}}}, false},
+		{"nothing", test.Output{}, false},
+	}
+	for _, tc := range tests {
+		c := NewCheck(cfg)
+		output := tc.output
+		c.SetExpectTestOutput(&output)
+		if c.Assert(response) != tc.expected {
+			t.Errorf("%s: expected %t", tc.name, tc.expected)
+		}
+	}
+
+	// without response, the status can't be checked
+	c := NewCheck(cfg)
+	c.SetExpectTestOutput(&test.Output{AllOf: []test.Output{{Status: []int{403}}, {LogContains: test.PatternList{`id "920300"`}}}})
+	if c.Assert(nil) {
+		t.Errorf("all_of can't be satisfied without response")
+	}
+}
+
+func TestSetCloudModeComposedOutput(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	c := NewCheck(cfg)
+	c.SetExpectTestOutput(&test.Output{
+		AllOf: []test.Output{{Log: test.LogOutput{ExpectIDs: []int{942100}}}},
+		Not:   &test.Output{NoLogContains: test.PatternList{"ABCDE"}},
+	})
+	c.SetCloudMode()
+
+	response := &ftwhttp.Response{Parsed: http.Response{StatusCode: 403}}
+	if !c.Assert(response) {
+		t.Errorf("the groups must be translated to statuses in cloud mode")
+	}
+}
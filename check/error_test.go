@@ -24,12 +24,11 @@ var expectedFailTests = []struct {
 }
 
 func TestAssertResponseErrorOK(t *testing.T) {
-	err := config.NewConfigFromString(yamlApacheConfig)
-
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 	for _, e := range expectedOKTests {
 		c.SetExpectError(e.expected)
 		if c.AssertExpectError(e.err) != e.expected {
@@ -39,13 +38,12 @@ func TestAssertResponseErrorOK(t *testing.T) {
 }
 
 func TestAssertResponseFail(t *testing.T) {
-	err := config.NewConfigFromString(yamlApacheConfig)
-
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
 
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 
 	for _, e := range expectedFailTests {
 		c.SetExpectError(e.expected)
@@ -0,0 +1,93 @@
+package check
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
+
+// exprEnv is what `expr` expressions are evaluated over
+type exprEnv struct {
+	Status  int                 `expr:"status"`
+	Headers map[string][]string `expr:"headers"`
+	Body    string              `expr:"body"`
+	// Log is the log entries of the stage, in the order they were written
+	Log                  []string      `expr:"log"`
+	Rules                []int         `expr:"rules"`
+	AnomalyScore         int           `expr:"anomaly_score"`
+	OutboundAnomalyScore int           `expr:"outbound_anomaly_score"`
+	RTT                  time.Duration `expr:"rtt"`
+	// Vars are the values captured from the logs by the previous stages
+	Vars map[string]string `expr:"vars"`
+}
+
+// newExprEnv returns the values of the response and the logs the expressions can use. The log
+// values are empty when the logs can't be read, like in cloud mode.
+func (c *FTWCheck) newExprEnv(response *ftwhttp.Response) exprEnv {
+	env := exprEnv{
+		Status:  response.Parsed.StatusCode,
+		Headers: map[string][]string(response.Parsed.Header),
+		Body:    response.GetBodyAsString(),
+		Log:     []string{},
+		Rules:   []int{},
+		RTT:     response.RoundTripTime,
+		Vars:    c.variables,
+	}
+	if env.Vars == nil {
+		env.Vars = map[string]string{}
+	}
+	if env.Headers == nil {
+		env.Headers = map[string][]string{}
+	}
+	if c.log != nil && c.log.HasWindow() {
+		if excerpt := c.log.Excerpt(); excerpt != nil {
+			env.Log = excerpt
+		}
+		if rules := c.log.TriggeredRules(); rules != nil {
+			env.Rules = rules
+		}
+		env.AnomalyScore, env.OutboundAnomalyScore = c.log.AnomalyScores()
+	}
+	return env
+}
+
+// header returns the first value of a response header, with the name in any case
+func header(headers map[string][]string) expr.Option {
+	return expr.Function("header", func(params ...any) (any, error) {
+		return http.Header(headers).Get(params[0].(string)), nil
+	}, new(func(string) string))
+}
+
+// AssertExpr returns true when the expression evaluates to true for the response and the logs
+func (c *FTWCheck) AssertExpr(response *ftwhttp.Response) bool {
+	passed, err := c.evalExpr(response)
+	if err != nil {
+		log.Error().Msgf("ftw/check: bad expr %q: %s", c.expected.Expr, err.Error())
+	}
+	return passed
+}
+
+func (c *FTWCheck) evalExpr(response *ftwhttp.Response) (bool, error) {
+	if c.expected.Expr == "" || response == nil {
+		return false, nil
+	}
+	env := c.newExprEnv(response)
+	program, err := expr.Compile(c.expected.Expr, expr.Env(exprEnv{}), expr.AsBool(), header(env.Headers))
+	if err != nil {
+		return false, err
+	}
+	result, err := expr.Run(program, env)
+	if err != nil {
+		return false, err
+	}
+	passed, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("the expression returned %T instead of a boolean", result)
+	}
+	return passed, nil
+}
@@ -0,0 +1,69 @@
+package check
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+func TestAssertExpr(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+	// the log values are only set with markers, which are not in the log, so all of it is read
+	c.SetStartMarker([]byte("x-crs-test: start"))
+	c.SetEndMarker([]byte("x-crs-test: end"))
+	response := &ftwhttp.Response{
+		Parsed: http.Response{
+			StatusCode: 403,
+			Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			Body:       io.NopCloser(strings.NewReader("<html>Request blocked</html>")),
+		},
+		RoundTripTime: 20 * time.Millisecond,
+	}
+
+	tests := map[string]bool{
+		`status == 403 && body contains "blocked"`:                 true,
+		`status in [200, 404]`:                                     false,
+		`header("content-type") startsWith "text/html"`:            true,
+		`headers["Content-Type"][0] matches "charset=utf-8$"`:      true,
+		`949110 in rules && 942100 not in rules`:                   true,
+		`len(rules) == 4 && anomaly_score >= 5`:                    true,
+		`any(log, # contains "Request Missing an Accept Header")`:  true,
+		`outbound_anomaly_score > 0`:                               false,
+		`rtt < duration("100ms")`:                                  true,
+		`rtt > duration("1s") || (status == 403 && len(log) == 0)`: false,
+		// errors fail the assertion
+		`status ==`:    false,
+		`unknown == 1`: false,
+		`status + 1`:   false,
+	}
+	for expression, expected := range tests {
+		c.SetExpr(expression)
+		if c.AssertExpr(response) != expected {
+			t.Errorf("expr %q: expected %t", expression, expected)
+		}
+	}
+
+	c.SetExpr(`status == 403`)
+	if c.AssertExpr(nil) {
+		t.Errorf("the expression can't be evaluated without response")
+	}
+	c.SetExpr("")
+	if c.AssertExpr(response) {
+		t.Errorf("no expression expected, assertion must not pass")
+	}
+}
@@ -1,17 +1,205 @@
 package check
 
-// AssertNoLogContains returns true is the string is not found in the logs
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/waflog"
+)
+
+// AssertNoLogContains returns true is none of the patterns is found in the logs
 func (c *FTWCheck) AssertNoLogContains() bool {
-	if c.expected.NoLogContains != "" {
-		return !c.log.Contains(c.expected.NoLogContains)
+	if len(c.expected.NoLogContains) == 0 {
+		return false
 	}
-	return false
+	for _, pattern := range c.expected.NoLogContains {
+		if c.log.Contains(pattern) {
+			return false
+		}
+	}
+	return true
 }
 
-// AssertLogContains returns true when the logs contain the string
+// AssertLogContains returns true when the logs contain all the patterns
 func (c *FTWCheck) AssertLogContains() bool {
-	if c.expected.LogContains != "" {
-		return c.log.Contains(c.expected.LogContains)
+	if len(c.expected.LogContains) == 0 {
+		return false
+	}
+	for _, pattern := range c.expected.LogContains {
+		if !c.log.Contains(pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// Captures returns the values of the named capture groups of the log_contains patterns, like
+// `unique_id "(?P<transaction>[^"]+)"`, found in the logs. Patterns in all_of and any_of groups
+// are captured too.
+func (c *FTWCheck) Captures() map[string]string {
+	if !c.log.HasWindow() {
+		return nil
+	}
+	var captures map[string]string
+	for _, pattern := range logContainsPatterns(c.expected) {
+		for name, value := range c.log.Capture(pattern) {
+			if captures == nil {
+				captures = map[string]string{}
+			}
+			captures[name] = value
+		}
+	}
+	return captures
+}
+
+// logContainsPatterns returns the log_contains patterns of the output and of its groups
+func logContainsPatterns(expected *test.Output) []string {
+	patterns := append([]string(nil), expected.LogContains...)
+	for i := range expected.AllOf {
+		patterns = append(patterns, logContainsPatterns(&expected.AllOf[i])...)
+	}
+	for i := range expected.AnyOf {
+		patterns = append(patterns, logContainsPatterns(&expected.AnyOf[i])...)
+	}
+	return patterns
+}
+
+// AssertLogContainsCount returns true when the number of times the pattern is found in the logs
+// satisfies the expected count, or when it's found at least once without count
+func (c *FTWCheck) AssertLogContainsCount() bool {
+	expected := c.expected.LogContainsCount
+	if expected == nil || expected.Pattern == "" {
+		return false
+	}
+	count := c.log.CountMatches(expected.Pattern)
+	if expected.Count == nil {
+		return count > 0
+	}
+	return expected.Count.Matches(count)
+}
+
+// AssertAuditParts returns true when a transaction of the audit log has all the expected parts,
+// with content matching their regular expressions
+func (c *FTWCheck) AssertAuditParts() bool {
+	if len(c.expected.AuditParts) == 0 {
+		return false
+	}
+	regexes := make(map[string]*regexp.Regexp, len(c.expected.AuditParts))
+	for part, regex := range c.expected.AuditParts {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			log.Error().Msgf("ftw/check: bad regexp for audit log part %s: %s", part, err.Error())
+			return false
+		}
+		regexes[strings.ToUpper(part)] = re
+	}
+	for _, entry := range c.log.AuditEntries() {
+		if auditEntryMatches(entry, regexes) {
+			return true
+		}
 	}
 	return false
 }
+
+// auditEntryMatches returns true when the transaction has all the parts, matching the regexes
+func auditEntryMatches(entry waflog.AuditEntry, regexes map[string]*regexp.Regexp) bool {
+	for part, re := range regexes {
+		content, ok := entry[part]
+		if !ok || !re.MatchString(content) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertExpectIDs returns true when all the expected rule IDs are found in the logs
+func (c *FTWCheck) AssertExpectIDs() bool {
+	if len(c.expected.Log.ExpectIDs) == 0 {
+		return false
+	}
+	found := c.log.TriggeredRules()
+	for _, id := range c.expected.Log.ExpectIDs {
+		if !containsID(found, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertNoExpectIDs returns true when none of the rules that must not trigger are found in the logs
+func (c *FTWCheck) AssertNoExpectIDs() bool {
+	if len(c.expected.Log.NoExpectIDs) == 0 {
+		return false
+	}
+	for _, id := range c.log.TriggeredRules() {
+		if c.expected.Log.NoExpectIDs.Contains(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertAnomalyScore returns true when the inbound and outbound anomaly scores found in the logs
+// satisfy the expected conditions
+func (c *FTWCheck) AssertAnomalyScore() bool {
+	expected := c.expected.Log
+	if expected.AnomalyScore == nil && expected.OutboundAnomalyScore == nil {
+		return false
+	}
+	inbound, outbound := c.log.AnomalyScores()
+	if expected.AnomalyScore != nil && !expected.AnomalyScore.Matches(inbound) {
+		return false
+	}
+	if expected.OutboundAnomalyScore != nil && !expected.OutboundAnomalyScore.Matches(outbound) {
+		return false
+	}
+	return true
+}
+
+// AssertMatchCount returns true when the number of different rules found in the logs satisfies
+// the expected condition
+func (c *FTWCheck) AssertMatchCount() bool {
+	if c.expected.Log.MatchCount == nil {
+		return false
+	}
+	return c.expected.Log.MatchCount.Matches(len(c.log.TriggeredRules()))
+}
+
+// AssertMaxSeverity returns true when the highest severity of the rules found in the logs
+// satisfies the expected condition
+func (c *FTWCheck) AssertMaxSeverity() bool {
+	if c.expected.Log.MaxSeverity == nil {
+		return false
+	}
+	return c.expected.Log.MaxSeverity.Matches(c.log.MaxSeverity())
+}
+
+func containsID(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// LogExcerpt returns the log lines between the markers, to show why a test failed
+func (c *FTWCheck) LogExcerpt() []string {
+	return c.log.Excerpt()
+}
+
+// TriggeredRules returns the sorted IDs of the rules found in the logs between the markers, or
+// nil if there are no markers nor time window, like in cloud mode
+func (c *FTWCheck) TriggeredRules() []int {
+	if !c.log.HasWindow() {
+		return nil
+	}
+	ids := c.log.TriggeredRules()
+	if ids == nil {
+		ids = []int{}
+	}
+	return ids
+}
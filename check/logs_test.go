@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/test"
 	"github.com/coreruleset/go-ftw/utils"
 )
 
@@ -15,15 +16,15 @@ var logText = `[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76:tid 1396834345
 `
 
 func TestAssertLogContainsOK(t *testing.T) {
-	err := config.NewConfigFromString(yamlApacheConfig)
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
 	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
 	defer os.Remove(logName)
-	config.FTWConfig.LogFile = logName
+	cfg.LogFile = logName
 
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 
 	c.SetLogContains(`id "920300"`)
 
@@ -37,3 +38,313 @@ func TestAssertLogContainsOK(t *testing.T) {
 	// 	t.Errorf("Failed !")
 	// }
 }
+
+func TestAssertExpectIDs(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	c.SetExpectIDs([]int{920300, 949110})
+	if !c.AssertExpectIDs() {
+		t.Errorf("expected to find rules 920300 and 949110")
+	}
+
+	c.SetExpectIDs([]int{920300, 942100})
+	if c.AssertExpectIDs() {
+		t.Errorf("rule 942100 is not in the logs")
+	}
+
+	c.SetExpectIDs(nil)
+	if c.AssertExpectIDs() {
+		t.Errorf("no rule IDs expected, assertion must not pass")
+	}
+}
+
+func TestAssertNoExpectIDs(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	c.SetNoExpectIDs(test.RuleIDList{{From: 942000, To: 942999}})
+	if !c.AssertNoExpectIDs() {
+		t.Errorf("no 942xxx rule is in the logs")
+	}
+
+	c.SetNoExpectIDs(test.RuleIDList{{From: 942000, To: 942999}, {From: 920000, To: 920999}})
+	if c.AssertNoExpectIDs() {
+		t.Errorf("920xxx rules are in the logs")
+	}
+
+	c.SetNoExpectIDs(nil)
+	if c.AssertNoExpectIDs() {
+		t.Errorf("no rule IDs given, assertion must not pass")
+	}
+}
+
+func TestAssertAnomalyScore(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	tests := []struct {
+		inbound  string
+		outbound string
+		result   bool
+	}{
+		{"5", "", true},
+		{">= 5", "0", true},
+		{"> 5", "", false},
+		{"", "> 0", false},
+		{"< 5", "", false},
+	}
+	for _, tc := range tests {
+		var inbound, outbound *test.ScoreCondition
+		if tc.inbound != "" {
+			condition, _ := test.ParseScoreCondition(tc.inbound)
+			inbound = &condition
+		}
+		if tc.outbound != "" {
+			condition, _ := test.ParseScoreCondition(tc.outbound)
+			outbound = &condition
+		}
+		c.SetAnomalyScore(inbound, outbound)
+		if c.AssertAnomalyScore() != tc.result {
+			t.Errorf("anomaly_score %q, outbound_anomaly_score %q: expected %t", tc.inbound, tc.outbound, tc.result)
+		}
+	}
+
+	c.SetAnomalyScore(nil, nil)
+	if c.AssertAnomalyScore() {
+		t.Errorf("no anomaly score expected, assertion must not pass")
+	}
+}
+
+func TestAssertMatchCount(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	// the logs have 4 different rules
+	for condition, expected := range map[string]bool{"4": true, ">= 2": true, "1": false, "> 4": false} {
+		count, _ := test.ParseScoreCondition(condition)
+		c.SetMatchCount(&count)
+		if c.AssertMatchCount() != expected {
+			t.Errorf("match_count %q: expected %t", condition, expected)
+		}
+	}
+
+	c.SetMatchCount(nil)
+	if c.AssertMatchCount() {
+		t.Errorf("no match count expected, assertion must not pass")
+	}
+}
+
+func TestAssertExpectIDsLogFormat(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: json")
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(`{"transaction":{"messages":[{"message":"SQL Injection Attack Detected via libinjection","details":{"ruleId":"942100"}}]}}`+"\n", "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	c.SetExpectIDs([]int{942100})
+	if !c.AssertExpectIDs() {
+		t.Errorf("the configured log format must be used")
+	}
+}
+
+func TestAssertLogContainsCount(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	// the four rules are logged with the same unique ID, two of them by REQUEST-920
+	tests := []struct {
+		pattern   string
+		condition string
+		expected  bool
+	}{
+		{`X-PNFSe1VwjCgYRI9FsbHgAAAIY`, "4", true},
+		{`REQUEST-920-PROTOCOL-ENFORCEMENT`, "2", true},
+		{`REQUEST-920-PROTOCOL-ENFORCEMENT`, ">= 3", false},
+		{`id "942100"`, "0", true},
+		{`id "949110"`, "", true},
+		{`id "942100"`, "", false},
+	}
+	for _, tc := range tests {
+		var count *test.ScoreCondition
+		if tc.condition != "" {
+			condition, _ := test.ParseScoreCondition(tc.condition)
+			count = &condition
+		}
+		c.SetLogContainsCount(tc.pattern, count)
+		if c.AssertLogContainsCount() != tc.expected {
+			t.Errorf("log_contains_count %q %q: expected %t", tc.pattern, tc.condition, tc.expected)
+		}
+	}
+}
+
+func TestAssertLogContainsAll(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	c.SetLogContainsAll([]string{`id "920300"`, `msg "Request Missing an Accept Header"`})
+	if !c.AssertLogContains() {
+		t.Errorf("all the patterns are in the logs")
+	}
+	c.SetLogContainsAll([]string{`id "920300"`, `id "942100"`})
+	if c.AssertLogContains() {
+		t.Errorf("rule 942100 is not in the logs")
+	}
+
+	c.SetNoLogContainsAny([]string{`id "942100"`, `id "941100"`})
+	if !c.AssertNoLogContains() {
+		t.Errorf("none of the patterns is in the logs")
+	}
+	c.SetNoLogContainsAny([]string{`id "942100"`, `id "949110"`})
+	if c.AssertNoLogContains() {
+		t.Errorf("rule 949110 is in the logs")
+	}
+}
+
+func TestCaptures(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+	c.SetLogContains(`\[unique_id "(?P<transaction>[^"]+)"\]`)
+	if captures := c.Captures(); captures != nil {
+		t.Errorf("nothing is captured without markers, got %v", captures)
+	}
+
+	// the markers are not in the log, so all of it is read
+	c.SetStartMarker([]byte("x-crs-test: start"))
+	c.SetEndMarker([]byte("x-crs-test: end"))
+	c.SetExpectTestOutput(&test.Output{
+		LogContains: test.PatternList{`\[unique_id "(?P<transaction>[^"]+)"\]`},
+		AllOf: []test.Output{
+			{LogContains: test.PatternList{`Total Score: (?P<score>\d+)`}},
+		},
+	})
+	captures := c.Captures()
+	if captures["transaction"] != "X-PNFSe1VwjCgYRI9FsbHgAAAIY" || captures["score"] != "5" || len(captures) != 2 {
+		t.Errorf("unexpected captures %v", captures)
+	}
+}
+
+func TestAssertAuditParts(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: json")
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	auditLog := `{"transaction":{"time":"05/Jan/2021:02:21:09.637165 +0000","transaction_id":"X-PNFSe1VwjCgYRI9FsbHgAAAIY"},"request":{"request_line":"GET /?id=1%27%20or%201=1 HTTP/1.1","headers":{"Host":"localhost"}},"response":{"protocol":"HTTP/1.1","status":403},"audit_data":{"messages":["Access denied with code 403 (phase 2). [id \"949110\"]"],"action":{"intercepted":true,"phase":2,"message":"Operator GE matched 5 at TX:anomaly_score."}},"matched_rules":[{"chain":false,"rules":[{"actionset":{"id":"942100","phase":2}}]}]}`
+	logName, _ := utils.CreateTempFileWithContent(auditLog, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+	c.SetAuditParts(map[string]string{"H": `"intercepted":true`})
+	if c.AssertAuditParts() {
+		t.Errorf("the audit log is not read without markers")
+	}
+
+	// the markers are not in the log, so all of it is read
+	c.SetStartMarker([]byte("x-crs-test: start"))
+	c.SetEndMarker([]byte("x-crs-test: end"))
+	tests := []struct {
+		parts    map[string]string
+		expected bool
+	}{
+		{map[string]string{"H": `"intercepted":true`}, true},
+		{map[string]string{"H": `"intercepted":true`, "k": `"id":"942100"`, "F": ""}, true},
+		{map[string]string{"H": `"intercepted":false`}, false},
+		{map[string]string{"E": ""}, false},
+		{map[string]string{"H": `(`}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		c.SetAuditParts(tt.parts)
+		if c.AssertAuditParts() != tt.expected {
+			t.Errorf("audit parts %v: expected %t", tt.parts, tt.expected)
+		}
+	}
+}
+
+func TestAssertMaxSeverity(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logName, _ := utils.CreateTempFileWithContent(logText, "test-*.log")
+	defer os.Remove(logName)
+	cfg.LogFile = logName
+
+	c := NewCheck(cfg)
+
+	for condition, expected := range map[string]bool{
+		">= CRITICAL": true,
+		"CRITICAL":    true,
+		"> CRITICAL":  false,
+		"<= WARNING":  false,
+		"<= ALERT":    true,
+	} {
+		severity, err := test.ParseSeverityCondition(condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetMaxSeverity(&severity)
+		if c.AssertMaxSeverity() != expected {
+			t.Errorf("max severity %s: expected %t", condition, expected)
+		}
+	}
+
+	c.SetMaxSeverity(nil)
+	if c.AssertMaxSeverity() {
+		t.Errorf("no severity expected, assertion must not pass")
+	}
+}
@@ -1,7 +1,12 @@
 package check
 
 import (
+	"net/http"
+	"regexp"
 	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 // AssertResponseContains checks that the http response contains the needle
@@ -11,3 +16,41 @@ func (c *FTWCheck) AssertResponseContains(response string) bool {
 	}
 	return false
 }
+
+// AssertResponseHeader returns true when one of the values of the response header matches the
+// regular expression. An empty regular expression only checks that the header is present.
+func (c *FTWCheck) AssertResponseHeader(headers http.Header, name string, regex string) bool {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		log.Error().Msgf("ftw/check: bad regexp for response header %s: %s", name, err.Error())
+		return false
+	}
+	for _, value := range headers.Values(name) {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertResponseHeaders returns true when all the expected response headers match
+func (c *FTWCheck) AssertResponseHeaders(headers http.Header) bool {
+	if len(c.expected.ResponseHeaders) == 0 {
+		return false
+	}
+	for name, regex := range c.expected.ResponseHeaders {
+		if !c.AssertResponseHeader(headers, name, regex) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertMaxRTT returns true when the round trip time of the request is not longer than the
+// expected maximum
+func (c *FTWCheck) AssertMaxRTT(rtt time.Duration) bool {
+	if c.expected.MaxRTTMs <= 0 {
+		return false
+	}
+	return rtt <= time.Duration(c.expected.MaxRTTMs)*time.Millisecond
+}
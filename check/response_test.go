@@ -1,7 +1,9 @@
 package check
 
 import (
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/coreruleset/go-ftw/config"
 )
@@ -21,12 +23,11 @@ var expectedResponseFailTests = []struct {
 }
 
 func TestAssertResponseTextErrorOK(t *testing.T) {
-	err := config.NewConfigFromString(yamlApacheConfig)
-
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 	for _, e := range expectedResponseOKTests {
 		c.SetExpectResponse(e.expected)
 		if !c.AssertResponseContains(e.response) {
@@ -36,11 +37,11 @@ func TestAssertResponseTextErrorOK(t *testing.T) {
 }
 
 func TestAssertResponseTextFailOK(t *testing.T) {
-	err := config.NewConfigFromString(yamlApacheConfig)
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 	for _, e := range expectedResponseFailTests {
 		c.SetExpectResponse(e.expected)
 		if c.AssertResponseContains(e.response) {
@@ -48,3 +49,58 @@ func TestAssertResponseTextFailOK(t *testing.T) {
 		}
 	}
 }
+
+func TestAssertResponseHeaders(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	c := NewCheck(cfg)
+	headers := http.Header{
+		"Location":     {"https://example.com/blocked.html?id=X-PNFSe1VwjCgYRI9FsbHgAAAIY"},
+		"Content-Type": {"text/plain"},
+		"Set-Cookie":   {"a=1", "waf_block=1"},
+	}
+
+	tests := []struct {
+		expected map[string]string
+		result   bool
+	}{
+		{map[string]string{"Location": `/blocked\.html`}, true},
+		{map[string]string{"location": `^https://example\.com/`, "Content-Type": "^text/plain$"}, true},
+		{map[string]string{"Set-Cookie": "^waf_block="}, true},
+		{map[string]string{"Content-Type": "^text/html"}, false},
+		{map[string]string{"Location": `/blocked\.html`, "X-Blocked-By": ""}, false},
+		{map[string]string{"Content-Type": ""}, true},
+		{map[string]string{"Content-Type": "("}, false},
+		{nil, false},
+	}
+	for _, tc := range tests {
+		c.SetExpectResponseHeaders(tc.expected)
+		if c.AssertResponseHeaders(headers) != tc.result {
+			t.Errorf("response_headers %v: expected %t", tc.expected, tc.result)
+		}
+	}
+}
+
+func TestAssertMaxRTT(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	c := NewCheck(cfg)
+	if c.AssertMaxRTT(time.Millisecond) {
+		t.Errorf("no maximum round trip time expected, assertion must not pass")
+	}
+	c.SetMaxRTT(50)
+	for rtt, expected := range map[time.Duration]bool{
+		10 * time.Millisecond: true,
+		50 * time.Millisecond: true,
+		51 * time.Millisecond: false,
+		2 * time.Second:       false,
+	} {
+		if c.AssertMaxRTT(rtt) != expected {
+			t.Errorf("rtt %s: expected %t", rtt, expected)
+		}
+	}
+}
@@ -9,3 +9,17 @@ func (c *FTWCheck) AssertStatus(status int) bool {
 	}
 	return false
 }
+
+// AssertNoStatus returns true when the status received in the response is not in the list of
+// statuses that must not be returned
+func (c *FTWCheck) AssertNoStatus(status int) bool {
+	if len(c.expected.NoExpectStatus) == 0 {
+		return false
+	}
+	for _, i := range c.expected.NoExpectStatus {
+		if i == status {
+			return false
+		}
+	}
+	return true
+}
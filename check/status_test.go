@@ -24,12 +24,12 @@ var statusFailTests = []struct {
 }
 
 func TestStatusOK(t *testing.T) {
-	err := config.NewConfigFromString(yamlApacheConfig)
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
 
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 
 	for _, expected := range statusOKTests {
 		c.SetExpectStatus(expected.expectedStatus)
@@ -40,12 +40,12 @@ func TestStatusOK(t *testing.T) {
 }
 
 func TestStatusFail(t *testing.T) {
-	err := config.NewConfigFromString(yamlApacheConfig)
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
 
-	c := NewCheck(config.FTWConfig)
+	c := NewCheck(cfg)
 
 	for _, expected := range statusFailTests {
 		c.SetExpectStatus(expected.expectedStatus)
@@ -54,3 +54,30 @@ func TestStatusFail(t *testing.T) {
 		}
 	}
 }
+
+var noStatusTests = []struct {
+	status           int
+	noExpectedStatus []int
+	result           bool
+}{
+	{200, []int{403, 406}, true},
+	{403, []int{403, 406}, false},
+	{406, []int{403, 406}, false},
+	{200, nil, false},
+}
+
+func TestNoStatus(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlApacheConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	c := NewCheck(cfg)
+
+	for _, expected := range noStatusTests {
+		c.SetNoExpectStatus(expected.noExpectedStatus)
+		if c.AssertNoStatus(expected.status) != expected.result {
+			t.Errorf("status %d with no_expect_status %v: expected %t", expected.status, expected.noExpectedStatus, expected.result)
+		}
+	}
+}
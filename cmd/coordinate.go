@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kyokomi/emoji"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/coordinator"
+	"github.com/coreruleset/go-ftw/report"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// coordinateCmd represents the coordinate command
+var coordinateCmd = &cobra.Command{
+	Use:   "coordinate",
+	Short: "Distribute the tests to ftw services",
+	Long: `Distribute the files of tests found recursively in a directory to workers, ftw services each running the tests near its own WAF, and show the results of all of them as the ones of a single run.
+The workers have the same files of tests in their --worker-dir, and run one file at a time. The file of a worker that fails is sent to another one.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		workerURLs, _ := cmd.Flags().GetStringArray("worker")
+		token, _ := cmd.Flags().GetString("token")
+		workerDir, _ := cmd.Flags().GetString("worker-dir")
+		include, _ := cmd.Flags().GetString("include")
+		exclude, _ := cmd.Flags().GetString("exclude")
+		destination, _ := cmd.Flags().GetString("destination")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		jsonReport, _ := cmd.Flags().GetString("json-report")
+		junitReport, _ := cmd.Flags().GetString("junit-report")
+		artifacts, _ := cmd.Flags().GetString("artifacts")
+		if quiet && ftwLog.File == "" {
+			zerolog.SetGlobalLevel(zerolog.FatalLevel)
+		}
+		if len(workerURLs) == 0 {
+			log.Fatal().Msg("ftw/coordinate: no workers, add them with --worker")
+		}
+		if exclude != "" && include != "" {
+			log.Fatal().Msgf("You need to choose one: use --include (%s) or --exclude (%s)", include, exclude)
+		}
+		if token == "" {
+			token = os.Getenv(serviceTokenEnv)
+		}
+
+		files, err := testFiles(dir)
+		if errors.Is(err, test.ErrNoTests) {
+			log.Error().Msgf("ftw/coordinate: no tests found in %s", dir)
+			os.Exit(exitNoTests)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/coordinate: cannot read the tests")
+		}
+
+		workers := make([]coordinator.Worker, 0, len(workerURLs))
+		for _, url := range workerURLs {
+			workers = append(workers, coordinator.Worker{URL: url, Token: token})
+		}
+		if !quiet {
+			emoji.Printf(":hammer_and_wrench:sending %d files of tests to %d workers\n", len(files), len(workers))
+		}
+
+		// the run stops after the current files on SIGINT or SIGTERM, and the summary and the
+		// reports are the ones of the files completed so far
+		interrupted, stopSignals := interruptContext()
+		stats, err := coordinator.Run(interrupted, coordinator.Config{
+			Workers:     workers,
+			Dir:         workerDir,
+			Files:       files,
+			Include:     include,
+			Exclude:     exclude,
+			Destination: destination,
+			Evidence:    artifacts != "",
+			OnFile: func(file string, worker string, stages []runner.StageResult) {
+				if !quiet {
+					printFileResult(file, worker, stages)
+				}
+			},
+		})
+		stopSignals()
+		if err != nil {
+			log.Error().Err(err).Msg("ftw/coordinate: the tests were not all run")
+		}
+
+		if !quiet {
+			runner.PrintSummary(stats)
+		}
+		if jsonReport != "" {
+			if err := writeReport(jsonReport, report.WriteJSON, stats); err != nil {
+				log.Error().Err(err).Msg("ftw/coordinate: the JSON report was not written")
+			}
+		}
+		if junitReport != "" {
+			if err := writeReport(junitReport, report.WriteJUnit, stats); err != nil {
+				log.Error().Err(err).Msg("ftw/coordinate: the JUnit report was not written")
+			}
+		}
+		if artifacts != "" {
+			if err := report.WriteArtifacts(artifacts, stats); err != nil {
+				log.Error().Err(err).Msg("ftw/coordinate: the artifacts of the failed tests were not all written")
+			}
+		}
+		if err != nil && !stats.Interrupted {
+			os.Exit(exitError)
+		}
+		os.Exit(runExitCode(stats))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(coordinateCmd)
+	coordinateCmd.Flags().StringP("dir", "d", ".", "recursively find the yaml tests to distribute in this directory")
+	coordinateCmd.Flags().StringArray("worker", nil, "URL of the API of an ftw service running the tests, like http://waf-1:8081, repeated for every worker")
+	coordinateCmd.Flags().String("token", "", "bearer token of the API of the workers (default is to use "+serviceTokenEnv+")")
+	coordinateCmd.Flags().String("worker-dir", ".", "directory of the same tests on the workers, relative to their --dir")
+	coordinateCmd.Flags().StringP("include", "i", "", "include only tests matching this Go regexp")
+	coordinateCmd.Flags().StringP("exclude", "e", "", "exclude tests matching this Go regexp")
+	coordinateCmd.Flags().String("destination", "", "send the tests to this destination profile of the config file of the workers")
+	coordinateCmd.Flags().BoolP("quiet", "q", false, "do not show file by file, only results")
+	coordinateCmd.Flags().String("json-report", "", "write the results of the tests to this file as JSON, to compare them with the ones of another run with 'ftw diff'")
+	coordinateCmd.Flags().String("junit-report", "", "write the results of the tests to this file as a JUnit XML report")
+	coordinateCmd.Flags().String("artifacts", "", "write the request, response and WAF logs of every failed test to a folder of this directory, for CI to upload them")
+}
+
+// testFiles returns the files of tests found recursively in dir, relative to it, sorted. They are
+// read, so the bad files are found before sending them to the workers.
+func testFiles(dir string) ([]string, error) {
+	tests, err := test.GetTestsFromFiles(filepath.Join(dir, "**", "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(tests))
+	for _, t := range tests {
+		file, err := filepath.Rel(dir, t.FileName)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, filepath.ToSlash(file))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// printFileResult prints the results of the stages of a file once a worker ran its tests
+func printFileResult(file string, worker string, stages []runner.StageResult) {
+	counts := make(map[runner.TestResult]int)
+	for _, stage := range stages {
+		counts[stage.Result]++
+	}
+	if failed := counts[runner.Failed] + counts[runner.ForceFail]; failed > 0 {
+		emoji.Printf(":thumbs_down:%s on %s: %d passed, %d failed\n", file, worker, counts[runner.Success], failed)
+		return
+	}
+	emoji.Printf(":check_mark:%s on %s: %d passed\n", file, worker, counts[runner.Success])
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kyokomi/emoji"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/report"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff OLD NEW",
+	Short: "Compares the results of two runs.",
+	Long:  `Compares the JSON reports of two runs, written with 'ftw run --json-report', and shows the tests failing in the new run that didn't fail in the old one, the tests passing again, and the largest changes of the time of the tests. Exits with status 1 when tests fail that didn't fail in the old run.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		top, _ := cmd.Flags().GetInt("top")
+
+		if output != "text" && output != "json" {
+			log.Fatal().Msgf("unknown output format %q, use one of: text, json", output)
+		}
+
+		previous := readResults(args[0])
+		current := readResults(args[1])
+		diff := report.Compare(previous, current)
+		if top >= 0 && len(diff.TimeDeltas) > top {
+			diff.TimeDeltas = diff.TimeDeltas[:top]
+		}
+
+		if output == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(diff); err != nil {
+				log.Fatal().Err(err).Msg("ftw/diff: cannot print the differences")
+			}
+		} else {
+			printDiff(diff)
+		}
+
+		if diff.Regressed() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringP("output", "o", "text", "output format: text or json")
+	diffCmd.Flags().Int("top", 10, "number of tests with the largest time changes to show, -1 to show all of them")
+}
+
+func readResults(path string) report.Results {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("ftw/diff: cannot open %s", path)
+	}
+	defer f.Close()
+	results, err := report.ReadJSON(f)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("ftw/diff: cannot read %s", path)
+	}
+	return results
+}
+
+func printDiff(diff report.Diff) {
+	added := make(map[string]bool)
+	for _, title := range diff.Added {
+		added[title] = true
+	}
+	if len(diff.NewFailures) > 0 {
+		emoji.Printf(":thumbs_down:%d new failure(s):\n", len(diff.NewFailures))
+		for _, t := range diff.NewFailures {
+			line := "\t" + t.Test
+			if added[t.Test] {
+				line += " (new test)"
+			}
+			if len(t.FalsePositives) > 0 {
+				line += ", triggered " + formatIDs(t.FalsePositives)
+			}
+			fmt.Println(line)
+		}
+	}
+	if len(diff.NewPasses) > 0 {
+		emoji.Printf(":tada:%d test(s) passing again:\n", len(diff.NewPasses))
+		for _, t := range diff.NewPasses {
+			fmt.Printf("\t%s\n", t.Test)
+		}
+	}
+	if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+		fmt.Printf("%d test(s) added, %d removed\n", len(diff.Added), len(diff.Removed))
+		for _, title := range diff.Removed {
+			fmt.Printf("\t- %s\n", title)
+		}
+	}
+	fmt.Printf("run time: %.3fs -> %.3fs (%+.3fs)\n", diff.OldTime, diff.NewTime, diff.NewTime-diff.OldTime)
+	if len(diff.TimeDeltas) > 0 {
+		fmt.Println("largest time changes:")
+		for _, d := range diff.TimeDeltas {
+			fmt.Printf("\t%s: %.3fs -> %.3fs (%+.3fs)\n", d.Test, d.OldTime, d.NewTime, d.Delta)
+		}
+	}
+	if !diff.Regressed() {
+		emoji.Println(":tada:No new failures!")
+	}
+}
+
+func formatIDs(ids []int) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, strconv.Itoa(id))
+	}
+	return strings.Join(names, ", ")
+}
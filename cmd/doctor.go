@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kyokomi/emoji"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks the environment of the tests",
+	Long: `Checks the environment of the tests before running them: the configuration loads, the destination is reachable, the log file is readable and written by the WAF, and a marker request is found in the logs.
+Every check is reported on its own, and the exit code is 2 when one of them failed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		destination, _ := cmd.Flags().GetString("destination")
+		destAddr, _ := cmd.Flags().GetString("dest-addr")
+		port, _ := cmd.Flags().GetInt("port")
+		protocol, _ := cmd.Flags().GetString("protocol")
+		connectTimeout, _ := cmd.Flags().GetDuration("connect-timeout")
+
+		d := &doctor{}
+		d.checkConfig()
+		dest, reachable := d.checkDestination(d.destination(destination, destAddr, port, protocol), connectTimeout)
+		d.checkLogs(dest, reachable, connectTimeout)
+		if d.failed > 0 {
+			emoji.Printf(":collision:%d check(s) failed\n", d.failed)
+			os.Exit(exitError)
+		}
+		emoji.Println(":tada:The environment is ready for the tests!")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().String("destination", "", "check this destination profile of the config file")
+	doctorCmd.Flags().String("dest-addr", "", "check this host, instead of the one of the destination or the overrides (default localhost)")
+	doctorCmd.Flags().Int("port", 0, "check this port, instead of the one of the destination or the overrides (default 80)")
+	doctorCmd.Flags().String("protocol", "", "check with this protocol, http or https, instead of the one of the destination or the overrides (default http)")
+	doctorCmd.Flags().Duration("connect-timeout", 3*time.Second, "timeout for connecting to the destination")
+}
+
+// doctor reports the checks of the environment, counting the failed ones
+type doctor struct {
+	failed int
+}
+
+func (d *doctor) pass(check string, format string, a ...interface{}) {
+	emoji.Printf(":check_mark:%s: %s\n", check, fmt.Sprintf(format, a...))
+}
+
+func (d *doctor) fail(check string, format string, a ...interface{}) {
+	d.failed++
+	emoji.Printf(":collision:%s: %s\n", check, fmt.Sprintf(format, a...))
+}
+
+func (d *doctor) skip(check string, format string, a ...interface{}) {
+	emoji.Printf(":next_track_button:%s: %s\n", check, fmt.Sprintf(format, a...))
+}
+
+// checkConfig reports where the configuration was read from and its problems
+func (d *doctor) checkConfig() {
+	found, err := config.Validate(cfg, cfgFileRead)
+	switch {
+	case err != nil:
+		d.fail("config", "can't validate the configuration: %s", err)
+	case len(found) > 0:
+		for _, e := range found {
+			fmt.Println(e.Error())
+		}
+		d.fail("config", "found %d problems in the configuration", len(found))
+	default:
+		from := cfgFileRead
+		if from == "" {
+			from = "the environment and the flags, without config file"
+		}
+		d.pass("config", "loaded from %s, %s mode, %s log source", from, cfg.RunMode, cfg.LogSource)
+	}
+}
+
+// destination returns the destination of the checks: the flags, over the destination profile,
+// over the overrides of the configuration, over localhost:80 with http
+func (d *doctor) destination(name string, destAddr string, port int, protocol string) ftwhttp.Destination {
+	dest := ftwhttp.Destination{DestAddr: "localhost", Port: 80, Protocol: "http"}
+	input := cfg.TestOverride.Input
+	if input.DestAddr != nil {
+		dest.DestAddr = *input.DestAddr
+	}
+	if input.Port != nil {
+		dest.Port = int(*input.Port)
+	}
+	if input.Protocol != nil {
+		dest.Protocol = *input.Protocol
+	}
+	if profile, ok := cfg.Destinations[name]; ok {
+		if profile.DestAddr != "" {
+			dest.DestAddr = profile.DestAddr
+		}
+		if profile.Port != 0 {
+			dest.Port = profile.Port
+		}
+		if profile.Protocol != "" {
+			dest.Protocol = profile.Protocol
+		}
+		if profile.InsecureSkipVerify || profile.ServerName != "" {
+			dest.TLS = &ftwhttp.TLSConfig{InsecureSkipVerify: profile.InsecureSkipVerify, ServerName: profile.ServerName}
+		}
+	} else if name != "" {
+		d.fail("destination", "unknown destination %q, add it to the destinations of the configuration", name)
+	}
+	if destAddr != "" {
+		dest.DestAddr = destAddr
+	}
+	if port != 0 {
+		dest.Port = port
+	}
+	if protocol != "" {
+		dest.Protocol = protocol
+	}
+	return dest
+}
+
+// checkDestination reports whether a connection to the destination can be opened
+func (d *doctor) checkDestination(dest ftwhttp.Destination, timeout time.Duration) (ftwhttp.Destination, bool) {
+	if cfg.RunMode == config.EmbeddedRunMode {
+		d.skip("destination", "the requests are evaluated by the embedded WAF")
+		return dest, false
+	}
+	addr := net.JoinHostPort(dest.DestAddr, strconv.Itoa(dest.Port))
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		d.fail("destination", "can't connect to %s: %s", addr, err)
+		return dest, false
+	}
+	conn.Close()
+	d.pass("destination", "%s://%s is reachable", dest.Protocol, addr)
+	return dest, true
+}
+
+// checkLogs reports whether the log file can be read, whether the WAF writes to it, and whether
+// a marker request is found in the logs
+func (d *doctor) checkLogs(dest ftwhttp.Destination, reachable bool, timeout time.Duration) {
+	switch {
+	case cfg.RunMode != config.DefaultRunMode:
+		d.skip("logs", "the logs are not read in %s mode", cfg.RunMode)
+		return
+	case cfg.LogSource != config.FileLogSource:
+		d.skip("log file", "the logs are read from the %s log source", cfg.LogSource)
+	case cfg.LogFile == "":
+		d.fail("log file", "no log file in the configuration, set logfile")
+		return
+	default:
+		f, err := os.Open(cfg.LogFile)
+		if err != nil {
+			d.fail("log file", "can't read %s: %s", cfg.LogFile, err)
+			return
+		}
+		f.Close()
+		d.pass("log file", "%s is readable", cfg.LogFile)
+	}
+	if !reachable {
+		d.skip("marker", "the destination is not reachable")
+		return
+	}
+
+	before, sized := logFileSize()
+	err := runner.CheckMarker(cfg, dest, runner.NewConfig(runner.WithConnectTimeout(timeout)))
+	if after, ok := logFileSize(); sized && ok {
+		if after > before {
+			d.pass("log file", "%s grows with the requests, %d bytes written", cfg.LogFile, after-before)
+		} else {
+			d.fail("log file", "%s doesn't grow with the requests, is it the log file of the WAF of %s?", cfg.LogFile, dest.DestAddr)
+		}
+	}
+	if errors.Is(err, runner.ErrNoMarkers) {
+		d.skip("marker", "the logs of the %s log source are queried for each request, without markers", cfg.LogSource)
+		return
+	}
+	if err != nil {
+		d.fail("marker", "%s", err)
+		return
+	}
+	d.pass("marker", "the marker request was found in the logs")
+}
+
+// logFileSize returns the size of the log file, when the logs are read from a file
+func logFileSize() (int64, bool) {
+	if cfg.LogSource != config.FileLogSource || cfg.LogFile == "" {
+		return 0, false
+	}
+	fi, err := os.Stat(cfg.LogFile)
+	if err != nil {
+		return 0, false
+	}
+	return fi.Size(), true
+}
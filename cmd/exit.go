@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// The exit codes of ftw run, for the CI scripts to tell the failed tests from the runs that
+// couldn't test anything
+const (
+	// exitTestsFailed is the exit code when tests failed
+	exitTestsFailed = 1
+	// exitError is the exit code of the configuration and infrastructure errors, like a bad
+	// flag, a destination that can't be reached or markers that are not found
+	exitError = 2
+	// exitNoTests is the exit code when no test was selected, like with an --include matching none
+	exitNoTests = 3
+	// exitInterrupted is the exit code when the run was interrupted by a signal, like the one of
+	// the shells for SIGINT
+	exitInterrupted = 130
+)
+
+// fatalWriter writes the logs to out, and exits with exitError once a fatal error is written,
+// instead of the exit code 1 of zerolog
+type fatalWriter struct {
+	out io.Writer
+}
+
+func (w fatalWriter) Write(p []byte) (int, error) {
+	return w.out.Write(p)
+}
+
+func (w fatalWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	n, err := w.out.Write(p)
+	if level == zerolog.FatalLevel {
+		os.Exit(exitError)
+	}
+	return n, err
+}
+
+// runExitCode returns the exit code of a run with the statistics
+func runExitCode(stats runner.TestStats) int {
+	switch {
+	case stats.Interrupted:
+		return exitInterrupted
+	case stats.TotalFailed() > 0:
+		return exitTestsFailed
+	case stats.Run == 0:
+		return exitNoTests
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/history"
+)
+
+// flakyCmd represents the flaky command
+var flakyCmd = &cobra.Command{
+	Use:   "flaky",
+	Short: "Lists the tests whose result flips between runs.",
+	Long:  `Lists the tests whose result flipped between passed and failed in the previous runs with the same configuration, kept in the history file written with 'ftw run --history'. Flaky tests often have problems with their markers, or race with the logs of the WAF.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		minFlips, _ := cmd.Flags().GetInt("min-flips")
+		runs, output := readHistory(cmd)
+
+		flaky := history.Flaky(runs, minFlips)
+		var err error
+		if output == "json" {
+			if flaky == nil {
+				flaky = []history.FlakyTest{}
+			}
+			err = printHistoryJSON(os.Stdout, flaky)
+		} else {
+			err = printFlakyTable(os.Stdout, flaky)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/flaky: cannot print the flaky tests")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(flakyCmd)
+	flakyCmd.Flags().StringP("file", "f", defaultHistoryFile, "history file written with 'ftw run --history'")
+	flakyCmd.Flags().Int("last", 20, "number of runs to read, the most recent ones, 0 to read all of them")
+	flakyCmd.Flags().Int("min-flips", 2, "number of times the result of a test must flip to be flaky")
+	flakyCmd.Flags().StringP("output", "o", "table", "output format: table or json")
+}
+
+func printFlakyTable(w io.Writer, flaky []history.FlakyTest) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEST\tFILE\tCONFIG\tRUNS\tPASSED\tFAILED\tFLIPS\tLAST")
+	for _, f := range flaky {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", f.Test, f.File, f.Config, f.Runs, f.Passed, f.Failed, f.Flips, f.LastResult)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/generate"
+)
+
+// generateCmd represents the generate command
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate test skeletons from captured traffic",
+	Long:  `Generate test skeletons from captured traffic, curl commands or raw requests. Every request becomes a test with the input filled in, and the expected output left for you to add. ftw generate gotest generates a Go test running the tests instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		harFile, _ := cmd.Flags().GetString("from-har")
+		curlCommand, _ := cmd.Flags().GetString("from-curl")
+		rawFile, _ := cmd.Flags().GetString("from-raw")
+		protocol, _ := cmd.Flags().GetString("protocol")
+		output, _ := cmd.Flags().GetString("output")
+		prefix, _ := cmd.Flags().GetString("title-prefix")
+
+		var requests []generate.Request
+		var source string
+		switch {
+		case harFile != "":
+			f, err := os.Open(harFile)
+			if err != nil {
+				log.Fatal().Err(err).Msg("ftw/generate: cannot open HAR file")
+			}
+			defer f.Close()
+			if requests, err = generate.FromHAR(f); err != nil {
+				log.Fatal().Err(err).Msg("ftw/generate: cannot read requests")
+			}
+			source = harFile
+		case curlCommand != "":
+			if curlCommand == "-" {
+				contents, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					log.Fatal().Err(err).Msg("ftw/generate: cannot read curl command")
+				}
+				curlCommand = string(contents)
+			}
+			request, err := generate.FromCurl(curlCommand)
+			if err != nil {
+				log.Fatal().Err(err).Msg("ftw/generate: cannot read curl command")
+			}
+			requests = []generate.Request{request}
+			source = "curl"
+		case rawFile != "":
+			f, err := os.Open(rawFile)
+			if err != nil {
+				log.Fatal().Err(err).Msg("ftw/generate: cannot open raw request file")
+			}
+			defer f.Close()
+			request, err := generate.FromRawRequest(f, protocol)
+			if err != nil {
+				log.Fatal().Err(err).Msg("ftw/generate: cannot read raw request")
+			}
+			requests = []generate.Request{request}
+			source = rawFile
+		default:
+			log.Fatal().Msg("ftw/generate: nothing to generate from, use --from-har, --from-curl or --from-raw")
+		}
+
+		writeGeneratedTest(source, output, prefix, requests)
+	},
+}
+
+// generateGoTestCmd represents the generate gotest command
+var generateGoTestCmd = &cobra.Command{
+	Use:   "gotest",
+	Short: "Generate a Go test file running the tests",
+	Long:  `Generate a _test.go file running the yaml tests of a directory with go test, every file of tests as a subtest, so go test is the only entry point of the CI. The file reads the configuration of ftw when the tests run, and is only built with its build tag.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		output, _ := cmd.Flags().GetString("output")
+		pkg, _ := cmd.Flags().GetString("package")
+		testName, _ := cmd.Flags().GetString("test-name")
+		tag, _ := cmd.Flags().GetString("tag")
+		parallel, _ := cmd.Flags().GetBool("parallel")
+
+		// the paths of the file are relative to its directory, where go test runs it
+		configFile := cfgFile
+		if configFile == "" {
+			configFile = ".ftw.yaml"
+		}
+		if output != "" {
+			dir = relativeTo(filepath.Dir(output), dir)
+			configFile = relativeTo(filepath.Dir(output), configFile)
+		}
+		if pkg == "" {
+			pkg = "waf"
+			if output != "" {
+				if abs, err := filepath.Abs(filepath.Dir(output)); err == nil {
+					pkg = strings.NewReplacer("-", "_", ".", "_").Replace(filepath.Base(abs))
+				}
+			}
+		}
+
+		out, err := generate.GoTest(generate.GoTestOptions{
+			Package:  pkg,
+			TestName: testName,
+			Tag:      tag,
+			Dir:      filepath.ToSlash(dir),
+			Config:   filepath.ToSlash(configFile),
+			Profile:  profile,
+			Parallel: parallel,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/generate: cannot generate the Go test")
+		}
+		if output == "" {
+			_, err = os.Stdout.Write(out)
+		} else {
+			err = os.WriteFile(output, out, 0644)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/generate: cannot write the Go test")
+		}
+	},
+}
+
+// relativeTo returns the path relative to dir, or the path itself when it can't be
+func relativeTo(dir string, path string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+	generateCmd.AddCommand(generateGoTestCmd)
+	generateCmd.Flags().String("from-har", "", "generate one test per request recorded in this HAR file")
+	generateCmd.Flags().String("from-curl", "", "generate a test from this curl command line, or from stdin with -")
+	generateCmd.Flags().String("from-raw", "", "generate a test from the raw HTTP request in this file")
+	generateCmd.Flags().String("protocol", "http", "protocol used to send the raw request (http or https)")
+	generateCmd.Flags().StringP("output", "o", "", "write the tests to this file instead of stdout")
+	generateCmd.Flags().String("title-prefix", "", "prefix of the test titles (default is the name of the source file)")
+	generateGoTestCmd.Flags().StringP("dir", "d", ".", "directory of the yaml tests, searched recursively")
+	generateGoTestCmd.Flags().StringP("output", "o", "", "write the Go test to this file instead of stdout, like waf/ftw_test.go")
+	generateGoTestCmd.Flags().String("package", "", "package of the Go test (default is the name of the directory of the output, or waf)")
+	generateGoTestCmd.Flags().String("test-name", "TestWAF", "name of the test function")
+	generateGoTestCmd.Flags().String("tag", "waf", "build tag of the Go test, empty to always build it")
+	generateGoTestCmd.Flags().Bool("parallel", false, "run the files of tests in parallel, only when the logs of every request are found on their own, like in embedded mode")
+}
+
+func writeGeneratedTest(source string, output string, prefix string, requests []generate.Request) {
+	base := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	if prefix == "" {
+		prefix = base
+	}
+	name := base + ".yaml"
+	if output != "" {
+		name = filepath.Base(output)
+	}
+
+	ftwTest, err := generate.NewTest(name, fmt.Sprintf("Generated from %s", filepath.Base(source)), prefix, requests)
+	if err != nil {
+		log.Fatal().Err(err).Msg("ftw/generate: cannot generate test")
+	}
+	out, err := generate.Marshal(ftwTest)
+	if err != nil {
+		log.Fatal().Err(err).Msg("ftw/generate: cannot write test")
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = os.WriteFile(output, out, 0644)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("ftw/generate: cannot write test")
+	}
+}
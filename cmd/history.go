@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/history"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Shows the results of the previous runs.",
+	Long:  `Shows the results of the previous runs, kept in the history file written with 'ftw run --history'.`,
+}
+
+// historyShowCmd represents the history show command
+var historyShowCmd = &cobra.Command{
+	Use:   "show TEST",
+	Short: "Shows the results of tests in the previous runs.",
+	Long:  `Shows the results of the tests whose title starts with the Go regexp, like 942100, in the previous runs, the oldest first.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runs, output := readHistory(cmd)
+		title, err := regexp.Compile("^(?:" + args[0] + ")")
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/history: bad test regexp")
+		}
+		entries := history.Tests(runs, title)
+		if output == "json" {
+			if entries == nil {
+				entries = []history.Entry{}
+			}
+			err = printHistoryJSON(os.Stdout, entries)
+		} else {
+			err = printHistoryTests(os.Stdout, entries)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/history: cannot print the results")
+		}
+	},
+}
+
+// historyRunsCmd represents the history runs command
+var historyRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Shows the totals of the previous runs.",
+	Long:  `Shows the number of tests passed, failed and skipped by the previous runs, and the time they took, the oldest first.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runs, output := readHistory(cmd)
+		var err error
+		if output == "json" {
+			summaries := make([]historyRunSummary, 0, len(runs))
+			for _, run := range runs {
+				summaries = append(summaries, summarizeRun(run))
+			}
+			err = printHistoryJSON(os.Stdout, summaries)
+		} else {
+			err = printHistoryRuns(os.Stdout, runs)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/history: cannot print the runs")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyShowCmd, historyRunsCmd)
+	historyCmd.PersistentFlags().StringP("file", "f", defaultHistoryFile, "history file written with 'ftw run --history'")
+	historyCmd.PersistentFlags().Int("last", 20, "number of runs to read, the most recent ones, 0 to read all of them")
+	historyCmd.PersistentFlags().StringP("output", "o", "table", "output format: table or json")
+}
+
+// defaultHistoryFile is the history file read by default
+const defaultHistoryFile = "ftw-history.jsonl"
+
+// historyRunSummary are the totals of a run of the history
+type historyRunSummary struct {
+	ID         string    `json:"id"`
+	FinishedAt time.Time `json:"finished_at"`
+	Config     string    `json:"config,omitempty"`
+	Tests      int       `json:"tests"`
+	Passed     int       `json:"passed"`
+	Failed     int       `json:"failed"`
+	Skipped    int       `json:"skipped"`
+	// Time is the time spent running the tests, in seconds
+	Time float64 `json:"time"`
+}
+
+func summarizeRun(run history.Run) historyRunSummary {
+	summary := historyRunSummary{ID: run.ID, FinishedAt: run.FinishedAt, Config: run.Config, Tests: len(run.Tests), Time: run.Time}
+	for _, t := range run.Tests {
+		switch {
+		case t.Passed():
+			summary.Passed++
+		case t.Failed():
+			summary.Failed++
+		default:
+			summary.Skipped++
+		}
+	}
+	return summary
+}
+
+// readHistory returns the runs of the history file and the output format of the command
+func readHistory(cmd *cobra.Command) ([]history.Run, string) {
+	file, _ := cmd.Flags().GetString("file")
+	last, _ := cmd.Flags().GetInt("last")
+	output, _ := cmd.Flags().GetString("output")
+
+	if output != "table" && output != "json" {
+		log.Fatal().Msgf("unknown output format %q, use one of: table, json", output)
+	}
+	runs, err := history.NewStore(file).Runs(last)
+	if err != nil {
+		log.Fatal().Err(err).Msg("ftw/history: cannot read the history")
+	}
+	return runs, output
+}
+
+func printHistoryJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func printHistoryTests(w io.Writer, entries []history.Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tTEST\tRESULT\tTIME\tRULES")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.3fs\t%s\n", entry.RunAt.Local().Format(time.RFC3339), entry.Test,
+			entry.Result, entry.Time, formatIDs(entry.TriggeredRules))
+	}
+	return tw.Flush()
+}
+
+func printHistoryRuns(w io.Writer, runs []history.Run) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tID\tCONFIG\tTESTS\tPASSED\tFAILED\tSKIPPED\tTIME")
+	for _, run := range runs {
+		s := summarizeRun(run)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%.3fs\n", s.FinishedAt.Local().Format(time.RFC3339), s.ID, s.Config,
+			s.Tests, s.Passed, s.Failed, s.Skipped, s.Time)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kyokomi/emoji"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Checks the quality of ftw tests.",
+	Long:  `Checks the quality of ftw tests, reporting duplicate test titles, stages without assertions, assertions that contradict each other, and deprecated fields. Exits with status 1 when problems are found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		output, _ := cmd.Flags().GetString("output")
+
+		if output != "text" && output != "json" {
+			log.Fatal().Msgf("unknown output format %q, use one of: text, json", output)
+		}
+
+		files := fmt.Sprintf("%s/**/*.yaml", dir)
+		log.Trace().Msgf("ftw/lint: linting files using glob pattern: %s", files)
+		tests, err := test.GetTestsFromFiles(files)
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/lint: cannot read tests")
+		}
+
+		issues := test.Lint(tests)
+		if output == "json" {
+			if issues == nil {
+				issues = []test.LintIssue{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err = encoder.Encode(issues); err != nil {
+				log.Fatal().Err(err).Msg("ftw/lint: cannot print issues")
+			}
+		} else {
+			for _, issue := range issues {
+				fmt.Println(issue.String())
+			}
+			if len(issues) > 0 {
+				emoji.Printf("ftw/lint: :collision: linted %d files, found %d problems\n", len(tests), len(issues))
+			} else {
+				emoji.Printf("ftw/lint: linted %d files, everything looks good!\n", len(tests))
+			}
+		}
+
+		if len(issues) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringP("dir", "d", ".", "recursively find yaml tests in this directory")
+	lintCmd.Flags().StringP("output", "o", "text", "output format: text or json")
+}
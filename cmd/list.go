@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tests",
+	Long:  `List all tests below a certain subdirectory, showing their files, number of stages, tags, platforms, and whether they would be skipped using the current configuration.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		exclude, _ := cmd.Flags().GetString("exclude")
+		include, _ := cmd.Flags().GetString("include")
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		output, _ := cmd.Flags().GetString("output")
+
+		if output != "table" && output != "json" {
+			log.Fatal().Msgf("unknown output format %q, use one of: table, json", output)
+		}
+
+		files := fmt.Sprintf("%s/**/*.yaml", dir)
+		tests, err := test.GetTestsFromFiles(files)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot read tests")
+		}
+
+		var includeRE *regexp.Regexp
+		if include != "" {
+			if includeRE, err = regexp.Compile(include); err != nil {
+				log.Fatal().Err(err).Msg("ftw/list: bad --include")
+			}
+		}
+		var excludeRE *regexp.Regexp
+		if exclude != "" {
+			if excludeRE, err = regexp.Compile(exclude); err != nil {
+				log.Fatal().Err(err).Msg("ftw/list: bad --exclude")
+			}
+		}
+
+		entries := filterByTags(runner.ListTests(cfg, tests, runner.Config{
+			Include: includeRE,
+			Exclude: excludeRE,
+		}), tags)
+
+		if output == "json" {
+			err = printListJSON(os.Stdout, entries)
+		} else {
+			err = printListTable(os.Stdout, entries)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot print test list")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringP("dir", "d", ".", "recursively find yaml tests in this directory")
+	listCmd.Flags().StringP("exclude", "e", "", "mark tests matching this Go regexp as skipped")
+	listCmd.Flags().StringP("include", "i", "", "mark tests not matching this Go regexp as skipped")
+	listCmd.Flags().StringSlice("tag", nil, "only list tests having one of these tags")
+	listCmd.Flags().StringP("output", "o", "table", "output format: table or json")
+}
+
+// filterByTags keeps the entries having at least one of the tags
+func filterByTags(entries []runner.TestListEntry, tags []string) []runner.TestListEntry {
+	if len(tags) == 0 {
+		return entries
+	}
+	var filtered []runner.TestListEntry
+	for _, entry := range entries {
+		for _, tag := range tags {
+			if containsString(entry.Tags, tag) {
+				filtered = append(filtered, entry)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func containsString(list []string, s string) bool {
+	for _, candidate := range list {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+func printListJSON(w io.Writer, entries []runner.TestListEntry) error {
+	if entries == nil {
+		entries = []runner.TestListEntry{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func printListTable(w io.Writer, entries []runner.TestListEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFILE\tSTAGES\tTAGS\tPLATFORMS\tSKIPPED\tREASON")
+	for _, entry := range entries {
+		skipped := "no"
+		if entry.Skipped {
+			skipped = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", entry.ID, entry.File, entry.Stages,
+			strings.Join(entry.Tags, ","), strings.Join(entry.Platforms, ","), skipped, entry.Reason)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kyokomi/emoji"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/generate"
+)
+
+// newCmd represents the new command
+var newCmd = &cobra.Command{
+	Use:   "new RULE_ID",
+	Short: "Create a test file for a rule",
+	Long:  `Create a test file for a CRS rule, with the titles, meta block, and stages following the CRS conventions. The file is written to the directory of the rule file (e.g. REQUEST-942-APPLICATION-ATTACK-SQLI) when there is one.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		author, _ := cmd.Flags().GetString("author")
+		tests, _ := cmd.Flags().GetInt("tests")
+		output, _ := cmd.Flags().GetString("output")
+		force, _ := cmd.Flags().GetBool("force")
+		ruleID := args[0]
+
+		out, err := generate.Scaffold(ruleID, author, tests)
+		if err != nil {
+			log.Fatal().Err(err).Msg("ftw/new: cannot create test")
+		}
+
+		if output == "-" {
+			if _, err = os.Stdout.Write(out); err != nil {
+				log.Fatal().Err(err).Msg("ftw/new: cannot write test")
+			}
+			return
+		}
+		if output == "" {
+			if output, err = generate.ScaffoldPath(dir, ruleID); err != nil {
+				log.Fatal().Err(err).Msg("ftw/new: cannot find where to write the test")
+			}
+		}
+		if _, err = os.Stat(output); err == nil && !force {
+			log.Fatal().Msgf("ftw/new: %s already exists, use --force to overwrite it", output)
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Fatal().Err(err).Msgf("ftw/new: cannot check %s", output)
+		}
+		if err = os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			log.Fatal().Err(err).Msg("ftw/new: cannot create directory")
+		}
+		if err = os.WriteFile(output, out, 0644); err != nil {
+			log.Fatal().Err(err).Msg("ftw/new: cannot write test")
+		}
+		emoji.Printf("ftw/new: :sparkles: created %s\n", output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(newCmd)
+	newCmd.Flags().StringP("dir", "d", ".", "directory with the test files, like tests/regression/tests in CRS")
+	newCmd.Flags().String("author", os.Getenv("USER"), "author of the tests")
+	newCmd.Flags().Int("tests", 1, "number of tests to create")
+	newCmd.Flags().StringP("output", "o", "", "write the file here instead of the rule directory, - for stdout")
+	newCmd.Flags().Bool("force", false, "overwrite the file if it exists")
+}
@@ -1,22 +1,90 @@
 package cmd
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 
+	"github.com/kyokomi/emoji"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/logging"
+	"github.com/coreruleset/go-ftw/utils"
 )
 
 var (
 	cfgFile string
+	profile string
 	debug   bool
 	trace   bool
 	cloud   bool
+	plain   bool
+	// ftwLog is the configuration of the logs of ftw, apart from the results of the tests
+	ftwLog logging.Config
+	// cfg is the configuration read when the command starts
+	cfg *config.FTWConfiguration
+	// cfgFileRead is the file the configuration was read from, empty when it was read from
+	// the environment and the flags only
+	cfgFileRead string
 )
 
+// configFlags are the flags setting values of the configuration, with the path of their key in
+// the config file. They take precedence over the environment and the config file.
+var configFlags = map[string]string{
+	"log-file":                   "logfile",
+	"log-files":                  "logfiles",
+	"log-format":                 "logformat",
+	"log-source":                 "logsource",
+	"log-marker-header-name":     "logmarkerheadername",
+	"log-marker-field":           "logmarkerfield",
+	"log-marker-watch":           "logmarkerwatch",
+	"log-marker-timeout":         "logmarkertimeout",
+	"max-marker-retries":         "maxmarkerretries",
+	"marker-retry-delay":         "markerretrydelay",
+	"timestamp-fallback":         "timestampfallback",
+	"clock-skew":                 "clockskew",
+	"mode":                       "mode",
+	"cloud-provider":             "cloudprovider",
+	"override-dest-addr":         "testoverride.input.dest_addr",
+	"override-port":              "testoverride.input.port",
+	"override-protocol":          "testoverride.input.protocol",
+	"override-uri-prefix":        "testoverride.uriprefix",
+	"ignore":                     "testoverride.ignore",
+	"force-pass":                 "testoverride.forcepass",
+	"force-fail":                 "testoverride.forcefail",
+	"journald-unit":              "journald.unit",
+	"journald-identifier":        "journald.identifier",
+	"syslog-listen":              "syslog.listen",
+	"syslog-protocol":            "syslog.protocol",
+	"cloudwatch-log-group":       "cloudwatch.loggroup",
+	"cloudwatch-stream-prefix":   "cloudwatch.streamprefix",
+	"cloudwatch-region":          "cloudwatch.region",
+	"cloudwatch-profile":         "cloudwatch.profile",
+	"cloudwatch-poll-interval":   "cloudwatch.pollinterval",
+	"cloudflare-zone-id":         "cloudflare.zoneid",
+	"cloudflare-endpoint":        "cloudflare.endpoint",
+	"cloudflare-poll-interval":   "cloudflare.pollinterval",
+	"cloudflare-timeout":         "cloudflare.timeout",
+	"loganalytics-workspace":     "loganalytics.workspace",
+	"loganalytics-query":         "loganalytics.query",
+	"loganalytics-poll-interval": "loganalytics.pollinterval",
+	"cloudlogging-project":       "cloudlogging.project",
+	"cloudlogging-filter":        "cloudlogging.filter",
+	"cloudlogging-poll-interval": "cloudlogging.pollinterval",
+	"ngwaf-corp":                 "ngwaf.corp",
+	"ngwaf-site":                 "ngwaf.site",
+	"ngwaf-email":                "ngwaf.email",
+	"ngwaf-endpoint":             "ngwaf.endpoint",
+	"ngwaf-poll-interval":        "ngwaf.pollinterval",
+	"embedded-rules":             "embedded.rules",
+	"embedded-directives":        "embedded.directives",
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "ftw run",
@@ -27,8 +95,9 @@ var rootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(version string) {
 	rootCmd.Version = version
+	log.Logger = log.Output(fatalWriter{out: zerolog.ConsoleWriter{Out: os.Stderr}})
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 }
 
@@ -39,27 +108,159 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "override config file (default is $PWD/.ftw.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "merge the values of this profile of the config file over the top-level ones")
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "", false, "debug output")
 	rootCmd.PersistentFlags().BoolVarP(&trace, "trace", "", false, "trace output: really, really verbose")
+	rootCmd.PersistentFlags().StringVar(&ftwLog.Level, "ftw-log-level", "info", "minimum level of the logs of ftw: trace, debug, info, warn, error or disabled (--debug and --trace take precedence)")
+	rootCmd.PersistentFlags().StringVar(&ftwLog.Format, "ftw-log-format", logging.ConsoleFormat, "format of the logs of ftw: console, or json for log collectors")
+	rootCmd.PersistentFlags().StringVar(&ftwLog.File, "ftw-log-file", "", "append the logs of ftw to this file instead of stderr, keeping them apart from the results of the tests")
+	rootCmd.PersistentFlags().BoolVar(&plain, "plain", false, "plain output: text markers instead of emoji and no colors, for CI log viewers (default when NO_COLOR is set)")
 	rootCmd.PersistentFlags().BoolVarP(&cloud, "cloud", "", false, "cloud mode: rely only on HTTP status codes for determining test success or failure (will not process any logs)")
+
+	// the values of the configuration, the defaults are the ones of the config file
+	flags := rootCmd.PersistentFlags()
+	flags.String("log-file", "", "WAF log file (logfile)")
+	flags.StringSlice("log-files", nil, "other WAF log files read with the log file (logfiles)")
+	flags.String("log-format", "", "format of the WAF logs: native, json, audit, coraza, coraza-json, nginx, apache, envoy, coraza-spoa, traefik, naxsi, aws-waf, cloudflare, azure-waf, cloud-armor or ngwaf (logformat)")
+	flags.String("log-source", "", "where the WAF logs are read from: file, journald, syslog, cloudwatch, cloudflare, loganalytics, cloudlogging, ngwaf or ssh://user@host:/path (logsource)")
+	flags.String("log-marker-header-name", "", "header sent with the markers written to the WAF log (logmarkerheadername)")
+	flags.String("log-marker-field", "", "field of the JSON marker lines with the stage ID, instead of searching the header name in the lines (logmarkerfield)")
+	flags.Bool("log-marker-watch", false, "watch the log file for the markers instead of polling it (logmarkerwatch)")
+	flags.Duration("log-marker-timeout", 0, "time to wait for a marker when watching the log file (logmarkertimeout)")
+	flags.Int("max-marker-retries", 0, "number of marker requests sent until the marker is found (maxmarkerretries)")
+	flags.Duration("marker-retry-delay", 0, "time between marker requests (markerretrydelay)")
+	flags.Bool("timestamp-fallback", false, "select the logs by their timestamps when the markers are not found (timestampfallback)")
+	flags.Duration("clock-skew", 0, "time added around a stage when the logs are selected by their timestamps (clockskew)")
+	flags.String("mode", "", "run mode: default, cloud or embedded (mode)")
+	flags.String("cloud-provider", "", "WAF service under test, recognizing its block responses: aws-waf, cloudflare, azure-waf, cloud-armor or ngwaf (cloudprovider)")
+	flags.String("override-dest-addr", "", "send the requests of all tests to this host (testoverride.input.dest_addr)")
+	flags.Int("override-port", 0, "send the requests of all tests to this port (testoverride.input.port)")
+	flags.String("override-protocol", "", "send the requests of all tests with this protocol, http or https (testoverride.input.protocol)")
+	flags.String("override-uri-prefix", "", "prepend this base path to the URI of all tests, like /app1 (testoverride.uriprefix)")
+	flags.StringToString("ignore", nil, "ignore the results of these tests, like 920400-1=reason (testoverride.ignore)")
+	flags.StringToString("force-pass", nil, "pass these tests unconditionally, like 920400-1=reason (testoverride.forcepass)")
+	flags.StringToString("force-fail", nil, "fail these tests unconditionally, like 920400-1=reason (testoverride.forcefail)")
+	flags.String("journald-unit", "", "systemd unit of the web server, with the journald log source (journald.unit)")
+	flags.String("journald-identifier", "", "syslog identifier of the WAF logs, with the journald log source (journald.identifier)")
+	flags.String("syslog-listen", "", "address of the listener, with the syslog log source (syslog.listen)")
+	flags.String("syslog-protocol", "", "protocol of the listener, udp or tcp, with the syslog log source (syslog.protocol)")
+	flags.String("cloudwatch-log-group", "", "log group with the WAF logs, with the cloudwatch log source (cloudwatch.loggroup)")
+	flags.String("cloudwatch-stream-prefix", "", "only read the log streams starting with this prefix, with the cloudwatch log source (cloudwatch.streamprefix)")
+	flags.String("cloudwatch-region", "", "AWS region of the log group, with the cloudwatch log source (cloudwatch.region)")
+	flags.String("cloudwatch-profile", "", "AWS profile with the credentials, with the cloudwatch log source (cloudwatch.profile)")
+	flags.Duration("cloudwatch-poll-interval", 0, "minimum time between queries, with the cloudwatch log source (cloudwatch.pollinterval)")
+	flags.String("cloudflare-zone-id", "", "zone of the site under test, with the cloudflare log source (cloudflare.zoneid)")
+	flags.String("cloudflare-endpoint", "", "GraphQL endpoint of the Cloudflare API, with the cloudflare log source (cloudflare.endpoint)")
+	flags.Duration("cloudflare-poll-interval", 0, "minimum time between queries, with the cloudflare log source (cloudflare.pollinterval)")
+	flags.Duration("cloudflare-timeout", 0, "time to wait for the firewall events of a request, with the cloudflare log source (cloudflare.timeout)")
+	flags.String("loganalytics-workspace", "", "ID of the Log Analytics workspace with the WAF logs, with the loganalytics log source (loganalytics.workspace)")
+	flags.String("loganalytics-query", "", "KQL query selecting the WAF logs, with the loganalytics log source (loganalytics.query)")
+	flags.Duration("loganalytics-poll-interval", 0, "minimum time between queries, with the loganalytics log source (loganalytics.pollinterval)")
+	flags.String("cloudlogging-project", "", "Google Cloud project of the logs, with the cloudlogging log source (cloudlogging.project)")
+	flags.String("cloudlogging-filter", "", "logging query selecting the WAF logs, with the cloudlogging log source (cloudlogging.filter)")
+	flags.Duration("cloudlogging-poll-interval", 0, "minimum time between queries, with the cloudlogging log source (cloudlogging.pollinterval)")
+	flags.String("ngwaf-corp", "", "corp of the site under test, with the ngwaf log source (ngwaf.corp)")
+	flags.String("ngwaf-site", "", "site under test, with the ngwaf log source (ngwaf.site)")
+	flags.String("ngwaf-email", "", "email of the API user, with the ngwaf log source (ngwaf.email)")
+	flags.String("ngwaf-endpoint", "", "endpoint of the Fastly Next-Gen WAF API, with the ngwaf log source (ngwaf.endpoint)")
+	flags.Duration("ngwaf-poll-interval", 0, "minimum time between queries, with the ngwaf log source (ngwaf.pollinterval)")
+	flags.StringSlice("embedded-rules", nil, "files with the rules of the WAF, like the setup and the rules of CRS, in embedded mode (embedded.rules)")
+	flags.String("embedded-directives", "", "directives loaded before the rules, in embedded mode (embedded.directives)")
 }
 
 func initConfig() {
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if plain || utils.NoColor() {
+		utils.SetPlainOutput()
+		ftwLog.NoColor = true
+	}
+	level, err := logging.ParseLevel(ftwLog.Level)
+	if err != nil {
+		log.Fatal().Err(err).Msg("bad --ftw-log-level")
+	}
+	// the file is closed when ftw exits
+	w, _, err := logging.Writer(ftwLog)
+	if err != nil {
+		log.Fatal().Err(err).Msg("can't write the logs of ftw")
+	}
+	log.Logger = log.Output(fatalWriter{out: w})
+	zerolog.SetGlobalLevel(level)
 	if debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 	if trace {
 		zerolog.SetGlobalLevel(zerolog.TraceLevel)
 	}
-	errFile := config.NewConfigFromFile(cfgFile)
-	if errFile != nil {
-		errEnv := config.NewConfigFromEnv()
-		if errEnv != nil {
-			log.Fatalf("cannot read config from file (%s) nor environment (%s).", errFile.Error(), errEnv.Error())
+	cfg, err = config.NewConfig(cfgFile, profile, configFlagValues(rootCmd.PersistentFlags()))
+	switch {
+	case err == nil:
+		cfgFileRead = cfg.File
+	case errors.Is(err, fs.ErrNotExist):
+		log.Fatal().Msgf("cannot use profile %s without config file (%s).", profile, err.Error())
+	default:
+		// the values that could be loaded are checked too, with the file if there is one
+		fileName := ""
+		if cfg != nil {
+			fileName = cfg.File
+		} else if cfgFile != "" {
+			fileName = cfgFile
+		} else if _, errStat := os.Stat(".ftw.yaml"); errStat == nil {
+			fileName = ".ftw.yaml"
+		}
+		found, errValidate := config.Validate(cfg, fileName)
+		if errValidate != nil || len(found) == 0 {
+			log.Fatal().Msgf("cannot read config (%s).", err.Error())
+		}
+		reportConfigProblems(found)
+	}
+}
+
+// configFlagValues returns the values of the configuration set by the flags, by the path of
+// their key in the config file
+func configFlagValues(flags *pflag.FlagSet) map[string]interface{} {
+	values := map[string]interface{}{}
+	for name, key := range configFlags {
+		flag := flags.Lookup(name)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		switch flag.Value.Type() {
+		case "stringSlice":
+			values[key], _ = flags.GetStringSlice(name)
+		case "stringToString":
+			// merged with the ones of the config file, by test ID
+			reasons, _ := flags.GetStringToString(name)
+			tests := make(map[string]interface{}, len(reasons))
+			for id, reason := range reasons {
+				tests[id] = reason
+			}
+			values[key] = tests
+		default:
+			// koanf converts the strings to the types of the configuration
+			values[key] = flag.Value.String()
 		}
 	}
 	if cloud {
-		config.FTWConfig.RunMode = config.CloudRunMode
+		values["mode"] = string(config.CloudRunMode)
+	}
+	return values
+}
+
+// validateConfig checks the configuration of the command, and exits reporting all the problems
+// found, if any
+func validateConfig() {
+	found, err := config.Validate(cfg, cfgFileRead)
+	if err != nil {
+		log.Fatal().Msgf("cannot validate config file (%s).", err.Error())
+	}
+	if len(found) > 0 {
+		reportConfigProblems(found)
+	}
+}
+
+func reportConfigProblems(found []config.ValidationError) {
+	for _, e := range found {
+		fmt.Println(e.Error())
 	}
+	emoji.Printf("ftw/config: :collision: found %d problems in the configuration\n", len(found))
+	os.Exit(exitError)
 }
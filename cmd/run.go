@@ -1,9 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/kyokomi/emoji"
@@ -11,8 +19,15 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/history"
+	"github.com/coreruleset/go-ftw/metrics"
+	"github.com/coreruleset/go-ftw/notify"
+	"github.com/coreruleset/go-ftw/report"
 	"github.com/coreruleset/go-ftw/runner"
 	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/tracing"
+	"github.com/coreruleset/go-ftw/tui"
 )
 
 // cleanCmd represents the clean command
@@ -27,12 +42,39 @@ var runCmd = &cobra.Command{
 		dir, _ := cmd.Flags().GetString("dir")
 		showTime, _ := cmd.Flags().GetBool("time")
 		quiet, _ := cmd.Flags().GetBool("quiet")
+		output, _ := cmd.Flags().GetString("output")
+		outputFile, _ := cmd.Flags().GetString("output-file")
 		connectTimeout, _ := cmd.Flags().GetDuration("connect-timeout")
 		readTimeout, _ := cmd.Flags().GetDuration("read-timeout")
-		if !quiet {
+		maxBodySize, _ := cmd.Flags().GetInt64("max-body-size")
+		bodyTimeout, _ := cmd.Flags().GetDuration("body-timeout")
+		destination, _ := cmd.Flags().GetString("destination")
+		metricsListen, _ := cmd.Flags().GetString("metrics-listen")
+		metricsPushURL, _ := cmd.Flags().GetString("metrics-push-url")
+		metricsJob, _ := cmd.Flags().GetString("metrics-job")
+		otlpEndpoint, _ := cmd.Flags().GetString("otlp-endpoint")
+		jsonReport, _ := cmd.Flags().GetString("json-report")
+		csvReport, _ := cmd.Flags().GetString("csv-report")
+		historyFile, _ := cmd.Flags().GetString("history")
+		junitReport, _ := cmd.Flags().GetString("junit-report")
+		codeQualityReport, _ := cmd.Flags().GetString("code-quality-report")
+		gitlab, _ := cmd.Flags().GetBool("gitlab")
+		notifyURL, _ := cmd.Flags().GetString("notify-url")
+		notifyOn, _ := cmd.Flags().GetString("notify-on")
+		notifyTitle, _ := cmd.Flags().GetString("notify-title")
+		useTUI, _ := cmd.Flags().GetBool("tui")
+		show, _ := cmd.Flags().GetString("show")
+		list, _ := cmd.Flags().GetBool("list")
+		waitForHost, _ := cmd.Flags().GetString("wait-for-host")
+		waitTimeout, _ := cmd.Flags().GetDuration("wait-timeout")
+		debugFailures, _ := cmd.Flags().GetBool("debug-failures")
+		artifacts, _ := cmd.Flags().GetString("artifacts")
+		if !quiet && !list {
 			log.Info().Msgf(emoji.Sprintf(":hammer_and_wrench: Starting tests!\n"))
-		} else {
-			zerolog.SetGlobalLevel(zerolog.Disabled)
+		} else if ftwLog.File == "" {
+			// the logs written to a file don't get in the way of the results. The fatal errors
+			// are kept, as zerolog doesn't exit on the disabled ones.
+			zerolog.SetGlobalLevel(zerolog.FatalLevel)
 		}
 		if id != "" {
 			log.Fatal().Msgf("--id is deprecated in favour of --include|-i")
@@ -40,35 +82,285 @@ var runCmd = &cobra.Command{
 		if exclude != "" && include != "" {
 			log.Fatal().Msgf("You need to choose one: use --include (%s) or --exclude (%s)", include, exclude)
 		}
+		validateConfig()
+		if output != outputText && output != outputNDJSON {
+			log.Fatal().Msgf("unknown output format %q, use one of: %s, %s", output, outputText, outputNDJSON)
+		}
+		if useTUI && plain {
+			log.Fatal().Msg("the terminal UI has no plain output, remove --plain or --tui")
+		}
+		if useTUI && output != outputText {
+			log.Fatal().Msgf("the events of the run are shown by --tui, use the %s output", outputText)
+		}
+		var events *os.File
+		if output == outputNDJSON {
+			events = os.Stdout
+			if outputFile != "" {
+				f, err := os.Create(outputFile)
+				if err != nil {
+					log.Fatal().Err(err).Msg("ftw/run: can't create the output file")
+				}
+				events = f
+			}
+		}
+		if show != showAll && show != showFailures {
+			log.Fatal().Msgf("unknown value %q of --show, use one of: %s, %s", show, showAll, showFailures)
+		}
+		if notifyOn != notifyAlways && notifyOn != notifyFailure {
+			log.Fatal().Msgf("unknown value %q of --notify-on, use one of: %s, %s", notifyOn, notifyAlways, notifyFailure)
+		}
+		if gitlab {
+			if junitReport == "" {
+				junitReport = gitlabJUnitReport
+			}
+			if codeQualityReport == "" {
+				codeQualityReport = gitlabCodeQualityReport
+			}
+		}
 		files := fmt.Sprintf("%s/**/*.yaml", dir)
 		tests, err := test.GetTestsFromFiles(files)
 
+		if errors.Is(err, test.ErrNoTests) {
+			log.Error().Msgf("ftw/run: no tests found in %s", dir)
+			os.Exit(exitNoTests)
+		}
 		if err != nil {
-			log.Fatal().Err(err)
+			log.Fatal().Err(err).Msg("ftw/run: cannot read the tests")
 		}
 
 		var includeRE *regexp.Regexp
 		if include != "" {
-			includeRE = regexp.MustCompile(include)
+			if includeRE, err = regexp.Compile(include); err != nil {
+				log.Fatal().Err(err).Msg("ftw/run: bad --include")
+			}
 		}
 		var excludeRE *regexp.Regexp
 		if exclude != "" {
-			excludeRE = regexp.MustCompile(exclude)
+			if excludeRE, err = regexp.Compile(exclude); err != nil {
+				log.Fatal().Err(err).Msg("ftw/run: bad --exclude")
+			}
+		}
+
+		if list {
+			// the tests selected by the flags and the configuration, without running them
+			entries := runner.ListTests(cfg, tests, runner.NewConfig(runner.WithInclude(includeRE), runner.WithExclude(excludeRE)))
+			if err := printListTable(os.Stdout, entries); err != nil {
+				log.Fatal().Err(err).Msg("ftw/run: cannot print the tests")
+			}
+			return
+		}
+
+		if waitForHost != "" {
+			log.Info().Msgf("ftw/run: waiting up to %s for %s", waitTimeout, waitForHost)
+			ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+			err := ftwhttp.WaitForHost(ctx, waitForHost)
+			cancel()
+			if err != nil {
+				log.Fatal().Err(err).Msg("ftw/run: the destination is not ready")
+			}
+		}
+
+		var collector *metrics.Collector
+		if metricsListen != "" || metricsPushURL != "" {
+			collector = metrics.NewCollector()
+		}
+		var metricsServer *http.Server
+		if metricsListen != "" {
+			metricsServer, err = serveMetrics(metricsListen, collector)
+			if err != nil {
+				log.Fatal().Err(err).Msg("ftw/run: can't serve the metrics")
+			}
+		}
+
+		shutdownTracing := func(context.Context) error { return nil }
+		if tracesEndpoint := tracing.TracesEndpoint(otlpEndpoint); tracesEndpoint != "" {
+			// the version has the build details on the next lines
+			version, _, _ := strings.Cut(rootCmd.Version, "\n")
+			shutdownTracing = tracing.Setup(tracesEndpoint, version)
+		}
+
+		// the run stops after the current stage on SIGINT or SIGTERM, and the summary and the
+		// reports are the ones of the tests completed so far
+		interrupted, stopSignals := interruptContext()
+		// the events written to stdout replace the results of the tests
+		runConfig := runner.NewConfig(
+			runner.WithInclude(includeRE),
+			runner.WithExclude(excludeRE),
+			runner.WithShowTime(showTime),
+			runner.WithQuiet(quiet || events == os.Stdout),
+			runner.WithFailuresOnly(show == showFailures),
+			runner.WithDebugFailures(debugFailures),
+			runner.WithEvidence(artifacts != ""),
+			runner.WithConnectTimeout(connectTimeout),
+			runner.WithReadTimeout(readTimeout),
+			runner.WithMaxBodySize(maxBodySize),
+			runner.WithBodyTimeout(bodyTimeout),
+			runner.WithDestination(destination),
+			runner.WithMetrics(collector),
+			runner.WithEvents(eventsWriter(events)),
+			runner.WithContext(interrupted),
+		)
+		var currentRun runner.TestRunContext
+		if useTUI {
+			currentRun, err = tui.Run(cfg, tests, runConfig)
+			if err != nil {
+				log.Fatal().Err(err).Msg("ftw/run: the tests were not all run")
+			}
+		} else {
+			currentRun = runner.Run(cfg, tests, runConfig)
+		}
+		stopSignals()
+		if events != nil && events != os.Stdout {
+			if err := events.Close(); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the events were not all written")
+			}
+		}
+		if currentRun.Err != nil {
+			log.Fatal().Err(currentRun.Err).Msg("ftw/run: the tests were not all run")
+		}
+
+		if historyFile != "" {
+			if err := history.NewStore(historyFile).Add(history.NewRun(currentRun.Stats, history.Fingerprint(cfg, include, exclude, destination))); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the run was not added to the history")
+			}
+		}
+		if jsonReport != "" {
+			if err := writeReport(jsonReport, report.WriteJSON, currentRun.Stats); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the JSON report was not written")
+			}
+		}
+		if csvReport != "" {
+			if err := writeReport(csvReport, report.WriteCSV, currentRun.Stats); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the CSV report was not written")
+			}
+		}
+		if junitReport != "" {
+			if err := writeReport(junitReport, report.WriteJUnit, currentRun.Stats); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the JUnit report was not written")
+			}
+		}
+		if artifacts != "" {
+			if err := report.WriteArtifacts(artifacts, currentRun.Stats); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the artifacts of the failed tests were not all written")
+			}
+		}
+		if codeQualityReport != "" {
+			if err := writeReport(codeQualityReport, report.WriteCodeQuality, currentRun.Stats); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the code quality report was not written")
+			}
 		}
 
-		currentRun := runner.Run(tests, runner.Config{
-			Include:        includeRE,
-			Exclude:        excludeRE,
-			ShowTime:       showTime,
-			Quiet:          quiet,
-			ConnectTimeout: connectTimeout,
-			ReadTimeout:    readTimeout,
-		})
+		if notifyURL != "" && (notifyOn == notifyAlways || currentRun.Stats.TotalFailed() > 0) {
+			client := &http.Client{Timeout: notifyTimeout}
+			if err := notify.Send(client, notifyURL, notify.NewSummary(notifyTitle, currentRun.Stats)); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the summary was not sent")
+			}
+		}
+
+		if metricsPushURL != "" {
+			client := &http.Client{Timeout: metricsPushTimeout}
+			if err := collector.Push(client, metricsPushURL, metricsJob); err != nil {
+				log.Error().Err(err).Msg("ftw/run: the metrics were not pushed")
+			}
+		}
+		if metricsServer != nil {
+			_ = metricsServer.Close()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error().Err(err).Msg("ftw/run: the spans were not all sent")
+		}
+		cancel()
 
-		os.Exit(currentRun.Stats.TotalFailed())
+		if currentRun.Stats.Run == 0 {
+			log.Warn().Msg("ftw/run: no test was run, check the directory and the selection of the tests")
+		}
+		os.Exit(runExitCode(currentRun.Stats))
 	},
 }
 
+const (
+	// metricsPushTimeout is the time allowed to push the metrics to the Pushgateway
+	metricsPushTimeout = 10 * time.Second
+	// tracingShutdownTimeout is the time allowed to send the last spans
+	tracingShutdownTimeout = 10 * time.Second
+	// gitlabJUnitReport and gitlabCodeQualityReport are the reports written with --gitlab, unless
+	// other files are set
+	gitlabJUnitReport       = "ftw-junit.xml"
+	gitlabCodeQualityReport = "gl-code-quality-report.json"
+	// notifyTimeout is the time allowed to send the summary to the webhook
+	notifyTimeout = 10 * time.Second
+	// outputText and outputNDJSON are the values of --output
+	outputText   = "text"
+	outputNDJSON = "ndjson"
+	// notifyAlways and notifyFailure are the values of --notify-on
+	notifyAlways  = "always"
+	notifyFailure = "failure"
+	// showAll and showFailures are the values of --show
+	showAll      = "all"
+	showFailures = "failures"
+)
+
+// interruptContext returns a context done once SIGINT or SIGTERM is received. The signals are
+// handled until stop is called, or until the first one: a second one stops ftw right away.
+func interruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			log.Warn().Msgf("ftw/run: %s received, stopping after the current stage, send it again to stop right away", sig)
+			cancel()
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// eventsWriter returns the writer of the events, nil when they are not written
+func eventsWriter(f *os.File) io.Writer {
+	if f == nil {
+		return nil
+	}
+	return f
+}
+
+// writeReport writes a report of the results of the run to the file
+func writeReport(path string, write func(io.Writer, runner.TestStats) error, stats runner.TestStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, stats); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// serveMetrics serves the metrics of the run on /metrics at the address while the tests run
+func serveMetrics(addr string, collector *metrics.Collector) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: metricsPushTimeout}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("ftw/run: stopped serving the metrics")
+		}
+	}()
+	return server, nil
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().StringP("exclude", "e", "", "exclude tests matching this Go regexp (e.g. to exclude all tests beginning with \"91\", use \"91.*\"). \nIf you want more permanent exclusion, check the 'testoverride' option in the config file.")
@@ -77,6 +369,31 @@ func init() {
 	runCmd.Flags().StringP("dir", "d", ".", "recursively find yaml tests in this directory")
 	runCmd.Flags().BoolP("quiet", "q", false, "do not show test by test, only results")
 	runCmd.Flags().BoolP("time", "t", false, "show time spent per test")
+	runCmd.Flags().Bool("list", false, "list the tests the run would select, with their file and number of stages, without running them")
+	runCmd.Flags().Bool("debug-failures", false, "print the whole request sent, response received and WAF logs of the failed stages, to reproduce the failures")
+	runCmd.Flags().String("show", showAll, "tests shown while running: all, or failures to show only the failed stages with their request, response and logs")
+	runCmd.Flags().StringP("output", "o", outputText, "output format: text, or ndjson to write a line of JSON for every event of the run, like the end of a stage")
+	runCmd.Flags().String("output-file", "", "write the events to this file instead of stdout, with the ndjson output")
+	runCmd.Flags().Bool("tui", false, "show the progress of the run in a terminal UI, to browse the results and the evidence of the failed tests, and run tests again")
+	runCmd.Flags().String("wait-for-host", "", "wait until this address accepts connections, like waf:80, or this URL returns a 2xx status, like http://waf/healthz, before running the tests")
+	runCmd.Flags().Duration("wait-timeout", time.Minute, "maximum time to wait for --wait-for-host")
 	runCmd.Flags().Duration("connect-timeout", 3*time.Second, "timeout for connecting to endpoints during test execution")
 	runCmd.Flags().Duration("read-timeout", 1*time.Second, "timeout for receiving responses during test execution")
+	runCmd.Flags().Int64("max-body-size", ftwhttp.DefaultMaxBodySize, "maximum number of bytes read from response bodies, the rest is discarded, 0 for no limit")
+	runCmd.Flags().String("destination", "", "send the tests to this destination profile of the config file, unless their file selects another one in its meta")
+	runCmd.Flags().String("metrics-listen", "", "serve the Prometheus metrics of the run on /metrics at this address while the tests run, like :9101")
+	runCmd.Flags().String("metrics-push-url", "", "push the Prometheus metrics of the run to the Pushgateway at this URL when the tests are done")
+	runCmd.Flags().String("metrics-job", "ftw", "job of the metrics pushed to the Pushgateway")
+	runCmd.Flags().String("otlp-endpoint", "", "send the spans of the run to this OTLP/HTTP endpoint, like http://collector:4318 (default is to use OTEL_EXPORTER_OTLP_ENDPOINT)")
+	runCmd.Flags().String("history", "", "add the results of the tests to this history file, read by 'ftw history', like "+defaultHistoryFile)
+	runCmd.Flags().String("json-report", "", "write the results of the tests to this file as JSON, to compare them with the ones of another run with 'ftw diff'")
+	runCmd.Flags().String("csv-report", "", "write the results of the stages to this file as CSV, for spreadsheets")
+	runCmd.Flags().String("artifacts", "", "write the request, response and WAF logs of every failed test to a folder of this directory, for CI to upload them")
+	runCmd.Flags().String("junit-report", "", "write the results of the tests to this file as a JUnit XML report, like the test reports of GitLab")
+	runCmd.Flags().String("code-quality-report", "", "write the false positives, the rules triggered by tests expecting them not to trigger, to this file as a GitLab code quality report")
+	runCmd.Flags().Bool("gitlab", false, "write the JUnit report to "+gitlabJUnitReport+" and the code quality report to "+gitlabCodeQualityReport+", unless other files are set")
+	runCmd.Flags().String("notify-url", "", "post the summary of the run to this webhook when the tests are done, like a Slack incoming webhook")
+	runCmd.Flags().String("notify-on", notifyAlways, "when to post the summary: always, or failure to post it only when tests failed")
+	runCmd.Flags().String("notify-title", "ftw", "title of the summary posted to the webhook, like the name of the job")
+	runCmd.Flags().Duration("body-timeout", 0, "timeout for reading response bodies once headers were received (default is to use the read timeout for the whole response)")
 }
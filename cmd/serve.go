@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/dashboard"
+	"github.com/coreruleset/go-ftw/history"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a web dashboard running the tests",
+	Long:  `Serve a web dashboard to run the tests below a certain subdirectory, browse the results of the runs with the request, the response and the logs of the failed tests, and run a selection of the tests again.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		listen, _ := cmd.Flags().GetString("listen")
+		historyFile, _ := cmd.Flags().GetString("history")
+		connectTimeout, _ := cmd.Flags().GetDuration("connect-timeout")
+		readTimeout, _ := cmd.Flags().GetDuration("read-timeout")
+		destination, _ := cmd.Flags().GetString("destination")
+		validateConfig()
+
+		files := fmt.Sprintf("%s/**/*.yaml", dir)
+		load := func() ([]test.FTWTest, error) {
+			return test.GetTestsFromFiles(files)
+		}
+		var store *history.Store
+		if historyFile != "" {
+			store = history.NewStore(historyFile)
+		}
+		server := dashboard.NewServer(cfg, load, runner.Config{
+			ConnectTimeout: connectTimeout,
+			ReadTimeout:    readTimeout,
+			Destination:    destination,
+		}, store)
+
+		log.Info().Msgf("ftw/serve: serving the dashboard on http://%s", listen)
+		httpServer := &http.Server{Addr: listen, Handler: server, ReadHeaderTimeout: serveReadHeaderTimeout}
+		if err := httpServer.ListenAndServe(); err != nil {
+			log.Fatal().Err(err).Msg("ftw/serve: stopped serving the dashboard")
+		}
+	},
+}
+
+// serveReadHeaderTimeout is the time allowed to the browsers to send the headers of the requests
+const serveReadHeaderTimeout = 10 * time.Second
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringP("dir", "d", ".", "recursively find yaml tests in this directory, read again for every run")
+	serveCmd.Flags().String("listen", "localhost:8080", "address to serve the dashboard on")
+	serveCmd.Flags().String("history", "", "add the runs to this history file, and list its previous runs, like "+defaultHistoryFile)
+	serveCmd.Flags().Duration("connect-timeout", 3*time.Second, "timeout for connecting to endpoints during test execution")
+	serveCmd.Flags().Duration("read-timeout", 1*time.Second, "timeout for receiving responses during test execution")
+	serveCmd.Flags().String("destination", "", "send the tests to this destination profile of the config file, unless their file selects another one in its meta")
+}
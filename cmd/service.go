@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/remote"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/service"
+)
+
+// serviceTokenEnv is the environment variable with the token of the API, when it's not set with
+// --token
+const serviceTokenEnv = "FTW_SERVICE_TOKEN"
+
+// serviceCmd represents the service command
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run tests as a service",
+	Long:  `Serve an HTTP API accepting jobs to run the tests of a directory below a certain subdirectory against a destination, and streaming their results. The jobs run one at a time. The same jobs can be run with a gRPC API too.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		listen, _ := cmd.Flags().GetString("listen")
+		grpcListen, _ := cmd.Flags().GetString("grpc-listen")
+		token, _ := cmd.Flags().GetString("token")
+		connectTimeout, _ := cmd.Flags().GetDuration("connect-timeout")
+		readTimeout, _ := cmd.Flags().GetDuration("read-timeout")
+		validateConfig()
+		if token == "" {
+			token = os.Getenv(serviceTokenEnv)
+		}
+		if token == "" {
+			log.Warn().Msgf("ftw/service: the API has no token, anyone reaching it can run tests")
+		}
+
+		s := service.New(cfg, dir, runner.Config{
+			ConnectTimeout: connectTimeout,
+			ReadTimeout:    readTimeout,
+		}, token)
+		go s.Run()
+
+		if grpcListen != "" {
+			go func() {
+				log.Info().Msgf("ftw/service: serving the gRPC API on %s", grpcListen)
+				grpcServer := &http.Server{Addr: grpcListen, Handler: remote.NewServer(s).Handler(), ReadHeaderTimeout: serveReadHeaderTimeout}
+				if err := grpcServer.ListenAndServe(); err != nil {
+					log.Fatal().Err(err).Msg("ftw/service: stopped serving the gRPC API")
+				}
+			}()
+		}
+
+		log.Info().Msgf("ftw/service: serving the API on %s", listen)
+		httpServer := &http.Server{Addr: listen, Handler: s, ReadHeaderTimeout: serveReadHeaderTimeout}
+		if err := httpServer.ListenAndServe(); err != nil {
+			log.Fatal().Err(err).Msg("ftw/service: stopped serving the API")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.Flags().StringP("dir", "d", ".", "directory of the test sets, the jobs run the yaml tests found recursively in one of its directories")
+	serviceCmd.Flags().String("listen", "localhost:8081", "address to serve the API on")
+	serviceCmd.Flags().String("grpc-listen", "", "address to also serve the gRPC API on, over HTTP/2 without TLS (default is not to serve it)")
+	serviceCmd.Flags().String("token", "", "bearer token required by the API (default is to use "+serviceTokenEnv+")")
+	serviceCmd.Flags().Duration("connect-timeout", 3*time.Second, "timeout for connecting to endpoints during test execution")
+	serviceCmd.Flags().Duration("read-timeout", 1*time.Second, "timeout for receiving responses during test execution")
+}
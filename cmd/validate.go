@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kyokomi/emoji"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates ftw test files against the test schema.",
+	Long:  `Validates ftw test files against the test schema, reporting unknown fields, values of the wrong type, and conflicting fields with the file, line and column where they were found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		validateFiles(dir)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringP("dir", "d", ".", "recursively find yaml tests in this directory")
+}
+
+func validateFiles(dir string) {
+	files := fmt.Sprintf("%s/**/*.yaml", dir)
+	log.Trace().Msgf("ftw/validate: validating files using glob pattern: %s", files)
+	found, count, err := test.ValidateTestFiles(files)
+	for _, e := range found {
+		fmt.Println(e.Error())
+	}
+	if err != nil {
+		emoji.Printf("ftw/validate: :collision: oops, found %s\n", err.Error())
+		os.Exit(1)
+	}
+	if len(found) > 0 {
+		emoji.Printf("ftw/validate: :collision: validated %d files, found %d problems\n", count, len(found))
+		os.Exit(1)
+	}
+	emoji.Printf("ftw/validate: validated %d files, everything looks good!\n", count)
+}
@@ -1,106 +1,300 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/textproto"
 	"os"
 	"strings"
 
 	"github.com/knadh/koanf"
 	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
 	"github.com/knadh/koanf/providers/env"
-	"github.com/knadh/koanf/providers/file"
-	"github.com/knadh/koanf/providers/rawbytes"
+
+	"github.com/coreruleset/go-ftw/utils"
 )
 
 // NewConfigFromFile reads configuration information from the config file if it exists,
-// or uses `.ftw.yaml` as default file
-func NewConfigFromFile(cfgFile string) error {
-	// kaonf merges by default but we never want to merge in this case
-	Reset()
+// or uses `.ftw.yaml` as default file. `${NAME}` references to environment variables are
+// expanded in the values of the file.
+func NewConfigFromFile(cfgFile string) (*FTWConfiguration, error) {
+	return NewConfigFromFileWithProfile(cfgFile, "")
+}
 
-	// Global koanf instance. Use "." as the key path delimiter. This can be "/" or any character.
+// NewConfigFromFileWithProfile reads the configuration from the config file like
+// NewConfigFromFile, with the values of the profile merged over the top-level ones. Without
+// profile, only the top-level values are used.
+func NewConfigFromFileWithProfile(cfgFile string, profile string) (*FTWConfiguration, error) {
+	// koanf instance. Use "." as the key path delimiter. This can be "/" or any character.
 	var k = koanf.New(".")
-	var err error
 
+	cfgFile, err := loadFile(k, cfgFile, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// At this point we have loaded our config, now we need to
+	// unmarshal the whole root module
+	cfg, err := unmarshal(k)
+	cfg.Profile = profile
+	cfg.File = cfgFile
+	return cfg, err
+}
+
+// NewConfig reads the configuration from every source, each one taking precedence over the
+// previous ones: the config file if it exists, with the values of the profile like
+// NewConfigFromFileWithProfile, the environment variables starting with `FTW_`, and values,
+// like the command line flags. The keys of values are the paths of the keys in the config file,
+// like `testoverride.input.port`. A profile requires the config file.
+func NewConfig(cfgFile string, profile string, values map[string]interface{}) (*FTWConfiguration, error) {
+	var k = koanf.New(".")
+
+	cfgFile, err := loadFile(k, cfgFile, profile)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) || profile != "" {
+			return nil, err
+		}
+		cfgFile = ""
+	}
+
+	overrides := koanf.New(".")
+	if err = loadEnv(overrides); err != nil {
+		return nil, err
+	}
+	if err = overrides.Load(confmap.Provider(values, "."), nil); err != nil {
+		return nil, err
+	}
+	if err = k.Merge(overrides); err != nil {
+		return nil, err
+	}
+
+	cfg, err := unmarshal(k)
+	cfg.Profile = profile
+	cfg.File = cfgFile
+	cfg.overridden = map[string]bool{}
+	for _, key := range overrides.Keys() {
+		cfg.overridden[key] = true
+	}
+	return cfg, err
+}
+
+// loadFile loads the config file, or `.ftw.yaml` if cfgFile is empty, with the values of the
+// profile merged over the top-level ones. It returns the name of the file.
+func loadFile(k *koanf.Koanf, cfgFile string, profile string) (string, error) {
 	// first check if we had an explicit call with config file
 	if cfgFile == "" {
 		cfgFile = ".ftw.yaml"
 	}
 
-	_, err = os.Stat(cfgFile)
+	contents, err := os.ReadFile(cfgFile)
 	if err != nil { // file exists, so we read it looking for config values
-		return err
+		return cfgFile, err
 	}
 
-	err = k.Load(file.Provider(cfgFile), yaml.Parser())
+	err = loadYaml(k, contents)
+	if err != nil {
+		return cfgFile, err
+	}
+	return cfgFile, selectProfile(k, profile)
+}
+
+// loadYaml loads the YAML contents, with the `${NAME}` references to environment variables
+// expanded in their values once parsed, so the values of the variables are never read as YAML
+func loadYaml(k *koanf.Koanf, contents []byte) error {
+	values, err := yaml.Parser().Unmarshal(contents)
 	if err != nil {
 		return err
 	}
+	for key, value := range values {
+		values[key] = expandEnv(value)
+	}
+	return k.Load(confmap.Provider(values, ""), nil)
+}
 
-	// At this point we have loaded our config, now we need to
-	// unmarshal the whole root module
-	err = k.UnmarshalWithConf("", &FTWConfig, koanf.UnmarshalConf{Tag: "koanf"})
-	loadDefaults()
+// expandEnv expands the environment variables in the strings of the value, and of the mappings
+// and lists it holds
+func expandEnv(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return utils.ExpandEnv(v)
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = expandEnv(item)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = expandEnv(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandEnv(item)
+		}
+	}
+	return value
+}
 
-	return err
+// selectProfile merges the values of the profile over the top-level ones, and removes the
+// profiles from the configuration
+func selectProfile(k *koanf.Koanf, profile string) error {
+	profiles := k.Cut("profiles")
+	k.Delete("profiles")
+	if profile == "" {
+		return nil
+	}
+	if !profiles.Exists(profile) {
+		names := profiles.MapKeys("")
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q, there are no profiles in the config file", profile)
+		}
+		return fmt.Errorf("unknown profile %q, use one of %s", profile, strings.Join(names, ", "))
+	}
+	return k.Merge(profiles.Cut(profile))
 }
 
 // NewConfigFromEnv reads configuration information from environment variables that start with `FTW_`
-func NewConfigFromEnv() error {
-	// kaonf merges by default but we never want to merge in this case
-	Reset()
-
-	var err error
+func NewConfigFromEnv() (*FTWConfiguration, error) {
 	var k = koanf.New(".")
 
-	err = k.Load(env.Provider("FTW_", ".", func(s string) string {
-		return strings.ReplaceAll(strings.ToLower(
-			strings.TrimPrefix(s, "FTW_")), "_", ".")
-	}), nil)
-
-	if err != nil {
-		return err
+	if err := loadEnv(k); err != nil {
+		return nil, err
 	}
 	// Unmarshal the whole root module
-	err = k.UnmarshalWithConf("", &FTWConfig, koanf.UnmarshalConf{Tag: "koanf"})
-	loadDefaults()
+	return unmarshal(k)
+}
 
-	return err
+// loadEnv loads the environment variables that start with `FTW_`, like `FTW_SYSLOG_PROTOCOL`
+// for `syslog.protocol`
+func loadEnv(k *koanf.Koanf) error {
+	return k.Load(env.ProviderWithValue("FTW_", ".", func(s string, value string) (string, interface{}) {
+		key := strings.ReplaceAll(strings.ToLower(
+			strings.TrimPrefix(s, "FTW_")), "_", ".")
+		// dest_addr is the only key with an underscore
+		key = strings.ReplaceAll(key, "dest.addr", "dest_addr")
+		// lists are separated by commas
+		if key == "logfiles" {
+			return key, strings.Split(value, ",")
+		}
+		return key, value
+	}), nil)
 }
 
 // NewConfigFromString initializes the configuration from a yaml formatted string. Useful for testing.
-func NewConfigFromString(conf string) error {
-	// kaonf merges by default but we never want to merge in this case
-	Reset()
-
+func NewConfigFromString(conf string) (*FTWConfiguration, error) {
 	var k = koanf.New(".")
 	var err error
 
-	err = k.Load(rawbytes.Provider([]byte(conf)), yaml.Parser())
+	err = loadYaml(k, []byte(conf))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Unmarshal the whole root module
-	err = k.UnmarshalWithConf("", &FTWConfig, koanf.UnmarshalConf{Tag: "koanf"})
-	loadDefaults()
+	return unmarshal(k)
+}
 
-	return err
+// NewDefaultConfig returns the configuration with the default values, like the one of an empty
+// config file
+func NewDefaultConfig() *FTWConfiguration {
+	cfg := &FTWConfiguration{}
+	cfg.loadDefaults()
+	return cfg
 }
 
-// Reset configuration to uninitialized state
-func Reset() {
-	FTWConfig = nil
+// unmarshal returns the configuration loaded by koanf, with the defaults for the values not set.
+// On errors, the configuration still has the values that could be loaded.
+func unmarshal(k *koanf.Koanf) (*FTWConfiguration, error) {
+	cfg := &FTWConfiguration{}
+	err := k.UnmarshalWithConf("", cfg, koanf.UnmarshalConf{Tag: "koanf"})
+	cfg.loadDefaults()
+	return cfg, err
 }
 
-func loadDefaults() {
+func (c *FTWConfiguration) loadDefaults() {
 	// Note: kaonf has a way to set defaults. However, kaonf's merge behavior
 	// will overwrite defaults when the associated field is empty in nested
 	// structures (top level would work). That's why we set defaults here
 	// explictly.
-	if FTWConfig.LogMarkerHeaderName == "" {
-		FTWConfig.LogMarkerHeaderName = DefaultLogMarkerHeaderName
+	if c.LogMarkerHeaderName == "" {
+		c.LogMarkerHeaderName = DefaultLogMarkerHeaderName
+	}
+	if c.RunMode == "" {
+		c.RunMode = DefaultRunMode
+	}
+	if c.LogFormat == "" {
+		c.LogFormat = NativeLogFormat
+		switch c.LogSource {
+		case CloudflareLogSource:
+			c.LogFormat = CloudflareLogFormat
+		case LogAnalyticsLogSource:
+			c.LogFormat = AzureWAFLogFormat
+		case CloudLoggingLogSource:
+			c.LogFormat = CloudArmorLogFormat
+		case NGWAFLogSource:
+			c.LogFormat = NGWAFLogFormat
+		}
+		// the embedded WAF writes the rules matching like the Coraza error log
+		if c.RunMode == EmbeddedRunMode {
+			c.LogFormat = CorazaLogFormat
+		}
+	}
+	if c.LogSource == "" {
+		c.LogSource = FileLogSource
+	}
+	// the access log of Traefik has the request headers in their own fields
+	if c.LogMarkerField == "" && c.LogFormat == TraefikLogFormat {
+		c.LogMarkerField = TraefikLogMarkerFieldPrefix + textproto.CanonicalMIMEHeaderKey(c.LogMarkerHeaderName)
+	}
+	if c.Syslog.Listen == "" {
+		c.Syslog.Listen = DefaultSyslogListen
+	}
+	if c.Syslog.Protocol == "" {
+		c.Syslog.Protocol = DefaultSyslogProtocol
+	}
+	if c.LogMarkerTimeout == 0 {
+		c.LogMarkerTimeout = DefaultLogMarkerTimeout
+	}
+	if c.MaxMarkerRetries <= 0 {
+		c.MaxMarkerRetries = DefaultMaxMarkerRetries
+	}
+	if c.ClockSkew == 0 {
+		c.ClockSkew = DefaultClockSkew
+	}
+	if c.CloudWatch.PollInterval == 0 {
+		c.CloudWatch.PollInterval = DefaultCloudWatchPollInterval
+	}
+	if c.Cloudflare.Endpoint == "" {
+		c.Cloudflare.Endpoint = DefaultCloudflareEndpoint
+	}
+	if c.Cloudflare.PollInterval == 0 {
+		c.Cloudflare.PollInterval = DefaultCloudflarePollInterval
+	}
+	if c.Cloudflare.Timeout == 0 {
+		c.Cloudflare.Timeout = DefaultCloudflareTimeout
+	}
+	if c.LogAnalytics.Query == "" {
+		c.LogAnalytics.Query = DefaultLogAnalyticsQuery
+	}
+	if c.LogAnalytics.PollInterval == 0 {
+		c.LogAnalytics.PollInterval = DefaultLogAnalyticsPollInterval
+	}
+	if c.CloudLogging.Filter == "" {
+		c.CloudLogging.Filter = DefaultCloudLoggingFilter
+	}
+	if c.CloudLogging.PollInterval == 0 {
+		c.CloudLogging.PollInterval = DefaultCloudLoggingPollInterval
+	}
+	if c.NGWAF.Endpoint == "" {
+		c.NGWAF.Endpoint = DefaultNGWAFEndpoint
+	}
+	if c.NGWAF.PollInterval == 0 {
+		c.NGWAF.PollInterval = DefaultNGWAFPollInterval
+	}
+	if c.Embedded.Directives == "" {
+		c.Embedded.Directives = DefaultEmbeddedDirectives
 	}
-	if FTWConfig.RunMode == "" {
-		FTWConfig.RunMode = DefaultRunMode
+	if len(c.BlockResponses) == 0 {
+		c.BlockResponses = cloudProviderBlockResponses[c.CloudProvider]
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coreruleset/go-ftw/utils"
 )
@@ -36,7 +37,7 @@ var jsonConfig = `
 func TestNewConfigBadFileConfig(t *testing.T) {
 	filename, _ := utils.CreateTempFileWithContent(jsonConfig, "test-*.yaml")
 	defer os.Remove(filename)
-	err := NewConfigFromFile(filename)
+	_, err := NewConfigFromFile(filename)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
@@ -45,20 +46,20 @@ func TestNewConfigBadFileConfig(t *testing.T) {
 func TestNewConfigConfig(t *testing.T) {
 	filename, _ := utils.CreateTempFileWithContent(yamlConfig, "test-*.yaml")
 
-	err := NewConfigFromFile(filename)
+	cfg, err := NewConfigFromFile(filename)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
 
-	if len(FTWConfig.TestOverride.Ignore) == 0 {
+	if len(cfg.TestOverride.Ignore) == 0 {
 		t.Errorf("Failed! Len must be > 0")
 	}
 
-	if reflect.ValueOf(FTWConfig.TestOverride.Input).IsZero() {
+	if reflect.ValueOf(cfg.TestOverride.Input).IsZero() {
 		t.Errorf("Failed! Input must not be empty")
 	}
 
-	for id, text := range FTWConfig.TestOverride.Ignore {
+	for id, text := range cfg.TestOverride.Ignore {
 		if !strings.Contains(id, "920400-1") {
 			t.Errorf("Looks like we could not find item to ignore")
 		}
@@ -67,7 +68,7 @@ func TestNewConfigConfig(t *testing.T) {
 		}
 	}
 
-	overrides := FTWConfig.TestOverride.Input
+	overrides := cfg.TestOverride.Input
 	if overrides.DestAddr != nil && *overrides.DestAddr != "httpbin.org" {
 		t.Errorf("Looks like we are not overriding destination!")
 	}
@@ -76,9 +77,9 @@ func TestNewConfigConfig(t *testing.T) {
 func TestNewConfigBadConfig(t *testing.T) {
 	filename, _ := utils.CreateTempFileWithContent(yamlBadConfig, "test-*.yaml")
 	defer os.Remove(filename)
-	_ = NewConfigFromFile(filename)
+	cfg, _ := NewConfigFromFile(filename)
 
-	if FTWConfig == nil {
+	if cfg == nil {
 		t.Errorf("Failed !")
 	}
 }
@@ -91,22 +92,22 @@ func TestNewConfigDefaultConfig(t *testing.T) {
 		os.Remove(fileName)
 	})
 
-	_ = NewConfigFromFile("")
+	cfg, _ := NewConfigFromFile("")
 
-	if FTWConfig == nil {
+	if cfg == nil {
 		t.Errorf("Failed !")
 	}
 }
 
 func TestNewConfigFromString(t *testing.T) {
-	err := NewConfigFromString(yamlConfig)
+	_, err := NewConfigFromString(yamlConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
 }
 
 func TestNewEnvConfigFromString(t *testing.T) {
-	err := NewConfigFromString(yamlConfig)
+	_, err := NewConfigFromString(yamlConfig)
 	if err != nil {
 		t.Errorf("Failed!")
 	}
@@ -116,27 +117,28 @@ func TestNewConfigFromEnv(t *testing.T) {
 	// Set some environment so it gets merged with conf
 	os.Setenv("FTW_LOGFILE", "kaonf")
 
-	err := NewConfigFromEnv()
+	cfg, err := NewConfigFromEnv()
 
 	if err != nil {
 		t.Error(err)
 	}
 
-	if FTWConfig.LogFile != "kaonf" {
-		t.Errorf(FTWConfig.LogFile)
+	if cfg.LogFile != "kaonf" {
+		t.Errorf(cfg.LogFile)
 	}
 }
 
 func TestNewConfigFromEnvHasDefaults(t *testing.T) {
-	if err := NewConfigFromEnv(); err != nil {
+	cfg, err := NewConfigFromEnv()
+	if err != nil {
 		t.Error(err)
 	}
 
-	if FTWConfig.RunMode != DefaultRunMode {
-		t.Errorf("unexpected default value '%s' for run mode", FTWConfig.RunMode)
+	if cfg.RunMode != DefaultRunMode {
+		t.Errorf("unexpected default value '%s' for run mode", cfg.RunMode)
 	}
-	if FTWConfig.LogMarkerHeaderName != DefaultLogMarkerHeaderName {
-		t.Errorf("unexpected default value '%s' for logmarkerheadername", FTWConfig.LogMarkerHeaderName)
+	if cfg.LogMarkerHeaderName != DefaultLogMarkerHeaderName {
+		t.Errorf("unexpected default value '%s' for logmarkerheadername", cfg.LogMarkerHeaderName)
 	}
 }
 
@@ -144,28 +146,34 @@ func TestNewConfigFromFileHasDefaults(t *testing.T) {
 	filename, _ := utils.CreateTempFileWithContent(yamlConfig, "test-*.yaml")
 	defer os.Remove(filename)
 
-	if err := NewConfigFromFile(filename); err != nil {
+	cfg, err := NewConfigFromFile(filename)
+
+	if err != nil {
 		t.Error(err)
 	}
 
-	if FTWConfig.RunMode != DefaultRunMode {
-		t.Errorf("unexpected default value '%s' for run mode", FTWConfig.RunMode)
+	if cfg.RunMode != DefaultRunMode {
+		t.Errorf("unexpected default value '%s' for run mode", cfg.RunMode)
 	}
-	if FTWConfig.LogMarkerHeaderName != DefaultLogMarkerHeaderName {
-		t.Errorf("unexpected default value '%s' for logmarkerheadername", FTWConfig.LogMarkerHeaderName)
+	if cfg.LogMarkerHeaderName != DefaultLogMarkerHeaderName {
+		t.Errorf("unexpected default value '%s' for logmarkerheadername", cfg.LogMarkerHeaderName)
 	}
 }
 
 func TestNewConfigFromStringHasDefaults(t *testing.T) {
-	if err := NewConfigFromString(""); err != nil {
+	cfg, err := NewConfigFromString("")
+	if err != nil {
 		t.Error(err)
 	}
 
-	if FTWConfig.RunMode != DefaultRunMode {
-		t.Errorf("unexpected default value '%s' for run mode", FTWConfig.RunMode)
+	if cfg.RunMode != DefaultRunMode {
+		t.Errorf("unexpected default value '%s' for run mode", cfg.RunMode)
 	}
-	if FTWConfig.LogMarkerHeaderName != DefaultLogMarkerHeaderName {
-		t.Errorf("unexpected default value '%s' for logmarkerheadername", FTWConfig.LogMarkerHeaderName)
+	if cfg.LogFormat != NativeLogFormat {
+		t.Errorf("unexpected default value '%s' for logformat", cfg.LogFormat)
+	}
+	if cfg.LogMarkerHeaderName != DefaultLogMarkerHeaderName {
+		t.Errorf("unexpected default value '%s' for logmarkerheadername", cfg.LogMarkerHeaderName)
 	}
 }
 
@@ -173,11 +181,458 @@ func TestNewConfigFromFileRunMode(t *testing.T) {
 	filename, _ := utils.CreateTempFileWithContent(yamlCloudConfig, "test-*.yaml")
 	defer os.Remove(filename)
 
-	if err := NewConfigFromFile(filename); err != nil {
+	cfg, err := NewConfigFromFile(filename)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if cfg.RunMode != CloudRunMode {
+		t.Errorf("unexpected value '%s' for run mode, expected '%s;", cfg.RunMode, CloudRunMode)
+	}
+}
+
+func TestNewConfigFromStringLogFormat(t *testing.T) {
+	cfg, err := NewConfigFromString("logformat: json")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if cfg.LogFormat != JSONLogFormat {
+		t.Errorf("unexpected value '%s' for logformat, expected '%s'", cfg.LogFormat, JSONLogFormat)
+	}
+}
+
+func TestNewConfigFromEnvJournald(t *testing.T) {
+	t.Setenv("FTW_LOGSOURCE", "journald")
+	t.Setenv("FTW_JOURNALD_UNIT", "apache2.service")
+	cfg, err := NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if cfg.LogSource != JournaldLogSource {
+		t.Errorf("unexpected value '%s' for logsource, expected '%s'", cfg.LogSource, JournaldLogSource)
+	}
+	if cfg.Journald.Unit != "apache2.service" || cfg.Journald.Identifier != "" {
+		t.Errorf("unexpected journald config %+v", cfg.Journald)
+	}
+}
+
+func TestNewConfigFromStringCloudWatch(t *testing.T) {
+	cfg, err := NewConfigFromString(`---
+logsource: cloudwatch
+cloudwatch:
+  loggroup: /aws/waf
+  region: eu-west-1
+  pollinterval: 5s
+`)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := CloudWatchConfig{LogGroup: "/aws/waf", Region: "eu-west-1", PollInterval: 5 * time.Second}
+	if cfg.LogSource != CloudWatchLogSource || cfg.CloudWatch != expected {
+		t.Errorf("unexpected cloudwatch config %s %+v", cfg.LogSource, cfg.CloudWatch)
+	}
+
+	cfg, err = NewConfigFromString("logsource: cloudwatch")
+
+	if err != nil {
+		t.Error(err)
+	}
+	if cfg.CloudWatch.PollInterval != DefaultCloudWatchPollInterval {
+		t.Errorf("unexpected default poll interval %s", cfg.CloudWatch.PollInterval)
+	}
+}
+
+func TestNewConfigFromStringCloudProvider(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nmode: cloud\ncloudprovider: aws-waf\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(cfg.BlockResponses, AWSWAFBlockResponses) {
+		t.Errorf("unexpected block responses %+v", cfg.BlockResponses)
+	}
+
+	cfg, err = NewConfigFromString("---\ncloudprovider: aws-waf\nblockresponses:\n  - status: [429]\n")
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []FTWBlockResponse{{Status: []int{429}}}
+	if !reflect.DeepEqual(cfg.BlockResponses, expected) {
+		t.Errorf("the block responses must replace the defaults, got %+v", cfg.BlockResponses)
+	}
+}
+
+func TestNewConfigFromStringCloudflare(t *testing.T) {
+	t.Setenv("FTW_CLOUDFLARE_APITOKEN", "token")
+	cfg, err := NewConfigFromString("---\nlogsource: cloudflare\ncloudprovider: cloudflare\ncloudflare:\n  zoneid: zone\n  apitoken: ${FTW_CLOUDFLARE_APITOKEN}\n")
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := CloudflareConfig{ZoneID: "zone", APIToken: "token", Endpoint: DefaultCloudflareEndpoint,
+		PollInterval: DefaultCloudflarePollInterval, Timeout: DefaultCloudflareTimeout}
+	if cfg.Cloudflare != expected {
+		t.Errorf("unexpected cloudflare config %+v", cfg.Cloudflare)
+	}
+	if cfg.LogFormat != CloudflareLogFormat {
+		t.Errorf("the firewall events must be read with the cloudflare log format, got %s", cfg.LogFormat)
+	}
+	if !reflect.DeepEqual(cfg.BlockResponses, CloudflareBlockResponses) {
+		t.Errorf("unexpected block responses %+v", cfg.BlockResponses)
+	}
+}
+
+func TestNewConfigFromStringLogAnalytics(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nlogsource: loganalytics\ncloudprovider: azure-waf\nloganalytics:\n  workspace: ws\n")
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := LogAnalyticsConfig{Workspace: "ws", Query: DefaultLogAnalyticsQuery, PollInterval: DefaultLogAnalyticsPollInterval}
+	if cfg.LogAnalytics != expected {
+		t.Errorf("unexpected loganalytics config %+v", cfg.LogAnalytics)
+	}
+	if cfg.LogFormat != AzureWAFLogFormat {
+		t.Errorf("the rows must be read with the azure-waf log format, got %s", cfg.LogFormat)
+	}
+	if !reflect.DeepEqual(cfg.BlockResponses, AzureWAFBlockResponses) {
+		t.Errorf("unexpected block responses %+v", cfg.BlockResponses)
+	}
+}
+
+func TestNewConfigFromStringCloudLogging(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nlogsource: cloudlogging\ncloudprovider: cloud-armor\ncloudlogging:\n  project: ftw\n")
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := CloudLoggingConfig{Project: "ftw", Filter: DefaultCloudLoggingFilter, PollInterval: DefaultCloudLoggingPollInterval}
+	if cfg.CloudLogging != expected {
+		t.Errorf("unexpected cloudlogging config %+v", cfg.CloudLogging)
+	}
+	if cfg.LogFormat != CloudArmorLogFormat {
+		t.Errorf("the entries must be read with the cloud-armor log format, got %s", cfg.LogFormat)
+	}
+	if !reflect.DeepEqual(cfg.BlockResponses, CloudArmorBlockResponses) {
+		t.Errorf("unexpected block responses %+v", cfg.BlockResponses)
+	}
+}
+
+func TestNewConfigFromStringNGWAF(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nlogsource: ngwaf\ncloudprovider: ngwaf\nngwaf:\n  corp: acme\n  site: www\n  email: ftw@example.com\n")
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := NGWAFConfig{Corp: "acme", Site: "www", Email: "ftw@example.com", Endpoint: DefaultNGWAFEndpoint, PollInterval: DefaultNGWAFPollInterval}
+	if cfg.NGWAF != expected {
+		t.Errorf("unexpected ngwaf config %+v", cfg.NGWAF)
+	}
+	if cfg.LogFormat != NGWAFLogFormat {
+		t.Errorf("the requests must be read with the ngwaf log format, got %s", cfg.LogFormat)
+	}
+	if !reflect.DeepEqual(cfg.BlockResponses, NGWAFBlockResponses) {
+		t.Errorf("unexpected block responses %+v", cfg.BlockResponses)
+	}
+}
+
+func TestNewConfigFromStringEmbedded(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nmode: embedded\nembedded:\n  rules:\n    - crs-setup.conf\n    - rules/*.conf\n")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if cfg.RunMode != EmbeddedRunMode {
+		t.Errorf("unexpected mode %s", cfg.RunMode)
+	}
+	if !reflect.DeepEqual(cfg.Embedded.Rules, []string{"crs-setup.conf", "rules/*.conf"}) {
+		t.Errorf("unexpected rules %v", cfg.Embedded.Rules)
+	}
+	if cfg.Embedded.Directives != DefaultEmbeddedDirectives {
+		t.Errorf("unexpected directives %q", cfg.Embedded.Directives)
+	}
+	if cfg.LogFormat != CorazaLogFormat {
+		t.Errorf("the rules matched must be read with the coraza log format, got %s", cfg.LogFormat)
+	}
+}
+
+func TestNewConfigFromStringTraefik(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nlogformat: traefik\nlogmarkerheadername: X-FTW-MARKER\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if cfg.LogMarkerField != "request_X-Ftw-Marker" {
+		t.Errorf("unexpected marker field %q", cfg.LogMarkerField)
+	}
+
+	cfg, err = NewConfigFromString("---\nlogformat: traefik\nlogmarkerfield: marker\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if cfg.LogMarkerField != "marker" {
+		t.Errorf("the marker field set must be kept, got %q", cfg.LogMarkerField)
+	}
+
+	cfg, err = NewConfigFromString("---\nlogformat: coraza\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if cfg.LogMarkerField != "" {
+		t.Errorf("markers are searched in the lines for the other formats, got %q", cfg.LogMarkerField)
+	}
+}
+
+func TestNewConfigFromEnvMarkerRetries(t *testing.T) {
+	cfg, err := NewConfigFromEnv()
+	if err != nil {
 		t.Error(err)
 	}
+	if cfg.MaxMarkerRetries != DefaultMaxMarkerRetries || cfg.MarkerRetryDelay != 0 {
+		t.Errorf("unexpected defaults %d, %s", cfg.MaxMarkerRetries, cfg.MarkerRetryDelay)
+	}
 
-	if FTWConfig.RunMode != CloudRunMode {
-		t.Errorf("unexpected value '%s' for run mode, expected '%s;", FTWConfig.RunMode, CloudRunMode)
+	t.Setenv("FTW_MAXMARKERRETRIES", "50")
+	t.Setenv("FTW_MARKERRETRYDELAY", "100ms")
+	cfg, err = NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	if cfg.MaxMarkerRetries != 50 || cfg.MarkerRetryDelay != 100*time.Millisecond {
+		t.Errorf("unexpected values %d, %s", cfg.MaxMarkerRetries, cfg.MarkerRetryDelay)
+	}
+}
+
+func TestNewConfigFromStringTimestampFallback(t *testing.T) {
+	cfg, err := NewConfigFromString("timestampfallback: true")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cfg.TimestampFallback || cfg.ClockSkew != DefaultClockSkew {
+		t.Errorf("unexpected values %t, %s", cfg.TimestampFallback, cfg.ClockSkew)
+	}
+
+	cfg, err = NewConfigFromString("timestampfallback: true\nclockskew: 3s")
+
+	if err != nil {
+		t.Error(err)
+	}
+	if cfg.ClockSkew != 3*time.Second {
+		t.Errorf("unexpected clock skew %s", cfg.ClockSkew)
+	}
+}
+
+func TestNewConfigFromEnvLogFiles(t *testing.T) {
+	t.Setenv("FTW_LOGFILES", "/var/log/apache2/error.log,/var/log/apache2/modsec_audit.log")
+	cfg, err := NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{"/var/log/apache2/error.log", "/var/log/apache2/modsec_audit.log"}
+	if !reflect.DeepEqual(cfg.LogFiles, expected) {
+		t.Errorf("unexpected log files %v", cfg.LogFiles)
+	}
+}
+
+func TestNewConfigFromFileExpandsEnv(t *testing.T) {
+	t.Setenv("FTW_TEST_DEST_ADDR", "waf.example.com")
+	t.Setenv("FTW_TEST_PORT", "8080")
+	t.Setenv("FTW_TEST_LOGFILE", "waf.log'\nmode: 'cloud")
+	filename, _ := utils.CreateTempFileWithContent(`---
+logfile: '${FTW_TEST_LOGFILE}'
+testoverride:
+  input:
+    dest_addr: '${FTW_TEST_DEST_ADDR}'
+    port: ${FTW_TEST_PORT}
+`, "test-*.yaml")
+	defer os.Remove(filename)
+
+	cfg, err := NewConfigFromFile(filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overrides := cfg.TestOverride.Input
+	if overrides.DestAddr == nil || *overrides.DestAddr != "waf.example.com" {
+		t.Errorf("dest_addr was not expanded: %v", overrides.DestAddr)
+	}
+	if overrides.Port == nil || *overrides.Port != 8080 {
+		t.Errorf("port was not expanded: %v", overrides.Port)
+	}
+	if cfg.LogFile != "waf.log'\nmode: 'cloud" || cfg.RunMode != DefaultRunMode {
+		t.Errorf("the value of the variable must not be read as YAML, got %q in %s mode", cfg.LogFile, cfg.RunMode)
+	}
+}
+
+var yamlProfilesConfig = `---
+logfile: 'tests/logs/modsec2-apache/apache2/error.log'
+testoverride:
+  ignore:
+    '920400-1': 'ignored everywhere'
+profiles:
+  nginx:
+    logfile: 'tests/logs/modsec3-nginx/nginx/error.log'
+    logformat: nginx
+    testoverride:
+      ignore:
+        '941190-3': 'known nginx bug'
+  cloud:
+    mode: cloud
+`
+
+func TestNewConfigFromFileWithProfile(t *testing.T) {
+	filename, _ := utils.CreateTempFileWithContent(yamlProfilesConfig, "test-*.yaml")
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFileWithProfile(filename, "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profile != "nginx" || cfg.LogFile != "tests/logs/modsec3-nginx/nginx/error.log" || cfg.LogFormat != NginxLogFormat {
+		t.Errorf("the values of the profile were not used: %s, %s", cfg.LogFile, cfg.LogFormat)
+	}
+	// the maps of the profile are merged with the top-level ones
+	if len(cfg.TestOverride.Ignore) != 2 {
+		t.Errorf("unexpected ignored tests %v", cfg.TestOverride.Ignore)
+	}
+
+	cfg, err = NewConfigFromFileWithProfile(filename, "cloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RunMode != CloudRunMode || cfg.LogFile != "tests/logs/modsec2-apache/apache2/error.log" {
+		t.Errorf("unexpected values %s, %s", cfg.RunMode, cfg.LogFile)
+	}
+
+	// without profile, only the top-level values are used
+	cfg, err = NewConfigFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RunMode != DefaultRunMode || cfg.LogFormat != NativeLogFormat || len(cfg.TestOverride.Ignore) != 1 {
+		t.Errorf("unexpected values %s, %s, %v", cfg.RunMode, cfg.LogFormat, cfg.TestOverride.Ignore)
+	}
+
+	if _, err = NewConfigFromFileWithProfile(filename, "apache"); err == nil || !strings.Contains(err.Error(), `unknown profile "apache", use one of cloud, nginx`) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestNewConfigPrecedence(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(`---
+logfile: 'file.log'
+logformat: json
+mode: cloud
+testoverride:
+  ignore:
+    '920400-1': 'from the file'
+`, "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+	t.Setenv("FTW_LOGFILE", "env.log")
+	t.Setenv("FTW_LOGFORMAT", "nginx")
+	t.Setenv("FTW_TESTOVERRIDE_INPUT_DEST_ADDR", "waf.example.com")
+
+	cfg, err := NewConfig(filename, "", map[string]interface{}{
+		"logformat":               "apache",
+		"testoverride.input.port": "8080",
+		"testoverride.ignore":     map[string]interface{}{"920410-1": "from the flags"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.File != filename {
+		t.Errorf("unexpected file %q", cfg.File)
+	}
+	if cfg.RunMode != CloudRunMode {
+		t.Errorf("the mode of the file must be kept, got %s", cfg.RunMode)
+	}
+	if cfg.LogFile != "env.log" {
+		t.Errorf("the environment must take precedence over the file, got %s", cfg.LogFile)
+	}
+	if cfg.LogFormat != ApacheLogFormat {
+		t.Errorf("the flags must take precedence over the environment, got %s", cfg.LogFormat)
+	}
+	input := cfg.TestOverride.Input
+	if input.DestAddr == nil || *input.DestAddr != "waf.example.com" {
+		t.Errorf("unexpected dest_addr %v", input.DestAddr)
+	}
+	if input.Port == nil || *input.Port != 8080 {
+		t.Errorf("unexpected port %v", input.Port)
+	}
+	if len(cfg.TestOverride.Ignore) != 2 {
+		t.Errorf("the ignored tests must be merged, got %v", cfg.TestOverride.Ignore)
+	}
+}
+
+func TestNewConfigWithoutFile(t *testing.T) {
+	t.Setenv("FTW_LOGFILE", "env.log")
+
+	cfg, err := NewConfig("does-not-exist.yaml", "", map[string]interface{}{"mode": "cloud"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File != "" || cfg.LogFile != "env.log" || cfg.RunMode != CloudRunMode {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+
+	if _, err = NewConfig("does-not-exist.yaml", "apache", nil); err == nil {
+		t.Error("a profile requires the config file")
+	}
+}
+
+var yamlExpectationsConfig = `---
+expectations:
+  blocked:
+    status: [403]
+profiles:
+  apache:
+    expectations:
+      blocked:
+        status: [406]
+  proxy:
+    expectations:
+      blocked: { expect_error: true }
+`
+
+func TestExpectation(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(yamlExpectationsConfig, "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	tests := []struct {
+		profile     string
+		status      []int
+		expectError bool
+	}{
+		{"", []int{403}, false},
+		{"apache", []int{406}, false},
+		// mappings are merged with the top-level ones
+		{"proxy", []int{403}, true},
+	}
+	for _, tt := range tests {
+		cfg, err := NewConfigFromFileWithProfile(filename, tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := cfg.Expectation("blocked")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([]int(output.Status), tt.status) || output.ExpectError != tt.expectError {
+			t.Errorf("%q: unexpected output %+v", tt.profile, output)
+		}
+		if _, err = cfg.Expectation("allowed"); err == nil || err.Error() != `unknown expectation "allowed", use one of blocked` {
+			t.Errorf("%q: unexpected error %v", tt.profile, err)
+		}
 	}
 }
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// Expectation returns the output the canonical expectation stands for on the platform under test
+func (c *FTWConfiguration) Expectation(name string) (test.Output, error) {
+	var output test.Output
+
+	value, ok := c.Expectations[name]
+	if !ok {
+		if len(c.Expectations) == 0 {
+			return output, fmt.Errorf("unknown expectation %q, there are no expectations in the configuration", name)
+		}
+		names := make([]string, 0, len(c.Expectations))
+		for n := range c.Expectations {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return output, fmt.Errorf("unknown expectation %q, use one of %s", name, strings.Join(names, ", "))
+	}
+
+	// the output is written like the ones of the tests
+	contents, err := yaml.Marshal(value)
+	if err != nil {
+		return output, fmt.Errorf("invalid expectation %q: %w", name, err)
+	}
+	if err = yaml.UnmarshalWithOptions(contents, &output, yaml.Strict()); err != nil {
+		msg := strings.TrimSpace(yaml.FormatError(err, false, false))
+		// the positions are the ones of the output alone, not of the config file
+		if m := yamlErrorPosition.FindStringSubmatch(msg); m != nil {
+			msg = m[3]
+		}
+		return output, fmt.Errorf("invalid expectation %q: %s", name, msg)
+	}
+	if output.Expect != "" {
+		return output, fmt.Errorf("invalid expectation %q: expect can't be used in the expectations", name)
+	}
+	return output, nil
+}
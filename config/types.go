@@ -1,6 +1,10 @@
 package config
 
-import "github.com/coreruleset/go-ftw/test"
+import (
+	"time"
+
+	"github.com/coreruleset/go-ftw/test"
+)
 
 // RunMode represents the mode of the test run
 type RunMode string
@@ -10,30 +14,383 @@ const (
 	CloudRunMode RunMode = "cloud"
 	// DefaultRunMode is the default execution run mode
 	DefaultRunMode RunMode = "default"
+	// EmbeddedRunMode sends the requests to a Coraza WAF running in the process, without web server
+	EmbeddedRunMode RunMode = "embedded"
+	// DefaultEmbeddedDirectives enable the rule engine of the embedded WAF, and the inspection of
+	// the request bodies
+	DefaultEmbeddedDirectives = "SecRuleEngine On\nSecRequestBodyAccess On"
 	// DefaultLogMarkerHeaderName is the default log marker header name
 	DefaultLogMarkerHeaderName string = "X-CRS-Test"
+	// TraefikLogMarkerFieldPrefix starts the fields of the request headers in the JSON access log
+	// of Traefik, followed by the canonical header name, e.g. `request_X-Crs-Test`
+	TraefikLogMarkerFieldPrefix = "request_"
+	// DefaultSyslogListen is the default address of the syslog listener
+	DefaultSyslogListen string = ":514"
+	// DefaultSyslogProtocol is the default protocol of the syslog listener
+	DefaultSyslogProtocol string = "udp"
+	// DefaultCloudWatchPollInterval is the default time between queries to CloudWatch Logs
+	DefaultCloudWatchPollInterval = 2 * time.Second
+	// DefaultCloudflareEndpoint is the GraphQL endpoint of the Cloudflare API
+	DefaultCloudflareEndpoint = "https://api.cloudflare.com/client/v4/graphql"
+	// DefaultCloudflarePollInterval is the default time between queries of the Cloudflare firewall events
+	DefaultCloudflarePollInterval = 5 * time.Second
+	// DefaultCloudflareTimeout is the default time to wait for the firewall events of a request
+	DefaultCloudflareTimeout = time.Minute
+	// DefaultLogAnalyticsQuery selects the WAF logs of Application Gateway and Front Door, when they
+	// are sent to the AzureDiagnostics table
+	DefaultLogAnalyticsQuery = `AzureDiagnostics | where Category in ("ApplicationGatewayFirewallLog", "FrontDoorWebApplicationFirewallLog")`
+	// DefaultLogAnalyticsPollInterval is the default time between queries to a Log Analytics workspace
+	DefaultLogAnalyticsPollInterval = 10 * time.Second
+	// DefaultCloudLoggingFilter selects the logs of the load balancers, with the Cloud Armor decisions
+	DefaultCloudLoggingFilter = `resource.type="http_load_balancer"`
+	// DefaultCloudLoggingPollInterval is the default time between queries to Cloud Logging
+	DefaultCloudLoggingPollInterval = 2 * time.Second
+	// DefaultNGWAFEndpoint is the API of the Fastly Next-Gen WAF
+	DefaultNGWAFEndpoint = "https://dashboard.signalsciences.net/api/v0"
+	// DefaultNGWAFPollInterval is the default time between queries to the Fastly Next-Gen WAF API
+	DefaultNGWAFPollInterval = 5 * time.Second
+	// DefaultLogMarkerTimeout is the default time to wait for a marker when watching the log file
+	DefaultLogMarkerTimeout = 10 * time.Second
+	// DefaultMaxMarkerRetries is the default number of marker requests sent until the marker is found
+	DefaultMaxMarkerRetries = 20
+	// DefaultClockSkew is the default time added around a stage when the logs are selected by their timestamps
+	DefaultClockSkew = time.Second
+)
+
+// LogFormat is the format of the WAF log file
+type LogFormat string
+
+const (
+	// NativeLogFormat is the line format of the error log, e.g. the Apache error log with ModSecurity messages
+	NativeLogFormat LogFormat = "native"
+	// JSONLogFormat is the JSON audit log format, written by ModSecurity with `SecAuditLogFormat JSON`
+	JSONLogFormat LogFormat = "json"
+	// CorazaLogFormat is the Coraza error log, also when written as JSON by the server embedding Coraza
+	CorazaLogFormat LogFormat = "coraza"
+	// CorazaJSONLogFormat is the Coraza audit log, written with `SecAuditLogFormat JSON`
+	CorazaJSONLogFormat LogFormat = "coraza-json"
+	// NginxLogFormat is the nginx error log, with the messages of libmodsecurity
+	NginxLogFormat LogFormat = "nginx"
+	// ApacheLogFormat is the Apache error log, with the messages of ModSecurity v2 and multi-line entries
+	ApacheLogFormat LogFormat = "apache"
+	// EnvoyLogFormat is the Envoy log, with the messages of coraza-proxy-wasm between the lines of
+	// Envoy and of its access log
+	EnvoyLogFormat LogFormat = "envoy"
+	// CorazaSPOALogFormat is the log of the Coraza SPOA agent of HAProxy, with the messages of Coraza
+	// written by zerolog, as JSON or in its console layout
+	CorazaSPOALogFormat LogFormat = "coraza-spoa"
+	// TraefikLogFormat is the JSON log of Traefik, with the messages of the Coraza plugin and the
+	// access log lines
+	TraefikLogFormat LogFormat = "traefik"
+	// NaxsiLogFormat is the nginx error log with the summaries of NAXSI, where the rules matching a
+	// request are listed with their zones and scores
+	NaxsiLogFormat LogFormat = "naxsi"
+	// AuditLogFormat is the native ModSecurity audit log, written with `SecAuditLogFormat Native`,
+	// where every part of a transaction starts with a boundary like `--c7036611-H--`
+	AuditLogFormat LogFormat = "audit"
+	// AWSWAFLogFormat is the JSON log of AWS WAF, with one line per request, like in the log
+	// groups of CloudWatch Logs starting with `aws-waf-logs-`
+	AWSWAFLogFormat LogFormat = "aws-waf"
+	// CloudflareLogFormat is the firewall events of Cloudflare, written as JSON lines by the
+	// cloudflare log source
+	CloudflareLogFormat LogFormat = "cloudflare"
+	// AzureWAFLogFormat is the WAF log of Azure Application Gateway or Front Door, written as JSON
+	// lines by the loganalytics log source
+	AzureWAFLogFormat LogFormat = "azure-waf"
+	// CloudArmorLogFormat is the request log of the Google Cloud load balancers, with the decisions of
+	// Cloud Armor, written as JSON lines by the cloudlogging log source
+	CloudArmorLogFormat LogFormat = "cloud-armor"
+	// NGWAFLogFormat is the requests of the Fastly Next-Gen WAF, with the signals the agent tagged
+	// them with, written as JSON lines by the ngwaf log source
+	NGWAFLogFormat LogFormat = "ngwaf"
 )
 
-// FTWConfig is being exported to be used across the app
-var FTWConfig *FTWConfiguration
+// CloudProvider is the WAF service under test, whose block responses are recognized
+type CloudProvider string
+
+const (
+	// AWSWAFCloudProvider is AWS WAF, in front of CloudFront, an Application Load Balancer or
+	// API Gateway
+	AWSWAFCloudProvider CloudProvider = "aws-waf"
+	// CloudflareCloudProvider is the WAF of Cloudflare
+	CloudflareCloudProvider CloudProvider = "cloudflare"
+	// AzureWAFCloudProvider is Azure WAF, in front of Application Gateway or Front Door
+	AzureWAFCloudProvider CloudProvider = "azure-waf"
+	// CloudArmorCloudProvider is Google Cloud Armor, in front of a Google Cloud load balancer
+	CloudArmorCloudProvider CloudProvider = "cloud-armor"
+	// NGWAFCloudProvider is the Fastly Next-Gen WAF, formerly Signal Sciences
+	NGWAFCloudProvider CloudProvider = "ngwaf"
+)
+
+// AWSWAFBlockResponses are the default responses of AWS WAF when it blocks a request, depending
+// on the service it protects
+var AWSWAFBlockResponses = []FTWBlockResponse{
+	// Application Load Balancer
+	{Status: []int{403}, Headers: map[string]string{"Server": "^awselb/"}},
+	// CloudFront
+	{Status: []int{403}, Headers: map[string]string{"X-Cache": "^Error from cloudfront"}},
+	// API Gateway
+	{Status: []int{403}, Headers: map[string]string{"X-Amzn-ErrorType": "^ForbiddenException"}},
+}
+
+// CloudflareBlockResponses are the default responses of Cloudflare when it blocks a request. Errors
+// of the origin go through Cloudflare too, so only its own error pages, with the ray ID, are
+// recognized.
+var CloudflareBlockResponses = []FTWBlockResponse{
+	// block and rate limiting pages
+	{Status: []int{403, 429}, Headers: map[string]string{"Server": "^cloudflare$"}, Body: "Cloudflare Ray ID"},
+	// challenges
+	{Status: []int{403}, Headers: map[string]string{"Cf-Mitigated": "^challenge$"}},
+}
+
+// AzureWAFBlockResponses are the default responses of Azure WAF when it blocks a request
+var AzureWAFBlockResponses = []FTWBlockResponse{
+	// Application Gateway
+	{Status: []int{403}, Headers: map[string]string{"Server": "^Microsoft-Azure-Application-Gateway"}},
+	// Front Door
+	{Status: []int{403}, Headers: map[string]string{"X-Azure-Ref": "."}, Body: "The request is blocked"},
+}
+
+// CloudArmorBlockResponses are the default responses of Cloud Armor when it denies a request,
+// with the status of the deny action
+var CloudArmorBlockResponses = []FTWBlockResponse{
+	{Status: []int{403, 404, 429, 502}, Body: `<title>\d{3}</title>\d{3} `},
+}
+
+// NGWAFBlockResponses are the default responses of the Fastly Next-Gen WAF when it blocks a request
+var NGWAFBlockResponses = []FTWBlockResponse{
+	{Status: []int{406}},
+}
+
+// cloudProviderBlockResponses are the default block responses of each cloud provider
+var cloudProviderBlockResponses = map[CloudProvider][]FTWBlockResponse{
+	AWSWAFCloudProvider:     AWSWAFBlockResponses,
+	CloudflareCloudProvider: CloudflareBlockResponses,
+	AzureWAFCloudProvider:   AzureWAFBlockResponses,
+	CloudArmorCloudProvider: CloudArmorBlockResponses,
+	NGWAFCloudProvider:      NGWAFBlockResponses,
+}
 
-// FTWConfiguration FTW global Configuration
+// LogSource is where the WAF logs are read from
+type LogSource string
+
+const (
+	// FileLogSource reads the logs from `logfile`
+	FileLogSource LogSource = "file"
+	// JournaldLogSource reads the logs from the systemd journal
+	JournaldLogSource LogSource = "journald"
+	// SyslogLogSource receives the logs from the WAF with a syslog listener
+	SyslogLogSource LogSource = "syslog"
+	// CloudWatchLogSource queries the logs from a log group of AWS CloudWatch Logs
+	CloudWatchLogSource LogSource = "cloudwatch"
+	// CloudflareLogSource queries the firewall events of each request from the Cloudflare API,
+	// by the ray ID of its response
+	CloudflareLogSource LogSource = "cloudflare"
+	// LogAnalyticsLogSource queries the logs from an Azure Log Analytics workspace
+	LogAnalyticsLogSource LogSource = "loganalytics"
+	// CloudLoggingLogSource queries the logs from Google Cloud Logging
+	CloudLoggingLogSource LogSource = "cloudlogging"
+	// NGWAFLogSource queries the requests of a site of the Fastly Next-Gen WAF from its API
+	NGWAFLogSource LogSource = "ngwaf"
+	// SSHLogSourceScheme starts the log source of a file on a remote host, read over SSH,
+	// like `ssh://user@waf:/var/log/modsec_audit.log`
+	SSHLogSourceScheme = "ssh://"
+)
+
+// FTWConfiguration is the configuration of a run. Every run has its own, so runs with
+// different settings can happen at the same time.
 type FTWConfiguration struct {
-	LogFile             string          `koanf:"logfile"`
-	TestOverride        FTWTestOverride `koanf:"testoverride"`
-	LogMarkerHeaderName string          `koanf:"logmarkerheadername"`
-	RunMode             RunMode         `koanf:"mode"`
+	LogFile             string             `koanf:"logfile"`
+	LogFiles            []string           `koanf:"logfiles"`
+	TestOverride        FTWTestOverride    `koanf:"testoverride"`
+	LogMarkerHeaderName string             `koanf:"logmarkerheadername"`
+	LogMarkerField      string             `koanf:"logmarkerfield"`
+	LogMarkerWatch      bool               `koanf:"logmarkerwatch"`
+	LogMarkerTimeout    time.Duration      `koanf:"logmarkertimeout"`
+	MaxMarkerRetries    int                `koanf:"maxmarkerretries"`
+	MarkerRetryDelay    time.Duration      `koanf:"markerretrydelay"`
+	TimestampFallback   bool               `koanf:"timestampfallback"`
+	ClockSkew           time.Duration      `koanf:"clockskew"`
+	RunMode             RunMode            `koanf:"mode"`
+	LogFormat           LogFormat          `koanf:"logformat"`
+	LogSource           LogSource          `koanf:"logsource"`
+	Journald            JournaldConfig     `koanf:"journald"`
+	Syslog              SyslogConfig       `koanf:"syslog"`
+	CloudWatch          CloudWatchConfig   `koanf:"cloudwatch"`
+	Cloudflare          CloudflareConfig   `koanf:"cloudflare"`
+	LogAnalytics        LogAnalyticsConfig `koanf:"loganalytics"`
+	CloudLogging        CloudLoggingConfig `koanf:"cloudlogging"`
+	NGWAF               NGWAFConfig        `koanf:"ngwaf"`
+	Embedded            EmbeddedConfig     `koanf:"embedded"`
+	// Profile is the name of the profile of the config file whose values were merged over the
+	// top-level ones, if any
+	Profile string `koanf:"-"`
+	// File is the config file the configuration was read from, empty when there was none
+	File string `koanf:"-"`
+	// Destinations are the named destination profiles, selected for the tests of a file with
+	// `destination` in its meta, or for all the tests with `--destination`
+	Destinations map[string]FTWDestination `koanf:"destinations"`
+	// Expectations map the canonical expectations of the tests, like `blocked`, to the outputs
+	// they stand for on the platform under test, like `status: [406]` or `expect_error: true`.
+	// The outputs are written like the ones of the tests.
+	Expectations map[string]interface{} `koanf:"expectations"`
+	// CloudProvider is the WAF service under test, setting the default block responses
+	CloudProvider CloudProvider `koanf:"cloudprovider"`
+	// BlockResponses recognize the responses of the requests blocked by the WAF, replacing the
+	// ones of the cloud provider. Without them, blocked requests are the ones answered with 403.
+	BlockResponses []FTWBlockResponse `koanf:"blockresponses"`
+	// overridden are the keys set by the environment or the command line flags over the
+	// config file, by their path like `syslog.protocol`
+	overridden map[string]bool
+}
+
+// FTWBlockResponse is a response of the WAF blocking a request. All the values set must match.
+type FTWBlockResponse struct {
+	// Status are the statuses of the response, like 403
+	Status []int `koanf:"status"`
+	// Headers maps header names to regular expressions one of their values must match
+	Headers map[string]string `koanf:"headers"`
+	// Body is a regular expression the body must match
+	Body string `koanf:"body"`
+}
+
+// FTWDestination is a named destination profile, with the WAF instance the tests are sent to.
+// Only the values set replace the ones of the tests.
+type FTWDestination struct {
+	// DestAddr is the host of the instance
+	DestAddr string `koanf:"destaddr"`
+	// Port is the port of the instance
+	Port int `koanf:"port"`
+	// Protocol is either `http` or `https`
+	Protocol string `koanf:"protocol"`
+	// InsecureSkipVerify accepts any certificate with https, like the self-signed ones of test instances
+	InsecureSkipVerify bool `koanf:"insecureskipverify"`
+	// ServerName is sent with SNI and checked against the certificate, instead of DestAddr
+	ServerName string `koanf:"servername"`
+}
+
+// JournaldConfig selects the journal entries with the WAF logs, when the log source is journald.
+// Without unit and identifier, the whole journal is read.
+type JournaldConfig struct {
+	// Unit is the systemd unit of the web server, like `apache2.service`
+	Unit string `koanf:"unit"`
+	// Identifier is the syslog identifier of the entries, like `modsecurity`
+	Identifier string `koanf:"identifier"`
+}
+
+// SyslogConfig is the address and the protocol of the listener, when the log source is syslog
+type SyslogConfig struct {
+	// Listen is the address to listen on, like `:514` or `127.0.0.1:5514`
+	Listen string `koanf:"listen"`
+	// Protocol is either `udp` or `tcp`
+	Protocol string `koanf:"protocol"`
 }
 
-// FTWTestOverride holds four lists:
+// CloudWatchConfig selects the log group with the WAF logs, when the log source is cloudwatch.
+// Credentials are taken from the profile, or from the environment like with the AWS CLI.
+type CloudWatchConfig struct {
+	// LogGroup is the name of the log group
+	LogGroup string `koanf:"loggroup"`
+	// StreamPrefix only selects the log streams whose name starts with it
+	StreamPrefix string `koanf:"streamprefix"`
+	// Region is the AWS region of the log group
+	Region string `koanf:"region"`
+	// Profile is the profile with the credentials, from the AWS configuration files
+	Profile string `koanf:"profile"`
+	// PollInterval is the minimum time between queries
+	PollInterval time.Duration `koanf:"pollinterval"`
+}
+
+// CloudflareConfig selects the zone with the firewall events, when the log source is cloudflare.
+// The API token needs the Analytics Read permission of the zone.
+type CloudflareConfig struct {
+	// ZoneID is the ID of the zone of the site under test
+	ZoneID string `koanf:"zoneid"`
+	// APIToken is the API token, better set with FTW_CLOUDFLARE_APITOKEN than in the config file
+	APIToken string `koanf:"apitoken"`
+	// Endpoint is the GraphQL endpoint of the API
+	Endpoint string `koanf:"endpoint"`
+	// PollInterval is the minimum time between queries
+	PollInterval time.Duration `koanf:"pollinterval"`
+	// Timeout is how long to wait for the events of a request, which take a while to show up.
+	// Requests that didn't match any rule have no events, so their stages always wait that long.
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// LogAnalyticsConfig selects the workspace with the WAF logs, when the log source is loganalytics.
+// Credentials are the ones of the Azure CLI, like after `az login`.
+type LogAnalyticsConfig struct {
+	// Workspace is the ID of the Log Analytics workspace
+	Workspace string `koanf:"workspace"`
+	// Query is the KQL query selecting the WAF logs, like the rows of a table for a resource.
+	// The rows logged since the start of the run are selected after it, by TimeGenerated.
+	Query string `koanf:"query"`
+	// PollInterval is the minimum time between queries
+	PollInterval time.Duration `koanf:"pollinterval"`
+}
+
+// CloudLoggingConfig selects the Cloud Logging entries with the WAF logs, when the log source is
+// cloudlogging. Credentials are the ones of the gcloud CLI, like after `gcloud auth login`.
+type CloudLoggingConfig struct {
+	// Project is the Google Cloud project of the logs, by default the one of the gcloud configuration
+	Project string `koanf:"project"`
+	// Filter selects the entries, in the logging query language. The entries logged since the start
+	// of the run are selected after it, by their timestamp.
+	Filter string `koanf:"filter"`
+	// PollInterval is the minimum time between queries
+	PollInterval time.Duration `koanf:"pollinterval"`
+}
+
+// NGWAFConfig selects the site with the requests, when the log source is ngwaf
+type NGWAFConfig struct {
+	// Corp is the name of the corp of the site
+	Corp string `koanf:"corp"`
+	// Site is the name of the site under test
+	Site string `koanf:"site"`
+	// Email is the email of the API user
+	Email string `koanf:"email"`
+	// Token is the API access token, better set with FTW_NGWAF_TOKEN than in the config file
+	Token string `koanf:"token"`
+	// Endpoint is the base URL of the API
+	Endpoint string `koanf:"endpoint"`
+	// PollInterval is the minimum time between queries
+	PollInterval time.Duration `koanf:"pollinterval"`
+}
+
+// EmbeddedConfig sets up the Coraza WAF the requests are sent to in embedded mode
+type EmbeddedConfig struct {
+	// Directives are loaded before the rules, like `SecRuleEngine On`
+	Directives string `koanf:"directives"`
+	// Rules are the files with the rules, like the setup and the rules of CRS, loaded in order.
+	// Patterns like `rules/*.conf` are expanded.
+	Rules []string `koanf:"rules"`
+}
+
+// FTWTestOverride holds the overrides of the tests:
 //
 //	Input allows you to override input parameters in tests. An example usage is if you want to change the `dest_addr` of all tests to point to an external IP or host.
+//	Scoped allows you to override input parameters only in the tests whose ID matches a regular expression, after Input.
+//	URIPrefix is a base path prepended to the URI of all tests, like when the WAF only protects a sub-path. Scoped overrides can replace it.
 //	Ignore is for tests you want to ignore. You should add a comment on why you ignore the test
 //	ForcePass is for tests you want to pass unconditionally. You should add a comment on why you force to pass the test
 //	ForceFail is for tests you want to fail unconditionally. You should add a comment on why you force to fail the test
 type FTWTestOverride struct {
-	Input     test.Input        `koanf:"input"`
-	Ignore    map[string]string `koanf:"ignore"`
-	ForcePass map[string]string `koanf:"forcepass"`
-	ForceFail map[string]string `koanf:"forcefail"`
+	Input     test.Input          `koanf:"input"`
+	URIPrefix string              `koanf:"uriprefix"`
+	Scoped    []FTWScopedOverride `koanf:"scoped"`
+	Ignore    map[string]string   `koanf:"ignore"`
+	ForcePass map[string]string   `koanf:"forcepass"`
+	ForceFail map[string]string   `koanf:"forcefail"`
+}
+
+// FTWScopedOverride overrides the input of the tests whose ID matches a regular expression, like
+// tests going through a proxy while the others hit the origin. When several scoped overrides
+// match a test, the last one wins for every parameter.
+type FTWScopedOverride struct {
+	// Tests is the regular expression matching the IDs of the tests, like `^920`
+	Tests string `koanf:"tests"`
+	// Input overrides the same input parameters as the global override
+	Input test.Input `koanf:"input"`
+	// URIPrefix is prepended to the URI of the requests, like `/app`
+	URIPrefix string `koanf:"uriprefix"`
 }
@@ -0,0 +1,544 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+// ValidationError is a problem found in the configuration, with the position where it was found.
+// File is empty when the configuration was read from the environment, or when the value was set
+// by the environment or the command line flags over the config file, and Line is 0 when the
+// problem is not about a single key, like a required key that is missing.
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error formats the problem as `file:line:column: message`
+func (e ValidationError) Error() string {
+	switch {
+	case e.File == "":
+		return e.Message
+	case e.Line == 0:
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// yamlErrorPosition matches the `[line:column]` prefix of errors from the yaml parser
+var yamlErrorPosition = regexp.MustCompile(`^\[(\d+):(\d+)\]\s*(.*)`)
+
+// overridableInputFields are the fields of the stage inputs that can be overridden
+var overridableInputFields = []string{"dest_addr", "port", "protocol", "header_files"}
+
+// Validate checks the configuration and reports all the problems found at once: unknown keys,
+// values of the wrong type, invalid run modes, log formats, cloud providers and log sources,
+// malformed regular expressions of the scoped overrides and the block responses, missing header
+// files, and the keys required by the run mode or the log source.
+// fileName is the file the configuration was read from, or empty when it was read from the
+// environment. The keys of the file are checked too, and the problems have their position in
+// the file. cfg can be nil, or only have the values that could be loaded when loading the file
+// failed.
+// The error is only set if the file can't be read.
+func Validate(cfg *FTWConfiguration, fileName string) ([]ValidationError, error) {
+	v := &configValidator{file: fileName, positions: map[string]*token.Position{}}
+
+	if fileName != "" {
+		contents, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		v.validateYaml(contents)
+		if cfg != nil && cfg.Profile != "" {
+			v.useProfilePositions(cfg.Profile)
+		}
+	}
+	if cfg != nil {
+		v.overridden = cfg.overridden
+		v.validateValues(cfg)
+	}
+
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		if v.errors[i].Line != v.errors[j].Line {
+			return v.errors[i].Line < v.errors[j].Line
+		}
+		return v.errors[i].Column < v.errors[j].Column
+	})
+	return v.errors, nil
+}
+
+type configValidator struct {
+	file   string
+	errors []ValidationError
+	// positions are the positions of the keys in the file, by their path like `syslog.protocol`
+	positions map[string]*token.Position
+	// overridden are the keys set by the environment or the command line flags
+	overridden map[string]bool
+}
+
+func (v *configValidator) report(pos *token.Position, format string, a ...interface{}) {
+	e := ValidationError{File: v.file, Message: fmt.Sprintf(format, a...)}
+	if pos != nil {
+		e.Line = pos.Line
+		e.Column = pos.Column
+	}
+	v.errors = append(v.errors, e)
+}
+
+func (v *configValidator) reportNode(node ast.Node, format string, a ...interface{}) {
+	var pos *token.Position
+	if tk := node.GetToken(); tk != nil {
+		pos = tk.Position
+	}
+	v.report(pos, format, a...)
+}
+
+// reportKey reports a problem with the value of the key, at the position of the key if it was
+// read from the file. The problems with values set by the environment or the command line flags
+// have no file.
+func (v *configValidator) reportKey(key string, format string, a ...interface{}) {
+	if v.overridden[key] {
+		v.errors = append(v.errors, ValidationError{Message: fmt.Sprintf(format, a...)})
+		return
+	}
+	v.report(v.positions[key], format, a...)
+}
+
+// validateYaml checks the keys of the file against the configuration types, and keeps their
+// positions.
+func (v *configValidator) validateYaml(contents []byte) {
+	// the yaml parser can panic on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			v.report(nil, "syntax error: %v", r)
+		}
+	}()
+
+	f, err := parser.ParseBytes(contents, 0)
+	if err != nil {
+		e := ValidationError{File: v.file}
+		msg := strings.TrimSpace(yaml.FormatError(err, false, false))
+		if m := yamlErrorPosition.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Column, _ = strconv.Atoi(m[2])
+			msg = m[3]
+		}
+		e.Message = "syntax error: " + msg
+		v.errors = append(v.errors, e)
+		return
+	}
+	for _, doc := range f.Docs {
+		if doc.Body != nil {
+			v.validateNode(doc.Body, reflect.TypeOf(FTWConfiguration{}), "")
+		}
+	}
+}
+
+// validateNode checks the node against the Go type it will be unmarshaled into. koanf converts
+// scalars when needed, so strings like "1234" are valid integers.
+func (v *configValidator) validateNode(node ast.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch n := node.(type) {
+	case *ast.AnchorNode:
+		v.validateNode(n.Value, t, path)
+		return
+	case *ast.TagNode:
+		v.validateNode(n.Value, t, path)
+		return
+	case *ast.AliasNode, *ast.NullNode, *ast.CommentNode:
+		return
+	}
+
+	// headers and JSON bodies can be written in several ways, they are checked with the tests
+	if t == reflect.TypeOf(ftwhttp.Header{}) || t.Kind() == reflect.Interface {
+		return
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		v.validateDuration(node, path)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		v.validateStruct(node, t, path)
+	case reflect.Map:
+		mapping := mappingValues(node)
+		if mapping == nil {
+			v.reportNode(node, "%s: expected a mapping, got %s", path, node.Type())
+			return
+		}
+		for _, mv := range mapping {
+			keyPath := joinPath(path, mv.Key.GetToken().Value)
+			v.positions[keyPath] = mv.Key.GetToken().Position
+			v.validateNode(mv.Value, t.Elem(), keyPath)
+		}
+	case reflect.Slice:
+		switch n := node.(type) {
+		case *ast.SequenceNode:
+			for i, item := range n.Values {
+				itemPath := fmt.Sprintf("%s[%d]", path, i)
+				v.positions[itemPath] = nodePosition(item)
+				v.validateNode(item, t.Elem(), itemPath)
+			}
+		case *ast.StringNode:
+			// lists can also be written separated by commas, like in the environment
+		default:
+			v.reportNode(node, "%s: expected a list, got %s", path, node.Type())
+		}
+	case reflect.String:
+		switch node.(type) {
+		case *ast.MappingNode, *ast.MappingValueNode, *ast.SequenceNode:
+			v.reportNode(node, "%s: expected a string, got %s", path, node.Type())
+		}
+	case reflect.Int, reflect.Int64:
+		if _, err := strconv.Atoi(scalarValue(node)); err != nil {
+			v.reportNode(node, "%s: expected an integer, got %s", path, node.Type())
+		}
+	case reflect.Bool:
+		if _, err := strconv.ParseBool(scalarValue(node)); err != nil {
+			v.reportNode(node, "%s: expected a boolean, got %s", path, node.Type())
+		}
+	}
+}
+
+func (v *configValidator) validateStruct(node ast.Node, t reflect.Type, path string) {
+	mapping := mappingValues(node)
+	if mapping == nil {
+		v.reportNode(node, "%s: expected a mapping, got %s", path, node.Type())
+		return
+	}
+
+	fields := koanfFields(t)
+	for _, mv := range mapping {
+		if _, ok := mv.Key.(*ast.MergeKeyNode); ok {
+			continue
+		}
+		key := mv.Key.GetToken().Value
+		if path == "" && key == "profiles" {
+			v.validateProfiles(mv.Value)
+			continue
+		}
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			v.reportNode(mv.Key, "unknown key %q", joinPath(path, key))
+			continue
+		}
+		fieldPath := joinPath(path, field.name)
+		if _, duplicated := v.positions[fieldPath]; duplicated {
+			v.reportNode(mv.Key, "duplicated key %q", fieldPath)
+		}
+		v.positions[fieldPath] = mv.Key.GetToken().Position
+		if field.Type == reflect.TypeOf(test.Input{}) {
+			v.validateInputOverride(mv.Value, field.Type, fieldPath)
+			continue
+		}
+		v.validateNode(mv.Value, field.Type, fieldPath)
+	}
+}
+
+// validateProfiles checks every profile like the top-level configuration. Profiles can't be nested.
+func (v *configValidator) validateProfiles(node ast.Node) {
+	mapping := mappingValues(node)
+	if mapping == nil {
+		v.reportNode(node, "profiles: expected a mapping, got %s", node.Type())
+		return
+	}
+	for _, mv := range mapping {
+		path := "profiles." + mv.Key.GetToken().Value
+		v.positions[path] = mv.Key.GetToken().Position
+		v.validateNode(mv.Value, reflect.TypeOf(FTWConfiguration{}), path)
+	}
+}
+
+// useProfilePositions reports the problems with the values of the profile at the position
+// of its keys, instead of the top-level ones
+func (v *configValidator) useProfilePositions(profile string) {
+	prefix := "profiles." + profile + "."
+	for key, pos := range v.positions {
+		if strings.HasPrefix(key, prefix) {
+			v.positions[strings.TrimPrefix(key, prefix)] = pos
+		}
+	}
+}
+
+// validateInputOverride only accepts the fields of the input that can be overridden, even if
+// the others are valid in tests
+func (v *configValidator) validateInputOverride(node ast.Node, t reflect.Type, path string) {
+	mapping := mappingValues(node)
+	if mapping == nil {
+		v.reportNode(node, "%s: expected a mapping, got %s", path, node.Type())
+		return
+	}
+
+	fields := koanfFields(t)
+	for _, mv := range mapping {
+		key := mv.Key.GetToken().Value
+		field, ok := fields[key]
+		if !ok || !isOverridable(key) {
+			v.reportNode(mv.Key, "%q can't be overridden, use one of %s", joinPath(path, key),
+				strings.Join(overridableInputFields, ", "))
+			continue
+		}
+		v.positions[joinPath(path, key)] = mv.Key.GetToken().Position
+		v.validateNode(mv.Value, field.Type, joinPath(path, key))
+	}
+}
+
+func isOverridable(key string) bool {
+	for _, field := range overridableInputFields {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDuration checks durations written like `10s`, or as a number of nanoseconds
+func (v *configValidator) validateDuration(node ast.Node, path string) {
+	value := scalarValue(node)
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		v.reportNode(node, "%s: invalid duration %q, use a duration like 500ms or 10s", path, value)
+	}
+}
+
+// validateValues checks the values of the configuration, once loaded
+func (v *configValidator) validateValues(cfg *FTWConfiguration) {
+	switch cfg.RunMode {
+	case DefaultRunMode, CloudRunMode:
+	case EmbeddedRunMode:
+		if len(cfg.Embedded.Rules) == 0 {
+			v.reportKey("mode", "embedded.rules is required in %s mode, list the files with the rules", EmbeddedRunMode)
+		}
+	default:
+		v.reportKey("mode", "invalid mode %q, use %q, %q or %q", cfg.RunMode, DefaultRunMode, CloudRunMode, EmbeddedRunMode)
+	}
+
+	switch cfg.LogFormat {
+	case NativeLogFormat, JSONLogFormat, CorazaLogFormat, CorazaJSONLogFormat, NginxLogFormat, ApacheLogFormat, EnvoyLogFormat, CorazaSPOALogFormat, TraefikLogFormat, NaxsiLogFormat, AuditLogFormat, AWSWAFLogFormat, CloudflareLogFormat, AzureWAFLogFormat, CloudArmorLogFormat, NGWAFLogFormat:
+	default:
+		v.reportKey("logformat", "invalid logformat %q, use one of %s", cfg.LogFormat,
+			strings.Join([]string{string(NativeLogFormat), string(JSONLogFormat), string(AuditLogFormat),
+				string(CorazaLogFormat), string(CorazaJSONLogFormat), string(NginxLogFormat), string(ApacheLogFormat),
+				string(EnvoyLogFormat), string(CorazaSPOALogFormat), string(TraefikLogFormat), string(NaxsiLogFormat), string(AWSWAFLogFormat), string(CloudflareLogFormat), string(AzureWAFLogFormat),
+				string(CloudArmorLogFormat), string(NGWAFLogFormat)}, ", "))
+	}
+
+	switch cfg.CloudProvider {
+	case "", AWSWAFCloudProvider, CloudflareCloudProvider, AzureWAFCloudProvider, CloudArmorCloudProvider, NGWAFCloudProvider:
+	default:
+		v.reportKey("cloudprovider", "invalid cloudprovider %q, use one of %s, %s, %s, %s, %s", cfg.CloudProvider,
+			AWSWAFCloudProvider, CloudflareCloudProvider, AzureWAFCloudProvider, CloudArmorCloudProvider, NGWAFCloudProvider)
+	}
+	for i, block := range cfg.BlockResponses {
+		path := fmt.Sprintf("blockresponses[%d]", i)
+		headers := make([]string, 0, len(block.Headers))
+		for name := range block.Headers {
+			headers = append(headers, name)
+		}
+		sort.Strings(headers)
+		for _, name := range headers {
+			if _, err := regexp.Compile(block.Headers[name]); err != nil {
+				key := joinPath(path+".headers", name)
+				v.reportKey(key, "%s: invalid regular expression: %s", key, err)
+			}
+		}
+		if _, err := regexp.Compile(block.Body); err != nil {
+			v.reportKey(path+".body", "%s.body: invalid regular expression: %s", path, err)
+		}
+	}
+
+	switch {
+	case cfg.LogSource == FileLogSource, cfg.LogSource == JournaldLogSource:
+	case cfg.LogSource == SyslogLogSource:
+		if cfg.Syslog.Protocol != "udp" && cfg.Syslog.Protocol != "tcp" {
+			v.reportKey("syslog.protocol", "invalid syslog protocol %q, use \"udp\" or \"tcp\"", cfg.Syslog.Protocol)
+		}
+	case cfg.LogSource == CloudWatchLogSource:
+		if cfg.CloudWatch.LogGroup == "" {
+			v.reportKey("logsource", "cloudwatch.loggroup is required with the cloudwatch log source")
+		}
+	case cfg.LogSource == CloudflareLogSource:
+		if cfg.Cloudflare.ZoneID == "" {
+			v.reportKey("logsource", "cloudflare.zoneid is required with the cloudflare log source")
+		}
+		if cfg.Cloudflare.APIToken == "" {
+			v.reportKey("logsource", "cloudflare.apitoken is required with the cloudflare log source, set it with FTW_CLOUDFLARE_APITOKEN")
+		}
+	case cfg.LogSource == CloudLoggingLogSource:
+	case cfg.LogSource == NGWAFLogSource:
+		for _, required := range []struct{ key, value string }{
+			{"ngwaf.corp", cfg.NGWAF.Corp}, {"ngwaf.site", cfg.NGWAF.Site}, {"ngwaf.email", cfg.NGWAF.Email},
+		} {
+			if required.value == "" {
+				v.reportKey("logsource", "%s is required with the ngwaf log source", required.key)
+			}
+		}
+		if cfg.NGWAF.Token == "" {
+			v.reportKey("logsource", "ngwaf.token is required with the ngwaf log source, set it with FTW_NGWAF_TOKEN")
+		}
+	case cfg.LogSource == LogAnalyticsLogSource:
+		if cfg.LogAnalytics.Workspace == "" {
+			v.reportKey("logsource", "loganalytics.workspace is required with the loganalytics log source")
+		}
+	case strings.HasPrefix(string(cfg.LogSource), SSHLogSourceScheme):
+	default:
+		v.reportKey("logsource", "invalid logsource %q, use one of file, journald, syslog, cloudwatch, cloudflare, loganalytics, cloudlogging, ngwaf, or %suser@host:/path", cfg.LogSource, SSHLogSourceScheme)
+	}
+
+	names := make([]string, 0, len(cfg.Destinations))
+	for name := range cfg.Destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		destination, path := cfg.Destinations[name], "destinations."+name
+		switch strings.ToLower(destination.Protocol) {
+		case "", "http", "https":
+		default:
+			v.reportKey(path+".protocol", "%s.protocol: invalid protocol %q, use \"http\" or \"https\"", path, destination.Protocol)
+		}
+		if destination.Port < 0 || destination.Port > 65535 {
+			v.reportKey(path+".port", "%s.port: invalid port %d", path, destination.Port)
+		}
+	}
+
+	names = make([]string, 0, len(cfg.Expectations))
+	for name := range cfg.Expectations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := cfg.Expectation(name); err != nil {
+			v.reportKey("expectations."+name, "%s", err)
+		}
+	}
+
+	v.validateHeaderFiles(cfg.TestOverride.Input.HeaderFiles, "testoverride.input")
+	if prefix := cfg.TestOverride.URIPrefix; prefix != "" && !strings.HasPrefix(prefix, "/") {
+		v.reportKey("testoverride.uriprefix", "testoverride.uriprefix: %q must start with /", prefix)
+	}
+	for i, scoped := range cfg.TestOverride.Scoped {
+		path := fmt.Sprintf("testoverride.scoped[%d]", i)
+		v.validateHeaderFiles(scoped.Input.HeaderFiles, path+".input")
+		if scoped.Tests == "" {
+			v.reportKey(path, "%s: tests is required, set it to the regular expression of the test IDs", path)
+		} else if _, err := regexp.Compile(scoped.Tests); err != nil {
+			v.reportKey(path+".tests", "%s.tests: invalid regular expression: %s", path, err)
+		}
+		if scoped.URIPrefix != "" && !strings.HasPrefix(scoped.URIPrefix, "/") {
+			v.reportKey(path+".uriprefix", "%s.uriprefix: %q must start with /", path, scoped.URIPrefix)
+		}
+	}
+
+	// the logs are only read from the log files with the file log source
+	if cfg.RunMode == DefaultRunMode && cfg.LogSource == FileLogSource && cfg.LogFile == "" && len(cfg.LogFiles) == 0 {
+		v.reportKey("mode", "logfile is required in %s mode, set it or use the %s mode", DefaultRunMode, CloudRunMode)
+	}
+}
+
+// validateHeaderFiles checks that the files of the headers of the input override exist, so the
+// requests are not sent without them
+func (v *configValidator) validateHeaderFiles(headerFiles map[string]string, path string) {
+	names := make([]string, 0, len(headerFiles))
+	for name := range headerFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := joinPath(joinPath(path, "header_files"), name)
+		if _, err := os.Stat(headerFiles[name]); err != nil {
+			v.reportKey(key, "%s: %s", key, err)
+		}
+	}
+}
+
+type koanfField struct {
+	reflect.StructField
+	name string
+}
+
+// koanfFields maps the lower case koanf key of every field in the struct to the field. koanf
+// keys are matched without case, like field names.
+func koanfFields(t reflect.Type) map[string]koanfField {
+	fields := make(map[string]koanfField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported fields are not read
+			continue
+		}
+		name := strings.Split(field.Tag.Get("koanf"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = koanfField{StructField: field, name: name}
+	}
+	return fields
+}
+
+func mappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	}
+	return nil
+}
+
+// nodePosition returns the position of the node, or of its first key for mappings
+func nodePosition(node ast.Node) *token.Position {
+	if mapping := mappingValues(node); len(mapping) > 0 {
+		node = mapping[0].Key
+	}
+	if tk := node.GetToken(); tk != nil {
+		return tk.Position
+	}
+	return nil
+}
+
+// scalarValue returns the value of a scalar node, with the environment variables expanded like
+// when reading the configuration, or an empty string
+func scalarValue(node ast.Node) string {
+	switch node.(type) {
+	case *ast.MappingNode, *ast.MappingValueNode, *ast.SequenceNode:
+		return ""
+	}
+	if tk := node.GetToken(); tk != nil {
+		return utils.ExpandEnv(tk.Value)
+	}
+	return ""
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
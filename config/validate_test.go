@@ -0,0 +1,456 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var invalidYamlConfig = `---
+logfile: ''
+mode: 'clod'
+logmarkertimeout: 'ten seconds'
+maxmarkerretries: 'many'
+logsource: cloudwatch
+testoverride:
+  input:
+    dest_addr: 'localhost'
+    port: 'eighty'
+    uri: '/'
+  ignore:
+    '920400-1': 'This test result must be ignored'
+doesNotExist: ""
+`
+
+var validYamlConfig = `---
+logfile: 'tests/logs/modsec2-apache/apache2/error.log'
+LogFormat: json
+logmarkertimeout: 5s
+maxmarkerretries: '10'
+testoverride:
+  input:
+    dest_addr: 'localhost'
+    port: '8080'
+  forcefail:
+    '920400-1': 'known issue'
+`
+
+func TestValidate(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(invalidYamlConfig, "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	// the invalid values can't be loaded, like when ftw starts
+	found, err := Validate(nil, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ValidationError{
+		{filename, 4, 19, `logmarkertimeout: invalid duration "ten seconds", use a duration like 500ms or 10s`},
+		{filename, 5, 19, "maxmarkerretries: expected an integer, got String"},
+		{filename, 10, 11, "testoverride.input.port: expected an integer, got String"},
+		{filename, 11, 5, `"testoverride.input.uri" can't be overridden, use one of dest_addr, port, protocol, header_files`},
+		{filename, 14, 1, `unknown key "doesNotExist"`},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+func TestValidateValues(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent("---\nlogfile: ''\nmode: 'clod'\nlogsource: cloudwatch\n", "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ValidationError{
+		{filename, 3, 1, `invalid mode "clod", use "default", "cloud" or "embedded"`},
+		{filename, 4, 1, "cloudwatch.loggroup is required with the cloudwatch log source"},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+var yamlScopedOverrideConfig = `---
+mode: cloud
+testoverride:
+  uriprefix: 'base'
+  scoped:
+    - tests: '^920('
+      input:
+        dest_addr: 'origin'
+    - input:
+        port: 8080
+        uri: '/'
+        header_files:
+          Authorization: 'does-not-exist'
+      uriprefix: 'app'
+`
+
+func TestValidateScopedOverrides(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(yamlScopedOverrideConfig, "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ValidationError{
+		{filename, 4, 3, `testoverride.uriprefix: "base" must start with /`},
+		{filename, 6, 7, "testoverride.scoped[0].tests: invalid regular expression: error parsing regexp: missing closing ): `^920(`"},
+		{filename, 9, 7, "testoverride.scoped[1]: tests is required, set it to the regular expression of the test IDs"},
+		{filename, 11, 9, `"testoverride.scoped[1].input.uri" can't be overridden, use one of dest_addr, port, protocol, header_files`},
+		{filename, 13, 11, "testoverride.scoped[1].input.header_files.Authorization: stat does-not-exist: no such file or directory"},
+		{filename, 14, 7, `testoverride.scoped[1].uriprefix: "app" must start with /`},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+var yamlDestinationsConfig = `---
+mode: cloud
+destinations:
+  nginx:
+    destaddr: 'nginx.example.com'
+    protocol: 'https'
+    insecureskipverify: true
+  apache:
+    destaddr: 'apache.example.com'
+    port: 70000
+    protocol: 'ftp'
+`
+
+func TestValidateDestinations(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(yamlDestinationsConfig, "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cfg.Destinations["nginx"]; d.DestAddr != "nginx.example.com" || !d.InsecureSkipVerify {
+		t.Errorf("unexpected destination %+v", d)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ValidationError{
+		{filename, 10, 5, "destinations.apache.port: invalid port 70000"},
+		{filename, 11, 5, `destinations.apache.protocol: invalid protocol "ftp", use "http" or "https"`},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+var yamlInvalidProfilesConfig = `---
+logfile: 'error.log'
+mode: cloud
+profiles:
+  apache:
+    mode: default
+    logformat: apache2
+  nginx:
+    logfile: 'nginx.log'
+    profiles:
+      nested: {}
+`
+
+func TestValidateProfiles(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(yamlInvalidProfilesConfig, "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFileWithProfile(filename, "apache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the values of the profile are reported where they are set in the profile
+	expected := []ValidationError{
+		{filename, 7, 5, `invalid logformat "apache2", use one of native, json, audit, coraza, coraza-json, nginx, apache, envoy, coraza-spoa, traefik, naxsi, aws-waf, cloudflare, azure-waf, cloud-armor, ngwaf`},
+		{filename, 10, 5, `unknown key "profiles.nginx.profiles"`},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+func TestValidateExpectations(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent("---\nmode: cloud\nexpectations:\n  blocked:\n    status: [403]\n  reset:\n    expect_errors: true\n  allowed:\n    expect: blocked\n", "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ValidationError{
+		{filename, 6, 3, `invalid expectation "reset": unknown field "expect_errors"`},
+		{filename, 8, 3, `invalid expectation "allowed": expect can't be used in the expectations`},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+func TestValidateMissingLogFile(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nlogformat: xml\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Validate(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`invalid logformat "xml", use one of native, json, audit, coraza, coraza-json, nginx, apache, envoy, coraza-spoa, traefik, naxsi, aws-waf, cloudflare, azure-waf, cloud-armor, ngwaf`,
+		`logfile is required in default mode, set it or use the cloud mode`,
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i].Error() != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e)
+		}
+	}
+
+	cfg.RunMode = CloudRunMode
+	cfg.LogFormat = NativeLogFormat
+	if found, _ := Validate(cfg, ""); len(found) != 0 {
+		t.Errorf("the log file is not required in cloud mode, got %v", found)
+	}
+}
+
+func TestValidateCloudLogSources(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nlogsource: cloudflare\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Validate(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`cloudflare.zoneid is required with the cloudflare log source`,
+		`cloudflare.apitoken is required with the cloudflare log source, set it with FTW_CLOUDFLARE_APITOKEN`,
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i].Error() != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e)
+		}
+	}
+
+	cfg.LogSource = LogAnalyticsLogSource
+	found, err = Validate(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Error() != "loganalytics.workspace is required with the loganalytics log source" {
+		t.Errorf("unexpected errors %v", found)
+	}
+
+	cfg.LogSource = NGWAFLogSource
+	cfg.NGWAF.Corp = "acme"
+	found, err = Validate(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		`ngwaf.site is required with the ngwaf log source`,
+		`ngwaf.email is required with the ngwaf log source`,
+		`ngwaf.token is required with the ngwaf log source, set it with FTW_NGWAF_TOKEN`,
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i].Error() != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e)
+		}
+	}
+}
+
+func TestValidateEmbedded(t *testing.T) {
+	cfg, err := NewConfigFromString("---\nmode: embedded\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Validate(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the log file is not needed
+	if len(found) != 1 || found[0].Error() != "embedded.rules is required in embedded mode, list the files with the rules" {
+		t.Errorf("unexpected errors %v", found)
+	}
+}
+
+func TestValidateValidConfig(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(validYamlConfig, "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("unexpected errors: %v", found)
+	}
+}
+
+func TestValidateSyntaxError(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent("---\nsyslog:\n  listen: ':514'\n    protocol: tcp\n", "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	found, err := Validate(nil, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Line == 0 {
+		t.Errorf("expected a syntax error with its position, got %v", found)
+	}
+}
+
+func TestValidateOverriddenValues(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent("---\nlogfile: 'error.log'\nmode: clod\nlogformat: json\n", "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfig(filename, "", map[string]interface{}{"logformat": "xml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the value of the flag is not in the file
+	expected := []ValidationError{
+		{"", 0, 0, `invalid logformat "xml", use one of native, json, audit, coraza, coraza-json, nginx, apache, envoy, coraza-spoa, traefik, naxsi, aws-waf, cloudflare, azure-waf, cloud-armor, ngwaf`},
+		{filename, 3, 1, `invalid mode "clod", use "default", "cloud" or "embedded"`},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+func TestValidateBlockResponses(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent("---\nmode: cloud\ncloudprovider: aws\nblockresponses:\n  - status: [403]\n    headers:\n      server: '^awselb/('\n    body: '[a-'\n", "test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	cfg, err := NewConfigFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := Validate(cfg, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ValidationError{
+		{filename, 3, 1, `invalid cloudprovider "aws", use one of aws-waf, cloudflare, azure-waf, cloud-armor, ngwaf`},
+		{filename, 7, 7, "blockresponses[0].headers.server: invalid regular expression: error parsing regexp: missing closing ): `^awselb/(`"},
+		{filename, 8, 5, "blockresponses[0].body: invalid regular expression: error parsing regexp: missing closing ]: `[a-`"},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
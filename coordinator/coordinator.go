@@ -0,0 +1,320 @@
+// Package coordinator distributes the files of tests to ftw services, the workers, each running
+// the tests near its own WAF, and aggregates their results as the ones of a single run.
+package coordinator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/service"
+)
+
+const (
+	// maxEventSize is the size of the longest event of the workers, with the evidence of a stage
+	maxEventSize = 16 << 20
+	// cancelTimeout is the time allowed to cancel the job of a worker once the run is interrupted
+	cancelTimeout = 5 * time.Second
+)
+
+// ErrNoWorkers is returned when all the workers failed before the tests of every file ran
+var ErrNoWorkers = errors.New("ftw/coordinator: no worker left to run the tests")
+
+// Worker is an ftw service running the tests sent by the coordinator
+type Worker struct {
+	// URL is the address of the API of the service, like http://waf-1:8081
+	URL string
+	// Token is the bearer token of the API, if it requires one
+	Token string
+}
+
+// Config is the configuration of a distributed run
+type Config struct {
+	// Workers are the services running the tests
+	Workers []Worker
+	// Dir is the directory of the tests on the workers, relative to their directory of tests
+	Dir string
+	// Files are the files of tests, relative to Dir, each of them run by one of the workers
+	Files []string
+	// Include and Exclude are regular expressions selecting the tests by title
+	Include string
+	Exclude string
+	// Destination is the name of a destination profile of the configuration of the workers
+	Destination string
+	// Evidence keeps the request, the response and the logs of the failed stages
+	Evidence bool
+	// Client sends the requests to the workers, http.DefaultClient when nil
+	Client *http.Client
+	// OnFile is called once a worker ran the tests of a file, with the results of their stages
+	OnFile func(file string, worker string, stages []runner.StageResult)
+}
+
+// fileError is the error of a file that no worker can run, like a file that doesn't exist
+type fileError struct {
+	err error
+}
+
+func (e fileError) Error() string {
+	return e.err.Error()
+}
+
+// Run sends every file of tests to one of the workers, as a job of its own, and returns the
+// statistics of all their stages. A worker that fails, like one that can't be reached, is not
+// sent any other file, and its file is sent to another one. A file whose job fails on its worker,
+// like when the WAF of the worker can't be reached, is not sent to another one, and its error is
+// returned once the other files ran. The stages of a file are in the statistics once the tests of
+// the whole file ran, so the ones of a file that ran partly on a failed worker are not counted
+// twice. When ctx is done, the jobs of the workers are cancelled and the statistics are the ones
+// of the tests completed so far, with Interrupted set.
+func Run(ctx context.Context, cfg Config) (runner.TestStats, error) {
+	var stats runner.TestStats
+	if len(cfg.Workers) == 0 {
+		return stats, errors.New("ftw/coordinator: no workers")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	// every file is in the queue at most once, so requeueing never blocks
+	queue := make(chan string, len(cfg.Files))
+	for _, file := range cfg.Files {
+		queue <- file
+	}
+	var (
+		mu         sync.Mutex
+		remaining  = len(cfg.Files)
+		alive      = len(cfg.Workers)
+		fileErrors []error
+		stopOnce   sync.Once
+		wg         sync.WaitGroup
+	)
+	// stopped is closed once every file ran, or once no worker is left
+	stopped := make(chan struct{})
+	stop := func() { stopOnce.Do(func() { close(stopped) }) }
+	if remaining == 0 {
+		stop()
+	}
+
+	for _, worker := range cfg.Workers {
+		wg.Add(1)
+		go func(worker Worker) {
+			defer wg.Done()
+			for {
+				var file string
+				select {
+				case <-ctx.Done():
+					return
+				case <-stopped:
+					return
+				case file = <-queue:
+				}
+
+				stages, err := runFile(ctx, cfg, worker, file)
+				var badFile fileError
+				if err != nil && !errors.As(err, &badFile) && ctx.Err() == nil {
+					log.Error().Err(err).Msgf("ftw/coordinator: the worker %s failed, sending %s to another one", worker.URL, file)
+					queue <- file
+					mu.Lock()
+					alive--
+					if alive == 0 {
+						stop()
+					}
+					mu.Unlock()
+					return
+				}
+
+				mu.Lock()
+				for _, stage := range stages {
+					stats.AddStage(stage)
+				}
+				if err != nil && ctx.Err() == nil {
+					fileErrors = append(fileErrors, err)
+				}
+				remaining--
+				if remaining == 0 {
+					stop()
+				}
+				mu.Unlock()
+				if err == nil && ctx.Err() == nil && cfg.OnFile != nil {
+					cfg.OnFile(file, worker.URL, stages)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		stats.Interrupted = true
+		return stats, nil
+	}
+	if remaining > 0 {
+		return stats, fmt.Errorf("%w, %d file(s) not run", ErrNoWorkers, remaining)
+	}
+	if len(fileErrors) > 0 {
+		return stats, fmt.Errorf("ftw/coordinator: %d file(s) not run, the first one: %w", len(fileErrors), fileErrors[0])
+	}
+	return stats, nil
+}
+
+// runFile runs the tests of the file as a job of the worker, and returns the results of their
+// stages, with the file of the coordinator. The errors of the file itself are fileErrors, the
+// other ones are the ones of the worker.
+func runFile(ctx context.Context, cfg Config, worker Worker, file string) ([]runner.StageResult, error) {
+	job, err := submit(ctx, cfg, worker, service.JobRequest{
+		Dir:         cfg.Dir,
+		Files:       []string{file},
+		Include:     cfg.Include,
+		Exclude:     cfg.Exclude,
+		Destination: cfg.Destination,
+		Evidence:    cfg.Evidence,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stages, err := followEvents(ctx, cfg, worker, job.ID, file)
+	if ctx.Err() != nil {
+		cancelJob(cfg, worker, job.ID)
+		return stages, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var done service.Job
+	if err := call(ctx, cfg, worker, http.MethodGet, "/jobs/"+job.ID, nil, http.StatusOK, &done); err != nil {
+		return nil, err
+	}
+	switch done.State {
+	case service.Finished:
+		return stages, nil
+	case service.Failed:
+		return nil, fileError{fmt.Errorf("ftw/coordinator: the tests of %s failed to run on %s: %s", file, worker.URL, done.Error)}
+	default:
+		return nil, fmt.Errorf("ftw/coordinator: the job %s of %s is %s", job.ID, file, done.State)
+	}
+}
+
+// submit submits the job to the worker. The requests the worker rejects are fileErrors.
+func submit(ctx context.Context, cfg Config, worker Worker, request service.JobRequest) (service.Job, error) {
+	var job service.Job
+	body, err := json.Marshal(request)
+	if err != nil {
+		return job, err
+	}
+	err = call(ctx, cfg, worker, http.MethodPost, "/jobs", body, http.StatusAccepted, &job)
+	var status statusError
+	if errors.As(err, &status) && status.code == http.StatusBadRequest {
+		return job, fileError{fmt.Errorf("ftw/coordinator: %s rejected the tests of %s: %w", worker.URL, strings.Join(request.Files, ", "), err)}
+	}
+	return job, err
+}
+
+// followEvents reads the events of the job until its end, and returns the results of the stages
+func followEvents(ctx context.Context, cfg Config, worker Worker, id string, file string) ([]runner.StageResult, error) {
+	resp, err := send(ctx, cfg, worker, http.MethodGet, "/jobs/"+id+"/events", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stages []runner.StageResult
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxEventSize)
+	for scanner.Scan() {
+		var event runner.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return stages, fmt.Errorf("ftw/coordinator: bad event of %s: %w", worker.URL, err)
+		}
+		if event.Type != runner.StageFinished {
+			continue
+		}
+		stage, err := event.StageResult()
+		if err != nil {
+			return stages, err
+		}
+		// the file of the worker is the one in its directory of tests
+		stage.File = file
+		stages = append(stages, stage)
+	}
+	return stages, scanner.Err()
+}
+
+// cancelJob cancels the job of the worker, once the run is interrupted
+func cancelJob(cfg Config, worker Worker, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	if err := call(ctx, cfg, worker, http.MethodPost, "/jobs/"+id+"/cancel", nil, http.StatusOK, nil); err != nil {
+		log.Warn().Err(err).Msgf("ftw/coordinator: can't cancel the job %s of %s", id, worker.URL)
+	}
+}
+
+// statusError is the error of a response of a worker without the expected status
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.code, e.message)
+}
+
+// call sends the request to the worker, and decodes the JSON of the response into value, if not nil
+func call(ctx context.Context, cfg Config, worker Worker, method string, path string, body []byte, status int, value interface{}) error {
+	resp, err := send(ctx, cfg, worker, method, path, body, status)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if value == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+		return fmt.Errorf("ftw/coordinator: bad response of %s to %s %s: %w", worker.URL, method, path, err)
+	}
+	return nil
+}
+
+// send sends the request to the worker, and returns the response when it has the status
+func send(ctx context.Context, cfg Config, worker Worker, method string, path string, body []byte, status int) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(worker.URL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if worker.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+worker.Token)
+	}
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != status {
+		defer resp.Body.Close()
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil || message.Error == "" {
+			message.Error = http.StatusText(resp.StatusCode)
+		}
+		return nil, fmt.Errorf("ftw/coordinator: %s %s of %s: %w", method, path, worker.URL, statusError{resp.StatusCode, message.Error})
+	}
+	return resp, nil
+}
@@ -0,0 +1,196 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/service"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var yamlTests = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "%[1]s.yaml"
+tests:
+  - test_title: "%[1]s-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1%%27%%20or%%201=1"
+          output:
+            log:
+              rule_ids: [942100]
+  - test_title: "%[1]s-2"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1"
+          output:
+            log:
+              no_rule_ids: [942100]
+`
+
+// newWorker returns the URL of a service running the tests of sqli/ with the embedded WAF, whose
+// rule matches the request of the second test of every file too, which expects it not to
+func newWorker(t *testing.T, token string) string {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx 1" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startWorker(t, cfg, token)
+}
+
+// startWorker returns the URL of a service with the configuration, running the tests of sqli/
+func startWorker(t *testing.T, cfg *config.FTWConfiguration, token string) string {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sqli"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"942100", "942110", "942120"} {
+		if err := os.WriteFile(filepath.Join(dir, "sqli", name+".yaml"), []byte(fmt.Sprintf(yamlTests, name)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := service.New(cfg, dir, runner.Config{}, token)
+	go s.Run()
+	t.Cleanup(s.Close)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// unreachableWorker returns the URL of a server which is closed
+func unreachableWorker() string {
+	ts := httptest.NewServer(nil)
+	ts.Close()
+	return ts.URL
+}
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	ran := make(map[string]string)
+	stats, err := Run(context.Background(), Config{
+		Workers: []Worker{{URL: unreachableWorker()}, {URL: newWorker(t, "secret"), Token: "secret"}},
+		Dir:     "sqli",
+		Files:   []string{"942100.yaml", "942110.yaml", "942120.yaml"},
+		Exclude: "942120-2",
+		OnFile: func(file string, worker string, stages []runner.StageResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			ran[file] = worker
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 3 {
+		t.Errorf("every file must run once on the worker left, got %v", ran)
+	}
+	sort.Strings(stats.Failed)
+	if stats.Run != 5 || stats.Success != 3 || len(stats.Skipped) != 1 || len(stats.Stages) != 6 ||
+		strings.Join(stats.Failed, ",") != "942100-2,942110-2" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	for _, stage := range stats.Stages {
+		if !strings.HasPrefix(stage.Test, strings.TrimSuffix(stage.File, ".yaml")) {
+			t.Errorf("the stage %s must have the file of the coordinator, got %s", stage.Test, stage.File)
+		}
+	}
+}
+
+func TestRunBadFile(t *testing.T) {
+	stats, err := Run(context.Background(), Config{
+		Workers: []Worker{{URL: newWorker(t, "")}},
+		Dir:     "sqli",
+		Files:   []string{"942100.yaml", "941100.yaml", "../942110.yaml"},
+	})
+	if err == nil || errors.Is(err, ErrNoWorkers) || !strings.Contains(err.Error(), "2 file(s) not run") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if stats.Run != 2 {
+		t.Errorf("the files that ran must be in the stats, got %+v", stats)
+	}
+}
+
+func TestRunFailedJob(t *testing.T) {
+	// the tests send their requests to localhost:1, where nothing listens
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workers := []Worker{{URL: startWorker(t, cfg, "")}, {URL: startWorker(t, cfg, "")}}
+	_, err = Run(context.Background(), Config{
+		Workers: workers,
+		Dir:     "sqli",
+		Files:   []string{"942100.yaml"},
+	})
+	if err == nil || errors.Is(err, ErrNoWorkers) || !strings.Contains(err.Error(), "can't connect to destination") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// the file is not sent to the other worker
+	var jobs []service.Job
+	for _, worker := range workers {
+		resp, err := http.Get(worker.URL + "/jobs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []service.Job
+		err = json.NewDecoder(resp.Body).Decode(&found)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, found...)
+	}
+	if len(jobs) != 1 || jobs[0].State != service.Failed {
+		t.Errorf("expected a single failed job, got %+v", jobs)
+	}
+}
+
+func TestRunWithoutWorkers(t *testing.T) {
+	_, err := Run(context.Background(), Config{
+		Workers: []Worker{{URL: unreachableWorker()}, {URL: newWorker(t, "secret")}},
+		Dir:     "sqli",
+		Files:   []string{"942100.yaml"},
+	})
+	if !errors.Is(err, ErrNoWorkers) {
+		t.Errorf("expected %v, got %v", ErrNoWorkers, err)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err := Run(ctx, Config{
+		Workers: []Worker{{URL: newWorker(t, "")}},
+		Dir:     "sqli",
+		Files:   []string{"942100.yaml"},
+	})
+	if err != nil || !stats.Interrupted || stats.Run != 0 {
+		t.Errorf("unexpected stats %+v or error %v", stats, err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package dashboard implements the web dashboard of `ftw serve`. It shows the runs started from
+// it and the previous runs of the history, the results of the tests of every run with the
+// request, the response and the logs of the stages that failed, and runs a selection of the tests
+// again.
+package dashboard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/history"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// historyRuns is the number of runs of the history listed
+const historyRuns = 20
+
+// ErrRunning is returned when a run is started while another one is in progress, since the runs
+// share the logs of the WAF
+var ErrRunning = errors.New("ftw/dashboard: a run is in progress")
+
+// Server serves the dashboard
+type Server struct {
+	cfg *config.FTWConfiguration
+	// load reads the tests for every run, so the changes to the files are picked up
+	load   func() ([]test.FTWTest, error)
+	config runner.Config
+	// history is where the runs are added when they finish, nil without history
+	history *history.Store
+	mux     *http.ServeMux
+
+	mu   sync.Mutex
+	runs []*Run
+}
+
+// NewServer returns the server of the dashboard running the tests read by load with the
+// configuration of ftw and the Config of the runner. The finished runs are added to the history,
+// which is listed too, unless it's nil.
+func NewServer(cfg *config.FTWConfiguration, load func() ([]test.FTWTest, error), c runner.Config, store *history.Store) *Server {
+	s := &Server{cfg: cfg, load: load, config: c, history: store, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/", s.handleIndex)
+	s.mux.HandleFunc("/runs", s.handleStart)
+	s.mux.HandleFunc("/runs/", s.handleRun)
+	s.mux.HandleFunc("/history/", s.handleHistory)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start starts a run of the tests whose title matches the regular expression, or of the tests
+// selected by the Config of the runner when it's empty
+func (s *Server) Start(selection string) (*Run, error) {
+	c := s.config
+	if selection != "" {
+		include, err := regexp.Compile(selection)
+		if err != nil {
+			return nil, fmt.Errorf("ftw/dashboard: bad selection: %w", err)
+		}
+		c.Include, c.Exclude = include, nil
+	}
+	tests, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("ftw/dashboard: can't read the tests: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.runs) > 0 && s.runs[len(s.runs)-1].Running() {
+		return nil, ErrRunning
+	}
+	run := &Run{ID: len(s.runs) + 1, Selection: selection, Started: time.Now()}
+	s.runs = append(s.runs, run)
+
+	c.Quiet = true
+	c.Evidence = true
+	c.Events = &runEvents{server: s, run: run}
+	go func() {
+		runContext := runner.Run(s.cfg, tests, c)
+		if runContext.Err != nil {
+			// the results of the tests not all run are not added to the history
+			log.Error().Err(runContext.Err).Msgf("ftw/dashboard: run #%d stopped", run.ID)
+			s.mu.Lock()
+			run.Error = runContext.Err.Error()
+			run.Finished = time.Now()
+			s.mu.Unlock()
+			return
+		}
+		if s.history != nil {
+			if err := s.history.Add(history.NewRun(runContext.Stats, history.Fingerprint(s.cfg, selection))); err != nil {
+				log.Error().Err(err).Msg("ftw/dashboard: the run was not added to the history")
+			}
+		}
+		s.mu.Lock()
+		run.Finished = time.Now()
+		s.mu.Unlock()
+	}()
+	return run, nil
+}
+
+// Runs returns the runs started from the dashboard, the oldest first
+func (s *Server) Runs() []*Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Run{}, s.runs...)
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	var previous []history.Run
+	if s.history != nil {
+		var err error
+		if previous, err = s.history.Runs(historyRuns); err != nil {
+			log.Error().Err(err).Msg("ftw/dashboard: can't read the history")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]*Run, 0, len(s.runs))
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		runs = append(runs, s.runs[i])
+	}
+	newestFirst := make([]history.Run, 0, len(previous))
+	for i := len(previous) - 1; i >= 0; i-- {
+		newestFirst = append(newestFirst, previous[i])
+	}
+	s.render(w, indexTemplate, map[string]interface{}{
+		"Runs":    runs,
+		"History": newestFirst,
+		"Refresh": len(runs) > 0 && runs[0].Running(),
+	})
+}
+
+// handleStart starts a run of the tests matching the regular expression of the `include` field,
+// or of the titles of the `test` fields
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	selection := strings.TrimSpace(r.PostForm.Get("include"))
+	if titles := r.PostForm["test"]; len(titles) > 0 {
+		selection = Selection(titles)
+	}
+	run, err := s.Start(selection)
+	if errors.Is(err, ErrRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/runs/%d", run.ID), http.StatusSeeOther)
+}
+
+// Selection returns the regular expression selecting the tests with the titles
+func Selection(titles []string) string {
+	quoted := make([]string, len(titles))
+	for i, title := range titles {
+		quoted[i] = regexp.QuoteMeta(title)
+	}
+	return "^(?:" + strings.Join(quoted, "|") + ")$"
+}
+
+// handleRun shows the results of the tests of a run on /runs/<id>, or the details of one of them
+// on /runs/<id>/test?file=<file>&title=<title>
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	id, page, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+	n, err := strconv.Atoi(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil || n < 1 || n > len(s.runs) || (page != "" && page != "test") {
+		http.NotFound(w, r)
+		return
+	}
+	run := s.runs[n-1]
+	if page == "" {
+		s.render(w, runTemplate, map[string]interface{}{"Run": run, "Refresh": run.Running()})
+		return
+	}
+	t := run.Test(r.URL.Query().Get("file"), r.URL.Query().Get("title"))
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, testTemplate, map[string]interface{}{"Run": run, "Test": t, "Refresh": run.Running()})
+}
+
+// handleHistory shows the results of the tests of a run of the history on /history/<id>
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/history/")
+	if s.history == nil {
+		http.NotFound(w, r)
+		return
+	}
+	runs, err := s.history.Runs(0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, run := range runs {
+		if run.ID == id {
+			s.render(w, historyTemplate, map[string]interface{}{"Run": run})
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// render writes the page, or an error if the template fails
+func (s *Server) render(w http.ResponseWriter, page *template.Template, data interface{}) {
+	var b bytes.Buffer
+	if err := page.ExecuteTemplate(&b, "layout", data); err != nil {
+		log.Error().Err(err).Msg("ftw/dashboard: can't render the page")
+		http.Error(w, "can't render the page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = b.WriteTo(w)
+}
@@ -0,0 +1,232 @@
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/history"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var yamlTests = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "942100.yaml"
+tests:
+  - test_title: "942100-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1%27%20or%201=1"
+          output:
+            log:
+              rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1"
+          output:
+            log:
+              no_rule_ids: [942100]
+`
+
+// newTestServer returns a dashboard running the tests with the embedded WAF, whose rule matches
+// the request of 942100-2 too, which expects it not to
+func newTestServer(t *testing.T) (*Server, *httptest.Server, string) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx 1" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() ([]test.FTWTest, error) {
+		ftwTest, err := test.GetTestFromYaml([]byte(yamlTests))
+		ftwTest.FileName = "tests/942100.yaml"
+		return []test.FTWTest{ftwTest}, err
+	}
+	historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+	s := NewServer(cfg, load, runner.Config{}, history.NewStore(historyFile))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts, historyFile
+}
+
+// waitForRun waits for the end of the run
+func waitForRun(t *testing.T, s *Server, run *Run) {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		s.mu.Lock()
+		running := run.Running()
+		s.mu.Unlock()
+		if !running {
+			return
+		}
+	}
+	t.Fatalf("the run didn't finish")
+}
+
+func get(t *testing.T, u string) (int, string) {
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestStart(t *testing.T) {
+	s, ts, historyFile := newTestServer(t)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(ts.URL+"/runs", url.Values{"include": {""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/runs/1" {
+		t.Fatalf("expected a redirection to the run, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	runs := s.Runs()
+	if len(runs) != 1 {
+		t.Fatalf("expected a run, got %d", len(runs))
+	}
+	waitForRun(t, s, runs[0])
+
+	status, body := get(t, ts.URL+"/runs/1")
+	if status != http.StatusOK || !strings.Contains(body, "Finished at") || !strings.Contains(body, `<td class="failed">failed</td>`) ||
+		!strings.Contains(body, `<input type="checkbox" name="test" value="942100-2" checked>`) {
+		t.Errorf("unexpected run page %d\n%s", status, body)
+	}
+	if strings.Contains(body, "http-equiv") {
+		t.Errorf("the page of a finished run must not be refreshed")
+	}
+
+	status, body = get(t, ts.URL+"/runs/1/test?file=tests%2F942100.yaml&title=942100-2")
+	if status != http.StatusOK || !strings.Contains(body, "GET /?id=1 HTTP/1.1") || !strings.Contains(body, "HTTP/1.1 403 Forbidden") ||
+		!strings.Contains(body, `[id &#34;942100&#34;]`) {
+		t.Errorf("expected the evidence of the failed test, got %d\n%s", status, body)
+	}
+
+	status, body = get(t, ts.URL+"/")
+	if status != http.StatusOK || !strings.Contains(body, `<a href="/runs/1">#1</a>`) {
+		t.Errorf("unexpected index %d\n%s", status, body)
+	}
+	previous, err := history.NewStore(historyFile).Runs(0)
+	if err != nil || len(previous) != 1 {
+		t.Fatalf("expected the run in the history, got %v, %v", previous, err)
+	}
+	if !strings.Contains(body, `<a href="/history/`+previous[0].ID+`">`) {
+		t.Errorf("the runs of the history must be listed\n%s", body)
+	}
+	status, body = get(t, ts.URL+"/history/"+previous[0].ID)
+	if status != http.StatusOK || !strings.Contains(body, "<td>942100-2</td>") {
+		t.Errorf("unexpected run of the history %d\n%s", status, body)
+	}
+}
+
+func TestStartSelection(t *testing.T) {
+	s, ts, _ := newTestServer(t)
+
+	resp, err := http.PostForm(ts.URL+"/runs", url.Values{"test": {"942100-2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	run := s.Runs()[0]
+	waitForRun(t, s, run)
+	if run.Selection != "^(?:942100-2)$" {
+		t.Errorf("unexpected selection %q", run.Selection)
+	}
+	tests := run.Tests()
+	if len(tests) != 2 || tests[0].Result() != "skipped" || tests[1].Result() != "failed" {
+		t.Errorf("only the selected test must run, got %+v", tests)
+	}
+}
+
+func TestStoppedRun(t *testing.T) {
+	// the tests send their requests to localhost:1, where nothing listens
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() ([]test.FTWTest, error) {
+		ftwTest, err := test.GetTestFromYaml([]byte(yamlTests))
+		return []test.FTWTest{ftwTest}, err
+	}
+	historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+	s := NewServer(cfg, load, runner.Config{ConnectTimeout: time.Second}, history.NewStore(historyFile))
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	run, err := s.Start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForRun(t, s, run)
+	status, body := get(t, ts.URL+"/runs/1")
+	if status != http.StatusOK || !strings.Contains(body, "The run stopped before all the tests ran: ftw/run: can&#39;t connect to destination localhost:1") {
+		t.Errorf("unexpected run page %d\n%s", status, body)
+	}
+	if _, err := os.Stat(historyFile); !os.IsNotExist(err) {
+		t.Errorf("the stopped run must not be added to the history, got %v", err)
+	}
+}
+
+func TestStartErrors(t *testing.T) {
+	s, ts, _ := newTestServer(t)
+	if _, err := s.Start("("); err == nil {
+		t.Errorf("expected an error with a bad selection")
+	}
+
+	// a run is in progress until its end
+	s.runs = append(s.runs, &Run{ID: 1, Started: time.Now()})
+	if _, err := s.Start(""); err != ErrRunning {
+		t.Errorf("expected %v, got %v", ErrRunning, err)
+	}
+	resp, err := http.PostForm(ts.URL+"/runs", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+
+	if status, _ := get(t, ts.URL+"/runs"); status != http.StatusMethodNotAllowed {
+		t.Errorf("expected %d, got %d", http.StatusMethodNotAllowed, status)
+	}
+	for _, path := range []string{"/runs/2", "/runs/x", "/runs/1/other", "/history/unknown", "/other"} {
+		if status, _ := get(t, ts.URL+path); status != http.StatusNotFound {
+			t.Errorf("expected %d for %s, got %d", http.StatusNotFound, path, status)
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	if selection := Selection([]string{"942100-1", "a.b"}); selection != `^(?:942100-1|a\.b)$` {
+		t.Errorf("unexpected selection %q", selection)
+	}
+}
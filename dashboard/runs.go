@@ -0,0 +1,142 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// Run is a run of the tests started from the dashboard
+type Run struct {
+	// ID is the number of the run, from 1 in the order they started
+	ID int
+	// Selection is the regular expression selecting the tests of the run, empty when all of them
+	// ran
+	Selection string
+	Started   time.Time
+	// Finished is when the run finished, zero while it's in progress
+	Finished time.Time
+	// Stages are the stage_finished events of the run, with the evidence of the failed stages
+	Stages []runner.Event
+	// Stats are the totals of the run, nil while it's in progress
+	Stats *runner.EventStats
+	// Error is the error that stopped the run before all the tests ran, like a WAF that can't be
+	// reached, empty if none did
+	Error string
+}
+
+// Running returns whether the run is in progress
+func (r *Run) Running() bool {
+	return r.Finished.IsZero()
+}
+
+// Duration returns the time the run took, or the time since it started while it's in progress
+func (r *Run) Duration() time.Duration {
+	if r.Running() {
+		return time.Since(r.Started).Round(time.Second)
+	}
+	return r.Finished.Sub(r.Started).Round(time.Millisecond)
+}
+
+// Tests returns the results of the tests of the run, in the order they ran
+func (r *Run) Tests() []*TestRun {
+	var tests []*TestRun
+	index := map[string]*TestRun{}
+	for _, stage := range r.Stages {
+		key := stage.File + "\x00" + stage.Test
+		t, ok := index[key]
+		if !ok {
+			t = &TestRun{File: stage.File, Test: stage.Test}
+			index[key] = t
+			tests = append(tests, t)
+		}
+		t.Stages = append(t.Stages, stage)
+	}
+	return tests
+}
+
+// Counts returns the number of tests of the run by result
+func (r *Run) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, t := range r.Tests() {
+		counts[t.Result()]++
+	}
+	return counts
+}
+
+// Test returns the results of the test of the file, nil if it didn't run
+func (r *Run) Test(file string, title string) *TestRun {
+	for _, t := range r.Tests() {
+		if t.File == file && t.Test == title {
+			return t
+		}
+	}
+	return nil
+}
+
+// TestRun is the results of the stages of a test in a run
+type TestRun struct {
+	File   string
+	Test   string
+	Stages []runner.Event
+}
+
+// Result returns the name of the result of the test: failed when one of its stages failed or was
+// forced to fail, and otherwise the result of its stages, which are all skipped, ignored or forced
+// to pass together
+func (t *TestRun) Result() string {
+	result := runner.Success.String()
+	for _, stage := range t.Stages {
+		switch stage.Result {
+		case runner.Failed.String(), runner.ForceFail.String():
+			return stage.Result
+		case runner.Skipped.String(), runner.Ignored.String(), runner.ForcePass.String():
+			result = stage.Result
+		}
+	}
+	return result
+}
+
+// Failed returns whether the test failed or was forced to fail
+func (t *TestRun) Failed() bool {
+	result := t.Result()
+	return result == runner.Failed.String() || result == runner.ForceFail.String()
+}
+
+// TriggeredRules returns the rules found in the logs of the stages, in the order they were found
+func (t *TestRun) TriggeredRules() []int {
+	var ids []int
+	seen := map[int]bool{}
+	for _, stage := range t.Stages {
+		for _, id := range stage.TriggeredRules {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// runEvents keeps the events of a run written by the runner
+type runEvents struct {
+	server *Server
+	run    *Run
+}
+
+func (w *runEvents) Write(p []byte) (int, error) {
+	var event runner.Event
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	w.server.mu.Lock()
+	defer w.server.mu.Unlock()
+	switch event.Type {
+	case runner.StageFinished:
+		w.run.Stages = append(w.run.Stages, event)
+	case runner.RunFinished:
+		w.run.Stats = event.Stats
+	}
+	return len(p), nil
+}
@@ -0,0 +1,179 @@
+package dashboard
+
+import (
+	"html/template"
+	"strings"
+	"time"
+)
+
+// functions are the functions of the templates
+var functions = template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"seconds": func(s float64) string {
+		return (time.Duration(s * float64(time.Second))).Round(time.Millisecond).String()
+	},
+	"milliseconds": func(ms float64) string {
+		return (time.Duration(ms * float64(time.Millisecond))).Round(time.Microsecond).String()
+	},
+	"printable": printable,
+}
+
+const layout = `{{ define "layout" }}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-ftw</title>
+{{- if .Refresh }}
+<meta http-equiv="refresh" content="2">
+{{- end }}
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 0.8em; border-bottom: 1px solid #ddd; }
+pre { background: #f6f6f6; padding: 0.8em; overflow-x: auto; }
+.passed, .forced_pass { color: #080; }
+.failed, .forced_fail { color: #c00; font-weight: bold; }
+.skipped, .ignored { color: #888; }
+</style>
+</head>
+<body>
+<h1><a href="/">go-ftw</a></h1>
+{{ template "content" . }}
+</body>
+</html>
+{{ end }}`
+
+var indexTemplate = template.Must(template.New("index").Funcs(functions).Parse(layout + `{{ define "content" }}
+<form method="post" action="/runs">
+<input name="include" size="40" placeholder="Go regexp of the titles, empty for all the tests">
+<button type="submit">Run</button>
+</form>
+<h2>Runs</h2>
+{{- if .Runs }}
+<table>
+<tr><th>Run</th><th>Started</th><th>Selection</th><th>Tests</th><th>Failed</th><th>Time</th></tr>
+{{- range .Runs }}
+{{- $counts := .Counts }}
+<tr>
+<td><a href="/runs/{{ .ID }}">#{{ .ID }}</a></td>
+<td>{{ time .Started }}</td>
+<td><code>{{ .Selection }}</code></td>
+<td>{{ len .Tests }}</td>
+<td class="{{ if index $counts "failed" }}failed{{ end }}">{{ index $counts "failed" }}</td>
+<td>{{ if .Running }}running for {{ end }}{{ .Duration }}</td>
+</tr>
+{{- end }}
+</table>
+{{- else }}
+<p>No run yet.</p>
+{{- end }}
+{{- if .History }}
+<h2>History</h2>
+<table>
+<tr><th>Run</th><th>Finished</th><th>Tests</th><th>Time</th></tr>
+{{- range .History }}
+<tr>
+<td><a href="/history/{{ .ID }}">{{ .ID }}</a></td>
+<td>{{ time .FinishedAt }}</td>
+<td>{{ len .Tests }}</td>
+<td>{{ seconds .Time }}</td>
+</tr>
+{{- end }}
+</table>
+{{- end }}
+{{ end }}`))
+
+var runTemplate = template.Must(template.New("run").Funcs(functions).Parse(layout + `{{ define "content" }}
+{{- $run := .Run }}
+<h2>Run #{{ $run.ID }}{{ if $run.Selection }} of <code>{{ $run.Selection }}</code>{{ end }}</h2>
+<p>
+{{- if $run.Running }}Running for {{ $run.Duration }}, {{ len $run.Tests }} tests done.
+{{- else }}Finished at {{ time $run.Finished }} in {{ $run.Duration }}.{{ end }}
+{{- range $result, $count := $run.Counts }} <span class="{{ $result }}">{{ $count }} {{ $result }}</span>{{ end }}
+</p>
+{{- if $run.Error }}
+<p class="failed">The run stopped before all the tests ran: {{ $run.Error }}</p>
+{{- end }}
+<form method="post" action="/runs">
+<table>
+<tr><th></th><th>Test</th><th>File</th><th>Result</th><th>Triggered rules</th></tr>
+{{- range $run.Tests }}
+<tr>
+<td><input type="checkbox" name="test" value="{{ .Test }}"{{ if .Failed }} checked{{ end }}></td>
+<td><a href="/runs/{{ $run.ID }}/test?file={{ .File }}&amp;title={{ .Test }}">{{ .Test }}</a></td>
+<td>{{ .File }}</td>
+<td class="{{ .Result }}">{{ .Result }}</td>
+<td>{{ range $i, $id := .TriggeredRules }}{{ if $i }}, {{ end }}{{ $id }}{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+<p><button type="submit"{{ if $run.Running }} disabled{{ end }}>Run the selected tests again</button></p>
+</form>
+{{ end }}`))
+
+var testTemplate = template.Must(template.New("test").Funcs(functions).Parse(layout + `{{ define "content" }}
+<h2>{{ .Test.Test }} <small>{{ .Test.File }}</small></h2>
+<p>In <a href="/runs/{{ .Run.ID }}">run #{{ .Run.ID }}</a>: <span class="{{ .Test.Result }}">{{ .Test.Result }}</span></p>
+<form method="post" action="/runs">
+<input type="hidden" name="test" value="{{ .Test.Test }}">
+<button type="submit"{{ if .Run.Running }} disabled{{ end }}>Run the test again</button>
+</form>
+{{- range .Test.Stages }}
+<h3>{{ if .Stage }}Stage {{ .Stage }}{{ else }}Stage{{ end }}: <span class="{{ .Result }}">{{ .Result }}</span></h3>
+<p>
+{{- if .StatusCode }}Status {{ .StatusCode }}. {{ end }}
+{{- if .RoundTripTime }}RTT {{ milliseconds .RoundTripTime }}. {{ end }}
+{{- if .TriggeredRules }}Triggered {{ range $i, $id := .TriggeredRules }}{{ if $i }}, {{ end }}{{ $id }}{{ end }}.{{ end }}
+</p>
+{{- with .Evidence }}
+{{- if .Error }}
+<h4>Error</h4>
+<pre>{{ .Error }}</pre>
+{{- end }}
+{{- if .Request }}
+<h4>Request</h4>
+<pre>{{ printable .Request }}</pre>
+{{- end }}
+{{- if .Response }}
+<h4>Response</h4>
+<pre>{{ printable .Response }}</pre>
+{{- end }}
+{{- if .Logs }}
+<h4>Logs</h4>
+<pre>{{ range .Logs }}{{ . }}
+{{ end }}</pre>
+{{- end }}
+{{- end }}
+{{- end }}
+{{ end }}`))
+
+var historyTemplate = template.Must(template.New("history").Funcs(functions).Parse(layout + `{{ define "content" }}
+<h2>Run {{ .Run.ID }}</h2>
+<p>Finished at {{ time .Run.FinishedAt }}, the tests took {{ seconds .Run.Time }}.</p>
+<table>
+<tr><th>Test</th><th>File</th><th>Result</th><th>Time</th><th>Triggered rules</th></tr>
+{{- range .Run.Tests }}
+<tr>
+<td>{{ .Test }}</td>
+<td>{{ .File }}</td>
+<td class="{{ .Result }}">{{ .Result }}</td>
+<td>{{ seconds .Time }}</td>
+<td>{{ range $i, $id := .TriggeredRules }}{{ if $i }}, {{ end }}{{ $id }}{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+{{ end }}`))
+
+// printable returns the request or response without carriage returns, and with dots instead of
+// the other control characters
+func printable(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || (r >= ' ' && r != 0x7f) {
+			return r
+		}
+		return '.'
+	}, s)
+}
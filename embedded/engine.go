@@ -0,0 +1,219 @@
+// Package embedded evaluates the requests of the tests with a Coraza WAF running in the process,
+// loaded with the rules of the configuration, instead of sending them to a web server
+package embedded
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
+
+const (
+	// clientAddr is the address the requests are sent from
+	clientAddr = "127.0.0.1"
+	// clientPort is the port the requests are sent from
+	clientPort = 54321
+)
+
+// ErrDropped is returned when the WAF drops the connection of a request, like a web server
+// closing it without response
+var ErrDropped = errors.New("ftw/embedded: the connection was dropped by the WAF")
+
+// Engine is the Coraza WAF evaluating the requests. Requests are evaluated one at a time.
+type Engine struct {
+	waf coraza.WAF
+
+	mu sync.Mutex
+	// lines are the error log lines of the rules matched by the request being evaluated
+	lines [][]byte
+}
+
+// NewEngine loads the directives, and then the rule files in order, into a new WAF
+func NewEngine(cfg config.EmbeddedConfig) (*Engine, error) {
+	files, err := ruleFiles(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Engine{}
+	wafConfig := coraza.NewWAFConfig().WithErrorCallback(e.logRule)
+	if cfg.Directives != "" {
+		wafConfig = wafConfig.WithDirectives(cfg.Directives)
+	}
+	for _, file := range files {
+		log.Debug().Msgf("ftw/embedded: loading rules from %s", file)
+		wafConfig = wafConfig.WithDirectivesFromFile(file)
+	}
+	if e.waf, err = coraza.NewWAF(wafConfig); err != nil {
+		return nil, fmt.Errorf("ftw/embedded: can't load the rules: %w", err)
+	}
+	return e, nil
+}
+
+// ruleFiles expands the patterns of the rule files, keeping their order
+func ruleFiles(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("ftw/embedded: bad rules pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("ftw/embedded: no rules file matches %q", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// logRule is called by the WAF with the rules matched that are logged
+func (e *Engine) logRule(rule types.MatchedRule) {
+	e.lines = append(e.lines, []byte(rule.ErrorLog()))
+}
+
+// Do evaluates the request with the WAF, like a web server embedding it. Requests that are not
+// interrupted are answered with an empty 200, as there is no backend, and requests that can't be
+// parsed with a 400 without being evaluated. It returns the response, and the rules matched like
+// in the Coraza error log.
+func (e *Engine) Do(req ftwhttp.Request, dest ftwhttp.Destination) (*ftwhttp.Response, [][]byte, error) {
+	data, err := req.Bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debug().Msgf("ftw/embedded: evaluating data:\n%s\n", data)
+
+	start := time.Now()
+	parsed, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		log.Debug().Msgf("ftw/embedded: bad request: %s", err.Error())
+		response, err := newResponse(http.StatusBadRequest, nil)
+		if response != nil {
+			response.RoundTripTime = time.Since(start)
+		}
+		return response, nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lines = nil
+
+	tx := e.waf.NewTransaction()
+	it, err := processRequest(tx, parsed, dest)
+	tx.ProcessLogging()
+	if closeErr := tx.Close(); closeErr != nil {
+		log.Debug().Msgf("ftw/embedded: error closing the transaction: %s", closeErr.Error())
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("ftw/embedded: can't evaluate the request: %w", err)
+	}
+
+	lines := e.lines
+	e.lines = nil
+	var response *ftwhttp.Response
+	if it == nil {
+		response, err = newResponse(http.StatusOK, nil)
+	} else {
+		log.Debug().Msgf("ftw/embedded: request interrupted by rule %d with %s", it.RuleID, it.Action)
+		response, err = interruptionResponse(it)
+	}
+	if response != nil {
+		response.RoundTripTime = time.Since(start)
+	}
+	return response, lines, err
+}
+
+// processRequest evaluates the phases of the transaction for the request and an empty response,
+// until one of them interrupts it
+func processRequest(tx types.Transaction, req *http.Request, dest ftwhttp.Destination) (*types.Interruption, error) {
+	tx.ProcessConnection(clientAddr, clientPort, dest.DestAddr, dest.Port)
+	tx.ProcessURI(req.RequestURI, req.Method, req.Proto)
+	for name, values := range req.Header {
+		for _, value := range values {
+			tx.AddRequestHeader(name, value)
+		}
+	}
+	// the Host and Transfer-Encoding headers are removed from the parsed headers
+	if req.Host != "" {
+		tx.AddRequestHeader("Host", req.Host)
+		tx.SetServerName(req.Host)
+	}
+	if len(req.TransferEncoding) > 0 {
+		tx.AddRequestHeader("Transfer-Encoding", strings.Join(req.TransferEncoding, ", "))
+	}
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		return it, nil
+	}
+
+	if tx.IsRequestBodyAccessible() && req.Body != nil {
+		it, _, err := tx.ReadRequestBodyFrom(req.Body)
+		if err != nil || it != nil {
+			return it, err
+		}
+	}
+	if it, err := tx.ProcessRequestBody(); err != nil || it != nil {
+		return it, err
+	}
+
+	if it := tx.ProcessResponseHeaders(http.StatusOK, req.Proto); it != nil {
+		return it, nil
+	}
+	return tx.ProcessResponseBody()
+}
+
+// interruptionResponse returns the response of a web server for the interruption: the status of
+// the action, 403 by default, or a redirect. Dropped connections have no response.
+func interruptionResponse(it *types.Interruption) (*ftwhttp.Response, error) {
+	switch it.Action {
+	case "drop":
+		return nil, ErrDropped
+	case "redirect":
+		status := it.Status
+		if status == 0 {
+			status = http.StatusFound
+		}
+		return newResponse(status, http.Header{"Location": {it.Data}})
+	default:
+		status := it.Status
+		if status == 0 {
+			status = http.StatusForbidden
+		}
+		return newResponse(status, nil)
+	}
+}
+
+// newResponse returns a response with the status and headers, and without body
+func newResponse(status int, header http.Header) (*ftwhttp.Response, error) {
+	if header == nil {
+		header = http.Header{}
+	}
+	parsed := http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          http.NoBody,
+		ContentLength: 0,
+	}
+	var raw bytes.Buffer
+	if err := parsed.Write(&raw); err != nil {
+		return nil, err
+	}
+	parsed.Body = io.NopCloser(bytes.NewReader(nil))
+	return &ftwhttp.Response{RAW: raw.Bytes(), Parsed: parsed}, nil
+}
@@ -0,0 +1,104 @@
+package embedded
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
+
+const testRules = `
+SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"
+SecRule REQUEST_HEADERS:X-Redirect "@streq yes" "id:1001,phase:1,redirect:http://example.com/,log"
+SecRule REQUEST_HEADERS:X-Drop "@streq yes" "id:1002,phase:1,drop,log"
+SecRule REQUEST_HEADERS:User-Agent "@streq scanner" "id:1003,phase:1,pass,log,msg:'Scanner'"
+SecRule REQUEST_HEADERS:User-Agent "@streq scanner" "id:1004,phase:1,pass,nolog"
+`
+
+func newTestEngine(t *testing.T) *Engine {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rules.conf"), []byte(testRules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(config.EmbeddedConfig{
+		Directives: config.DefaultEmbeddedDirectives,
+		Rules:      []string{filepath.Join(dir, "*.conf")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func newTestRequest(uri string, headers ftwhttp.Header, data string) ftwhttp.Request {
+	method := "GET"
+	if data != "" {
+		method = "POST"
+	}
+	headers = append(ftwhttp.Header{{Name: "Host", Value: "localhost"}}, headers...)
+	return *ftwhttp.NewRequest(&ftwhttp.RequestLine{Method: method, URI: uri, Version: "HTTP/1.1"}, headers, []byte(data), true)
+}
+
+func TestEngine(t *testing.T) {
+	engine := newTestEngine(t)
+	dest := ftwhttp.Destination{DestAddr: "localhost", Port: 80, Protocol: "http"}
+
+	tests := []struct {
+		name     string
+		request  ftwhttp.Request
+		status   int
+		location string
+		ids      []string
+	}{
+		{"query", newTestRequest("/?id=1%27", nil, ""), 403, "", []string{"942100"}},
+		{"body", newTestRequest("/", nil, "id=1%27"), 403, "", []string{"942100"}},
+		{"allowed", newTestRequest("/?id=1", nil, ""), 200, "", nil},
+		{"logged", newTestRequest("/", ftwhttp.Header{{Name: "User-Agent", Value: "scanner"}}, ""), 200, "", []string{"1003"}},
+		{"redirect", newTestRequest("/", ftwhttp.Header{{Name: "X-Redirect", Value: "yes"}}, ""), 302, "http://example.com/", []string{"1001"}},
+		{"bad request", *ftwhttp.NewRawRequest([]byte("GARBAGE\r\n\r\n"), false), 400, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, lines, err := engine.Do(tt.request, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Parsed.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, response.Parsed.StatusCode)
+			}
+			if location := response.Parsed.Header.Get("Location"); location != tt.location {
+				t.Errorf("unexpected location %q", location)
+			}
+			if !bytes.HasPrefix(response.RAW, []byte("HTTP/1.1 ")) {
+				t.Errorf("unexpected raw response %q", response.RAW)
+			}
+			if len(lines) != len(tt.ids) {
+				t.Fatalf("expected %d log lines, got %q", len(tt.ids), lines)
+			}
+			for i, id := range tt.ids {
+				if !bytes.Contains(lines[i], []byte(`[id "`+id+`"]`)) || !bytes.Contains(lines[i], []byte("Coraza:")) {
+					t.Errorf("unexpected log line %q", lines[i])
+				}
+			}
+		})
+	}
+
+	_, _, err := engine.Do(newTestRequest("/", ftwhttp.Header{{Name: "X-Drop", Value: "yes"}}, ""), dest)
+	if !errors.Is(err, ErrDropped) {
+		t.Errorf("expected the connection to be dropped, got %v", err)
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	if _, err := NewEngine(config.EmbeddedConfig{Rules: []string{filepath.Join(t.TempDir(), "*.conf")}}); err == nil || !strings.Contains(err.Error(), "no rules file matches") {
+		t.Errorf("expected an error for a pattern without files, got %v", err)
+	}
+	if _, err := NewEngine(config.EmbeddedConfig{Directives: "SecRule ARGS"}); err == nil || !strings.Contains(err.Error(), "can't load the rules") {
+		t.Errorf("expected an error for bad directives, got %v", err)
+	}
+}
@@ -1,22 +1,35 @@
 package ftwhttp
 
 import (
+	"context"
 	"crypto/tls"
-	"fmt"
 	"net"
 	"net/http/cookiejar"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/publicsuffix"
+
+	"github.com/coreruleset/go-ftw/tracing"
 )
 
+// tracer creates the spans of the requests
+var tracer = tracing.Tracer("github.com/coreruleset/go-ftw/ftwhttp")
+
+// DefaultMaxBodySize is the default limit for the size of response bodies (10 MiB)
+const DefaultMaxBodySize int64 = 10 * 1024 * 1024
+
 // NewClientConfig returns a new ClientConfig with reasonable defaults.
 func NewClientConfig() ClientConfig {
 	return ClientConfig{
 		ConnectTimeout: 3 * time.Second,
 		ReadTimeout:    1 * time.Second,
+		MaxBodySize:    DefaultMaxBodySize,
 	}
 }
 
@@ -42,11 +55,7 @@ func (c *Client) NewConnection(d Destination) error {
 		}
 	}
 
-	c.Transport = &Connection{
-		protocol:    d.Protocol,
-		readTimeout: c.config.ReadTimeout,
-		duration:    NewRoundTripTime(),
-	}
+	c.Transport = c.newTransport(d)
 
 	netConn, err := c.dial(d)
 	if err == nil {
@@ -56,14 +65,28 @@ func (c *Client) NewConnection(d Destination) error {
 	return err
 }
 
+// newTransport creates the Connection for a Destination, without connecting yet
+func (c *Client) newTransport(d Destination) *Connection {
+	return &Connection{
+		protocol:    d.Protocol,
+		readTimeout: c.config.ReadTimeout,
+		maxBodySize: c.config.MaxBodySize,
+		bodyTimeout: c.config.BodyTimeout,
+		duration:    NewRoundTripTime(),
+	}
+}
+
 // NewOrReusedConnection reuses an existing connection, or creates a new one
 // if no connection has been set up yet
 func (c *Client) NewOrReusedConnection(d Destination) error {
 	if c.Transport == nil {
 		return c.NewConnection(d)
 	}
-	if err := c.Transport.connection.Close(); err != nil {
-		return err
+	// the connection of a gRPC call is closed once the call is done
+	if c.Transport.connection != nil {
+		if err := c.Transport.connection.Close(); err != nil {
+			return err
+		}
 	}
 
 	netConn, err := c.dial(d)
@@ -76,13 +99,24 @@ func (c *Client) NewOrReusedConnection(d Destination) error {
 
 // dial tries to establish a connection
 func (c *Client) dial(d Destination) (net.Conn, error) {
-	hostPort := fmt.Sprintf("%s:%d", d.DestAddr, d.Port)
+	return c.dialWithProtos(d, nil)
+}
+
+// dialWithProtos tries to establish a connection, announcing the application protocols
+// passed when using TLS
+func (c *Client) dialWithProtos(d Destination, protos []string) (net.Conn, error) {
+	hostPort := net.JoinHostPort(d.DestAddr, strconv.Itoa(d.Port))
 
 	// Fatal error: dial tcp 127.0.0.1:80: connect: connection refused
 	// strings.HasSuffix(err.String(), "connection refused") {
 	if strings.ToLower(d.Protocol) == "https" {
-		// Commenting InsecureSkipVerify: true.
-		return tls.DialWithDialer(&net.Dialer{Timeout: c.config.ConnectTimeout}, "tcp", hostPort, &tls.Config{MinVersion: tls.VersionTLS12})
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, NextProtos: protos}
+		if d.TLS != nil {
+			// only set for test instances, explicitly in the configuration
+			tlsConfig.InsecureSkipVerify = d.TLS.InsecureSkipVerify
+			tlsConfig.ServerName = d.TLS.ServerName
+		}
+		return tls.DialWithDialer(&net.Dialer{Timeout: c.config.ConnectTimeout}, "tcp", hostPort, tlsConfig)
 	}
 
 	return net.DialTimeout("tcp", hostPort, c.config.ConnectTimeout)
@@ -90,6 +124,20 @@ func (c *Client) dial(d Destination) (net.Conn, error) {
 
 // Do performs the http request roundtrip
 func (c *Client) Do(req Request) (*Response, error) {
+	return c.DoContext(context.Background(), req)
+}
+
+// DoContext performs the http request roundtrip in a span, child of the span of the context
+func (c *Client) DoContext(ctx context.Context, req Request) (*Response, error) {
+	_, span := tracer.Start(ctx, "request", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	if req.requestLine != nil {
+		span.SetAttributes(
+			attribute.String("http.method", req.requestLine.Method),
+			attribute.String("http.target", req.requestLine.URI),
+		)
+	}
+
 	var response *Response
 
 	err := c.Transport.Request(&req)
@@ -104,9 +152,21 @@ func (c *Client) Do(req Request) (*Response, error) {
 		}
 	}
 
+	endRequestSpan(span, response, err)
 	return response, err
 }
 
+// endRequestSpan records the status of the response, or the error, in the span of the request
+func endRequestSpan(span trace.Span, response *Response, err error) {
+	if response != nil {
+		span.SetAttributes(attribute.Int("http.status_code", response.Parsed.StatusCode))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
 // GetRoundTripTime returns the time taken from the initial send till receiving the full response
 func (c *Client) GetRoundTripTime() *RoundTripTime {
 	return c.Transport.GetTrackedTime()
@@ -1,6 +1,8 @@
 package ftwhttp
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -69,7 +71,7 @@ func TestGetTrackedTime(t *testing.T) {
 		Version: "HTTP/1.1",
 	}
 
-	h := Header{"Accept": "*/*", "User-Agent": "go-ftw test agent", "Host": "localhost"}
+	h := Header{{"Accept", "*/*"}, {"Host", "localhost"}, {"User-Agent", "go-ftw test agent"}}
 
 	data := []byte(`test=me&one=two&one=twice`)
 	req := NewRequest(rl, h, data, true)
@@ -116,8 +118,10 @@ func TestClientMultipartFormDataRequest(t *testing.T) {
 	}
 
 	h := Header{
-		"Accept": "*/*", "User-Agent": "go-ftw test agent", "Host": "localhost",
-		"Content-Type": "multipart/form-data; boundary=--------397236876",
+		{"Accept", "*/*"},
+		{"Content-Type", "multipart/form-data; boundary=--------397236876"},
+		{"Host", "localhost"},
+		{"User-Agent", "go-ftw test agent"},
 	}
 
 	data := []byte(`----------397236876
@@ -225,3 +229,24 @@ func TestNewOrReusedConnectionReusesTransport(t *testing.T) {
 		t.Errorf("Transport must not be reinitialized when reusing connection")
 	}
 }
+
+func TestConnectDestinationTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(NewClientConfig())
+	// the certificate of the test server is self-signed
+	if err := c.NewConnection(*d); err == nil {
+		t.Error("the certificate must be verified by default")
+	}
+
+	d.TLS = &TLSConfig{InsecureSkipVerify: true}
+	if err := c.NewConnection(*d); err != nil {
+		t.Errorf("the certificate must not be verified: %s", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -68,8 +69,7 @@ func (c *Connection) send(data []byte) (int, error) {
 func (c *Connection) receive() (io.Reader, error) {
 	log.Trace().Msg("ftw/http: receiving data")
 
-	// We assume the response body can be handled in memory without problems
-	// That's why we use io.ReadAll
+	// The response body is read into memory, up to the configured size limit
 	if err := c.connection.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
 		return nil, err
 	}
@@ -82,7 +82,7 @@ func (c *Connection) Request(request *Request) error {
 	// Build request first, then connect and send, so timers are accurate
 	data, err := buildRequest(request)
 	if err != nil {
-		log.Fatal().Msgf("ftw/http: fatal error building request: %s", err.Error())
+		return fmt.Errorf("ftw/http: error building request: %w", err)
 	}
 
 	log.Debug().Msgf("ftw/http: sending data:\n%s\n", data)
@@ -105,21 +105,94 @@ func (c *Connection) Response() (*Response, error) {
 		return nil, err
 	}
 
-	buf := &bytes.Buffer{}
+	buf := &cappedBuffer{limit: -1}
 
-	reader := *bufio.NewReader(io.TeeReader(r, buf))
+	reader := bufio.NewReader(io.TeeReader(r, buf))
 
-	httpResponse, err := http.ReadResponse(&reader, nil)
+	httpResponse, err := http.ReadResponse(reader, nil)
 	if err != nil {
 		return nil, err
 	}
+	if c.maxBodySize > 0 {
+		// the raw response keeps the status line, the headers and at most the size limit of the
+		// body, the reader may have buffered more
+		buf.limit = buf.Len() - reader.Buffered() + int(c.maxBodySize)
+	}
+
+	// Read the body now, so huge or never-ending bodies are cut by the limits
+	body, truncated := c.readBody(httpResponse.Body)
+	httpResponse.Body = io.NopCloser(bytes.NewReader(body))
 
 	data := buf.Bytes()
+	if buf.limit >= 0 && len(data) > buf.limit {
+		data = data[:buf.limit]
+	}
 	log.Trace().Msgf("ftw/http: received data - %q", data)
 
 	response := Response{
-		RAW:    data,
-		Parsed: *httpResponse,
+		RAW:       data,
+		Parsed:    *httpResponse,
+		Truncated: truncated,
 	}
 	return &response, err
 }
+
+// readBody streams the body up to the size limit and within the body timeout.
+// It returns what could be read, and whether the body was truncated.
+func (c *Connection) readBody(body io.ReadCloser) ([]byte, bool) {
+	if c.bodyTimeout > 0 {
+		if err := c.connection.SetReadDeadline(time.Now().Add(c.bodyTimeout)); err != nil {
+			log.Debug().Msgf("ftw/http: cannot set body timeout: %s", err.Error())
+		}
+	}
+
+	var r io.Reader = body
+	if c.maxBodySize > 0 {
+		// read one more byte, so we know if there was more to read
+		r = io.LimitReader(body, c.maxBodySize+1)
+	}
+
+	data, err := io.ReadAll(r)
+	if c.maxBodySize > 0 && int64(len(data)) > c.maxBodySize {
+		log.Debug().Msgf("ftw/http: response body exceeds %d bytes, truncating", c.maxBodySize)
+		c.abort()
+		return data[:c.maxBodySize], true
+	}
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			log.Debug().Msgf("ftw/http: timeout reading response body, using %d bytes read", len(data))
+			c.abort()
+			return data, true
+		}
+		log.Debug().Msgf("ftw/http: error reading response body: %s", err.Error())
+	}
+	body.Close()
+	return data, false
+}
+
+// abort closes the connection once the body of the response is not read to its end. Closing
+// the body instead would read the rest of it, to reuse the connection.
+func (c *Connection) abort() {
+	if err := c.connection.Close(); err != nil {
+		log.Debug().Msgf("ftw/http: error closing the connection: %s", err.Error())
+	}
+	c.connection = nil
+}
+
+// cappedBuffer keeps the bytes written up to its limit, and discards the rest. A negative limit
+// means no limit.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit < 0 || b.Len()+len(p) <= b.limit {
+		return b.Buffer.Write(p)
+	}
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:room])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,276 @@
+package ftwhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// GRPCContentType is the content type used for gRPC requests
+	GRPCContentType string = "application/grpc"
+	// grpcFrameHeaderSize is the size of the length-prefix in front of every gRPC message
+	grpcFrameHeaderSize int = 5
+)
+
+// GRPCRequest represents a unary gRPC call
+type GRPCRequest struct {
+	path     string
+	metadata Header
+	message  []byte
+	output   protoreflect.MessageDescriptor
+}
+
+// NewGRPCRequest creates a new unary gRPC request. The service and method are looked up in the
+// descriptor set file (as written by `protoc --descriptor_set_out --include_imports`), and the
+// JSON payload is converted to the protobuf input message of the method.
+func NewGRPCRequest(descriptorSet string, service string, method string, payload []byte, metadata Header) (*GRPCRequest, error) {
+	md, err := findGRPCMethod(descriptorSet, service, method)
+	if err != nil {
+		return nil, err
+	}
+
+	input := dynamicpb.NewMessage(md.Input())
+	if len(bytes.TrimSpace(payload)) > 0 {
+		if err = protojson.Unmarshal(payload, input); err != nil {
+			return nil, fmt.Errorf("ftw/http: cannot convert payload to %s: %w", md.Input().FullName(), err)
+		}
+	}
+	message, err := proto.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &GRPCRequest{
+		path:     fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name()),
+		metadata: metadata.Clone(),
+		message:  message,
+		output:   md.Output(),
+	}
+	return r, nil
+}
+
+// Path returns the HTTP/2 path of the call, e.g. `/package.Service/Method`
+func (r GRPCRequest) Path() string {
+	return r.path
+}
+
+// Message returns the serialized protobuf request message
+func (r GRPCRequest) Message() []byte {
+	return r.message
+}
+
+// NewGRPCConnection creates a new Connection based on a Destination, negotiating HTTP/2
+// when using TLS
+func (c *Client) NewGRPCConnection(d Destination) error {
+	if c.Transport != nil && c.Transport.connection != nil {
+		if err := c.Transport.connection.Close(); err != nil {
+			return err
+		}
+	}
+
+	c.Transport = c.newTransport(d)
+
+	netConn, err := c.dialWithProtos(d, []string{http2.NextProtoTLS})
+	if err == nil {
+		c.Transport.connection = netConn
+	}
+
+	return err
+}
+
+// DoGRPC performs the gRPC roundtrip over the current connection. The response messages
+// are decoded and made available as JSON in the response body, so they can be checked like
+// any other response.
+func (c *Client) DoGRPC(req GRPCRequest) (*Response, error) {
+	return c.DoGRPCContext(context.Background(), req)
+}
+
+// DoGRPCContext performs the gRPC roundtrip in a span, child of the span of the context
+func (c *Client) DoGRPCContext(ctx context.Context, req GRPCRequest) (*Response, error) {
+	_, span := tracer.Start(ctx, "request", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(attribute.String("rpc.system", "grpc"), attribute.String("http.target", req.path))
+
+	if c.Transport == nil || c.Transport.connection == nil {
+		err := errors.New("ftw/http/grpc: not connected to server")
+		endRequestSpan(span, nil, err)
+		return nil, err
+	}
+
+	response, err := c.Transport.grpcRoundTrip(&req)
+	if err != nil {
+		log.Debug().Msgf("ftw/http: error receiving grpc response: %s\n", err.Error())
+	}
+
+	endRequestSpan(span, response, err)
+	return response, err
+}
+
+func (c *Connection) grpcRoundTrip(req *GRPCRequest) (*Response, error) {
+	t := &http2.Transport{AllowHTTP: true}
+	cc, err := t.NewClientConn(c.connection)
+	if err != nil {
+		return nil, err
+	}
+	// the connection is only used for this call, closing the client connection closes it too
+	defer func() {
+		cc.Close()
+		c.connection = nil
+	}()
+
+	scheme := "http"
+	if strings.ToLower(c.protocol) == "https" {
+		scheme = "https"
+	}
+	host := c.connection.RemoteAddr().String()
+	if h := req.metadata.Get("Host"); h != "" {
+		host = h
+	}
+
+	httpRequest, err := http.NewRequest("POST", fmt.Sprintf("%s://%s%s", scheme, host, req.path), bytes.NewReader(encodeGRPCFrame(req.message)))
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range req.metadata {
+		if strings.EqualFold(field.Name, "Host") {
+			continue
+		}
+		httpRequest.Header.Add(field.Name, field.Value)
+	}
+	httpRequest.Header.Set(ContentTypeHeader, GRPCContentType)
+	httpRequest.Header.Set("TE", "trailers")
+
+	log.Debug().Msgf("ftw/http: sending grpc request to %s: %x", req.path, req.message)
+
+	if err = c.connection.SetDeadline(time.Now().Add(c.readTimeout)); err != nil {
+		return nil, err
+	}
+
+	httpResponse, err := cc.RoundTrip(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+
+	data, truncated := c.readBody(httpResponse.Body)
+	log.Trace().Msgf("ftw/http: received grpc data - %q", data)
+
+	// the status of the call is sent in the trailers, read with the body, unless the server only
+	// sent headers. Both are headers of the response, so the checks of the headers see the
+	// `grpc-status` and `grpc-message` of every call.
+	for name, values := range httpResponse.Trailer {
+		for _, value := range values {
+			httpResponse.Header.Add(name, value)
+		}
+	}
+
+	// Show decoded messages as body, so response checks can be written against JSON
+	body := data
+	if decoded, err := decodeGRPCFrames(data, req.output); err == nil {
+		body = decoded
+	} else {
+		log.Debug().Msgf("ftw/http: cannot decode grpc response: %s", err.Error())
+	}
+	httpResponse.Body = io.NopCloser(bytes.NewReader(body))
+
+	response := Response{
+		RAW:       data,
+		Parsed:    *httpResponse,
+		Truncated: truncated,
+	}
+	return &response, nil
+}
+
+func findGRPCMethod(descriptorSet string, service string, method string) (protoreflect.MethodDescriptor, error) {
+	contents, err := os.ReadFile(descriptorSet)
+	if err != nil {
+		return nil, err
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(contents, fds); err != nil {
+		return nil, fmt.Errorf("ftw/http: cannot read descriptor set %s: %w", descriptorSet, err)
+	}
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, fmt.Errorf("ftw/http: invalid descriptor set %s: %w", descriptorSet, err)
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("ftw/http: cannot find service %s: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("ftw/http: %s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("ftw/http: service %s has no method %s", service, method)
+	}
+	return md, nil
+}
+
+// encodeGRPCFrame adds the length-prefix (uncompressed) to a message
+func encodeGRPCFrame(message []byte) []byte {
+	frame := make([]byte, grpcFrameHeaderSize+len(message))
+	binary.BigEndian.PutUint32(frame[1:grpcFrameHeaderSize], uint32(len(message)))
+	copy(frame[grpcFrameHeaderSize:], message)
+	return frame
+}
+
+// decodeGRPCFrames converts all length-prefixed messages to JSON, one message per line
+func decodeGRPCFrames(data []byte, output protoreflect.MessageDescriptor) ([]byte, error) {
+	var b bytes.Buffer
+
+	for len(data) > 0 {
+		if len(data) < grpcFrameHeaderSize {
+			return nil, errors.New("ftw/http/grpc: truncated frame header")
+		}
+		if data[0] != 0 {
+			return nil, errors.New("ftw/http/grpc: compressed messages are not supported")
+		}
+		size := int(binary.BigEndian.Uint32(data[1:grpcFrameHeaderSize]))
+		data = data[grpcFrameHeaderSize:]
+		if len(data) < size {
+			return nil, errors.New("ftw/http/grpc: truncated message")
+		}
+
+		message := dynamicpb.NewMessage(output)
+		if err := proto.Unmarshal(data[:size], message); err != nil {
+			return nil, err
+		}
+		j, err := protojson.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		// protojson output is deliberately unstable, compact it so it can be matched
+		if err = json.Compact(&b, j); err != nil {
+			return nil, err
+		}
+		b.WriteString("\n")
+		data = data[size:]
+	}
+
+	return b.Bytes(), nil
+}
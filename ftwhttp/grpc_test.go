@@ -0,0 +1,245 @@
+package ftwhttp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func createDescriptorSetForTesting(t *testing.T) string {
+	message := func(name string) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name: proto.String(name),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("message"),
+				JsonName: proto.String("message"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}},
+		}
+	}
+	fds := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:        proto.String("echo.proto"),
+			Package:     proto.String("echo"),
+			Syntax:      proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{message("EchoRequest"), message("EchoReply")},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Echo"),
+				Method: []*descriptorpb.MethodDescriptorProto{{
+					Name:       proto.String("Echo"),
+					InputType:  proto.String(".echo.EchoRequest"),
+					OutputType: proto.String(".echo.EchoReply"),
+				}},
+			}},
+		}},
+	}
+	contents, err := proto.Marshal(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.CreateTemp(t.TempDir(), "echo-*.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+// grpcTestServer echoes the request message back, unless the metadata asks to be blocked, or to
+// be denied with the status of the call
+func grpcTestServer() *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Deny") != "" {
+			w.Header().Set("Content-Type", GRPCContentType)
+			w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Grpc-Status", "7")
+			w.Header().Set("Grpc-Message", "denied")
+			return
+		}
+		if r.URL.Path != "/echo.Echo/Echo" || r.Header.Get("Content-Type") != GRPCContentType {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", GRPCContentType)
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write(body)
+		w.Header().Set("Grpc-Status", "0")
+	})
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+func TestNewGRPCRequest(t *testing.T) {
+	descriptorSet := createDescriptorSetForTesting(t)
+
+	req, err := NewGRPCRequest(descriptorSet, "echo.Echo", "Echo", []byte(`{"message": "hello"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Path() != "/echo.Echo/Echo" {
+		t.Errorf("unexpected path %s", req.Path())
+	}
+	// field 1, wire type 2, length 5, "hello"
+	if string(req.Message()) != "\x0a\x05hello" {
+		t.Errorf("unexpected message %q", req.Message())
+	}
+}
+
+func TestNewGRPCRequestErrors(t *testing.T) {
+	descriptorSet := createDescriptorSetForTesting(t)
+
+	if _, err := NewGRPCRequest(descriptorSet, "echo.Missing", "Echo", nil, nil); err == nil {
+		t.Error("expected error for unknown service")
+	}
+	if _, err := NewGRPCRequest(descriptorSet, "echo.Echo", "Missing", nil, nil); err == nil {
+		t.Error("expected error for unknown method")
+	}
+	if _, err := NewGRPCRequest(descriptorSet, "echo.Echo", "Echo", []byte(`{"unknown": 1}`), nil); err == nil {
+		t.Error("expected error for payload not matching the message")
+	}
+	if _, err := NewGRPCRequest("does-not-exist.protoset", "echo.Echo", "Echo", nil, nil); err == nil {
+		t.Error("expected error for missing descriptor set")
+	}
+}
+
+func TestDoGRPC(t *testing.T) {
+	server := grpcTestServer()
+	defer server.Close()
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewGRPCRequest(createDescriptorSetForTesting(t), "echo.Echo", "Echo", []byte(`{"message": "<script>"}`), Header{{"Host", "localhost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(NewClientConfig())
+	if err = c.NewGRPCConnection(*d); err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.DoGRPC(*req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Parsed.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status %d", response.Parsed.StatusCode)
+	}
+	if body := response.GetBodyAsString(); !strings.Contains(body, `{"message":"<script>"}`) {
+		t.Errorf("unexpected body %s", body)
+	}
+	if status := response.Parsed.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("unexpected grpc status %q", status)
+	}
+}
+
+func TestDoGRPCBlocked(t *testing.T) {
+	server := grpcTestServer()
+	defer server.Close()
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewGRPCRequest(createDescriptorSetForTesting(t), "echo.Echo", "Echo", nil, Header{{"X-Block", "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(NewClientConfig())
+	if err = c.NewGRPCConnection(*d); err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.DoGRPC(*req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Parsed.StatusCode != http.StatusForbidden {
+		t.Errorf("unexpected status %d", response.Parsed.StatusCode)
+	}
+}
+
+func TestDoGRPCStatus(t *testing.T) {
+	server := grpcTestServer()
+	defer server.Close()
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewGRPCRequest(createDescriptorSetForTesting(t), "echo.Echo", "Echo", nil, Header{{"X-Deny", "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(NewClientConfig())
+	if err = c.NewGRPCConnection(*d); err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.DoGRPC(*req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Parsed.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status %d", response.Parsed.StatusCode)
+	}
+	// the status of the call is in the trailers, checked like the headers
+	if status, message := response.Parsed.Header.Get("Grpc-Status"), response.Parsed.Header.Get("Grpc-Message"); status != "7" || message != "denied" {
+		t.Errorf("the status of the call must be in the headers, got %q %q", status, message)
+	}
+}
+
+func TestDoGRPCClosesConnection(t *testing.T) {
+	server := grpcTestServer()
+	defer server.Close()
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewGRPCRequest(createDescriptorSetForTesting(t), "echo.Echo", "Echo", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(NewClientConfig())
+	if err = c.NewGRPCConnection(*d); err != nil {
+		t.Fatal(err)
+	}
+	conn := c.Transport.connection
+	if _, err = c.DoGRPC(*req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write([]byte("PING")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("the connection must be closed once the response is read, got %v", err)
+	}
+
+	// the next requests open their own connection
+	if err = c.NewOrReusedConnection(*d); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = c.NewGRPCConnection(*d); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package ftwhttp
 
 import (
 	"bytes"
+	"fmt"
 	"io"
-	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
 )
 
 const (
@@ -14,9 +17,16 @@ const (
 
 // Based on https://golang.org/src/net/http/header.go
 
-// Header is a simplified version of headers, where there is only one header per key.
-// The original golang stdlib uses a proper string slice to map this.
-type Header map[string]string
+// HeaderField is a single header line, with the name as it is sent
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Header is the list of headers of a request, sent in order.
+// Unlike the golang stdlib, names keep their case and can be repeated, because header order
+// and duplicated headers are part of many WAF evasions. Lookups ignore the case of the name.
+type Header []HeaderField
 
 // stringWriter implements WriteString on a Writer.
 type stringWriter struct {
@@ -28,50 +38,69 @@ func (w stringWriter) WriteString(s string) (n int, err error) {
 	return w.w.Write([]byte(s))
 }
 
-// Add adds the key, value pair to the header.
-// It appends to any existing values associated with key.
-func (h Header) Add(key, value string) {
-	if h.Get(key) == "" {
-		h.Set(key, value)
+// Add adds the key, value pair to the header, unless there
+// is already a header with that name.
+func (h *Header) Add(key, value string) {
+	if h.index(key) < 0 {
+		h.Append(key, value)
 	}
 }
 
+// Append adds the key, value pair at the end of the header,
+// even when there are other headers with that name.
+func (h *Header) Append(key, value string) {
+	*h = append(*h, HeaderField{Name: key, Value: value})
+}
+
 // Set sets the header entries associated with key to
 // the single element value. It replaces any existing
-// values associated with key.
-func (h Header) Set(key, value string) {
-	h[key] = value
+// values associated with key, keeping the position of the first one.
+func (h *Header) Set(key, value string) {
+	i := h.index(key)
+	if i < 0 {
+		h.Append(key, value)
+		return
+	}
+	(*h)[i] = HeaderField{Name: key, Value: value}
+	rest := (*h)[i+1:].without(key)
+	*h = append((*h)[:i+1], rest...)
 }
 
 // Get gets the first value associated with the given key.
 // It is case insensitive;
 // If there are no values associated with the key, Get returns "".
 func (h Header) Get(key string) string {
-	if h == nil {
-		return ""
+	if i := h.index(key); i >= 0 {
+		return h[i].Value
 	}
-	v := h[key]
-
-	return v
+	return ""
 }
 
 // Value returns the value associated with the given key.
 // It is case insensitive;
 func (h Header) Value(key string) string {
-	if h == nil {
-		return ""
-	}
+	return h.Get(key)
+}
 
-	return h[key]
+// Values returns all the values associated with the given key, in order.
+// It is case insensitive;
+func (h Header) Values(key string) []string {
+	var values []string
+	for _, field := range h {
+		if strings.EqualFold(field.Name, key) {
+			values = append(values, field.Value)
+		}
+	}
+	return values
 }
 
-// Del deletes the value associated with key.
-func (h Header) Del(key string) {
-	delete(h, key)
+// Del deletes the values associated with key.
+func (h *Header) Del(key string) {
+	*h = h.without(key)
 }
 
 // AddStandard adds standard headers
-func (h Header) AddStandard(dataSize int) {
+func (h *Header) AddStandard(dataSize int) {
 	// For better performance, we always close the connection (unless otherwise)
 	h.Add("Connection", "close")
 	// If there is data, we add the length also
@@ -87,11 +116,9 @@ func (h Header) Write(w io.Writer) error {
 		ws = stringWriter{w}
 	}
 
-	sorted := h.getSortedHeadersByName()
-
-	for _, key := range sorted {
+	for _, field := range h {
 		// we want all headers "as-is"
-		s := key + ": " + h[key] + "\r\n"
+		s := field.Name + ": " + field.Value + "\r\n"
 		if _, err := ws.WriteString(s); err != nil {
 			return err
 		}
@@ -101,20 +128,32 @@ func (h Header) Write(w io.Writer) error {
 
 }
 
-// WriteBytes writes a header in a ByteWriter.
+// WriteBytes writes a header in a ByteWriter, "as-is", without the wire encoding options
 func (h Header) WriteBytes(b *bytes.Buffer) error {
-	sorted := h.getSortedHeadersByName()
+	return h.WriteBytesWithOptions(b, false, false)
+}
 
-	for _, key := range sorted {
-		// we want all headers "as-is"
-		s := key + ": " + h[key] + "\r\n"
+// WriteBytesWithOptions writes a header in a ByteWriter, applying the wire encoding options.
+//
+// With obsFold, line breaks in values are sent as obsolete line folding (continuation lines).
+// With latin1, names and values are sent as ISO-8859-1, so every rune up to U+00FF
+// (e.g. "\xff" in YAML) becomes the corresponding single, possibly high-bit, byte.
+func (h Header) WriteBytesWithOptions(b *bytes.Buffer, obsFold bool, latin1 bool) error {
+	for _, field := range h {
+		value := field.Value
+		if obsFold {
+			value = foldHeaderValue(value)
+		}
+		s := field.Name + ": " + value + "\r\n"
+		if latin1 {
+			s = string(toLatin1(s))
+		}
 		if _, err := b.Write([]byte(s)); err != nil {
 			return err
 		}
 	}
 
 	return nil
-
 }
 
 // Clone returns a copy of h or nil if h is nil.
@@ -122,23 +161,132 @@ func (h Header) Clone() Header {
 	if h == nil {
 		return nil
 	}
-	clone := make(Header)
+	clone := make(Header, len(h))
+	copy(clone, h)
+
+	return clone
+}
 
-	for n, v := range h {
-		clone[n] = v
+// UnmarshalYAML reads headers written as a mapping, or as a list of single entry mappings when
+// names are repeated:
+//
+//	headers:
+//	  - Cookie: "a=1"
+//	  - Cookie: "b=2"
+func (h *Header) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var mapping yaml.MapSlice
+	if err := unmarshal(&mapping); err == nil {
+		*h = Header{}
+		for _, item := range mapping {
+			if err := h.appendYAML(item); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	return clone
+	var list []yaml.MapSlice
+	if err := unmarshal(&list); err != nil {
+		return fmt.Errorf("headers must be a mapping, or a list of single entry mappings: %w", err)
+	}
+	*h = Header{}
+	for _, mapping := range list {
+		if len(mapping) != 1 {
+			return fmt.Errorf("every item of the header list must have one header, found %d", len(mapping))
+		}
+		if err := h.appendYAML(mapping[0]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// sortHeadersByName gets headers sorted by name
-// This way the output is predictable, for tests
-func (h Header) getSortedHeadersByName() []string {
-	keys := make([]string, 0, len(h))
-	for k := range h {
-		keys = append(keys, k)
+// MarshalYAML writes headers as a mapping, unless names are repeated
+func (h Header) MarshalYAML() (interface{}, error) {
+	seen := make(map[string]bool, len(h))
+	repeated := false
+	mapping := make(yaml.MapSlice, 0, len(h))
+	for _, field := range h {
+		repeated = repeated || seen[strings.ToLower(field.Name)]
+		seen[strings.ToLower(field.Name)] = true
+		mapping = append(mapping, yaml.MapItem{Key: field.Name, Value: field.Value})
+	}
+	if !repeated {
+		return mapping, nil
+	}
+
+	list := make([]yaml.MapSlice, 0, len(h))
+	for _, item := range mapping {
+		list = append(list, yaml.MapSlice{item})
 	}
-	sort.Strings(keys)
+	return list, nil
+}
 
-	return keys
+// index returns the position of the first header with the name, or -1
+func (h Header) index(key string) int {
+	for i, field := range h {
+		if strings.EqualFold(field.Name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// without returns the headers not having the name
+func (h Header) without(key string) Header {
+	if h == nil {
+		return nil
+	}
+	kept := make(Header, 0, len(h))
+	for _, field := range h {
+		if !strings.EqualFold(field.Name, key) {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// appendYAML appends a header read from YAML, converting scalars like numbers to text
+func (h *Header) appendYAML(item yaml.MapItem) error {
+	var text [2]string
+	for i, value := range []interface{}{item.Key, item.Value} {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			text[i] = v
+		case map[string]interface{}, []interface{}, yaml.MapSlice:
+			return fmt.Errorf("header %v: expected a string", item.Key)
+		default:
+			text[i] = fmt.Sprint(v)
+		}
+	}
+	h.Append(text[0], text[1])
+	return nil
+}
+
+// foldHeaderValue converts line breaks in a header value to obs-fold, that is CRLF
+// followed by at least one space or tab
+func foldHeaderValue(value string) string {
+	lines := strings.Split(value, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+		if i > 0 && !strings.HasPrefix(lines[i], " ") && !strings.HasPrefix(lines[i], "\t") {
+			lines[i] = " " + lines[i]
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// toLatin1 encodes every rune up to U+00FF as a single byte. Runes that
+// can't be represented are kept as UTF-8.
+func toLatin1(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r <= 0xff {
+			b = append(b, byte(r))
+		} else {
+			b = append(b, string(r)...)
+		}
+	}
+	return b
 }
@@ -11,7 +11,10 @@ package ftwhttp
 import (
 	"bytes"
 	"io"
+	"reflect"
 	"testing"
+
+	"github.com/goccy/go-yaml"
 )
 
 var headerWriteTests = []struct {
@@ -21,28 +24,28 @@ var headerWriteTests = []struct {
 	{Header{}, ""},
 	{
 		Header{
-			"Content-Type":   "text/html; charset=UTF-8",
-			"Content-Length": "0",
+			{"Content-Length", "0"},
+			{"Content-Type", "text/html; charset=UTF-8"},
 		},
 		"Content-Length: 0\r\nContent-Type: text/html; charset=UTF-8\r\n",
 	},
 	{
 		Header{
-			"Content-Length": "1",
+			{"Content-Length", "1"},
 		},
 		"Content-Length: 1\r\n",
 	},
 	{
 		Header{
-			"Expires":          "-1",
-			"Content-Length":   "0",
-			"Content-Encoding": "gzip",
+			{"Content-Encoding", "gzip"},
+			{"Content-Length", "0"},
+			{"Expires", "-1"},
 		},
 		"Content-Encoding: gzip\r\nContent-Length: 0\r\nExpires: -1\r\n",
 	},
 	{
 		Header{
-			"Blank": "",
+			{"Blank", ""},
 		},
 		"Blank: \r\n",
 	},
@@ -59,6 +62,32 @@ func TestHeaderWriteBytes(t *testing.T) {
 	}
 }
 
+var headerWriteWithOptionsTests = []struct {
+	h        Header
+	obsFold  bool
+	latin1   bool
+	expected string
+}{
+	{Header{{"Folded", "first\nsecond"}}, false, false, "Folded: first\nsecond\r\n"},
+	{Header{{"Folded", "first\nsecond"}}, true, false, "Folded: first\r\n second\r\n"},
+	{Header{{"Folded", "first\r\n\tsecond\n  third"}}, true, false, "Folded: first\r\n\tsecond\r\n  third\r\n"},
+	{Header{{"High-Bit", "\u00ff\u00e9"}}, false, false, "High-Bit: \xc3\xbf\xc3\xa9\r\n"},
+	{Header{{"High-Bit", "\u00ff\u00e9"}}, false, true, "High-Bit: \xff\xe9\r\n"},
+	{Header{{"High-Bit", "\u20ac"}}, false, true, "High-Bit: \xe2\x82\xac\r\n"},
+	{Header{{"X-\u00ff", "a\nb"}}, true, true, "X-\xff: a\r\n b\r\n"},
+}
+
+func TestHeaderWriteBytesWithOptions(t *testing.T) {
+	var buf bytes.Buffer
+	for i, test := range headerWriteWithOptionsTests {
+		_ = test.h.WriteBytesWithOptions(&buf, test.obsFold, test.latin1)
+		if buf.String() != test.expected {
+			t.Errorf("#%d:\n got: %q\nwant: %q", i, buf.String(), test.expected)
+		}
+		buf.Reset()
+	}
+}
+
 func TestHeaderWrite(t *testing.T) {
 	for _, test := range headerWriteTests {
 		_ = test.h.Write(io.Discard)
@@ -67,7 +96,7 @@ func TestHeaderWrite(t *testing.T) {
 
 func TestHeaderSetGet(t *testing.T) {
 	h := Header{
-		"Custom": "Value",
+		{"Custom", "Value"},
 	}
 	h.Add("Other", "Value")
 	value := h.Get("Other")
@@ -79,7 +108,7 @@ func TestHeaderSetGet(t *testing.T) {
 
 func TestHeaderClone(t *testing.T) {
 	h := Header{
-		"Custom": "Value",
+		{"Custom", "Value"},
 	}
 
 	clone := h.Clone()
@@ -93,10 +122,10 @@ func TestHeaderClone(t *testing.T) {
 }
 
 var testHeader = Header{
-	"Content-Length": "123",
-	"Content-Type":   "text/plain",
-	"Date":           "some date at some time Z",
-	"Server":         "DefaultUserAgent",
+	{"Content-Length", "123"},
+	{"Content-Type", "text/plain"},
+	{"Date", "some date at some time Z"},
+	{"Server", "DefaultUserAgent"},
 }
 
 var buf bytes.Buffer
@@ -108,3 +137,71 @@ func BenchmarkHeaderWrite(b *testing.B) {
 		_ = testHeader.Write(&buf)
 	}
 }
+
+func TestHeaderOrderAndDuplicates(t *testing.T) {
+	h := Header{{"Host", "localhost"}, {"cookie", "a=1"}}
+	h.Append("Cookie", "b=2")
+	h.Add("COOKIE", "ignored")
+	h.Append("X-First", "1")
+
+	var buf bytes.Buffer
+	_ = h.WriteBytes(&buf)
+	expected := "Host: localhost\r\ncookie: a=1\r\nCookie: b=2\r\nX-First: 1\r\n"
+	if buf.String() != expected {
+		t.Errorf("got: %q, want: %q", buf.String(), expected)
+	}
+	if h.Get("Cookie") != "a=1" {
+		t.Errorf("got: %s, want the first value", h.Get("Cookie"))
+	}
+	if values := h.Values("COOKIE"); len(values) != 2 || values[1] != "b=2" {
+		t.Errorf("unexpected values %v", values)
+	}
+
+	h.Set("Cookie", "c=3")
+	buf.Reset()
+	_ = h.WriteBytes(&buf)
+	expected = "Host: localhost\r\nCookie: c=3\r\nX-First: 1\r\n"
+	if buf.String() != expected {
+		t.Errorf("got: %q, want: %q", buf.String(), expected)
+	}
+
+	h.Del("x-first")
+	if len(h) != 2 || h.Get("X-First") != "" {
+		t.Errorf("header not deleted: %v", h)
+	}
+}
+
+func TestHeaderYAML(t *testing.T) {
+	var input struct {
+		Headers Header `yaml:"headers"`
+	}
+	if err := yaml.Unmarshal([]byte("headers:\n  User-Agent: ftw\n  Accept: \"*/*\"\n  Content-Length: 0\n"), &input); err != nil {
+		t.Fatal(err)
+	}
+	expected := Header{{"User-Agent", "ftw"}, {"Accept", "*/*"}, {"Content-Length", "0"}}
+	if !reflect.DeepEqual(input.Headers, expected) {
+		t.Errorf("got: %v, want: %v", input.Headers, expected)
+	}
+
+	if err := yaml.Unmarshal([]byte("headers:\n  - cookie: a=1\n  - Cookie: b=2\n"), &input); err != nil {
+		t.Fatal(err)
+	}
+	expected = Header{{"cookie", "a=1"}, {"Cookie", "b=2"}}
+	if !reflect.DeepEqual(input.Headers, expected) {
+		t.Errorf("got: %v, want: %v", input.Headers, expected)
+	}
+
+	out, err := yaml.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "headers:\n- cookie: a=1\n- Cookie: b=2\n" {
+		t.Errorf("repeated headers must be written as a list, got %q", out)
+	}
+
+	for _, invalid := range []string{"headers:\n  - A: 1\n    B: 2\n", "headers:\n  A: [1]\n", "headers: 1\n"} {
+		if err := yaml.Unmarshal([]byte(invalid), &input); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ftwhttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// IsRedirect returns true when the response is a redirect that can be followed
+func (r *Response) IsRedirect() bool {
+	switch r.Parsed.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return r.Parsed.Header.Get("Location") != ""
+	}
+	return false
+}
+
+// NewRedirectRequest creates the request that follows the redirect in the response.
+//
+// d and uri are the destination and URI of the request that was redirected, and h its headers.
+// The new request is always a GET without body, keeping the original headers except the
+// ones describing the body. The Host header is replaced when redirecting to another host.
+func NewRedirectRequest(d Destination, uri string, h Header, response *Response) (*Destination, *Request, error) {
+	if !response.IsRedirect() {
+		return nil, nil, fmt.Errorf("ftw/http: response with status %d is not a redirect", response.Parsed.StatusCode)
+	}
+
+	base := &url.URL{
+		Scheme: strings.ToLower(d.Protocol),
+		Host:   net.JoinHostPort(d.DestAddr, strconv.Itoa(d.Port)),
+	}
+	current, err := base.Parse(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	location, err := current.Parse(response.Parsed.Header.Get("Location"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ftw/http: bad redirect location: %w", err)
+	}
+
+	next := &Destination{
+		DestAddr: location.Hostname(),
+		Port:     d.Port,
+		Protocol: location.Scheme,
+	}
+	if port := location.Port(); port != "" {
+		if next.Port, err = strconv.Atoi(port); err != nil {
+			return nil, nil, fmt.Errorf("ftw/http: bad redirect port: %w", err)
+		}
+	} else if next.Protocol != strings.ToLower(d.Protocol) || next.DestAddr != d.DestAddr {
+		next.Port = defaultPort(next.Protocol)
+	}
+	// the certificates accepted by the run are accepted for every host it's redirected to, but the
+	// server name is the one of the host
+	if d.TLS != nil {
+		config := *d.TLS
+		if next.DestAddr != d.DestAddr {
+			config.ServerName = ""
+		}
+		if config.InsecureSkipVerify || config.ServerName != "" {
+			next.TLS = &config
+		}
+	}
+
+	headers := h.Clone()
+	if headers == nil {
+		headers = Header{}
+	}
+	headers.Del(ContentTypeHeader)
+	headers.Del("Content-Length")
+	if next.DestAddr != d.DestAddr || next.Port != d.Port {
+		headers.Set("Host", location.Host)
+	}
+
+	rline := &RequestLine{
+		Method:  "GET",
+		URI:     location.RequestURI(),
+		Version: "HTTP/1.1",
+	}
+
+	return next, NewRequest(rline, headers, nil, true), nil
+}
+
+func defaultPort(protocol string) int {
+	if protocol == "https" {
+		return 443
+	}
+	return 80
+}
@@ -0,0 +1,143 @@
+package ftwhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func generateRedirectResponseForTesting(status int, location string) *Response {
+	return &Response{
+		Parsed: http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Location": []string{location}},
+		},
+	}
+}
+
+var redirectTests = []struct {
+	location string
+	dest     Destination
+	uri      string
+	host     string
+}{
+	{"/blocked", Destination{DestAddr: "localhost", Port: 8080, Protocol: "http"}, "/blocked", "localhost"},
+	{"blocked?a=1", Destination{DestAddr: "localhost", Port: 8080, Protocol: "http"}, "/path/blocked?a=1", "localhost"},
+	{"https://waf.example.com/block.html", Destination{DestAddr: "waf.example.com", Port: 443, Protocol: "https"}, "/block.html", "waf.example.com"},
+	{"http://waf.example.com:8000/", Destination{DestAddr: "waf.example.com", Port: 8000, Protocol: "http"}, "/", "waf.example.com:8000"},
+}
+
+func TestNewRedirectRequest(t *testing.T) {
+	d := Destination{DestAddr: "localhost", Port: 8080, Protocol: "http"}
+	h := Header{{"Content-Type", "text/plain"}, {"Host", "localhost"}, {"User-Agent", "go-ftw"}}
+
+	for i, test := range redirectTests {
+		response := generateRedirectResponseForTesting(http.StatusFound, test.location)
+		next, req, err := NewRedirectRequest(d, "/path/original", h, response)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err.Error())
+		}
+		if *next != test.dest {
+			t.Errorf("#%d: got destination %+v, want %+v", i, *next, test.dest)
+		}
+		if req.RequestLine().Method != "GET" || req.RequestLine().URI != test.uri {
+			t.Errorf("#%d: unexpected request line %q", i, req.RequestLine().ToString())
+		}
+		if req.Headers().Get("Host") != test.host {
+			t.Errorf("#%d: got host %s, want %s", i, req.Headers().Get("Host"), test.host)
+		}
+		if req.Headers().Get("Content-Type") != "" {
+			t.Errorf("#%d: body headers must not be sent again", i)
+		}
+		if req.Headers().Get("User-Agent") != "go-ftw" {
+			t.Errorf("#%d: original headers must be kept", i)
+		}
+	}
+}
+
+func TestNewRedirectRequestNotARedirect(t *testing.T) {
+	d := Destination{DestAddr: "localhost", Port: 80, Protocol: "http"}
+
+	response := generateRedirectResponseForTesting(http.StatusOK, "/somewhere")
+	if response.IsRedirect() {
+		t.Error("200 must not be a redirect")
+	}
+	if _, _, err := NewRedirectRequest(d, "/", nil, response); err == nil {
+		t.Error("expected error when response is not a redirect")
+	}
+
+	if generateRedirectResponseForTesting(http.StatusFound, "").IsRedirect() {
+		t.Error("redirect without location can't be followed")
+	}
+}
+
+func TestNewRedirectRequestTLS(t *testing.T) {
+	d := Destination{DestAddr: "127.0.0.1", Port: 80, Protocol: "http", TLS: &TLSConfig{InsecureSkipVerify: true, ServerName: "waf.example.com"}}
+
+	response := generateRedirectResponseForTesting(http.StatusFound, "https://127.0.0.1/")
+	next, _, err := NewRedirectRequest(d, "/", nil, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.TLS == nil || *next.TLS != *d.TLS {
+		t.Errorf("the TLS settings of the host must be kept, got %+v", next.TLS)
+	}
+
+	response = generateRedirectResponseForTesting(http.StatusFound, "https://waf.example.com/")
+	if next, _, err = NewRedirectRequest(d, "/", nil, response); err != nil {
+		t.Fatal(err)
+	}
+	if next.TLS == nil || *next.TLS != (TLSConfig{InsecureSkipVerify: true}) {
+		t.Errorf("only the certificates accepted must be kept for another host, got %+v", next.TLS)
+	}
+
+	d.TLS = &TLSConfig{ServerName: "waf.example.com"}
+	if next, _, err = NewRedirectRequest(d, "/", nil, response); err != nil {
+		t.Fatal(err)
+	}
+	if next.TLS != nil {
+		t.Errorf("the server name must not be kept for another host, got %+v", next.TLS)
+	}
+}
+
+func TestFollowRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/blocked", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(NewClientConfig())
+	if err = client.NewConnection(*d); err != nil {
+		t.Fatal(err)
+	}
+	req := generateRequestForTesting(false)
+	response, err := client.Do(*req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.IsRedirect() {
+		t.Fatalf("expected redirect, got %d", response.Parsed.StatusCode)
+	}
+
+	next, req, err := NewRedirectRequest(*d, "/", req.Headers(), response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.NewOrReusedConnection(*next); err != nil {
+		t.Fatal(err)
+	}
+	if response, err = client.Do(*req); err != nil {
+		t.Fatal(err)
+	}
+	if response.Parsed.StatusCode != http.StatusForbidden {
+		t.Errorf("expected final response to be 403, got %d", response.Parsed.StatusCode)
+	}
+}
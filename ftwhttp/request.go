@@ -49,6 +49,17 @@ func (r Request) WithAutoCompleteHeaders() bool {
 	return r.autoCompleteHeaders
 }
 
+// SetObsFoldHeaders sets whether line breaks in header values are sent as obsolete line folding
+func (r *Request) SetObsFoldHeaders(value bool) {
+	r.obsFoldHeaders = value
+}
+
+// SetLatin1Headers sets whether headers are sent as ISO-8859-1 instead of UTF-8,
+// which allows sending arbitrary high-bit bytes
+func (r *Request) SetLatin1Headers(value bool) {
+	r.latin1Headers = value
+}
+
 // SetData sets the data
 // You can use only one of raw, encoded or data.
 func (r *Request) SetData(data []byte) error {
@@ -72,6 +83,11 @@ func (r *Request) SetRawData(raw []byte) error {
 	return nil
 }
 
+// RequestLine returns the request line
+func (r Request) RequestLine() *RequestLine {
+	return r.requestLine
+}
+
 // Data returns the data
 func (r Request) Data() []byte {
 	return r.data
@@ -107,6 +123,12 @@ func (r *Request) AddStandardHeaders(size int) {
 	r.headers.AddStandard(size)
 }
 
+// Bytes returns the request as it is sent to the destination, with the standard headers added
+// unless autocompletion is disabled
+func (r *Request) Bytes() ([]byte, error) {
+	return buildRequest(r)
+}
+
 // isRaw is a helper that returns true if raw or encoded data
 func (r Request) isRaw() bool {
 	return utils.IsNotEmpty(r.raw)
@@ -156,7 +178,7 @@ func buildRequest(r *Request) ([]byte, error) {
 			r.AddStandardHeaders(len(r.data))
 		}
 
-		err = r.Headers().WriteBytes(&b)
+		err = r.Headers().WriteBytesWithOptions(&b, r.obsFoldHeaders, r.latin1Headers)
 		if err != nil {
 			log.Debug().Msgf("ftw/http: error writing to buffer: %s", err.Error())
 			return nil, err
@@ -15,7 +15,7 @@ func generateBaseRequestForTesting() *Request {
 		Version: "1.4",
 	}
 
-	h := Header{"This": "Header", "Connection": "Not-Closed"}
+	h := Header{{"Connection", "Not-Closed"}, {"This", "Header"}}
 
 	req = NewRequest(rl, h, []byte("Data"), true)
 
@@ -32,8 +32,10 @@ func TestMultipartFormDataRequest(t *testing.T) {
 	}
 
 	h := Header{
-		"Accept": "*/*", "User-Agent": "go-ftw test agent", "Host": "localhost",
-		"Content-Type": "multipart/form-data; boundary=--------397236876",
+		{"Accept", "*/*"},
+		{"Content-Type", "multipart/form-data; boundary=--------397236876"},
+		{"Host", "localhost"},
+		{"User-Agent", "go-ftw test agent"},
 	}
 
 	data := []byte(`----------397236876
@@ -132,7 +134,7 @@ func TestWithAutocompleteRequest(t *testing.T) {
 		Version: "HTTP/1.1",
 	}
 
-	h := Header{"Accept": "*/*", "User-Agent": "go-ftw test agent", "Host": "localhost"}
+	h := Header{{"Accept", "*/*"}, {"Host", "localhost"}, {"User-Agent", "go-ftw test agent"}}
 
 	data := []byte(`test=me&one=two`)
 	req = NewRequest(rl, h, data, true)
@@ -151,7 +153,7 @@ func TestWithoutAutocompleteRequest(t *testing.T) {
 		Version: "1.1",
 	}
 
-	h := Header{"Accept": "*/*", "User-Agent": "go-ftw test agent", "Host": "localhost"}
+	h := Header{{"Accept", "*/*"}, {"Host", "localhost"}, {"User-Agent", "go-ftw test agent"}}
 
 	data := []byte(`test=me&one=two`)
 	req = NewRequest(rl, h, data, false)
@@ -164,7 +166,7 @@ func TestWithoutAutocompleteRequest(t *testing.T) {
 func TestRequestHeadersSet(t *testing.T) {
 	req := generateBaseRequestForTesting()
 
-	newH := Header{"X-New-Header": "Value"}
+	newH := Header{{"X-New-Header", "Value"}}
 	req.SetHeaders(newH)
 
 	if req.headers.Get("X-New-Header") == "Value" {
@@ -266,3 +268,27 @@ func TestRequestURLParseFail(t *testing.T) {
 		t.Errorf("Failed !")
 	}
 }
+
+func TestRequestObsFoldAndLatin1Headers(t *testing.T) {
+	rl := &RequestLine{
+		Method:  "GET",
+		URI:     "/",
+		Version: "HTTP/1.1",
+	}
+
+	h := Header{{"Host", "localhost"}, {"X-Folded", "one\ntwo"}, {"X-High-Bit", "ÿ"}}
+	req := NewRequest(rl, h, nil, false)
+	req.SetObsFoldHeaders(true)
+	req.SetLatin1Headers(true)
+
+	data, err := buildRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("X-Folded: one\r\n two\r\n")) {
+		t.Errorf("header not folded: %q", data)
+	}
+	if !bytes.Contains(data, []byte("X-High-Bit: \xff\r\n")) {
+		t.Errorf("header not sent as latin1: %q", data)
+	}
+}
@@ -1,12 +1,18 @@
 package ftwhttp
 
 import (
+	"bytes"
 	"io"
 )
 
-// GetBodyAsString gives the response body as string, or nil if there was some error
+// GetBodyAsString gives the response body as string, or nil if there was some error.
+// The body is kept, so it can be read again, e.g. by several assertions.
 func (r *Response) GetBodyAsString() string {
+	if r.Parsed.Body == nil {
+		return ""
+	}
 	body, err := io.ReadAll(r.Parsed.Body)
+	r.Parsed.Body = io.NopCloser(bytes.NewReader(body))
 	if err != nil {
 		return ""
 	}
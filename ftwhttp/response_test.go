@@ -1,9 +1,12 @@
 package ftwhttp
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -24,9 +27,9 @@ func generateRequestForTesting(keepalive bool) *Request {
 		connection = "close"
 	}
 	h := Header{
-		"Host":       "localhost",
-		"User-Agent": "Go Tests",
-		"Connection": connection,
+		{"Connection", connection},
+		{"Host", "localhost"},
+		{"User-Agent", "Go Tests"},
 	}
 
 	req = NewRequest(rl, h, nil, true)
@@ -44,10 +47,10 @@ func generateRequestWithCookiesForTesting() *Request {
 	}
 
 	h := Header{
-		"Host":       "localhost",
-		"User-Agent": "Go Tests",
-		"Cookie":     "THISISACOOKIE",
-		"Connection": "Keep-Alive",
+		{"Connection", "Keep-Alive"},
+		{"Cookie", "THISISACOOKIE"},
+		{"Host", "localhost"},
+		{"User-Agent", "Go Tests"},
 	}
 
 	req = NewRequest(rl, h, nil, true)
@@ -104,7 +107,10 @@ func TestResponse(t *testing.T) {
 	if response.GetBodyAsString() != "Hello, client\n" {
 		t.Errorf("Error!")
 	}
-
+	// the body can be read several times
+	if response.GetBodyAsString() != "Hello, client\n" {
+		t.Errorf("the body was consumed")
+	}
 }
 
 func TestResponseWithCookies(t *testing.T) {
@@ -143,3 +149,132 @@ func TestResponseWithCookies(t *testing.T) {
 		t.Logf("Failed !")
 	}
 }
+
+func TestResponseBodyMaxSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("A"), 4096))
+	}))
+	defer server.Close()
+
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewClientConfig()
+	config.MaxBodySize = 100
+	client := NewClient(config)
+	if err = client.NewConnection(*d); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.Do(*generateRequestForTesting(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Truncated {
+		t.Error("response body should be truncated")
+	}
+	if body := response.GetBodyAsString(); len(body) != 100 {
+		t.Errorf("expected 100 bytes of body, got %d", len(body))
+	}
+}
+
+func TestResponseRawMaxSize(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("endless") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(20<<20))
+			_, _ = w.Write(bytes.Repeat([]byte("A"), 20<<20))
+			return
+		}
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_, _ = w.Write(bytes.Repeat([]byte("A"), 4096))
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewClientConfig()
+	config.ReadTimeout = 5 * time.Second
+	config.MaxBodySize = 1024
+	client := NewClient(config)
+	for _, uri := range []string{"/", "/?endless=1"} {
+		if err = client.NewOrReusedConnection(*d); err != nil {
+			t.Fatal(err)
+		}
+		req := NewRequest(&RequestLine{Method: "GET", URI: uri, Version: "HTTP/1.1"}, Header{{"Host", "localhost"}}, nil, true)
+		start := time.Now()
+		response, err := client.Do(*req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: the rest of the body must not be read, took %s", uri, elapsed)
+		}
+		if !response.Truncated || len(response.GetBodyAsString()) != 1024 {
+			t.Errorf("%s: expected 1024 bytes of body, got %d", uri, len(response.GetBodyAsString()))
+		}
+		// the raw response has the headers and the body read
+		if len(response.RAW) > 1024+512 || !bytes.Contains(response.RAW, bytes.Repeat([]byte("A"), 512)) {
+			t.Errorf("%s: expected the raw response to be cut with the body, got %d bytes", uri, len(response.RAW))
+		}
+	}
+}
+
+func TestResponseBodyTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// never-ending body
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_, _ = w.Write([]byte("endless "))
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	d, err := DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewClientConfig()
+	config.ReadTimeout = 5 * time.Second
+	config.BodyTimeout = 200 * time.Millisecond
+	client := NewClient(config)
+	if err = client.NewConnection(*d); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	response, err := client.Do(*generateRequestForTesting(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("body timeout was not applied")
+	}
+	if !response.Truncated {
+		t.Error("response body should be truncated")
+	}
+	if body := response.GetBodyAsString(); !strings.HasPrefix(body, "endless ") {
+		t.Errorf("expected partial body, got %q", body)
+	}
+}
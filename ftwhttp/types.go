@@ -12,6 +12,13 @@ type ClientConfig struct {
 	ConnectTimeout time.Duration
 	// ReadTimeout is the timeout for reading a response.
 	ReadTimeout time.Duration
+	// MaxBodySize is the maximum number of body bytes read from a response. The rest of the
+	// body is discarded. A value of 0 means no limit.
+	MaxBodySize int64
+	// BodyTimeout is the time allowed for reading the response body, once the headers have
+	// been received. What was read until then is used as body. A value of 0 means that
+	// ReadTimeout applies to the whole response.
+	BodyTimeout time.Duration
 }
 
 // Client is the top level abstraction in http
@@ -26,6 +33,8 @@ type Connection struct {
 	connection  net.Conn
 	protocol    string
 	readTimeout time.Duration
+	maxBodySize int64
+	bodyTimeout time.Duration
 	duration    *RoundTripTime
 }
 
@@ -49,6 +58,16 @@ type Destination struct {
 	DestAddr string `default:"localhost"`
 	Port     int    `default:"80"`
 	Protocol string `default:"http"`
+	// TLS are the settings used when connecting with https. The defaults are used when nil.
+	TLS *TLSConfig
+}
+
+// TLSConfig are the TLS settings of a Destination
+type TLSConfig struct {
+	// InsecureSkipVerify accepts any certificate, like the self-signed ones of test instances
+	InsecureSkipVerify bool
+	// ServerName is sent with SNI and checked against the certificate, instead of DestAddr
+	ServerName string
 }
 
 // RequestLine is the first line in the HTTP request dialog
@@ -67,10 +86,17 @@ type Request struct {
 	data                []byte
 	raw                 []byte
 	autoCompleteHeaders bool
+	obsFoldHeaders      bool
+	latin1Headers       bool
 }
 
 // Response represents the http response received from the server/waf
 type Response struct {
 	RAW    []byte
 	Parsed http.Response
+	// Truncated is true when the body was cut because of the size limit or body timeout
+	Truncated bool
+	// RoundTripTime is the time between sending the request and receiving the response, set by
+	// the runner
+	RoundTripTime time.Duration
 }
@@ -0,0 +1,74 @@
+package ftwhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WaitInterval is the time between two attempts of WaitForHost
+var WaitInterval = 500 * time.Millisecond
+
+// WaitForHost waits until the target is ready, or ctx is done. The target is either an address,
+// like `waf:80`, ready once a TCP connection can be opened, or a http or https URL, like
+// `http://waf/healthz`, ready once a GET request returns a 2xx status. The certificates of the
+// https URLs are not verified, as they are the ones of test instances.
+func WaitForHost(ctx context.Context, target string) error {
+	ready := connects(target)
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		ready = healthy(target)
+	}
+	var err error
+	for {
+		if err = ready(ctx); err == nil {
+			return nil
+		}
+		log.Debug().Msgf("ftw/http: %s is not ready: %s", target, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("ftw/http: %s is not ready: %w", target, err)
+		case <-time.After(WaitInterval):
+		}
+	}
+}
+
+// connects returns whether a TCP connection to the address can be opened
+func connects(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// healthy returns whether a GET request to the URL returns a 2xx status
+func healthy(url string) func(ctx context.Context) error {
+	client := &http.Client{Transport: &http.Transport{
+		// nolint: gosec
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
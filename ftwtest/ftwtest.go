@@ -0,0 +1,138 @@
+// Package ftwtest runs go-ftw tests as Go tests, so the test suites of a WAF are run by `go test`
+// like the other tests of a project:
+//
+//	func TestWAF(t *testing.T) {
+//		cfg, err := config.NewConfigFromFile(".ftw.yaml")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		ftwtest.Run(t, "tests", ftwtest.Config{FTW: cfg})
+//	}
+//
+// Every file of tests is a subtest, named after its path in the directory, and every test of the
+// file a subtest of it, so `go test -run 'TestWAF/942100.yaml/942100-1'` runs a single test of
+// tests/942100.yaml.
+package ftwtest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// Config is the configuration of the tests
+type Config struct {
+	// FTW is the configuration of ftw, like the one read from .ftw.yaml
+	FTW *config.FTWConfiguration
+	// Options are the options of the runs of the tests, like runner.WithDestination. The runs are
+	// always quiet and keep the evidence of the failed stages.
+	Options []runner.RunnerOption
+	// Parallel runs the files of tests in parallel, as many at once as -test.parallel allows. The
+	// logs of the WAF are found between markers, so only run them in parallel when the logs of
+	// every request are found on their own, like in embedded mode.
+	Parallel bool
+}
+
+// Run runs the yaml tests found recursively in dir, every file of tests as a subtest of t, and
+// every test of the file as a subtest of the file. A test fails with its failed stages, or with
+// the error that stopped its run, like a WAF that can't be reached, and is skipped when it's not
+// selected.
+func Run(t *testing.T, dir string, cfg Config) {
+	t.Helper()
+	tests, err := test.GetTestsFromFiles(filepath.Join(dir, "**", "*.yaml"))
+	if err != nil {
+		t.Fatalf("ftwtest: can't read the tests: %s", err)
+	}
+	if len(tests) == 0 {
+		t.Fatalf("ftwtest: no tests found in %s", dir)
+	}
+	for _, ftwTest := range tests {
+		ftwTest := ftwTest
+		name, err := filepath.Rel(dir, ftwTest.FileName)
+		if err != nil {
+			name = ftwTest.FileName
+		}
+		t.Run(name, func(t *testing.T) {
+			if cfg.Parallel {
+				t.Parallel()
+			}
+			for _, testCase := range ftwTest.Tests {
+				testCase := testCase
+				t.Run(testCase.TestTitle, func(t *testing.T) {
+					runTest(t, cfg, ftwTest, testCase)
+				})
+			}
+		})
+	}
+}
+
+// runTest runs a test of the file and reports its stages to t
+func runTest(t *testing.T, cfg Config, ftwTest test.FTWTest, testCase test.Test) {
+	var stages []runner.StageResult
+	options := append([]runner.RunnerOption{}, cfg.Options...)
+	options = append(options,
+		runner.WithQuiet(true),
+		runner.WithEvidence(true),
+		runner.OnStageComplete(func(stage runner.StageResult) {
+			stages = append(stages, stage)
+		}),
+	)
+	single := ftwTest
+	single.Tests = []test.Test{testCase}
+	runContext := runner.Run(cfg.FTW, []test.FTWTest{single}, runner.NewConfig(options...))
+	report(t, stages, runContext.Err)
+}
+
+// reporter is the part of testing.T the results of a test are reported to
+type reporter interface {
+	Errorf(format string, args ...interface{})
+	Logf(format string, args ...interface{})
+	Skip(args ...interface{})
+}
+
+// report reports the stages of a test, and the error that stopped its run, if any
+func report(t reporter, stages []runner.StageResult, err error) {
+	if err != nil {
+		t.Errorf("the test was not run: %s", err)
+	}
+	for i, stage := range stages {
+		switch stage.Result {
+		case runner.Skipped:
+			t.Skip("skipped")
+		case runner.Failed, runner.ForceFail:
+			t.Errorf("stage %d %s\n%s", i+1, stage.Result, failure(stage))
+		case runner.Ignored, runner.ForcePass:
+			t.Logf("stage %d %s", i+1, stage.Result)
+		}
+	}
+}
+
+// failure describes a failed stage, with its evidence
+func failure(stage runner.StageResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "status: %d\n", stage.StatusCode)
+	fmt.Fprintf(&b, "triggered rules: %v\n", stage.TriggeredRules)
+	if len(stage.FalsePositives) > 0 {
+		fmt.Fprintf(&b, "false positives: %v\n", stage.FalsePositives)
+	}
+	if evidence := stage.Evidence; evidence != nil {
+		if evidence.Error != "" {
+			fmt.Fprintf(&b, "error: %s\n", evidence.Error)
+		}
+		if evidence.Request != "" {
+			fmt.Fprintf(&b, "request:\n%s\n", strings.TrimRight(evidence.Request, "\r\n"))
+		}
+		if evidence.Response != "" {
+			fmt.Fprintf(&b, "response:\n%s\n", strings.TrimRight(evidence.Response, "\r\n"))
+		}
+		if len(evidence.Logs) > 0 {
+			fmt.Fprintf(&b, "logs:\n%s\n", strings.Join(evidence.Logs, "\n"))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,114 @@
+package ftwtest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var yamlTests = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "942100.yaml"
+tests:
+  - test_title: "942100-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1%27%20or%201=1"
+          output:
+            log:
+              rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1"
+          output:
+            log:
+              no_rule_ids: [942100]
+`
+
+func TestRun(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sqli"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"942100.yaml", "942101.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, "sqli", name), []byte(yamlTests), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the excluded test is skipped
+	Run(t, dir, Config{FTW: cfg, Options: []runner.RunnerOption{runner.WithExclude(regexp.MustCompile("942100-2"))}, Parallel: true})
+}
+
+// recorder records the results reported to it
+type recorder struct {
+	errors  []string
+	skipped bool
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Logf(format string, args ...interface{}) {}
+
+func (r *recorder) Skip(args ...interface{}) {
+	r.skipped = true
+}
+
+func TestReport(t *testing.T) {
+	var r recorder
+	report(&r, []runner.StageResult{{Result: runner.Success}, {Result: runner.Failed}}, nil)
+	if len(r.errors) != 1 || !strings.HasPrefix(r.errors[0], "stage 2 failed") || r.skipped {
+		t.Errorf("unexpected results %+v", r)
+	}
+
+	// the run stopped before the stage
+	r = recorder{}
+	report(&r, nil, errors.New("ftw/run: can't connect to destination localhost:1 of 942100-1"))
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "the test was not run: ftw/run: can't connect to destination") {
+		t.Errorf("unexpected results %+v", r)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	message := failure(runner.StageResult{
+		StatusCode:     403,
+		TriggeredRules: []int{942100},
+		FalsePositives: []int{942100},
+		Evidence:       &runner.StageEvidence{Request: "GET /?id=1 HTTP/1.1\r\n\r\n", Logs: []string{`[id "942100"]`}},
+	})
+	expected := "status: 403\ntriggered rules: [942100]\nfalse positives: [942100]\nrequest:\nGET /?id=1 HTTP/1.1\nlogs:\n[id \"942100\"]"
+	if message != expected {
+		t.Errorf("unexpected failure\n%s", message)
+	}
+	if strings.Contains(failure(runner.StageResult{}), "false positives") {
+		t.Errorf("the false positives must only be shown when there are some")
+	}
+}
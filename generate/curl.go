@@ -0,0 +1,305 @@
+package generate
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// curlIgnoredFlags don't change the request sent, and are skipped
+var curlIgnoredFlags = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true, "-v": true, "--verbose": true,
+	"-i": true, "--include": true, "-k": true, "--insecure": true, "-L": true, "--location": true,
+	"--compressed": true, "-f": true, "--fail": true, "--http1.1": true, "--http2": true, "-#": true,
+}
+
+// curlIgnoredOptions take an argument, but don't change the request sent
+var curlIgnoredOptions = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-w": true, "--write-out": true, "--retry": true, "-x": true, "--proxy": true,
+}
+
+// FromCurl reads the request of a curl command line, as copied from the browser developer tools
+// or a bug report
+func FromCurl(commandLine string) (Request, error) {
+	var request Request
+
+	args, err := splitShellWords(commandLine)
+	if err != nil {
+		return request, fmt.Errorf("ftw/generate: %w", err)
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl")) {
+		args = args[1:]
+	}
+
+	var data []string
+	get, head := false, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		next := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("ftw/generate: missing argument for %s", arg)
+			}
+			i++
+			return args[i], nil
+		}
+
+		// --option=value
+		if strings.HasPrefix(arg, "--") && strings.Contains(arg, "=") {
+			name, value, _ := strings.Cut(arg, "=")
+			args = append(args[:i+1], append([]string{value}, args[i+1:]...)...)
+			arg = name
+		}
+
+		var value string
+		switch arg {
+		case "-X", "--request":
+			if request.Method, err = next(); err != nil {
+				return request, err
+			}
+		case "-H", "--header":
+			if value, err = next(); err != nil {
+				return request, err
+			}
+			name, headerValue, found := strings.Cut(value, ":")
+			if !found {
+				return request, fmt.Errorf("ftw/generate: bad header %q", value)
+			}
+			request.Headers = append(request.Headers, [2]string{strings.TrimSpace(name), strings.TrimSpace(headerValue)})
+		case "-A", "--user-agent":
+			if value, err = next(); err != nil {
+				return request, err
+			}
+			request.Headers = append(request.Headers, [2]string{"User-Agent", value})
+		case "-e", "--referer":
+			if value, err = next(); err != nil {
+				return request, err
+			}
+			request.Headers = append(request.Headers, [2]string{"Referer", value})
+		case "-b", "--cookie":
+			if value, err = next(); err != nil {
+				return request, err
+			}
+			request.Headers = append(request.Headers, [2]string{"Cookie", value})
+		case "-u", "--user":
+			if value, err = next(); err != nil {
+				return request, err
+			}
+			request.Headers = append(request.Headers, [2]string{"Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(value))})
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+			if value, err = next(); err != nil {
+				return request, err
+			}
+			if value, err = curlData(arg, value); err != nil {
+				return request, err
+			}
+			data = append(data, value)
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			head = true
+		case "-0", "--http1.0":
+			request.Version = "HTTP/1.0"
+		case "--url":
+			if request.URL, err = next(); err != nil {
+				return request, err
+			}
+		default:
+			switch {
+			case curlIgnoredFlags[arg]:
+			case curlIgnoredOptions[arg]:
+				if _, err = next(); err != nil {
+					return request, err
+				}
+			case strings.HasPrefix(arg, "-"):
+				return request, fmt.Errorf("ftw/generate: unsupported curl option %s", arg)
+			default:
+				request.URL = arg
+			}
+		}
+	}
+
+	if request.URL == "" {
+		return request, errors.New("ftw/generate: no URL in curl command")
+	}
+	// like curl, default to http when the URL has no scheme
+	if !strings.Contains(request.URL, "://") {
+		request.URL = "http://" + request.URL
+	}
+
+	body := strings.Join(data, "&")
+	switch {
+	case get && body != "":
+		u, err := url.Parse(request.URL)
+		if err != nil {
+			return request, err
+		}
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += body
+		request.URL = u.String()
+	case body != "":
+		request.Body = []byte(body)
+		if !hasHeader(request.Headers, "Content-Type") {
+			request.Headers = append(request.Headers, [2]string{"Content-Type", "application/x-www-form-urlencoded"})
+		}
+	}
+
+	if request.Method == "" {
+		switch {
+		case head:
+			request.Method = "HEAD"
+		case len(request.Body) > 0:
+			request.Method = "POST"
+		default:
+			request.Method = "GET"
+		}
+	}
+	return request, nil
+}
+
+// curlData returns the data for a data option, reading files for `@file` arguments like curl does
+func curlData(option string, value string) (string, error) {
+	if option == "--data-urlencode" {
+		if name, content, found := strings.Cut(value, "="); found {
+			return name + "=" + url.QueryEscape(content), nil
+		}
+		return url.QueryEscape(value), nil
+	}
+	if option == "--data-raw" || !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+
+	contents, err := os.ReadFile(strings.TrimPrefix(value, "@"))
+	if err != nil {
+		return "", fmt.Errorf("ftw/generate: cannot read data file: %w", err)
+	}
+	if option == "--data-binary" {
+		return string(contents), nil
+	}
+	// curl strips line breaks from files passed with -d
+	return strings.NewReplacer("\r", "", "\n", "").Replace(string(contents)), nil
+}
+
+// splitShellWords splits a command line like a POSIX shell does, handling quotes, escapes,
+// and line continuations
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				if line[i] != '\n' {
+					word.WriteByte(line[i])
+					inWord = true
+				}
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(line) && line[i+1] == '\'':
+			// ANSI-C quoting, as used by the browser tools for bodies with special characters
+			value, n, err := ansiCQuoted(line[i+2:])
+			if err != nil {
+				return nil, err
+			}
+			word.WriteString(value)
+			i += n + 2
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\"\\$`\n", line[i+1]) >= 0 {
+					i++
+					if line[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ansiCQuoted reads the contents of a `$'...'` string up to the closing quote, returning the
+// value and the number of bytes read including the closing quote
+func ansiCQuoted(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, errors.New("unterminated ANSI-C quote")
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '0':
+				b.WriteByte(0)
+			case 'x':
+				if i+2 < len(s) {
+					var v byte
+					if _, err := fmt.Sscanf(s[i+1:i+3], "%02x", &v); err == nil {
+						b.WriteByte(v)
+						i += 2
+						continue
+					}
+				}
+				b.WriteString("\\x")
+			case 'u':
+				if i+4 < len(s) {
+					var v rune
+					if _, err := fmt.Sscanf(s[i+1:i+5], "%04x", &v); err == nil {
+						b.WriteRune(v)
+						i += 4
+						continue
+					}
+				}
+				b.WriteString("\\u")
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated ANSI-C quote")
+}
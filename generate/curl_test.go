@@ -0,0 +1,123 @@
+package generate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromCurl(t *testing.T) {
+	request, err := FromCurl(`curl 'https://example.com/login?next=%2F' \
+  -H 'Accept: */*' \
+  -H "X-Payload: \"quoted\"" \
+  -A 'Mozilla/5.0' \
+  --data-raw $'user=admin\'--&pass=x' \
+  --compressed -k`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request.Method != "POST" {
+		t.Errorf("expected POST with data, got %s", request.Method)
+	}
+	if request.URL != "https://example.com/login?next=%2F" {
+		t.Errorf("unexpected URL %s", request.URL)
+	}
+	if string(request.Body) != "user=admin'--&pass=x" {
+		t.Errorf("unexpected body %q", request.Body)
+	}
+	expected := [][2]string{
+		{"Accept", "*/*"},
+		{"X-Payload", `"quoted"`},
+		{"User-Agent", "Mozilla/5.0"},
+		{"Content-Type", "application/x-www-form-urlencoded"},
+	}
+	if len(request.Headers) != len(expected) {
+		t.Fatalf("unexpected headers %v", request.Headers)
+	}
+	for i := range expected {
+		if request.Headers[i] != expected[i] {
+			t.Errorf("expected header %v, got %v", expected[i], request.Headers[i])
+		}
+	}
+}
+
+func TestFromCurlOptions(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "payload.txt")
+	if err := os.WriteFile(dataFile, []byte("a=1\nb=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		command string
+		method  string
+		url     string
+		body    string
+	}{
+		{"curl localhost:8080/", "GET", "http://localhost:8080/", ""},
+		{"curl -X PUT --url=http://localhost/ -d x=1", "PUT", "http://localhost/", "x=1"},
+		{"curl -G -d q=1 -d r=2 http://localhost/?a=b", "GET", "http://localhost/?a=b&q=1&r=2", ""},
+		{"curl -I http://localhost/", "HEAD", "http://localhost/", ""},
+		{"curl --data-urlencode 'q=<script>' http://localhost/", "POST", "http://localhost/", "q=%3Cscript%3E"},
+		{"curl -d @" + dataFile + " http://localhost/", "POST", "http://localhost/", "a=1b=2"},
+		{"curl --data-binary @" + dataFile + " http://localhost/", "POST", "http://localhost/", "a=1\nb=2\n"},
+	}
+
+	for _, tc := range tests {
+		request, err := FromCurl(tc.command)
+		if err != nil {
+			t.Errorf("%s: %s", tc.command, err)
+			continue
+		}
+		if request.Method != tc.method || request.URL != tc.url || string(request.Body) != tc.body {
+			t.Errorf("%s: got %s %s %q", tc.command, request.Method, request.URL, request.Body)
+		}
+	}
+}
+
+func TestFromCurlAuthAndVersion(t *testing.T) {
+	request, err := FromCurl("curl --http1.0 -u admin:secret -b 'session=1' http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Version != "HTTP/1.0" {
+		t.Errorf("unexpected version %s", request.Version)
+	}
+	if !hasHeader(request.Headers, "Authorization") || request.Headers[0][1] != "Basic YWRtaW46c2VjcmV0" {
+		t.Errorf("unexpected headers %v", request.Headers)
+	}
+	if request.Headers[1] != [2]string{"Cookie", "session=1"} {
+		t.Errorf("unexpected cookie header %v", request.Headers[1])
+	}
+}
+
+func TestFromCurlErrors(t *testing.T) {
+	for _, command := range []string{
+		"curl -H 'Accept: */*'",
+		"curl 'http://localhost/",
+		"curl --unknown-option http://localhost/",
+		"curl http://localhost/ -H",
+		"curl -H 'no colon' http://localhost/",
+	} {
+		if _, err := FromCurl(command); err == nil {
+			t.Errorf("%s: expected error", command)
+		}
+	}
+}
+
+func TestSplitShellWords(t *testing.T) {
+	words, err := splitShellWords("a 'b c' \"d \\\"e\\\"\" f\\ g \\\n h $'i\\nj\\x41'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a", "b c", `d "e"`, "f g", "h", "i\njA"}
+	if len(words) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, words)
+	}
+	for i := range expected {
+		if words[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], words[i])
+		}
+	}
+}
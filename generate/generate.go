@@ -0,0 +1,128 @@
+// Package generate creates test skeletons, from captured traffic or for new rules. Captured
+// requests are converted to stage inputs, and the expected output is left for the author of the test.
+package generate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// skippedHeaders are not copied to the tests, because go-ftw computes them when sending the request
+var skippedHeaders = map[string]bool{
+	"content-length":    true,
+	"transfer-encoding": true,
+}
+
+// Request is a captured request, independent of the format it was captured in
+type Request struct {
+	Method  string
+	URL     string
+	Version string
+	Headers [][2]string
+	Body    []byte
+}
+
+// NewTest creates a test file with one test per request. Test titles are the prefix followed by
+// the number of the request.
+func NewTest(name string, description string, titlePrefix string, requests []Request) (test.FTWTest, error) {
+	var ftwTest test.FTWTest
+	ftwTest.Meta.Enabled = true
+	ftwTest.Meta.Name = name
+	ftwTest.Meta.Description = description
+
+	for n, request := range requests {
+		input, err := NewInput(request)
+		if err != nil {
+			return ftwTest, fmt.Errorf("ftw/generate: request %d: %w", n+1, err)
+		}
+		t := test.Test{TestTitle: fmt.Sprintf("%s-%d", titlePrefix, n+1)}
+		t.Stages = append(t.Stages, struct {
+			Stage test.Stage `yaml:"stage"`
+		}{Stage: test.Stage{Input: input}})
+		ftwTest.Tests = append(ftwTest.Tests, t)
+	}
+	return ftwTest, nil
+}
+
+// NewInput converts a request to a stage input
+func NewInput(request Request) (test.Input, error) {
+	var input test.Input
+
+	u, err := url.Parse(request.URL)
+	if err != nil {
+		return input, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return input, fmt.Errorf("unsupported URL %s", request.URL)
+	}
+
+	protocol := u.Scheme
+	destAddr := u.Hostname()
+	port := 80
+	if protocol == "https" {
+		port = 443
+	}
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return input, err
+		}
+	}
+	uri := u.RequestURI()
+	method := strings.ToUpper(request.Method)
+
+	input.DestAddr = &destAddr
+	input.Port = (*test.Port)(&port)
+	input.Protocol = &protocol
+	input.URI = &uri
+	if method != "" && method != "GET" {
+		input.Method = &method
+	}
+	// go-ftw only speaks HTTP/1.x, HTTP/2 captures are sent as HTTP/1.1
+	if version := strings.ToUpper(request.Version); version == "HTTP/1.0" {
+		input.Version = &version
+	}
+
+	input.Headers = ftwhttp.Header{}
+	for _, header := range request.Headers {
+		name, value := header[0], header[1]
+		// HTTP/2 pseudo-headers like `:authority`
+		if strings.HasPrefix(name, ":") || skippedHeaders[strings.ToLower(name)] {
+			continue
+		}
+		input.Headers.Append(name, value)
+	}
+	if !hasHeader(request.Headers, "Host") {
+		input.Headers.Set("Host", u.Host)
+	}
+
+	if len(request.Body) > 0 {
+		// Data is a template, so bodies that would be interpreted are sent encoded
+		if utf8.Valid(request.Body) && !bytes.Contains(request.Body, []byte("{{")) {
+			data := string(request.Body)
+			input.Data = &data
+		} else {
+			input.DataB64 = base64.StdEncoding.EncodeToString(request.Body)
+		}
+	}
+	return input, nil
+}
+
+// Marshal writes the test as YAML, with a comment reminding to add the expected output
+func Marshal(ftwTest test.FTWTest) ([]byte, error) {
+	out, err := yaml.Marshal(ftwTest)
+	if err != nil {
+		return nil, err
+	}
+	header := "---\n# Generated by ftw. Add the expected output of every stage.\n"
+	return append([]byte(header), out...), nil
+}
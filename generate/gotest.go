@@ -0,0 +1,82 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"regexp"
+	"text/template"
+)
+
+var (
+	// buildTag matches the build tags the Go test files can be built with
+	buildTag = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+	// testName matches the names of the functions `go test` runs
+	testName = regexp.MustCompile(`^Test([^a-z]|$)`)
+)
+
+var goTestTemplate = template.Must(template.New("gotest").Parse(`{{ if .Tag }}//go:build {{ .Tag }}
+
+{{ end }}// Code generated by ftw generate gotest. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwtest"
+)
+
+// {{ .TestName }} runs the go-ftw tests found in {{ .Dir }}, every file of tests as a subtest{{ if .Tag }}. Run it
+// with ` + "`go test -tags {{ .Tag }}`" + `{{ end }}.
+func {{ .TestName }}(t *testing.T) {
+	cfg, err := config.NewConfig({{ printf "%q" .Config }}, {{ printf "%q" .Profile }}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwtest.Run(t, {{ printf "%q" .Dir }}, ftwtest.Config{FTW: cfg, Parallel: {{ .Parallel }}})
+}
+`))
+
+// GoTestOptions are the options of a Go test file running go-ftw tests
+type GoTestOptions struct {
+	// Package is the name of the package of the file
+	Package string
+	// TestName is the name of the test function
+	TestName string
+	// Tag is the build tag required to build the file, if not empty
+	Tag string
+	// Dir is the directory of the go-ftw tests, and Config the configuration file of ftw, both
+	// relative to the directory of the file
+	Dir    string
+	Config string
+	// Profile is the profile of the configuration, if not empty
+	Profile string
+	// Parallel runs the files of tests in parallel
+	Parallel bool
+}
+
+// GoTest returns a Go test file running the go-ftw tests of a directory with ftwtest, so they run
+// with `go test`
+func GoTest(options GoTestOptions) ([]byte, error) {
+	if !token.IsIdentifier(options.Package) {
+		return nil, fmt.Errorf("ftw/generate: %q is not a package name", options.Package)
+	}
+	if !token.IsIdentifier(options.TestName) || !testName.MatchString(options.TestName) {
+		return nil, fmt.Errorf("ftw/generate: %q is not the name of a test, like TestWAF", options.TestName)
+	}
+	if options.Tag != "" && !buildTag.MatchString(options.Tag) {
+		return nil, fmt.Errorf("ftw/generate: %q is not a build tag", options.Tag)
+	}
+	if options.Dir == "" {
+		options.Dir = "."
+	}
+
+	var b bytes.Buffer
+	if err := goTestTemplate.Execute(&b, options); err != nil {
+		return nil, err
+	}
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,51 @@
+package generate
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGoTest(t *testing.T) {
+	out, err := GoTest(GoTestOptions{Package: "waf", TestName: "TestWAF", Tag: "waf", Dir: "../tests", Config: "../.ftw.yaml", Parallel: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), "//go:build waf\n\n// Code generated by ftw generate gotest. DO NOT EDIT.\n") {
+		t.Errorf("the file must start with its build tag\n%s", out)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "ftw_test.go", out, 0)
+	if err != nil {
+		t.Fatalf("the file is not valid Go: %s\n%s", err, out)
+	}
+	if file.Name.Name != "waf" {
+		t.Errorf("unexpected package %s", file.Name.Name)
+	}
+	for _, expected := range []string{`config.NewConfig("../.ftw.yaml", "", nil)`, `ftwtest.Run(t, "../tests", ftwtest.Config{FTW: cfg, Parallel: true})`, "func TestWAF(t *testing.T)"} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected %s in\n%s", expected, out)
+		}
+	}
+
+	out, err = GoTest(GoTestOptions{Package: "waf", TestName: "TestWAF"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "go:build") || !strings.Contains(string(out), `ftwtest.Run(t, ".",`) {
+		t.Errorf("expected a file without build tag, running the current directory\n%s", out)
+	}
+}
+
+func TestGoTestErrors(t *testing.T) {
+	for _, options := range []GoTestOptions{
+		{Package: "my-waf", TestName: "TestWAF"},
+		{Package: "waf", TestName: "Testwaf"},
+		{Package: "waf", TestName: "WAF"},
+		{Package: "waf", TestName: "TestWAF", Tag: "waf || x"},
+	} {
+		if _, err := GoTest(options); err == nil {
+			t.Errorf("expected an error with %+v", options)
+		}
+	}
+}
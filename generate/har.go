@@ -0,0 +1,78 @@
+package generate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// har is the part of the HTTP Archive format (http://www.softwareishard.com/blog/har-12-spec/)
+// needed to recreate the requests
+type har struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method      string `json:"method"`
+				URL         string `json:"url"`
+				HTTPVersion string `json:"httpVersion"`
+				Headers     []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					// non-standard, but written by some tools for binary bodies
+					Encoding string `json:"encoding"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// FromHAR reads the requests recorded in a HAR file
+func FromHAR(r io.Reader) ([]Request, error) {
+	var archive har
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("ftw/generate: cannot read HAR: %w", err)
+	}
+
+	var requests []Request
+	for _, entry := range archive.Log.Entries {
+		request := Request{
+			Method:  entry.Request.Method,
+			URL:     entry.Request.URL,
+			Version: entry.Request.HTTPVersion,
+		}
+		for _, header := range entry.Request.Headers {
+			request.Headers = append(request.Headers, [2]string{header.Name, header.Value})
+		}
+		if postData := entry.Request.PostData; postData != nil {
+			if postData.Encoding == "base64" {
+				body, err := base64.StdEncoding.DecodeString(postData.Text)
+				if err != nil {
+					return nil, fmt.Errorf("ftw/generate: cannot decode body of %s: %w", request.URL, err)
+				}
+				request.Body = body
+			} else {
+				request.Body = []byte(postData.Text)
+			}
+			if postData.MimeType != "" && !hasHeader(request.Headers, "Content-Type") {
+				request.Headers = append(request.Headers, [2]string{"Content-Type", postData.MimeType})
+			}
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+func hasHeader(headers [][2]string, name string) bool {
+	for _, header := range headers {
+		if strings.EqualFold(header[0], name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/test"
+)
+
+var harCapture = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "Firefox", "version": "110.0"},
+    "entries": [
+      {
+        "request": {
+          "method": "GET",
+          "url": "https://example.com/search?q=%27%20or%201%3D1",
+          "httpVersion": "HTTP/2",
+          "headers": [
+            {"name": ":authority", "value": "example.com"},
+            {"name": "user-agent", "value": "Mozilla/5.0"},
+            {"name": "accept", "value": "*/*"}
+          ]
+        },
+        "response": {"status": 200}
+      },
+      {
+        "request": {
+          "method": "POST",
+          "url": "http://localhost:8080/api/users",
+          "httpVersion": "HTTP/1.1",
+          "headers": [
+            {"name": "Host", "value": "localhost:8080"},
+            {"name": "Content-Length", "value": "17"}
+          ],
+          "postData": {"mimeType": "application/json", "text": "{\"name\":\"{{x}}\"}"}
+        },
+        "response": {"status": 201}
+      }
+    ]
+  }
+}`
+
+func TestFromHAR(t *testing.T) {
+	requests, err := FromHAR(strings.NewReader(harCapture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+
+	ftwTest, err := NewTest("capture.yaml", "Generated from capture.har", "capture", requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := ftwTest.Tests[0].Stages[0].Stage.Input
+	if ftwTest.Tests[0].TestTitle != "capture-1" {
+		t.Errorf("unexpected title %s", ftwTest.Tests[0].TestTitle)
+	}
+	if first.GetDestAddr() != "example.com" || first.GetPort() != 443 || first.GetProtocol() != "https" {
+		t.Errorf("unexpected destination %s://%s:%d", first.GetProtocol(), first.GetDestAddr(), first.GetPort())
+	}
+	if first.GetURI() != "/search?q=%27%20or%201%3D1" || first.GetMethod() != "GET" || first.Version != nil {
+		t.Errorf("unexpected request line %s %s", first.GetMethod(), first.GetURI())
+	}
+	if first.Headers.Values(":authority") != nil {
+		t.Error("pseudo-headers must not be copied")
+	}
+	if first.Headers.Get("Host") != "example.com" || first.Headers.Get("user-agent") != "Mozilla/5.0" {
+		t.Errorf("unexpected headers %v", first.Headers)
+	}
+
+	second := ftwTest.Tests[1].Stages[0].Stage.Input
+	if second.GetMethod() != "POST" || second.GetPort() != 8080 {
+		t.Errorf("unexpected request %s to port %d", second.GetMethod(), second.GetPort())
+	}
+	if second.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("content type must be taken from the post data, got %v", second.Headers)
+	}
+	if second.Headers.Values("Content-Length") != nil {
+		t.Error("Content-Length must not be copied")
+	}
+	// the body looks like a template, so it must not be sent as data
+	if second.Data != nil || second.DataB64 != "eyJuYW1lIjoie3t4fX0ifQ==" {
+		t.Errorf("unexpected body %v, %s", second.Data, second.DataB64)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	requests, err := FromHAR(strings.NewReader(harCapture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest, err := NewTest("capture.yaml", "Generated from capture.har", "capture", requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Marshal(ftwTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the generated file must be a valid test
+	if problems := test.ValidateTestYaml("capture.yaml", out); len(problems) > 0 {
+		t.Errorf("generated test is not valid: %v\n%s", problems, out)
+	}
+	read, err := test.GetTestFromYaml(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Tests) != 2 || read.Tests[1].Stages[0].Stage.Input.DataB64 == "" {
+		t.Errorf("unexpected test read back:\n%s", out)
+	}
+}
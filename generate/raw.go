@@ -0,0 +1,97 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FromRawRequest reads a raw HTTP/1.x request, as captured with e.g. tcpdump or Burp. The
+// destination is taken from the Host header (or an absolute request URI) using the given protocol.
+func FromRawRequest(r io.Reader, protocol string) (Request, error) {
+	var request Request
+	reader := bufio.NewReader(r)
+
+	line, err := readRawLine(reader)
+	// skip empty lines before the request line, like servers do
+	for err == nil && line == "" {
+		line, err = readRawLine(reader)
+	}
+	if err != nil {
+		return request, fmt.Errorf("ftw/generate: cannot read request line: %w", err)
+	}
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return request, fmt.Errorf("ftw/generate: bad request line %q", line)
+	}
+	request.Method, request.Version = parts[0], parts[2]
+	uri := parts[1]
+
+	host := ""
+	for {
+		line, err = readRawLine(reader)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return request, fmt.Errorf("ftw/generate: cannot read headers: %w", err)
+		}
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return request, fmt.Errorf("ftw/generate: bad header %q", line)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.EqualFold(name, "Host") {
+			host = value
+		}
+		request.Headers = append(request.Headers, [2]string{name, value})
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return request, fmt.Errorf("ftw/generate: cannot read body: %w", err)
+	}
+	for _, h := range request.Headers {
+		if strings.EqualFold(h[0], "Content-Length") {
+			if n, err := strconv.Atoi(h[1]); err == nil && n >= 0 && n < len(body) {
+				body = body[:n]
+			}
+		}
+	}
+	// editors add a final line break to the captured file
+	if !hasHeader(request.Headers, "Content-Length") {
+		body = bytes.TrimRight(body, "\r\n")
+	}
+	if len(body) > 0 {
+		request.Body = body
+	}
+
+	switch {
+	case strings.Contains(uri, "://"):
+		request.URL = uri
+	case host != "":
+		if protocol == "" {
+			protocol = "http"
+		}
+		request.URL = protocol + "://" + host + uri
+	default:
+		return request, errors.New("ftw/generate: no Host header in raw request")
+	}
+	return request, nil
+}
+
+// readRawLine reads a line accepting both CRLF and LF line endings
+func readRawLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
@@ -0,0 +1,68 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromRawRequest(t *testing.T) {
+	raw := "POST /upload?id=1 HTTP/1.0\r\n" +
+		"Host: localhost:8080\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello, and trailing garbage"
+
+	request, err := FromRawRequest(strings.NewReader(raw), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Method != "POST" || request.Version != "HTTP/1.0" {
+		t.Errorf("unexpected request line %s %s", request.Method, request.Version)
+	}
+	if request.URL != "http://localhost:8080/upload?id=1" {
+		t.Errorf("unexpected URL %s", request.URL)
+	}
+	if string(request.Body) != "hello" {
+		t.Errorf("body must be cut at Content-Length, got %q", request.Body)
+	}
+	if len(request.Headers) != 3 || request.Headers[1] != [2]string{"Content-Type", "text/plain"} {
+		t.Errorf("unexpected headers %v", request.Headers)
+	}
+
+	input, err := NewInput(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.GetPort() != 8080 || input.GetURI() != "/upload?id=1" || *input.Data != "hello" {
+		t.Errorf("unexpected input %+v", input)
+	}
+}
+
+func TestFromRawRequestLineEndings(t *testing.T) {
+	raw := "\nGET / HTTP/1.1\nHost: example.com\nUser-Agent: nikto\n\n"
+
+	request, err := FromRawRequest(strings.NewReader(raw), "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.URL != "https://example.com/" || len(request.Body) != 0 {
+		t.Errorf("unexpected request %s %q", request.URL, request.Body)
+	}
+	if len(request.Headers) != 2 {
+		t.Errorf("unexpected headers %v", request.Headers)
+	}
+}
+
+func TestFromRawRequestErrors(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"GET /\r\nHost: localhost\r\n\r\n",
+		"GET / HTTP/1.1\r\nUser-Agent: x\r\n\r\n",
+		"GET / HTTP/1.1\r\nbad header\r\n\r\n",
+	} {
+		if _, err := FromRawRequest(strings.NewReader(raw), "http"); err == nil {
+			t.Errorf("%q: expected error", raw)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package generate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/template"
+)
+
+// crsRuleID matches CRS rule IDs, where the first three digits are the number of the rule file
+var crsRuleID = regexp.MustCompile(`^[1-9][0-9]{5}$`)
+
+var scaffoldTemplate = template.Must(template.New("scaffold").Parse(`---
+meta:
+  author: "{{ .Author }}"
+  enabled: true
+  name: "{{ .RuleID }}.yaml"
+  description: "Tests for rule {{ .RuleID }}"
+tests:
+{{- range .Titles }}
+  - test_title: {{ . }}
+    # describe what this test sends, and why the rule must (or must not) match
+    desc: ""
+    stages:
+      - stage:
+          input:
+            dest_addr: "127.0.0.1"
+            port: 80
+            method: "GET"
+            uri: "/"
+            headers:
+              Host: "localhost"
+              User-Agent: "OWASP CRS test agent"
+              Accept: "text/xml,application/xml,application/xhtml+xml,text/html;q=0.9,text/plain;q=0.8,image/png,*/*;q=0.5"
+          output:
+            log:
+              rule_ids: [{{ $.RuleID }}]
+{{- end }}
+`))
+
+// Scaffold returns a new test file for a CRS rule, with the given number of tests titled
+// `<rule id>-<n>` as CRS requires, each with one stage expecting the rule to match
+func Scaffold(ruleID string, author string, tests int) ([]byte, error) {
+	if !crsRuleID.MatchString(ruleID) {
+		return nil, fmt.Errorf("ftw/generate: %q is not a rule ID, CRS rule IDs have 6 digits", ruleID)
+	}
+	if tests < 1 {
+		return nil, errors.New("ftw/generate: at least one test is needed")
+	}
+
+	data := struct {
+		RuleID string
+		Author string
+		Titles []string
+	}{RuleID: ruleID, Author: author}
+	for n := 1; n <= tests; n++ {
+		data.Titles = append(data.Titles, ruleID+"-"+strconv.Itoa(n))
+	}
+
+	var out bytes.Buffer
+	if err := scaffoldTemplate.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ScaffoldPath returns the path of the test file for a rule. CRS keeps the tests of each rule
+// file in a directory named like the rule file (e.g. REQUEST-942-APPLICATION-ATTACK-SQLI); if dir
+// has a directory for the rule file, the path is in that directory, otherwise it is in dir.
+func ScaffoldPath(dir string, ruleID string) (string, error) {
+	if !crsRuleID.MatchString(ruleID) {
+		return "", fmt.Errorf("ftw/generate: %q is not a rule ID, CRS rule IDs have 6 digits", ruleID)
+	}
+	fileName := ruleID + ".yaml"
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*-"+ruleID[:3]+"-*"))
+	if err != nil {
+		return "", err
+	}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			return filepath.Join(match, fileName), nil
+		}
+	}
+	return filepath.Join(dir, fileName), nil
+}
@@ -0,0 +1,69 @@
+package generate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/test"
+)
+
+func TestScaffold(t *testing.T) {
+	out, err := Scaffold("942100", "tester", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found := test.ValidateTestYaml("942100.yaml", out); len(found) > 0 {
+		t.Fatalf("scaffolded test is not valid: %v", found)
+	}
+	ftwTest, err := test.GetTestFromYaml(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ftwTest.Meta.Author != "tester" || ftwTest.Meta.Name != "942100.yaml" || !ftwTest.Meta.Enabled {
+		t.Errorf("unexpected meta %+v", ftwTest.Meta)
+	}
+	if len(ftwTest.Tests) != 2 || ftwTest.Tests[0].TestTitle != "942100-1" || ftwTest.Tests[1].TestTitle != "942100-2" {
+		t.Fatalf("unexpected tests %+v", ftwTest.Tests)
+	}
+	output := ftwTest.Tests[1].Stages[0].Stage.Output
+	if len(output.Log.ExpectIDs) != 1 || output.Log.ExpectIDs[0] != 942100 {
+		t.Errorf("unexpected output %+v", output)
+	}
+	if issues := test.Lint([]test.FTWTest{ftwTest}); len(issues) > 0 {
+		t.Errorf("scaffolded test has lint issues: %v", issues)
+	}
+}
+
+func TestScaffoldInvalid(t *testing.T) {
+	if _, err := Scaffold("1234", "tester", 1); err == nil {
+		t.Error("expected error for short rule ID")
+	}
+	if _, err := Scaffold("942100", "tester", 0); err == nil {
+		t.Error("expected error without tests")
+	}
+}
+
+func TestScaffoldPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "REQUEST-942-APPLICATION-ATTACK-SQLI"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := ScaffoldPath(dir, "942100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "REQUEST-942-APPLICATION-ATTACK-SQLI", "942100.yaml") {
+		t.Errorf("unexpected path %s", path)
+	}
+
+	path, err = ScaffoldPath(dir, "920100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "920100.yaml") {
+		t.Errorf("unexpected path %s", path)
+	}
+}
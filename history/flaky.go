@@ -0,0 +1,67 @@
+package history
+
+import "sort"
+
+// FlakyTest is a test whose result flips between passed and failed in the runs of the same
+// configuration
+type FlakyTest struct {
+	File string `json:"file"`
+	Test string `json:"test"`
+	// Config is the fingerprint of the configuration of the runs
+	Config string `json:"config"`
+	// Runs is the number of runs where the test passed or failed
+	Runs   int `json:"runs"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+	// Flips is the number of times the result changed from a run to the next one
+	Flips int `json:"flips"`
+	// LastResult is the result of the test in the last run
+	LastResult string `json:"last_result"`
+}
+
+// Flaky returns the tests whose result changed at least minFlips times between passed and failed
+// in the runs, the oldest first, with the same configuration. The runs of every configuration are
+// compared separately, so changing the configuration doesn't make the tests flaky. The tests
+// that flipped the most are first. The skipped and ignored results are left out.
+func Flaky(runs []Run, minFlips int) []FlakyTest {
+	type key struct{ config, test string }
+	index := make(map[key]*FlakyTest)
+	last := make(map[key]bool)
+	var keys []key
+	for _, run := range runs {
+		for _, t := range run.Tests {
+			if !t.Passed() && !t.Failed() {
+				continue
+			}
+			k := key{run.Config, t.Test}
+			flaky, ok := index[k]
+			if !ok {
+				flaky = &FlakyTest{Test: t.Test, Config: run.Config}
+				index[k] = flaky
+				keys = append(keys, k)
+			} else if last[k] != t.Failed() {
+				flaky.Flips++
+			}
+			last[k] = t.Failed()
+			flaky.File = t.File
+			flaky.Runs++
+			if t.Failed() {
+				flaky.Failed++
+			} else {
+				flaky.Passed++
+			}
+			flaky.LastResult = t.Result
+		}
+	}
+
+	var found []FlakyTest
+	for _, k := range keys {
+		if flaky := index[k]; flaky.Flips >= minFlips && flaky.Flips > 0 {
+			found = append(found, *flaky)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Flips > found[j].Flips
+	})
+	return found
+}
@@ -0,0 +1,49 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/report"
+)
+
+// run returns a run of the configuration with the results of the tests, by title
+func run(config string, results ...string) Run {
+	r := Run{Config: config}
+	for i := 0; i < len(results); i += 2 {
+		r.Tests = append(r.Tests, report.TestResult{File: "tests.yaml", Test: results[i], Result: results[i+1]})
+	}
+	return r
+}
+
+func TestFlaky(t *testing.T) {
+	runs := []Run{
+		run("a", "942100-1", "passed", "942100-2", "passed", "920100-1", "failed", "913100-1", "passed"),
+		run("a", "942100-1", "failed", "942100-2", "passed", "920100-1", "failed", "913100-1", "failed"),
+		// a new configuration, like the rules of another paranoia level
+		run("b", "942100-1", "failed", "942100-2", "failed", "920100-1", "passed", "913100-1", "passed"),
+		run("a", "942100-1", "passed", "942100-2", "skipped", "920100-1", "failed", "913100-1", "failed"),
+		run("a", "942100-1", "forced_fail", "942100-2", "passed", "920100-1", "failed", "913100-1", "failed"),
+	}
+
+	flaky := Flaky(runs, 2)
+	expected := []FlakyTest{
+		{File: "tests.yaml", Test: "942100-1", Config: "a", Runs: 4, Passed: 2, Failed: 2, Flips: 3, LastResult: "forced_fail"},
+	}
+	if !reflect.DeepEqual(flaky, expected) {
+		t.Errorf("unexpected flaky tests %+v", flaky)
+	}
+
+	// 913100-1 started failing once, which is a regression rather than a flaky test
+	var titles []string
+	for _, f := range Flaky(runs, 1) {
+		titles = append(titles, f.Test)
+	}
+	if !reflect.DeepEqual(titles, []string{"942100-1", "913100-1"}) {
+		t.Errorf("unexpected flaky tests %v", titles)
+	}
+
+	if flaky := Flaky(runs, 0); len(flaky) != 2 {
+		t.Errorf("the tests that never flipped are not flaky, got %+v", flaky)
+	}
+}
@@ -0,0 +1,143 @@
+// Package history keeps the results of the runs in a file, so the trends of the tests can be
+// followed without external tools. Every run is a line of JSON appended to the file, which can
+// be kept by the CI system between runs.
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coreruleset/go-ftw/report"
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// maxLineSize is the size of the longest run read from the history, the results of large test
+// suites being long lines
+const maxLineSize = 64 * 1024 * 1024
+
+// Run is a run of the history, with the results of its tests
+type Run struct {
+	// ID identifies the run, and FinishedAt is when it finished
+	ID         string    `json:"id"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Config is the fingerprint of the configuration of the run, the same for the runs with the
+	// same configuration
+	Config string `json:"config,omitempty"`
+	report.Results
+}
+
+// Entry is the result of a test in a run of the history
+type Entry struct {
+	RunID string    `json:"run_id"`
+	RunAt time.Time `json:"run_at"`
+	report.TestResult
+}
+
+// NewRun returns the run of the history with the results of the statistics, finishing now, and
+// the fingerprint of its configuration
+func NewRun(stats runner.TestStats, config string) Run {
+	return Run{
+		ID:         uuid.NewString(),
+		FinishedAt: time.Now().UTC(),
+		Config:     config,
+		Results:    report.NewResults(stats),
+	}
+}
+
+// Fingerprint returns the fingerprint of the values of a configuration, like the configuration of
+// ftw and the tests selected, which is the same for the same values. It's empty when the values
+// can't be encoded as JSON.
+func Fingerprint(values ...interface{}) string {
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Store is a history file
+type Store struct {
+	path string
+}
+
+// NewStore returns the store of the history file at path. The file is created by the first run
+// added to it.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Add appends the run to the history
+func (s *Store) Add(run Run) error {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("ftw/history: can't encode the run: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("ftw/history: can't open the history: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("ftw/history: can't add the run: %w", err)
+	}
+	return f.Close()
+}
+
+// Runs returns the runs of the history, the oldest first. The last runs are returned when last
+// is more than 0. There are no runs when the file doesn't exist.
+func (s *Store) Runs(last int) ([]Run, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ftw/history: can't open the history: %w", err)
+	}
+	defer f.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("ftw/history: bad run on line %d of %s: %w", n, s.path, err)
+		}
+		runs = append(runs, run)
+		if last > 0 && len(runs) > last {
+			runs = runs[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ftw/history: can't read the history: %w", err)
+	}
+	return runs, nil
+}
+
+// Tests returns the results of the tests whose title matches the regular expression in the
+// runs, the oldest run first
+func Tests(runs []Run, title *regexp.Regexp) []Entry {
+	var entries []Entry
+	for _, run := range runs {
+		for _, t := range run.Tests {
+			if title.MatchString(t.Test) {
+				entries = append(entries, Entry{RunID: run.ID, RunAt: run.FinishedAt, TestResult: t})
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,96 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/report"
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+func TestStore(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "ftw-history.jsonl"))
+	if runs, err := store.Runs(0); err != nil || runs != nil {
+		t.Fatalf("a missing history has no runs, got %v, %v", runs, err)
+	}
+
+	for i, result := range []runner.TestResult{runner.Success, runner.Failed, runner.Success} {
+		run := NewRun(runner.TestStats{
+			Stages: []runner.StageResult{
+				{File: "942100.yaml", Test: "942100-1", Result: result, Duration: time.Duration(i+1) * time.Millisecond},
+				{File: "920100.yaml", Test: "920100-1", Result: runner.Success, Duration: time.Millisecond},
+			},
+		}, "0123456789abcdef")
+		if err := store.Add(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := store.Runs(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || runs[0].ID == "" || runs[0].Config != "0123456789abcdef" || runs[0].ID == runs[1].ID || runs[0].FinishedAt.IsZero() || runs[0].Time != 0.002 {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+
+	last, err := store.Runs(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 2 || last[0].ID != runs[1].ID || last[1].ID != runs[2].ID {
+		t.Errorf("the last runs must be returned, got %+v", last)
+	}
+
+	entries := Tests(runs, regexp.MustCompile("^(?:942100)"))
+	var results []string
+	for _, entry := range entries {
+		results = append(results, entry.Result)
+	}
+	if !reflect.DeepEqual(results, []string{"passed", "failed", "passed"}) {
+		t.Errorf("unexpected results %v", results)
+	}
+	if entries[1].RunID != runs[1].ID || !entries[1].RunAt.Equal(runs[1].FinishedAt) || entries[1].Time != 0.002 {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+}
+
+func TestStoreBadLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ftw-history.jsonl")
+	store := NewStore(path)
+	if err := store.Add(Run{ID: "first", Results: report.Results{}}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("\n{truncated\n")
+	f.Close()
+
+	if _, err := store.Runs(0); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("the bad line must be reported, got %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	type cfg struct {
+		LogFile string
+		Timeout time.Duration
+	}
+	first := Fingerprint(cfg{LogFile: "/var/log/error.log", Timeout: time.Second}, "942.*")
+	if len(first) != 16 || first != Fingerprint(cfg{LogFile: "/var/log/error.log", Timeout: time.Second}, "942.*") {
+		t.Errorf("the same configuration must have the same fingerprint, got %s", first)
+	}
+	if first == Fingerprint(cfg{LogFile: "/var/log/error.log", Timeout: time.Second}, "920.*") {
+		t.Error("different configurations must have different fingerprints")
+	}
+	if Fingerprint(func() {}) != "" {
+		t.Error("values that can't be encoded have no fingerprint")
+	}
+}
@@ -0,0 +1,101 @@
+// Package logging sets up the logs of ftw, its diagnostics, like the markers it looks for or the
+// requests it retries. They are written with the global logger of zerolog, apart from the
+// results of the tests printed to stdout, so programs using go-ftw as a library can set them up
+// like their own logs, or with Setup.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// The formats of the logs
+const (
+	// ConsoleFormat writes the logs as lines for humans, the default
+	ConsoleFormat = "console"
+	// JSONFormat writes the logs as lines of JSON, for log collectors
+	JSONFormat = "json"
+)
+
+// Config is the configuration of the logs
+type Config struct {
+	// Level is the minimum level of the logs written: trace, debug, info, warn, error or
+	// disabled. It's info when empty. With disabled, the fatal errors are not written either,
+	// but they still stop the program.
+	Level string
+	// Format is the format of the logs, ConsoleFormat when empty
+	Format string
+	// File is the file the logs are appended to, instead of stderr
+	File string
+	// NoColor writes the logs in the console format without colors
+	NoColor bool
+}
+
+// nopCloser closes nothing, for the logs written to stderr
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// disabledLevel is the name of the level writing no logs
+const disabledLevel = "disabled"
+
+// ParseLevel returns the level of the logs with the name, info for an empty name. The disabled
+// level is the fatal one, since zerolog doesn't exit on the fatal errors of the disabled logs:
+// Writer discards them instead.
+func ParseLevel(name string) (zerolog.Level, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return zerolog.InfoLevel, nil
+	case disabledLevel:
+		return zerolog.FatalLevel, nil
+	case "trace", "debug", "info", "warn", "error":
+		return zerolog.ParseLevel(strings.ToLower(name))
+	}
+	return zerolog.NoLevel, fmt.Errorf("ftw/logging: unknown level %q, use one of: trace, debug, info, warn, error, disabled", name)
+}
+
+// Writer returns the writer of the logs in the format of the configuration, and the closer of
+// its file. The logs of the disabled level are discarded.
+func Writer(cfg Config) (io.Writer, io.Closer, error) {
+	var out io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if strings.EqualFold(cfg.Level, disabledLevel) {
+		out = io.Discard
+	} else if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ftw/logging: can't open the log file: %w", err)
+		}
+		out, closer = f, f
+	}
+	switch cfg.Format {
+	case "", ConsoleFormat:
+		// the files don't show colors
+		return zerolog.ConsoleWriter{Out: out, NoColor: cfg.NoColor || cfg.File != ""}, closer, nil
+	case JSONFormat:
+		return out, closer, nil
+	}
+	closer.Close()
+	return nil, nil, fmt.Errorf("ftw/logging: unknown format %q, use one of: %s, %s", cfg.Format, ConsoleFormat, JSONFormat)
+}
+
+// Setup writes the global logs of zerolog, the ones of ftw, with the configuration. Close the
+// returned closer once the logs are written, to close their file.
+func Setup(cfg Config) (io.Closer, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	w, closer, err := Writer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Logger = log.Output(w)
+	zerolog.SetGlobalLevel(level)
+	return closer, nil
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]zerolog.Level{
+		"":         zerolog.InfoLevel,
+		"debug":    zerolog.DebugLevel,
+		"WARN":     zerolog.WarnLevel,
+		"disabled": zerolog.FatalLevel,
+	} {
+		if level, err := ParseLevel(name); err != nil || level != expected {
+			t.Errorf("expected the level %s for %q, got %s (%v)", expected, name, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	logger, level := log.Logger, zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+	})
+
+	file := filepath.Join(t.TempDir(), "ftw.log")
+	closer, err := Setup(Config{Level: "warn", Format: JSONFormat, File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info().Msg("not written")
+	log.Warn().Msg("written")
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var line struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &line) != nil || line.Level != "warn" || line.Message != "written" {
+		t.Errorf("unexpected logs %q", data)
+	}
+}
+
+func TestWriterDisabled(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ftw.log")
+	w, closer, err := Writer(Config{Level: "disabled", Format: JSONFormat, File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	if w != io.Discard {
+		t.Errorf("the disabled logs must be discarded, got %T", w)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("the file of the disabled logs must not be created, got %v", err)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	if _, _, err := Writer(Config{Format: "xml"}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, _, err := Writer(Config{File: filepath.Join(t.TempDir(), "missing", "ftw.log")}); err == nil {
+		t.Error("expected an error for a file that can't be opened")
+	}
+}
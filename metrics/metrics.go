@@ -0,0 +1,179 @@
+// Package metrics exposes the results of the runs in the Prometheus text format, served on an
+// endpoint or pushed to a Pushgateway, so scheduled runs can be monitored
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// RoundTripTimeBuckets are the upper bounds of the buckets of the round trip time histogram, in
+// seconds. They are the default buckets of the Prometheus clients.
+var RoundTripTimeBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector accumulates the metrics of a run. It can be read while the run updates it.
+type Collector struct {
+	mu sync.Mutex
+	// results counts the stages by result, like `passed` or `failed`
+	results map[string]int
+	// durations are the times spent running the stages of every test, by test title
+	durations map[string]time.Duration
+	// buckets count the round trip times of the requests, by bucket of RoundTripTimeBuckets
+	buckets   []int
+	rttSum    time.Duration
+	rttCount  int
+	runTime   time.Duration
+	lastRunAt time.Time
+}
+
+// NewCollector returns a collector without metrics
+func NewCollector() *Collector {
+	return &Collector{
+		results:   make(map[string]int),
+		durations: make(map[string]time.Duration),
+		buckets:   make([]int, len(RoundTripTimeBuckets)),
+	}
+}
+
+// ObserveResult counts a stage with its result, when it didn't run
+func (c *Collector) ObserveResult(result string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[result]++
+}
+
+// ObserveStage records a stage of a test that ran, with its result, the time it took and the
+// round trip time of its request. The round trip time is not recorded when it's 0, e.g. when the
+// request failed.
+func (c *Collector) ObserveStage(title string, result string, stageTime time.Duration, roundTripTime time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[result]++
+	c.durations[title] += stageTime
+	c.runTime += stageTime
+	if roundTripTime <= 0 {
+		return
+	}
+	c.rttSum += roundTripTime
+	c.rttCount++
+	for i, bound := range RoundTripTimeBuckets {
+		if roundTripTime.Seconds() <= bound {
+			c.buckets[i]++
+		}
+	}
+}
+
+// Finish records the end of the run
+func (c *Collector) Finish(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRunAt = at
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b bytes.Buffer
+	writeHeader(&b, "ftw_tests_total", "counter", "Stages of the tests by result.")
+	for _, result := range sortedKeys(c.results) {
+		fmt.Fprintf(&b, "ftw_tests_total{result=\"%s\"} %d\n", escapeLabel(result), c.results[result])
+	}
+
+	writeHeader(&b, "ftw_test_duration_seconds", "gauge", "Time spent running the stages of the test.")
+	titles := make([]string, 0, len(c.durations))
+	for title := range c.durations {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+	for _, title := range titles {
+		fmt.Fprintf(&b, "ftw_test_duration_seconds{test=\"%s\"} %s\n", escapeLabel(title), formatFloat(c.durations[title].Seconds()))
+	}
+
+	writeHeader(&b, "ftw_request_rtt_seconds", "histogram", "Round trip time of the requests of the stages.")
+	for i, bound := range RoundTripTimeBuckets {
+		fmt.Fprintf(&b, "ftw_request_rtt_seconds_bucket{le=\"%s\"} %d\n", formatFloat(bound), c.buckets[i])
+	}
+	fmt.Fprintf(&b, "ftw_request_rtt_seconds_bucket{le=\"+Inf\"} %d\n", c.rttCount)
+	fmt.Fprintf(&b, "ftw_request_rtt_seconds_sum %s\n", formatFloat(c.rttSum.Seconds()))
+	fmt.Fprintf(&b, "ftw_request_rtt_seconds_count %d\n", c.rttCount)
+
+	writeHeader(&b, "ftw_run_duration_seconds", "gauge", "Time spent running the stages of the run.")
+	fmt.Fprintf(&b, "ftw_run_duration_seconds %s\n", formatFloat(c.runTime.Seconds()))
+
+	if !c.lastRunAt.IsZero() {
+		writeHeader(&b, "ftw_last_run_timestamp_seconds", "gauge", "Time the last run finished, in seconds since the epoch.")
+		fmt.Fprintf(&b, "ftw_last_run_timestamp_seconds %s\n", formatFloat(float64(c.lastRunAt.UnixNano())/1e9))
+	}
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics, so the collector can be scraped while the tests run
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if _, err := c.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Push replaces the metrics of the job in the Pushgateway at gatewayURL, like
+// `http://pushgateway:9091`, with the metrics of the collector
+func (c *Collector) Push(client *http.Client, gatewayURL string, job string) error {
+	if job == "" {
+		return fmt.Errorf("ftw/metrics: the job of the metrics is required")
+	}
+	var body bytes.Buffer
+	if _, err := c.WriteTo(&body); err != nil {
+		return err
+	}
+	pushURL := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPut, pushURL, &body)
+	if err != nil {
+		return fmt.Errorf("ftw/metrics: bad Pushgateway URL: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ftw/metrics: can't push the metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ftw/metrics: the Pushgateway answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+func writeHeader(b *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeLabel escapes the backslashes, quotes and new lines of a label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
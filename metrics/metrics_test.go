@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTo(t *testing.T) {
+	c := NewCollector()
+	c.ObserveStage("942100-1", "passed", 300*time.Millisecond, 20*time.Millisecond)
+	c.ObserveStage("942100-1", "passed", 200*time.Millisecond, 2*time.Second)
+	c.ObserveStage("quote\"d", "failed", time.Second, 0)
+	c.ObserveResult("skipped")
+	c.Finish(time.Unix(1683117296, 0))
+
+	var b bytes.Buffer
+	if _, err := c.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, expected := range []string{
+		"# TYPE ftw_tests_total counter\n",
+		`ftw_tests_total{result="failed"} 1` + "\n",
+		`ftw_tests_total{result="passed"} 2` + "\n",
+		`ftw_tests_total{result="skipped"} 1` + "\n",
+		`ftw_test_duration_seconds{test="942100-1"} 0.5` + "\n",
+		`ftw_test_duration_seconds{test="quote\"d"} 1` + "\n",
+		"# TYPE ftw_request_rtt_seconds histogram\n",
+		`ftw_request_rtt_seconds_bucket{le="0.01"} 0` + "\n",
+		`ftw_request_rtt_seconds_bucket{le="0.025"} 1` + "\n",
+		`ftw_request_rtt_seconds_bucket{le="2.5"} 2` + "\n",
+		`ftw_request_rtt_seconds_bucket{le="+Inf"} 2` + "\n",
+		"ftw_request_rtt_seconds_sum 2.02\n",
+		"ftw_request_rtt_seconds_count 2\n",
+		"ftw_run_duration_seconds 1.5\n",
+		"ftw_last_run_timestamp_seconds 1.683117296e+09\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("%q not found in\n%s", expected, out)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	c := NewCollector()
+	c.ObserveResult("skipped")
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Header().Get("Content-Type") != ContentType {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `ftw_tests_total{result="skipped"} 1`) {
+		t.Errorf("unexpected metrics\n%s", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "ftw_last_run_timestamp_seconds") {
+		t.Error("the end of the run must not be served before the run is done")
+	}
+}
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.EscapedPath()
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		if strings.Contains(path, "broken") {
+			http.Error(w, "bad metrics", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewCollector()
+	c.ObserveResult("passed")
+	if err := c.Push(server.Client(), server.URL+"/", "nightly crs"); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/nightly%20crs" {
+		t.Errorf("unexpected push %s %s", method, path)
+	}
+	if !strings.Contains(body, `ftw_tests_total{result="passed"} 1`) {
+		t.Errorf("unexpected metrics pushed\n%s", body)
+	}
+
+	if err := c.Push(server.Client(), server.URL, "broken"); err == nil || !strings.Contains(err.Error(), "bad metrics") {
+		t.Errorf("the error of the Pushgateway must be returned, got %v", err)
+	}
+	if err := c.Push(server.Client(), server.URL, ""); err == nil {
+		t.Error("the job is required")
+	}
+}
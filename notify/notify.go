@@ -0,0 +1,108 @@
+// Package notify sends the summary of the runs to a webhook, like the incoming webhooks of
+// Slack, so unattended runs don't need to be watched
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+const (
+	// MaxListedFailures is the number of failures listed in the text of the summary
+	MaxListedFailures = 20
+	// timeRounding is the precision of the run time in the text of the summary
+	timeRounding = 10 * time.Millisecond
+)
+
+// Summary is the summary of a run posted to the webhook. Text is the message shown by Slack,
+// and chat tools with Slack compatible webhooks, and the other fields are for the other
+// webhooks.
+type Summary struct {
+	Text       string   `json:"text"`
+	Run        int      `json:"run"`
+	Passed     int      `json:"passed"`
+	Failed     []string `json:"failed"`
+	ForcedFail []string `json:"forced_fail"`
+	Skipped    int      `json:"skipped"`
+	Ignored    int      `json:"ignored"`
+	ForcedPass int      `json:"forced_pass"`
+	// RunTime is the time spent running the stages, in seconds
+	RunTime float64 `json:"run_time"`
+}
+
+// NewSummary returns the summary of the statistics of a run. The text starts with the title, like
+// the name of the job, when set.
+func NewSummary(title string, stats runner.TestStats) Summary {
+	summary := Summary{
+		Run:        stats.Run,
+		Passed:     stats.Success,
+		Failed:     append([]string{}, stats.Failed...),
+		ForcedFail: append([]string{}, stats.ForcedFail...),
+		Skipped:    len(stats.Skipped),
+		Ignored:    len(stats.Ignored),
+		ForcedPass: len(stats.ForcedPass),
+		RunTime:    stats.RunTime.Seconds(),
+	}
+
+	var b strings.Builder
+	if title != "" {
+		fmt.Fprintf(&b, "*%s*: ", title)
+	}
+	switch {
+	case stats.Run == 0:
+		b.WriteString("no tests were run")
+	case stats.TotalFailed() == 0:
+		fmt.Fprintf(&b, ":white_check_mark: all %d tests passed in %s", stats.Run, stats.RunTime.Round(timeRounding))
+	default:
+		fmt.Fprintf(&b, ":x: %d of %d tests failed in %s", stats.TotalFailed(), stats.Run, stats.RunTime.Round(timeRounding))
+	}
+	fmt.Fprintf(&b, " (%d skipped", summary.Skipped)
+	if summary.Ignored > 0 {
+		fmt.Fprintf(&b, ", %d ignored", summary.Ignored)
+	}
+	if summary.ForcedPass > 0 {
+		fmt.Fprintf(&b, ", %d forced to pass", summary.ForcedPass)
+	}
+	b.WriteString(")")
+
+	failures := append(append([]string{}, stats.Failed...), stats.ForcedFail...)
+	for i, failure := range failures {
+		if i == MaxListedFailures {
+			fmt.Fprintf(&b, "\n… and %d more", len(failures)-MaxListedFailures)
+			break
+		}
+		fmt.Fprintf(&b, "\n• `%s`", failure)
+	}
+	summary.Text = b.String()
+	return summary
+}
+
+// Send posts the summary as JSON to the webhook
+func Send(client *http.Client, webhookURL string, summary Summary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("ftw/notify: can't encode the summary: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ftw/notify: bad webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ftw/notify: can't send the summary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ftw/notify: the webhook answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+func TestNewSummary(t *testing.T) {
+	stats := runner.TestStats{
+		Run:        5,
+		Success:    2,
+		Failed:     []string{"942100-2", "920100-1"},
+		ForcedFail: []string{"930100-1"},
+		Skipped:    []string{"913100-1"},
+		ForcedPass: []string{"941100-1"},
+		RunTime:    1234567 * time.Microsecond,
+	}
+	summary := NewSummary("nightly", stats)
+	expected := "*nightly*: :x: 3 of 5 tests failed in 1.23s (1 skipped, 1 forced to pass)\n• `942100-2`\n• `920100-1`\n• `930100-1`"
+	if summary.Text != expected {
+		t.Errorf("unexpected text %q", summary.Text)
+	}
+	if summary.Run != 5 || summary.Passed != 2 || len(summary.Failed) != 2 || len(summary.ForcedFail) != 1 || summary.Skipped != 1 || summary.ForcedPass != 1 || summary.RunTime != 1.234567 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	summary = NewSummary("", runner.TestStats{Run: 3, Success: 3, RunTime: time.Second})
+	if summary.Text != ":white_check_mark: all 3 tests passed in 1s (0 skipped)" || summary.Failed == nil {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	if summary = NewSummary("ftw", runner.TestStats{}); summary.Text != "*ftw*: no tests were run (0 skipped)" {
+		t.Errorf("unexpected text %q", summary.Text)
+	}
+}
+
+func TestNewSummaryManyFailures(t *testing.T) {
+	var stats runner.TestStats
+	for i := 0; i < MaxListedFailures+5; i++ {
+		stats.Failed = append(stats.Failed, fmt.Sprintf("942100-%d", i))
+	}
+	stats.Run = len(stats.Failed)
+	summary := NewSummary("", stats)
+	if strings.Count(summary.Text, "•") != MaxListedFailures || !strings.HasSuffix(summary.Text, "\n… and 5 more") {
+		t.Errorf("unexpected text %q", summary.Text)
+	}
+	if len(summary.Failed) != MaxListedFailures+5 {
+		t.Error("all the failures must be in the summary")
+	}
+}
+
+func TestSend(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		if r.Method != http.MethodPost {
+			http.Error(w, "invalid_method", http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	summary := NewSummary("ftw", runner.TestStats{Run: 1, Failed: []string{"942100-1"}})
+	if err := Send(server.Client(), server.URL, summary); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("unexpected content type %s", contentType)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["text"] != summary.Text || payload["run"] != 1.0 {
+		t.Errorf("unexpected payload %s", body)
+	}
+}
+
+func TestSendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no_service", http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	err := Send(server.Client(), server.URL, NewSummary("", runner.TestStats{}))
+	if err == nil || !strings.Contains(err.Error(), "no_service") {
+		t.Errorf("the error of the webhook must be returned, got %v", err)
+	}
+}
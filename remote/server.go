@@ -0,0 +1,278 @@
+// Package remote implements the gRPC API of `ftw service --grpc-listen`, defined in
+// remotepb/remote.proto, so the runs of the service can be orchestrated from other languages and
+// services. The API is served over HTTP/2 without TLS, like the gRPC requests of the tests are sent.
+package remote
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/coreruleset/go-ftw/remote/remotepb"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/service"
+)
+
+// The paths of the methods of the Runner service
+const (
+	submitRunPath     = "/ftw.remote.v1.Runner/SubmitRun"
+	streamResultsPath = "/ftw.remote.v1.Runner/StreamResults"
+	cancelRunPath     = "/ftw.remote.v1.Runner/CancelRun"
+)
+
+// The gRPC status codes of the responses
+const (
+	codeOK                 = 0
+	codeInvalidArgument    = 3
+	codeNotFound           = 5
+	codeResourceExhausted  = 8
+	codeFailedPrecondition = 9
+	codeAborted            = 10
+	codeUnimplemented      = 12
+	codeInternal           = 13
+	codeUnauthenticated    = 16
+)
+
+// maxMessageSize is the size of the largest request message
+const maxMessageSize = 1 << 20
+
+// statusError is an error returned to the client with its gRPC status code
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func newStatusError(code int, err error) *statusError {
+	return &statusError{code: code, message: err.Error()}
+}
+
+// Server serves the gRPC API of a service
+type Server struct {
+	service *service.Service
+}
+
+// NewServer returns the server of the gRPC API running the jobs of the service, which requires the
+// token of the service
+func NewServer(s *service.Service) *Server {
+	return &Server{service: s}
+}
+
+// Handler returns the handler serving the API over HTTP/2 without TLS
+func (s *Server) Handler() http.Handler {
+	return h2c.NewHandler(s, &http2.Server{})
+}
+
+// ServeHTTP serves a call of the API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "ftw/remote: expected a gRPC request", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	err := s.call(w, r)
+	var status *statusError
+	switch {
+	case err == nil:
+		status = &statusError{code: codeOK}
+	case !errors.As(err, &status):
+		status = newStatusError(codeInternal, err)
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(status.code))
+	if status.message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(status.message))
+	}
+}
+
+// call runs the method of the request and writes its response messages
+func (s *Server) call(w http.ResponseWriter, r *http.Request) error {
+	if !s.service.Authorized(r) {
+		return newStatusError(codeUnauthenticated, errors.New("ftw/remote: missing or bad token"))
+	}
+	switch r.URL.Path {
+	case submitRunPath:
+		request := &remotepb.SubmitRunRequest{}
+		if err := readMessage(r.Body, request); err != nil {
+			return err
+		}
+		return s.submitRun(w, request)
+	case streamResultsPath:
+		request := &remotepb.StreamResultsRequest{}
+		if err := readMessage(r.Body, request); err != nil {
+			return err
+		}
+		return s.streamResults(w, r, request)
+	case cancelRunPath:
+		request := &remotepb.CancelRunRequest{}
+		if err := readMessage(r.Body, request); err != nil {
+			return err
+		}
+		return s.cancelRun(w, request)
+	default:
+		return newStatusError(codeUnimplemented, fmt.Errorf("ftw/remote: unknown method %s", r.URL.Path))
+	}
+}
+
+func (s *Server) submitRun(w http.ResponseWriter, request *remotepb.SubmitRunRequest) error {
+	job, err := s.service.Submit(service.JobRequest{
+		Dir:         request.Dir,
+		Include:     request.Include,
+		Exclude:     request.Exclude,
+		Destination: request.Destination,
+		DestAddr:    request.DestAddr,
+		Port:        int(request.Port),
+		Protocol:    request.Protocol,
+		Evidence:    request.Evidence,
+	})
+	if errors.Is(err, service.ErrQueueFull) {
+		return newStatusError(codeResourceExhausted, err)
+	}
+	if err != nil {
+		return newStatusError(codeInvalidArgument, err)
+	}
+	return writeMessage(w, &remotepb.SubmitRunResponse{RunId: job.ID})
+}
+
+func (s *Server) streamResults(w http.ResponseWriter, r *http.Request, request *remotepb.StreamResultsRequest) error {
+	err := s.service.Follow(r.Context(), request.RunId, func(line []byte) error {
+		var event runner.Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return err
+		}
+		return writeMessage(w, toEvent(event))
+	})
+	if errors.Is(err, service.ErrNotFound) {
+		return newStatusError(codeNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	// the stream of a run stopped by an error, like a WAF that can't be reached, ends with it
+	job, err := s.service.Job(request.RunId)
+	if err == nil && job.State == service.Failed {
+		return newStatusError(codeAborted, errors.New(job.Error))
+	}
+	return err
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, request *remotepb.CancelRunRequest) error {
+	job, err := s.service.Cancel(request.RunId)
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return newStatusError(codeNotFound, err)
+	case errors.Is(err, service.ErrDone):
+		return newStatusError(codeFailedPrecondition, err)
+	case err != nil:
+		return err
+	}
+	return writeMessage(w, &remotepb.CancelRunResponse{State: job.State})
+}
+
+// toEvent returns the message of the event of a run
+func toEvent(event runner.Event) *remotepb.Event {
+	message := &remotepb.Event{
+		Type:       event.Type,
+		Time:       event.Time.UTC().Format(time.RFC3339Nano),
+		Files:      int32(event.Files),
+		File:       event.File,
+		Test:       event.Test,
+		Stage:      int32(event.Stage),
+		StageId:    event.StageID,
+		Result:     event.Result,
+		Status:     int32(event.StatusCode),
+		RttMs:      event.RoundTripTime,
+		DurationMs: event.Duration,
+	}
+	for _, rule := range event.TriggeredRules {
+		message.TriggeredRules = append(message.TriggeredRules, int32(rule))
+	}
+	if evidence := event.Evidence; evidence != nil {
+		message.Evidence = &remotepb.Evidence{
+			Request:  evidence.Request,
+			Response: evidence.Response,
+			Error:    evidence.Error,
+			Logs:     evidence.Logs,
+		}
+	}
+	if stats := event.Stats; stats != nil {
+		message.Stats = &remotepb.Stats{
+			Run:        int32(stats.Run),
+			Passed:     int32(stats.Passed),
+			Failed:     stats.Failed,
+			ForcedFail: stats.ForcedFail,
+			Skipped:    int32(stats.Skipped),
+			Ignored:    int32(stats.Ignored),
+			ForcedPass: int32(stats.ForcedPass),
+			DurationMs: stats.Duration,
+		}
+	}
+	return message
+}
+
+// readMessage reads the message of a request, in its gRPC frame
+func readMessage(r io.Reader, message proto.Message) error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return newStatusError(codeInvalidArgument, fmt.Errorf("ftw/remote: can't read the message: %w", err))
+	}
+	if header[0] != 0 {
+		return newStatusError(codeUnimplemented, errors.New("ftw/remote: compressed messages are not supported"))
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return newStatusError(codeResourceExhausted, fmt.Errorf("ftw/remote: the message is larger than %d bytes", maxMessageSize))
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return newStatusError(codeInvalidArgument, fmt.Errorf("ftw/remote: can't read the message: %w", err))
+	}
+	if err := proto.Unmarshal(data, message); err != nil {
+		return newStatusError(codeInvalidArgument, fmt.Errorf("ftw/remote: bad message: %w", err))
+	}
+	return nil
+}
+
+// writeMessage writes a message of the response, in its gRPC frame, and flushes it
+func writeMessage(w http.ResponseWriter, message proto.Message) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	if _, err := w.Write(append(frame, data...)); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// encodeGRPCMessage percent-encodes the message of a status, as gRPC expects in its trailer
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
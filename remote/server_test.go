@@ -0,0 +1,244 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/remote/remotepb"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/service"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var yamlTests = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "942100.yaml"
+tests:
+  - test_title: "942100-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1%27%20or%201=1"
+          output:
+            log:
+              rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1"
+          output:
+            log:
+              no_rule_ids: [942100]
+`
+
+// newTestServer returns the URL of the API of a service running the tests of sqli/ with the
+// embedded WAF, whose rule matches the request of 942100-2 too, which expects it not to
+func newTestServer(t *testing.T, token string) (*service.Service, string) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx 1" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sqli"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sqli", "942100.yaml"), []byte(yamlTests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := service.New(cfg, dir, runner.Config{}, token)
+	ts := httptest.NewServer(NewServer(s).Handler())
+	t.Cleanup(ts.Close)
+	return s, ts.URL
+}
+
+// client sends the calls over HTTP/2 without TLS
+var client = &http.Client{Transport: &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network string, addr string, _ *tls.Config) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	},
+}}
+
+// call calls the method and returns the messages of the response, with its gRPC status and message
+func call(t *testing.T, url string, method string, token string, request proto.Message) ([][]byte, string, string) {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 5)
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	req, err := http.NewRequest(http.MethodPost, url+method, bytes.NewReader(append(frame, data...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages [][]byte
+	for len(body) >= 5 {
+		size := binary.BigEndian.Uint32(body[1:5])
+		messages = append(messages, body[5:5+size])
+		body = body[5+size:]
+	}
+	return messages, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+}
+
+func TestRun(t *testing.T) {
+	s, url := newTestServer(t, "")
+	go s.Run()
+	t.Cleanup(s.Close)
+
+	messages, status, message := call(t, url, submitRunPath, "", &remotepb.SubmitRunRequest{Dir: "sqli", Exclude: "942100-1", Evidence: true})
+	if status != "0" || len(messages) != 1 {
+		t.Fatalf("unexpected response %d messages, %s %s", len(messages), status, message)
+	}
+	submitted := &remotepb.SubmitRunResponse{}
+	if err := proto.Unmarshal(messages[0], submitted); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, status, _ = call(t, url, streamResultsPath, "", &remotepb.StreamResultsRequest{RunId: submitted.RunId})
+	var events []*remotepb.Event
+	for _, data := range messages {
+		event := &remotepb.Event{}
+		if err := proto.Unmarshal(data, event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if status != "0" || len(events) != 5 || events[0].Type != runner.RunStarted || events[4].Type != runner.RunFinished {
+		t.Fatalf("unexpected events %v, %s", events, status)
+	}
+	failed := events[3]
+	if failed.Test != "942100-2" || failed.Result != "failed" || failed.Status != 403 || len(failed.TriggeredRules) != 1 ||
+		failed.TriggeredRules[0] != 942100 || failed.Evidence == nil || failed.Evidence.Request == "" {
+		t.Errorf("unexpected event of the failed stage %v", failed)
+	}
+	if stats := events[4].Stats; stats == nil || stats.Run != 1 || stats.Skipped != 1 || len(stats.Failed) != 1 {
+		t.Errorf("unexpected totals %v", stats)
+	}
+
+	_, status, message = call(t, url, cancelRunPath, "", &remotepb.CancelRunRequest{RunId: submitted.RunId})
+	if status != "9" || message != service.ErrDone.Error() {
+		t.Errorf("expected a failed precondition cancelling a finished run, got %s %s", status, message)
+	}
+}
+
+func TestFailedRun(t *testing.T) {
+	// the tests send their requests to localhost:1, where nothing listens
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "942100.yaml"), []byte(yamlTests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := service.New(cfg, dir, runner.Config{ConnectTimeout: time.Second}, "")
+	go s.Run()
+	t.Cleanup(s.Close)
+	ts := httptest.NewServer(NewServer(s).Handler())
+	t.Cleanup(ts.Close)
+
+	messages, _, _ := call(t, ts.URL, submitRunPath, "", &remotepb.SubmitRunRequest{Dir: "."})
+	submitted := &remotepb.SubmitRunResponse{}
+	if err := proto.Unmarshal(messages[0], submitted); err != nil {
+		t.Fatal(err)
+	}
+	messages, status, message := call(t, ts.URL, streamResultsPath, "", &remotepb.StreamResultsRequest{RunId: submitted.RunId})
+	if status != "10" || !strings.Contains(message, "can't connect to destination") || len(messages) == 0 {
+		t.Errorf("expected the run to be aborted, got %d events, %s %s", len(messages), status, message)
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	_, url := newTestServer(t, "")
+	messages, _, _ := call(t, url, submitRunPath, "", &remotepb.SubmitRunRequest{Dir: "sqli"})
+	submitted := &remotepb.SubmitRunResponse{}
+	if err := proto.Unmarshal(messages[0], submitted); err != nil {
+		t.Fatal(err)
+	}
+
+	// the jobs don't run, the run is still queued
+	messages, status, _ := call(t, url, cancelRunPath, "", &remotepb.CancelRunRequest{RunId: submitted.RunId})
+	cancelled := &remotepb.CancelRunResponse{}
+	if status != "0" || len(messages) != 1 {
+		t.Fatalf("unexpected response %d messages, %s", len(messages), status)
+	}
+	if err := proto.Unmarshal(messages[0], cancelled); err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.State != service.Cancelled {
+		t.Errorf("expected the run to be cancelled, got %s", cancelled.State)
+	}
+	if messages, status, _ = call(t, url, streamResultsPath, "", &remotepb.StreamResultsRequest{RunId: submitted.RunId}); status != "0" || len(messages) != 0 {
+		t.Errorf("expected no events, got %d, %s", len(messages), status)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, url := newTestServer(t, "secret")
+	for _, c := range []struct {
+		method  string
+		token   string
+		request proto.Message
+		status  string
+	}{
+		{submitRunPath, "", &remotepb.SubmitRunRequest{Dir: "sqli"}, "16"},
+		{submitRunPath, "other", &remotepb.SubmitRunRequest{Dir: "sqli"}, "16"},
+		{submitRunPath, "secret", &remotepb.SubmitRunRequest{Dir: "../other"}, "3"},
+		{submitRunPath, "secret", &remotepb.SubmitRunRequest{Dir: "sqli", Include: "("}, "3"},
+		{streamResultsPath, "secret", &remotepb.StreamResultsRequest{RunId: "unknown"}, "5"},
+		{cancelRunPath, "secret", &remotepb.CancelRunRequest{RunId: "unknown"}, "5"},
+		{"/ftw.remote.v1.Runner/Other", "secret", &remotepb.CancelRunRequest{}, "12"},
+	} {
+		if _, status, message := call(t, url, c.method, c.token, c.request); status != c.status {
+			t.Errorf("expected the status %s for %s with %q, got %s %s", c.status, c.method, c.token, status, message)
+		}
+	}
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	if message := encodeGRPCMessage("bad \"dir\": 100%\n"); message != `bad "dir": 100%25%0A` {
+		t.Errorf("unexpected message %q", message)
+	}
+}
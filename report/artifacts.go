@@ -0,0 +1,95 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// unsafeFileName matches the characters of the test titles not kept in the names of their folders
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WriteArtifacts writes the evidence of the failed tests of the run in dir, one folder per failed
+// test named after its title, for CI to upload them. The folder of a test has the request of its
+// failed stage as it was sent in request.raw, the response as it was received in response.raw,
+// the WAF logs between its markers in audit.log and the error sending the request in error.txt,
+// when there are. The evidence of every failed stage is in a stage-<number> folder when several
+// stages of the test failed. The stages are only written when the run kept their evidence.
+func WriteArtifacts(dir string, stats runner.TestStats) error {
+	names := make(map[string]bool)
+	for _, file := range groupByFile(stats.Stages) {
+		for _, t := range file.tests {
+			var failed []int
+			for i, stage := range t.stages {
+				if stage.Result == runner.Failed && stage.Evidence != nil {
+					failed = append(failed, i)
+				}
+			}
+			if len(failed) == 0 {
+				continue
+			}
+			testDir := filepath.Join(dir, artifactName(t.title, names))
+			for _, i := range failed {
+				stageDir := testDir
+				if len(failed) > 1 {
+					stageDir = filepath.Join(testDir, "stage-"+strconv.Itoa(i+1))
+				}
+				if err := writeEvidence(stageDir, t.stages[i].Evidence); err != nil {
+					return fmt.Errorf("ftw/report: can't write the artifacts of %s: %w", t.title, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// artifactName returns the name of the folder of a test, unique among the names already taken
+func artifactName(title string, taken map[string]bool) string {
+	name := strings.Trim(unsafeFileName.ReplaceAllString(title, "_"), ".")
+	if name == "" {
+		name = "test"
+	}
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = name + "-" + strconv.Itoa(i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// writeEvidence writes the evidence of a stage in dir, skipping what the stage doesn't have
+func writeEvidence(dir string, evidence *runner.StageEvidence) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	var logs, errorText string
+	if len(evidence.Logs) > 0 {
+		logs = strings.Join(evidence.Logs, "\n") + "\n"
+	}
+	if evidence.Error != "" {
+		errorText = evidence.Error + "\n"
+	}
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"request.raw", evidence.Request},
+		{"response.raw", evidence.Response},
+		{"audit.log", logs},
+		{"error.txt", errorText},
+	}
+	for _, f := range files {
+		if f.content == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.name), []byte(f.content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+func TestWriteArtifacts(t *testing.T) {
+	evidence := &runner.StageEvidence{
+		Request:  "GET /?id=1 HTTP/1.1\r\n\r\n",
+		Response: "HTTP/1.1 403 Forbidden\r\n\r\n",
+		Logs:     []string{`[id "942100"]`, `[id "949110"]`},
+	}
+	stats := runner.TestStats{
+		Stages: []runner.StageResult{
+			{File: "942100.yaml", Test: "942100-1", Result: runner.Success},
+			{File: "942100.yaml", Test: "942100-2", Result: runner.Failed, Evidence: evidence},
+			{File: "920100.yaml", Test: "920100 1/a", Result: runner.Failed, Evidence: &runner.StageEvidence{Error: "connection refused"}},
+			{File: "920100.yaml", Test: "920100 1/a", Result: runner.Failed, Evidence: evidence},
+			{File: "920100.yaml", Test: "920100-2", Result: runner.ForceFail},
+			{File: "other.yaml", Test: "942100-2", Result: runner.Failed, Evidence: evidence},
+		},
+	}
+	dir := t.TempDir()
+	if err := WriteArtifacts(dir, stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"942100-2/request.raw":         evidence.Request,
+		"942100-2/response.raw":        evidence.Response,
+		"942100-2/audit.log":           "[id \"942100\"]\n[id \"949110\"]\n",
+		"920100_1_a/stage-1/error.txt": "connection refused\n",
+		"920100_1_a/stage-2/audit.log": "[id \"942100\"]\n[id \"949110\"]\n",
+		"942100-2-2/request.raw":       evidence.Request,
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("expected the artifact %s: %s", name, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("unexpected content of %s: %q", name, data)
+		}
+	}
+	for _, name := range []string{"942100-1", "920100-2", "920100_1_a/stage-1/request.raw"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("expected no artifact %s", name)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package report
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// CodeQualityCheckName is the check of the issues of the code quality report
+const CodeQualityCheckName = "ftw/false-positive"
+
+// codeQualityIssue is an issue of the code quality report of GitLab, a subset of the issues of
+// Code Climate
+type codeQualityIssue struct {
+	Description string              `json:"description"`
+	CheckName   string              `json:"check_name"`
+	Fingerprint string              `json:"fingerprint"`
+	Severity    string              `json:"severity"`
+	Location    codeQualityLocation `json:"location"`
+}
+
+type codeQualityLocation struct {
+	Path  string           `json:"path"`
+	Lines codeQualityLines `json:"lines"`
+}
+
+type codeQualityLines struct {
+	Begin int `json:"begin"`
+}
+
+// WriteCodeQuality writes the false positives of the run as a GitLab code quality report, so
+// they are shown in the merge requests changing the rules. There is an issue for every rule a
+// failed test expects not to trigger with no_rule_ids, found in its logs, located at the title
+// of the test in its file. The fingerprint of the issue is the same for the same rule and test
+// in different runs, so GitLab shows which ones are new.
+func WriteCodeQuality(w io.Writer, stats runner.TestStats) error {
+	issues := []codeQualityIssue{}
+	for _, file := range groupByFile(stats.Stages) {
+		var lines map[string]int
+		for _, t := range file.tests {
+			ids := t.falsePositives()
+			if len(ids) == 0 {
+				continue
+			}
+			if lines == nil {
+				lines = titleLines(file.name)
+			}
+			line, ok := lines[t.title]
+			if !ok {
+				line = 1
+			}
+			for _, id := range ids {
+				issues = append(issues, codeQualityIssue{
+					Description: fmt.Sprintf("False positive: rule %d triggered by test %s", id, t.title),
+					CheckName:   CodeQualityCheckName,
+					Fingerprint: fingerprint(file.name, t.title, id),
+					Severity:    "major",
+					Location:    codeQualityLocation{Path: file.name, Lines: codeQualityLines{Begin: line}},
+				})
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(issues); err != nil {
+		return fmt.Errorf("ftw/report: can't write the code quality report: %w", err)
+	}
+	return nil
+}
+
+// titleLines returns the lines of the titles of the tests of a file, by title. It's empty when
+// the file can't be read.
+func titleLines(file string) map[string]int {
+	lines := make(map[string]int)
+	f, err := os.Open(file)
+	if err != nil {
+		return lines
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		_, title, found := strings.Cut(scanner.Text(), "test_title:")
+		if !found {
+			continue
+		}
+		title = strings.Trim(strings.TrimSpace(title), `"'`)
+		if _, ok := lines[title]; !ok {
+			lines[title] = n
+		}
+	}
+	return lines
+}
+
+func fingerprint(file string, title string, id int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", file, title, id)))
+	return hex.EncodeToString(sum[:16])
+}
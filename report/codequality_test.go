@@ -0,0 +1,95 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var codeQualityTestFile = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "942100.yaml"
+tests:
+  - test_title: 942100-1
+    stages:
+      - stage:
+          input:
+            uri: "/?id=1"
+          output:
+            log:
+              no_rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            uri: "/?id=2"
+          output:
+            log:
+              no_rule_ids: [942100, 942110]
+`
+
+func TestWriteCodeQuality(t *testing.T) {
+	filename, err := utils.CreateTempFileWithContent(codeQualityTestFile, "test-942100-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+	stats := runner.TestStats{
+		Stages: []runner.StageResult{
+			{File: filename, Test: "942100-1", Result: runner.Success},
+			{File: filename, Test: "942100-2", Result: runner.Failed, FalsePositives: []int{942110, 942100}},
+			{File: "missing.yaml", Test: "920100-1", Result: runner.Failed, FalsePositives: []int{920100}},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := WriteCodeQuality(&b, stats); err != nil {
+		t.Fatal(err)
+	}
+	var issues []codeQualityIssue
+	if err := json.Unmarshal(b.Bytes(), &issues); err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 3 {
+		t.Fatalf("unexpected issues\n%s", b.String())
+	}
+	first := issues[0]
+	if first.Description != "False positive: rule 942100 triggered by test 942100-2" || first.CheckName != CodeQualityCheckName ||
+		first.Severity != "major" || first.Location.Path != filename || first.Location.Lines.Begin != 15 {
+		t.Errorf("unexpected issue %+v", first)
+	}
+	if issues[1].Fingerprint == first.Fingerprint || len(first.Fingerprint) != 32 {
+		t.Errorf("the issues must have different fingerprints, got %s and %s", first.Fingerprint, issues[1].Fingerprint)
+	}
+	if issues[2].Location.Lines.Begin != 1 {
+		t.Errorf("issues of files that can't be read are on the first line, got %+v", issues[2])
+	}
+
+	b.Reset()
+	if err := WriteCodeQuality(&b, stats); err != nil {
+		t.Fatal(err)
+	}
+	var again []codeQualityIssue
+	if err := json.Unmarshal(b.Bytes(), &again); err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Fingerprint != first.Fingerprint {
+		t.Error("the fingerprints must be the same in every run")
+	}
+}
+
+func TestWriteCodeQualityEmpty(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteCodeQuality(&b, runner.TestStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "[]\n" {
+		t.Errorf("GitLab expects an empty list without false positives, got %q", b.String())
+	}
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// csvHeader are the columns of the CSV report
+var csvHeader = []string{"test", "file", "stage", "result", "status", "rtt_ms", "stage_time_ms", "rule_ids"}
+
+// WriteCSV writes the results of the stages of the run as CSV, one row per stage, for
+// spreadsheets and BI tools. The stages are numbered from 1 in their test, and the IDs of the
+// rules found in their logs are separated by spaces. The status and the times are empty for the
+// stages without response or that didn't run.
+func WriteCSV(w io.Writer, stats runner.TestStats) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return fmt.Errorf("ftw/report: can't write the CSV report: %w", err)
+	}
+	for _, file := range groupByFile(stats.Stages) {
+		for _, t := range file.tests {
+			for i, stage := range t.stages {
+				record := []string{
+					t.title,
+					file.name,
+					strconv.Itoa(i + 1),
+					stage.Result.String(),
+					"",
+					formatMilliseconds(stage.RoundTripTime),
+					formatMilliseconds(stage.Duration),
+					joinIDs(stage.TriggeredRules, " "),
+				}
+				if stage.StatusCode != 0 {
+					record[4] = strconv.Itoa(stage.StatusCode)
+				}
+				if err := writer.Write(record); err != nil {
+					return fmt.Errorf("ftw/report: can't write the CSV report: %w", err)
+				}
+			}
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("ftw/report: can't write the CSV report: %w", err)
+	}
+	return nil
+}
+
+// formatMilliseconds returns the duration in milliseconds, or an empty string without duration
+func formatMilliseconds(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
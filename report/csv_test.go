@@ -0,0 +1,40 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+func TestWriteCSV(t *testing.T) {
+	stats := runner.TestStats{
+		Stages: []runner.StageResult{
+			{File: "942100.yaml", Test: "942100-1", Result: runner.Success, StatusCode: 403, RoundTripTime: 1500 * time.Microsecond, Duration: 12 * time.Millisecond, TriggeredRules: []int{942100, 949110}},
+			{File: "942100.yaml", Test: "942100-1", Result: runner.Failed, StatusCode: 200, RoundTripTime: time.Millisecond, Duration: 2 * time.Millisecond, TriggeredRules: []int{}},
+			{File: "920100.yaml", Test: "920100-1", Result: runner.Skipped},
+			{File: "920100.yaml", Test: "920100-2", Result: runner.Success, Duration: 3 * time.Millisecond},
+		},
+	}
+	var b bytes.Buffer
+	if err := WriteCSV(&b, stats); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"test", "file", "stage", "result", "status", "rtt_ms", "stage_time_ms", "rule_ids"},
+		{"942100-1", "942100.yaml", "1", "passed", "403", "1.500", "12.000", "942100 949110"},
+		{"942100-1", "942100.yaml", "2", "failed", "200", "1.000", "2.000", ""},
+		{"920100-1", "920100.yaml", "1", "skipped", "", "", "", ""},
+		{"920100-2", "920100.yaml", "1", "passed", "", "", "3.000", ""},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected records %q", records)
+	}
+}
@@ -0,0 +1,93 @@
+package report
+
+import (
+	"math"
+	"sort"
+)
+
+// Diff is the difference between the results of two runs of the same tests, like the runs of
+// the rules of two versions, or of two nights
+type Diff struct {
+	// NewFailures are the tests failing in the new run that didn't fail in the old one, including
+	// the tests that are new
+	NewFailures []TestResult `json:"new_failures"`
+	// NewPasses are the tests passing in the new run that failed in the old one
+	NewPasses []TestResult `json:"new_passes"`
+	// Added are the tests of the new run only, and Removed the tests of the old run only
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	// TimeDeltas are the changes of the time of the tests that ran in both runs, the largest
+	// first. The tests that took the same time are left out.
+	TimeDeltas []TimeDelta `json:"time_deltas"`
+	// OldTime and NewTime are the times spent running the tests, in seconds
+	OldTime float64 `json:"old_time"`
+	NewTime float64 `json:"new_time"`
+}
+
+// TimeDelta is the change of the time spent running a test, in seconds
+type TimeDelta struct {
+	Test    string  `json:"test"`
+	OldTime float64 `json:"old_time"`
+	NewTime float64 `json:"new_time"`
+	Delta   float64 `json:"delta"`
+}
+
+// Regressed returns true when tests fail in the new run that didn't fail in the old one
+func (d Diff) Regressed() bool {
+	return len(d.NewFailures) > 0
+}
+
+// Compare returns the difference between the results of the previous run and the current one. The tests are
+// matched by title, and are listed in the order of the new run, or of the old run for the
+// removed ones.
+func Compare(previous Results, current Results) Diff {
+	diff := Diff{
+		NewFailures: []TestResult{},
+		NewPasses:   []TestResult{},
+		Added:       []string{},
+		Removed:     []string{},
+		TimeDeltas:  []TimeDelta{},
+		OldTime:     previous.Time,
+		NewTime:     current.Time,
+	}
+	oldTests := make(map[string]TestResult)
+	for _, t := range previous.Tests {
+		oldTests[t.Test] = t
+	}
+	newTests := make(map[string]bool)
+	for _, t := range current.Tests {
+		newTests[t.Test] = true
+		before, found := oldTests[t.Test]
+		if !found {
+			diff.Added = append(diff.Added, t.Test)
+		}
+		switch {
+		case t.Failed() && !before.Failed():
+			diff.NewFailures = append(diff.NewFailures, t)
+		case t.Passed() && before.Failed():
+			diff.NewPasses = append(diff.NewPasses, t)
+		}
+		if found && ran(before) && ran(t) && t.Time != before.Time {
+			diff.TimeDeltas = append(diff.TimeDeltas, TimeDelta{
+				Test:    t.Test,
+				OldTime: before.Time,
+				NewTime: t.Time,
+				Delta:   t.Time - before.Time,
+			})
+		}
+	}
+	for _, t := range previous.Tests {
+		if !newTests[t.Test] {
+			diff.Removed = append(diff.Removed, t.Test)
+		}
+	}
+	sort.SliceStable(diff.TimeDeltas, func(i, j int) bool {
+		return math.Abs(diff.TimeDeltas[i].Delta) > math.Abs(diff.TimeDeltas[j].Delta)
+	})
+	return diff
+}
+
+// ran returns true when the stages of the test ran, instead of being skipped or overridden
+func ran(t TestResult) bool {
+	return t.Time > 0
+}
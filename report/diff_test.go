@@ -0,0 +1,66 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	previous := Results{
+		Time: 1,
+		Tests: []TestResult{
+			{Test: "942100-1", Result: "passed", Time: 0.1},
+			{Test: "942100-2", Result: "failed", Time: 0.2},
+			{Test: "942100-3", Result: "passed", Time: 0.3},
+			{Test: "920100-1", Result: "passed", Time: 0.4},
+			{Test: "920100-2", Result: "skipped"},
+		},
+	}
+	current := Results{
+		Time: 1.5,
+		Tests: []TestResult{
+			{Test: "942100-1", Result: "passed", Time: 0.15},
+			{Test: "942100-2", Result: "passed", Time: 0.2},
+			{Test: "942100-3", Result: "failed", Time: 0.9, FalsePositives: []int{942100}},
+			{Test: "920100-2", Result: "passed", Time: 0.1},
+			{Test: "920100-3", Result: "forced_fail"},
+		},
+	}
+
+	diff := Compare(previous, current)
+	if !diff.Regressed() {
+		t.Error("the new failures are regressions")
+	}
+	var titles []string
+	for _, r := range diff.NewFailures {
+		titles = append(titles, r.Test)
+	}
+	if !reflect.DeepEqual(titles, []string{"942100-3", "920100-3"}) {
+		t.Errorf("unexpected new failures %v", titles)
+	}
+	if len(diff.NewPasses) != 1 || diff.NewPasses[0].Test != "942100-2" {
+		t.Errorf("unexpected new passes %+v", diff.NewPasses)
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"920100-3"}) || !reflect.DeepEqual(diff.Removed, []string{"920100-1"}) {
+		t.Errorf("unexpected added %v and removed %v tests", diff.Added, diff.Removed)
+	}
+	titles = nil
+	for _, d := range diff.TimeDeltas {
+		titles = append(titles, d.Test)
+	}
+	// skipped tests didn't run, and the time of 942100-2 didn't change
+	if !reflect.DeepEqual(titles, []string{"942100-3", "942100-1"}) {
+		t.Errorf("unexpected time deltas %+v", diff.TimeDeltas)
+	}
+	if diff.OldTime != 1 || diff.NewTime != 1.5 {
+		t.Errorf("unexpected run times %v and %v", diff.OldTime, diff.NewTime)
+	}
+}
+
+func TestCompareSame(t *testing.T) {
+	results := Results{Tests: []TestResult{{Test: "942100-1", Result: "failed", Time: 0.1}}}
+	diff := Compare(results, results)
+	if diff.Regressed() || len(diff.NewPasses) != 0 || len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Errorf("the same results must not have differences, got %+v", diff)
+	}
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// Results are the results of a run, as written in the JSON reports
+type Results struct {
+	// Time is the time spent running the tests, in seconds
+	Time  float64      `json:"time"`
+	Tests []TestResult `json:"tests"`
+}
+
+// TestResult is the result of a test, with the results of all its stages
+type TestResult struct {
+	File string `json:"file"`
+	Test string `json:"test"`
+	// Result is the name of the result of the test, like `passed` or `failed`
+	Result string `json:"result"`
+	// Time is the time spent running the stages of the test, in seconds
+	Time float64 `json:"time"`
+	// TriggeredRules are the sorted IDs of the rules found in the logs of the stages
+	TriggeredRules []int `json:"triggered_rules,omitempty"`
+	// FalsePositives are the sorted IDs of the rules the failed stages expect not to trigger
+	// that were found in their logs
+	FalsePositives []int `json:"false_positives,omitempty"`
+	// Logs are the log lines of the failed stages of the test
+	Logs []string `json:"logs,omitempty"`
+	// Metadata is the metadata of the test, with the one of its file
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Failed returns true when the test failed or was forced to fail
+func (r TestResult) Failed() bool {
+	return r.Result == runner.Failed.String() || r.Result == runner.ForceFail.String()
+}
+
+// Passed returns true when the test passed or was forced to pass
+func (r TestResult) Passed() bool {
+	return r.Result == runner.Success.String() || r.Result == runner.ForcePass.String()
+}
+
+// NewResults returns the results of the tests of the run, in the order they ran
+func NewResults(stats runner.TestStats) Results {
+	results := Results{Tests: []TestResult{}}
+	var runTime time.Duration
+	for _, file := range groupByFile(stats.Stages) {
+		for _, t := range file.tests {
+			results.Tests = append(results.Tests, TestResult{
+				File:           file.name,
+				Test:           t.title,
+				Result:         t.result().String(),
+				Time:           t.duration().Seconds(),
+				TriggeredRules: t.triggeredRules(),
+				FalsePositives: t.falsePositives(),
+				Logs:           stats.FailedLogs[file.name][t.title],
+				Metadata:       t.metadata(),
+			})
+			runTime += t.duration()
+		}
+	}
+	results.Time = runTime.Seconds()
+	return results
+}
+
+// WriteJSON writes the results of the run as a JSON report, that can be compared with the one
+// of another run
+func WriteJSON(w io.Writer, stats runner.TestStats) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(NewResults(stats)); err != nil {
+		return fmt.Errorf("ftw/report: can't write the JSON report: %w", err)
+	}
+	return nil
+}
+
+// ReadJSON reads the results of a run from a JSON report
+func ReadJSON(r io.Reader) (Results, error) {
+	var results Results
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return results, fmt.Errorf("ftw/report: can't read the JSON report: %w", err)
+	}
+	return results, nil
+}
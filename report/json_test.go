@@ -0,0 +1,48 @@
+package report
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJSON(&b, stats); err != nil {
+		t.Fatal(err)
+	}
+	results, err := ReadJSON(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Tests) != 5 || results.Time < 0.399 || results.Time > 0.401 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	failed := results.Tests[1]
+	expected := TestResult{
+		File:           "tests/REQUEST-942/942100.yaml",
+		Test:           "942100-2",
+		Result:         "failed",
+		Time:           failed.Time,
+		TriggeredRules: []int{942100, 949110},
+		FalsePositives: []int{942100},
+		Logs:           []string{`[id "942100"] [msg "SQL Injection Attack Detected via libinjection"]`},
+		Metadata:       metadata,
+	}
+	if !reflect.DeepEqual(failed, expected) || failed.Time < 0.299 || failed.Time > 0.301 {
+		t.Errorf("unexpected result %+v", failed)
+	}
+	if !failed.Failed() || failed.Passed() || !results.Tests[0].Passed() || results.Tests[3].Passed() || results.Tests[3].Failed() {
+		t.Error("unexpected results of the tests")
+	}
+	if !results.Tests[4].Failed() {
+		t.Error("tests forced to fail are failures")
+	}
+}
+
+func TestReadJSONError(t *testing.T) {
+	if _, err := ReadJSON(strings.NewReader("<testsuites>")); err == nil {
+		t.Error("reports that are not JSON must not be read")
+	}
+}
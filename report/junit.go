@@ -0,0 +1,166 @@
+// Package report writes the results of the runs in the formats of the CI systems, like the JUnit
+// XML of the test reports and the code quality report of GitLab, and of other tools, like CSV
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite has the test cases of a file
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a test, with the results of all its stages
+type junitTestCase struct {
+	ClassName string `xml:"classname,attr"`
+	Name      string `xml:"name,attr"`
+	File      string `xml:"file,attr,omitempty"`
+	Time      string `xml:"time,attr"`
+	// Properties are the metadata of the test
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results of the run as a JUnit XML report, like the ones GitLab shows in
+// the test report of the pipelines. The files of the tests are the test suites, and their tests
+// the test cases, named after their title and classed by the name of their file, like `920100`.
+// A test fails when one of its stages fails, and is skipped when it's skipped or ignored.
+func WriteJUnit(w io.Writer, stats runner.TestStats) error {
+	suites := junitTestSuites{Name: "ftw"}
+	var runTime time.Duration
+	for _, file := range groupByFile(stats.Stages) {
+		suite := junitTestSuite{Name: file.name}
+		var suiteTime time.Duration
+		for _, t := range file.tests {
+			testCase := junitTestCase{
+				ClassName:  className(file.name),
+				Name:       t.title,
+				File:       file.name,
+				Time:       formatSeconds(t.duration()),
+				Properties: junitMetadata(t.metadata()),
+			}
+			switch result := t.result(); result {
+			case runner.Failed, runner.ForceFail:
+				testCase.Failure = &junitMessage{
+					Message: failureMessage(t, result),
+					Text:    strings.Join(stats.FailedLogs[file.name][t.title], "\n"),
+				}
+				suite.Failures++
+			case runner.Skipped, runner.Ignored:
+				testCase.Skipped = &junitMessage{Message: result.String()}
+				suite.Skipped++
+			}
+			suite.Tests++
+			suiteTime += t.duration()
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suite.Time = formatSeconds(suiteTime)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		runTime += suiteTime
+		suites.Suites = append(suites.Suites, suite)
+	}
+	suites.Time = formatSeconds(runTime)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return fmt.Errorf("ftw/report: can't write the JUnit report: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// failureMessage describes why the test failed, with the rules that it expects not to trigger
+// and that were found in the logs
+func failureMessage(t *testResults, result runner.TestResult) string {
+	if result == runner.ForceFail {
+		return "forced to fail"
+	}
+	ids := t.falsePositives()
+	if len(ids) == 0 {
+		return "failed"
+	}
+	return "failed: triggered " + joinIDs(ids, ", ")
+}
+
+// junitMetadata returns the metadata as properties, sorted by name. The values that aren't
+// strings, like lists, are written as JSON.
+func junitMetadata(metadata map[string]interface{}) *junitProperties {
+	if len(metadata) == 0 {
+		return nil
+	}
+	properties := &junitProperties{}
+	for name, value := range metadata {
+		text, ok := value.(string)
+		if !ok {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				text = fmt.Sprint(value)
+			} else {
+				text = string(encoded)
+			}
+		}
+		properties.Properties = append(properties.Properties, junitProperty{Name: name, Value: text})
+	}
+	sort.Slice(properties.Properties, func(i, j int) bool {
+		return properties.Properties[i].Name < properties.Properties[j].Name
+	})
+	return properties
+}
+
+// className returns the name of the file without directory and extension
+func className(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
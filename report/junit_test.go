@@ -0,0 +1,87 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+var metadata = map[string]interface{}{"cve": "CVE-2021-44228", "links": []interface{}{"https://example.com/1"}}
+
+var stats = runner.TestStats{
+	Stages: []runner.StageResult{
+		{File: "tests/REQUEST-942/942100.yaml", Test: "942100-1", Result: runner.Success, Duration: 100 * time.Millisecond},
+		{File: "tests/REQUEST-942/942100.yaml", Test: "942100-2", Result: runner.Success, Duration: 100 * time.Millisecond, Metadata: metadata},
+		{File: "tests/REQUEST-942/942100.yaml", Test: "942100-2", Result: runner.Failed, Duration: 200 * time.Millisecond, TriggeredRules: []int{942100, 949110}, FalsePositives: []int{942100}, Metadata: metadata},
+		{File: "tests/REQUEST-942/942100.yaml", Test: "942100-3", Result: runner.Ignored},
+		{File: "tests/REQUEST-920/920100.yaml", Test: "920100-1", Result: runner.Skipped},
+		{File: "tests/REQUEST-920/920100.yaml", Test: "920100-2", Result: runner.ForceFail},
+	},
+	FailedLogs: map[string]map[string][]string{
+		"tests/REQUEST-942/942100.yaml": {"942100-2": {`[id "942100"] [msg "SQL Injection Attack Detected via libinjection"]`}},
+		// a test of another file with the same title
+		"tests/REQUEST-920/920100.yaml": {"942100-2": {`[id "920100"]`}},
+	},
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJUnit(&b, stats); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), xml.Header) {
+		t.Errorf("the report must start with the XML header, got\n%s", b.String())
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(b.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 5 || suites.Failures != 2 || suites.Skipped != 2 || suites.Time != "0.400" || len(suites.Suites) != 2 {
+		t.Fatalf("unexpected report\n%s", b.String())
+	}
+	suite := suites.Suites[0]
+	if suite.Name != "tests/REQUEST-942/942100.yaml" || suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 {
+		t.Errorf("unexpected suite %+v", suite)
+	}
+	failed := suite.Cases[1]
+	if failed.ClassName != "942100" || failed.Name != "942100-2" || failed.Time != "0.300" || failed.Failure == nil {
+		t.Fatalf("unexpected test case %+v", failed)
+	}
+	if failed.Failure.Message != "failed: triggered 942100" || failed.Failure.Text != `[id "942100"] [msg "SQL Injection Attack Detected via libinjection"]` {
+		t.Errorf("unexpected failure %+v", failed.Failure)
+	}
+	if failed.Properties == nil || !reflect.DeepEqual(failed.Properties.Properties, []junitProperty{
+		{Name: "cve", Value: "CVE-2021-44228"},
+		{Name: "links", Value: `["https://example.com/1"]`},
+	}) {
+		t.Errorf("the metadata must be the properties of the test case, got %+v", failed.Properties)
+	}
+	if suite.Cases[0].Properties != nil {
+		t.Errorf("tests without metadata have no properties, got %+v", suite.Cases[0].Properties)
+	}
+	if suite.Cases[0].Failure != nil || suite.Cases[0].Skipped != nil {
+		t.Errorf("the test must pass, got %+v", suite.Cases[0])
+	}
+	if ignored := suite.Cases[2]; ignored.Skipped == nil || ignored.Skipped.Message != "ignored" {
+		t.Errorf("ignored tests are skipped, got %+v", ignored)
+	}
+	if forced := suites.Suites[1].Cases[1]; forced.Failure == nil || forced.Failure.Message != "forced to fail" {
+		t.Errorf("tests forced to fail are failures, got %+v", forced)
+	}
+}
+
+func TestWriteJUnitEmpty(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJUnit(&b, runner.TestStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `<testsuites name="ftw" tests="0" failures="0" skipped="0" time="0.000"></testsuites>`) {
+		t.Errorf("unexpected report\n%s", b.String())
+	}
+}
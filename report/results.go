@@ -0,0 +1,120 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreruleset/go-ftw/runner"
+)
+
+// fileResults are the results of the tests of a file, in the order they ran
+type fileResults struct {
+	name  string
+	tests []*testResults
+}
+
+// testResults are the results of the stages of a test
+type testResults struct {
+	title  string
+	stages []runner.StageResult
+}
+
+// groupByFile groups the results of the stages by file and test, in the order they ran
+func groupByFile(stages []runner.StageResult) []*fileResults {
+	var files []*fileResults
+	fileIndex := make(map[string]*fileResults)
+	testIndex := make(map[string]map[string]*testResults)
+	for _, stage := range stages {
+		file, ok := fileIndex[stage.File]
+		if !ok {
+			file = &fileResults{name: stage.File}
+			fileIndex[stage.File] = file
+			testIndex[stage.File] = make(map[string]*testResults)
+			files = append(files, file)
+		}
+		t, ok := testIndex[stage.File][stage.Test]
+		if !ok {
+			t = &testResults{title: stage.Test}
+			testIndex[stage.File][stage.Test] = t
+			file.tests = append(file.tests, t)
+		}
+		t.stages = append(t.stages, stage)
+	}
+	return files
+}
+
+// result returns the result of the test: failed when one of its stages failed or was forced to
+// fail, and otherwise the result of its stages, which are all skipped, ignored or forced to pass
+// together
+func (t *testResults) result() runner.TestResult {
+	result := runner.Success
+	for _, stage := range t.stages {
+		switch stage.Result {
+		case runner.Failed, runner.ForceFail:
+			return stage.Result
+		case runner.Skipped, runner.Ignored, runner.ForcePass:
+			result = stage.Result
+		}
+	}
+	return result
+}
+
+func (t *testResults) duration() time.Duration {
+	var d time.Duration
+	for _, stage := range t.stages {
+		d += stage.Duration
+	}
+	return d
+}
+
+// triggeredRules returns the sorted rules found in the logs of the stages
+func (t *testResults) triggeredRules() []int {
+	var ids []int
+	for _, stage := range t.stages {
+		ids = append(ids, stage.TriggeredRules...)
+	}
+	return uniqueSorted(ids)
+}
+
+// metadata returns the metadata of the test, which its stages share
+func (t *testResults) metadata() map[string]interface{} {
+	for _, stage := range t.stages {
+		if len(stage.Metadata) > 0 {
+			return stage.Metadata
+		}
+	}
+	return nil
+}
+
+// falsePositives returns the sorted rules the stages expect not to trigger that were found in
+// the logs
+func (t *testResults) falsePositives() []int {
+	var ids []int
+	for _, stage := range t.stages {
+		ids = append(ids, stage.FalsePositives...)
+	}
+	return uniqueSorted(ids)
+}
+
+// uniqueSorted sorts the IDs and removes the duplicates
+func uniqueSorted(ids []int) []int {
+	sort.Ints(ids)
+	var unique []int
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// joinIDs returns the IDs separated by the separator
+func joinIDs(ids []int, separator string) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, strconv.Itoa(id))
+	}
+	return strings.Join(names, separator)
+}
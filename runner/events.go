@@ -0,0 +1,142 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The types of the events of the lifecycle of a run
+const (
+	RunStarted    = "run_started"
+	TestStarted   = "test_started"
+	StageFinished = "stage_finished"
+	RunFinished   = "run_finished"
+)
+
+// Event is a step of the lifecycle of a run, written as a line of JSON to the events of the run.
+// The fields that don't apply to the type of the event are left out.
+type Event struct {
+	Type string    `json:"event"`
+	Time time.Time `json:"time"`
+	// Files is the number of files of tests of the run, in run_started
+	Files int `json:"files,omitempty"`
+	// File and Test are the file and the title of the test, in test_started and stage_finished
+	File string `json:"file,omitempty"`
+	Test string `json:"test,omitempty"`
+	// Stage is the number of the stage in its test, from 1, and StageID the ID of its markers
+	Stage   int    `json:"stage,omitempty"`
+	StageID string `json:"stage_id,omitempty"`
+	// Result is the name of the result of the stage, like `passed`, in stage_finished
+	Result     string `json:"result,omitempty"`
+	StatusCode int    `json:"status,omitempty"`
+	// RoundTripTime and Duration are the times of the stage, in milliseconds
+	RoundTripTime  float64 `json:"rtt_ms,omitempty"`
+	Duration       float64 `json:"duration_ms,omitempty"`
+	TriggeredRules []int   `json:"triggered_rules,omitempty"`
+	// Evidence has the request, the response and the logs of a failed stage, when the run keeps them
+	Evidence *StageEvidence `json:"evidence,omitempty"`
+	// Metadata is the metadata of the test, in stage_finished
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Stats are the statistics of the run, in run_finished
+	Stats *EventStats `json:"stats,omitempty"`
+	// Error is the error that stopped the run before all the tests ran, in run_finished
+	Error string `json:"error,omitempty"`
+}
+
+// EventStats are the statistics of the run in run_finished
+type EventStats struct {
+	Run        int      `json:"run"`
+	Passed     int      `json:"passed"`
+	Failed     []string `json:"failed"`
+	ForcedFail []string `json:"forced_fail"`
+	Skipped    int      `json:"skipped"`
+	Ignored    int      `json:"ignored"`
+	ForcedPass int      `json:"forced_pass"`
+	// Duration is the time spent running the stages, in milliseconds
+	Duration float64 `json:"duration_ms"`
+	// Interrupted is set when the run stopped before all the tests ran
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// StageResult returns the result of the stage of a stage_finished event, without its false
+// positives, which the events don't have
+func (e Event) StageResult() (StageResult, error) {
+	result, ok := ParseTestResult(e.Result)
+	if !ok {
+		return StageResult{}, fmt.Errorf("ftw/run: unknown result %q of %s", e.Result, e.Test)
+	}
+	return StageResult{
+		File:           e.File,
+		Test:           e.Test,
+		Result:         result,
+		StatusCode:     e.StatusCode,
+		RoundTripTime:  duration(e.RoundTripTime),
+		Duration:       duration(e.Duration),
+		TriggeredRules: e.TriggeredRules,
+		Evidence:       e.Evidence,
+		Metadata:       e.Metadata,
+	}, nil
+}
+
+// emitEvent writes the event to the events of the run, if they are written
+func emitEvent(runContext *TestRunContext, event Event) {
+	if runContext.Events == nil {
+		return
+	}
+	event.Time = time.Now()
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Msgf("ftw/run: can't encode the %s event", event.Type)
+		return
+	}
+	if _, err := runContext.Events.Write(append(line, '\n')); err != nil {
+		log.Error().Err(err).Msgf("ftw/run: can't write the %s event", event.Type)
+	}
+}
+
+// stageFinishedEvent returns the event of the end of the stage
+func stageFinishedEvent(stage StageResult, number int, stageID string) Event {
+	return Event{
+		Type:           StageFinished,
+		File:           stage.File,
+		Test:           stage.Test,
+		Stage:          number,
+		StageID:        stageID,
+		Result:         stage.Result.String(),
+		StatusCode:     stage.StatusCode,
+		RoundTripTime:  milliseconds(stage.RoundTripTime),
+		Duration:       milliseconds(stage.Duration),
+		TriggeredRules: stage.TriggeredRules,
+		Evidence:       stage.Evidence,
+		Metadata:       stage.Metadata,
+	}
+}
+
+// runFinishedEvent returns the event of the end of the run, with its statistics
+func runFinishedEvent(stats TestStats) Event {
+	return Event{
+		Type: RunFinished,
+		Stats: &EventStats{
+			Run:         stats.Run,
+			Passed:      stats.Success,
+			Failed:      append([]string{}, stats.Failed...),
+			ForcedFail:  append([]string{}, stats.ForcedFail...),
+			Skipped:     len(stats.Skipped),
+			Ignored:     len(stats.Ignored),
+			ForcedPass:  len(stats.ForcedPass),
+			Duration:    milliseconds(stats.RunTime),
+			Interrupted: stats.Interrupted,
+		},
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func duration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// TestListEntry describes a test case, and what would happen to it when running
+// with the current configuration
+type TestListEntry struct {
+	ID        string                 `json:"id"`
+	File      string                 `json:"file"`
+	Tags      []string               `json:"tags"`
+	Platforms []string               `json:"platforms"`
+	Author    string                 `json:"author,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Stages    int                    `json:"stages"`
+	Skipped   bool                   `json:"skipped"`
+	Reason    string                 `json:"reason,omitempty"`
+}
+
+// ListTests returns one entry per test case, using the include/exclude filters of the runner
+// Config and the overrides of the configuration, if any, to decide whether it would be skipped
+func ListTests(cfg *config.FTWConfiguration, tests []test.FTWTest, c Config) []TestListEntry {
+	var entries []TestListEntry
+
+	for i := range tests {
+		ftwTest := &tests[i]
+		for _, testCase := range ftwTest.Tests {
+			entry := TestListEntry{
+				ID:        testCase.TestTitle,
+				File:      ftwTest.FileName,
+				Tags:      ftwTest.GetTags(testCase),
+				Platforms: ftwTest.Meta.Platforms,
+				Author:    ftwTest.Meta.Author,
+				Metadata:  ftwTest.GetMetadata(testCase),
+				Stages:    len(testCase.Stages),
+			}
+			entry.Skipped, entry.Reason = skipReason(cfg, c, ftwTest, testCase.TestTitle)
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// skipReason tells whether a test would be skipped, and why. Tests forced to pass or fail
+// are not skipped, but their result is not the one of the test either.
+func skipReason(cfg *config.FTWConfiguration, c Config, ftwTest *test.FTWTest, title string) (bool, string) {
+	if !ftwTest.Meta.Enabled {
+		return true, "disabled"
+	}
+	if needToSkipTest(c.Include, c.Exclude, title, true) {
+		return true, "filtered out"
+	}
+	if cfg == nil {
+		return false, ""
+	}
+	overrides := cfg.TestOverride
+	if reason, ok := overrides.Ignore[title]; ok {
+		return true, "ignored: " + reason
+	}
+	if reason, ok := overrides.ForceFail[title]; ok {
+		return false, "forced to fail: " + reason
+	}
+	if reason, ok := overrides.ForcePass[title]; ok {
+		return false, "forced to pass: " + reason
+	}
+	return false, ""
+}
@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+var yamlListConfig = `
+---
+testoverride:
+  ignore:
+    "001": "broken on this platform"
+  forcefail:
+    "002": "known issue"
+`
+
+var yamlListTest = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  tags: ["pl1"]
+  platforms: ["nginx"]
+tests:
+  - test_title: "001"
+    stages: []
+  - test_title: "002"
+    tags: ["xss"]
+    metadata:
+      issue: "https://github.com/coreruleset/coreruleset/issues/1"
+      references:
+        cve: "CVE-2021-44228"
+    stages: []
+  - test_title: "003"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+          output:
+            status: 200
+      - stage:
+          input:
+            dest_addr: "localhost"
+          output:
+            status: 403
+  - test_title: "104"
+    stages: []
+`
+
+func TestListTests(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlListConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlListTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest.FileName = "tests/gotest-ftw.yaml"
+
+	entries := ListTests(cfg, []test.FTWTest{ftwTest}, Config{
+		Exclude: regexp.MustCompile("^1"),
+	})
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+
+	expected := []struct {
+		skipped bool
+		reason  string
+	}{
+		{true, "ignored: broken on this platform"},
+		{false, "forced to fail: known issue"},
+		{false, ""},
+		{true, "filtered out"},
+	}
+	for i, e := range expected {
+		if entries[i].Skipped != e.skipped || entries[i].Reason != e.reason {
+			t.Errorf("%s: got (%t, %q), want (%t, %q)", entries[i].ID, entries[i].Skipped, entries[i].Reason, e.skipped, e.reason)
+		}
+		if entries[i].File != "tests/gotest-ftw.yaml" {
+			t.Errorf("%s: unexpected file %s", entries[i].ID, entries[i].File)
+		}
+		if len(entries[i].Platforms) != 1 || entries[i].Platforms[0] != "nginx" {
+			t.Errorf("%s: unexpected platforms %v", entries[i].ID, entries[i].Platforms)
+		}
+	}
+	if entries[1].Stages != 0 || entries[2].Stages != 2 {
+		t.Errorf("unexpected stage counts %d, %d", entries[1].Stages, entries[2].Stages)
+	}
+	if len(entries[1].Tags) != 2 {
+		t.Errorf("expected file and test tags, got %v", entries[1].Tags)
+	}
+	if entries[1].Author != "tester" || entries[1].Metadata["issue"] != "https://github.com/coreruleset/coreruleset/issues/1" {
+		t.Errorf("unexpected metadata %s %v", entries[1].Author, entries[1].Metadata)
+	}
+	// metadata is reported as JSON, so nested values must be encodable
+	out, err := json.Marshal(entries[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"references":{"cve":"CVE-2021-44228"}`) {
+		t.Errorf("unexpected JSON %s", out)
+	}
+}
+
+func TestListDisabledTests(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlDisabledTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range ListTests(cfg, []test.FTWTest{ftwTest}, Config{}) {
+		if !entry.Skipped || entry.Reason != "disabled" {
+			t.Errorf("%s: disabled tests must be skipped", entry.ID)
+		}
+	}
+}
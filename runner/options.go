@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/metrics"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/waflog"
+)
+
+// RunnerOption follows the option pattern for the Config of a run
+type RunnerOption func(*Config)
+
+// NewConfig returns the Config of a run with the defaults, changed by the options. Using it
+// instead of a Config literal keeps the programs using go-ftw as a library working as the defaults
+// evolve.
+func NewConfig(opts ...RunnerOption) Config {
+	c := Config{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithInclude runs only the tests whose title matches the regular expression
+func WithInclude(re *regexp.Regexp) RunnerOption {
+	return func(c *Config) {
+		c.Include = re
+	}
+}
+
+// WithExclude skips the tests whose title matches the regular expression
+func WithExclude(re *regexp.Regexp) RunnerOption {
+	return func(c *Config) {
+		c.Exclude = re
+	}
+}
+
+// WithShowTime shows the time taken to run each test
+func WithShowTime(showTime bool) RunnerOption {
+	return func(c *Config) {
+		c.ShowTime = showTime
+	}
+}
+
+// WithQuiet doesn't output the informational messages
+func WithQuiet(quiet bool) RunnerOption {
+	return func(c *Config) {
+		c.Quiet = quiet
+	}
+}
+
+// WithConnectTimeout sets the timeout for connecting to the endpoints, when the run creates its
+// client
+func WithConnectTimeout(timeout time.Duration) RunnerOption {
+	return func(c *Config) {
+		c.ConnectTimeout = timeout
+	}
+}
+
+// WithReadTimeout sets the timeout for receiving the responses, when the run creates its client
+func WithReadTimeout(timeout time.Duration) RunnerOption {
+	return func(c *Config) {
+		c.ReadTimeout = timeout
+	}
+}
+
+// WithMaxBodySize sets the maximum number of bytes read from the response bodies, when the run
+// creates its client. A size of 0 means no limit.
+func WithMaxBodySize(size int64) RunnerOption {
+	return func(c *Config) {
+		c.MaxBodySize = &size
+	}
+}
+
+// WithBodyTimeout sets the timeout for reading the response bodies, when the run creates its client
+func WithBodyTimeout(timeout time.Duration) RunnerOption {
+	return func(c *Config) {
+		c.BodyTimeout = timeout
+	}
+}
+
+// WithDestination sends the tests whose file doesn't select a destination profile to this one
+func WithDestination(destination string) RunnerOption {
+	return func(c *Config) {
+		c.Destination = destination
+	}
+}
+
+// WithMetrics collects the results of the run in the collector
+func WithMetrics(collector *metrics.Collector) RunnerOption {
+	return func(c *Config) {
+		c.Metrics = collector
+	}
+}
+
+// WithEvents writes the events of the run to w, as lines of JSON
+func WithEvents(w io.Writer) RunnerOption {
+	return func(c *Config) {
+		c.Events = w
+	}
+}
+
+// WithEvidence keeps the request, the response and the logs of the failed stages
+func WithEvidence(evidence bool) RunnerOption {
+	return func(c *Config) {
+		c.Evidence = evidence
+	}
+}
+
+// WithContext stops the run after the current stage once ctx is done
+func WithContext(ctx context.Context) RunnerOption {
+	return func(c *Config) {
+		c.Context = ctx
+	}
+}
+
+// WithClient sends the requests of the run with the client, instead of one created with the
+// timeouts of the Config
+func WithClient(client *ftwhttp.Client) RunnerOption {
+	return func(c *Config) {
+		c.Client = client
+	}
+}
+
+// WithLogLines reads the logs of the WAF with ll, instead of reading the ones of the configuration
+func WithLogLines(ll *waflog.FTWLogLines) RunnerOption {
+	return func(c *Config) {
+		c.LogLines = ll
+	}
+}
+
+// OnTestStart calls the hook when a test starts, with its file
+func OnTestStart(hook func(file string, testCase test.Test)) RunnerOption {
+	return func(c *Config) {
+		c.OnTestStart = hook
+	}
+}
+
+// OnStageComplete calls the hook with the result of every stage, the skipped tests included
+func OnStageComplete(hook func(stage StageResult)) RunnerOption {
+	return func(c *Config) {
+		c.OnStageComplete = hook
+	}
+}
+
+// OnRunComplete calls the hook with the statistics of the run, at its end
+func OnRunComplete(hook func(stats TestStats)) RunnerOption {
+	return func(c *Config) {
+		c.OnRunComplete = hook
+	}
+}
+
+// WithPlugins calls the plugins around the stages sending a request, in their order
+func WithPlugins(plugins ...StagePlugin) RunnerOption {
+	return func(c *Config) {
+		c.Plugins = append(c.Plugins, plugins...)
+	}
+}
+
+// WithFailuresOnly prints only the failed stages, with their evidence, instead of every test
+func WithFailuresOnly(failuresOnly bool) RunnerOption {
+	return func(c *Config) {
+		c.FailuresOnly = failuresOnly
+	}
+}
+
+// WithDebugFailures prints the whole request, response and logs of the failed stages
+func WithDebugFailures(debugFailures bool) RunnerOption {
+	return func(c *Config) {
+		c.DebugFailures = debugFailures
+	}
+}
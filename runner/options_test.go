@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/utils"
+	"github.com/coreruleset/go-ftw/waflog"
+)
+
+func TestNewConfig(t *testing.T) {
+	include := regexp.MustCompile("942100")
+	c := NewConfig(WithInclude(include), WithQuiet(true), WithReadTimeout(5*time.Second), WithDestination("staging"))
+	if c.Include != include || !c.Quiet || c.ReadTimeout != 5*time.Second || c.Destination != "staging" || c.Exclude != nil {
+		t.Errorf("unexpected config %+v", c)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	tests := map[string]struct {
+		config   Config
+		expected int64
+	}{
+		"default":  {NewConfig(), ftwhttp.DefaultMaxBodySize},
+		"limit":    {NewConfig(WithMaxBodySize(100)), 100},
+		"no limit": {NewConfig(WithMaxBodySize(0)), 0},
+	}
+	for name, tt := range tests {
+		if size := clientConfig(tt.config).MaxBodySize; size != tt.expected {
+			t.Errorf("%s: expected a maximum body size of %d, got %d", name, tt.expected, size)
+		}
+	}
+}
+
+func TestRunWithClientAndLogLines(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := ftwhttp.NewClient(ftwhttp.NewClientConfig())
+	ll := waflog.NewFTWLogLines(cfg)
+	res := Run(cfg, []test.FTWTest{ftwTest}, NewConfig(WithQuiet(true), WithClient(client), WithLogLines(ll)))
+	if res.Client != client || res.LogLines != ll {
+		t.Errorf("the run must use the client and the log lines of the options")
+	}
+	if res.Stats.Run != 3 || res.Stats.TotalFailed() > 0 {
+		t.Errorf("unexpected stats %+v", res.Stats)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest.FileName = "tests/942100.yaml"
+
+	var calls []string
+	var stats TestStats
+	Run(cfg, []test.FTWTest{ftwTest}, NewConfig(
+		WithQuiet(true),
+		WithExclude(regexp.MustCompile("920100-1")),
+		OnTestStart(func(file string, testCase test.Test) {
+			calls = append(calls, "start "+file+" "+testCase.TestTitle)
+		}),
+		OnStageComplete(func(stage StageResult) {
+			calls = append(calls, fmt.Sprintf("stage %s %s", stage.Test, stage.Result))
+		}),
+		OnRunComplete(func(s TestStats) {
+			stats = s
+			calls = append(calls, "run")
+		}),
+	))
+	expected := []string{
+		"start tests/942100.yaml 942100-1",
+		"stage 942100-1 passed",
+		"start tests/942100.yaml 942100-2",
+		"stage 942100-2 passed",
+		"stage 920100-1 skipped",
+		"run",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected calls of the hooks\n%s", strings.Join(calls, "\n"))
+	}
+	if stats.Run != 2 || len(stats.Skipped) != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
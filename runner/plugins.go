@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
+
+// StagePlugin is called around the stages of the run which send a request, to change the request
+// before it's sent, like signing it, and to look at the response and the logs after, like to keep
+// them somewhere else
+type StagePlugin interface {
+	// BeforeStage is called once the request of the stage is built, before it's sent. It can
+	// change the request and the destination of the stage; an error stops the run.
+	BeforeStage(stage *StageContext) error
+	// AfterStage is called with the response, the logs and the result of the stage
+	AfterStage(stage *StageContext)
+}
+
+// StageContext is a stage sending a request, as seen by the plugins
+type StageContext struct {
+	// File is the file of the test, Test its title, Stage the number of the stage in the test,
+	// from 1, and StageID the ID of its markers
+	File    string
+	Test    string
+	Stage   int
+	StageID string
+	// Request is the request of the stage, or GRPCRequest for the gRPC stages, and Destination
+	// where it's sent
+	Request     *ftwhttp.Request
+	GRPCRequest *ftwhttp.GRPCRequest
+	Destination *ftwhttp.Destination
+	// Response is the last response of the stage, and ResponseError the error sending its request,
+	// after the stage
+	Response      *ftwhttp.Response
+	ResponseError error
+	// Logs are the log lines of the WAF for the requests of the stage, and Result its result,
+	// after the stage
+	Logs   []string
+	Result StageResult
+}
+
+// StagePluginFuncs is a StagePlugin calling its functions, if not nil
+type StagePluginFuncs struct {
+	Before func(stage *StageContext) error
+	After  func(stage *StageContext)
+}
+
+// BeforeStage calls Before, if not nil
+func (p StagePluginFuncs) BeforeStage(stage *StageContext) error {
+	if p.Before == nil {
+		return nil
+	}
+	return p.Before(stage)
+}
+
+// AfterStage calls After, if not nil
+func (p StagePluginFuncs) AfterStage(stage *StageContext) {
+	if p.After != nil {
+		p.After(stage)
+	}
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var yamlTestPlugin = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "signed.yaml"
+tests:
+  - test_title: "signed-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/"
+          output:
+            status: [200]
+`
+
+func TestPlugins(t *testing.T) {
+	// the embedded WAF refuses the requests without signature
+	rules, err := utils.CreateTempFileWithContent(`SecRule &REQUEST_HEADERS:X-Signature "@eq 0" "id:100,phase:1,deny,status:401,log,msg:'Unsigned'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestPlugin))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var after []*StageContext
+	signer := StagePluginFuncs{Before: func(stage *StageContext) error {
+		stage.Request.AddHeader("X-Signature", "signed")
+		return nil
+	}}
+	collector := StagePluginFuncs{After: func(stage *StageContext) {
+		after = append(after, stage)
+	}}
+	res := Run(cfg, []test.FTWTest{ftwTest}, NewConfig(WithQuiet(true), WithPlugins(signer, collector)))
+	if res.Stats.TotalFailed() > 0 {
+		t.Errorf("the requests must be signed by the plugin")
+	}
+	if len(after) != 1 {
+		t.Fatalf("expected the plugin to be called after 1 stage, got %d", len(after))
+	}
+	stage := after[0]
+	if stage.Test != "signed-1" || stage.Stage != 1 || stage.StageID == "" || stage.Response == nil || stage.Response.Parsed.StatusCode != 200 ||
+		stage.Result.Result != Success || stage.Destination == nil {
+		t.Errorf("unexpected stage %+v", stage)
+	}
+
+	// without the signer, the WAF logs the refused request
+	after = nil
+	res = Run(cfg, []test.FTWTest{ftwTest}, NewConfig(WithQuiet(true), WithPlugins(collector)))
+	if res.Stats.TotalFailed() != 1 || len(after) != 1 || !strings.Contains(strings.Join(after[0].Logs, "\n"), `id "100"`) {
+		t.Errorf("expected the logs of the refused request, got %v", after)
+	}
+}
@@ -1,85 +1,212 @@
 package runner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/kyokomi/emoji"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/coreruleset/go-ftw/check"
 	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/embedded"
 	"github.com/coreruleset/go-ftw/ftwhttp"
 	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/tracing"
 	"github.com/coreruleset/go-ftw/utils"
 	"github.com/coreruleset/go-ftw/waflog"
 )
 
-// Run runs your tests with the specified Config. Returns error if some test failed
-func Run(tests []test.FTWTest, c Config) TestRunContext {
+// tracer creates the spans of the run, of its files, tests and stages, and of the markers
+var tracer = tracing.Tracer("github.com/coreruleset/go-ftw/runner")
+
+// Run runs your tests with the specified configuration of ftw and Config of the runner. Runs
+// with different configurations can happen at the same time. The run stops on the errors that
+// keep the tests from running, like a destination that can't be reached or a bad test, which is
+// the Err of the returned context.
+func Run(cfg *config.FTWConfiguration, tests []test.FTWTest, c Config) TestRunContext {
 	printUnlessQuietMode(c.Quiet, ":rocket:Running go-ftw!\n")
 
-	logLines := waflog.NewFTWLogLines(waflog.WithLogFile(config.FTWConfig.LogFile))
+	if _, ok := cfg.Destinations[c.Destination]; c.Destination != "" && !ok {
+		return TestRunContext{Err: fmt.Errorf("ftw/run: unknown destination %q, add it to the destinations of the configuration", c.Destination)}
+	}
 
-	conf := ftwhttp.NewClientConfig()
-	if c.ConnectTimeout != 0 {
-		conf.ConnectTimeout = c.ConnectTimeout
+	logLines := c.LogLines
+	if logLines == nil {
+		logLines = waflog.NewFTWLogLines(cfg)
+		defer cleanLogs(logLines)
 	}
-	if c.ReadTimeout != 0 {
-		conf.ReadTimeout = c.ReadTimeout
+	if cfg.LogMarkerWatch && cfg.RunMode == config.DefaultRunMode && !logLines.QueriesRequests() && !logLines.CanWatch() {
+		log.Info().Msgf("ftw/run: the log source can't be watched, markers are found by sending requests")
+	}
+	if err := logLines.Checkpoint(); err != nil {
+		log.Error().Err(err).Msgf("ftw/run: the whole log file will be read")
+	}
+
+	client := c.Client
+	if client == nil {
+		client = newClient(c)
 	}
-	client := ftwhttp.NewClient(conf)
 	runContext := TestRunContext{
-		Include:  c.Include,
-		Exclude:  c.Exclude,
-		ShowTime: c.ShowTime,
-		Output:   c.Quiet,
-		Client:   client,
-		LogLines: logLines,
-		RunMode:  config.FTWConfig.RunMode,
+		Include:     c.Include,
+		Exclude:     c.Exclude,
+		ShowTime:    c.ShowTime,
+		Output:      c.Quiet,
+		Client:      client,
+		LogLines:    logLines,
+		RunMode:     cfg.RunMode,
+		Config:      cfg,
+		Destination: c.Destination,
+		Metrics:     c.Metrics,
+		Events:      c.Events,
+		Evidence:    c.Evidence,
+		ctx:         c.Context,
+
+		OnTestStart:     c.OnTestStart,
+		OnStageComplete: c.OnStageComplete,
+		OnRunComplete:   c.OnRunComplete,
+		Plugins:         c.Plugins,
+		FailuresOnly:    c.FailuresOnly,
+		DebugFailures:   c.DebugFailures,
+	}
+	if cfg.RunMode == config.EmbeddedRunMode {
+		engine, err := embedded.NewEngine(cfg.Embedded)
+		if err != nil {
+			runContext.Err = fmt.Errorf("ftw/run: can't start the embedded WAF: %w", err)
+			return runContext
+		}
+		runContext.Engine = engine
 	}
 
+	emitEvent(&runContext, Event{Type: RunStarted, Files: len(tests)})
+	span, endRun := startSpan(&runContext, "run", attribute.Int("ftw.files", len(tests)))
 	for _, test := range tests {
+		if runContext.stopped() {
+			break
+		}
 		RunTest(&runContext, test)
 	}
+	runContext.Stats.Interrupted = runContext.Err == nil && runContext.stopped()
+	span.SetAttributes(
+		attribute.Int("ftw.run", runContext.Stats.Run),
+		attribute.Int("ftw.failed", runContext.Stats.TotalFailed()),
+		attribute.Int("ftw.skipped", len(runContext.Stats.Skipped)),
+	)
+	if runContext.Stats.TotalFailed() > 0 {
+		span.SetStatus(codes.Error, "tests failed")
+	}
+	if runContext.Err != nil {
+		span.SetStatus(codes.Error, runContext.Err.Error())
+	}
+	endRun()
+	finished := runFinishedEvent(runContext.Stats)
+	if runContext.Err != nil {
+		finished.Error = runContext.Err.Error()
+	}
+	emitEvent(&runContext, finished)
 
-	printSummary(c.Quiet, runContext.Stats)
-
-	defer cleanLogs(logLines)
+	// the error is reported by the caller, instead of the summary of the tests not all run
+	printSummary(c.Quiet || runContext.Err != nil, runContext.Stats)
+	if c.Metrics != nil {
+		c.Metrics.Finish(time.Now())
+	}
+	if runContext.OnRunComplete != nil {
+		runContext.OnRunComplete(runContext.Stats)
+	}
 
 	return runContext
 }
 
+// newClient returns the client of the run, with the timeouts and the maximum body size of the
+// Config
+func newClient(c Config) *ftwhttp.Client {
+	return ftwhttp.NewClient(clientConfig(c))
+}
+
+// clientConfig returns the configuration of the client of the run, with the defaults of the
+// client for the values the Config doesn't set
+func clientConfig(c Config) ftwhttp.ClientConfig {
+	conf := ftwhttp.NewClientConfig()
+	if c.ConnectTimeout != 0 {
+		conf.ConnectTimeout = c.ConnectTimeout
+	}
+	if c.ReadTimeout != 0 {
+		conf.ReadTimeout = c.ReadTimeout
+	}
+	if c.MaxBodySize != nil {
+		conf.MaxBodySize = *c.MaxBodySize
+	}
+	if c.BodyTimeout != 0 {
+		conf.BodyTimeout = c.BodyTimeout
+	}
+	return conf
+}
+
 // RunTest runs an individual test.
 // runContext contains information for the current test run
 // ftwTest is the test you want to run
 func RunTest(runContext *TestRunContext, ftwTest test.FTWTest) {
 	changed := true
+	runContext.file = ftwTest.FileName
+	destination, err := destinationForTest(runContext, ftwTest)
+	if err != nil {
+		runContext.fail(err)
+		return
+	}
+	runContext.destination = destination
+	_, endFile := startSpan(runContext, "file", attribute.String("ftw.file", ftwTest.Meta.Name))
+	defer endFile()
 
 	for _, testCase := range ftwTest.Tests {
+		if runContext.stopped() {
+			return
+		}
+		runContext.metadata = ftwTest.GetMetadata(testCase)
 		// if we received a particular testid, skip until we find it
 		if needToSkipTest(runContext.Include, runContext.Exclude, testCase.TestTitle, ftwTest.Meta.Enabled) {
 			addResultToStats(Skipped, testCase.TestTitle, &runContext.Stats)
+			addStageResult(runContext, StageResult{File: ftwTest.FileName, Test: testCase.TestTitle, Result: Skipped}, "")
+			if runContext.Metrics != nil {
+				runContext.Metrics.ObserveResult(Skipped.String())
+			}
 			if !ftwTest.Meta.Enabled {
-				printUnlessQuietMode(runContext.Output, "\tskipping %s\n", testCase.TestTitle)
+				printUnlessQuietMode(runContext.Output || runContext.FailuresOnly, "\tskipping %s\n", testCase.TestTitle)
 			}
 			continue
 		}
 		// this is just for printing once the next test
 		if changed {
-			printUnlessQuietMode(runContext.Output, ":point_right:executing tests in file %s\n", ftwTest.Meta.Name)
+			printUnlessQuietMode(runContext.Output || runContext.FailuresOnly, ":point_right:executing tests in file %s\n", ftwTest.Meta.Name)
 			changed = false
 		}
 
 		// can we use goroutines here?
-		printUnlessQuietMode(runContext.Output, "\trunning %s: ", testCase.TestTitle)
+		printUnlessQuietMode(runContext.Output || runContext.FailuresOnly, "\trunning %s: ", testCase.TestTitle)
+		// the values captured by the stages are only for the stages of the same test
+		runContext.Variables = nil
+		runContext.stage = 0
+		emitEvent(runContext, Event{Type: TestStarted, File: ftwTest.FileName, Test: testCase.TestTitle})
+		if runContext.OnTestStart != nil {
+			runContext.OnTestStart(ftwTest.FileName, testCase)
+		}
+		_, endTest := startSpan(runContext, "test", attribute.String("ftw.test", testCase.TestTitle))
 		// Iterate over stages
 		for _, stage := range testCase.Stages {
-			ftwCheck := check.NewCheck(config.FTWConfig)
+			if runContext.stopped() {
+				break
+			}
+			ftwCheck := check.NewCheck(runContext.Config)
 			RunStage(runContext, ftwCheck, testCase, stage.Stage)
 		}
+		endTest()
 	}
 }
 
@@ -89,28 +216,71 @@ func RunTest(runContext *TestRunContext, ftwTest test.FTWTest) {
 // testCase is the test case the stage belongs to
 // stage is the stage you want to run
 func RunStage(runContext *TestRunContext, ftwCheck *check.FTWCheck, testCase test.Test, stage test.Stage) {
-	stageStartTime := time.Now()
 	stageID := uuid.NewString()
-	// Apply global overrides initially
+	runContext.stage++
+	span, endStage := startSpan(runContext, "stage",
+		attribute.String("ftw.test", testCase.TestTitle),
+		attribute.String("ftw.stage_id", stageID),
+	)
+	defer endStage()
+	// Send the request to the destination profile of the test, if any
 	testRequest := stage.Input
-	err := applyInputOverride(&testRequest)
+	if runContext.destination != nil {
+		if err := applyInputOverride(destinationInput(*runContext.destination), &testRequest); err != nil {
+			log.Debug().Msgf("ftw/run: problem using the destination: %s", err.Error())
+		}
+	}
+	// Apply global overrides next, and the ones scoped to the test
+	overrides, uriPrefix := inputOverrideForTest(runContext.Config.TestOverride, testCase.TestTitle)
+	err := applyInputOverride(overrides, &testRequest)
+	if err != nil {
+		log.Error().Msgf("ftw/run: problem overriding input: %s", err.Error())
+	}
+	applyURIPrefix(uriPrefix, &testRequest)
+	// Canonical expectations, like `blocked`, stand for the outputs of the platform under test
+	expectedOutput, err := outputForPlatform(runContext.Config, stage.Output)
+	if err == nil {
+		err = checkLogPatterns(expectedOutput)
+	}
 	if err != nil {
-		log.Debug().Msgf("ftw/run: problem overriding input: %s", err.Error())
+		runContext.fail(fmt.Errorf("ftw/run: bad test %s: %w", testCase.TestTitle, err))
+		return
 	}
-	expectedOutput := stage.Output
 
 	// Check sanity first
 	if checkTestSanity(testRequest) {
-		log.Fatal().Msgf("ftw/run: bad test: choose between data, encoded_request, or raw_request")
+		runContext.fail(fmt.Errorf("ftw/run: bad test %s: choose between data, data_file, data_b64, json, encoded_request, raw_request, or raw_request_b64 (grpc only works with data, data_file, data_b64, or json)", testCase.TestTitle))
+		return
 	}
 
 	// Do not even run test if result is overridden. Just use the override and display the overridden result.
 	if overridden := overriddenTestResult(ftwCheck, testCase.TestTitle); overridden != Failed {
 		addResultToStats(overridden, testCase.TestTitle, &runContext.Stats)
-		displayResult(runContext.Output, overridden, time.Duration(0), time.Duration(0))
+		addStageResult(runContext, StageResult{File: runContext.file, Test: testCase.TestTitle, Result: overridden}, stageID)
+		span.SetAttributes(attribute.String("ftw.result", overridden.String()))
+		if runContext.Metrics != nil {
+			runContext.Metrics.ObserveResult(overridden.String())
+		}
+		if runContext.FailuresOnly {
+			if overridden == ForceFail {
+				printUnlessQuietMode(runContext.Output, ":collision:%s: test forced to fail\n", testCase.TestTitle)
+			}
+		} else {
+			displayResult(runContext.Output, overridden, time.Duration(0), time.Duration(0))
+		}
 		return
 	}
 
+	// Delays are not part of the stage time
+	if stage.DelayBefore > 0 {
+		log.Debug().Msgf("ftw/run: waiting %s before sending the request", time.Duration(stage.DelayBefore))
+		if !runContext.wait(time.Duration(stage.DelayBefore)) {
+			log.Debug().Msgf("ftw/run: the run stopped before sending the request of %s", testCase.TestTitle)
+			return
+		}
+	}
+	stageStartTime := time.Now()
+
 	var req *ftwhttp.Request
 
 	// Destination is needed for an request
@@ -119,58 +289,319 @@ func RunStage(runContext *TestRunContext, ftwCheck *check.FTWCheck, testCase tes
 		Port:     testRequest.GetPort(),
 		Protocol: testRequest.GetProtocol(),
 	}
+	if d := runContext.destination; d != nil && (d.InsecureSkipVerify || d.ServerName != "") {
+		dest.TLS = &ftwhttp.TLSConfig{InsecureSkipVerify: d.InsecureSkipVerify, ServerName: d.ServerName}
+	}
 
-	if notRunningInCloudMode(ftwCheck) {
-		startMarker, err := markAndFlush(runContext, dest, stageID)
+	// the logs of some sources are queried for each request, instead of being found between markers
+	queriesRequests := notRunningInCloudMode(ftwCheck) && runContext.LogLines.QueriesRequests()
+	// in embedded mode, the WAF returns the logs of each request
+	usesMarkers := notRunningInCloudMode(ftwCheck) && !queriesRequests && runContext.Engine == nil
+	var startMarker []byte
+	if usesMarkers {
+		markerStart := time.Now()
+		startMarker, err = markAndFlush(runContext, dest, stageID)
+		runContext.Stats.MarkerTime += time.Since(markerStart)
 		if err != nil && !expectedOutput.ExpectError {
-			log.Fatal().Caller().Err(err).Msg("Failed to find start marker")
+			if !runContext.Config.TimestampFallback {
+				runContext.fail(fmt.Errorf("ftw/run: failed to find the start marker of %s: %w", testCase.TestTitle, err))
+				return
+			}
+			if !runContext.markersMissing {
+				log.Warn().Msgf("ftw/run: log markers not found, selecting the logs by their timestamps instead: %s", err)
+			}
+			runContext.markersMissing = true
 		}
+		ftwCheck.SetLogFile(runContext.LogLines.FileName)
+		ftwCheck.SetLogStartOffset(runContext.LogLines.StartOffset)
 		ftwCheck.SetStartMarker(startMarker)
 	}
+	since := time.Now()
 
-	req = getRequestFromTest(testRequest)
+	var grpcReq *ftwhttp.GRPCRequest
+	if testRequest.GRPC != nil {
+		grpcReq, err = getGRPCRequestFromTest(testRequest, runContext.Variables)
+		if err != nil {
+			runContext.fail(fmt.Errorf("ftw/run: bad test %s: cannot build grpc request: %w", testCase.TestTitle, err))
+			return
+		}
+	} else {
+		req = getRequestFromTest(testRequest, runContext.Variables)
+	}
+	var stageContext *StageContext
+	if len(runContext.Plugins) > 0 {
+		stageContext = &StageContext{
+			File:        runContext.file,
+			Test:        testCase.TestTitle,
+			Stage:       runContext.stage,
+			StageID:     stageID,
+			Request:     req,
+			GRPCRequest: grpcReq,
+			Destination: dest,
+		}
+		for _, plugin := range runContext.Plugins {
+			if err := plugin.BeforeStage(stageContext); err != nil {
+				runContext.fail(fmt.Errorf("ftw/run: a plugin failed before the stage of %s: %w", testCase.TestTitle, err))
+				return
+			}
+		}
+		req, grpcReq, dest = stageContext.Request, stageContext.GRPCRequest, stageContext.Destination
+	}
 
-	err = runContext.Client.NewConnection(*dest)
+	// With `repeat`, the same request is sent multiple times. Output is checked
+	// against the last response, and the logs of all of them.
+	var response *ftwhttp.Response
+	var responseErr error
+	var requestIDs []string
+	var requestLines [][]byte
+	for n := 0; n < stage.GetRepeat(); n++ {
+		if runContext.Engine != nil {
+			var lines [][]byte
+			response, lines, responseErr = evaluateRequest(runContext, req, grpcReq, dest)
+			requestLines = append(requestLines, lines...)
+			if responseErr != nil && !expectedOutput.ExpectError {
+				runContext.fail(fmt.Errorf("ftw/run: failed evaluating the request of %s with the embedded WAF: %w", testCase.TestTitle, responseErr))
+				return
+			}
+			continue
+		}
+		if grpcReq != nil {
+			err = runContext.Client.NewGRPCConnection(*dest)
+		} else {
+			err = runContext.Client.NewConnection(*dest)
+		}
 
-	if err != nil && !expectedOutput.ExpectError {
-		log.Fatal().Caller().Err(err).Msgf("can't connect to destination %+v", dest)
-	}
-	runContext.Client.StartTrackingTime()
+		if err != nil && !expectedOutput.ExpectError {
+			runContext.fail(fmt.Errorf("ftw/run: can't connect to destination %s:%d of %s: %w", dest.DestAddr, dest.Port, testCase.TestTitle, err))
+			return
+		}
+		runContext.Client.StartTrackingTime()
 
-	response, responseErr := runContext.Client.Do(*req)
+		if grpcReq != nil {
+			response, responseErr = runContext.Client.DoGRPCContext(runContext.spanContext(), *grpcReq)
+		} else {
+			response, responseErr = runContext.Client.DoContext(runContext.spanContext(), *req)
+		}
+		if responseErr == nil && testRequest.FollowRedirects > 0 {
+			response, responseErr = followRedirects(runContext, dest, testRequest, response)
+		}
 
-	runContext.Client.StopTrackingTime()
-	if responseErr != nil && !expectedOutput.ExpectError {
-		log.Fatal().Caller().Err(responseErr).Msgf("failed sending request to destination %+v", dest)
+		runContext.Client.StopTrackingTime()
+		if response != nil {
+			response.RoundTripTime = runContext.Client.GetRoundTripTime().RoundTripDuration()
+		}
+		if response != nil && queriesRequests {
+			if id := runContext.LogLines.RequestID(response.Parsed.Header); id != "" {
+				requestIDs = append(requestIDs, id)
+			}
+		}
+		if responseErr != nil && !expectedOutput.ExpectError {
+			runContext.fail(fmt.Errorf("ftw/run: failed sending the request of %s to destination %s:%d: %w", testCase.TestTitle, dest.DestAddr, dest.Port, responseErr))
+			return
+		}
 	}
 
-	if notRunningInCloudMode(ftwCheck) {
+	if usesMarkers {
+		until := time.Now()
+		if startMarker == nil && runContext.markersMissing {
+			// give the web server the time to write the logs of the request
+			time.Sleep(runContext.Config.ClockSkew)
+		}
+		markerStart := time.Now()
 		endMarker, err := markAndFlush(runContext, dest, stageID)
-		if err != nil && !expectedOutput.ExpectError {
-			log.Fatal().Caller().Err(err).Msg("Failed to find end marker")
-
+		runContext.Stats.MarkerTime += time.Since(markerStart)
+		if err != nil && !expectedOutput.ExpectError && !runContext.Config.TimestampFallback {
+			runContext.fail(fmt.Errorf("ftw/run: failed to find the end marker of %s: %w", testCase.TestTitle, err))
+			return
 		}
 		ftwCheck.SetEndMarker(endMarker)
+		if runContext.Config.TimestampFallback && (startMarker == nil || endMarker == nil) {
+			log.Debug().Msgf("ftw/run: selecting the logs written between %s and %s", since, until)
+			ftwCheck.SetTimeWindow(since.Add(-runContext.Config.ClockSkew), until.Add(runContext.Config.ClockSkew))
+		}
+	}
+
+	// the logs are not checked when sending the request failed
+	if queriesRequests && responseErr == nil {
+		lines, err := queryRequestLogs(runContext, requestIDs, since)
+		if err != nil {
+			runContext.fail(fmt.Errorf("ftw/run: failed to query the logs of %s: %w", testCase.TestTitle, err))
+			return
+		}
+		ftwCheck.SetRequestLogs(lines)
+	}
+	if runContext.Engine != nil && responseErr == nil {
+		ftwCheck.SetRequestLogs(requestLines)
 	}
 
 	// Set expected test output in check
 	ftwCheck.SetExpectTestOutput(&expectedOutput)
 
 	// now get the test result based on output
+	ftwCheck.SetVariables(runContext.Variables)
 	testResult := checkResult(ftwCheck, response, responseErr)
+	for name, value := range ftwCheck.Captures() {
+		if runContext.Variables == nil {
+			runContext.Variables = map[string]string{}
+		}
+		log.Debug().Msgf("ftw/run: captured %s = %q", name, value)
+		runContext.Variables[name] = value
+	}
 
-	roundTripTime := runContext.Client.GetRoundTripTime().RoundTripDuration()
+	roundTripTime := stageRoundTripTime(runContext, response)
 	stageTime := time.Since(stageStartTime)
 
 	addResultToStats(testResult, testCase.TestTitle, &runContext.Stats)
+	span.SetAttributes(
+		attribute.String("ftw.result", testResult.String()),
+		attribute.Int64("ftw.rtt_ms", roundTripTime.Milliseconds()),
+	)
+	if testResult == Failed {
+		span.SetStatus(codes.Error, "stage failed")
+	}
+	triggeredRules := ftwCheck.TriggeredRules()
+	addTriggeredRules(testCase.TestTitle, triggeredRules, &runContext.Stats)
+	stageResult := StageResult{
+		File:           runContext.file,
+		Test:           testCase.TestTitle,
+		Result:         testResult,
+		Duration:       stageTime,
+		RoundTripTime:  roundTripTime,
+		TriggeredRules: triggeredRules,
+	}
+	if response != nil {
+		stageResult.StatusCode = response.Parsed.StatusCode
+	}
+	var excerpt []string
+	if testResult == Failed {
+		stageResult.FalsePositives = falsePositives(expectedOutput, triggeredRules)
+		excerpt = ftwCheck.LogExcerpt()
+		if runContext.Evidence {
+			stageResult.Evidence = stageEvidence(req, response, responseErr, excerpt)
+		}
+	}
+	addStageResult(runContext, stageResult, stageID)
+	if stageContext != nil {
+		stageContext.Response, stageContext.ResponseError = response, responseErr
+		stageContext.Logs = ftwCheck.LogExcerpt()
+		stageContext.Result = stageResult
+		for _, plugin := range runContext.Plugins {
+			plugin.AfterStage(stageContext)
+		}
+	}
+	if testResult == Failed {
+		if len(excerpt) > 0 {
+			log.Debug().Msgf("ftw/run: logs of the failed stage:\n%s", strings.Join(excerpt, "\n"))
+		}
+		addFailedLogs(runContext.file, testCase.TestTitle, excerpt, &runContext.Stats)
+	}
 
 	runContext.Result = testResult
 
-	// show the result unless quiet was passed in the command line
-	displayResult(runContext.Output, testResult, roundTripTime, stageTime)
+	// show the result unless quiet was passed in the command line, or only the failures with
+	// their evidence
+	if !runContext.FailuresOnly {
+		displayResult(runContext.Output, testResult, roundTripTime, stageTime)
+	}
+	if testResult == Failed && !runContext.Output && (runContext.FailuresOnly || runContext.DebugFailures) {
+		evidence := stageResult.Evidence
+		if evidence == nil {
+			evidence = stageEvidence(req, response, responseErr, excerpt)
+		}
+		// the dumps of --debug-failures are complete, to reproduce the failure
+		maxLines := maxEvidenceLines
+		if runContext.DebugFailures {
+			maxLines = 0
+		}
+		printFailure(runContext.FailuresOnly, runContext.stage, stageResult, evidence, maxLines)
+	}
 
 	runContext.Stats.Run++
 	runContext.Stats.RunTime += stageTime
+	if runContext.Metrics != nil {
+		runContext.Metrics.ObserveStage(testCase.TestTitle, testResult.String(), stageTime, roundTripTime)
+	}
+
+	if stage.DelayAfter > 0 {
+		log.Debug().Msgf("ftw/run: waiting %s after the stage", time.Duration(stage.DelayAfter))
+		runContext.wait(time.Duration(stage.DelayAfter))
+	}
+}
+
+// addStageResult keeps the result of the stage for the reports of the run, and writes its event
+func addStageResult(runContext *TestRunContext, stage StageResult, stageID string) {
+	stage.Metadata = runContext.metadata
+	runContext.Stats.Stages = append(runContext.Stats.Stages, stage)
+	number := 0
+	if stageID != "" {
+		number = runContext.stage
+	}
+	emitEvent(runContext, stageFinishedEvent(stage, number, stageID))
+	if runContext.OnStageComplete != nil {
+		runContext.OnStageComplete(stage)
+	}
+}
+
+// falsePositives returns the triggered rules that the expected output forbids with no_rule_ids
+func falsePositives(expected test.Output, triggered []int) []int {
+	var ids []int
+	for _, id := range triggered {
+		if expected.Log.NoExpectIDs.Contains(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// stageEvidence returns the evidence of a failed stage. The request is nil for gRPC requests, and
+// the response when sending the request failed.
+func stageEvidence(req *ftwhttp.Request, response *ftwhttp.Response, responseErr error, logs []string) *StageEvidence {
+	evidence := &StageEvidence{Logs: logs}
+	if req != nil {
+		raw, err := req.Bytes()
+		if err != nil {
+			log.Debug().Msgf("ftw/run: can't keep the request of the stage: %s", err.Error())
+		}
+		evidence.Request = string(raw)
+	}
+	if response != nil {
+		evidence.Response = string(response.RAW)
+	}
+	if responseErr != nil {
+		evidence.Error = responseErr.Error()
+	}
+	return evidence
+}
+
+// evaluateRequest evaluates the request of the stage with the embedded WAF, returning the logs
+// of the rules it matched
+func evaluateRequest(runContext *TestRunContext, req *ftwhttp.Request, grpcReq *ftwhttp.GRPCRequest, dest *ftwhttp.Destination) (*ftwhttp.Response, [][]byte, error) {
+	if grpcReq != nil {
+		return nil, nil, fmt.Errorf("ftw/run: grpc requests can't be evaluated in %s mode", config.EmbeddedRunMode)
+	}
+	_, span := tracer.Start(runContext.spanContext(), "request", trace.WithAttributes(attribute.Bool("ftw.embedded", true)))
+	defer span.End()
+	if requestLine := req.RequestLine(); requestLine != nil {
+		span.SetAttributes(attribute.String("http.target", requestLine.URI))
+	}
+	response, lines, err := runContext.Engine.Do(*req, *dest)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return response, lines, err
+}
+
+// stageRoundTripTime returns the round trip time of the last request of the stage. In embedded
+// mode, it's the time the WAF took to evaluate it.
+func stageRoundTripTime(runContext *TestRunContext, response *ftwhttp.Response) time.Duration {
+	if runContext.Engine == nil {
+		return runContext.Client.GetRoundTripTime().RoundTripDuration()
+	}
+	if response == nil {
+		return 0
+	}
+	return response.RoundTripTime
 }
 
 func markAndFlush(runContext *TestRunContext, dest *ftwhttp.Destination, stageID string) ([]byte, error) {
@@ -184,33 +615,169 @@ func markAndFlush(runContext *TestRunContext, dest *ftwhttp.Destination, stageID
 	}
 
 	headers := &ftwhttp.Header{
-		"Accept":                             "*/*",
-		"User-Agent":                         "go-ftw test agent",
-		"Host":                               "localhost",
-		config.FTWConfig.LogMarkerHeaderName: stageID,
+		{Name: "Accept", Value: "*/*"},
+		{Name: "User-Agent", Value: "go-ftw test agent"},
+		{Name: "Host", Value: "localhost"},
+		{Name: runContext.Config.LogMarkerHeaderName, Value: stageID},
 	}
 
-	req := ftwhttp.NewRequest(rline, *headers, nil, true)
+	span, endMarker := startSpan(runContext, "marker", attribute.String("ftw.stage_id", stageID))
+	defer endMarker()
+	requests := 0
+	defer func() { span.SetAttributes(attribute.Int("ftw.marker_requests", requests)) }()
 
-	// 20 is a very conservative number. The web server should flush its
-	// buffer a lot earlier but we have absolutely no control over that.
-	for range [20]int{} {
+	req := ftwhttp.NewRequest(rline, *headers, nil, true)
+	sendMarker := func() error {
+		requests++
 		err := runContext.Client.NewOrReusedConnection(*dest)
 		if err != nil {
-			return nil, fmt.Errorf("ftw/run: can't connect to destination %+v: %w", dest, err)
+			return fmt.Errorf("ftw/run: can't connect to destination %+v: %w", dest, err)
 		}
 
-		_, err = runContext.Client.Do(*req)
+		_, err = runContext.Client.DoContext(runContext.spanContext(), *req)
 		if err != nil {
-			return nil, fmt.Errorf("ftw/run: failed sending request to %+v: %w", dest, err)
+			return fmt.Errorf("ftw/run: failed sending request to %+v: %w", dest, err)
+		}
+		return nil
+	}
+
+	// with a local log file, a single request is enough: wait until the web server writes it
+	if runContext.Config.LogMarkerWatch && !runContext.markersMissing && runContext.LogLines.CanWatch() {
+		if err := sendMarker(); err != nil {
+			return nil, err
+		}
+		return runContext.LogLines.WaitForMarker(stageID, runContext.Config.LogMarkerTimeout)
+	}
+
+	// The default of 20 is a very conservative number. The web server should flush its
+	// buffer a lot earlier but we have absolutely no control over that.
+	retries := runContext.Config.MaxMarkerRetries
+	if retries <= 0 {
+		retries = config.DefaultMaxMarkerRetries
+	}
+	// once the markers were not found, don't wait for them in every stage
+	if runContext.markersMissing {
+		retries = 1
+	}
+	for i := 0; i < retries; i++ {
+		if i > 0 && runContext.Config.MarkerRetryDelay > 0 {
+			time.Sleep(runContext.Config.MarkerRetryDelay)
+		}
+		if err := sendMarker(); err != nil {
+			return nil, err
 		}
 
 		marker := runContext.LogLines.CheckLogForMarker(stageID)
 		if marker != nil {
+			if i > 0 {
+				log.Debug().Msgf("ftw/run: found log marker after %d requests", i+1)
+			}
 			return marker, nil
 		}
 	}
-	return nil, fmt.Errorf("can't find log marker. Am I reading the correct log? Log file: %s", runContext.LogLines.FileName)
+	span.SetStatus(codes.Error, "marker not found")
+	return nil, fmt.Errorf("can't find log marker after %d requests. Am I reading the correct log? Log file: %s", retries, runContext.LogLines.FileName)
+}
+
+// ErrNoMarkers is returned by CheckMarker when the logs of the WAF are queried for each request,
+// without markers
+var ErrNoMarkers = errors.New("ftw/run: the logs are queried for each request, without markers")
+
+// CheckMarker sends a marker request to the destination and looks for it in the logs of the WAF,
+// like the stages of a run do, to check the logs are the ones of the destination before running
+// the tests. The client and the log lines of the Config are used, when set.
+func CheckMarker(cfg *config.FTWConfiguration, dest ftwhttp.Destination, c Config) error {
+	logLines := c.LogLines
+	if logLines == nil {
+		logLines = waflog.NewFTWLogLines(cfg)
+		defer cleanLogs(logLines)
+	}
+	if logLines.QueriesRequests() {
+		return ErrNoMarkers
+	}
+	if err := logLines.Checkpoint(); err != nil {
+		return err
+	}
+	client := c.Client
+	if client == nil {
+		client = newClient(c)
+	}
+	runContext := &TestRunContext{
+		Client:   client,
+		LogLines: logLines,
+		RunMode:  cfg.RunMode,
+		Config:   cfg,
+		ctx:      c.Context,
+	}
+	_, err := markAndFlush(runContext, &dest, uuid.NewString())
+	return err
+}
+
+// spanContext returns the context with the span of the current level of the run
+func (runContext *TestRunContext) spanContext() context.Context {
+	if runContext.ctx == nil {
+		return context.Background()
+	}
+	return runContext.ctx
+}
+
+// stopped returns whether the context of the run is done, or the run failed, so no other stage runs
+func (runContext *TestRunContext) stopped() bool {
+	return runContext.Err != nil || runContext.spanContext().Err() != nil
+}
+
+// wait waits for the duration, unless the context of the run is done first. It returns whether
+// the whole duration was waited.
+func (runContext *TestRunContext) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-runContext.spanContext().Done():
+		return false
+	}
+}
+
+// fail stops the run on the error, the first one is kept
+func (runContext *TestRunContext) fail(err error) {
+	if runContext.Err == nil {
+		runContext.Err = err
+	}
+}
+
+// startSpan starts a span, child of the span of the current level of the run. It's the current
+// span until the returned function ends it.
+func startSpan(runContext *TestRunContext, name string, attributes ...attribute.KeyValue) (trace.Span, func()) {
+	parent := runContext.spanContext()
+	ctx, span := tracer.Start(parent, name, trace.WithAttributes(attributes...))
+	runContext.ctx = ctx
+	return span, func() {
+		span.End()
+		runContext.ctx = parent
+	}
+}
+
+// followRedirects follows up to `follow_redirects` redirects, and returns the last response received
+func followRedirects(runContext *TestRunContext, dest *ftwhttp.Destination, testRequest test.Input, response *ftwhttp.Response) (*ftwhttp.Response, error) {
+	d, uri, headers := *dest, testRequest.GetURI(), testRequest.Headers
+	for i := 0; i < testRequest.FollowRedirects && response != nil && response.IsRedirect(); i++ {
+		next, req, err := ftwhttp.NewRedirectRequest(d, uri, headers, response)
+		if err != nil {
+			return response, err
+		}
+		log.Debug().Msgf("ftw/run: following redirect to %s://%s:%d%s", next.Protocol, next.DestAddr, next.Port, req.RequestLine().URI)
+
+		// reusing the connection keeps tracking the time for the whole redirect chain
+		if err = runContext.Client.NewOrReusedConnection(*next); err != nil {
+			return nil, err
+		}
+		if response, err = runContext.Client.DoContext(runContext.spanContext(), *req); err != nil {
+			return nil, err
+		}
+		d, uri, headers = *next, req.RequestLine().URI, req.Headers()
+	}
+	return response, nil
 }
 
 func needToSkipTest(include *regexp.Regexp, exclude *regexp.Regexp, title string, enabled bool) bool {
@@ -248,9 +815,22 @@ func needToSkipTest(include *regexp.Regexp, exclude *regexp.Regexp, title string
 }
 
 func checkTestSanity(testRequest test.Input) bool {
-	return (utils.IsNotEmpty(testRequest.Data) && testRequest.EncodedRequest != "") ||
-		(utils.IsNotEmpty(testRequest.Data) && testRequest.RAWRequest != "") ||
-		(testRequest.EncodedRequest != "" && testRequest.RAWRequest != "")
+	bodies := 0
+	for _, set := range []bool{
+		utils.IsNotEmpty(testRequest.Data),
+		testRequest.DataFile != "",
+		testRequest.DataB64 != "",
+		testRequest.JSON != nil,
+		testRequest.EncodedRequest != "",
+		testRequest.RAWRequest != "",
+		testRequest.RAWRequestB64 != "",
+	} {
+		if set {
+			bodies++
+		}
+	}
+	return bodies > 1 ||
+		(testRequest.GRPC != nil && (testRequest.EncodedRequest != "" || testRequest.RAWRequest != "" || testRequest.RAWRequestB64 != ""))
 }
 
 func displayResult(quiet bool, result TestResult, roundTripTime time.Duration, stageTime time.Duration) {
@@ -270,6 +850,47 @@ func displayResult(quiet bool, result TestResult, roundTripTime time.Duration, s
 	}
 }
 
+// maxEvidenceLines is the number of lines of the request, the response and the logs printed for
+// a failed stage, unless the failures are debugged
+const maxEvidenceLines = 20
+
+// printFailure prints the evidence of a failed stage, at most maxLines lines of the request, the
+// response and the logs, or all of them when it's 0. The header names the stage when only the
+// failures are shown, as the line of the test isn't.
+func printFailure(header bool, stage int, result StageResult, evidence *StageEvidence, maxLines int) {
+	if header {
+		emoji.Printf(":collision:%s (stage %d) failed in %s (RTT %s), %s\n", result.Test, stage, result.Duration, result.RoundTripTime, result.File)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\tstatus: %d\n", result.StatusCode)
+	fmt.Fprintf(&b, "\ttriggered rules: %v\n", result.TriggeredRules)
+	if len(result.FalsePositives) > 0 {
+		fmt.Fprintf(&b, "\tfalse positives: %v\n", result.FalsePositives)
+	}
+	if evidence.Error != "" {
+		fmt.Fprintf(&b, "\terror: %s\n", evidence.Error)
+	}
+	printEvidence(&b, "request", strings.Split(strings.TrimRight(evidence.Request, "\r\n"), "\n"), maxLines)
+	printEvidence(&b, "response", strings.Split(strings.TrimRight(evidence.Response, "\r\n"), "\n"), maxLines)
+	printEvidence(&b, "logs", evidence.Logs, maxLines)
+	fmt.Print(b.String())
+}
+
+// printEvidence writes the lines indented under the name, at most maxLines of them unless it's 0
+func printEvidence(b *strings.Builder, name string, lines []string, maxLines int) {
+	if len(lines) == 0 || (len(lines) == 1 && lines[0] == "") {
+		return
+	}
+	fmt.Fprintf(b, "\t%s:\n", name)
+	for i, line := range lines {
+		if i == maxLines && maxLines > 0 {
+			fmt.Fprintf(b, "\t\t... %d more lines\n", len(lines)-i)
+			break
+		}
+		fmt.Fprintf(b, "\t\t%s\n", strings.TrimRight(line, "\r"))
+	}
+}
+
 func overriddenTestResult(c *check.FTWCheck, id string) TestResult {
 	if c.ForcedIgnore(id) {
 		return Ignored
@@ -302,29 +923,15 @@ func checkResult(c *check.FTWCheck, response *ftwhttp.Response, responseError er
 		c.SetCloudMode()
 	}
 
-	// If we didn't expect an error, check the actual response from the waf
-	if response != nil {
-		if c.AssertStatus(response.Parsed.StatusCode) {
-			return Success
-		}
-		// Check response
-		if c.AssertResponseContains(response.GetBodyAsString()) {
-			return Success
-		}
-	}
-	// Lastly, check logs
-	if c.AssertLogContains() {
-		return Success
-	}
-	// We assume that the they were already setup, for comparing
-	if c.AssertNoLogContains() {
+	// Then the assertions, the response first and lastly the logs
+	if c.Assert(response) {
 		return Success
 	}
 
 	return Failed
 }
 
-func getRequestFromTest(testRequest test.Input) *ftwhttp.Request {
+func getRequestFromTest(testRequest test.Input, vars map[string]string) *ftwhttp.Request {
 	var req *ftwhttp.Request
 	// get raw request, if anything
 	raw, err := testRequest.GetRawRequest()
@@ -342,15 +949,23 @@ func getRequestFromTest(testRequest test.Input) *ftwhttp.Request {
 			Version: testRequest.GetVersion(),
 		}
 
-		data := testRequest.ParseData()
+		data := testRequest.ParseDataWithVariables(vars)
 		// create a new request
 		req = ftwhttp.NewRequest(rline, testRequest.Headers,
 			data, !testRequest.StopMagic)
+		req.SetObsFoldHeaders(testRequest.FoldHeaders)
+		req.SetLatin1Headers(testRequest.Latin1Headers)
 
 	}
 	return req
 }
 
+func getGRPCRequestFromTest(testRequest test.Input, vars map[string]string) (*ftwhttp.GRPCRequest, error) {
+	grpc := testRequest.GRPC
+	return ftwhttp.NewGRPCRequest(grpc.DescriptorSet, grpc.Service, grpc.Method,
+		testRequest.ParseDataWithVariables(vars), testRequest.Headers)
+}
+
 // We want to have output unless we are in quiet mode
 func printUnlessQuietMode(quiet bool, format string, a ...interface{}) {
 	if !quiet {
@@ -358,9 +973,160 @@ func printUnlessQuietMode(quiet bool, format string, a ...interface{}) {
 	}
 }
 
+// destinationForTest returns the destination profile selected in the meta of the test file, or
+// the one of the run. It's nil when none is selected.
+func destinationForTest(runContext *TestRunContext, ftwTest test.FTWTest) (*config.FTWDestination, error) {
+	name := ftwTest.Meta.Destination
+	if name == "" {
+		name = runContext.Destination
+	}
+	if name == "" {
+		return nil, nil
+	}
+	destination, ok := runContext.Config.Destinations[name]
+	if !ok {
+		return nil, fmt.Errorf("ftw/run: %s: unknown destination %q, add it to the destinations of the configuration", ftwTest.FileName, name)
+	}
+	return &destination, nil
+}
+
+// destinationInput returns the destination profile as an input override. Only the values set
+// in the profile replace the ones of the test.
+func destinationInput(destination config.FTWDestination) test.Input {
+	var overrides test.Input
+	if destination.DestAddr != "" {
+		overrides.DestAddr = &destination.DestAddr
+	}
+	if destination.Port != 0 {
+		overrides.Port = (*test.Port)(&destination.Port)
+	}
+	if destination.Protocol != "" {
+		overrides.Protocol = &destination.Protocol
+	}
+	return overrides
+}
+
+// inputOverrideForTest merges the global input override with the scoped overrides matching the
+// test ID, in order. It also returns the URI prefix of the last matching scoped override setting one.
+func inputOverrideForTest(testOverride config.FTWTestOverride, testID string) (test.Input, string) {
+	overrides := testOverride.Input
+	uriPrefix := testOverride.URIPrefix
+	for _, scoped := range testOverride.Scoped {
+		matched, err := regexp.MatchString(scoped.Tests, testID)
+		if err != nil {
+			log.Error().Msgf("ftw/run: bad regular expression in scoped override: %s", err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if scoped.Input.DestAddr != nil {
+			overrides.DestAddr = scoped.Input.DestAddr
+		}
+		if scoped.Input.Port != nil {
+			overrides.Port = scoped.Input.Port
+		}
+		if scoped.Input.Protocol != nil {
+			overrides.Protocol = scoped.Input.Protocol
+		}
+		if len(scoped.Input.HeaderFiles) > 0 {
+			// header files are merged by name, without changing the ones of the global override
+			headerFiles := make(map[string]string, len(overrides.HeaderFiles)+len(scoped.Input.HeaderFiles))
+			for name, headerFile := range overrides.HeaderFiles {
+				headerFiles[name] = headerFile
+			}
+			for name, headerFile := range scoped.Input.HeaderFiles {
+				headerFiles[name] = headerFile
+			}
+			overrides.HeaderFiles = headerFiles
+		}
+		if scoped.URIPrefix != "" {
+			uriPrefix = scoped.URIPrefix
+		}
+	}
+	return overrides, uriPrefix
+}
+
+// outputForPlatform replaces the canonical expectations of the output and of the outputs it
+// combines with the outputs configured for the platform under test
+func outputForPlatform(cfg *config.FTWConfiguration, output test.Output) (test.Output, error) {
+	var err error
+	// the outputs combined are shared by the runs of the test, they are copied before changing them
+	if output.AllOf, err = outputsForPlatform(cfg, output.AllOf); err != nil {
+		return output, err
+	}
+	if output.AnyOf, err = outputsForPlatform(cfg, output.AnyOf); err != nil {
+		return output, err
+	}
+	if output.Not != nil {
+		not, err := outputForPlatform(cfg, *output.Not)
+		if err != nil {
+			return output, err
+		}
+		output.Not = &not
+	}
+
+	if output.Expect == "" {
+		return output, nil
+	}
+	platform, err := cfg.Expectation(output.Expect)
+	if err != nil {
+		return output, err
+	}
+	return output.WithExpectation(platform), nil
+}
+
+func outputsForPlatform(cfg *config.FTWConfiguration, outputs []test.Output) ([]test.Output, error) {
+	if outputs == nil {
+		return nil, nil
+	}
+	resolved := make([]test.Output, len(outputs))
+	for i, output := range outputs {
+		var err error
+		if resolved[i], err = outputForPlatform(cfg, output); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// checkLogPatterns returns the error of the first regular expression matched against the logs
+// that doesn't compile, in the output and the outputs it combines
+func checkLogPatterns(output test.Output) error {
+	patterns := append(append([]string{}, output.LogContains...), output.NoLogContains...)
+	if output.LogContainsCount != nil {
+		patterns = append(patterns, output.LogContainsCount.Pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("bad log pattern: %w", err)
+		}
+	}
+	combined := append(append([]test.Output{}, output.AllOf...), output.AnyOf...)
+	if output.Not != nil {
+		combined = append(combined, *output.Not)
+	}
+	for _, o := range combined {
+		if err := checkLogPatterns(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyURIPrefix prepends the prefix to the URI of the test. URIs in absolute form are left as
+// they are.
+func applyURIPrefix(uriPrefix string, testRequest *test.Input) {
+	uri := testRequest.GetURI()
+	if uriPrefix == "" || !strings.HasPrefix(uri, "/") {
+		return
+	}
+	uri = strings.TrimSuffix(uriPrefix, "/") + uri
+	testRequest.URI = &uri
+}
+
 // applyInputOverride will check if config had global overrides and write that into the test.
-func applyInputOverride(testRequest *test.Input) error {
-	overrides := config.FTWConfig.TestOverride.Input
+func applyInputOverride(overrides test.Input, testRequest *test.Input) error {
 	if overrides.Port != nil {
 		testRequest.Port = overrides.Port
 	}
@@ -376,6 +1142,21 @@ func applyInputOverride(testRequest *test.Input) error {
 	if overrides.Protocol != nil {
 		testRequest.Protocol = overrides.Protocol
 	}
+	if len(overrides.HeaderFiles) > 0 {
+		// the files are read for every stage, and relative to the working directory
+		secrets := test.Input{HeaderFiles: overrides.HeaderFiles}
+		if err := secrets.LoadHeaderFiles(""); err != nil {
+			return err
+		}
+		// the headers of the stage are shared by the runs of the test
+		testRequest.Headers = testRequest.Headers.Clone()
+		if testRequest.Headers == nil {
+			testRequest.Headers = ftwhttp.Header{}
+		}
+		for _, field := range secrets.Headers {
+			testRequest.Headers.Set(field.Name, field.Value)
+		}
+	}
 
 	return nil
 }
@@ -384,8 +1165,28 @@ func notRunningInCloudMode(c *check.FTWCheck) bool {
 	return !c.CloudMode()
 }
 
+// queryRequestLogs returns the logs of the requests of a stage sent since the time, queried by
+// their IDs
+func queryRequestLogs(runContext *TestRunContext, requestIDs []string, since time.Time) ([][]byte, error) {
+	if len(requestIDs) == 0 {
+		log.Warn().Msgf("ftw/run: the responses have no request ID, their logs can't be queried")
+		return nil, nil
+	}
+	until := time.Now()
+	var lines [][]byte
+	for _, id := range requestIDs {
+		found, err := runContext.LogLines.QueryRequest(id, since.Add(-runContext.Config.ClockSkew), until.Add(runContext.Config.ClockSkew))
+		if err != nil {
+			return lines, fmt.Errorf("request %s: %w", id, err)
+		}
+		log.Debug().Msgf("ftw/run: found %d log lines for request %s", len(found), id)
+		lines = append(lines, found...)
+	}
+	return lines, nil
+}
+
 func cleanLogs(logLines *waflog.FTWLogLines) {
 	if err := logLines.Cleanup(); err != nil {
-		log.Fatal().Err(err).Msg("Failed to cleanup log file")
+		log.Error().Err(err).Msg("ftw/run: failed to clean up the log file")
 	}
 }
@@ -1,19 +1,33 @@
 package runner
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/coreruleset/go-ftw/check"
 	"github.com/coreruleset/go-ftw/config"
 	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/metrics"
 	"github.com/coreruleset/go-ftw/test"
+	"github.com/coreruleset/go-ftw/utils"
 )
 
 var yamlConfig = `
@@ -251,6 +265,63 @@ tests:
               Host: "localhost"
           output:
             no_log_contains: ABCDE
+  - test_title: "202"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+	    # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Accept: "*/*"
+              Host: "localhost"
+          output:
+            log:
+              rule_ids: [920300, 949110]
+  - test_title: "203"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+	    # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Accept: "*/*"
+              Host: "localhost"
+          output:
+            log:
+              no_rule_ids: [942xxx, 941xxx]
+  - test_title: "204"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+	    # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Accept: "*/*"
+              Host: "localhost"
+          output:
+            log:
+              anomaly_score: ">= 5"
+              outbound_anomaly_score: 0
+  - test_title: "205"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+	    # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Accept: "*/*"
+              Host: "localhost"
+          output:
+            log:
+              match_count: 4
 `
 
 var yamlFailedTest = `---
@@ -276,465 +347,1970 @@ tests:
             status: [413]
 `
 
-// Error checking omitted for brevity
-func newTestServer(t *testing.T, logLines string) (destination *ftwhttp.Destination, logFilePath string) {
-	logFilePath = setUpLogFileForTestServer(t)
+var yamlTestRedirect = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Redirect Test"
+tests:
+  - test_title: "001"
+    description: "status of the redirect itself"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/redirect"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            status: [302]
+  - test_title: "002"
+    description: "status of the block page after the redirect"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/redirect"
+            follow_redirects: 2
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            status: [403]
+            response_contains: "blocked"
+`
+
+var yamlTestResponseHeaders = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Response Headers Test"
+tests:
+  - test_title: "001"
+    description: "redirect to the block page"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/redirect"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            response_headers:
+              Location: "/block-page$"
+  - test_title: "002"
+    description: "content type downgrade"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/redirect"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            response_headers:
+              Content-Type: "^application/json"
+  - test_title: "003"
+    description: "expression over the response"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/redirect"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            expr: 'status == 302 && header("location") == "/block-page" && rtt > duration("0s")'
+`
+
+var yamlTestRepeat = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Repeat Test"
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          repeat: 3
+          output:
+            status: [429]
+`
+
+var yamlTestRepeatedHeaders = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Repeated Headers Test"
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              - Host: "localhost"
+              - X-Forwarded-For: "10.0.0.1"
+              - x-forwarded-for: "127.0.0.1"
+          output:
+            status: [200]
+`
+
+var yamlTestDelay = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Delay Test"
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              Host: "localhost"
+          output:
+            status: [200]
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            port: -1
+            headers:
+              Host: "localhost"
+          output:
+            status: [429]
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            port: -1
+            headers:
+              Host: "localhost"
+          delay_before: 300ms
+          delay_after: 300ms
+          output:
+            status: [200]
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            port: -1
+            headers:
+              Host: "localhost"
+          output:
+            status: [200]
+`
+
+var yamlTestNoExpectStatus = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example False Positive Test"
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/?q=harmless"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            no_expect_status: [403, 406]
+  - test_title: "002"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/attack"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            no_expect_status: [403, 406]
+`
+
+var yamlTestMaxRTT = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Test"
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/fast"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            status: [200]
+            max_rtt_ms: 1000
+  - test_title: "002"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/slow"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            status: [200]
+            max_rtt_ms: 50
+`
+
+var yamlTestCaptures = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Test"
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            log_contains: '\[unique_id "(?P<transaction>[^"]+)"\]'
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            method: "POST"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+              Content-Type: "text/plain"
+            data: "transaction={{ .Vars.transaction }}"
+          output:
+            expr: 'body == "transaction=" + vars.transaction && vars.transaction == "X-PNFSe1VwjCgYRI9FsbHgAAAIY"'
+  - test_title: "002"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            expr: 'len(vars) == 0'
+`
+
+// Error checking omitted for brevity
+func newTestServer(t *testing.T, cfg *config.FTWConfiguration, logLines string) (destination *ftwhttp.Destination, logFilePath string) {
+	logFilePath = setUpLogFileForTestServer(t, cfg)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Hello, client"))
+
+		writeTestServerLog(t, cfg, logLines, logFilePath, r)
+	}))
+
+	// close server after test
+	t.Cleanup(ts.Close)
+
+	dest, err := ftwhttp.DestinationFromString(ts.URL)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return dest, logFilePath
+}
+
+// Error checking omitted for brevity
+func newTestServerForCloudTest(t *testing.T, responseStatus int, logLines string) (server *httptest.Server, destination *ftwhttp.Destination) {
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(responseStatus)
+		_, _ = w.Write([]byte("Hello, client"))
+	}))
+
+	// close server after test
+	t.Cleanup(server.Close)
+
+	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return server, dest
+}
+
+func setUpLogFileForTestServer(t *testing.T, cfg *config.FTWConfiguration) (logFilePath string) {
+	// log to the configured file
+	if cfg != nil && cfg.RunMode == config.DefaultRunMode {
+		logFilePath = cfg.LogFile
+	}
+	// if no file has been configured, create one and handle cleanup
+	if logFilePath == "" {
+		file, err := os.CreateTemp("", "go-ftw-test-*.log")
+		if err != nil {
+			t.Error(err)
+		}
+		logFilePath = file.Name()
+		t.Cleanup(func() {
+			os.Remove(logFilePath)
+			log.Info().Msgf("Deleting temporary file '%s'", logFilePath)
+		})
+	}
+	return logFilePath
+}
+
+func writeTestServerLog(t *testing.T, cfg *config.FTWConfiguration, logLines string, logFilePath string, r *http.Request) {
+	// write supplied log lines, emulating the output of the rule engine
+	logMessage := logLines
+	// if the request has the special test header, log the request instead
+	// this emulates the log marker rule
+	if r.Header.Get(cfg.LogMarkerHeaderName) != "" {
+		logMessage = fmt.Sprintf("request line: %s %s %s, headers: %s\n", r.Method, r.RequestURI, r.Proto, r.Header)
+	}
+	file, err := os.OpenFile(logFilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(logMessage)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func replaceDestinationInTest(ftwTest *test.FTWTest, d ftwhttp.Destination) {
+	// This function doesn't use `range` because we want to modify the struct in place.
+	// Range (and assignments in general) create copies of structs, not references.
+	// Maps, slices, etc. on the other hand, are assigned as references.
+	for testIndex := 0; testIndex < len(ftwTest.Tests); testIndex++ {
+		testCase := &ftwTest.Tests[testIndex]
+		for stageIndex := 0; stageIndex < len(testCase.Stages); stageIndex++ {
+			input := &testCase.Stages[stageIndex].Stage.Input
+
+			if *input.DestAddr == "TEST_ADDR" {
+				input.DestAddr = &d.DestAddr
+			}
+			if input.Headers.Get("Host") == "TEST_ADDR" {
+				input.Headers.Set("Host", d.DestAddr)
+			}
+			if input.Port != nil && *input.Port == -1 {
+				input.Port = (*test.Port)(&d.Port)
+			}
+		}
+	}
+}
+
+func replaceDestinationInConfiguration(cfg *config.FTWConfiguration, dest ftwhttp.Destination) {
+	replaceableAddress := "TEST_ADDR"
+	replaceablePort := test.Port(-1)
+
+	input := &cfg.TestOverride.Input
+	if input.DestAddr != nil && *input.DestAddr == replaceableAddress {
+		input.DestAddr = &dest.DestAddr
+	}
+	if input.Port != nil && *input.Port == replaceablePort {
+		input.Port = (*test.Port)(&dest.Port)
+	}
+}
+
+func TestRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	// setup test webserver (not a waf)
+	dest, logFilePath := newTestServer(t, cfg, logText)
+	cfg.LogFile = logFilePath
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTest))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	t.Run("show time and execute all", func(t *testing.T) {
+		if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+			ShowTime: true,
+			Quiet:    true,
+		}); res.Stats.TotalFailed() > 0 {
+			t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
+		}
+	})
+
+	t.Run("be verbose and execute all", func(t *testing.T) {
+		if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+			Include:  regexp.MustCompile("0*"),
+			ShowTime: true,
+		}); res.Stats.TotalFailed() > 0 {
+			t.Error("Oops, test run failed!")
+		}
+	})
+
+	t.Run("don't show time and execute all", func(t *testing.T) {
+		if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+			Include: regexp.MustCompile("0*"),
+		}); res.Stats.TotalFailed() > 0 {
+			t.Error("Oops, test run failed!")
+		}
+	})
+
+	t.Run("execute only test 008 but exclude all", func(t *testing.T) {
+		if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+			Include: regexp.MustCompile("008"),
+			Exclude: regexp.MustCompile("0*"),
+		}); res.Stats.TotalFailed() > 0 {
+			t.Error("Oops, test run failed!")
+		}
+	})
+
+	t.Run("exclude test 010", func(t *testing.T) {
+		if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+			Exclude: regexp.MustCompile("010"),
+		}); res.Stats.TotalFailed() > 0 {
+			t.Error("Oops, test run failed!")
+		}
+	})
+
+	t.Run("test exceptions 1", func(t *testing.T) {
+		if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+			Include: regexp.MustCompile("1*"),
+			Exclude: regexp.MustCompile("0*"),
+			Quiet:   true,
+		}); res.Stats.TotalFailed() > 0 {
+			t.Error("Oops, test run failed!")
+		}
+	})
+}
+
+func TestOverrideRun(t *testing.T) {
+	// setup test webserver (not a waf)
+	cfg, err := config.NewConfigFromString(yamlConfigOverride)
+	if err != nil {
+		t.Error(err)
+	}
+
+	dest, logFilePath := newTestServer(t, cfg, logText)
+
+	replaceDestinationInConfiguration(cfg, *dest)
+	cfg.LogFile = logFilePath
+
+	// replace host and port with values that can be overridden by config
+	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
+	if err != nil {
+		t.Fatalf("Failed to parse fake destination")
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestOverride))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *fakeDestination)
+
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Error("Oops, test run failed!")
+	}
+}
+
+func TestBrokenOverrideRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlBrokenConfigOverride)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	dest, logFilePath := newTestServer(t, cfg, logText)
+
+	replaceDestinationInConfiguration(cfg, *dest)
+	cfg.LogFile = logFilePath
+
+	// replace host and port with values that can be overridden by config
+	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
+	if err != nil {
+		t.Fatalf("Failed to parse fake destination")
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestOverride))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *fakeDestination)
+
+	// the test should succeed, despite the unknown override property
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Error("Oops, test run failed!")
+	}
+}
+
+func TestBrokenPortOverrideRun(t *testing.T) {
+	// TestServer initialized first to retrieve the correct port number
+	dest, logFilePath := newTestServer(t, config.NewDefaultConfig(), logText)
+
+	// replace destination port inside the yaml with the retrieved one
+	cfg, err := config.NewConfigFromString(fmt.Sprintf(yamlConfigPortOverride, dest.Port))
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	replaceDestinationInConfiguration(cfg, *dest)
+	cfg.LogFile = logFilePath
+
+	// replace host and port with values that can be overridden by config
+	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
+	if err != nil {
+		t.Fatalf("Failed to parse fake destination")
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestOverrideWithNoPort))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *fakeDestination)
+
+	// the test should succeed, despite the unknown override property
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Error("Oops, test run failed!")
+	}
+}
+
+func TestDisabledRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
+	if err != nil {
+		t.Fatalf("Failed to parse fake destination")
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlDisabledTest))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *fakeDestination)
+
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Error("Oops, test run failed!")
+	}
+}
+
+func TestLogsRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	// setup test webserver (not a waf)
+	dest, logFilePath := newTestServer(t, cfg, logText)
+	replaceDestinationInConfiguration(cfg, *dest)
+	cfg.LogFile = logFilePath
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestLogs))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	})
+	if res.Stats.TotalFailed() > 0 {
+		t.Error("Oops, test run failed!")
+	}
+	// the rules are kept for passing tests too
+	for _, testCase := range ftwTest.Tests {
+		if ids := res.Stats.TriggeredRules[testCase.TestTitle]; !reflect.DeepEqual(ids, []int{920210, 920300, 949110, 980130}) {
+			t.Errorf("%s: unexpected triggered rules %v", testCase.TestTitle, ids)
+		}
+	}
+}
+
+func TestCloudRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	ftwTestDummy, err := test.GetTestFromYaml([]byte(yamlTestLogs))
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("don't show time and execute all", func(t *testing.T) {
+		for testCaseIndex, testCaseDummy := range ftwTestDummy.Tests {
+			for stageIndex := range testCaseDummy.Stages {
+				// Read the tests for every stage so we can replace the destination
+				// in each run. The server needs to be configured for each stage
+				// individually.
+				ftwTest, err := test.GetTestFromYaml([]byte(yamlTestLogs))
+				if err != nil {
+					t.Error(err)
+				}
+				testCase := &ftwTest.Tests[testCaseIndex]
+				stage := &testCase.Stages[stageIndex].Stage
+
+				ftwCheck := check.NewCheck(cfg)
+
+				// this mirrors check.SetCloudMode()
+				responseStatus := 200
+				if len(stage.Output.LogContains) > 0 || len(stage.Output.Log.ExpectIDs) > 0 ||
+					(stage.Output.Log.AnomalyScore != nil && !stage.Output.Log.AnomalyScore.Matches(0)) ||
+					(stage.Output.Log.MatchCount != nil && !stage.Output.Log.MatchCount.Matches(0)) {
+					responseStatus = 403
+				} else if len(stage.Output.NoLogContains) > 0 || len(stage.Output.Log.NoExpectIDs) > 0 {
+					responseStatus = 405
+				}
+				server, dest := newTestServerForCloudTest(t, responseStatus, logText)
+
+				replaceDestinationInConfiguration(cfg, *dest)
+
+				replaceDestinationInTest(&ftwTest, *dest)
+				if err != nil {
+					t.Error(err)
+				}
+				runContext := TestRunContext{
+					Include:  nil,
+					Exclude:  nil,
+					ShowTime: false,
+					Output:   true,
+					Client:   ftwhttp.NewClient(ftwhttp.NewClientConfig()),
+					LogLines: nil,
+					RunMode:  cfg.RunMode,
+					Config:   cfg,
+				}
+
+				RunStage(&runContext, ftwCheck, *testCase, *stage)
+				if runContext.Stats.TotalFailed() > 0 {
+					t.Error("Oops, test run failed!")
+				}
+
+				server.Close()
+			}
+		}
+	})
+}
+
+func TestFailedTestsRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	dest, logFilePath := newTestServer(t, cfg, logText)
+	replaceDestinationInConfiguration(cfg, *dest)
+	cfg.LogFile = logFilePath
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlFailedTest))
+	if err != nil {
+		t.Error(err.Error())
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{})
+	if res.Stats.TotalFailed() != 1 {
+		t.Error("Oops, test run failed!")
+	}
+	// the logs of the failed test are kept
+	excerpt := res.Stats.FailedLogs[ftwTest.FileName]["990"]
+	if len(excerpt) != 4 || !regexp.MustCompile(`\[id "949110"\]`).MatchString(excerpt[2]) {
+		t.Errorf("unexpected log excerpt %q", excerpt)
+	}
+}
+
+func TestApplyInputOverrideSetHostFromDestAddr(t *testing.T) {
+	originalHost := "original.com"
+	overrideHost := "override.com"
+	testInput := test.Input{
+		DestAddr: &originalHost,
+	}
+	overrides := test.Input{
+		DestAddr: &overrideHost,
+	}
+
+	err := applyInputOverride(overrides, &testInput)
+	if err != nil {
+		t.Error("Failed to apply input overrides", err)
+	}
+
+	if *testInput.DestAddr != overrideHost {
+		t.Error("`dest_addr` should have been overridden")
+	}
+	if testInput.Headers == nil {
+		t.Error("Header map must exist after overriding `dest_addr`")
+	}
+
+	hostHeader := testInput.Headers.Get("Host")
+	if hostHeader == "" {
+		t.Error("Host header must be set after overriding `dest_addr`")
+	}
+	if hostHeader != overrideHost {
+		t.Error("Host header must be identical to `dest_addr` after overrding `dest_addr`")
+	}
+}
+
+var yamlConfigScopedOverride = `
+---
+testoverride:
+  input:
+    dest_addr: 'proxy'
+    port: 80
+  uriprefix: '/base'
+  scoped:
+    - tests: '^920'
+      input:
+        dest_addr: 'origin'
+      uriprefix: '/app/'
+    - tests: '-2$'
+      input:
+        port: 8080
+`
+
+func TestInputOverrideForTest(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlConfigScopedOverride)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id        string
+		destAddr  string
+		port      test.Port
+		uriPrefix string
+	}{
+		{"911100-1", "proxy", 80, "/base"},
+		{"920100-1", "origin", 80, "/app/"},
+		{"920100-2", "origin", 8080, "/app/"},
+		{"911100-2", "proxy", 8080, "/base"},
+	}
+	for _, tt := range tests {
+		overrides, uriPrefix := inputOverrideForTest(cfg.TestOverride, tt.id)
+		if *overrides.DestAddr != tt.destAddr || *overrides.Port != tt.port || uriPrefix != tt.uriPrefix {
+			t.Errorf("%s: unexpected overrides %s:%d and prefix %q", tt.id, *overrides.DestAddr, *overrides.Port, uriPrefix)
+		}
+	}
+	// the global override is not changed by the scoped ones
+	if *cfg.TestOverride.Input.DestAddr != "proxy" || *cfg.TestOverride.Input.Port != 80 {
+		t.Error("the global override must not change")
+	}
+}
+
+func TestApplyInputOverrideHeaderFiles(t *testing.T) {
+	secretFile, err := os.CreateTemp(t.TempDir(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = secretFile.WriteString("Bearer secret\n"); err != nil {
+		t.Fatal(err)
+	}
+	secretFile.Close()
+
+	cfg, err := config.NewConfigFromString(fmt.Sprintf(`---
+testoverride:
+  input:
+    header_files:
+      Authorization: 'does-not-exist'
+  scoped:
+    - tests: '^920'
+      input:
+        header_files:
+          Authorization: '%s'
+`, secretFile.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stageInput := test.Input{Headers: ftwhttp.Header{{Name: "Authorization", Value: "Bearer committed"}}}
+	overrides, _ := inputOverrideForTest(cfg.TestOverride, "920100-1")
+	testInput := stageInput
+	if err = applyInputOverride(overrides, &testInput); err != nil {
+		t.Fatal(err)
+	}
+	if auth := testInput.Headers.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("unexpected Authorization %q", auth)
+	}
+	if stageInput.Headers.Get("Authorization") != "Bearer committed" {
+		t.Error("the headers of the stage must not change")
+	}
+	if cfg.TestOverride.Input.HeaderFiles["Authorization"] != "does-not-exist" {
+		t.Error("the global override must not change")
+	}
+
+	overrides, _ = inputOverrideForTest(cfg.TestOverride, "911100-1")
+	testInput = stageInput
+	if err = applyInputOverride(overrides, &testInput); err == nil {
+		t.Error("expected error for missing header file")
+	}
+}
+
+func TestOutputForPlatform(t *testing.T) {
+	cfg, err := config.NewConfigFromString(`---
+expectations:
+  blocked:
+    status: [406]
+  allowed:
+    no_expect_status: [406]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stageOutput := test.Output{
+		Expect:      "blocked",
+		LogContains: test.PatternList{"id \"942100\""},
+		AnyOf:       []test.Output{{Expect: "allowed"}, {Status: test.StatusList{200}}},
+	}
+	output, err := outputForPlatform(cfg, stageOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !output.Status.Contains(406) || len(output.LogContains) != 1 {
+		t.Errorf("unexpected output %+v", output)
+	}
+	if !output.AnyOf[0].NoExpectStatus.Contains(406) || !output.AnyOf[1].Status.Contains(200) {
+		t.Errorf("the combined outputs must be replaced too, got %+v", output.AnyOf)
+	}
+	if stageOutput.AnyOf[0].Expect != "allowed" {
+		t.Error("the output of the stage must not change")
+	}
+
+	if _, err = outputForPlatform(cfg, test.Output{Not: &test.Output{Expect: "reset"}}); err == nil {
+		t.Error("expected error for unknown expectation")
+	}
+}
+
+func TestApplyURIPrefix(t *testing.T) {
+	uri := "/get?a=b"
+	absolute := "http://example.com/get"
+	tests := []struct {
+		prefix   string
+		uri      *string
+		expected string
+	}{
+		{"", &uri, "/get?a=b"},
+		{"/app", &uri, "/app/get?a=b"},
+		{"/app/", &uri, "/app/get?a=b"},
+		{"/app", nil, "/app/"},
+		{"/app", &absolute, "http://example.com/get"},
+	}
+	for _, tt := range tests {
+		testInput := test.Input{URI: tt.uri}
+		applyURIPrefix(tt.prefix, &testInput)
+		if testInput.GetURI() != tt.expected {
+			t.Errorf("prefix %q: expected %q, got %q", tt.prefix, tt.expected, testInput.GetURI())
+		}
+	}
+	if uri != "/get?a=b" {
+		t.Error("the URI of the test must not change")
+	}
+}
+
+func TestRedirectRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/block-page", http.StatusFound)
+		case "/block-page":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("request blocked"))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestRedirect))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
+	}
+}
+
+func TestRedirectToHTTPSRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate of the block page is self-signed, and for another host than the WAF
+	blockPage := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("request blocked"))
+	}))
+	t.Cleanup(blockPage.Close)
+	location := strings.Replace(blockPage.URL, "127.0.0.1", "localhost", 1) + "/block-page"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, location, http.StatusFound)
+	}))
+	t.Cleanup(server.Close)
+	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Destinations = map[string]config.FTWDestination{"test": {InsecureSkipVerify: true}}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestRedirect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest.Meta.Destination = "test"
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 || res.Err != nil {
+		t.Errorf("the redirect to https must accept the certificates of the destination, got %d failures, error %v", res.Stats.TotalFailed(), res.Err)
+	}
+}
+
+func TestResponseHeadersRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/block-page", http.StatusFound)
+	}))
+	t.Cleanup(server.Close)
+	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestResponseHeaders))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	})
+	if res.Stats.Success != 2 || !reflect.DeepEqual(res.Stats.Failed, []string{"002"}) {
+		t.Errorf("unexpected results: success %v, failed %v", res.Stats.Success, res.Stats.Failed)
+	}
+}
+
+var yamlTestDestination = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  destination: %s
+tests:
+  - test_title: "%s"
+    stages:
+      - stage:
+          input:
+            dest_addr: "example.com"
+            port: 1234
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            status: [%d]
+`
+
+func TestDestinationRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(origin.Close)
+	originDest, err := ftwhttp.DestinationFromString(origin.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, proxyDest := newTestServerForCloudTest(t, http.StatusForbidden, "")
+	cfg.Destinations = map[string]config.FTWDestination{
+		"origin": {DestAddr: originDest.DestAddr, Port: originDest.Port, Protocol: "https", InsecureSkipVerify: true},
+		"proxy":  {DestAddr: proxyDest.DestAddr, Port: proxyDest.Port},
+	}
+
+	// the first file selects its destination, the second one uses the one of the run
+	originTest, err := test.GetTestFromYaml([]byte(fmt.Sprintf(yamlTestDestination, "origin", "001", http.StatusOK)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyTest, err := test.GetTestFromYaml([]byte(fmt.Sprintf(yamlTestDestination, `""`, "002", http.StatusForbidden)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := Run(cfg, []test.FTWTest{originTest, proxyTest}, Config{
+		Quiet:       true,
+		Destination: "proxy",
+	})
+	if res.Stats.Success != 2 || res.Stats.TotalFailed() > 0 {
+		t.Errorf("unexpected results: success %v, failed %v", res.Stats.Success, res.Stats.Failed)
+	}
+}
+
+func TestRepeatRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	// rate limit: block from the third request on
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) >= 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestRepeat))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+}
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("Hello, client"))
+func TestRepeatedHeadersRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
 
-		writeTestServerLog(t, logLines, logFilePath, r)
+	// the WAF sees the first value, the application the last one
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values := r.Header.Values("X-Forwarded-For")
+		if len(values) != 2 || values[0] != "10.0.0.1" || values[1] != "127.0.0.1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
 	}))
+	t.Cleanup(server.Close)
+	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// close server after test
-	t.Cleanup(ts.Close)
-
-	dest, err := ftwhttp.DestinationFromString(ts.URL)
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestRepeatedHeaders))
 	if err != nil {
 		t.Error(err)
-		t.FailNow()
 	}
-	return dest, logFilePath
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
+	}
 }
 
-// Error checking omitted for brevity
-func newTestServerForCloudTest(t *testing.T, responseStatus int, logLines string) (server *httptest.Server, destination *ftwhttp.Destination) {
-	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(responseStatus)
-		_, _ = w.Write([]byte("Hello, client"))
-	}))
+func TestDelayRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
 
-	// close server after test
+	// rate limit: block requests sent less than 200ms after the previous one
+	var mutex sync.Mutex
+	var last time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now := time.Now()
+		limited := now.Sub(last) < 200*time.Millisecond
+		last = now
+		if limited {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
 	t.Cleanup(server.Close)
-
 	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestDelay))
 	if err != nil {
 		t.Error(err)
-		t.FailNow()
 	}
-	return server, dest
-}
+	replaceDestinationInTest(&ftwTest, *dest)
 
-func setUpLogFileForTestServer(t *testing.T) (logFilePath string) {
-	// log to the configured file
-	if config.FTWConfig != nil && config.FTWConfig.RunMode == config.DefaultRunMode {
-		logFilePath = config.FTWConfig.LogFile
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	})
+	if res.Stats.TotalFailed() > 0 {
+		t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
 	}
-	// if no file has been configured, create one and handle cleanup
-	if logFilePath == "" {
-		file, err := os.CreateTemp("", "go-ftw-test-*.log")
-		if err != nil {
-			t.Error(err)
-		}
-		logFilePath = file.Name()
-		t.Cleanup(func() {
-			os.Remove(logFilePath)
-			log.Info().Msgf("Deleting temporary file '%s'", logFilePath)
-		})
+	if res.Stats.RunTime >= 600*time.Millisecond {
+		t.Errorf("delays must not be counted in the run time, got %s", res.Stats.RunTime)
 	}
-	return logFilePath
 }
 
-func writeTestServerLog(t *testing.T, logLines string, logFilePath string, r *http.Request) {
-	// write supplied log lines, emulating the output of the rule engine
-	logMessage := logLines
-	// if the request has the special test header, log the request instead
-	// this emulates the log marker rule
-	if r.Header.Get(config.FTWConfig.LogMarkerHeaderName) != "" {
-		logMessage = fmt.Sprintf("request line: %s %s %s, headers: %s\n", r.Method, r.RequestURI, r.Proto, r.Header)
+func TestNoExpectStatusRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
 	}
-	file, err := os.OpenFile(logFilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/attack" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	dest, err := ftwhttp.DestinationFromString(server.URL)
 	if err != nil {
-		t.Error(err)
-		t.FailNow()
+		t.Fatal(err)
 	}
-	defer file.Close()
 
-	_, err = file.WriteString(logMessage)
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestNoExpectStatus))
 	if err != nil {
 		t.Error(err)
-		t.FailNow()
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	})
+	if res.Stats.Success != 1 {
+		t.Errorf("expected test 001 to pass, got %d successful tests", res.Stats.Success)
+	}
+	if len(res.Stats.Failed) != 1 || res.Stats.Failed[0] != "002" {
+		t.Errorf("expected test 002 to fail, got %v", res.Stats.Failed)
 	}
 }
 
-func replaceDestinationInTest(ftwTest *test.FTWTest, d ftwhttp.Destination) {
-	// This function doesn't use `range` because we want to modify the struct in place.
-	// Range (and assignments in general) create copies of structs, not references.
-	// Maps, slices, etc. on the other hand, are assigned as references.
-	for testIndex := 0; testIndex < len(ftwTest.Tests); testIndex++ {
-		testCase := &ftwTest.Tests[testIndex]
-		for stageIndex := 0; stageIndex < len(testCase.Stages); stageIndex++ {
-			input := &testCase.Stages[stageIndex].Stage.Input
+func TestLogMarkerWatchRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nlogmarkerwatch: true\nlogmarkertimeout: 5s\n")
+	if err != nil {
+		t.Error(err)
+	}
+	logFilePath := setUpLogFileForTestServer(t, cfg)
+	cfg.LogFile = logFilePath
 
-			if *input.DestAddr == "TEST_ADDR" {
-				input.DestAddr = &d.DestAddr
-			}
-			if input.Headers.Get("Host") == "TEST_ADDR" {
-				input.Headers.Set("Host", d.DestAddr)
-			}
-			if input.Port != nil && *input.Port == -1 {
-				input.Port = &d.Port
-			}
+	// the web server writes the markers a bit later, like when it buffers its logs
+	var markers int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.Header.Get(cfg.LogMarkerHeaderName) != "" {
+			atomic.AddInt32(&markers, 1)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				writeTestServerLog(t, cfg, "", logFilePath, r)
+			}()
+			return
 		}
+		writeTestServerLog(t, cfg, logText, logFilePath, r)
+	}))
+	t.Cleanup(ts.Close)
+	dest, err := ftwhttp.DestinationFromString(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestLogs))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Error("Oops, test run failed!")
+	}
+	// a single request for every marker
+	if n := atomic.LoadInt32(&markers); n != int32(2*len(ftwTest.Tests)) {
+		t.Errorf("unexpected number of marker requests %d for %d stages", n, len(ftwTest.Tests))
 	}
 }
 
-func replaceDestinationInConfiguration(dest ftwhttp.Destination) {
-	replaceableAddress := "TEST_ADDR"
-	replaceablePort := -1
+func TestCheckMarker(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmaxmarkerretries: 2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFilePath := setUpLogFileForTestServer(t, cfg)
+	cfg.LogFile = logFilePath
 
-	input := &config.FTWConfig.TestOverride.Input
-	if input.DestAddr != nil && *input.DestAddr == replaceableAddress {
-		input.DestAddr = &dest.DestAddr
+	logged := int32(1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if atomic.LoadInt32(&logged) == 1 {
+			writeTestServerLog(t, cfg, "", logFilePath, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	dest, err := ftwhttp.DestinationFromString(ts.URL)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if input.Port != nil && *input.Port == replaceablePort {
-		input.Port = &dest.Port
+
+	if err := CheckMarker(cfg, *dest, Config{}); err != nil {
+		t.Errorf("expected the marker to be found, got %s", err)
+	}
+	// a web server not writing to the log file of the configuration
+	atomic.StoreInt32(&logged, 0)
+	if err := CheckMarker(cfg, *dest, Config{}); err == nil {
+		t.Error("expected an error when the marker isn't logged")
 	}
 }
 
-func TestRun(t *testing.T) {
-	t.Cleanup(config.Reset)
+func TestMarkerRetriesRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmaxmarkerretries: 5\nmarkerretrydelay: 10ms\n")
+	if err != nil {
+		t.Error(err)
+	}
+	logFilePath := setUpLogFileForTestServer(t, cfg)
+	cfg.LogFile = logFilePath
 
-	err := config.NewConfigFromString(yamlConfig)
+	// the web server only flushes its logs every third marker request
+	var markers int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.Header.Get(cfg.LogMarkerHeaderName) != "" {
+			if atomic.AddInt32(&markers, 1)%3 != 0 {
+				return
+			}
+			writeTestServerLog(t, cfg, "", logFilePath, r)
+			return
+		}
+		writeTestServerLog(t, cfg, logText, logFilePath, r)
+	}))
+	t.Cleanup(ts.Close)
+	dest, err := ftwhttp.DestinationFromString(ts.URL)
 	if err != nil {
-		t.Errorf("Failed!")
+		t.Fatal(err)
 	}
 
-	// setup test webserver (not a waf)
-	dest, logFilePath := newTestServer(t, logText)
-	config.FTWConfig.LogFile = logFilePath
-	ftwTest, err := test.GetTestFromYaml([]byte(yamlTest))
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestLogs))
 	if err != nil {
 		t.Error(err)
 	}
 	replaceDestinationInTest(&ftwTest, *dest)
 
-	t.Run("show time and execute all", func(t *testing.T) {
-		if res := Run([]test.FTWTest{ftwTest}, Config{
-			ShowTime: true,
-			Quiet:    true,
-		}); res.Stats.TotalFailed() > 0 {
-			t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
-		}
-	})
+	start := time.Now()
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	}); res.Stats.TotalFailed() > 0 {
+		t.Error("Oops, test run failed!")
+	}
+	stages := len(ftwTest.Tests)
+	if n := atomic.LoadInt32(&markers); n != int32(6*stages) {
+		t.Errorf("unexpected number of marker requests %d for %d stages", n, stages)
+	}
+	// two delays before every marker is found
+	if elapsed := time.Since(start); elapsed < time.Duration(2*2*stages)*10*time.Millisecond {
+		t.Errorf("the retries were not delayed, the run took %s", elapsed)
+	}
+}
 
-	t.Run("be verbose and execute all", func(t *testing.T) {
-		if res := Run([]test.FTWTest{ftwTest}, Config{
-			Include:  regexp.MustCompile("0*"),
-			ShowTime: true,
-		}); res.Stats.TotalFailed() > 0 {
-			t.Error("Oops, test run failed!")
+func TestTimestampFallbackRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\ntimestampfallback: true\nclockskew: 100ms\nmaxmarkerretries: 3\n")
+	if err != nil {
+		t.Error(err)
+	}
+	logFilePath := setUpLogFileForTestServer(t, cfg)
+	cfg.LogFile = logFilePath
+	// older logs must not be selected
+	writeTestServerLog(t, cfg, "[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76] ABCDE\n", logFilePath, &http.Request{})
+
+	// a proxy in front of the web server strips the marker header
+	var markers int32
+	timestamps := regexp.MustCompile(`\[\w{3} \w{3} \d{2} \d{2}:\d{2}:\d{2}\.\d+ \d{4}\]`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if r.Header.Get(cfg.LogMarkerHeaderName) != "" {
+			atomic.AddInt32(&markers, 1)
+			return
 		}
-	})
+		now := "[" + time.Now().Format("Mon Jan 02 15:04:05.000000 2006") + "]"
+		writeTestServerLog(t, cfg, timestamps.ReplaceAllString(logText, now), logFilePath, r)
+	}))
+	t.Cleanup(ts.Close)
+	dest, err := ftwhttp.DestinationFromString(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	t.Run("don't show time and execute all", func(t *testing.T) {
-		if res := Run([]test.FTWTest{ftwTest}, Config{
-			Include: regexp.MustCompile("0*"),
-		}); res.Stats.TotalFailed() > 0 {
-			t.Error("Oops, test run failed!")
-		}
-	})
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestLogs))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
 
-	t.Run("execute only test 008 but exclude all", func(t *testing.T) {
-		if res := Run([]test.FTWTest{ftwTest}, Config{
-			Include: regexp.MustCompile("008"),
-			Exclude: regexp.MustCompile("0*"),
-		}); res.Stats.TotalFailed() > 0 {
-			t.Error("Oops, test run failed!")
-		}
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
 	})
+	if res.Stats.TotalFailed() > 0 {
+		t.Errorf("Oops, test run failed! %v", res.Stats.Failed)
+	}
+	if rules := res.Stats.TriggeredRules["200"]; !reflect.DeepEqual(rules, []int{920210, 920300, 949110, 980130}) {
+		t.Errorf("unexpected rules %v", rules)
+	}
+	// the markers are only waited for in the first stage
+	stages := len(ftwTest.Tests)
+	if n := atomic.LoadInt32(&markers); n != int32(3+2*stages-1) {
+		t.Errorf("unexpected number of marker requests %d for %d stages", n, stages)
+	}
+}
 
-	t.Run("exclude test 010", func(t *testing.T) {
-		if res := Run([]test.FTWTest{ftwTest}, Config{
-			Exclude: regexp.MustCompile("010"),
-		}); res.Stats.TotalFailed() > 0 {
-			t.Error("Oops, test run failed!")
-		}
-	})
+func TestCapturesRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+	logFilePath := setUpLogFileForTestServer(t, cfg)
+	cfg.LogFile = logFilePath
 
-	t.Run("test exceptions 1", func(t *testing.T) {
-		if res := Run([]test.FTWTest{ftwTest}, Config{
-			Include: regexp.MustCompile("1*"),
-			Exclude: regexp.MustCompile("0*"),
-			Quiet:   true,
-		}); res.Stats.TotalFailed() > 0 {
-			t.Error("Oops, test run failed!")
-		}
+	// the web server echoes the body of the requests
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+		writeTestServerLog(t, cfg, logText, logFilePath, r)
+	}))
+	t.Cleanup(ts.Close)
+	dest, err := ftwhttp.DestinationFromString(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaceDestinationInConfiguration(cfg, *dest)
+
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestCaptures))
+	if err != nil {
+		t.Error(err)
+	}
+	replaceDestinationInTest(&ftwTest, *dest)
+
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
 	})
+	if res.Stats.TotalFailed() > 0 {
+		t.Errorf("Oops, test run failed! %v", res.Stats.Failed)
+	}
 }
 
-func TestOverrideRun(t *testing.T) {
-	t.Cleanup(config.Reset)
+func TestMaxRTTRun(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
+	if err != nil {
+		t.Errorf("Failed!")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	dest, err := ftwhttp.DestinationFromString(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// setup test webserver (not a waf)
-	err := config.NewConfigFromString(yamlConfigOverride)
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestMaxRTT))
 	if err != nil {
 		t.Error(err)
 	}
+	replaceDestinationInTest(&ftwTest, *dest)
 
-	dest, logFilePath := newTestServer(t, logText)
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{
+		Quiet: true,
+	})
+	// the status is right, but the slow response fails the stage
+	if res.Stats.Success != 1 || !reflect.DeepEqual(res.Stats.Failed, []string{"002"}) {
+		t.Errorf("unexpected results: success %v, failed %v", res.Stats.Success, res.Stats.Failed)
+	}
+}
 
-	replaceDestinationInConfiguration(*dest)
-	config.FTWConfig.LogFile = logFilePath
+var yamlTestCloudflare = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Test"
+tests:
+  - test_title: "942100-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/?id=1%27%20or%201=1"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            log_contains: 'source "firewallManaged"'
+            log:
+              rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            dest_addr: "TEST_ADDR"
+            # -1 designates port value must be replaced by test setup
+            port: -1
+            uri: "/?id=1"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            no_log_contains: 'firewallManaged'
+`
 
-	// replace host and port with values that can be overridden by config
-	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
+func TestCloudflareRun(t *testing.T) {
+	// the WAF blocks the attacks, and the firewall events are found by the ray ID of the response
+	var requests int32
+	var mu sync.Mutex
+	blocked := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ray := fmt.Sprintf("7d00000000000%03d", atomic.AddInt32(&requests, 1))
+		w.Header().Set("Cf-Ray", ray+"-LHR")
+		if r.URL.Query().Get("id") != "1" {
+			mu.Lock()
+			blocked[ray] = true
+			mu.Unlock()
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query struct {
+			Variables struct {
+				Filter struct {
+					RayName string `json:"rayName"`
+				} `json:"filter"`
+			} `json:"variables"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &query); err != nil || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ray := query.Variables.Filter.RayName
+		events := "[]"
+		mu.Lock()
+		if blocked[ray] {
+			events = fmt.Sprintf(`[{"action":"block","description":"942100: SQL Injection Attack Detected via libinjection","rayName":%q,"ruleId":"a1","source":"firewallManaged"}]`, ray)
+		}
+		mu.Unlock()
+		fmt.Fprintf(w, `{"data":{"viewer":{"zones":[{"firewallEventsAdaptive":%s}]}},"errors":null}`, events)
+	}))
+	t.Cleanup(api.Close)
+
+	cfg, err := config.NewConfigFromString(fmt.Sprintf(`---
+logsource: cloudflare
+cloudflare:
+  zoneid: zone
+  apitoken: token
+  endpoint: %s
+  pollinterval: 10ms
+  timeout: 50ms
+`, api.URL))
 	if err != nil {
-		t.Fatalf("Failed to parse fake destination")
+		t.Fatal(err)
+	}
+	dest, err := ftwhttp.DestinationFromString(ts.URL)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestOverride))
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestCloudflare))
 	if err != nil {
 		t.Error(err)
 	}
-	replaceDestinationInTest(&ftwTest, *fakeDestination)
+	replaceDestinationInTest(&ftwTest, *dest)
 
-	if res := Run([]test.FTWTest{ftwTest}, Config{
+	if res := Run(cfg, []test.FTWTest{ftwTest}, Config{
 		Quiet: true,
 	}); res.Stats.TotalFailed() > 0 {
-		t.Error("Oops, test run failed!")
+		t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
+	}
+	// no marker requests
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
 	}
 }
 
-func TestBrokenOverrideRun(t *testing.T) {
-	t.Cleanup(config.Reset)
+var yamlTestEmbedded = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "gotest-ftw.yaml"
+  description: "Example Test"
+tests:
+  - test_title: "942100-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1%27%20or%201=1"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            log_contains: 'msg "SQL Injection Attack"'
+            log:
+              rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            method: "POST"
+            uri: "/"
+            data: "id=1"
+            headers:
+              User-Agent: "ModSecurity CRS 3 Tests"
+              Host: "localhost"
+          output:
+            log:
+              no_rule_ids: [942100]
+  - test_title: "920100-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            raw_request: "GARBAGE\r\n\r\n"
+          output:
+            status: [400]
+`
 
-	err := config.NewConfigFromString(yamlBrokenConfigOverride)
+func TestEmbeddedRun(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
 	if err != nil {
-		t.Errorf("Failed!")
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	dest, logFilePath := newTestServer(t, logText)
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	replaceDestinationInConfiguration(*dest)
-	config.FTWConfig.LogFile = logFilePath
+	ftwTest.Meta.Metadata = map[string]interface{}{"paranoia_level": 1}
+	ftwTest.Tests[0].Metadata = map[string]interface{}{"cve": "CVE-2021-44228"}
 
-	// replace host and port with values that can be overridden by config
-	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
-	if err != nil {
-		t.Fatalf("Failed to parse fake destination")
+	// nothing listens on the destination, the requests are evaluated by the embedded WAF
+	collector := metrics.NewCollector()
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, Metrics: collector})
+	if res.Stats.TotalFailed() > 0 {
+		t.Errorf("Oops, %d tests failed to run!", res.Stats.TotalFailed())
+	}
+	if res.Stats.Run != 3 {
+		t.Errorf("expected 3 stages to run, got %d", res.Stats.Run)
 	}
 
-	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestOverride))
-	if err != nil {
-		t.Error(err)
+	var b bytes.Buffer
+	if _, err := collector.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `ftw_tests_total{result="passed"} 3`) || !strings.Contains(b.String(), "ftw_request_rtt_seconds_count 3") {
+		t.Errorf("the stages must be collected in the metrics, got\n%s", b.String())
 	}
-	replaceDestinationInTest(&ftwTest, *fakeDestination)
 
-	// the test should succeed, despite the unknown override property
-	if res := Run([]test.FTWTest{ftwTest}, Config{
-		Quiet: true,
-	}); res.Stats.TotalFailed() > 0 {
-		t.Error("Oops, test run failed!")
+	if len(res.Stats.Stages) != 3 {
+		t.Fatalf("expected the results of 3 stages, got %+v", res.Stats.Stages)
+	}
+	first := res.Stats.Stages[0]
+	if first.Test != "942100-1" || first.Result != Success || first.StatusCode != 403 || !reflect.DeepEqual(first.TriggeredRules, []int{942100}) || first.RoundTripTime <= 0 {
+		t.Errorf("unexpected stage result %+v", first)
+	}
+	if !reflect.DeepEqual(first.Metadata, map[string]interface{}{"paranoia_level": 1, "cve": "CVE-2021-44228"}) {
+		t.Errorf("the stage results must have the metadata of the test and its file, got %v", first.Metadata)
+	}
+	if last := res.Stats.Stages[2]; !reflect.DeepEqual(last.Metadata, map[string]interface{}{"paranoia_level": 1}) {
+		t.Errorf("the stage results must have the metadata of their test, got %v", last.Metadata)
 	}
 }
 
-func TestBrokenPortOverrideRun(t *testing.T) {
-	t.Cleanup(config.Reset)
+// cancellingWriter cancels the run at the end of its first stage
+type cancellingWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
 
-	// TestServer initialized first to retrieve the correct port number
-	dest, logFilePath := newTestServer(t, logText)
+func (w *cancellingWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte(StageFinished)) {
+		w.cancel()
+	}
+	return w.Buffer.Write(p)
+}
 
-	// replace destination port inside the yaml with the retrieved one
-	err := config.NewConfigFromString(fmt.Sprintf(yamlConfigPortOverride, dest.Port))
+func TestCancelledRun(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
 	if err != nil {
-		t.Errorf("Failed!")
+		t.Fatal(err)
 	}
-
-	replaceDestinationInConfiguration(*dest)
-	config.FTWConfig.LogFile = logFilePath
-
-	// replace host and port with values that can be overridden by config
-	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
 	if err != nil {
-		t.Fatalf("Failed to parse fake destination")
+		t.Fatal(err)
 	}
-
-	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestOverrideWithNoPort))
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	replaceDestinationInTest(&ftwTest, *fakeDestination)
 
-	// the test should succeed, despite the unknown override property
-	if res := Run([]test.FTWTest{ftwTest}, Config{
-		Quiet: true,
-	}); res.Stats.TotalFailed() > 0 {
-		t.Error("Oops, test run failed!")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := &cancellingWriter{cancel: cancel}
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, Context: ctx, Events: events})
+	if res.Stats.Run != 1 || !res.Stats.Interrupted {
+		t.Errorf("expected the run to stop after the first stage, got %d stages", res.Stats.Run)
+	}
+	if !strings.Contains(events.String(), RunFinished) || !strings.Contains(events.String(), `"interrupted":true`) {
+		t.Errorf("the end of a cancelled run must be in its events\n%s", events.String())
 	}
 }
 
-func TestDisabledRun(t *testing.T) {
-	t.Cleanup(config.Reset)
-
-	err := config.NewConfigFromString(yamlConfig)
+func TestCancelledDelay(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
 	if err != nil {
-		t.Errorf("Failed!")
+		t.Fatal(err)
 	}
-
-	fakeDestination, err := ftwhttp.DestinationFromString("http://example.com:1234")
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
 	if err != nil {
-		t.Fatalf("Failed to parse fake destination")
+		t.Fatal(err)
 	}
-
-	ftwTest, err := test.GetTestFromYaml([]byte(yamlDisabledTest))
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	ftwTest.Tests[0].Stages[0].Stage.DelayAfter = test.Duration(time.Minute)
+	ftwTest.Tests[1].Stages[0].Stage.DelayBefore = test.Duration(time.Minute)
+
+	// the run is cancelled at the end of the first stage, while it waits after it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, Context: ctx, Events: &cancellingWriter{cancel: cancel}})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the delay after the stage must end with the run, took %s", elapsed)
+	}
+	if res.Stats.Run != 1 || !res.Stats.Interrupted {
+		t.Errorf("expected the run to stop after the first stage, got %+v", res.Stats)
 	}
-	replaceDestinationInTest(&ftwTest, *fakeDestination)
 
-	if res := Run([]test.FTWTest{ftwTest}, Config{
-		Quiet: true,
-	}); res.Stats.TotalFailed() > 0 {
-		t.Error("Oops, test run failed!")
+	// the run is cancelled while it waits before the first stage
+	ftwTest.Tests = ftwTest.Tests[1:]
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	res = Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, Context: ctx})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the delay before the stage must end with the run, took %s", elapsed)
+	}
+	if res.Stats.Run != 0 || len(res.Stats.Stages) != 0 || !res.Stats.Interrupted {
+		t.Errorf("the stage must not run once the run stopped, got %+v", res.Stats)
 	}
 }
 
-func TestLogsRun(t *testing.T) {
-	t.Cleanup(config.Reset)
-
-	// setup test webserver (not a waf)
-	dest, logFilePath := newTestServer(t, logText)
-
-	err := config.NewConfigFromString(yamlConfig)
+func TestRunStopsOnError(t *testing.T) {
+	cfg, err := config.NewConfigFromString(yamlCloudConfig)
 	if err != nil {
-		t.Errorf("Failed!")
+		t.Fatal(err)
 	}
-	replaceDestinationInConfiguration(*dest)
-	config.FTWConfig.LogFile = logFilePath
-
-	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestLogs))
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	replaceDestinationInTest(&ftwTest, *dest)
 
-	if res := Run([]test.FTWTest{ftwTest}, Config{
-		Quiet: true,
-	}); res.Stats.TotalFailed() > 0 {
-		t.Error("Oops, test run failed!")
+	// the tests send their requests to localhost:1, where nothing listens
+	var events strings.Builder
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, ConnectTimeout: time.Second, Events: &events})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "can't connect to destination localhost:1 of 942100-1") {
+		t.Errorf("unexpected error %v", res.Err)
 	}
-}
-
-func TestCloudRun(t *testing.T) {
-	t.Cleanup(config.Reset)
-
-	err := config.NewConfigFromString(yamlCloudConfig)
-	if err != nil {
-		t.Errorf("Failed!")
+	if res.Stats.Run != 0 || len(res.Stats.Stages) != 0 || res.Stats.Interrupted {
+		t.Errorf("the run must stop at the first stage, got %+v", res.Stats)
+	}
+	if !strings.Contains(events.String(), `"error":"ftw/run: can't connect to destination`) {
+		t.Errorf("the end of the run must have its error\n%s", events.String())
 	}
 
-	ftwTestDummy, err := test.GetTestFromYaml([]byte(yamlTestLogs))
-	if err != nil {
-		t.Error(err)
+	ftwTest.Tests[0].Stages[0].Stage.Output.LogContains = test.PatternList{"("}
+	res = Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "bad test 942100-1: bad log pattern") {
+		t.Errorf("unexpected error %v", res.Err)
 	}
 
-	t.Run("don't show time and execute all", func(t *testing.T) {
-		for testCaseIndex, testCaseDummy := range ftwTestDummy.Tests {
-			for stageIndex := range testCaseDummy.Stages {
-				// Read the tests for every stage so we can replace the destination
-				// in each run. The server needs to be configured for each stage
-				// individually.
-				ftwTest, err := test.GetTestFromYaml([]byte(yamlTestLogs))
-				if err != nil {
-					t.Error(err)
-				}
-				testCase := &ftwTest.Tests[testCaseIndex]
-				stage := &testCase.Stages[stageIndex].Stage
+	res = Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, Destination: "unknown"})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), `unknown destination "unknown"`) {
+		t.Errorf("unexpected error %v", res.Err)
+	}
+}
 
-				ftwCheck := check.NewCheck(config.FTWConfig)
+func TestFalsePositives(t *testing.T) {
+	var expected test.Output
+	if ids := falsePositives(expected, []int{942100}); ids != nil {
+		t.Errorf("no rule is a false positive without no_rule_ids, got %v", ids)
+	}
+	expected.Log.NoExpectIDs = test.RuleIDList{{From: 942100, To: 942199}, {From: 920100, To: 920100}}
+	if ids := falsePositives(expected, []int{920100, 942100, 942110, 949110}); !reflect.DeepEqual(ids, []int{920100, 942100, 942110}) {
+		t.Errorf("unexpected false positives %v", ids)
+	}
+}
 
-				// this mirrors check.SetCloudMode()
-				responseStatus := 200
-				if stage.Output.LogContains != "" {
-					responseStatus = 403
-				} else if stage.Output.NoLogContains != "" {
-					responseStatus = 405
-				}
-				server, dest := newTestServerForCloudTest(t, responseStatus, logText)
+func TestPrintEvidence(t *testing.T) {
+	var b strings.Builder
+	printEvidence(&b, "response", []string{""}, maxEvidenceLines)
+	if b.Len() != 0 {
+		t.Errorf("nothing must be printed without evidence, got %q", b.String())
+	}
+	lines := make([]string, maxEvidenceLines+5)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d\r", i)
+	}
+	printEvidence(&b, "logs", lines, maxEvidenceLines)
+	printed := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(printed) != maxEvidenceLines+2 || printed[0] != "\tlogs:" || printed[1] != "\t\tline 0" || printed[len(printed)-1] != "\t\t... 5 more lines" {
+		t.Errorf("unexpected evidence\n%s", b.String())
+	}
 
-				replaceDestinationInConfiguration(*dest)
+	b.Reset()
+	printEvidence(&b, "logs", lines, 0)
+	if printed := strings.Count(b.String(), "\n"); printed != len(lines)+1 {
+		t.Errorf("expected all the lines without a maximum, got %d\n%s", printed, b.String())
+	}
+}
 
-				replaceDestinationInTest(&ftwTest, *dest)
-				if err != nil {
-					t.Error(err)
-				}
-				runContext := TestRunContext{
-					Include:  nil,
-					Exclude:  nil,
-					ShowTime: false,
-					Output:   true,
-					Client:   ftwhttp.NewClient(ftwhttp.NewClientConfig()),
-					LogLines: nil,
-				}
+func TestRunSpans(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
+	if err != nil {
+		t.Fatal(err)
+	}
 
-				RunStage(&runContext, ftwCheck, *testCase, *stage)
-				if runContext.Stats.TotalFailed() > 0 {
-					t.Error("Oops, test run failed!")
-				}
+	// the tracers of the packages are bound to the first provider set, so it's set only here
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true})
 
-				server.Close()
-			}
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	byID := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+		byID[span.SpanContext().SpanID().String()] = span
+	}
+	if len(spans["run"]) != 1 || len(spans["file"]) != 1 || len(spans["stage"]) != 3 || len(spans["request"]) != 3 {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	for _, request := range spans["request"] {
+		var names []string
+		for span := request; span != nil; {
+			names = append(names, span.Name())
+			span = byID[span.Parent().SpanID().String()]
 		}
-	})
+		if !reflect.DeepEqual(names, []string{"request", "stage", "test", "file", "run"}) {
+			t.Errorf("unexpected ancestors of the request %v", names)
+		}
+	}
+	for _, kv := range spans["run"][0].Attributes() {
+		if kv.Key == "ftw.run" && kv.Value.AsInt64() != 3 {
+			t.Errorf("expected 3 stages run, got %d", kv.Value.AsInt64())
+		}
+	}
 }
 
-func TestFailedTestsRun(t *testing.T) {
-	t.Cleanup(config.Reset)
-
-	err := config.NewConfigFromString(yamlConfig)
-	dest, logFilePath := newTestServer(t, logText)
+func TestRunEvents(t *testing.T) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx '" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
 	if err != nil {
-		t.Errorf("Failed!")
+		t.Fatal(err)
 	}
-	replaceDestinationInConfiguration(*dest)
-	config.FTWConfig.LogFile = logFilePath
-
-	ftwTest, err := test.GetTestFromYaml([]byte(yamlFailedTest))
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
 	if err != nil {
-		t.Error(err.Error())
+		t.Fatal(err)
 	}
-	replaceDestinationInTest(&ftwTest, *dest)
-
-	if res := Run([]test.FTWTest{ftwTest}, Config{}); res.Stats.TotalFailed() != 1 {
-		t.Error("Oops, test run failed!")
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	ftwTest.FileName = "942100.yaml"
 
-func TestApplyInputOverrideSetHostFromDestAddr(t *testing.T) {
-	t.Cleanup(config.Reset)
+	var b bytes.Buffer
+	Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, Exclude: regexp.MustCompile("920100-1"), Events: &b})
 
-	originalHost := "original.com"
-	overrideHost := "override.com"
-	testInput := test.Input{
-		DestAddr: &originalHost,
+	var events []Event
+	var types []string
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("bad event %s: %s", line, err)
+		}
+		events = append(events, event)
+		types = append(types, event.Type)
+	}
+	expected := []string{RunStarted, TestStarted, StageFinished, TestStarted, StageFinished, StageFinished, RunFinished}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("unexpected events %v", types)
+	}
+	if events[0].Files != 1 || events[0].Time.IsZero() {
+		t.Errorf("unexpected run_started event %+v", events[0])
 	}
-	config.FTWConfig = &config.FTWConfiguration{
-		TestOverride: config.FTWTestOverride{
-			Input: test.Input{
-				DestAddr: &overrideHost,
-			},
-		},
+	stage := events[2]
+	if stage.File != "942100.yaml" || stage.Test != "942100-1" || stage.Stage != 1 || stage.StageID == "" || stage.Result != "passed" ||
+		stage.StatusCode != 403 || stage.Duration <= 0 || !reflect.DeepEqual(stage.TriggeredRules, []int{942100}) {
+		t.Errorf("unexpected stage_finished event %+v", stage)
 	}
+	if skipped := events[5]; skipped.Test != "920100-1" || skipped.Result != "skipped" || skipped.Stage != 0 {
+		t.Errorf("unexpected event of the skipped test %+v", skipped)
+	}
+	if stats := events[6].Stats; stats == nil || stats.Run != 2 || stats.Passed != 2 || stats.Skipped != 1 || stats.Failed == nil {
+		t.Errorf("unexpected run_finished event %+v", events[6])
+	}
+}
 
-	err := applyInputOverride(&testInput)
+func TestRunEvidence(t *testing.T) {
+	// the rule matches the request of 942100-2 too, which expects it not to
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx 1" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
 	if err != nil {
-		t.Error("Failed to apply input overrides", err)
+		t.Fatal(err)
 	}
-
-	if *testInput.DestAddr != overrideHost {
-		t.Error("`dest_addr` should have been overridden")
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\n", rules))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if testInput.Headers == nil {
-		t.Error("Header map must exist after overriding `dest_addr`")
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTestEmbedded))
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	hostHeader := testInput.Headers.Get("Host")
-	if hostHeader == "" {
-		t.Error("Host header must be set after overriding `dest_addr`")
+	var b bytes.Buffer
+	res := Run(cfg, []test.FTWTest{ftwTest}, Config{Quiet: true, Exclude: regexp.MustCompile("920100-1"), Events: &b, Evidence: true})
+	if len(res.Stats.Stages) != 3 || res.Stats.Stages[0].Evidence != nil {
+		t.Fatalf("only the failed stages have evidence, got %+v", res.Stats.Stages)
 	}
-	if hostHeader != overrideHost {
-		t.Error("Host header must be identical to `dest_addr` after overrding `dest_addr`")
+	evidence := res.Stats.Stages[1].Evidence
+	if evidence == nil {
+		t.Fatalf("expected the evidence of the failed stage")
+	}
+	if !strings.HasPrefix(evidence.Request, "POST / HTTP/1.1\r\n") || !strings.HasSuffix(evidence.Request, "id=1") {
+		t.Errorf("unexpected request %q", evidence.Request)
+	}
+	if !strings.HasPrefix(evidence.Response, "HTTP/1.1 403") || evidence.Error != "" {
+		t.Errorf("unexpected response %q, error %q", evidence.Response, evidence.Error)
+	}
+	if len(evidence.Logs) != 1 || !strings.Contains(evidence.Logs[0], `[id "942100"]`) {
+		t.Errorf("unexpected logs %v", evidence.Logs)
+	}
+	if !strings.Contains(b.String(), `"evidence":{"request":"POST / HTTP/1.1`) {
+		t.Errorf("the events of the failed stages must have their evidence, got\n%s", b.String())
 	}
 }
@@ -1,6 +1,12 @@
 package runner
 
 import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kyokomi/emoji"
@@ -20,6 +26,34 @@ const (
 	ForceFail
 )
 
+// resultNames are the names of the results in the metrics
+var resultNames = map[TestResult]string{
+	Success:   "passed",
+	Failed:    "failed",
+	Skipped:   "skipped",
+	Ignored:   "ignored",
+	ForcePass: "forced_pass",
+	ForceFail: "forced_fail",
+}
+
+// String returns the name of the result, like `passed`
+func (r TestResult) String() string {
+	if name, ok := resultNames[r]; ok {
+		return name
+	}
+	return strconv.Itoa(int(r))
+}
+
+// ParseTestResult returns the result with the name, like `passed`
+func ParseTestResult(name string) (TestResult, bool) {
+	for result, resultName := range resultNames {
+		if resultName == name {
+			return result, true
+		}
+	}
+	return 0, false
+}
+
 // TestStats accumulates test statistics
 type TestStats struct {
 	Run        int
@@ -30,12 +64,78 @@ type TestStats struct {
 	ForcedFail []string
 	Success    int
 	RunTime    time.Duration
+	// FailedLogs has the log lines between the markers of the stages that failed, by file and test
+	// title, as tests of different files can have the same title
+	FailedLogs map[string]map[string][]string
+	// TriggeredRules has the sorted IDs of the rules found in the logs of every test that ran, by test title
+	TriggeredRules map[string][]int
+	// Stages has the results of the stages, in the order they ran, for the reports of the run
+	Stages []StageResult
+	// Interrupted is set when the context of the run stopped it before all the tests ran
+	Interrupted bool
+	// MarkerTime is the time spent sending the marker requests and finding them in the logs, part
+	// of RunTime
+	MarkerTime time.Duration
+}
+
+// StageResult is the result of a stage of a test. The stages of the skipped tests have a result
+// without time.
+type StageResult struct {
+	// File is the file of the test, and Test its title
+	File string
+	Test string
+	// Result is the result of the stage
+	Result TestResult
+	// StatusCode is the status code of the response to the last request of the stage, 0 without
+	// response
+	StatusCode int
+	// Duration is the time spent running the stage, and RoundTripTime the round trip time of its
+	// request
+	Duration      time.Duration
+	RoundTripTime time.Duration
+	// TriggeredRules are the sorted IDs of the rules found in the logs of the stage
+	TriggeredRules []int
+	// FalsePositives are the triggered rules of a failed stage that the stage expects not to trigger
+	FalsePositives []int
+	// Evidence has the request, the response and the logs of a failed stage, when the run keeps them
+	Evidence *StageEvidence
+	// Metadata is the metadata of the test, with the one of its file, for the reports
+	Metadata map[string]interface{}
+}
+
+// StageEvidence is what a failed stage sent and received, and the logs of its requests, to see why
+// it failed
+type StageEvidence struct {
+	// Request is the last request of the stage as it was sent, empty for gRPC requests
+	Request string `json:"request,omitempty"`
+	// Response is the last response of the stage as it was received, and Error the error sending
+	// the request, if any
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Logs are the log lines of the requests of the stage
+	Logs []string `json:"logs,omitempty"`
 }
 
 func (t *TestStats) TotalFailed() int {
 	return len(t.Failed) + len(t.ForcedFail)
 }
 
+// AddStage adds the result of a stage run somewhere else, like by a worker of a distributed run,
+// to the statistics as if the stage ran here
+func (t *TestStats) AddStage(stage StageResult) {
+	addResultToStats(stage.Result, stage.Test, t)
+	t.Stages = append(t.Stages, stage)
+	if stage.Result != Success && stage.Result != Failed {
+		return
+	}
+	t.Run++
+	t.RunTime += stage.Duration
+	addTriggeredRules(stage.Test, stage.TriggeredRules, t)
+	if stage.Result == Failed && stage.Evidence != nil {
+		addFailedLogs(stage.File, stage.Test, stage.Evidence.Logs, t)
+	}
+}
+
 func addResultToStats(result TestResult, title string, stats *TestStats) {
 	switch result {
 	case Success:
@@ -55,13 +155,185 @@ func addResultToStats(result TestResult, title string, stats *TestStats) {
 	}
 }
 
+// addFailedLogs keeps the log lines of a failed stage. Lines of the stages of the same test are appended.
+func addFailedLogs(file, title string, lines []string, stats *TestStats) {
+	if len(lines) == 0 {
+		return
+	}
+	if stats.FailedLogs == nil {
+		stats.FailedLogs = make(map[string]map[string][]string)
+	}
+	if stats.FailedLogs[file] == nil {
+		stats.FailedLogs[file] = make(map[string][]string)
+	}
+	stats.FailedLogs[file][title] = append(stats.FailedLogs[file][title], lines...)
+}
+
+// addTriggeredRules merges the rules triggered by a stage with the ones of the previous stages of the test
+func addTriggeredRules(title string, ids []int, stats *TestStats) {
+	if ids == nil {
+		return
+	}
+	if stats.TriggeredRules == nil {
+		stats.TriggeredRules = make(map[string][]int)
+	}
+	merged := stats.TriggeredRules[title]
+	for _, id := range ids {
+		i := sort.SearchInts(merged, id)
+		if i < len(merged) && merged[i] == id {
+			continue
+		}
+		merged = append(merged, 0)
+		copy(merged[i+1:], merged[i:])
+		merged[i] = id
+	}
+	if merged == nil {
+		merged = []int{}
+	}
+	stats.TriggeredRules[title] = merged
+}
+
+// ruleFamilyRegex matches the ID of the CRS rule at the start of the test titles, like
+// `942100-1`. The first 3 digits are the family of the rule, and of its rule file.
+var ruleFamilyRegex = regexp.MustCompile(`^(\d{3})\d{3}`)
+
+// familyResultOrder is the order of the results in the summary of the families
+var familyResultOrder = []TestResult{Success, Failed, ForceFail, Skipped, Ignored, ForcePass}
+
+// FamilyStats are the results of the stages of the tests of a rule family
+type FamilyStats struct {
+	// Family is the family of the rules of the tests, like `942`, or empty for the tests whose
+	// title doesn't start with a rule ID
+	Family string
+	// Name is the directory of the tests of the family, like `REQUEST-942-APPLICATION-ATTACK-SQLI`,
+	// or the family when the directory doesn't have it
+	Name string
+	// Results counts the stages by result
+	Results map[TestResult]int
+}
+
+// Failed returns the number of stages of the family that failed or were forced to fail
+func (f FamilyStats) Failed() int {
+	return f.Results[Failed] + f.Results[ForceFail]
+}
+
+// FamilyStats groups the results of the stages by the family of the rules of the tests, derived
+// from the rule IDs starting their titles, sorted by family. The tests without rule ID are last.
+func (t *TestStats) FamilyStats() []FamilyStats {
+	index := make(map[string]*FamilyStats)
+	for _, stage := range t.Stages {
+		family := ""
+		if match := ruleFamilyRegex.FindStringSubmatch(stage.Test); match != nil {
+			family = match[1]
+		}
+		f, ok := index[family]
+		if !ok {
+			f = &FamilyStats{Family: family, Name: family, Results: make(map[TestResult]int)}
+			index[family] = f
+		}
+		if dir := filepath.Base(filepath.Dir(stage.File)); family != "" && strings.Contains(dir, "-"+family+"-") {
+			f.Name = dir
+		}
+		f.Results[stage.Result]++
+	}
+
+	families := make([]FamilyStats, 0, len(index))
+	for _, f := range index {
+		families = append(families, *f)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		if families[i].Family == "" || families[j].Family == "" {
+			return families[j].Family == ""
+		}
+		return families[i].Family < families[j].Family
+	})
+	return families
+}
+
+// RTTStats are the statistics of the round trip times of the requests of the stages
+type RTTStats struct {
+	// Count is the number of stages with a round trip time
+	Count int
+	Min   time.Duration
+	Mean  time.Duration
+	// P95 is the 95th percentile, the time 95% of the stages took at most
+	P95 time.Duration
+	Max time.Duration
+}
+
+// RTTStats returns the statistics of the round trip times of the stages that sent a request
+func (t *TestStats) RTTStats() RTTStats {
+	var times []time.Duration
+	var total time.Duration
+	for _, stage := range t.Stages {
+		if stage.RoundTripTime > 0 {
+			times = append(times, stage.RoundTripTime)
+			total += stage.RoundTripTime
+		}
+	}
+	if len(times) == 0 {
+		return RTTStats{}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	// the nearest rank
+	rank := (len(times)*95 + 99) / 100
+	return RTTStats{
+		Count: len(times),
+		Min:   times[0],
+		Mean:  total / time.Duration(len(times)),
+		P95:   times[rank-1],
+		Max:   times[len(times)-1],
+	}
+}
+
+// printFamilySummary prints the results of every rule family, when the tests have more than one
+func printFamilySummary(stats TestStats) {
+	families := stats.FamilyStats()
+	if len(families) < 2 {
+		return
+	}
+	emoji.Println(":bookmark_tabs:results by rule family:")
+	for _, f := range families {
+		name := f.Name
+		if name == "" {
+			name = "other tests"
+		}
+		var counts []string
+		for _, result := range familyResultOrder {
+			if n := f.Results[result]; n > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", n, strings.ReplaceAll(result.String(), "_", " ")))
+			}
+		}
+		line := fmt.Sprintf("\t%s: %s", name, strings.Join(counts, ", "))
+		if f.Failed() > 0 {
+			line += " :thumbs_down:"
+		}
+		emoji.Println(line)
+	}
+}
+
+// PrintSummary prints the summary of the statistics of a run, like at the end of Run
+func PrintSummary(stats TestStats) {
+	printSummary(false, stats)
+}
+
 func printSummary(quiet bool, stats TestStats) {
 	if quiet {
 		return
 	}
 
+	if stats.Interrupted {
+		emoji.Println(":stop_sign:The run was interrupted, the results are the ones of the tests completed so far")
+	}
 	if stats.Run > 0 {
+		printFamilySummary(stats)
 		emoji.Printf(":plus:run %d total tests in %s\n", stats.Run, stats.RunTime)
+		if rtt := stats.RTTStats(); rtt.Count > 0 {
+			emoji.Printf(":stopwatch:RTT min %s, mean %s, p95 %s, max %s\n", rtt.Min, rtt.Mean, rtt.P95, rtt.Max)
+		}
+		if stats.MarkerTime > 0 {
+			emoji.Printf(":stopwatch:log markers took %s of the run\n", stats.MarkerTime)
+		}
 		emoji.Printf(":next_track_button: skipped %d tests\n", len(stats.Skipped))
 		if len(stats.Ignored) > 0 {
 			emoji.Printf(":index_pointing_up: ignored %d tests\n", len(stats.Ignored))
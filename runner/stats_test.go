@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddTriggeredRules(t *testing.T) {
+	var stats TestStats
+
+	addTriggeredRules("cloud", nil, &stats)
+	if _, found := stats.TriggeredRules["cloud"]; found {
+		t.Error("tests without logs must not have triggered rules")
+	}
+
+	addTriggeredRules("none", []int{}, &stats)
+	if ids, found := stats.TriggeredRules["none"]; !found || len(ids) != 0 {
+		t.Errorf("tests without rules must be recorded, got %v", ids)
+	}
+
+	addTriggeredRules("stages", []int{920300, 949110}, &stats)
+	addTriggeredRules("stages", []int{911100, 949110, 980130}, &stats)
+	if ids := stats.TriggeredRules["stages"]; !reflect.DeepEqual(ids, []int{911100, 920300, 949110, 980130}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+}
+
+func TestAddFailedLogs(t *testing.T) {
+	var stats TestStats
+
+	addFailedLogs("a.yaml", "cloud", nil, &stats)
+	if stats.FailedLogs != nil {
+		t.Error("no logs expected")
+	}
+	addFailedLogs("a.yaml", "990", []string{"one"}, &stats)
+	addFailedLogs("a.yaml", "990", []string{"two"}, &stats)
+	addFailedLogs("b.yaml", "990", []string{"three"}, &stats)
+	if lines := stats.FailedLogs["a.yaml"]["990"]; !reflect.DeepEqual(lines, []string{"one", "two"}) {
+		t.Errorf("unexpected logs %v", lines)
+	}
+	if lines := stats.FailedLogs["b.yaml"]["990"]; !reflect.DeepEqual(lines, []string{"three"}) {
+		t.Errorf("the logs of the tests of different files must not be merged, got %v", lines)
+	}
+}
+
+func TestTestResultString(t *testing.T) {
+	if Success.String() != "passed" || ForceFail.String() != "forced_fail" {
+		t.Errorf("unexpected names %s, %s", Success, ForceFail)
+	}
+	if TestResult(42).String() != "42" {
+		t.Errorf("unknown results must have their number, got %s", TestResult(42))
+	}
+}
+
+func TestFamilyStats(t *testing.T) {
+	stats := TestStats{
+		Stages: []StageResult{
+			{File: "tests/REQUEST-942-APPLICATION-ATTACK-SQLI/942100.yaml", Test: "942100-1", Result: Success},
+			{File: "tests/REQUEST-942-APPLICATION-ATTACK-SQLI/942100.yaml", Test: "942100-2", Result: Failed},
+			{File: "tests/942110.yaml", Test: "942110-1", Result: Success},
+			{File: "tests/REQUEST-920-PROTOCOL-ENFORCEMENT/920100.yaml", Test: "920100-1", Result: Skipped},
+			{File: "tests/smoke.yaml", Test: "smoke-1", Result: ForceFail},
+		},
+	}
+	expected := []FamilyStats{
+		{Family: "920", Name: "REQUEST-920-PROTOCOL-ENFORCEMENT", Results: map[TestResult]int{Skipped: 1}},
+		{Family: "942", Name: "REQUEST-942-APPLICATION-ATTACK-SQLI", Results: map[TestResult]int{Success: 2, Failed: 1}},
+		{Family: "", Name: "", Results: map[TestResult]int{ForceFail: 1}},
+	}
+	families := stats.FamilyStats()
+	if !reflect.DeepEqual(families, expected) {
+		t.Errorf("unexpected families %+v", families)
+	}
+	if families[0].Failed() != 0 || families[1].Failed() != 1 || families[2].Failed() != 1 {
+		t.Error("unexpected failures of the families")
+	}
+
+	stats.Stages = []StageResult{{File: "tests/942110.yaml", Test: "942110-1", Result: Success}}
+	if families := stats.FamilyStats(); len(families) != 1 || families[0].Name != "942" {
+		t.Errorf("the family must be named after its number without directory, got %+v", families)
+	}
+}
+
+func TestRTTStats(t *testing.T) {
+	stats := TestStats{Stages: []StageResult{{Result: Skipped}}}
+	if rtt := stats.RTTStats(); rtt != (RTTStats{}) {
+		t.Errorf("expected no statistics without round trip times, got %+v", rtt)
+	}
+	for i := 20; i > 0; i-- {
+		stats.Stages = append(stats.Stages, StageResult{Result: Success, RoundTripTime: time.Duration(i) * time.Millisecond})
+	}
+	expected := RTTStats{Count: 20, Min: time.Millisecond, Mean: 10500 * time.Microsecond, P95: 19 * time.Millisecond, Max: 20 * time.Millisecond}
+	if rtt := stats.RTTStats(); rtt != expected {
+		t.Errorf("unexpected statistics %+v", rtt)
+	}
+}
+
+func TestAddStage(t *testing.T) {
+	var stats TestStats
+	for _, stage := range []StageResult{
+		{Test: "942100-1", Result: Success, Duration: time.Second, TriggeredRules: []int{942100}},
+		{File: "942100.yaml", Test: "942100-2", Result: Failed, Duration: time.Second, Evidence: &StageEvidence{Logs: []string{"942100"}}},
+		{Test: "942100-3", Result: Skipped},
+	} {
+		event := stageFinishedEvent(stage, 1, "id")
+		parsed, err := event.StageResult()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats.AddStage(parsed)
+	}
+	if stats.Run != 2 || stats.Success != 1 || len(stats.Failed) != 1 || len(stats.Skipped) != 1 ||
+		stats.RunTime != 2*time.Second || len(stats.Stages) != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if !reflect.DeepEqual(stats.TriggeredRules["942100-1"], []int{942100}) || !reflect.DeepEqual(stats.FailedLogs["942100.yaml"]["942100-2"], []string{"942100"}) {
+		t.Errorf("unexpected rules %v or logs %v", stats.TriggeredRules, stats.FailedLogs)
+	}
+	if _, err := (Event{Type: StageFinished, Result: "unknown"}).StageResult(); err == nil {
+		t.Error("unknown results must be an error")
+	}
+}
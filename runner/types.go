@@ -1,15 +1,21 @@
 package runner
 
 import (
+	"context"
+	"io"
 	"regexp"
 	"time"
 
 	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/embedded"
 	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/metrics"
+	"github.com/coreruleset/go-ftw/test"
 	"github.com/coreruleset/go-ftw/waflog"
 )
 
-// Config provides configuration for the test runner.
+// Config provides configuration for the test runner. Build it with NewConfig and the options, like
+// WithInclude, rather than with a literal.
 type Config struct {
 	// Include is a regular expression to filter tests to include. If nil, all tests are included.
 	Include *regexp.Regexp
@@ -23,6 +29,42 @@ type Config struct {
 	ConnectTimeout time.Duration
 	// ReadTimeout is the timeout for receiving responses during test execution.
 	ReadTimeout time.Duration
+	// MaxBodySize is the maximum number of bytes read from response bodies, 0 meaning no limit. If
+	// nil, the client default is used.
+	MaxBodySize *int64
+	// BodyTimeout is the timeout for reading response bodies, once the headers have been received.
+	BodyTimeout time.Duration
+	// Destination is the name of the destination profile of the configuration used for the tests
+	// whose file doesn't select one. If empty, the tests are sent to the destination they set.
+	Destination string
+	// Metrics collects the results of the run, to be served or pushed. If nil, no metrics are collected.
+	Metrics *metrics.Collector
+	// Events receives the events of the lifecycle of the run, like the end of every stage, as lines
+	// of JSON. If nil, no events are written.
+	Events io.Writer
+	// Evidence keeps the request, the response and the logs of the failed stages in their results
+	// and in their events
+	Evidence bool
+	// Context stops the run after the current stage once it's done, and is the parent of the spans
+	// of the run. If nil, the run goes on until all the tests ran.
+	Context context.Context
+	// Client sends the requests of the run. If nil, a client is created with the timeouts and the
+	// maximum body size above.
+	Client *ftwhttp.Client
+	// LogLines reads the logs of the WAF, and is left open at the end of the run. If nil, the logs
+	// of the configuration are read.
+	LogLines *waflog.FTWLogLines
+	// OnTestStart, OnStageComplete and OnRunComplete are the hooks of the run, see the ones of
+	// TestRunContext
+	OnTestStart     func(file string, testCase test.Test)
+	OnStageComplete func(stage StageResult)
+	OnRunComplete   func(stats TestStats)
+	// Plugins are called around the stages sending a request, in their order
+	Plugins []StagePlugin
+	// FailuresOnly prints only the failed stages, with their evidence, instead of every test
+	FailuresOnly bool
+	// DebugFailures prints the whole request, response and logs of the failed stages
+	DebugFailures bool
 }
 
 // TestRunContext carries information about the current test run.
@@ -39,4 +81,47 @@ type TestRunContext struct {
 	Client   *ftwhttp.Client
 	LogLines *waflog.FTWLogLines
 	RunMode  config.RunMode
+	// Engine evaluates the requests in embedded mode, instead of sending them with the client
+	Engine *embedded.Engine
+	// Config is the configuration of the run
+	Config *config.FTWConfiguration
+	// Destination is the name of the destination profile used for the tests whose file doesn't
+	// select one
+	Destination string
+	// Metrics collects the results of the stages, if not nil
+	Metrics *metrics.Collector
+	// Events receives the events of the run as lines of JSON, if not nil
+	Events io.Writer
+	// Evidence keeps the request, the response and the logs of the failed stages
+	Evidence bool
+	// Variables are the values captured from the logs by the stages, for the next ones
+	Variables map[string]string
+	// OnTestStart is called when a test starts, OnStageComplete with the result of every stage,
+	// the skipped tests included, and OnRunComplete with the statistics at the end of the run.
+	// They are called from the goroutine of the run, which waits for them, and are not called if nil.
+	OnTestStart     func(file string, testCase test.Test)
+	OnStageComplete func(stage StageResult)
+	OnRunComplete   func(stats TestStats)
+	// Plugins are called around the stages sending a request, in their order
+	Plugins []StagePlugin
+	// FailuresOnly prints only the failed stages, with their evidence, instead of every test
+	FailuresOnly bool
+	// DebugFailures prints the whole request, response and logs of the failed stages
+	DebugFailures bool
+	// Err is the error that stopped the run before all the tests ran, like a destination that
+	// can't be reached or a bad test. The statistics are the ones of the stages completed before.
+	Err error
+	// file is the file of the current test, and stage the number of its current stage
+	file  string
+	stage int
+	// metadata is the metadata of the current test, with the one of its file
+	metadata map[string]interface{}
+	// destination is the destination profile of the current test, if any
+	destination *config.FTWDestination
+	// ctx has the span of the current level of the run, like the file or the test, parent of the
+	// spans of the next level
+	ctx context.Context
+	// markersMissing is set when the markers were not found and the logs are selected by their
+	// timestamps instead
+	markersMissing bool
 }
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ServeHTTP serves the API:
+//
+//   - POST /jobs submits a job, with its JobRequest as JSON, and returns it;
+//   - GET /jobs returns the jobs, the oldest first;
+//   - GET /jobs/<id> returns a job, with the totals of its run when it finished;
+//   - GET /jobs/<id>/events streams the events of the run of a job as lines of JSON, from the
+//     first one until the end of the run;
+//   - POST /jobs/<id>/cancel cancels a job which isn't done, and returns it.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.Authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("ftw/service: missing or bad token"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Service) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		jobs := make([]Job, 0, len(s.jobs))
+		for _, job := range s.jobs {
+			jobs = append(jobs, *job)
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		var request JobRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		job, err := s.Submit(request)
+		if errors.Is(err, ErrQueueFull) {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		s.mu.Lock()
+		copied := *job
+		s.mu.Unlock()
+		writeJSON(w, http.StatusAccepted, copied)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("ftw/service: method not allowed"))
+	}
+}
+
+func (s *Service) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, page, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	method := http.MethodGet
+	if page == "cancel" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("ftw/service: method not allowed"))
+		return
+	}
+	job, err := s.Job(id)
+	switch {
+	case err != nil || (page != "" && page != "events" && page != "cancel"):
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	case page == "events":
+		s.streamEvents(w, r, id)
+	case page == "cancel":
+		job, err = s.Cancel(id)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	default:
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// streamEvents writes the events of the job as they are added, until the job is done or the
+// client goes away
+func (s *Service) streamEvents(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	_ = s.Follow(r.Context(), id, func(line []byte) error {
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
+
+// errorResponse is the body of the responses of the errors
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
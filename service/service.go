@@ -0,0 +1,437 @@
+// Package service implements the HTTP API of `ftw service`, which runs go-ftw as a service: the
+// jobs submitted run test sets against destinations, one at a time, and their results are
+// streamed as the events of the runs.
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+const (
+	// maxQueuedJobs is the number of jobs waiting to run, more are refused until some run
+	maxQueuedJobs = 100
+	// maxJobs is the number of jobs kept, the oldest finished ones are forgotten
+	maxJobs = 1000
+	// maxRequestSize is the size of the largest job request
+	maxRequestSize = 1 << 20
+	// jobDestination is the name of the destination profile of the jobs sending the tests to an
+	// address of their own
+	jobDestination = "job"
+)
+
+// The states of the jobs
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Finished  = "finished"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+var (
+	// ErrQueueFull is returned when a job is submitted while too many are waiting to run
+	ErrQueueFull = errors.New("ftw/service: too many jobs are waiting to run")
+	// ErrNotFound is returned for the jobs the service doesn't know
+	ErrNotFound = errors.New("ftw/service: no such job")
+	// ErrDone is returned when cancelling a job which is done
+	ErrDone = errors.New("ftw/service: the job is done")
+)
+
+// JobRequest is a job to run a test set against a destination
+type JobRequest struct {
+	// Dir is the directory of the tests, relative to the directory of the tests of the service
+	Dir string `json:"dir"`
+	// Files are the files of tests run, relative to Dir, instead of all the ones found in Dir
+	Files []string `json:"files,omitempty"`
+	// Include and Exclude are regular expressions selecting the tests by title
+	Include string `json:"include,omitempty"`
+	Exclude string `json:"exclude,omitempty"`
+	// Destination is the name of a destination profile of the configuration of the service
+	Destination string `json:"destination,omitempty"`
+	// DestAddr, Port and Protocol send the tests to this address, instead of the ones of the
+	// tests or of the destination profile
+	DestAddr string `json:"dest_addr,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// Evidence adds the request, the response and the logs of the failed stages to their events
+	Evidence bool `json:"evidence,omitempty"`
+}
+
+// Job is a job of the service
+type Job struct {
+	ID       string             `json:"id"`
+	Request  JobRequest         `json:"request"`
+	State    string             `json:"state"`
+	Created  time.Time          `json:"created"`
+	Started  *time.Time         `json:"started,omitempty"`
+	Finished *time.Time         `json:"finished,omitempty"`
+	Error    string             `json:"error,omitempty"`
+	Stats    *runner.EventStats `json:"stats,omitempty"`
+
+	// events are the lines of the events of the run, and changed is closed when one is added or
+	// the job is done, to wake up the streams of the events
+	events  [][]byte
+	changed chan struct{}
+	// include and exclude are the compiled regular expressions of the request
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	// cancel stops the run of the job, once it's running
+	cancel context.CancelFunc
+}
+
+// done returns whether the job finished, failed or was cancelled
+func (j *Job) done() bool {
+	return j.State == Finished || j.State == Failed || j.State == Cancelled
+}
+
+// Service runs the jobs and serves the API
+type Service struct {
+	cfg *config.FTWConfiguration
+	// dir is the directory of the test sets of the jobs
+	dir    string
+	config runner.Config
+	// token is the bearer token of the requests, empty when they are not authenticated
+	token string
+	queue chan *Job
+	mux   *http.ServeMux
+
+	mu   sync.Mutex
+	jobs []*Job
+	byID map[string]*Job
+}
+
+// New returns the service running the test sets below dir with the configuration of ftw and the
+// Config of the runner, and requiring the bearer token, unless it's empty. The jobs run once Run
+// is called.
+func New(cfg *config.FTWConfiguration, dir string, c runner.Config, token string) *Service {
+	s := &Service{
+		cfg:    cfg,
+		dir:    dir,
+		config: c,
+		token:  token,
+		queue:  make(chan *Job, maxQueuedJobs),
+		mux:    http.NewServeMux(),
+		byID:   map[string]*Job{},
+	}
+	s.mux.HandleFunc("/jobs", s.handleJobs)
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	return s
+}
+
+// Run runs the jobs in the order they were submitted, until the queue is closed by Close
+func (s *Service) Run() {
+	for job := range s.queue {
+		s.mu.Lock()
+		cancelled := job.State == Cancelled
+		s.mu.Unlock()
+		if !cancelled {
+			s.run(job)
+		}
+	}
+}
+
+// Close stops running the jobs once the ones queued ran
+func (s *Service) Close() {
+	close(s.queue)
+}
+
+// Submit queues a job and returns it
+func (s *Service) Submit(request JobRequest) (*Job, error) {
+	job := &Job{ID: uuid.NewString(), Request: request, State: Queued, Created: time.Now().UTC(), changed: make(chan struct{})}
+	if err := validate(job); err != nil {
+		return nil, err
+	}
+	if request.Destination != "" {
+		if _, ok := s.cfg.Destinations[request.Destination]; !ok {
+			return nil, fmt.Errorf("ftw/service: unknown destination %q", request.Destination)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- job:
+	default:
+		return nil, ErrQueueFull
+	}
+	s.jobs = append(s.jobs, job)
+	s.byID[job.ID] = job
+	s.forgetOldJobs()
+	return job, nil
+}
+
+// Job returns a copy of the job with the ID
+func (s *Service) Job(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.byID[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Cancel cancels the job with the ID: a queued job won't run, and the run of a running job stops
+// after its current stage
+func (s *Service) Cancel(id string) (Job, error) {
+	s.mu.Lock()
+	job, ok := s.byID[id]
+	s.mu.Unlock()
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	var err error
+	s.update(job, func() {
+		switch {
+		case job.done():
+			err = ErrDone
+		case job.State == Queued:
+			finished := time.Now().UTC()
+			job.State = Cancelled
+			job.Finished = &finished
+		default:
+			job.cancel()
+		}
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	return s.Job(id)
+}
+
+// Follow calls send with the lines of the events of the run of the job with the ID, from the
+// first one, as they are added, until the job is done or ctx is
+func (s *Service) Follow(ctx context.Context, id string, send func(line []byte) error) error {
+	s.mu.Lock()
+	job, ok := s.byID[id]
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	sent := 0
+	for {
+		s.mu.Lock()
+		lines := job.events[sent:]
+		done := job.done()
+		changed := job.changed
+		s.mu.Unlock()
+		for _, line := range lines {
+			if err := send(line); err != nil {
+				return err
+			}
+		}
+		sent += len(lines)
+		if done {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// validate checks the request of the job, and compiles its regular expressions
+func validate(job *Job) error {
+	if !below(job.Request.Dir) {
+		return fmt.Errorf("ftw/service: the directory %q is not below the directory of the tests", job.Request.Dir)
+	}
+	for _, file := range job.Request.Files {
+		if file == "" || !below(file) {
+			return fmt.Errorf("ftw/service: the file %q is not below the directory of the job", file)
+		}
+	}
+	var err error
+	if job.Request.Include != "" {
+		if job.include, err = regexp.Compile(job.Request.Include); err != nil {
+			return fmt.Errorf("ftw/service: bad include: %w", err)
+		}
+	}
+	if job.Request.Exclude != "" {
+		if job.exclude, err = regexp.Compile(job.Request.Exclude); err != nil {
+			return fmt.Errorf("ftw/service: bad exclude: %w", err)
+		}
+	}
+	if job.Request.Port < 0 || job.Request.Port > 65535 {
+		return fmt.Errorf("ftw/service: bad port %d", job.Request.Port)
+	}
+	if p := job.Request.Protocol; p != "" && p != "http" && p != "https" {
+		return fmt.Errorf("ftw/service: bad protocol %q, use http or https", p)
+	}
+	return nil
+}
+
+// below returns whether the relative path stays below its directory
+func below(path string) bool {
+	path = filepath.Clean(path)
+	return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
+
+// forgetOldJobs forgets the oldest finished jobs when there are too many
+func (s *Service) forgetOldJobs() {
+	for i := 0; len(s.jobs) > maxJobs && i < len(s.jobs); {
+		if !s.jobs[i].done() {
+			i++
+			continue
+		}
+		delete(s.byID, s.jobs[i].ID)
+		s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+	}
+}
+
+// run runs the tests of the job
+func (s *Service) run(job *Job) {
+	started := time.Now().UTC()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.update(job, func() {
+		job.State = Running
+		job.Started = &started
+		job.cancel = cancel
+	})
+	tests, err := s.jobTests(job)
+	if err == nil && len(tests) == 0 {
+		err = errors.New("no tests found")
+	}
+	if err != nil {
+		s.finish(job, Failed, fmt.Sprintf("ftw/service: can't read the tests: %s", err))
+		return
+	}
+
+	cfg, c := s.jobConfig(job)
+	c.Context = ctx
+	runContext := runner.Run(cfg, tests, c)
+	if runContext.Err != nil {
+		s.finish(job, Failed, fmt.Sprintf("ftw/service: the run stopped: %s", runContext.Err))
+		return
+	}
+	if ctx.Err() != nil {
+		s.finish(job, Cancelled, "")
+		return
+	}
+	s.finish(job, Finished, "")
+}
+
+// jobTests reads the tests of the job: the files of the request, or all the ones of its directory
+func (s *Service) jobTests(job *Job) ([]test.FTWTest, error) {
+	dir := filepath.Join(s.dir, filepath.Clean(job.Request.Dir))
+	if len(job.Request.Files) == 0 {
+		return test.GetTestsFromFiles(filepath.Join(dir, "**", "*.yaml"))
+	}
+	var tests []test.FTWTest
+	for _, file := range job.Request.Files {
+		found, err := test.GetTestsFromFiles(filepath.Join(dir, filepath.Clean(file)))
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, found...)
+	}
+	return tests, nil
+}
+
+// jobConfig returns the configuration of ftw and of the runner of the job
+func (s *Service) jobConfig(job *Job) (*config.FTWConfiguration, runner.Config) {
+	cfg := s.cfg
+	c := s.config
+	c.Quiet = true
+	c.Include, c.Exclude = job.include, job.exclude
+	c.Evidence = job.Request.Evidence
+	c.Events = &jobEvents{service: s, job: job}
+	if job.Request.Destination != "" {
+		c.Destination = job.Request.Destination
+	}
+	request := job.Request
+	if request.DestAddr == "" && request.Port == 0 && request.Protocol == "" {
+		return cfg, c
+	}
+	// the address of the job is a profile of a copy of the configuration, with the other values
+	// of the profile selected, if any
+	destination := cfg.Destinations[c.Destination]
+	if request.DestAddr != "" {
+		destination.DestAddr = request.DestAddr
+	}
+	if request.Port != 0 {
+		destination.Port = request.Port
+	}
+	if request.Protocol != "" {
+		destination.Protocol = request.Protocol
+	}
+	copied := *cfg
+	copied.Destinations = map[string]config.FTWDestination{jobDestination: destination}
+	for name, profile := range cfg.Destinations {
+		if name != jobDestination {
+			copied.Destinations[name] = profile
+		}
+	}
+	c.Destination = jobDestination
+	return &copied, c
+}
+
+// update changes the job and wakes up the streams of its events
+func (s *Service) update(job *Job, change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change()
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+func (s *Service) finish(job *Job, state string, message string) {
+	finished := time.Now().UTC()
+	s.update(job, func() {
+		job.State = state
+		job.Error = message
+		job.Finished = &finished
+	})
+	if message != "" {
+		log.Error().Msgf("%s, job %s", message, job.ID)
+	}
+}
+
+// jobEvents keeps the events of the run of a job
+type jobEvents struct {
+	service *Service
+	job     *Job
+}
+
+func (w *jobEvents) Write(p []byte) (int, error) {
+	line := append([]byte{}, p...)
+	var event runner.Event
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	w.service.update(w.job, func() {
+		w.job.events = append(w.job.events, line)
+		if event.Type == runner.RunFinished {
+			w.job.Stats = event.Stats
+		}
+	})
+	return len(p), nil
+}
+
+// Authorized returns whether the request has the token of the service, if it needs one
+func (s *Service) Authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var yamlTests = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "942100.yaml"
+tests:
+  - test_title: "942100-1"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1%27%20or%201=1"
+          output:
+            log:
+              rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            dest_addr: "localhost"
+            port: 1
+            uri: "/?id=1"
+          output:
+            log:
+              no_rule_ids: [942100]
+`
+
+// newTestService returns a service running the tests of sqli/ with the embedded WAF, whose rule
+// matches the request of 942100-2 too, which expects it not to
+func newTestService(t *testing.T, token string) (*Service, *httptest.Server) {
+	rules, err := utils.CreateTempFileWithContent(`SecRule ARGS:id "@rx 1" "id:942100,phase:2,deny,status:403,log,msg:'SQL Injection Attack'"`, "rules-*.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(rules) })
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("---\nmode: embedded\nembedded:\n  rules: [%q]\ndestinations:\n  staging:\n    destaddr: staging.example.com\n    port: 8080\n", rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sqli"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sqli", "942100.yaml"), []byte(yamlTests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(cfg, dir, runner.Config{}, token)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func submit(t *testing.T, url string, body string) (*http.Response, Job) {
+	resp, err := http.Post(url+"/jobs", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	if resp.StatusCode == http.StatusAccepted {
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, job
+}
+
+func getJob(t *testing.T, url string, id string) Job {
+	resp, err := http.Get(url + "/jobs/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestJob(t *testing.T) {
+	s, ts := newTestService(t, "")
+	go s.Run()
+	t.Cleanup(s.Close)
+
+	resp, job := submit(t, ts.URL, `{"dir": "sqli", "exclude": "942100-1"}`)
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Location") != "/jobs/"+job.ID || job.ID == "" {
+		t.Fatalf("unexpected response %d %+v", resp.StatusCode, job)
+	}
+
+	// the events are streamed until the end of the run
+	events, err := http.Get(ts.URL + "/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+	if events.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("unexpected content type %s", events.Header.Get("Content-Type"))
+	}
+	var types []string
+	scanner := bufio.NewScanner(events.Body)
+	for scanner.Scan() {
+		var event runner.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("bad event %s: %s", scanner.Text(), err)
+		}
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "run_started,stage_finished,test_started,stage_finished,run_finished" {
+		t.Errorf("unexpected events %v", types)
+	}
+
+	job = getJob(t, ts.URL, job.ID)
+	if job.State != Finished || job.Started == nil || job.Finished == nil || job.Stats == nil ||
+		job.Stats.Skipped != 1 || len(job.Stats.Failed) != 1 || job.Stats.Failed[0] != "942100-2" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var jobs []Job
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+}
+
+func TestJobWithoutTests(t *testing.T) {
+	s, ts := newTestService(t, "")
+	go s.Run()
+	t.Cleanup(s.Close)
+	_, job := submit(t, ts.URL, `{"dir": "xss"}`)
+	events, err := http.Get(ts.URL + "/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events.Body.Close()
+
+	job = getJob(t, ts.URL, job.ID)
+	if job.State != Failed || !strings.Contains(job.Error, "no tests found") {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestJobFiles(t *testing.T) {
+	s, ts := newTestService(t, "")
+	go s.Run()
+	t.Cleanup(s.Close)
+	for files, state := range map[string]string{`["942100.yaml"]`: Finished, `["941100.yaml"]`: Failed} {
+		_, job := submit(t, ts.URL, `{"dir": "sqli", "files": `+files+`}`)
+		events, err := http.Get(ts.URL + "/jobs/" + job.ID + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		events.Body.Close()
+
+		job = getJob(t, ts.URL, job.ID)
+		if job.State != state {
+			t.Errorf("unexpected job for %s %+v", files, job)
+		}
+		if state == Finished && (job.Stats == nil || job.Stats.Run != 2) {
+			t.Errorf("unexpected stats for %s %+v", files, job.Stats)
+		}
+	}
+}
+
+func TestJobUnreachableDestination(t *testing.T) {
+	cfg, err := config.NewConfigFromString("---\nmode: cloud\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "942100.yaml"), []byte(yamlTests), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(cfg, dir, runner.Config{ConnectTimeout: time.Second}, "")
+	go s.Run()
+	t.Cleanup(s.Close)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	// the service runs the next jobs after the failed one
+	for i := 0; i < 2; i++ {
+		_, job := submit(t, ts.URL, `{"dir": ".", "dest_addr": "127.0.0.1", "port": 1}`)
+		events, err := http.Get(ts.URL + "/jobs/" + job.ID + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(events.Body)
+		events.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(body), `"error":"ftw/run: can't connect to destination 127.0.0.1:1`) {
+			t.Errorf("the end of the run must have its error, got\n%s", body)
+		}
+
+		job = getJob(t, ts.URL, job.ID)
+		if job.State != Failed || !strings.Contains(job.Error, "can't connect to destination") {
+			t.Errorf("unexpected job %+v", job)
+		}
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	_, ts := newTestService(t, "")
+	for _, body := range []string{
+		`{"dir": "../other"}`,
+		`{"dir": "/etc"}`,
+		`{"dir": "sqli", "include": "("}`,
+		`{"dir": "sqli", "destination": "production"}`,
+		`{"dir": "sqli", "protocol": "ftp"}`,
+		`{"dir": "sqli", "unknown": true}`,
+		`{"dir": "sqli", "files": ["../../942100.yaml"]}`,
+		`{"dir": "sqli", "files": [""]}`,
+		`not json`,
+	} {
+		if resp, _ := submit(t, ts.URL, body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected %d for %s, got %d", http.StatusBadRequest, body, resp.StatusCode)
+		}
+	}
+	for _, path := range []string{"/jobs/unknown", "/jobs/unknown/events", "/jobs/unknown/other"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected %d for %s, got %d", http.StatusNotFound, path, resp.StatusCode)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	_, ts := newTestService(t, "secret")
+	for token, status := range map[string]int{"": http.StatusUnauthorized, "Bearer other": http.StatusUnauthorized, "Bearer secret": http.StatusOK} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/jobs", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("expected %d with %q, got %d", status, token, resp.StatusCode)
+		}
+	}
+}
+
+func TestJobConfig(t *testing.T) {
+	s, _ := newTestService(t, "")
+	job := &Job{Request: JobRequest{Destination: "staging", Port: 8443, Protocol: "https", Evidence: true}}
+	cfg, c := s.jobConfig(job)
+	if c.Destination != jobDestination || !c.Evidence || !c.Quiet {
+		t.Errorf("unexpected config of the runner %+v", c)
+	}
+	expected := config.FTWDestination{DestAddr: "staging.example.com", Port: 8443, Protocol: "https"}
+	if cfg.Destinations[jobDestination] != expected || len(cfg.Destinations) != 2 {
+		t.Errorf("unexpected destinations %+v", cfg.Destinations)
+	}
+	if _, ok := s.cfg.Destinations[jobDestination]; ok {
+		t.Errorf("the configuration of the service must not change")
+	}
+
+	job = &Job{Request: JobRequest{Destination: "staging"}}
+	if cfg, c = s.jobConfig(job); cfg != s.cfg || c.Destination != "staging" {
+		t.Errorf("expected the destination profile, got %s", c.Destination)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s, ts := newTestService(t, "")
+	cancelled, err := s.Submit(JobRequest{Dir: "sqli"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := s.Submit(JobRequest{Dir: "sqli"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queued job won't run
+	resp, err := http.Post(ts.URL+"/jobs/"+cancelled.ID+"/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if _, err := s.Cancel(cancelled.ID); err != ErrDone {
+		t.Errorf("expected %v, got %v", ErrDone, err)
+	}
+	if _, err := s.Cancel("unknown"); err != ErrNotFound {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	go s.Run()
+	t.Cleanup(s.Close)
+	var lines int
+	if err := s.Follow(context.Background(), next.ID, func([]byte) error { lines++; return nil }); err != nil || lines == 0 {
+		t.Errorf("expected the events of the next job, got %d, %v", lines, err)
+	}
+	job, err := s.Job(cancelled.ID)
+	if err != nil || job.State != Cancelled || job.Started != nil || len(job.events) != 0 {
+		t.Errorf("unexpected cancelled job %+v, %v", job, err)
+	}
+}
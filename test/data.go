@@ -2,28 +2,108 @@ package test
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
 	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
 )
 
 // ParseData returns the data from the test. Will parse and interpret Go text/template inside it.
+// Bodies read from `data_file`, `data_b64`, or `json` are returned as they are.
 func (i *Input) ParseData() []byte {
+	return i.ParseDataWithVariables(nil)
+}
+
+// ParseDataWithVariables returns the data from the test like ParseData, with the variables
+// captured by previous stages available in the template as `{{ .Vars.name }}`
+func (i *Input) ParseDataWithVariables(vars map[string]string) []byte {
 	var err error
 	var tpl bytes.Buffer
 
+	if i.body != nil {
+		return i.body
+	}
+
 	// Parse data for Go template
 	if i.Data != nil {
-		t := template.New("ftw").Funcs(sprig.TxtFuncMap())
+		t := template.New("ftw").Funcs(sprig.TxtFuncMap()).Option("missingkey=zero")
 		t, err = t.Parse(*i.Data)
 		if err != nil {
 			log.Debug().Msgf("test/data: error parsing template in data: %s", err.Error())
 		}
-		if err = t.Execute(&tpl, nil); err != nil {
+		if err = t.Execute(&tpl, map[string]interface{}{"Vars": vars}); err != nil {
 			log.Debug().Msgf("test/data: error executing template: %s", err.Error())
 		}
 	}
 
 	return tpl.Bytes()
 }
+
+// loadBody reads the body from `data_file`, relative to dir, decodes the base64 encoded
+// `data_b64` and `raw_request_b64`, and serializes `json`
+func (i *Input) loadBody(dir string) error {
+	var err error
+
+	if (i.DataFile != "" && i.DataB64 != "") || (i.JSON != nil && (i.DataFile != "" || i.DataB64 != "")) {
+		return errors.New("choose between data_file, data_b64, and json")
+	}
+	if i.DataFile != "" {
+		if i.body, err = os.ReadFile(resolvePath(dir, i.DataFile)); err != nil {
+			return fmt.Errorf("cannot read data_file: %w", err)
+		}
+	}
+	if i.DataB64 != "" {
+		if i.body, err = base64.StdEncoding.DecodeString(i.DataB64); err != nil {
+			return fmt.Errorf("cannot decode data_b64: %w", err)
+		}
+	}
+	if i.JSON != nil {
+		if i.body, err = json.Marshal(i.JSON); err != nil {
+			return fmt.Errorf("cannot serialize json: %w", err)
+		}
+		if i.Headers == nil {
+			i.Headers = ftwhttp.Header{}
+		}
+		if i.Headers.Get(ftwhttp.ContentTypeHeader) == "" {
+			i.Headers.Set(ftwhttp.ContentTypeHeader, "application/json")
+		}
+	}
+	if i.RAWRequestB64 != "" {
+		if i.rawRequest, err = base64.StdEncoding.DecodeString(i.RAWRequestB64); err != nil {
+			return fmt.Errorf("cannot decode raw_request_b64: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadHeaderFiles sets the headers of `header_files` to the contents of their files, relative to
+// dir, without the trailing line break. API keys and auth tokens can be read from mounted secret
+// files instead of being written in the YAML.
+func (i *Input) LoadHeaderFiles(dir string) error {
+	names := make([]string, 0, len(i.HeaderFiles))
+	for name := range i.HeaderFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		contents, err := os.ReadFile(resolvePath(dir, i.HeaderFiles[name]))
+		if err != nil {
+			return fmt.Errorf("cannot read header_files %s: %w", name, err)
+		}
+		if i.Headers == nil {
+			i.Headers = ftwhttp.Header{}
+		}
+		i.Headers.Set(name, strings.TrimRight(string(contents), "\r\n"))
+	}
+	return nil
+}
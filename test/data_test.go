@@ -2,6 +2,8 @@ package test
 
 import (
 	"bytes"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/goccy/go-yaml"
@@ -87,3 +89,214 @@ uri: "/"
 		t.Fatalf("Failed: %s", data)
 	}
 }
+
+var yamlDataFileTest = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            method: "POST"
+            data_file: "payloads/body.bin"
+          output:
+            status: [200]
+`
+
+func TestDataFile(t *testing.T) {
+	body := []byte("{{ not a template }}\x00\xff\xfe")
+	dir := writeTestFiles(t, map[string]string{
+		"tests/911100.yaml":       yamlDataFileTest,
+		"tests/payloads/body.bin": string(body),
+	})
+
+	tests, err := GetTestsFromFiles(filepath.Join(dir, "tests", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := tests[0].Tests[0].Stages[0].Stage.Input
+	if data := input.ParseData(); !bytes.Equal(data, body) {
+		t.Errorf("expected body to be sent as it is, got %q", data)
+	}
+}
+
+func TestDataFileMissing(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"911100.yaml": yamlDataFileTest,
+	})
+
+	if _, err := GetTestsFromFiles(filepath.Join(dir, "*.yaml")); err == nil {
+		t.Error("expected error for missing data_file")
+	}
+}
+
+var yamlHeaderFilesTest = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            headers:
+              Authorization: "Bearer committed"
+              User-Agent: "ModSecurity CRS 3 Tests"
+            header_files:
+              Authorization: "secrets/token"
+            include:
+              - "snippets/api.yaml"
+          output:
+            status: [200]
+`
+
+func TestHeaderFiles(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"tests/911100.yaml":       yamlHeaderFilesTest,
+		"tests/secrets/token":     "Bearer secret\n",
+		"tests/snippets/api.yaml": "header_files:\n  X-Api-Key: 'key'\n  Authorization: 'other'\n",
+		"tests/snippets/key":      "abc123\r\n",
+	})
+
+	tests, err := GetTestsFromFiles(filepath.Join(dir, "tests", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := tests[0].Tests[0].Stages[0].Stage.Input
+	// the files of the test win over the ones of the include, and replace the headers
+	if auth := input.Headers.Values("Authorization"); len(auth) != 1 || auth[0] != "Bearer secret" {
+		t.Errorf("unexpected Authorization %v", auth)
+	}
+	if key := input.Headers.Get("X-Api-Key"); key != "abc123" {
+		t.Errorf("the files of the include must be relative to it, got %q", key)
+	}
+	if input.Headers.Get("User-Agent") == "" {
+		t.Error("the other headers must be kept")
+	}
+}
+
+func TestHeaderFilesMissing(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"911100.yaml":       yamlHeaderFilesTest,
+		"snippets/api.yaml": "header_files:\n  X-Api-Key: 'key'\n",
+		"snippets/key":      "abc123",
+	})
+
+	if _, err := GetTestsFromFiles(filepath.Join(dir, "*.yaml")); err == nil {
+		t.Error("expected error for missing header file")
+	}
+}
+
+var yamlBase64Test = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            method: "POST"
+            data_b64: "YT0AYv8="
+          output:
+            status: [200]
+      - stage:
+          input:
+            raw_request_b64: "R0VUIC8/YT0AIEhUVFAvMS4xDQoNCg=="
+          output:
+            status: [200]
+`
+
+func TestDataBase64(t *testing.T) {
+	ftwTest, err := GetTestFromYaml([]byte(yamlBase64Test))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stages := ftwTest.Tests[0].Stages
+	if data := stages[0].Stage.Input.ParseData(); !bytes.Equal(data, []byte("a=\x00b\xff")) {
+		t.Errorf("unexpected body %q", data)
+	}
+	raw, err := stages[1].Stage.Input.GetRawRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, []byte("GET /?a=\x00 HTTP/1.1\r\n\r\n")) {
+		t.Errorf("unexpected raw request %q", raw)
+	}
+}
+
+func TestDataBase64Invalid(t *testing.T) {
+	invalid := strings.Replace(yamlBase64Test, "YT0AYv8=", "not base64!", 1)
+	if _, err := GetTestFromYaml([]byte(invalid)); err == nil {
+		t.Error("expected error for invalid base64")
+	}
+}
+
+var yamlJSONTest = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            method: "POST"
+            json:
+              user: "admin' OR 1=1--"
+              roles: ["admin", 1]
+              nested:
+                enabled: true
+          output:
+            status: [200]
+      - stage:
+          input:
+            method: "POST"
+            headers:
+              Content-Type: "application/vnd.api+json"
+            json: ["a", "b"]
+          output:
+            status: [200]
+`
+
+func TestDataJSON(t *testing.T) {
+	ftwTest, err := GetTestFromYaml([]byte(yamlJSONTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := ftwTest.Tests[0].Stages[0].Stage.Input
+	expected := `{"nested":{"enabled":true},"roles":["admin",1],"user":"admin' OR 1=1--"}`
+	if data := string(input.ParseData()); data != expected {
+		t.Errorf("unexpected body %s", data)
+	}
+	if ct := input.Headers.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %s", ct)
+	}
+
+	input = ftwTest.Tests[0].Stages[1].Stage.Input
+	if data := string(input.ParseData()); data != `["a","b"]` {
+		t.Errorf("unexpected body %s", data)
+	}
+	if ct := input.Headers.Get("Content-Type"); ct != "application/vnd.api+json" {
+		t.Errorf("content type must not be changed, got %s", ct)
+	}
+}
+
+func TestParseDataWithVariables(t *testing.T) {
+	data := `id={{ .Vars.transaction }}&q={{ .Vars.missing | default "none" }}`
+	input := Input{Data: &data}
+
+	vars := map[string]string{"transaction": "X-PNFSe1VwjCgYRI9FsbHgAAAIY"}
+	if parsed := string(input.ParseDataWithVariables(vars)); parsed != "id=X-PNFSe1VwjCgYRI9FsbHgAAAIY&q=none" {
+		t.Errorf("unexpected data %s", parsed)
+	}
+	if parsed := string(input.ParseData()); parsed != "id=&q=none" {
+		t.Errorf("unexpected data without variables %s", parsed)
+	}
+}
@@ -51,7 +51,7 @@ func (i *Input) GetPort() int {
 	if i.Port == nil {
 		return 80
 	}
-	return *i.Port
+	return int(*i.Port)
 }
 
 // GetRawRequest returns the proper raw data, and error if there was none
@@ -63,5 +63,16 @@ func (i *Input) GetRawRequest() ([]byte, error) {
 	if utils.IsNotEmpty(i.RAWRequest) {
 		return []byte(i.RAWRequest), nil
 	}
+	if i.rawRequest != nil {
+		return i.rawRequest, nil
+	}
 	return nil, nil
 }
+
+// GetRepeat returns the number of times the request of the stage is sent, at least once
+func (s *Stage) GetRepeat() int {
+	if s.Repeat < 1 {
+		return 1
+	}
+	return s.Repeat
+}
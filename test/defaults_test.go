@@ -11,7 +11,7 @@ func getTestInputDefaults() *Input {
 	data := "My Data"
 
 	inputDefaults := Input{
-		Headers:    make(ftwhttp.Header),
+		Headers:    ftwhttp.Header{},
 		Data:       &data,
 		SaveCookie: false,
 		StopMagic:  false,
@@ -21,7 +21,7 @@ func getTestInputDefaults() *Input {
 
 func getTestExampleInput() *Input {
 	destaddr := "192.168.0.1"
-	port := 8080
+	port := Port(8080)
 	protocol := "http"
 	uri := "/test"
 	method := "REPORT"
@@ -33,7 +33,7 @@ func getTestExampleInput() *Input {
 		Protocol:       &protocol,
 		URI:            &uri,
 		Version:        &version,
-		Headers:        make(ftwhttp.Header),
+		Headers:        ftwhttp.Header{},
 		Method:         &method,
 		Data:           nil,
 		EncodedRequest: "TXkgRGF0YQo=",
@@ -46,7 +46,7 @@ func getTestExampleInput() *Input {
 
 func getRawInput() *Input {
 	destaddr := "192.168.0.1"
-	port := 8080
+	port := Port(8080)
 	protocol := "http"
 
 	inputTest := Input{
@@ -0,0 +1,34 @@
+package test
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration written in YAML as a Go duration string, like `500ms` or `1m30s`
+type Duration time.Duration
+
+// UnmarshalYAML reads the duration
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	s := fmt.Sprint(value)
+	// a plain 0 needs no unit
+	if s == "0" {
+		*d = 0
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("invalid duration %q, use a positive Go duration like 500ms or 2s", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes the duration as a Go duration string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestDuration(t *testing.T) {
+	var tests = []struct {
+		yaml     string
+		expected time.Duration
+	}{
+		{`delay_before: 500ms`, 500 * time.Millisecond},
+		{`delay_before: "1m30s"`, 90 * time.Second},
+		{`delay_before: 0`, 0},
+	}
+
+	for _, tc := range tests {
+		var stage Stage
+		if err := yaml.Unmarshal([]byte(tc.yaml), &stage); err != nil {
+			t.Errorf("%s: %s", tc.yaml, err.Error())
+			continue
+		}
+		if time.Duration(stage.DelayBefore) != tc.expected {
+			t.Errorf("%s: got %s, want %s", tc.yaml, time.Duration(stage.DelayBefore), tc.expected)
+		}
+	}
+}
+
+func TestDurationInvalid(t *testing.T) {
+	for _, invalid := range []string{`delay_after: 5`, `delay_after: "soon"`, `delay_after: -1s`} {
+		var stage Stage
+		if err := yaml.Unmarshal([]byte(invalid), &stage); err == nil {
+			t.Errorf("%s: expected error, got %s", invalid, time.Duration(stage.DelayAfter))
+		}
+	}
+}
+
+func TestDurationMarshal(t *testing.T) {
+	out, err := yaml.Marshal(Stage{DelayAfter: Duration(2 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stage Stage
+	if err = yaml.Unmarshal(out, &stage); err != nil {
+		t.Fatal(err)
+	}
+	if stage.DelayAfter != Duration(2*time.Second) || stage.DelayBefore != 0 {
+		t.Errorf("unexpected delays after reading %q", out)
+	}
+}
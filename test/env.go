@@ -0,0 +1,44 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+// Port is the port of the destination of a stage. In YAML, it can be written as a number, or as
+// a reference to an environment variable holding the number, like `${WAF_PORT}`.
+type Port int
+
+// UnmarshalYAML reads a port, expanding the environment variables it references
+func (p *Port) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	port, err := strconv.Atoi(utils.ExpandEnv(fmt.Sprint(value)))
+	if err != nil {
+		return fmt.Errorf("invalid port %v, use a number or an environment variable set to one", value)
+	}
+	*p = Port(port)
+	return nil
+}
+
+// expandEnv replaces the references to environment variables in the destination and the headers
+// of the input. The other fields, like the payloads, are sent as they are written.
+func (i *Input) expandEnv() {
+	if i.DestAddr != nil {
+		destAddr := utils.ExpandEnv(*i.DestAddr)
+		i.DestAddr = &destAddr
+	}
+	if i.Headers != nil {
+		headers := make(ftwhttp.Header, 0, len(i.Headers))
+		for _, field := range i.Headers {
+			headers = append(headers, ftwhttp.HeaderField{Name: field.Name, Value: utils.ExpandEnv(field.Value)})
+		}
+		i.Headers = headers
+	}
+}
@@ -0,0 +1,19 @@
+package test
+
+import "reflect"
+
+// WithExpectation returns the output with the keys it doesn't set taken from platform, the output
+// its canonical expectation stands for on the platform under test
+func (o Output) WithExpectation(platform Output) Output {
+	merged := o
+	merged.Expect = ""
+
+	dst := reflect.ValueOf(&merged).Elem()
+	src := reflect.ValueOf(platform)
+	for n := 0; n < dst.NumField(); n++ {
+		if dst.Type().Field(n).IsExported() && dst.Field(n).IsZero() {
+			dst.Field(n).Set(src.Field(n))
+		}
+	}
+	return merged
+}
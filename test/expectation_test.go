@@ -0,0 +1,32 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestWithExpectation(t *testing.T) {
+	var output Output
+	if err := yaml.Unmarshal([]byte("expect: blocked\nlog_contains: 'id \"942100\"'\n"), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.Expect != "blocked" {
+		t.Fatalf("unexpected expectation %q", output.Expect)
+	}
+
+	merged := output.WithExpectation(Output{Status: StatusList{406}, LogContains: PatternList{"ignored"}})
+	if merged.Expect != "" {
+		t.Error("the expectation must be replaced")
+	}
+	if !reflect.DeepEqual(merged.Status, StatusList{406}) {
+		t.Errorf("the status of the platform must be used, got %v", merged.Status)
+	}
+	if !reflect.DeepEqual(merged.LogContains, output.LogContains) {
+		t.Errorf("the keys of the test must win, got %v", merged.LogContains)
+	}
+	if !merged.hasAssertion() || !output.hasAssertion() {
+		t.Error("an expectation is an assertion")
+	}
+}
@@ -2,13 +2,18 @@ package test
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/goccy/go-yaml"
 	"github.com/rs/zerolog/log"
 	"github.com/yargevad/filepathx"
 )
 
+// ErrNoTests is returned when no test file matches the pattern
+var ErrNoTests = errors.New("no tests found")
+
 // GetTestsFromFiles will get the files to be processed.
 // If some file has yaml error, will stop processing and
 // return the error with the partial list of files read.
@@ -30,7 +35,7 @@ func GetTestsFromFiles(globPattern string) ([]FTWTest, error) {
 		if err != nil {
 			return tests, err
 		}
-		ftwTest, err := GetTestFromYaml(yamlString)
+		ftwTest, err := getTestFromYaml(yamlString, filepath.Dir(fileName))
 		if err != nil {
 			return tests, err
 		}
@@ -40,24 +45,61 @@ func GetTestsFromFiles(globPattern string) ([]FTWTest, error) {
 	}
 
 	if len(tests) == 0 {
-		return tests, errors.New("no tests found")
+		return tests, ErrNoTests
 	}
 	return tests, nil
 }
 
 // GetTestFromYaml will get the tests to be processed from a YAML string.
+// Files referenced by the tests are relative to the current directory.
 func GetTestFromYaml(testYaml []byte) (ftwTest FTWTest, err error) {
+	return getTestFromYaml(testYaml, "")
+}
+
+// getTestFromYaml reads the tests, and loads the files referenced by the tests relative to dir
+func getTestFromYaml(testYaml []byte, dir string) (ftwTest FTWTest, err error) {
 	ftwTest, err = readTestYaml(testYaml)
 	if err != nil {
 		log.Info().Msgf(yaml.FormatError(err, true, true))
 		return FTWTest{}, err
 	}
 
+	if err = ftwTest.loadInputs(dir); err != nil {
+		return FTWTest{}, err
+	}
+
 	return ftwTest, nil
 }
 
+// loadInputs resolves the includes and the gRPC descriptor sets of the inputs of all stages,
+// expands the environment variables of their destinations and headers, and loads their bodies and
+// the headers of `header_files` from files
+func (f *FTWTest) loadInputs(dir string) error {
+	for i := range f.Tests {
+		for j := range f.Tests[i].Stages {
+			input := &f.Tests[i].Stages[j].Stage.Input
+			// the descriptor set of the input is relative to the test, the ones of the included
+			// snippets to the snippets
+			if input.GRPC != nil {
+				input.GRPC.DescriptorSet = resolvePath(dir, input.GRPC.DescriptorSet)
+			}
+			if err := input.resolveIncludes(dir, nil); err != nil {
+				return fmt.Errorf("ftw/test: test %s: %w", f.Tests[i].TestTitle, err)
+			}
+			input.expandEnv()
+			if err := input.loadBody(dir); err != nil {
+				return fmt.Errorf("ftw/test: test %s: %w", f.Tests[i].TestTitle, err)
+			}
+			if err := input.LoadHeaderFiles(dir); err != nil {
+				return fmt.Errorf("ftw/test: test %s: %w", f.Tests[i].TestTitle, err)
+			}
+		}
+	}
+	return nil
+}
+
 func readTestYaml(testYaml []byte) (t FTWTest, err error) {
-	err = yaml.Unmarshal([]byte(testYaml), &t)
+	err = yaml.Unmarshal(testYaml, &t)
 	return t, err
 }
 
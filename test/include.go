@@ -0,0 +1,94 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
+
+// resolveIncludes merges the included snippets into the input. Values set in the input win over the
+// included ones, and later includes win over earlier ones. seen holds the files being included, to detect
+// include loops.
+func (i *Input) resolveIncludes(dir string, seen []string) error {
+	includes := i.Include
+	i.Include = nil
+
+	for n := len(includes) - 1; n >= 0; n-- {
+		fileName := resolvePath(dir, includes[n])
+		for _, s := range seen {
+			if s == fileName {
+				return fmt.Errorf("include loop: %s -> %s", strings.Join(seen, " -> "), fileName)
+			}
+		}
+
+		contents, err := os.ReadFile(fileName)
+		if err != nil {
+			return fmt.Errorf("cannot read include: %w", err)
+		}
+		var snippet Input
+		if err = yaml.Unmarshal(contents, &snippet); err != nil {
+			return fmt.Errorf("cannot parse include %s: %w", fileName, err)
+		}
+		// files referenced by the snippet are relative to the snippet
+		snippet.DataFile = resolvePath(filepath.Dir(fileName), snippet.DataFile)
+		for name, headerFile := range snippet.HeaderFiles {
+			snippet.HeaderFiles[name] = resolvePath(filepath.Dir(fileName), headerFile)
+		}
+		if snippet.GRPC != nil {
+			snippet.GRPC.DescriptorSet = resolvePath(filepath.Dir(fileName), snippet.GRPC.DescriptorSet)
+		}
+		if err = snippet.resolveIncludes(filepath.Dir(fileName), append(seen, fileName)); err != nil {
+			return err
+		}
+		i.mergeDefaults(snippet)
+	}
+	return nil
+}
+
+// mergeDefaults sets every field that is not set in the input to its value in defaults.
+// Headers and header files are merged by name, the headers of the snippet are added after the
+// ones of the input.
+func (i *Input) mergeDefaults(defaults Input) {
+	headers := i.Headers
+	if len(defaults.Headers) > 0 && headers == nil {
+		headers = ftwhttp.Header{}
+	}
+	for _, field := range defaults.Headers {
+		if i.Headers.Values(field.Name) == nil {
+			headers.Append(field.Name, field.Value)
+		}
+	}
+	headerFiles := i.HeaderFiles
+	if len(defaults.HeaderFiles) > 0 && headerFiles == nil {
+		headerFiles = map[string]string{}
+	}
+	for name, headerFile := range defaults.HeaderFiles {
+		if _, ok := headerFiles[name]; !ok {
+			headerFiles[name] = headerFile
+		}
+	}
+
+	dst := reflect.ValueOf(i).Elem()
+	src := reflect.ValueOf(defaults)
+	for n := 0; n < dst.NumField(); n++ {
+		if dst.Type().Field(n).IsExported() && dst.Field(n).IsZero() {
+			dst.Field(n).Set(src.Field(n))
+		}
+	}
+	i.Headers = headers
+	i.HeaderFiles = headerFiles
+}
+
+// resolvePath returns the file name relative to dir, unless it is empty or absolute
+func resolvePath(dir string, fileName string) string {
+	if fileName == "" || filepath.IsAbs(fileName) {
+		return fileName
+	}
+	return filepath.Join(dir, fileName)
+}
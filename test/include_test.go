@@ -0,0 +1,117 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var yamlIncludeTest = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            include: ["snippets/crs.yml", "snippets/method.yml"]
+            headers:
+              Accept: "text/html"
+              User-Agent: "Custom"
+          output:
+            status: [200]
+`
+
+var yamlCRSSnippet = `include: ["common.yml"]
+port: 8080
+method: "POST"
+headers:
+  User-Agent: "OWASP CRS test agent"
+  Accept: "*/*"
+`
+
+var yamlCommonSnippet = `dest_addr: "localhost"
+port: 80
+headers:
+  Host: "localhost"
+`
+
+var yamlMethodSnippet = `method: "OPTIONS"
+`
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		fileName := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestIncludeSnippets(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"tests/911100.yaml":         yamlIncludeTest,
+		"tests/snippets/crs.yml":    yamlCRSSnippet,
+		"tests/snippets/common.yml": yamlCommonSnippet,
+		"tests/snippets/method.yml": yamlMethodSnippet,
+	})
+
+	tests, err := GetTestsFromFiles(filepath.Join(dir, "tests", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := tests[0].Tests[0].Stages[0].Stage.Input
+	if input.Include != nil {
+		t.Errorf("includes must be resolved, got %v", input.Include)
+	}
+	if input.GetDestAddr() != "localhost" {
+		t.Errorf("expected dest_addr from nested include, got %s", input.GetDestAddr())
+	}
+	if input.GetPort() != 8080 {
+		t.Errorf("including snippet must win over nested include, got port %d", input.GetPort())
+	}
+	if input.GetMethod() != "OPTIONS" {
+		t.Errorf("later include must win, got method %s", input.GetMethod())
+	}
+	expected := map[string]string{
+		"Host":       "localhost",
+		"Accept":     "text/html",
+		"User-Agent": "Custom",
+	}
+	for name, value := range expected {
+		if input.Headers.Get(name) != value {
+			t.Errorf("expected header %s: %s, got %q", name, value, input.Headers.Get(name))
+		}
+	}
+}
+
+func TestIncludeLoop(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"911100.yaml": strings.Replace(yamlIncludeTest, `["snippets/crs.yml", "snippets/method.yml"]`, `["a.yml"]`, 1),
+		"a.yml":       `include: ["b.yml"]`,
+		"b.yml":       `include: ["a.yml"]`,
+	})
+
+	_, err := GetTestsFromFiles(filepath.Join(dir, "*.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "include loop") {
+		t.Errorf("expected include loop error, got %v", err)
+	}
+}
+
+func TestIncludeMissingFile(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"911100.yaml": yamlIncludeTest,
+	})
+
+	if _, err := GetTestsFromFiles(filepath.Join(dir, "*.yaml")); err == nil {
+		t.Error("expected error for missing include")
+	}
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lint checks, used as the `check` of the issues found
+const (
+	LintDuplicateTitle       = "duplicate-title"
+	LintNoAssertion          = "no-assertion"
+	LintUnreachableAssertion = "unreachable-assertion"
+	LintDeprecatedField      = "deprecated-field"
+)
+
+// LintIssue is a test quality problem found by Lint. Stage is 1-based, and 0 when the issue is
+// about the whole test.
+type LintIssue struct {
+	File    string `json:"file"`
+	Test    string `json:"test"`
+	Stage   int    `json:"stage,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	location := i.File
+	if i.Test != "" {
+		location += ": " + i.Test
+	}
+	if i.Stage > 0 {
+		location += fmt.Sprintf(": stage %d", i.Stage)
+	}
+	return fmt.Sprintf("%s: %s (%s)", location, i.Message, i.Check)
+}
+
+// deprecatedInputFields are the input fields still supported but that shouldn't be used in new
+// tests, with the reason
+var deprecatedInputFields = []struct {
+	name   string
+	isSet  func(i *Input) bool
+	advice string
+}{
+	{
+		name:   "raw_request",
+		isSet:  func(i *Input) bool { return i.RAWRequest != "" },
+		advice: "YAML can change the line endings and whitespace of the request, use encoded_request or raw_request_b64",
+	},
+}
+
+// Lint looks for problems that don't make the tests invalid, but make them useless or
+// confusing: duplicate titles, stages that don't check anything, assertions that contradict
+// each other, and deprecated fields.
+func Lint(tests []FTWTest) []LintIssue {
+	var issues []LintIssue
+	titles := make(map[string]string)
+
+	for _, ftwTest := range tests {
+		for _, t := range ftwTest.Tests {
+			if file, found := titles[t.TestTitle]; found {
+				issues = append(issues, LintIssue{
+					File:    ftwTest.FileName,
+					Test:    t.TestTitle,
+					Check:   LintDuplicateTitle,
+					Message: fmt.Sprintf("test title already used in %s", file),
+				})
+			} else {
+				titles[t.TestTitle] = ftwTest.FileName
+			}
+
+			for n, s := range t.Stages {
+				for _, message := range lintStage(&s.Stage) {
+					issues = append(issues, LintIssue{
+						File:    ftwTest.FileName,
+						Test:    t.TestTitle,
+						Stage:   n + 1,
+						Check:   message[0],
+						Message: message[1],
+					})
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// lintStage returns the check and message of each problem found in the stage
+func lintStage(stage *Stage) [][2]string {
+	var found [][2]string
+	output := &stage.Output
+
+	if !output.hasAssertion() {
+		found = append(found, [2]string{LintNoAssertion, "stage has no output to check, it always passes"})
+	}
+
+	if len(output.LogContains) > 0 && len(output.NoLogContains) > 0 {
+		found = append(found, [2]string{LintUnreachableAssertion,
+			"both log_contains and no_log_contains are set, the stage passes if either matches (use all_of to require both)"})
+	}
+	var both []string
+	for _, status := range output.Status {
+		if output.NoExpectStatus.Contains(status) {
+			both = append(both, fmt.Sprint(status))
+		}
+	}
+	if len(both) > 0 {
+		found = append(found, [2]string{LintUnreachableAssertion,
+			fmt.Sprintf("status %s both expected and not expected", strings.Join(both, ", "))})
+	}
+	both = nil
+	for _, id := range output.Log.ExpectIDs {
+		if output.Log.NoExpectIDs.Contains(id) {
+			both = append(both, fmt.Sprint(id))
+		}
+	}
+	if len(both) > 0 {
+		found = append(found, [2]string{LintUnreachableAssertion,
+			fmt.Sprintf("rule IDs %s both expected and not expected", strings.Join(both, ", "))})
+	}
+
+	for _, field := range deprecatedInputFields {
+		if field.isSet(&stage.Input) {
+			found = append(found, [2]string{LintDeprecatedField,
+				fmt.Sprintf("%s is deprecated: %s", field.name, field.advice)})
+		}
+	}
+	return found
+}
+
+// hasAssertion returns true if the output checks anything
+func (o *Output) hasAssertion() bool {
+	return len(o.Status) > 0 || len(o.NoExpectStatus) > 0 || o.ResponseContains != "" || len(o.ResponseHeaders) > 0 ||
+		len(o.LogContains) > 0 || len(o.NoLogContains) > 0 || o.LogContainsCount != nil || o.ExpectError ||
+		len(o.Log.ExpectIDs) > 0 || len(o.Log.NoExpectIDs) > 0 || o.Log.AnomalyScore != nil ||
+		o.Log.OutboundAnomalyScore != nil || o.Log.MatchCount != nil || o.Log.MaxSeverity != nil || len(o.AuditParts) > 0 ||
+		o.Expr != "" || o.MaxRTTMs > 0 || len(o.AllOf) > 0 || len(o.AnyOf) > 0 || o.Not != nil || o.Expect != "" ||
+		o.Blocked != nil
+}
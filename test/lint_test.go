@@ -0,0 +1,106 @@
+package test
+
+import (
+	"strings"
+	"testing"
+)
+
+var yamlLintTest = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            uri: "/"
+          output:
+            status: [200]
+      - stage:
+          input:
+            uri: "/"
+          output: {}
+  - test_title: "002"
+    stages:
+      - stage:
+          input:
+            raw_request: |
+              GET / HTTP/1.1
+          output:
+            log_contains: "id \"942100\""
+            no_log_contains: "id \"920100\""
+            status: 4xx
+            no_expect_status: [403, 200]
+            log:
+              rule_ids: [942100, 920100]
+              no_rule_ids: [920xxx]
+`
+
+var yamlLintOtherFile = `---
+meta:
+  author: "tester"
+  enabled: true
+tests:
+  - test_title: "001"
+    stages:
+      - stage:
+          input:
+            uri: "/"
+          output:
+            response_contains: "hello"
+`
+
+func TestLint(t *testing.T) {
+	first, err := GetTestFromYaml([]byte(yamlLintTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.FileName = "first.yaml"
+	second, err := GetTestFromYaml([]byte(yamlLintOtherFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.FileName = "second.yaml"
+
+	issues := Lint([]FTWTest{first, second})
+
+	expected := []LintIssue{
+		{File: "first.yaml", Test: "001", Stage: 2, Check: LintNoAssertion},
+		{File: "first.yaml", Test: "002", Stage: 1, Check: LintUnreachableAssertion},
+		{File: "first.yaml", Test: "002", Stage: 1, Check: LintUnreachableAssertion},
+		{File: "first.yaml", Test: "002", Stage: 1, Check: LintUnreachableAssertion},
+		{File: "first.yaml", Test: "002", Stage: 1, Check: LintDeprecatedField},
+		{File: "second.yaml", Test: "001", Check: LintDuplicateTitle},
+	}
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %v", len(expected), issues)
+	}
+	// issues are reported in file order, duplicate titles when the second test is found
+	for n, issue := range issues {
+		e := expected[n]
+		if issue.File != e.File || issue.Test != e.Test || issue.Stage != e.Stage || issue.Check != e.Check {
+			t.Errorf("expected %+v, got %+v", e, issue)
+		}
+	}
+
+	if !strings.Contains(issues[2].Message, "status 403") {
+		t.Errorf("unexpected message %s", issues[2].Message)
+	}
+	if !strings.Contains(issues[3].Message, "rule IDs 920100") {
+		t.Errorf("unexpected message %s", issues[3].Message)
+	}
+	if issues[5].String() != "second.yaml: 001: test title already used in first.yaml (duplicate-title)" {
+		t.Errorf("unexpected issue text %s", issues[5].String())
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	ftwTest, err := GetTestFromYaml([]byte(yamlLintOtherFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issues := Lint([]FTWTest{ftwTest}); len(issues) != 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+}
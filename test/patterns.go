@@ -0,0 +1,52 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PatternList is a list of regular expressions. In YAML, it can be written as a single pattern
+// or as a list of patterns.
+type PatternList []string
+
+// UnmarshalYAML reads a pattern, or a list of patterns
+func (p *PatternList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+
+	var list PatternList
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		switch item.(type) {
+		case []interface{}, map[string]interface{}:
+			return fmt.Errorf("invalid pattern %v, use a string or a list of strings", item)
+		}
+		if pattern := fmt.Sprint(item); pattern != "" {
+			list = append(list, pattern)
+		}
+	}
+	*p = list
+	return nil
+}
+
+// MarshalYAML writes a single pattern as a string, so files with one pattern look the same
+func (p PatternList) MarshalYAML() (interface{}, error) {
+	if len(p) == 1 {
+		return p[0], nil
+	}
+	return []string(p), nil
+}
+
+// String returns the patterns separated by commas
+func (p PatternList) String() string {
+	return strings.Join(p, ", ")
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+var patternListTests = []struct {
+	yaml     string
+	expected PatternList
+}{
+	{`log_contains: 'id "942100"'`, PatternList{`id "942100"`}},
+	{`log_contains: ['id "942100"', 'msg "SQL Injection']`, PatternList{`id "942100"`, `msg "SQL Injection`}},
+	{"log_contains:\n  - 'id \"942100\"'\n  - 920300", PatternList{`id "942100"`, "920300"}},
+	{`log_contains: ""`, nil},
+}
+
+func TestPatternList(t *testing.T) {
+	for _, test := range patternListTests {
+		var output Output
+		if err := yaml.Unmarshal([]byte(test.yaml), &output); err != nil {
+			t.Errorf("%s: %s", test.yaml, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(output.LogContains, test.expected) {
+			t.Errorf("%s: got %v, want %v", test.yaml, output.LogContains, test.expected)
+		}
+	}
+}
+
+func TestPatternListInvalid(t *testing.T) {
+	var output Output
+	if err := yaml.Unmarshal([]byte(`no_log_contains: [[a, b]]`), &output); err == nil {
+		t.Errorf("expected error, got %v", output.NoLogContains)
+	}
+}
+
+func TestPatternListMarshal(t *testing.T) {
+	for patterns, expected := range map[string]string{
+		`id "942100"`:        "log_contains: id \"942100\"",
+		`id "942100"|id "1"`: "log_contains:\n- id \"942100\"\n- id \"1\"",
+	} {
+		out, err := yaml.Marshal(Output{LogContains: strings.Split(patterns, "|")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(out)) != expected {
+			t.Errorf("unexpected yaml %q", out)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RuleIDRange is an inclusive range of rule IDs
+type RuleIDRange struct {
+	From int
+	To   int
+}
+
+// RuleIDList is a list of rule IDs. In YAML, every entry can be written as an ID (`942100`), an
+// inclusive range (`942100-942199`), or an ID with trailing `x` wildcards matching a whole rule
+// family (`942xxx`).
+type RuleIDList []RuleIDRange
+
+// UnmarshalYAML reads an ID, range, or wildcard, or a list of them
+func (l *RuleIDList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+
+	var list RuleIDList
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		r, err := parseRuleIDRange(fmt.Sprint(item))
+		if err != nil {
+			return err
+		}
+		list = append(list, r)
+	}
+	*l = list
+	return nil
+}
+
+// Contains returns true when the ID is in any of the ranges
+func (l RuleIDList) Contains(id int) bool {
+	for _, r := range l {
+		if id >= r.From && id <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRuleIDRange(id string) (RuleIDRange, error) {
+	id = strings.TrimSpace(id)
+
+	if from, to, found := strings.Cut(id, "-"); found {
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return RuleIDRange{}, fmt.Errorf("invalid rule ID range %q", id)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || end < start {
+			return RuleIDRange{}, fmt.Errorf("invalid rule ID range %q", id)
+		}
+		return RuleIDRange{From: start, To: end}, nil
+	}
+
+	prefix := strings.TrimRight(strings.ToLower(id), "x")
+	if wildcards := len(id) - len(prefix); wildcards > 0 && prefix != "" {
+		start, err := strconv.Atoi(prefix)
+		if err != nil {
+			return RuleIDRange{}, fmt.Errorf("invalid rule ID %q", id)
+		}
+		size := 1
+		for i := 0; i < wildcards; i++ {
+			size *= 10
+		}
+		return RuleIDRange{From: start * size, To: start*size + size - 1}, nil
+	}
+
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return RuleIDRange{}, fmt.Errorf("invalid rule ID %q, use an ID (942100), a range (942100-942199), or a rule family (942xxx)", id)
+	}
+	return RuleIDRange{From: n, To: n}, nil
+}
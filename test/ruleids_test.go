@@ -0,0 +1,50 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+var ruleIDListTests = []struct {
+	yaml     string
+	expected RuleIDList
+}{
+	{`no_rule_ids: 942100`, RuleIDList{{942100, 942100}}},
+	{`no_rule_ids: [942100, 941110]`, RuleIDList{{942100, 942100}, {941110, 941110}}},
+	{`no_rule_ids: 942xxx`, RuleIDList{{942000, 942999}}},
+	{`no_rule_ids: ["9421XX", "920100-920199"]`, RuleIDList{{942100, 942199}, {920100, 920199}}},
+}
+
+func TestRuleIDList(t *testing.T) {
+	for _, test := range ruleIDListTests {
+		var output LogOutput
+		if err := yaml.Unmarshal([]byte(test.yaml), &output); err != nil {
+			t.Errorf("%s: %s", test.yaml, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(output.NoExpectIDs, test.expected) {
+			t.Errorf("%s: got %v, want %v", test.yaml, output.NoExpectIDs, test.expected)
+		}
+	}
+}
+
+func TestRuleIDListInvalid(t *testing.T) {
+	for _, invalid := range []string{`no_rule_ids: sqli`, `no_rule_ids: xxx`, `no_rule_ids: "942199-942100"`, `no_rule_ids: 94x2`} {
+		var output LogOutput
+		if err := yaml.Unmarshal([]byte(invalid), &output); err == nil {
+			t.Errorf("%s: expected error, got %v", invalid, output.NoExpectIDs)
+		}
+	}
+}
+
+func TestRuleIDListContains(t *testing.T) {
+	list := RuleIDList{{942000, 942999}, {920100, 920100}}
+
+	for id, expected := range map[int]bool{942000: true, 942431: true, 942999: true, 920100: true, 941100: false, 920101: false} {
+		if list.Contains(id) != expected {
+			t.Errorf("Contains(%d) should be %t", id, expected)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// scoreOperators are the comparisons supported in score conditions. Longer operators go first,
+// so they are matched before their prefixes.
+var scoreOperators = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+// ScoreCondition is a comparison against a score, or any other number like a count of rules.
+// In YAML, it is written as an exact value (`5`) or as an operator followed by a value (`">= 10"`).
+// Operators are `=`, `==`, `!=`, `>`, `>=`, `<`, and `<=`.
+type ScoreCondition struct {
+	Operator string
+	Value    int
+}
+
+// UnmarshalYAML reads the condition
+func (c *ScoreCondition) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	condition, err := ParseScoreCondition(fmt.Sprint(value))
+	if err != nil {
+		return err
+	}
+	*c = condition
+	return nil
+}
+
+// ParseScoreCondition reads a condition like `>= 10`
+func ParseScoreCondition(condition string) (ScoreCondition, error) {
+	condition = strings.TrimSpace(condition)
+	operator := "="
+	for _, op := range scoreOperators {
+		if strings.HasPrefix(condition, op) {
+			operator = op
+			condition = strings.TrimSpace(strings.TrimPrefix(condition, op))
+			break
+		}
+	}
+	value, err := strconv.Atoi(condition)
+	if err != nil {
+		return ScoreCondition{}, fmt.Errorf("invalid score condition %q, use a value (5) or an operator and a value (\">= 10\")", condition)
+	}
+	if operator == "==" {
+		operator = "="
+	}
+	return ScoreCondition{Operator: operator, Value: value}, nil
+}
+
+// Matches returns true when the score satisfies the condition
+func (c ScoreCondition) Matches(score int) bool {
+	switch c.Operator {
+	case "!=":
+		return score != c.Value
+	case ">":
+		return score > c.Value
+	case ">=":
+		return score >= c.Value
+	case "<":
+		return score < c.Value
+	case "<=":
+		return score <= c.Value
+	default:
+		return score == c.Value
+	}
+}
+
+// String returns the condition as written in YAML
+func (c ScoreCondition) String() string {
+	return fmt.Sprintf("%s %d", c.Operator, c.Value)
+}
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+var scoreConditionTests = []struct {
+	yaml    string
+	matches []int
+	misses  []int
+}{
+	{`anomaly_score: 5`, []int{5}, []int{0, 4, 6}},
+	{`anomaly_score: "= 5"`, []int{5}, []int{4, 6}},
+	{`anomaly_score: "== 5"`, []int{5}, []int{4, 6}},
+	{`anomaly_score: "!= 5"`, []int{0, 4, 6}, []int{5}},
+	{`anomaly_score: ">= 10"`, []int{10, 15}, []int{0, 9}},
+	{`anomaly_score: ">10"`, []int{11}, []int{10}},
+	{`anomaly_score: "< 5"`, []int{0, 4}, []int{5}},
+	{`anomaly_score: "<= 5"`, []int{0, 5}, []int{6}},
+}
+
+func TestScoreCondition(t *testing.T) {
+	for _, test := range scoreConditionTests {
+		var output LogOutput
+		if err := yaml.Unmarshal([]byte(test.yaml), &output); err != nil {
+			t.Errorf("%s: %s", test.yaml, err.Error())
+			continue
+		}
+		for _, score := range test.matches {
+			if !output.AnomalyScore.Matches(score) {
+				t.Errorf("%s: %d should match", test.yaml, score)
+			}
+		}
+		for _, score := range test.misses {
+			if output.AnomalyScore.Matches(score) {
+				t.Errorf("%s: %d should not match", test.yaml, score)
+			}
+		}
+	}
+}
+
+func TestScoreConditionInvalid(t *testing.T) {
+	for _, invalid := range []string{`anomaly_score: "high"`, `anomaly_score: ">= "`, `anomaly_score: "=> 5"`} {
+		var output LogOutput
+		if err := yaml.Unmarshal([]byte(invalid), &output); err == nil {
+			t.Errorf("%s: expected error, got %v", invalid, output.AnomalyScore)
+		}
+	}
+}
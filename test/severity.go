@@ -0,0 +1,98 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Severities are the names of the severities of the rules, from the most to the least severe.
+// Like syslog levels, the severity is also written as its index, e.g. `2` for CRITICAL.
+var Severities = []string{"EMERGENCY", "ALERT", "CRITICAL", "ERROR", "WARNING", "NOTICE", "INFO", "DEBUG"}
+
+// ParseSeverity returns the level of a severity written as a name, in any case, or as a number.
+// Lower levels are more severe.
+func ParseSeverity(severity string) (int, error) {
+	severity = strings.TrimSpace(severity)
+	for level, name := range Severities {
+		if strings.EqualFold(severity, name) {
+			return level, nil
+		}
+	}
+	if level, err := strconv.Atoi(severity); err == nil && level >= 0 && level < len(Severities) {
+		return level, nil
+	}
+	return 0, fmt.Errorf("invalid severity %q, use one of %s or 0 to %d", severity, strings.Join(Severities, ", "), len(Severities)-1)
+}
+
+// SeverityCondition is a comparison against the highest severity of the rules found in the logs.
+// In YAML, it is written as a severity (`CRITICAL`) or as an operator followed by a severity
+// (`">= CRITICAL"`), with the same operators as score conditions. Greater means more severe, so
+// `">= CRITICAL"` requires a CRITICAL, ALERT or EMERGENCY rule, and `"<= WARNING"` allows no rule
+// more severe than WARNING.
+type SeverityCondition struct {
+	Operator string
+	Level    int
+}
+
+// UnmarshalYAML reads the condition
+func (c *SeverityCondition) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	condition, err := ParseSeverityCondition(fmt.Sprint(value))
+	if err != nil {
+		return err
+	}
+	*c = condition
+	return nil
+}
+
+// ParseSeverityCondition reads a condition like `>= CRITICAL`
+func ParseSeverityCondition(condition string) (SeverityCondition, error) {
+	condition = strings.TrimSpace(condition)
+	operator := "="
+	for _, op := range scoreOperators {
+		if strings.HasPrefix(condition, op) {
+			operator = op
+			condition = strings.TrimPrefix(condition, op)
+			break
+		}
+	}
+	level, err := ParseSeverity(condition)
+	if err != nil {
+		return SeverityCondition{}, err
+	}
+	if operator == "==" {
+		operator = "="
+	}
+	return SeverityCondition{Operator: operator, Level: level}, nil
+}
+
+// Matches returns true when the highest severity found satisfies the condition. Without rules
+// found, only the conditions that allow lower severities match.
+func (c SeverityCondition) Matches(level int, found bool) bool {
+	if !found {
+		return c.Operator == "<" || c.Operator == "<=" || c.Operator == "!="
+	}
+	switch c.Operator {
+	case "!=":
+		return level != c.Level
+	case ">":
+		return level < c.Level
+	case ">=":
+		return level <= c.Level
+	case "<":
+		return level > c.Level
+	case "<=":
+		return level >= c.Level
+	default:
+		return level == c.Level
+	}
+}
+
+// String returns the condition as written in YAML
+func (c SeverityCondition) String() string {
+	return fmt.Sprintf("%s %s", c.Operator, Severities[c.Level])
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+var severityConditionTests = []struct {
+	yaml    string
+	matches []int
+	misses  []int
+}{
+	{`max_severity: CRITICAL`, []int{2}, []int{0, 4}},
+	{`max_severity: ">= critical"`, []int{0, 1, 2}, []int{3, 5}},
+	{`max_severity: "> ERROR"`, []int{2}, []int{3, 4}},
+	{`max_severity: "<= WARNING"`, []int{4, 7}, []int{2, 3}},
+	{`max_severity: "< 4"`, []int{5}, []int{4, 2}},
+	{`max_severity: "!= NOTICE"`, []int{2, 6}, []int{5}},
+	{`max_severity: "== 2"`, []int{2}, []int{1, 3}},
+}
+
+func TestSeverityCondition(t *testing.T) {
+	for _, test := range severityConditionTests {
+		var output LogOutput
+		if err := yaml.Unmarshal([]byte(test.yaml), &output); err != nil {
+			t.Errorf("%s: %s", test.yaml, err.Error())
+			continue
+		}
+		for _, level := range test.matches {
+			if !output.MaxSeverity.Matches(level, true) {
+				t.Errorf("%s: %s should match", test.yaml, Severities[level])
+			}
+		}
+		for _, level := range test.misses {
+			if output.MaxSeverity.Matches(level, true) {
+				t.Errorf("%s: %s should not match", test.yaml, Severities[level])
+			}
+		}
+	}
+}
+
+func TestSeverityConditionWithoutRules(t *testing.T) {
+	for condition, expected := range map[string]bool{
+		">= CRITICAL": false,
+		"CRITICAL":    false,
+		"<= WARNING":  true,
+		"!= ALERT":    true,
+	} {
+		c, err := ParseSeverityCondition(condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Matches(0, false) != expected {
+			t.Errorf("%s: expected %t without rules", condition, expected)
+		}
+	}
+}
+
+func TestSeverityConditionInvalid(t *testing.T) {
+	for _, invalid := range []string{`max_severity: "high"`, `max_severity: ">= "`, `max_severity: 8`, `max_severity: "=> ERROR"`} {
+		var output LogOutput
+		if err := yaml.Unmarshal([]byte(invalid), &output); err == nil {
+			t.Errorf("%s: expected error, got %v", invalid, output.MaxSeverity)
+		}
+	}
+}
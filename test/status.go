@@ -0,0 +1,85 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusList is a list of HTTP statuses. In YAML, every status can be written as a code (`403`),
+// an inclusive range (`400-499`), or a class (`4xx`), either alone or in a list.
+// Ranges and classes are expanded, so the list always holds plain status codes.
+type StatusList []int
+
+// UnmarshalYAML reads a status, range, or class, or a list of them
+func (s *StatusList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+
+	var list StatusList
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		codes, err := parseStatus(fmt.Sprint(item))
+		if err != nil {
+			return err
+		}
+		list = append(list, codes...)
+	}
+	*s = list
+	return nil
+}
+
+// parseStatus returns the status codes in a status, range, or class
+func parseStatus(status string) ([]int, error) {
+	status = strings.TrimSpace(status)
+
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") && status[0] >= '1' && status[0] <= '5' {
+		start := int(status[0]-'0') * 100
+		return statusRange(start, start+99), nil
+	}
+
+	if from, to, found := strings.Cut(status, "-"); found {
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status range %q", status)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid status range %q", status)
+		}
+		return statusRange(start, end), nil
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status %q, use a code (403), a range (400-499), or a class (4xx)", status)
+	}
+	return []int{code}, nil
+}
+
+func statusRange(start int, end int) []int {
+	codes := make([]int, 0, end-start+1)
+	for code := start; code <= end; code++ {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// Contains returns true if status is one of the statuses in the list
+func (s StatusList) Contains(status int) bool {
+	for _, candidate := range s {
+		if candidate == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+var statusListTests = []struct {
+	yaml     string
+	expected StatusList
+}{
+	{`status: 403`, StatusList{403}},
+	{`status: [200, 403]`, StatusList{200, 403}},
+	{`status: "401-403"`, StatusList{401, 402, 403}},
+	{`status: 401-403`, StatusList{401, 402, 403}},
+	{`status: [200, "405 - 406"]`, StatusList{200, 405, 406}},
+	{`status: 2xx`, statusRange(200, 299)},
+	{`status: ["4XX", 500]`, append(statusRange(400, 499), 500)},
+}
+
+func TestStatusList(t *testing.T) {
+	for _, test := range statusListTests {
+		var output Output
+		if err := yaml.Unmarshal([]byte(test.yaml), &output); err != nil {
+			t.Errorf("%s: %s", test.yaml, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(output.Status, test.expected) {
+			t.Errorf("%s: got %v, want %v", test.yaml, output.Status, test.expected)
+		}
+	}
+}
+
+func TestStatusListInvalid(t *testing.T) {
+	for _, invalid := range []string{`status: "forbidden"`, `status: 6xx`, `status: "499-400"`, `status: [200, "4xx-5xx"]`} {
+		var output Output
+		if err := yaml.Unmarshal([]byte(invalid), &output); err == nil {
+			t.Errorf("%s: expected error, got %v", invalid, output.Status)
+		}
+	}
+}
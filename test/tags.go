@@ -0,0 +1,40 @@
+package test
+
+// GetTags returns the tags of a test case, including the ones set for the whole file
+func (f *FTWTest) GetTags(t Test) []string {
+	seen := make(map[string]bool, len(f.Meta.Tags)+len(t.Tags))
+	var tags []string
+	for _, tag := range append(append([]string{}, f.Meta.Tags...), t.Tags...) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// HasTag returns true if the test case, or the file it belongs to, is tagged with tag
+func (f *FTWTest) HasTag(t Test, tag string) bool {
+	for _, candidate := range f.GetTags(t) {
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMetadata returns the metadata of a test case, including the metadata set for the whole file.
+// Keys set in the test case override the ones of the file.
+func (f *FTWTest) GetMetadata(t Test) map[string]interface{} {
+	if len(f.Meta.Metadata) == 0 && len(t.Metadata) == 0 {
+		return nil
+	}
+	metadata := make(map[string]interface{}, len(f.Meta.Metadata)+len(t.Metadata))
+	for key, value := range f.Meta.Metadata {
+		metadata[key] = value
+	}
+	for key, value := range t.Metadata {
+		metadata[key] = value
+	}
+	return metadata
+}
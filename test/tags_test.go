@@ -0,0 +1,96 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+)
+
+var yamlTaggedTest = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "911100.yaml"
+  tags: ["method-enforcement", "pl1"]
+  platforms: ["modsec2-apache"]
+tests:
+  - test_title: 911100-1
+    tags: ["pl1", "get"]
+    stages: []
+  - test_title: 911100-2
+    stages: []
+`
+
+func TestGetTags(t *testing.T) {
+	ftwTest, err := GetTestFromYaml([]byte(yamlTaggedTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tags := ftwTest.GetTags(ftwTest.Tests[0]); !reflect.DeepEqual(tags, []string{"method-enforcement", "pl1", "get"}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	if tags := ftwTest.GetTags(ftwTest.Tests[1]); !reflect.DeepEqual(tags, []string{"method-enforcement", "pl1"}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	if !reflect.DeepEqual(ftwTest.Meta.Platforms, []string{"modsec2-apache"}) {
+		t.Errorf("unexpected platforms %v", ftwTest.Meta.Platforms)
+	}
+}
+
+func TestHasTag(t *testing.T) {
+	ftwTest, err := GetTestFromYaml([]byte(yamlTaggedTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ftwTest.HasTag(ftwTest.Tests[0], "get") {
+		t.Error("test tag not found")
+	}
+	if !ftwTest.HasTag(ftwTest.Tests[1], "method-enforcement") {
+		t.Error("file tag not found")
+	}
+	if ftwTest.HasTag(ftwTest.Tests[1], "get") {
+		t.Error("tag of another test found")
+	}
+}
+
+var yamlMetadataTest = `---
+meta:
+  author: "tester"
+  enabled: true
+  metadata:
+    issue: "https://github.com/coreruleset/coreruleset/issues/1"
+    severity: "high"
+tests:
+  - test_title: 944100-1
+    metadata:
+      cve: ["CVE-2021-44228", "CVE-2021-45046"]
+      severity: "critical"
+    stages: []
+  - test_title: 944100-2
+    stages: []
+`
+
+func TestGetMetadata(t *testing.T) {
+	ftwTest, err := GetTestFromYaml([]byte(yamlMetadataTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := ftwTest.GetMetadata(ftwTest.Tests[0])
+	if metadata["severity"] != "critical" || metadata["issue"] != "https://github.com/coreruleset/coreruleset/issues/1" {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+	if cves, ok := metadata["cve"].([]interface{}); !ok || len(cves) != 2 || cves[1] != "CVE-2021-45046" {
+		t.Errorf("unexpected cve %v", metadata["cve"])
+	}
+	if metadata := ftwTest.GetMetadata(ftwTest.Tests[1]); len(metadata) != 2 || metadata["severity"] != "high" {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+
+	var plain FTWTest
+	plain.Tests = []Test{{TestTitle: "1"}}
+	if metadata := plain.GetMetadata(plain.Tests[0]); metadata != nil {
+		t.Errorf("expected no metadata, got %v", metadata)
+	}
+}
@@ -1,43 +1,134 @@
 package test
 
-import "github.com/coreruleset/go-ftw/ftwhttp"
+import (
+	"github.com/goccy/go-yaml"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
 
 // Input represents the input request in a stage
 // The fields `Version`, `Method` and `URI` we want to explicitly now when they are set to ""
+// `Include` lists YAML files with input snippets, used as defaults for the fields not set in the input
 type Input struct {
-	DestAddr       *string        `yaml:"dest_addr,omitempty" koanf:"dest_addr,omitempty"`
-	Port           *int           `yaml:"port,omitempty" koanf:"port,omitempty"`
-	Protocol       *string        `yaml:"protocol,omitempty" koanf:"protocol,omitempty"`
-	URI            *string        `yaml:"uri,omitempty" koanf:"uri,omitempty"`
-	Version        *string        `yaml:"version,omitempty" koanf:"version,omitempty"`
-	Headers        ftwhttp.Header `yaml:"headers,omitempty" koanf:"headers,omitempty"`
-	Method         *string        `yaml:"method,omitempty" koanf:"method,omitempty"`
-	Data           *string        `yaml:"data,omitempty" koanf:"data,omitempty"`
-	SaveCookie     bool           `yaml:"save_cookie,omitempty" koanf:"save_cookie,omitempty"`
-	StopMagic      bool           `yaml:"stop_magic" koanf:"stop_magic,omitempty"`
-	EncodedRequest string         `yaml:"encoded_request,omitempty" koanf:"encoded_request,omitempty"`
-	RAWRequest     string         `yaml:"raw_request,omitempty" koanf:"raw_request,omitempty"`
+	DestAddr        *string        `yaml:"dest_addr,omitempty" koanf:"dest_addr,omitempty"`
+	Port            *Port          `yaml:"port,omitempty" koanf:"port,omitempty"`
+	Protocol        *string        `yaml:"protocol,omitempty" koanf:"protocol,omitempty"`
+	URI             *string        `yaml:"uri,omitempty" koanf:"uri,omitempty"`
+	Version         *string        `yaml:"version,omitempty" koanf:"version,omitempty"`
+	Headers         ftwhttp.Header `yaml:"headers,omitempty" koanf:"headers,omitempty"`
+	Method          *string        `yaml:"method,omitempty" koanf:"method,omitempty"`
+	Data            *string        `yaml:"data,omitempty" koanf:"data,omitempty"`
+	SaveCookie      bool           `yaml:"save_cookie,omitempty" koanf:"save_cookie,omitempty"`
+	StopMagic       bool           `yaml:"stop_magic,omitempty" koanf:"stop_magic,omitempty"`
+	EncodedRequest  string         `yaml:"encoded_request,omitempty" koanf:"encoded_request,omitempty"`
+	RAWRequest      string         `yaml:"raw_request,omitempty" koanf:"raw_request,omitempty"`
+	GRPC            *GRPCInput     `yaml:"grpc,omitempty" koanf:"grpc,omitempty"`
+	FoldHeaders     bool           `yaml:"fold_headers,omitempty" koanf:"fold_headers,omitempty"`
+	Latin1Headers   bool           `yaml:"latin1_headers,omitempty" koanf:"latin1_headers,omitempty"`
+	FollowRedirects int            `yaml:"follow_redirects,omitempty" koanf:"follow_redirects,omitempty"`
+	Include         []string       `yaml:"include,omitempty" koanf:"include,omitempty"`
+	DataFile        string         `yaml:"data_file,omitempty" koanf:"data_file,omitempty"`
+	DataB64         string         `yaml:"data_b64,omitempty" koanf:"data_b64,omitempty"`
+	RAWRequestB64   string         `yaml:"raw_request_b64,omitempty" koanf:"raw_request_b64,omitempty"`
+	JSON            interface{}    `yaml:"json,omitempty" koanf:"json,omitempty"`
+	// HeaderFiles maps header names to the files their values are read from, like secrets
+	HeaderFiles map[string]string `yaml:"header_files,omitempty" koanf:"header_files,omitempty"`
+
+	// body is the request body loaded from DataFile, decoded from DataB64, or serialized from JSON
+	body []byte
+	// rawRequest is the request decoded from RAWRequestB64
+	rawRequest []byte
+}
+
+// GRPCInput describes a unary gRPC call. The request message is read as JSON from `data`,
+// and `headers` are sent as gRPC metadata.
+type GRPCInput struct {
+	DescriptorSet string `yaml:"descriptor_set" koanf:"descriptor_set"`
+	Service       string `yaml:"service" koanf:"service"`
+	Method        string `yaml:"method" koanf:"method"`
 }
 
 // Output is the response expected from the test
 type Output struct {
-	Status           []int  `yaml:"status,flow,omitempty"`
-	ResponseContains string `yaml:"response_contains,omitempty"`
-	LogContains      string `yaml:"log_contains,omitempty"`
-	NoLogContains    string `yaml:"no_log_contains,omitempty"`
-	ExpectError      bool   `yaml:"expect_error,omitempty"`
+	Status           StatusList `yaml:"status,flow,omitempty"`
+	NoExpectStatus   StatusList `yaml:"no_expect_status,flow,omitempty"`
+	ResponseContains string     `yaml:"response_contains,omitempty"`
+	// ResponseHeaders maps header names to the regular expressions one of their values must match
+	ResponseHeaders map[string]string `yaml:"response_headers,omitempty"`
+	// LogContains are the patterns that must all match the logs, and NoLogContains the patterns
+	// that must not match them
+	LogContains   PatternList `yaml:"log_contains,omitempty"`
+	NoLogContains PatternList `yaml:"no_log_contains,omitempty"`
+	// LogContainsCount is a pattern that must be found a number of times in the logs
+	LogContainsCount *LogContainsCount `yaml:"log_contains_count,omitempty"`
+	ExpectError      bool              `yaml:"expect_error,omitempty"`
+	// Blocked checks that the response is, or is not, a response of the WAF blocking the request,
+	// as recognized by `blockresponses` in the configuration, or a 403 without them
+	Blocked *bool     `yaml:"blocked,omitempty"`
+	Log     LogOutput `yaml:"log,omitempty"`
+	// AuditParts maps the letters of the parts of the audit log, like `H`, to the regular
+	// expressions their content must match. An empty expression only requires the part.
+	AuditParts map[string]string `yaml:"audit_parts,omitempty"`
+	// Expr is an expression over the response and the logs that must evaluate to true
+	Expr string `yaml:"expr,omitempty"`
+	// MaxRTTMs is the longest round trip time allowed for the request, in milliseconds. Unlike
+	// the keys above, it must be satisfied on top of them.
+	MaxRTTMs int `yaml:"max_rtt_ms,omitempty"`
+	// AllOf, AnyOf and Not combine outputs: all of them, at least one of them, or none of them
+	// must be satisfied, on top of the keys above
+	AllOf []Output `yaml:"all_of,omitempty"`
+	AnyOf []Output `yaml:"any_of,omitempty"`
+	Not   *Output  `yaml:"not,omitempty"`
+	// Expect is a canonical expectation, like `blocked`, standing for the output configured for
+	// the platform under test. The keys set in the output win over the ones of the platform.
+	Expect string `yaml:"expect,omitempty"`
+}
+
+// LogContainsCount is a regular expression and the number of times it must match the logs.
+// Without count, the pattern must match at least once.
+type LogContainsCount struct {
+	Pattern string          `yaml:"pattern"`
+	Count   *ScoreCondition `yaml:"count,omitempty"`
+}
+
+// LogOutput is what the test expects to find in the WAF logs, parsed from the log lines between
+// the markers
+type LogOutput struct {
+	ExpectIDs            []int           `yaml:"rule_ids,flow,omitempty"`
+	NoExpectIDs          RuleIDList      `yaml:"no_rule_ids,flow,omitempty"`
+	AnomalyScore         *ScoreCondition `yaml:"anomaly_score,omitempty"`
+	OutboundAnomalyScore *ScoreCondition `yaml:"outbound_anomaly_score,omitempty"`
+	MatchCount           *ScoreCondition `yaml:"match_count,omitempty"`
+	// MaxSeverity is a condition on the highest severity of the rules found in the logs
+	MaxSeverity *SeverityCondition `yaml:"max_severity,omitempty"`
+}
+
+// UnmarshalYAML reads the expectations, rejecting the unknown keys: a misspelled key, like
+// `expect_ids`, would otherwise be ignored and check nothing
+func (l *LogOutput) UnmarshalYAML(data []byte) error {
+	type fields LogOutput
+	return yaml.UnmarshalWithOptions(data, (*fields)(l), yaml.DisallowUnknownField())
 }
 
 // Stage is an individual test stage
+// `Repeat` is the number of times the request is sent before checking the output
+// `DelayBefore` and `DelayAfter` are waited before sending the request and after checking the output
 type Stage struct {
-	Input  Input  `yaml:"input"`
-	Output Output `yaml:"output"`
+	Input       Input    `yaml:"input"`
+	Output      Output   `yaml:"output"`
+	Repeat      int      `yaml:"repeat,omitempty"`
+	DelayBefore Duration `yaml:"delay_before,omitempty"`
+	DelayAfter  Duration `yaml:"delay_after,omitempty"`
 }
 
 // Test is an individual test
+// `Metadata` holds free-form information about the test, like links to issues or CVEs, that is
+// copied to the JSON and JUnit reports
 type Test struct {
-	TestTitle       string `yaml:"test_title"`
-	TestDescription string `yaml:"desc,omitempty"`
+	TestTitle       string                 `yaml:"test_title"`
+	TestDescription string                 `yaml:"desc,omitempty"`
+	Tags            []string               `yaml:"tags,omitempty"`
+	Metadata        map[string]interface{} `yaml:"metadata,omitempty"`
 	Stages          []struct {
 		Stage Stage `yaml:"stage"`
 	} `yaml:"stages"`
@@ -45,12 +136,18 @@ type Test struct {
 
 // FTWTest is the base type used when unmarshaling
 type FTWTest struct {
-	FileName string
+	FileName string `yaml:"-"`
 	Meta     struct {
-		Author      string `yaml:"author,omitempty"`
-		Enabled     bool   `yaml:"enabled,omitempty"`
-		Name        string `yaml:"name,omitempty"`
-		Description string `yaml:"description,omitempty"`
+		Author      string                 `yaml:"author,omitempty"`
+		Enabled     bool                   `yaml:"enabled,omitempty"`
+		Name        string                 `yaml:"name,omitempty"`
+		Description string                 `yaml:"description,omitempty"`
+		Tags        []string               `yaml:"tags,omitempty"`
+		Platforms   []string               `yaml:"platforms,omitempty"`
+		Metadata    map[string]interface{} `yaml:"metadata,omitempty"`
+		// Destination is the name of the destination profile of the configuration the tests
+		// are sent to
+		Destination string `yaml:"destination,omitempty"`
 	} `yaml:"meta"`
 	Tests []Test `yaml:"tests"`
 }
@@ -0,0 +1,302 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/yargevad/filepathx"
+
+	"github.com/coreruleset/go-ftw/ftwhttp"
+)
+
+// ValidationError is a problem found in a test file, with the position where it was found
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error formats the problem as `file:line:column: message`
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// yamlErrorPosition matches the `[line:column]` prefix of errors from the yaml parser
+var yamlErrorPosition = regexp.MustCompile(`^\[(\d+):(\d+)\]\s*(.*)`)
+
+// ValidateTestFile checks the test file against the schema of the test types. The error is only
+// set if the file can't be read.
+func ValidateTestFile(fileName string) ([]ValidationError, error) {
+	contents, err := readFileContents(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateTestYaml(fileName, contents), nil
+}
+
+// ValidateTestYaml checks the YAML contents against the schema of the test types, reporting
+// unknown keys, values of the wrong type, and conflicting fields in stage inputs.
+// fileName is only used for reporting.
+func ValidateTestYaml(fileName string, contents []byte) (found []ValidationError) {
+	v := &validator{file: fileName}
+
+	// the yaml parser can panic on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			found = []ValidationError{{File: fileName, Message: fmt.Sprintf("syntax error: %v", r)}}
+		}
+	}()
+
+	f, err := parser.ParseBytes(contents, 0)
+	if err != nil {
+		v.syntaxError(err)
+		return v.errors
+	}
+	for _, doc := range f.Docs {
+		if doc.Body != nil {
+			v.validate(doc.Body, reflect.TypeOf(FTWTest{}))
+		}
+	}
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		if v.errors[i].Line != v.errors[j].Line {
+			return v.errors[i].Line < v.errors[j].Line
+		}
+		return v.errors[i].Column < v.errors[j].Column
+	})
+	return v.errors
+}
+
+type validator struct {
+	file   string
+	errors []ValidationError
+}
+
+func (v *validator) report(node ast.Node, format string, a ...interface{}) {
+	e := ValidationError{File: v.file, Message: fmt.Sprintf(format, a...)}
+	if tk := node.GetToken(); tk != nil {
+		e.Line = tk.Position.Line
+		e.Column = tk.Position.Column
+	}
+	v.errors = append(v.errors, e)
+}
+
+func (v *validator) syntaxError(err error) {
+	e := ValidationError{File: v.file}
+	msg := strings.TrimSpace(yaml.FormatError(err, false, false))
+	if m := yamlErrorPosition.FindStringSubmatch(msg); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+		e.Column, _ = strconv.Atoi(m[2])
+		msg = m[3]
+	}
+	e.Message = "syntax error: " + msg
+	v.errors = append(v.errors, e)
+}
+
+// yamlErrorMessage returns the error message without the position, which is relative to the
+// snippet that was unmarshaled
+func yamlErrorMessage(err error) string {
+	msg := strings.TrimSpace(yaml.FormatError(err, false, false))
+	if m := yamlErrorPosition.FindStringSubmatch(msg); m != nil {
+		return m[3]
+	}
+	return msg
+}
+
+// validate checks the node against the Go type it will be unmarshaled into
+func (v *validator) validate(node ast.Node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch n := node.(type) {
+	case *ast.AnchorNode:
+		v.validate(n.Value, t)
+		return
+	case *ast.TagNode:
+		v.validate(n.Value, t)
+		return
+	case *ast.AliasNode, *ast.NullNode, *ast.CommentNode:
+		// aliases are checked where the anchor is defined
+		return
+	}
+
+	if t == reflect.TypeOf(ftwhttp.Header{}) {
+		v.validateHeaders(node)
+		return
+	}
+
+	// types with their own syntax are checked by unmarshaling them
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*yaml.InterfaceUnmarshaler)(nil)).Elem()) {
+		if err := yaml.Unmarshal([]byte(node.String()), reflect.New(t).Interface()); err != nil {
+			v.report(node, "%s", yamlErrorMessage(err))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		v.validateStruct(node, t)
+	case reflect.Map:
+		mapping := v.mappingValues(node)
+		if mapping == nil {
+			v.report(node, "expected a mapping, got %s", node.Type())
+			return
+		}
+		for _, mv := range mapping {
+			v.validate(mv.Value, t.Elem())
+		}
+	case reflect.Slice:
+		seq, ok := node.(*ast.SequenceNode)
+		if !ok {
+			v.report(node, "expected a list, got %s", node.Type())
+			return
+		}
+		for _, item := range seq.Values {
+			v.validate(item, t.Elem())
+		}
+	case reflect.String:
+		switch node.(type) {
+		case *ast.MappingNode, *ast.MappingValueNode, *ast.SequenceNode:
+			v.report(node, "expected a string, got %s", node.Type())
+		}
+	case reflect.Int, reflect.Int64:
+		if _, ok := node.(*ast.IntegerNode); !ok {
+			v.report(node, "expected an integer, got %s", node.Type())
+		}
+	case reflect.Bool:
+		if _, ok := node.(*ast.BoolNode); !ok {
+			v.report(node, "expected a boolean, got %s", node.Type())
+		}
+	}
+}
+
+func (v *validator) validateStruct(node ast.Node, t reflect.Type) {
+	mapping := v.mappingValues(node)
+	if mapping == nil {
+		v.report(node, "expected a mapping, got %s", node.Type())
+		return
+	}
+
+	fields := yamlFields(t)
+	keys := make(map[string]ast.Node, len(mapping))
+	for _, mv := range mapping {
+		key := mv.Key.GetToken().Value
+		if _, ok := mv.Key.(*ast.MergeKeyNode); ok {
+			continue
+		}
+		field, ok := fields[key]
+		if !ok {
+			v.report(mv.Key, "unknown field %q", key)
+			continue
+		}
+		if _, duplicated := keys[key]; duplicated {
+			v.report(mv.Key, "duplicated field %q", key)
+		}
+		keys[key] = mv.Key
+		v.validate(mv.Value, field.Type)
+	}
+
+	if t == reflect.TypeOf(Input{}) {
+		v.validateInputFields(keys)
+	}
+}
+
+// validateInputFields reports fields that can't be used together in a stage input
+func (v *validator) validateInputFields(keys map[string]ast.Node) {
+	var bodies []string
+	for _, key := range []string{"data", "data_file", "data_b64", "json", "encoded_request", "raw_request", "raw_request_b64"} {
+		if _, ok := keys[key]; ok {
+			bodies = append(bodies, key)
+		}
+	}
+	if len(bodies) > 1 {
+		v.report(keys[bodies[1]], "conflicting fields: choose between %s", strings.Join(bodies, ", "))
+	}
+	if grpc, ok := keys["grpc"]; ok {
+		_, encoded := keys["encoded_request"]
+		_, raw := keys["raw_request"]
+		_, rawB64 := keys["raw_request_b64"]
+		if encoded || raw || rawB64 {
+			v.report(grpc, "conflicting fields: grpc only works with data, data_file, data_b64 or json")
+		}
+	}
+}
+
+// validateHeaders checks headers written as a mapping, or as a list of single entry mappings
+func (v *validator) validateHeaders(node ast.Node) {
+	if mapping := v.mappingValues(node); mapping != nil {
+		for _, mv := range mapping {
+			v.validate(mv.Value, reflect.TypeOf(""))
+		}
+		return
+	}
+	seq, ok := node.(*ast.SequenceNode)
+	if !ok {
+		v.report(node, "expected a mapping or a list, got %s", node.Type())
+		return
+	}
+	for _, item := range seq.Values {
+		mapping := v.mappingValues(item)
+		if len(mapping) != 1 {
+			v.report(item, "expected a mapping with one header, got %s", item.Type())
+			continue
+		}
+		v.validate(mapping[0].Value, reflect.TypeOf(""))
+	}
+}
+
+func (v *validator) mappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	}
+	return nil
+}
+
+// yamlFields maps the yaml key of every field in the struct to the field
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("yaml")
+		if !ok {
+			// fields without tag are not read from yaml
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// ValidateTestFiles validates all the files matching the glob pattern, returning
+// the problems found and the number of files validated
+func ValidateTestFiles(globPattern string) ([]ValidationError, int, error) {
+	testFiles, err := filepathx.Glob(globPattern)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var found []ValidationError
+	for _, fileName := range testFiles {
+		fileErrors, err := ValidateTestFile(fileName)
+		if err != nil {
+			return found, len(testFiles), err
+		}
+		found = append(found, fileErrors...)
+	}
+	return found, len(testFiles), nil
+}
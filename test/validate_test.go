@@ -0,0 +1,99 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var invalidYamlTest = `---
+meta:
+  author: "tester"
+  enabled: yes-please
+  nme: "911100.yaml"
+tests:
+  - test_title: 911100-1
+    stages:
+      - stage:
+          input:
+            port: "eighty"
+            data: "a=b"
+            raw_request: "GET / HTTP/1.1"
+            headers:
+              Host: "localhost"
+              X-List: [1]
+          output:
+            status: 200
+            no_expect_status: [403, "5yy"]
+            bogus: true
+`
+
+var brokenYamlTest = `---
+meta:
+  enabled: true
+    author: "tester"
+`
+
+func TestValidateTestYaml(t *testing.T) {
+	expected := []ValidationError{
+		{"test.yaml", 4, 12, "expected a boolean, got String"},
+		{"test.yaml", 5, 3, `unknown field "nme"`},
+		{"test.yaml", 11, 19, "invalid port eighty, use a number or an environment variable set to one"},
+		{"test.yaml", 13, 13, "conflicting fields: choose between data, raw_request"},
+		{"test.yaml", 16, 23, "expected a string, got Sequence"},
+		{"test.yaml", 19, 31, `invalid status "5yy", use a code (403), a range (400-499), or a class (4xx)`},
+		{"test.yaml", 20, 13, `unknown field "bogus"`},
+	}
+
+	found := ValidateTestYaml("test.yaml", []byte(invalidYamlTest))
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(found), found)
+	}
+	for i, e := range expected {
+		if found[i] != e {
+			t.Errorf("got %q, want %q", found[i].Error(), e.Error())
+		}
+	}
+}
+
+func TestValidateValidTestYaml(t *testing.T) {
+	for _, contents := range []string{yamlTest, errorsTest, yamlTaggedTest} {
+		if found := ValidateTestYaml("test.yaml", []byte(contents)); len(found) != 0 {
+			t.Errorf("unexpected errors: %v", found)
+		}
+	}
+}
+
+func TestValidateBrokenTestYaml(t *testing.T) {
+	found := ValidateTestYaml("test.yaml", []byte(brokenYamlTest))
+	if len(found) != 1 {
+		t.Fatalf("expected one syntax error, got %v", found)
+	}
+	if found[0].Line == 0 {
+		t.Errorf("syntax error must have a position: %s", found[0].Error())
+	}
+}
+
+func TestValidateMalformedTestYaml(t *testing.T) {
+	found := ValidateTestYaml("test.yaml", []byte("meta: }\n"))
+	if len(found) != 1 {
+		t.Fatalf("expected one syntax error, got %v", found)
+	}
+}
+
+func TestValidateTestFiles(t *testing.T) {
+	filename, _ := utils.CreateTempFileWithContent(invalidYamlTest, "test-yaml-*")
+	defer os.Remove(filename)
+
+	found, count, err := ValidateTestFiles(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected one file to be validated, got %d", count)
+	}
+	if len(found) == 0 || found[0].File != filename {
+		t.Errorf("expected errors for %s, got %v", filename, found)
+	}
+}
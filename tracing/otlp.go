@@ -0,0 +1,214 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// The status codes of OTLP, which are not the ones of the API
+const (
+	otlpStatusUnset = 0
+	otlpStatusOk    = 1
+	otlpStatusError = 2
+)
+
+// Exporter sends the spans to an OTLP endpoint over HTTP, encoded as JSON, like
+// `http://collector:4318/v1/traces`
+type Exporter struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+
+	mu       sync.Mutex
+	shutdown bool
+}
+
+// NewExporter returns an exporter sending the spans to the OTLP endpoint with the headers, e.g.
+// the ones holding the credentials of the tracing backend
+func NewExporter(client *http.Client, endpoint string, headers map[string]string) *Exporter {
+	return &Exporter{
+		client:   client,
+		endpoint: endpoint,
+		headers:  headers,
+	}
+}
+
+// ExportSpans sends the spans to the endpoint
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	shutdown := e.shutdown
+	e.mu.Unlock()
+	if shutdown || len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return fmt.Errorf("ftw/tracing: can't encode the spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ftw/tracing: bad OTLP endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ftw/tracing: can't send the spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ftw/tracing: the OTLP endpoint answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// Shutdown stops sending the spans
+func (e *Exporter) Shutdown(_ context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+// otlpRequest groups the spans by resource and by instrumentation scope, like the export
+// requests of OTLP
+func otlpRequest(spans []sdktrace.ReadOnlySpan) map[string]interface{} {
+	var resourceSpans []map[string]interface{}
+	resourceIndex := make(map[*resource.Resource]int)
+	scopeIndex := make(map[*resource.Resource]map[instrumentation.Scope]int)
+	for _, span := range spans {
+		res := span.Resource()
+		i, ok := resourceIndex[res]
+		if !ok {
+			i = len(resourceSpans)
+			resourceIndex[res] = i
+			scopeIndex[res] = make(map[instrumentation.Scope]int)
+			resourceSpans = append(resourceSpans, map[string]interface{}{
+				"resource":   map[string]interface{}{"attributes": otlpAttributes(res.Attributes())},
+				"scopeSpans": []map[string]interface{}{},
+			})
+		}
+		scopeSpans := resourceSpans[i]["scopeSpans"].([]map[string]interface{})
+		scope := span.InstrumentationScope()
+		j, ok := scopeIndex[res][scope]
+		if !ok {
+			j = len(scopeSpans)
+			scopeIndex[res][scope] = j
+			scopeSpans = append(scopeSpans, map[string]interface{}{
+				"scope": map[string]interface{}{"name": scope.Name, "version": scope.Version},
+				"spans": []map[string]interface{}{},
+			})
+		}
+		scopeSpans[j]["spans"] = append(scopeSpans[j]["spans"].([]map[string]interface{}), otlpSpan(span))
+		resourceSpans[i]["scopeSpans"] = scopeSpans
+	}
+	return map[string]interface{}{"resourceSpans": resourceSpans}
+}
+
+func otlpSpan(span sdktrace.ReadOnlySpan) map[string]interface{} {
+	sc := span.SpanContext()
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+	s := map[string]interface{}{
+		"traceId":           hex.EncodeToString(traceID[:]),
+		"spanId":            hex.EncodeToString(spanID[:]),
+		"name":              span.Name(),
+		"kind":              int(span.SpanKind()),
+		"startTimeUnixNano": strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		"attributes":        otlpAttributes(span.Attributes()),
+	}
+	if parent := span.Parent(); parent.IsValid() {
+		parentID := parent.SpanID()
+		s["parentSpanId"] = hex.EncodeToString(parentID[:])
+	}
+
+	var events []map[string]interface{}
+	for _, event := range span.Events() {
+		events = append(events, map[string]interface{}{
+			"name":         event.Name,
+			"timeUnixNano": strconv.FormatInt(event.Time.UnixNano(), 10),
+			"attributes":   otlpAttributes(event.Attributes),
+		})
+	}
+	if len(events) > 0 {
+		s["events"] = events
+	}
+
+	status := map[string]interface{}{"code": otlpStatusUnset}
+	switch span.Status().Code {
+	case codes.Ok:
+		status["code"] = otlpStatusOk
+	case codes.Error:
+		status["code"] = otlpStatusError
+		status["message"] = span.Status().Description
+	}
+	s["status"] = status
+	return s
+}
+
+func otlpAttributes(attributes []attribute.KeyValue) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(attributes))
+	for _, kv := range attributes {
+		result = append(result, map[string]interface{}{
+			"key":   string(kv.Key),
+			"value": otlpValue(kv.Value),
+		})
+	}
+	return result
+}
+
+// otlpValue encodes an attribute value. Integers are written as strings, like all the 64 bits
+// integers of OTLP.
+func otlpValue(value attribute.Value) map[string]interface{} {
+	switch value.Type() {
+	case attribute.BOOL:
+		return map[string]interface{}{"boolValue": value.AsBool()}
+	case attribute.INT64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(value.AsInt64(), 10)}
+	case attribute.FLOAT64:
+		return map[string]interface{}{"doubleValue": value.AsFloat64()}
+	case attribute.BOOLSLICE:
+		var values []map[string]interface{}
+		for _, v := range value.AsBoolSlice() {
+			values = append(values, otlpValue(attribute.BoolValue(v)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case attribute.INT64SLICE:
+		var values []map[string]interface{}
+		for _, v := range value.AsInt64Slice() {
+			values = append(values, otlpValue(attribute.Int64Value(v)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case attribute.FLOAT64SLICE:
+		var values []map[string]interface{}
+		for _, v := range value.AsFloat64Slice() {
+			values = append(values, otlpValue(attribute.Float64Value(v)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case attribute.STRINGSLICE:
+		var values []map[string]interface{}
+		for _, v := range value.AsStringSlice() {
+			values = append(values, otlpValue(attribute.StringValue(v)))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	default:
+		return map[string]interface{}{"stringValue": value.Emit()}
+	}
+}
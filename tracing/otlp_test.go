@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestExporter(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(server.Close)
+
+	exporter := NewExporter(server.Client(), server.URL+"/v1/traces", map[string]string{"Api-Key": "secret"})
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", ServiceName))),
+	)
+	tracer := provider.Tracer("github.com/coreruleset/go-ftw/runner")
+	ctx, parent := tracer.Start(context.Background(), "stage")
+	_, child := tracer.Start(ctx, "request")
+	child.SetAttributes(attribute.Int("http.status_code", 403), attribute.StringSlice("ftw.tags", []string{"a", "b"}))
+	child.RecordError(errors.New("connection reset"))
+	child.SetStatus(codes.Error, "connection reset")
+	child.End()
+
+	if header.Get("Content-Type") != "application/json" || header.Get("Api-Key") != "secret" {
+		t.Errorf("unexpected headers %v", header)
+	}
+	var request struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]interface{} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				Spans []struct {
+					TraceID      string                   `json:"traceId"`
+					SpanID       string                   `json:"spanId"`
+					ParentSpanID string                   `json:"parentSpanId"`
+					Name         string                   `json:"name"`
+					Attributes   []map[string]interface{} `json:"attributes"`
+					Events       []map[string]interface{} `json:"events"`
+					Status       struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("unexpected request %s", body)
+	}
+	scope := request.ResourceSpans[0].ScopeSpans[0]
+	span := scope.Spans[0]
+	parentID := parent.SpanContext().SpanID()
+	if scope.Scope.Name != "github.com/coreruleset/go-ftw/runner" || span.Name != "request" || len(span.TraceID) != 32 || span.ParentSpanID != parentID.String() {
+		t.Errorf("unexpected span %s", body)
+	}
+	if span.Status.Code != otlpStatusError || span.Status.Message != "connection reset" || len(span.Events) != 1 {
+		t.Errorf("the error must be exported, got %s", body)
+	}
+	for _, expected := range []string{
+		`{"key":"http.status_code","value":{"intValue":"403"}}`,
+		`{"key":"ftw.tags","value":{"arrayValue":{"values":[{"stringValue":"a"},{"stringValue":"b"}]}}}`,
+		`{"key":"service.name","value":{"stringValue":"ftw"}}`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("%s not found in %s", expected, body)
+		}
+	}
+
+	parent.End()
+	if !strings.Contains(string(body), `"name":"stage"`) || strings.Contains(string(body), "parentSpanId") {
+		t.Errorf("root spans have no parent, got %s", body)
+	}
+}
+
+func TestExporterError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	exporter := NewExporter(server.Client(), server.URL, nil)
+	provider := sdktrace.NewTracerProvider()
+	_, span := provider.Tracer("test").Start(context.Background(), "run")
+	span.End()
+	stub := []sdktrace.ReadOnlySpan{span.(sdktrace.ReadOnlySpan)}
+	if err := exporter.ExportSpans(context.Background(), stub); err == nil || !strings.Contains(err.Error(), "unauthorized tenant") {
+		t.Errorf("the error of the endpoint must be returned, got %v", err)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.ExportSpans(context.Background(), stub); err != nil {
+		t.Errorf("spans are dropped after the shutdown, got %v", err)
+	}
+}
+
+func TestTracesEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if endpoint := TracesEndpoint(""); endpoint != "" {
+		t.Errorf("no endpoint expected, got %s", endpoint)
+	}
+	if endpoint := TracesEndpoint("http://collector:4318/"); endpoint != "http://collector:4318/v1/traces" {
+		t.Errorf("unexpected endpoint %s", endpoint)
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://env:4318")
+	if endpoint := TracesEndpoint(""); endpoint != "http://env:4318/v1/traces" {
+		t.Errorf("unexpected endpoint %s", endpoint)
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://env:4318/custom")
+	if endpoint := TracesEndpoint(""); endpoint != "http://env:4318/custom" {
+		t.Errorf("the traces endpoint must be used as is, got %s", endpoint)
+	}
+	if endpoint := TracesEndpoint("http://flag:4318"); endpoint != "http://flag:4318/v1/traces" {
+		t.Errorf("the flag must win, got %s", endpoint)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret, tenant = waf,broken")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "tenant=traces")
+	headers := Headers()
+	if len(headers) != 2 || headers["api-key"] != "secret" || headers["tenant"] != "traces" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+}
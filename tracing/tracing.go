@@ -0,0 +1,78 @@
+// Package tracing exports the spans of the runs, from the run down to the requests of the stages,
+// to a tracing backend over OTLP, so slow stages and markers can be analyzed
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ServiceName is the name of the service of the spans
+	ServiceName = "ftw"
+	// tracesPath is the path of the traces under the OTLP endpoint
+	tracesPath = "/v1/traces"
+	// exportTimeout is the time allowed to send a batch of spans
+	exportTimeout = 10 * time.Second
+)
+
+// Tracer returns the tracer of a package of ftw. Spans are dropped until Setup is called.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// TracesEndpoint returns the URL the spans are sent to: the traces path under the endpoint
+// when set, or the endpoint of the standard OpenTelemetry environment variables. It's empty
+// when there is no endpoint.
+func TracesEndpoint(endpoint string) string {
+	if endpoint == "" {
+		if traces := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); traces != "" {
+			return traces
+		}
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return ""
+	}
+	return strings.TrimSuffix(endpoint, "/") + tracesPath
+}
+
+// Headers returns the headers sent with the spans, from the standard OpenTelemetry environment
+// variables, like `OTEL_EXPORTER_OTLP_HEADERS=api-key=secret,tenant=waf`
+func Headers() map[string]string {
+	headers := make(map[string]string)
+	for _, variable := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for _, pair := range strings.Split(os.Getenv(variable), ",") {
+			name, value, found := strings.Cut(pair, "=")
+			if found && strings.TrimSpace(name) != "" {
+				headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return headers
+}
+
+// Setup sends the spans of the tracers to the OTLP traces endpoint. The returned function sends
+// the spans not sent yet, and must be called before exiting.
+func Setup(tracesEndpoint string, version string) func(context.Context) error {
+	exporter := NewExporter(&http.Client{Timeout: exportTimeout}, tracesEndpoint, Headers())
+	res := resource.NewSchemaless(
+		attribute.String("service.name", ServiceName),
+		attribute.String("service.version", version),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithExportTimeout(exportTimeout)),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown
+}
@@ -0,0 +1,510 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+const (
+	// chromeLines are the lines of the screen around the list of the tests or the details of one
+	chromeLines = 3
+	// maxProgressWidth is the width of the progress bar on wide screens
+	maxProgressWidth = 40
+)
+
+// the styles of the results, and of the lines around the tests
+var (
+	passedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	failedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true)
+	runningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	faintStyle   = lipgloss.NewStyle().Faint(true)
+	cursorStyle  = lipgloss.NewStyle().Reverse(true)
+	titleStyle   = lipgloss.NewStyle().Bold(true)
+)
+
+// resultOrder are the results of the stages, from the one that decides the result of a test the
+// most to the one that decides it the least
+var resultOrder = []string{
+	runner.Failed.String(),
+	runner.ForceFail.String(),
+	runner.Success.String(),
+	runner.ForcePass.String(),
+	runner.Ignored.String(),
+	runner.Skipped.String(),
+}
+
+// testEntry is a test of the browser, with the results of its stages in its last run
+type testEntry struct {
+	ftwTest  test.FTWTest
+	testCase test.Test
+	// stages are the stage_finished events of the last run of the test
+	stages  []runner.Event
+	running bool
+}
+
+func (e *testEntry) file() string {
+	return e.ftwTest.FileName
+}
+
+func (e *testEntry) title() string {
+	return e.testCase.TestTitle
+}
+
+// done returns whether all the stages of the test ran, or the test was skipped
+func (e *testEntry) done() bool {
+	if len(e.stages) == 1 && e.stages[0].Stage == 0 {
+		return true
+	}
+	return len(e.stages) > 0 && len(e.stages) >= len(e.testCase.Stages)
+}
+
+// result returns the name of the result of the test, empty until one of its stages finished
+func (e *testEntry) result() string {
+	for _, result := range resultOrder {
+		for _, stage := range e.stages {
+			if stage.Result == result {
+				return result
+			}
+		}
+	}
+	return ""
+}
+
+func (e *testEntry) failed() bool {
+	result := e.result()
+	return result == runner.Failed.String() || result == runner.ForceFail.String()
+}
+
+// eventMsg is an event of a run, and runDoneMsg the end of a run
+type eventMsg runner.Event
+
+type runDoneMsg struct {
+	runContext runner.TestRunContext
+	// rerun is set when only some of the tests ran again
+	rerun bool
+}
+
+// model is the state of the browser
+type model struct {
+	tests []*testEntry
+	// byTest has the tests by file and title
+	byTest map[string]*testEntry
+	// visible are the indexes of the tests listed, all of them or the failed ones, and cursor the
+	// index of the selected test in them
+	visible      []int
+	cursor       int
+	failuresOnly bool
+	// shown is the test whose details are shown in the viewport, nil when the tests are listed
+	shown    *testEntry
+	viewport viewport.Model
+	progress progress.Model
+	width    int
+	height   int
+	// events are the events of the runs, and run starts a run of the tests
+	events <-chan runner.Event
+	run    func(tests []test.FTWTest, rerun bool) runner.TestRunContext
+	// running is set while a run is in progress, and started is the time it started
+	running bool
+	started time.Time
+	elapsed time.Duration
+	// runErr is the error that stopped the last run, if any
+	runErr string
+	// first is the context of the first run, set when it's done
+	first *runner.TestRunContext
+}
+
+func newModel(tests []test.FTWTest, events <-chan runner.Event, run func([]test.FTWTest, bool) runner.TestRunContext) *model {
+	m := &model{
+		byTest:   map[string]*testEntry{},
+		events:   events,
+		run:      run,
+		viewport: viewport.New(0, 0),
+		progress: progress.New(progress.WithDefaultGradient()),
+	}
+	for _, ftwTest := range tests {
+		for _, testCase := range ftwTest.Tests {
+			entry := &testEntry{ftwTest: ftwTest, testCase: testCase}
+			m.tests = append(m.tests, entry)
+			m.byTest[testKey(ftwTest.FileName, testCase.TestTitle)] = entry
+		}
+	}
+	m.filter()
+	return m
+}
+
+func testKey(file string, title string) string {
+	return file + "\x00" + title
+}
+
+// Init starts the run of all the tests
+func (m *model) Init() tea.Cmd {
+	tests := make([]test.FTWTest, 0, len(m.tests))
+	var last string
+	for _, entry := range m.tests {
+		if entry.file() != last {
+			tests = append(tests, entry.ftwTest)
+			last = entry.file()
+		}
+	}
+	return tea.Batch(m.startRun(tests, false), m.waitForEvent)
+}
+
+// startRun runs the tests, unless a run is in progress
+func (m *model) startRun(tests []test.FTWTest, rerun bool) tea.Cmd {
+	if m.running {
+		return nil
+	}
+	m.running = true
+	m.started = time.Now()
+	run := m.run
+	return func() tea.Msg {
+		return runDoneMsg{runContext: run(tests, rerun), rerun: rerun}
+	}
+}
+
+// waitForEvent waits for the next event of the runs
+func (m *model) waitForEvent() tea.Msg {
+	event, ok := <-m.events
+	if !ok {
+		return nil
+	}
+	return eventMsg(event)
+}
+
+// Update updates the state of the browser
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.viewport.Width, m.viewport.Height = msg.Width, m.listHeight()
+		m.progress.Width = clamp(msg.Width/3, 1, maxProgressWidth)
+		return m, nil
+	case eventMsg:
+		m.handleEvent(runner.Event(msg))
+		return m, m.waitForEvent
+	case runDoneMsg:
+		if !msg.rerun && m.first == nil {
+			first := msg.runContext
+			m.first = &first
+		}
+		return m, nil
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *model) handleEvent(event runner.Event) {
+	switch event.Type {
+	case runner.TestStarted:
+		if entry, ok := m.byTest[testKey(event.File, event.Test)]; ok {
+			entry.stages = nil
+			entry.running = true
+		}
+	case runner.StageFinished:
+		if entry, ok := m.byTest[testKey(event.File, event.Test)]; ok {
+			entry.stages = append(entry.stages, event)
+			entry.running = !entry.done()
+		}
+	case runner.RunFinished:
+		m.running = false
+		m.elapsed = time.Since(m.started)
+		m.runErr = event.Error
+	}
+	m.filter()
+	if m.shown != nil {
+		m.viewport.SetContent(m.details())
+	}
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "r":
+		return m, m.rerun()
+	}
+	if m.shown != nil {
+		switch msg.String() {
+		case "esc", "backspace", "left", "h":
+			m.shown = nil
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+	switch msg.String() {
+	case "up", "k":
+		m.moveCursor(-1)
+	case "down", "j":
+		m.moveCursor(1)
+	case "pgup":
+		m.moveCursor(-m.listHeight())
+	case "pgdown":
+		m.moveCursor(m.listHeight())
+	case "home", "g":
+		m.moveCursor(-len(m.visible))
+	case "end", "G":
+		m.moveCursor(len(m.visible))
+	case "f":
+		m.failuresOnly = !m.failuresOnly
+		m.filter()
+	case "enter", "right", "l":
+		if m.shown = m.selected(); m.shown != nil {
+			m.viewport.SetContent(m.details())
+			m.viewport.GotoTop()
+		}
+	}
+	return m, nil
+}
+
+// rerun runs the test shown, or the selected one, again
+func (m *model) rerun() tea.Cmd {
+	entry := m.shown
+	if entry == nil {
+		entry = m.selected()
+	}
+	if entry == nil || m.running {
+		return nil
+	}
+	ftwTest := entry.ftwTest
+	ftwTest.Tests = []test.Test{entry.testCase}
+	entry.stages = nil
+	entry.running = true
+	return m.startRun([]test.FTWTest{ftwTest}, true)
+}
+
+// filter updates the tests listed, keeping the selected test if it's still listed
+func (m *model) filter() {
+	selected := m.selected()
+	m.visible = m.visible[:0]
+	for i, entry := range m.tests {
+		if !m.failuresOnly || entry.failed() {
+			m.visible = append(m.visible, i)
+		}
+	}
+	m.moveCursor(0)
+	m.selectTest(selected)
+}
+
+func (m *model) moveCursor(delta int) {
+	m.cursor = clamp(m.cursor+delta, 0, len(m.visible)-1)
+}
+
+// selected returns the selected test, nil when no test is listed
+func (m *model) selected() *testEntry {
+	if len(m.visible) == 0 {
+		return nil
+	}
+	return m.tests[m.visible[m.cursor]]
+}
+
+// selectTest moves the cursor to the test, if it's listed
+func (m *model) selectTest(entry *testEntry) {
+	for i, index := range m.visible {
+		if m.tests[index] == entry {
+			m.cursor = i
+			return
+		}
+	}
+}
+
+func (m *model) listHeight() int {
+	if m.height <= chromeLines {
+		return 1
+	}
+	return m.height - chromeLines
+}
+
+// View renders the list of the tests or the details of the selected one, between the progress
+// of the run and the keys that can be used
+func (m *model) View() string {
+	var b strings.Builder
+	b.WriteString(m.header())
+	b.WriteString("\n\n")
+	if m.shown != nil {
+		b.WriteString(m.viewport.View())
+		b.WriteString("\n")
+		b.WriteString(faintStyle.Render("↑/↓ scroll • r run again • esc back • q quit"))
+		return b.String()
+	}
+	height := m.listHeight()
+	start := 0
+	if m.cursor >= height {
+		start = m.cursor - height + 1
+	}
+	for i := start; i < len(m.visible) && i < start+height; i++ {
+		line := m.truncate(m.row(m.tests[m.visible[i]]))
+		if i == m.cursor {
+			line = cursorStyle.Render(line)
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	for i := len(m.visible) - start; i < height; i++ {
+		b.WriteString("\n")
+	}
+	help := "↑/↓ select • enter details • r run again • f failures only • q quit"
+	if m.failuresOnly {
+		help = "↑/↓ select • enter details • r run again • f all tests • q quit"
+	}
+	b.WriteString(faintStyle.Render(help))
+	return b.String()
+}
+
+// header returns the progress of the run, with the number of the tests done and failed
+func (m *model) header() string {
+	done, failed := 0, 0
+	for _, entry := range m.tests {
+		if entry.done() {
+			done++
+		}
+		if entry.failed() {
+			failed++
+		}
+	}
+	percent := 0.0
+	if len(m.tests) > 0 {
+		percent = float64(done) / float64(len(m.tests))
+	}
+	state := runningStyle.Render("running")
+	if !m.running {
+		state = fmt.Sprintf("done in %s", m.elapsed.Round(time.Millisecond))
+	}
+	if !m.running && m.runErr != "" {
+		state = failedStyle.Render("stopped: " + m.runErr)
+	}
+	failures := fmt.Sprintf("%d failed", failed)
+	if failed > 0 {
+		failures = failedStyle.Render(failures)
+	}
+	return fmt.Sprintf("%s %s %d/%d tests, %s, %s", titleStyle.Render("go-ftw"), m.progress.ViewAs(percent), done, len(m.tests), failures, state)
+}
+
+// row returns the line of a test in the list
+func (m *model) row(entry *testEntry) string {
+	var result string
+	switch {
+	case entry.running:
+		result = runningStyle.Render("running")
+	case entry.failed():
+		result = failedStyle.Render(entry.result())
+	case entry.result() == runner.Success.String() || entry.result() == runner.ForcePass.String():
+		result = passedStyle.Render(entry.result())
+	case entry.result() == "":
+		result = faintStyle.Render("pending")
+	default:
+		result = faintStyle.Render(entry.result())
+	}
+	return fmt.Sprintf("%-12s %s %s", result, entry.title(), faintStyle.Render(filepath.Base(entry.file())))
+}
+
+// truncate cuts the line to the width of the screen
+func (m *model) truncate(line string) string {
+	if m.width <= 0 {
+		return line
+	}
+	return lipgloss.NewStyle().MaxWidth(m.width).Render(line)
+}
+
+// details returns the results of the stages of the test shown, with the request, the response
+// and the logs of the failed ones
+func (m *model) details() string {
+	entry := m.shown
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", titleStyle.Render(entry.title()), faintStyle.Render(entry.file()))
+	if entry.testCase.TestDescription != "" {
+		fmt.Fprintf(&b, "%s\n", entry.testCase.TestDescription)
+	}
+	if len(entry.stages) == 0 {
+		b.WriteString("\nthe test didn't run yet\n")
+	}
+	for _, stage := range entry.stages {
+		b.WriteString("\n")
+		b.WriteString(stageLine(stage))
+		b.WriteString("\n")
+		if stage.Evidence == nil {
+			continue
+		}
+		if stage.Evidence.Error != "" {
+			fmt.Fprintf(&b, "\n%s\n%s\n", titleStyle.Render("error"), stage.Evidence.Error)
+		}
+		if stage.Evidence.Request != "" {
+			fmt.Fprintf(&b, "\n%s\n%s\n", titleStyle.Render("request"), printable(stage.Evidence.Request))
+		}
+		if stage.Evidence.Response != "" {
+			fmt.Fprintf(&b, "\n%s\n%s\n", titleStyle.Render("response"), printable(stage.Evidence.Response))
+		}
+		if len(stage.Evidence.Logs) > 0 {
+			fmt.Fprintf(&b, "\n%s\n%s\n", titleStyle.Render("logs"), strings.Join(stage.Evidence.Logs, "\n"))
+		}
+	}
+	return b.String()
+}
+
+// stageLine returns the result of the stage, with its status code, round trip time and
+// triggered rules
+func stageLine(stage runner.Event) string {
+	result := stage.Result
+	switch result {
+	case runner.Failed.String(), runner.ForceFail.String():
+		result = failedStyle.Render(result)
+	case runner.Success.String(), runner.ForcePass.String():
+		result = passedStyle.Render(result)
+	}
+	parts := []string{result}
+	if stage.StatusCode != 0 {
+		parts = append(parts, fmt.Sprintf("status %d", stage.StatusCode))
+	}
+	if stage.RoundTripTime != 0 {
+		parts = append(parts, fmt.Sprintf("RTT %s", time.Duration(stage.RoundTripTime*float64(time.Millisecond)).Round(time.Microsecond)))
+	}
+	if len(stage.TriggeredRules) > 0 {
+		ids := make([]string, len(stage.TriggeredRules))
+		for i, id := range stage.TriggeredRules {
+			ids[i] = strconv.Itoa(id)
+		}
+		parts = append(parts, "triggered "+strings.Join(ids, ", "))
+	}
+	name := "stage"
+	if stage.Stage > 0 {
+		name = fmt.Sprintf("stage %d", stage.Stage)
+	}
+	return fmt.Sprintf("%s: %s", titleStyle.Render(name), strings.Join(parts, ", "))
+}
+
+// printable returns the request or response without carriage returns, and with dots instead of
+// the other control characters, so they don't mess with the screen
+func printable(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || (r >= ' ' && r != 0x7f) {
+			return r
+		}
+		return '.'
+	}, s)
+}
+
+// clamp returns the value, or the closest bound when it's out of them. The upper bound wins
+// when they cross, like with no test listed.
+func clamp(value int, low int, high int) int {
+	if value > high {
+		value = high
+	}
+	if value < low {
+		value = low
+	}
+	return value
+}
@@ -0,0 +1,199 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+var yamlTests = `---
+meta:
+  author: "tester"
+  enabled: true
+  name: "942100.yaml"
+tests:
+  - test_title: "942100-1"
+    desc: "SQL injection"
+    stages:
+      - stage:
+          input:
+            uri: "/?id=1%27%20or%201=1"
+          output:
+            log:
+              rule_ids: [942100]
+      - stage:
+          input:
+            uri: "/?id=2"
+          output:
+            log:
+              no_rule_ids: [942100]
+  - test_title: "942100-2"
+    stages:
+      - stage:
+          input:
+            uri: "/?id=1"
+          output:
+            log:
+              no_rule_ids: [942100]
+`
+
+// newTestModel returns a browser of the tests, with the tests that it runs
+func newTestModel(t *testing.T) (*model, *[][]test.FTWTest) {
+	ftwTest, err := test.GetTestFromYaml([]byte(yamlTests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftwTest.FileName = "tests/942100.yaml"
+	var runs [][]test.FTWTest
+	m := newModel([]test.FTWTest{ftwTest}, nil, func(tests []test.FTWTest, rerun bool) runner.TestRunContext {
+		runs = append(runs, tests)
+		return runner.TestRunContext{}
+	})
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 20})
+	return m, &runs
+}
+
+func stageFinished(title string, stage int, result string) eventMsg {
+	return eventMsg{Type: runner.StageFinished, File: "tests/942100.yaml", Test: title, Stage: stage, Result: result}
+}
+
+func key(k string) tea.KeyMsg {
+	switch k {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "down":
+		return tea.KeyMsg{Type: tea.KeyDown}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+func TestProgress(t *testing.T) {
+	m, _ := newTestModel(t)
+	m.running = true
+	if !strings.Contains(m.View(), "0/2 tests") || !strings.Contains(m.View(), "pending") {
+		t.Errorf("no test ran yet, got\n%s", m.View())
+	}
+
+	m.Update(eventMsg{Type: runner.TestStarted, File: "tests/942100.yaml", Test: "942100-1"})
+	m.Update(stageFinished("942100-1", 1, "passed"))
+	if !m.tests[0].running || m.tests[0].done() {
+		t.Errorf("the test has a stage left")
+	}
+	m.Update(stageFinished("942100-1", 2, "failed"))
+	if m.tests[0].running || !m.tests[0].done() || m.tests[0].result() != "failed" {
+		t.Errorf("the test failed in its last stage, got %+v", m.tests[0])
+	}
+	m.Update(stageFinished("942100-2", 0, "skipped"))
+	m.Update(eventMsg{Type: runner.RunFinished})
+	view := m.View()
+	if m.running || !strings.Contains(view, "2/2 tests") || !strings.Contains(view, "1 failed") || !strings.Contains(view, "done in") {
+		t.Errorf("unexpected progress\n%s", view)
+	}
+	if !strings.Contains(view, "skipped") {
+		t.Errorf("the skipped test must be listed, got\n%s", view)
+	}
+	m.Update(eventMsg{Type: runner.RunFinished, Error: "ftw/run: can't connect to destination"})
+	if view := m.View(); !strings.Contains(view, "stopped: ftw/run: can't connect to destination") {
+		t.Errorf("the error of the run must be shown\n%s", view)
+	}
+	m.Update(runDoneMsg{runContext: runner.TestRunContext{Stats: runner.TestStats{Run: 2}}})
+	if m.first == nil || m.first.Stats.Run != 2 {
+		t.Errorf("expected the context of the first run, got %+v", m.first)
+	}
+}
+
+func TestDetails(t *testing.T) {
+	m, _ := newTestModel(t)
+	failed := stageFinished("942100-1", 1, "failed")
+	failed.StatusCode = 403
+	failed.TriggeredRules = []int{942100, 949110}
+	failed.Evidence = &runner.StageEvidence{
+		Request:  "GET /?id=2 HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		Response: "HTTP/1.1 403 Forbidden\r\n\r\n\x1b[2J",
+		Logs:     []string{`[id "942100"] [msg "SQL Injection Attack"]`},
+	}
+	m.Update(failed)
+
+	m.Update(key("enter"))
+	if m.shown != m.tests[0] {
+		t.Fatalf("expected the details of the selected test")
+	}
+	details := m.details()
+	for _, expected := range []string{"942100-1", "SQL injection", "status 403", "942100, 949110", "GET /?id=2 HTTP/1.1\nHost: localhost\n", "HTTP/1.1 403 Forbidden", `[msg "SQL Injection Attack"]`} {
+		if !strings.Contains(details, expected) {
+			t.Errorf("expected %q in the details\n%s", expected, details)
+		}
+	}
+	if strings.Contains(details, "\x1b") || strings.Contains(details, "\r") {
+		t.Errorf("the control characters of the response must be replaced, got %q", details)
+	}
+
+	m.Update(key("esc"))
+	if m.shown != nil {
+		t.Errorf("expected the list of the tests")
+	}
+}
+
+func TestFailuresOnly(t *testing.T) {
+	m, _ := newTestModel(t)
+	m.Update(stageFinished("942100-1", 1, "passed"))
+	m.Update(stageFinished("942100-1", 2, "passed"))
+	m.Update(stageFinished("942100-2", 1, "failed"))
+	m.Update(key("f"))
+	if len(m.visible) != 1 || m.selected() != m.tests[1] {
+		t.Fatalf("only the failed test must be listed, got %v", m.visible)
+	}
+	if strings.Contains(m.View(), "942100-1") {
+		t.Errorf("the passed test must not be listed\n%s", m.View())
+	}
+
+	// the test stays selected when the other ones are listed again
+	m.Update(key("f"))
+	if len(m.visible) != 2 || m.selected() != m.tests[1] {
+		t.Errorf("all the tests must be listed, got %v", m.visible)
+	}
+}
+
+func TestRerun(t *testing.T) {
+	m, runs := newTestModel(t)
+	m.Update(stageFinished("942100-1", 1, "passed"))
+	m.Update(stageFinished("942100-1", 2, "passed"))
+	m.Update(stageFinished("942100-2", 1, "failed"))
+	m.Update(key("down"))
+
+	// no test runs again while a run is in progress
+	m.running = true
+	if _, cmd := m.Update(key("r")); cmd != nil {
+		t.Fatalf("expected no run while the tests run")
+	}
+	m.running = false
+
+	_, cmd := m.Update(key("r"))
+	if cmd == nil {
+		t.Fatalf("expected the test to run again")
+	}
+	if !m.running || !m.tests[1].running || m.tests[1].stages != nil {
+		t.Errorf("the results of the test must be cleared while it runs again")
+	}
+	if done, ok := cmd().(runDoneMsg); !ok || !done.rerun {
+		t.Errorf("unexpected message %+v", done)
+	}
+	if len(*runs) != 1 || len((*runs)[0]) != 1 || len((*runs)[0][0].Tests) != 1 || (*runs)[0][0].Tests[0].TestTitle != "942100-2" {
+		t.Errorf("only the selected test must run again, got %+v", *runs)
+	}
+	if m.first != nil {
+		t.Errorf("the run of a test again is not the first run")
+	}
+}
+
+func TestPrintable(t *testing.T) {
+	if s := printable("GET / HTTP/1.1\r\nX: a\x00b\tc\r\n"); s != "GET / HTTP/1.1\nX: a.b\tc\n" {
+		t.Errorf("unexpected printable text %q", s)
+	}
+}
@@ -0,0 +1,117 @@
+// Package tui implements the terminal user interface of `ftw run --tui`. It shows the progress of
+// the run, the details of the tests with the request, the response and the logs of the stages
+// that failed, and runs the tests again on demand.
+package tui
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/runner"
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// ErrInterrupted is returned when the user quits before the end of the run
+var ErrInterrupted = errors.New("ftw/tui: quit before the end of the run")
+
+// Run runs the tests with the configuration of ftw and the Config of the runner, like
+// runner.Run, showing them in the terminal until the user quits. The tests run again on demand
+// run with the same Config, without the include and exclude filters. Returns the context of the
+// first run of the tests, or ErrInterrupted if the user quit before its end.
+//
+// The logs are written to stderr once the user quits, so they don't mess with the screen.
+func Run(cfg *config.FTWConfiguration, tests []test.FTWTest, c runner.Config) (runner.TestRunContext, error) {
+	events := make(chan runner.Event)
+	c.Quiet = true
+	c.Evidence = true
+	c.Events = &eventWriter{events: events}
+	run := func(tests []test.FTWTest, rerun bool) runner.TestRunContext {
+		rc := c
+		if rerun {
+			rc.Include, rc.Exclude, rc.Metrics = nil, nil, nil
+		}
+		return runner.Run(cfg, tests, rc)
+	}
+
+	m := newModel(tests, events, run)
+	program := tea.NewProgram(m, tea.WithAltScreen())
+	logger := log.Logger
+	logs := &logWriter{program: program, logger: logger}
+	log.Logger = log.Output(logs)
+	_, err := program.Run()
+	log.Logger = logger
+	logs.flush()
+	if err != nil {
+		return runner.TestRunContext{}, err
+	}
+	if m.first == nil {
+		return runner.TestRunContext{}, ErrInterrupted
+	}
+	return *m.first, nil
+}
+
+// eventWriter sends the events written by the runner to the browser
+type eventWriter struct {
+	events chan<- runner.Event
+}
+
+// Write sends the event on the line to the browser, waiting for it to take it
+func (w *eventWriter) Write(p []byte) (int, error) {
+	var event runner.Event
+	if err := json.Unmarshal(p, &event); err != nil {
+		return 0, err
+	}
+	w.events <- event
+	return len(p), nil
+}
+
+// logWriter keeps the logs written while the browser is shown, to write them once it's closed.
+// The fatal errors release the terminal and are written right away, since the program exits, and
+// logged with the logger of the program, so it exits like it does for its other fatal errors.
+type logWriter struct {
+	program *tea.Program
+	logger  zerolog.Logger
+	mu      sync.Mutex
+	logs    bytes.Buffer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel keeps the log line, formatted like the other logs, or writes the kept ones and the
+// line on fatal errors
+func (w *logWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := (zerolog.ConsoleWriter{Out: &w.logs}).Write(p); err != nil {
+		return 0, err
+	}
+	if level == zerolog.FatalLevel || level == zerolog.PanicLevel {
+		_ = w.program.ReleaseTerminal()
+		w.flushLocked()
+		if level == zerolog.FatalLevel {
+			w.logger.WithLevel(zerolog.FatalLevel).Msg("ftw/tui: stopped on a fatal error")
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the logs kept to stderr
+func (w *logWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushLocked()
+}
+
+func (w *logWriter) flushLocked() {
+	_, _ = w.logs.WriteTo(os.Stderr)
+}
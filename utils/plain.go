@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"os"
+
+	"github.com/kyokomi/emoji"
+)
+
+// plainMarkers are the text markers replacing the emoji of the output in plain mode
+var plainMarkers = map[string]string{
+	":bookmark_tabs:":     "[FAMILIES]",
+	":check_mark:":        "[PASS]",
+	":collision:":         "[FAIL]",
+	":hammer_and_wrench:": "[START]",
+	":index_pointing_up:": "[NOTE]",
+	":information:":       "[INFO]",
+	":next_track_button:": "[SKIP]",
+	":person_shrugging:":  "[NONE]",
+	":plus:":              "[TOTAL]",
+	":point_right:":       "[FILE]",
+	":rocket:":            "[RUN]",
+	":sparkles:":          "[NEW]",
+	":stop_sign:":         "[STOP]",
+	":stopwatch:":         "[TIME]",
+	":tada:":              "[OK]",
+	":thumbs_down:":       "[FAIL]",
+}
+
+// NoColor returns true when the NO_COLOR environment variable asks for output without colors,
+// see https://no-color.org
+func NoColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// SetPlainOutput replaces the emoji printed by ftw with text markers, like `[PASS]`, for the
+// terminals and CI log viewers that can't show them. It changes the output of the emoji package
+// for the whole program, so call it before printing anything.
+func SetPlainOutput() {
+	codes := emoji.CodeMap()
+	for code, marker := range plainMarkers {
+		codes[code] = marker
+	}
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/kyokomi/emoji"
+)
+
+func TestNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	if NoColor() {
+		t.Error("an empty NO_COLOR must not disable the colors")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if !NoColor() {
+		t.Error("NO_COLOR must disable the colors")
+	}
+}
+
+func TestSetPlainOutput(t *testing.T) {
+	SetPlainOutput()
+	if line := emoji.Sprintf(":check_mark:passed, :collision:failed"); line != "[PASS] passed, [FAIL] failed" {
+		t.Errorf("unexpected plain output %q", line)
+	}
+}
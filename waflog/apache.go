@@ -0,0 +1,89 @@
+package waflog
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// apachePrefixRegex matches the fields Apache writes before the message of an error log line, e.g.
+// `[Tue Jan 05 02:21:09.637165 2021] [security2:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] `
+var apachePrefixRegex = regexp.MustCompile(`^\[([^\]]*)\] `)
+
+// apacheEntries joins the lines of multi-line entries of the Apache error log. Lines that don't start
+// with the `[date]` of an entry continue the previous one, e.g. when a module writes a message with
+// new lines. The lines are in reverse order, as returned by getMarkedLines.
+func apacheEntries(lines [][]byte) [][]byte {
+	var entries [][]byte
+	var continued [][]byte
+	for _, line := range lines {
+		if !bytes.HasPrefix(line, []byte("[")) {
+			continued = append(continued, line)
+			continue
+		}
+		for i := len(continued) - 1; i >= 0; i-- {
+			line = append(append(line, '\n'), continued[i]...)
+		}
+		continued = nil
+		entries = append(entries, line)
+	}
+	// lines before the first entry belong to an entry that started before the start marker
+	return entries
+}
+
+// apacheRuleMatch reads a rule match from an entry of the Apache error log, written by ModSecurity v2, like
+//
+//	[Tue Jan 05 02:21:09.637165 2021] [security2:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. ... [id "942100"] ... [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+//
+// The fields of the prefix are added to the context as `time`, `module`, `level`, `pid`, `tid` and
+// `client`. ModSecurity writes the unique ID last, so matches without it are marked as truncated.
+func apacheRuleMatch(line []byte) (RuleMatch, bool) {
+	match, ok := parseRuleMatch(line)
+	if !ok {
+		return match, false
+	}
+
+	match.Context = make(map[string]string)
+	rest := line
+	for i := 0; ; i++ {
+		field := apachePrefixRegex.FindSubmatch(rest)
+		if field == nil {
+			break
+		}
+		rest = rest[len(field[0]):]
+		value := string(field[1])
+		switch {
+		case i == 0:
+			match.Context["time"] = value
+		case i == 1:
+			// `[module:level]` in Apache 2.4, `[level]` before
+			if module, level, found := strings.Cut(value, ":"); found {
+				if module != "" {
+					match.Context["module"] = module
+				}
+				match.Context["level"] = level
+			} else {
+				match.Context["level"] = value
+			}
+		case strings.HasPrefix(value, "pid "):
+			pid, tid, _ := strings.Cut(strings.TrimPrefix(value, "pid "), ":tid ")
+			match.Context["pid"] = pid
+			if tid != "" {
+				match.Context["tid"] = tid
+			}
+		case strings.HasPrefix(value, "client "):
+			// ModSecurity adds its own client field, without the port, after the one of Apache
+			if _, found := match.Context["client"]; !found {
+				match.Context["client"] = strings.TrimPrefix(value, "client ")
+			}
+		}
+	}
+
+	if match.UniqueID == "" {
+		match.Truncated = true
+		log.Debug().Msgf("ftw/waflog: the Apache log entry of rule %d is truncated, fields at the end may be missing", match.ID)
+	}
+	return match, true
+}
@@ -0,0 +1,111 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var apacheLogLines = `[Tue Jan 05 02:21:09.637165 2021] [security2:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. detected SQLi using libinjection with fingerprint 's&1c' [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "45"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"] [data "Matched Data: s&1c found within ARGS:id: 1' or 1=1"] [severity "CRITICAL"] [ver "OWASP_CRS/3.3.2"] [tag "attack-sqli"] [tag "paranoia-level/1"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+[Tue Jan 05 02:21:09.637731 2021] [security2:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Pattern match "(?:<script)" at ARGS:text. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-941-APPLICATION-ATTACK-XSS.conf"] [line "80"] [id "941100"] [msg "XSS Attack Detected via libinjection"] [data "Matched Data: <script>
+alert(1)
+</script> found within ARGS:text"] [severity "CRITICAL"] [tag "attack-xss"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+[Tue Jan 05 02:21:09 2021] [error] [client 172.23.0.1] ModSecurity: Access denied with code 403 (phase 2). Operator GE matched 5 at TX:anomaly_score. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-949-BLOCKING-EVALUATION.conf"] [line "91"] [id "949110"] [msg "Inbound Anomaly Score Exceeded (Total Score: 10)"] [severity "CRITICAL"] [tag "anomaly-evaluation"] [hostname "local`
+
+func TestApacheEntries(t *testing.T) {
+	lines := [][]byte{
+		[]byte("[date] three"),
+		[]byte("two b"),
+		[]byte("two a"),
+		[]byte("[date] two"),
+		[]byte("[date] one"),
+		[]byte("before the start marker"),
+	}
+	expected := [][]byte{
+		[]byte("[date] three"),
+		[]byte("[date] two\ntwo a\ntwo b"),
+		[]byte("[date] one"),
+	}
+	if entries := apacheEntries(lines); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("unexpected entries %q", entries)
+	}
+}
+
+func TestApacheRuleMatch(t *testing.T) {
+	lines := strings.Split(apacheLogLines, "\n")
+
+	match, ok := apacheRuleMatch([]byte(lines[0]))
+	if !ok {
+		t.Fatal("rule match not found")
+	}
+	if match.ID != 942100 || match.Severity != "CRITICAL" || match.Truncated {
+		t.Errorf("unexpected match %+v", match)
+	}
+	expected := map[string]string{
+		"time":   "Tue Jan 05 02:21:09.637165 2021",
+		"module": "security2",
+		"level":  "error",
+		"pid":    "76",
+		"tid":    "139683434571520",
+		"client": "172.23.0.1:58998",
+	}
+	if !reflect.DeepEqual(match.Context, expected) {
+		t.Errorf("unexpected context %v", match.Context)
+	}
+
+	// Apache 2.2 prefix, cut before the end
+	match, ok = apacheRuleMatch([]byte(lines[4]))
+	if !ok {
+		t.Fatal("rule match not found in truncated line")
+	}
+	expected = map[string]string{
+		"time":   "Tue Jan 05 02:21:09 2021",
+		"level":  "error",
+		"client": "172.23.0.1",
+	}
+	if match.ID != 949110 || !match.Truncated || !reflect.DeepEqual(match.Context, expected) {
+		t.Errorf("unexpected match %+v", match)
+	}
+}
+
+func TestApacheLog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: apache")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	logLines := strings.Join([]string{startMarkerLine, apacheLogLines, endMarkerLine}, "\n")
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-apache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg,
+		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
+		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	matches := ll.RuleMatches()
+	if len(matches) != 3 || matches[0].ID != 942100 || matches[1].ID != 941100 || matches[2].ID != 949110 {
+		t.Fatalf("unexpected rule matches %+v", matches)
+	}
+	if matches[1].Data != "Matched Data: <script>\nalert(1)\n</script> found within ARGS:text" || matches[1].Truncated {
+		t.Errorf("multi-line entry was not joined: %+v", matches[1])
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{941100, 942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	if !ll.Contains(`alert\(1\)\n</script>`) {
+		t.Error("log_contains must match the whole entry")
+	}
+}
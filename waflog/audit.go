@@ -0,0 +1,219 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+// AuditEntry is a transaction of the audit log, with the content of its parts by letter, e.g. `H`
+// for the trailer with the actions and the rule matches, or `K` for the matched rules. Parts that
+// were not logged are missing.
+type AuditEntry map[string]string
+
+// auditBoundaryRegex matches the boundaries of the parts of the native audit log, e.g. `--c7036611-A--`
+var auditBoundaryRegex = regexp.MustCompile(`^--([0-9A-Za-z]+)-([A-Z])--$`)
+
+// auditEntryParsers read the parts of the transactions of the audit log formats, from the lines
+// between the markers in the order they were logged
+var auditEntryParsers = map[config.LogFormat]func([][]byte) []AuditEntry{
+	config.AuditLogFormat:      nativeAuditEntries,
+	config.JSONLogFormat:       jsonAuditEntries,
+	config.CorazaJSONLogFormat: jsonAuditEntries,
+}
+
+// AuditEntries returns the transactions of the audit log between the markers, in the order they
+// were logged. It's empty for the error log formats, or if the markers were not found.
+func (ll *FTWLogLines) AuditEntries() []AuditEntry {
+	parse, ok := auditEntryParsers[ll.Format]
+	if !ok || !ll.HasWindow() {
+		return nil
+	}
+	entries := ll.getEntries()
+	lines := make([][]byte, 0, len(entries))
+	// entries are read backwards
+	for i := len(entries) - 1; i >= 0; i-- {
+		lines = append(lines, entries[i])
+	}
+	return parse(lines)
+}
+
+// nativeAuditEntries reads the transactions of the native audit log, where every part starts with
+// a boundary line like `--c7036611-B--` and the transaction ends with part Z. Transactions that
+// are not complete, like the ones of the marker requests cut by the markers, are left out.
+func nativeAuditEntries(lines [][]byte) []AuditEntry {
+	var entries []AuditEntry
+	var entry AuditEntry
+	var id, part string
+	var content [][]byte
+	for _, line := range lines {
+		boundary := auditBoundaryRegex.FindSubmatch(bytes.TrimSpace(line))
+		if boundary == nil {
+			if entry != nil {
+				content = append(content, line)
+			}
+			continue
+		}
+		if entry != nil && part != "" {
+			entry[part] = string(bytes.TrimSpace(bytes.Join(content, []byte("\n"))))
+		}
+		content = nil
+		switch {
+		case string(boundary[2]) == "A":
+			entry = AuditEntry{}
+			id = string(boundary[1])
+			part = "A"
+		case entry == nil || string(boundary[1]) != id:
+			// a part of a transaction that started before the markers
+			entry = nil
+			part = ""
+		case string(boundary[2]) == "Z":
+			entries = append(entries, entry)
+			entry = nil
+			part = ""
+		default:
+			part = string(boundary[2])
+		}
+	}
+	return entries
+}
+
+// nativeAuditLines returns the lines of the complete transactions of the native audit log. The
+// lines are in reverse order, as returned by getMarkedLines.
+func nativeAuditLines(lines [][]byte) [][]byte {
+	var kept [][]byte
+	var transaction [][]byte
+	inTransaction := false
+	// lines are read backwards, so transactions start with part Z
+	for _, line := range lines {
+		boundary := auditBoundaryRegex.FindSubmatch(bytes.TrimSpace(line))
+		switch {
+		case boundary != nil && string(boundary[2]) == "Z":
+			transaction = [][]byte{line}
+			inTransaction = true
+		case inTransaction:
+			transaction = append(transaction, line)
+			if boundary != nil && string(boundary[2]) == "A" {
+				kept = append(kept, transaction...)
+				transaction = nil
+				inTransaction = false
+			}
+		}
+	}
+	return kept
+}
+
+// isAuditBoundary returns true if the line starts a part of the native audit log
+func isAuditBoundary(line []byte, part string) bool {
+	boundary := auditBoundaryRegex.FindSubmatch(bytes.TrimSpace(line))
+	return boundary != nil && string(boundary[2]) == part
+}
+
+// jsonAuditEntries reads the parts of the transactions of the JSON audit logs, one per line. The
+// parts are mapped to the JSON fields written for them:
+//
+//   - A: the fields of `transaction`, without the ones of the other parts
+//   - B: `request`, without the body, and C: the request body
+//   - F: `response`, without the body, and E: the response body
+//   - H: `audit_data` for ModSecurity v2, `messages` and `producer` for ModSecurity v3 and Coraza
+//   - K: `matched_rules`, only written by ModSecurity v2
+//
+// The content of a part is its JSON, with the keys sorted.
+func jsonAuditEntries(lines [][]byte) []AuditEntry {
+	var entries []AuditEntry
+	for _, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] != '{' {
+			continue
+		}
+		var root map[string]interface{}
+		if err := json.Unmarshal(trimmed, &root); err != nil {
+			continue
+		}
+		transaction, ok := root["transaction"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := AuditEntry{}
+
+		request := jsonObject(root, transaction, "request")
+		response := jsonObject(root, transaction, "response")
+		setJSONPart(entry, "C", request["body"])
+		setJSONPart(entry, "E", response["body"])
+		setJSONPart(entry, "B", without(request, "body"))
+		setJSONPart(entry, "F", without(response, "body"))
+
+		if auditData, ok := root["audit_data"]; ok {
+			setJSONPart(entry, "H", auditData)
+		} else {
+			trailer := map[string]interface{}{}
+			for _, name := range []string{"messages", "producer"} {
+				if value, ok := transaction[name]; ok {
+					trailer[name] = value
+				} else if value, ok := root[name]; ok {
+					trailer[name] = value
+				}
+			}
+			setJSONPart(entry, "H", trailer)
+		}
+		setJSONPart(entry, "K", root["matched_rules"])
+		setJSONPart(entry, "A", without(transaction, "request", "response", "messages", "producer"))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// jsonObject returns the object with the name at the top of the entry, like ModSecurity v2 writes
+// it, or in the transaction, like ModSecurity v3 and Coraza write it
+func jsonObject(root map[string]interface{}, transaction map[string]interface{}, name string) map[string]interface{} {
+	if object, ok := root[name].(map[string]interface{}); ok {
+		return object
+	}
+	if object, ok := transaction[name].(map[string]interface{}); ok {
+		return object
+	}
+	return nil
+}
+
+// without returns a copy of the object without the fields
+func without(object map[string]interface{}, names ...string) map[string]interface{} {
+	if object == nil {
+		return nil
+	}
+	kept := make(map[string]interface{}, len(object))
+	for name, value := range object {
+		kept[name] = value
+	}
+	for _, name := range names {
+		delete(kept, name)
+	}
+	return kept
+}
+
+// setJSONPart sets the part to the JSON of the value, unless it's empty
+func setJSONPart(entry AuditEntry, part string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		return
+	case string:
+		if v != "" {
+			entry[part] = v
+		}
+		return
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return
+		}
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	entry[part] = string(content)
+}
@@ -0,0 +1,163 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+// nativeAuditMarker is a transaction of a marker request in the native audit log
+func nativeAuditMarker(id string, stageID string) string {
+	return fmt.Sprintf(`--%[1]s-A--
+[05/Jan/2021:02:21:09.637165 +0000] X-PNFSe1VwjCgYRI9FsbHgAA%[1]s 172.23.0.1 58998 172.23.0.2 80
+--%[1]s-B--
+GET / HTTP/1.1
+Host: localhost
+X-CRS-Test: %[2]s
+
+--%[1]s-H--
+Message: Warning. Pattern match "^.*$" at REQUEST_HEADERS:X-CRS-Test. [file "/etc/modsecurity.d/crs-test.conf"] [line "1"] [id "999999"] [msg "X-CRS-Test %[2]s"]
+Stopwatch: 1609813269637165 1234; combined=500, p1=200, p2=200, p3=0, p4=0, p5=100, sr=0, sw=0, l=0, gc=0
+
+--%[1]s-Z--
+`, id, stageID)
+}
+
+var nativeAuditTransaction = `--c7036611-A--
+[05/Jan/2021:02:21:09.637165 +0000] X-PNFSe1VwjCgYRI9FsbHgAAAIY 172.23.0.1 58998 172.23.0.2 80
+--c7036611-B--
+GET /?id=1%27%20or%201=1 HTTP/1.1
+Host: localhost
+
+--c7036611-F--
+HTTP/1.1 403 Forbidden
+Content-Type: text/html
+
+--c7036611-H--
+Message: Warning. detected SQLi using libinjection with fingerprint 's&1c' [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "45"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"]
+Message: Access denied with code 403 (phase 2). Operator GE matched 5 at TX:anomaly_score. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-949-BLOCKING-EVALUATION.conf"] [line "80"] [id "949110"] [msg "Inbound Anomaly Score Exceeded (Total Score: 5)"]
+Action: Intercepted (phase 2)
+Stopwatch: 1609813269637165 1234; combined=500, p1=200, p2=200, p3=0, p4=0, p5=100, sr=0, sw=0, l=0, gc=0
+
+--c7036611-K--
+SecRule "ARGS" "@detectSQLi" "id:942100,phase:2,block,msg:'SQL Injection Attack Detected via libinjection'"
+
+--c7036611-Z--
+`
+
+func TestNativeAuditLog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: audit")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	logLines := nativeAuditMarker("a1b2c3d4", stageID) + nativeAuditTransaction + nativeAuditMarker("e5f6a7b8", stageID)
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-auditlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	// the marker is not the last line, but in the last transaction
+	marker := ll.CheckLogForMarker(stageID)
+	if !bytes.Contains(marker, []byte(`[id "999999"]`)) {
+		t.Fatalf("marker not found in the native audit log, got %q", marker)
+	}
+	if ll.CheckLogForMarker("another-stage") != nil {
+		t.Error("the marker of another stage must not be found")
+	}
+	ll.StartMarker = marker
+	ll.EndMarker = marker
+
+	// the parts of the marker transactions after the markers are not read
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	if ll.Contains(`X-CRS-Test`) {
+		t.Error("the marker transactions must not be matched")
+	}
+
+	entries := ll.AuditEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 transaction, got %d: %v", len(entries), entries)
+	}
+	entry := entries[0]
+	for _, part := range []string{"A", "B", "F", "H", "K"} {
+		if entry[part] == "" {
+			t.Errorf("part %s not found in %v", part, entry)
+		}
+	}
+	if _, ok := entry["C"]; ok {
+		t.Errorf("part C was not logged, got %q", entry["C"])
+	}
+	if !strings.HasSuffix(entry["H"], "sr=0, sw=0, l=0, gc=0") || !strings.Contains(entry["H"], "\nAction: Intercepted (phase 2)\n") {
+		t.Errorf("unexpected part H %q", entry["H"])
+	}
+	if entry["F"] != "HTTP/1.1 403 Forbidden\nContent-Type: text/html" {
+		t.Errorf("unexpected part F %q", entry["F"])
+	}
+}
+
+func TestNativeAuditLines(t *testing.T) {
+	// a transaction cut by the start marker, a complete one, and one cut by the end marker
+	lines := bytes.Split([]byte("--1-H--\nAction: Intercepted\n--1-Z--\n--2-A--\n--2-H--\nMessage: Warning.\n--2-Z--\n--3-A--\n--3-B--"), []byte("\n"))
+	// lines are read backwards
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	kept := nativeAuditLines(lines)
+	expected := []string{"--2-Z--", "Message: Warning.", "--2-H--", "--2-A--"}
+	if len(kept) != len(expected) {
+		t.Fatalf("unexpected lines %q", kept)
+	}
+	for i := range expected {
+		if string(kept[i]) != expected[i] {
+			t.Errorf("unexpected lines %q", kept)
+		}
+	}
+}
+
+func TestJSONAuditEntries(t *testing.T) {
+	lines := [][]byte{[]byte(jsonV3LogLine), []byte(jsonV2LogLine), []byte("X-CRS-Test: 1234"), []byte(corazaAuditLogLine)}
+	entries := jsonAuditEntries(lines)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(entries))
+	}
+
+	v3 := entries[0]
+	if v3["B"] != `{"headers":{"Host":"localhost"},"http_version":1.1,"method":"GET","uri":"/?id=1%27%20or%201=1"}` {
+		t.Errorf("unexpected part B %q", v3["B"])
+	}
+	if v3["F"] != `{"http_code":403}` {
+		t.Errorf("unexpected part F %q", v3["F"])
+	}
+	if !strings.Contains(v3["H"], `"ruleId":"942100"`) || !strings.HasPrefix(v3["H"], `{"messages":[`) {
+		t.Errorf("unexpected part H %q", v3["H"])
+	}
+	if strings.Contains(v3["A"], "messages") || !strings.Contains(v3["A"], `"unique_id":"161181246962.002"`) {
+		t.Errorf("unexpected part A %q", v3["A"])
+	}
+	if _, ok := v3["K"]; ok {
+		t.Error("ModSecurity v3 doesn't write part K")
+	}
+
+	v2 := entries[1]
+	if !strings.Contains(v2["H"], `[id \"920300\"]`) || v2["F"] != `{"protocol":"HTTP/1.1","status":403}` {
+		t.Errorf("unexpected parts %v", v2)
+	}
+
+	coraza := entries[2]
+	if !strings.Contains(coraza["H"], `"id":942100`) || coraza["B"] == "" {
+		t.Errorf("unexpected parts %v", coraza)
+	}
+}
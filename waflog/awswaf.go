@@ -0,0 +1,85 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// awsWAFDefaultAction is the terminating rule of the requests that didn't match any rule
+const awsWAFDefaultAction = "Default_Action"
+
+// awsWAFRule is a rule matching a request in the AWS WAF log
+type awsWAFRule struct {
+	RuleID string `json:"ruleId"`
+	Action string `json:"action"`
+}
+
+// awsWAFEntry is a request in the AWS WAF log
+type awsWAFEntry struct {
+	TerminatingRuleID string `json:"terminatingRuleId"`
+	Action            string `json:"action"`
+	RuleGroupList     []struct {
+		RuleGroupID                 string       `json:"ruleGroupId"`
+		TerminatingRule             *awsWAFRule  `json:"terminatingRule"`
+		NonTerminatingMatchingRules []awsWAFRule `json:"nonTerminatingMatchingRules"`
+	} `json:"ruleGroupList"`
+	NonTerminatingMatchingRules []awsWAFRule `json:"nonTerminatingMatchingRules"`
+	Labels                      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	HTTPRequest struct {
+		URI       string `json:"uri"`
+		RequestID string `json:"requestId"`
+	} `json:"httpRequest"`
+}
+
+// awsWAFLines returns the lines matched against the expected output for a line of the AWS WAF
+// log: the line itself, followed by every rule matching the request like in the error log, e.g.
+// `AWS WAF: BLOCK. [rule "SQLi_BODY"] [rule_group "AWS#AWSManagedRulesSQLiRuleSet"]`. The rules
+// of AWS WAF have names instead of numeric IDs, so they are found with log_contains.
+func awsWAFLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var entry awsWAFEntry
+	if err := json.Unmarshal(trimmed, &entry); err != nil {
+		return lines
+	}
+
+	terminatingInGroup := false
+	for _, group := range entry.RuleGroupList {
+		if group.TerminatingRule != nil {
+			terminatingInGroup = true
+			lines = append(lines, awsWAFRuleLine(&entry, *group.TerminatingRule, group.RuleGroupID))
+		}
+		for _, r := range group.NonTerminatingMatchingRules {
+			lines = append(lines, awsWAFRuleLine(&entry, r, group.RuleGroupID))
+		}
+	}
+	if !terminatingInGroup && entry.TerminatingRuleID != "" && entry.TerminatingRuleID != awsWAFDefaultAction {
+		lines = append(lines, awsWAFRuleLine(&entry, awsWAFRule{RuleID: entry.TerminatingRuleID, Action: entry.Action}, ""))
+	}
+	for _, r := range entry.NonTerminatingMatchingRules {
+		lines = append(lines, awsWAFRuleLine(&entry, r, ""))
+	}
+	return lines
+}
+
+// awsWAFRuleLine writes the rule matching the request like in the error log
+func awsWAFRuleLine(entry *awsWAFEntry, rule awsWAFRule, group string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "AWS WAF: %s.", strings.ToUpper(rule.Action))
+	writeField(&b, "rule", rule.RuleID)
+	writeField(&b, "rule_group", group)
+	for _, label := range entry.Labels {
+		writeField(&b, "label", label.Name)
+	}
+	writeField(&b, "uri", entry.HTTPRequest.URI)
+	writeField(&b, "unique_id", entry.HTTPRequest.RequestID)
+	return []byte(b.String())
+}
@@ -0,0 +1,35 @@
+package waflog
+
+import (
+	"testing"
+)
+
+var awsWAFLogLine = `{"timestamp":1672531200200,"formatVersion":1,"webaclId":"arn:aws:wafv2:us-east-1:123456789012:regional/webacl/ftw/a1","terminatingRuleId":"AWS-AWSManagedRulesSQLiRuleSet","terminatingRuleType":"MANAGED_RULE_GROUP","action":"BLOCK","ruleGroupList":[{"ruleGroupId":"AWS#AWSManagedRulesSQLiRuleSet","terminatingRule":{"ruleId":"SQLi_QUERYARGUMENTS","action":"BLOCK"},"nonTerminatingMatchingRules":[]},{"ruleGroupId":"AWS#AWSManagedRulesCommonRuleSet","terminatingRule":null,"nonTerminatingMatchingRules":[{"ruleId":"NoUserAgent_HEADER","action":"COUNT"}]}],"nonTerminatingMatchingRules":[],"labels":[{"name":"awswaf:managed:aws:sql-database:SQLi_QueryArguments"}],"httpRequest":{"clientIp":"172.23.0.1","uri":"/","args":"id=1%27%20or%201=1","httpMethod":"GET","requestId":"1-63b0ce00-a2"}}`
+
+func TestAWSWAFLines(t *testing.T) {
+	lines := awsWAFLines([]byte(awsWAFLogLine))
+	if len(lines) != 3 {
+		t.Fatalf("expected the line and 2 rule matches, got %q", lines)
+	}
+	expected := []string{
+		`AWS WAF: BLOCK. [rule "SQLi_QUERYARGUMENTS"] [rule_group "AWS#AWSManagedRulesSQLiRuleSet"] [label "awswaf:managed:aws:sql-database:SQLi_QueryArguments"] [uri "/"] [unique_id "1-63b0ce00-a2"]`,
+		`AWS WAF: COUNT. [rule "NoUserAgent_HEADER"] [rule_group "AWS#AWSManagedRulesCommonRuleSet"] [label "awswaf:managed:aws:sql-database:SQLi_QueryArguments"] [uri "/"] [unique_id "1-63b0ce00-a2"]`,
+	}
+	for i, line := range expected {
+		if string(lines[i+1]) != line {
+			t.Errorf("unexpected rule line:\n%s\n%s", lines[i+1], line)
+		}
+	}
+
+	custom := `{"timestamp":1672531200300,"terminatingRuleId":"block-admin","action":"BLOCK","ruleGroupList":[],"httpRequest":{"uri":"/admin","requestId":"a3"}}`
+	if lines := awsWAFLines([]byte(custom)); len(lines) != 2 || string(lines[1]) != `AWS WAF: BLOCK. [rule "block-admin"] [uri "/admin"] [unique_id "a3"]` {
+		t.Errorf("unexpected lines for a rule of the web ACL: %q", lines)
+	}
+
+	allowed := `{"timestamp":1672531200400,"terminatingRuleId":"Default_Action","action":"ALLOW","ruleGroupList":[],"httpRequest":{"uri":"/","requestId":"a4"}}`
+	for _, line := range []string{"", allowed, "START RequestId: a5", `{"timestamp":`} {
+		if lines := awsWAFLines([]byte(line)); len(lines) != 1 {
+			t.Errorf("%q: line must be kept as it is, got %q", line, lines)
+		}
+	}
+}
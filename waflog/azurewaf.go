@@ -0,0 +1,72 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// azureWAFRuleIDRegex finds the ID of the managed rules in their name, like
+// `Microsoft_DefaultRuleSet-2.1-SQLI-942100` in the Front Door logs
+var azureWAFRuleIDRegex = regexp.MustCompile(`(?:^|-)(\d+)$`)
+
+// azureWAFColumns are the columns of each field of the rule matches, in the AzureDiagnostics
+// table first, then in the resource-specific tables
+var azureWAFColumns = map[string][]string{
+	"action":    {"action_s", "Action"},
+	"rule":      {"ruleId_s", "ruleName_s", "RuleId", "RuleName"},
+	"msg":       {"Message", "details_message_s", "DetailedMessage"},
+	"data":      {"details_data_s", "DetailedData"},
+	"group":     {"ruleGroup_s", "RuleGroup"},
+	"uri":       {"requestUri_s", "RequestUri"},
+	"unique_id": {"transactionId_g", "trackingReference_s", "TransactionId", "TrackingReference"},
+}
+
+// azureWAFLines returns the lines matched against the expected output for a row of the WAF log
+// of Application Gateway or Front Door: the row itself, followed by the rule matching the request
+// like in the error log, e.g. `Azure WAF: Blocked. [rule "942100"] [id "942100"] [msg "..."]`.
+func azureWAFLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal(trimmed, &row); err != nil {
+		return lines
+	}
+	field := func(name string) string {
+		for _, column := range azureWAFColumns[name] {
+			switch value := row[column].(type) {
+			case string:
+				if value != "" {
+					return value
+				}
+			case float64:
+				return strconv.FormatFloat(value, 'f', -1, 64)
+			}
+		}
+		return ""
+	}
+	rule := field("rule")
+	if rule == "" {
+		return lines
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Azure WAF: %s.", field("action"))
+	writeField(&b, "rule", rule)
+	if found := azureWAFRuleIDRegex.FindStringSubmatch(rule); found != nil {
+		writeField(&b, "id", found[1])
+	}
+	writeField(&b, "msg", field("msg"))
+	writeField(&b, "data", field("data"))
+	writeField(&b, "rule_group", field("group"))
+	writeField(&b, "uri", field("uri"))
+	writeField(&b, "unique_id", field("unique_id"))
+	return append(lines, []byte(b.String()))
+}
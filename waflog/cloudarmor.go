@@ -0,0 +1,88 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cloudArmorRuleIDRegex finds the ID of the CRS rule in the preconfigured WAF rules, like
+// `owasp-crs-v030301-id942100-sqli`
+var cloudArmorRuleIDRegex = regexp.MustCompile(`-id(\d+)-`)
+
+// cloudArmorPolicy is the decision of a security policy in the load balancer log
+type cloudArmorPolicy struct {
+	Name                 string   `json:"name"`
+	Priority             int      `json:"priority"`
+	Outcome              string   `json:"outcome"`
+	ConfiguredAction     string   `json:"configuredAction"`
+	PreconfiguredExprIDs []string `json:"preconfiguredExprIds"`
+}
+
+// cloudArmorEntry is an entry of the load balancer log in Cloud Logging
+type cloudArmorEntry struct {
+	InsertID    string `json:"insertId"`
+	HTTPRequest struct {
+		RequestURL string `json:"requestUrl"`
+	} `json:"httpRequest"`
+	JSONPayload struct {
+		EnforcedSecurityPolicy *cloudArmorPolicy `json:"enforcedSecurityPolicy"`
+		PreviewSecurityPolicy  *cloudArmorPolicy `json:"previewSecurityPolicy"`
+	} `json:"jsonPayload"`
+}
+
+// cloudArmorLines returns the lines matched against the expected output for an entry of the load
+// balancer log: the entry itself, followed by the rules of the security policies that matched the
+// request like in the error log, e.g.
+// `Cloud Armor: DENY. [policy "ftw"] [priority "1000"] [rule "owasp-crs-v030301-id942100-sqli"] [id "942100"]`.
+// Rules in preview are written with a PREVIEW action.
+func cloudArmorLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var entry cloudArmorEntry
+	if err := json.Unmarshal(trimmed, &entry); err != nil {
+		return lines
+	}
+	if policy := entry.JSONPayload.EnforcedSecurityPolicy; policy != nil {
+		lines = append(lines, cloudArmorPolicyLines(&entry, policy, "")...)
+	}
+	if policy := entry.JSONPayload.PreviewSecurityPolicy; policy != nil {
+		lines = append(lines, cloudArmorPolicyLines(&entry, policy, "PREVIEW ")...)
+	}
+	return lines
+}
+
+// cloudArmorPolicyLines writes the rules of the policy that matched the request like in the error
+// log, one line per preconfigured WAF rule
+func cloudArmorPolicyLines(entry *cloudArmorEntry, policy *cloudArmorPolicy, prefix string) [][]byte {
+	line := func(rule string) []byte {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Cloud Armor: %s%s.", prefix, strings.ToUpper(policy.ConfiguredAction))
+		writeField(&b, "policy", policy.Name)
+		writeField(&b, "priority", strconv.Itoa(policy.Priority))
+		writeField(&b, "outcome", policy.Outcome)
+		writeField(&b, "rule", rule)
+		if found := cloudArmorRuleIDRegex.FindStringSubmatch(rule); found != nil {
+			writeField(&b, "id", found[1])
+		}
+		writeField(&b, "uri", entry.HTTPRequest.RequestURL)
+		writeField(&b, "unique_id", entry.InsertID)
+		return []byte(b.String())
+	}
+
+	if len(policy.PreconfiguredExprIDs) == 0 {
+		return [][]byte{line("")}
+	}
+	lines := make([][]byte, 0, len(policy.PreconfiguredExprIDs))
+	for _, rule := range policy.PreconfiguredExprIDs {
+		lines = append(lines, line(rule))
+	}
+	return lines
+}
@@ -0,0 +1,201 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cloudflareRayHeader is the header with the ray ID of the responses going through Cloudflare,
+// like `8a1b2c3d4e5f6a7b-LHR`
+const cloudflareRayHeader = "Cf-Ray"
+
+// cloudflareEventsQuery selects the firewall events of a request in the zone
+const cloudflareEventsQuery = `query ($zoneTag: string, $filter: FirewallEventsAdaptiveFilter_InputObject) {
+  viewer {
+    zones(filter: {zoneTag: $zoneTag}) {
+      firewallEventsAdaptive(filter: $filter, limit: 1000, orderBy: [datetime_ASC]) {
+        action
+        datetime
+        description
+        rayName
+        ruleId
+        rulesetId
+        source
+        clientRequestHTTPMethodName
+        clientRequestPath
+        clientRequestQuery
+      }
+    }
+  }
+}`
+
+// cloudflareRuleIDRegex finds the ID of the rule at the start of the description of the events,
+// like `942100: SQL Injection Attack Detected via libinjection` for the OWASP Core Ruleset
+var cloudflareRuleIDRegex = regexp.MustCompile(`^(\d+):\s`)
+
+// cloudflareEvent is a firewall event of the Cloudflare GraphQL API
+type cloudflareEvent struct {
+	Action      string `json:"action"`
+	Datetime    string `json:"datetime"`
+	Description string `json:"description"`
+	RayName     string `json:"rayName"`
+	RuleID      string `json:"ruleId"`
+	RulesetID   string `json:"rulesetId"`
+	Source      string `json:"source"`
+	Method      string `json:"clientRequestHTTPMethodName"`
+	Path        string `json:"clientRequestPath"`
+	Query       string `json:"clientRequestQuery"`
+}
+
+// cloudflare queries the firewall events of the requests of a zone, by their ray ID
+type cloudflare struct {
+	endpoint string
+	zoneID   string
+	token    string
+	interval time.Duration
+	timeout  time.Duration
+	client   *http.Client
+}
+
+func (c *cloudflare) requestID(header http.Header) string {
+	// the ray name of the events doesn't have the data center
+	ray, _, _ := strings.Cut(header.Get(cloudflareRayHeader), "-")
+	return ray
+}
+
+// query waits for the firewall events of the request, until they show up or until the timeout.
+// Requests that didn't match any rule have no events.
+func (c *cloudflare) query(rayID string, since time.Time, until time.Time) ([][]byte, error) {
+	if c.zoneID == "" {
+		return nil, fmt.Errorf("ftw/waflog: the cloudflare zone is not set")
+	}
+	deadline := time.Now().Add(c.timeout)
+	for {
+		events, err := c.events(rayID, since, until)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 || !time.Now().Add(c.interval).Before(deadline) {
+			lines := make([][]byte, 0, len(events))
+			for _, event := range events {
+				line, err := json.Marshal(event)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, line)
+			}
+			return lines, nil
+		}
+		log.Trace().Msgf("ftw/waflog: no cloudflare firewall events for ray %s yet", rayID)
+		time.Sleep(c.interval)
+	}
+}
+
+// events returns the firewall events of the request logged between since and until
+func (c *cloudflare) events(rayID string, since time.Time, until time.Time) ([]cloudflareEvent, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": cloudflareEventsQuery,
+		"variables": map[string]interface{}{
+			"zoneTag": c.zoneID,
+			"filter": map[string]interface{}{
+				"rayName":      rayID,
+				"datetime_geq": since.UTC().Truncate(time.Second).Format(time.RFC3339),
+				"datetime_leq": until.UTC().Add(time.Second).Truncate(time.Second).Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't query the cloudflare firewall events: %w", err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't read the cloudflare firewall events: %w", err)
+	}
+
+	var result struct {
+		Data struct {
+			Viewer struct {
+				Zones []struct {
+					FirewallEventsAdaptive []cloudflareEvent `json:"firewallEventsAdaptive"`
+				} `json:"zones"`
+			} `json:"viewer"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("ftw/waflog: bad response of the cloudflare API (%s): %w", resp.Status, err)
+	}
+	if len(result.Errors) > 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return nil, fmt.Errorf("ftw/waflog: can't query the cloudflare firewall events: %s", strings.Join(messages, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ftw/waflog: can't query the cloudflare firewall events: %s", resp.Status)
+	}
+
+	var events []cloudflareEvent
+	for _, zone := range result.Data.Viewer.Zones {
+		events = append(events, zone.FirewallEventsAdaptive...)
+	}
+	return events, nil
+}
+
+// cloudflareLines returns the lines matched against the expected output for a firewall event:
+// the event itself, followed by the rule like in the error log, e.g.
+// `Cloudflare: BLOCK. [rule "6179ae15870a4bb7b2d480d4843b323c"] [source "firewallManaged"]`.
+// When the description starts with the ID of the rule, like in the OWASP Core Ruleset of
+// Cloudflare, it's written as the id, so rule_ids can be used.
+func cloudflareLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var event cloudflareEvent
+	if err := json.Unmarshal(trimmed, &event); err != nil || event.RayName == "" {
+		return lines
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cloudflare: %s.", strings.ToUpper(event.Action))
+	writeField(&b, "rule", event.RuleID)
+	writeField(&b, "ruleset", event.RulesetID)
+	writeField(&b, "source", event.Source)
+	if found := cloudflareRuleIDRegex.FindStringSubmatch(event.Description); found != nil {
+		writeField(&b, "id", found[1])
+	}
+	writeField(&b, "msg", event.Description)
+	writeField(&b, "uri", event.Path+event.Query)
+	writeField(&b, "unique_id", event.RayName)
+	return append(lines, []byte(b.String()))
+}
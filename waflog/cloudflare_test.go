@@ -0,0 +1,102 @@
+package waflog
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var cloudflareEventLine = `{"action":"block","datetime":"2023-01-01T00:00:00Z","description":"942100: SQL Injection Attack Detected via libinjection","rayName":"7d1a2b3c4d5e6f70","ruleId":"6179ae15870a4bb7b2d480d4843b323c","rulesetId":"4814384a9e5d4991b9815dcfc25d2f1f","source":"firewallManaged","clientRequestHTTPMethodName":"GET","clientRequestPath":"/","clientRequestQuery":"?id=1%27%20or%201=1"}`
+
+func TestCloudflareLines(t *testing.T) {
+	lines := cloudflareLines([]byte(cloudflareEventLine))
+	if len(lines) != 2 {
+		t.Fatalf("expected the line and the rule match, got %q", lines)
+	}
+	expected := `Cloudflare: BLOCK. [rule "6179ae15870a4bb7b2d480d4843b323c"] [ruleset "4814384a9e5d4991b9815dcfc25d2f1f"] [source "firewallManaged"] [id "942100"] [msg "942100: SQL Injection Attack Detected via libinjection"] [uri "/?id=1%27%20or%201=1"] [unique_id "7d1a2b3c4d5e6f70"]`
+	if string(lines[1]) != expected {
+		t.Errorf("unexpected rule line:\n%s\n%s", lines[1], expected)
+	}
+
+	for _, line := range []string{"", "not json", `{"action":"block"}`} {
+		if lines := cloudflareLines([]byte(line)); len(lines) != 1 {
+			t.Errorf("%q: line must be kept as it is, got %q", line, lines)
+		}
+	}
+}
+
+func TestCloudflareQuery(t *testing.T) {
+	var queries int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		body, _ := io.ReadAll(r.Body)
+		var query struct {
+			Variables struct {
+				ZoneTag string            `json:"zoneTag"`
+				Filter  map[string]string `json:"filter"`
+			} `json:"variables"`
+		}
+		if err := json.Unmarshal(body, &query); err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			_, _ = w.Write([]byte(`{"data":null,"errors":[{"message":"not authorized"}]}`))
+			return
+		}
+		filter := query.Variables.Filter
+		if query.Variables.ZoneTag != "zone" || filter["rayName"] != "7d1a2b3c4d5e6f70" ||
+			filter["datetime_geq"] != "2023-01-01T00:00:00Z" || filter["datetime_leq"] != "2023-01-01T00:00:02Z" {
+			t.Errorf("unexpected variables %+v", query.Variables)
+		}
+		// the events show up with the second query
+		events := "[]"
+		if queries > 1 {
+			events = "[" + cloudflareEventLine + "]"
+		}
+		_, _ = w.Write([]byte(`{"data":{"viewer":{"zones":[{"firewallEventsAdaptive":` + events + `}]}},"errors":null}`))
+	}))
+	t.Cleanup(api.Close)
+
+	c := &cloudflare{endpoint: api.URL, zoneID: "zone", token: "token", interval: 10 * time.Millisecond, timeout: time.Second}
+	header := http.Header{}
+	header.Set("CF-RAY", "7d1a2b3c4d5e6f70-LHR")
+	ray := c.requestID(header)
+	if ray != "7d1a2b3c4d5e6f70" {
+		t.Errorf("unexpected ray ID %q", ray)
+	}
+
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 500000000, time.UTC)
+	lines, err := c.query(ray, since, since.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || len(cloudflareLines(lines[0])) != 2 {
+		t.Errorf("unexpected lines %q", lines)
+	}
+	if queries != 2 {
+		t.Errorf("expected 2 queries, got %d", queries)
+	}
+
+	c.token = "bad"
+	if _, err := c.query(ray, since, since.Add(time.Second)); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("expected the error of the API, got %v", err)
+	}
+}
+
+func TestCloudflareQueryTimeout(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"viewer":{"zones":[{"firewallEventsAdaptive":[]}]}},"errors":null}`))
+	}))
+	t.Cleanup(api.Close)
+
+	// requests that didn't match any rule have no events
+	c := &cloudflare{endpoint: api.URL, zoneID: "zone", token: "token", interval: 10 * time.Millisecond, timeout: 50 * time.Millisecond}
+	lines, err := c.query("7d1a2b3c4d5e6f70", time.Now(), time.Now())
+	if err != nil || len(lines) != 0 {
+		t.Errorf("expected no lines, got %q, %v", lines, err)
+	}
+}
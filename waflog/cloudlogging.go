@@ -0,0 +1,112 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// gcloudCommand is the Google Cloud CLI, used to query Cloud Logging
+var gcloudCommand = "gcloud"
+
+// cloudLoggingIngestionDelay is how long entries can take to be ingested by Cloud Logging.
+// Entries with a timestamp this old are queried again, so late entries are not missed.
+var cloudLoggingIngestionDelay = time.Minute
+
+// cloudLoggingEntry is an entry in the output of `gcloud logging read`
+type cloudLoggingEntry struct {
+	InsertID  string    `json:"insertId"`
+	Timestamp time.Time `json:"timestamp"`
+	// line is the whole entry, on a single line
+	line bytes.Buffer
+}
+
+// cloudLogging queries the entries of Cloud Logging with the WAF logs
+type cloudLogging struct {
+	project  string
+	filter   string
+	interval time.Duration
+
+	since    time.Time
+	latest   time.Time
+	lastRead time.Time
+	seen     map[string]bool
+}
+
+func (c *cloudLogging) start() error {
+	c.since = time.Now()
+	c.latest = c.since
+	c.seen = make(map[string]bool)
+	return nil
+}
+
+// gcloudArgs returns the arguments to query the entries logged since the time
+func (c *cloudLogging) gcloudArgs(since time.Time) []string {
+	filter := fmt.Sprintf(`(%s) AND timestamp>="%s"`, c.filter, since.UTC().Format(time.RFC3339Nano))
+	args := []string{"logging", "read", filter, "--format=json", "--order=asc"}
+	if c.project != "" {
+		args = append(args, "--project="+c.project)
+	}
+	return args
+}
+
+func (c *cloudLogging) read() ([]byte, error) {
+	// Cloud Logging has quotas for the queries, and new entries take a while to show up
+	if wait := c.interval - time.Since(c.lastRead); wait > 0 {
+		time.Sleep(wait)
+	}
+	c.lastRead = time.Now()
+
+	since := c.latest.Add(-cloudLoggingIngestionDelay)
+	if since.Before(c.since) {
+		since = c.since
+	}
+	args := c.gcloudArgs(since)
+	log.Trace().Msgf("ftw/waflog: running %s %v", gcloudCommand, args)
+	out, err := exec.Command(gcloudCommand, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("ftw/waflog: can't query cloud logging: %w", err)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("ftw/waflog: bad output of the gcloud command: %w", err)
+	}
+	entries := make([]cloudLoggingEntry, len(raw))
+	for i, entry := range raw {
+		if err := json.Unmarshal(entry, &entries[i]); err != nil {
+			return nil, fmt.Errorf("ftw/waflog: bad entry in the output of the gcloud command: %w", err)
+		}
+		// entries are written on a single line
+		if err := json.Compact(&entries[i].line, entry); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	var logs []byte
+	for _, entry := range entries {
+		// entries are queried again until they are older than the ingestion delay
+		if c.seen[entry.InsertID] {
+			continue
+		}
+		c.seen[entry.InsertID] = true
+		if entry.Timestamp.After(c.latest) {
+			c.latest = entry.Timestamp
+		}
+		logs = append(logs, entry.line.Bytes()...)
+		logs = append(logs, '\n')
+	}
+	return logs, nil
+}
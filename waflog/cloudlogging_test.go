@@ -0,0 +1,133 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestGcloudArgs(t *testing.T) {
+	c := &cloudLogging{project: "ftw", filter: `resource.type="http_load_balancer"`}
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 500000000, time.UTC)
+	expected := []string{"logging", "read", `(resource.type="http_load_balancer") AND timestamp>="2023-01-01T00:00:00.5Z"`,
+		"--format=json", "--order=asc", "--project=ftw"}
+	if args := c.gcloudArgs(since); !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments %v", args)
+	}
+}
+
+// fakeGcloud replaces the Google Cloud CLI with a script that prints the entries given to the
+// returned function, one call of the function per query, and records its arguments
+func fakeGcloud(t *testing.T) (func(entries string), string) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "gcloud")
+	argsFile := filepath.Join(dir, "args")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" >> `+argsFile+`
+n=$(wc -l < `+argsFile+`)
+if [ -f `+dir+`/entries-$n ]; then cat `+dir+`/entries-$n; else echo '[]'; fi
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := gcloudCommand
+	gcloudCommand = script
+	t.Cleanup(func() { gcloudCommand = previous })
+
+	calls := 0
+	return func(entries string) {
+		calls++
+		if err := os.WriteFile(filepath.Join(dir, "entries-"+strconv.Itoa(calls)), []byte(entries), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}, argsFile
+}
+
+func TestCloudLogging(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
+	}
+	cfg, err := config.NewConfigFromString("logsource: cloudlogging\ncloudlogging:\n  project: ftw\n  pollinterval: 1ms\n")
+	if err != nil {
+		t.Error(err)
+	}
+	addEntries, argsFile := fakeGcloud(t)
+
+	now := time.Now().UTC()
+	timestamp := func(ms int) string {
+		return now.Add(time.Duration(ms) * time.Millisecond).Format(time.RFC3339Nano)
+	}
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	// the backend echoes the marker header into the request log
+	marker := func(id string, suffix string, ms int) string {
+		return `{
+  "insertId": "` + id + `",
+  "timestamp": "` + timestamp(ms) + `",
+  "httpRequest": {"requestUrl": "http://localhost/status/200"},
+  "jsonPayload": {"requestHeaders": {"x-crs-test": "` + stageID + suffix + `"}}
+}`
+	}
+	addEntries("[" + marker("1", " -start", 0) + "]")
+	// the start marker is returned again, and entries are sorted by timestamp
+	addEntries("[" + marker("3", " -end", 10) + "," + marker("1", " -start", 0) + `,
+{"insertId": "2", "timestamp": "` + timestamp(1) + `", "httpRequest": {"requestUrl": "http://localhost/?id=1%27%20or%201=1"},
+ "jsonPayload": {"enforcedSecurityPolicy": {"name": "ftw", "priority": 1000, "outcome": "DENY", "configuredAction": "DENY",
+   "preconfiguredExprIds": ["owasp-crs-v030301-id942100-sqli", "owasp-crs-v030301-id942190-sqli"]}}}]`)
+
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if ll.Format != config.CloudArmorLogFormat {
+		t.Errorf("unexpected default log format %s", ll.Format)
+	}
+
+	ll.StartMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Contains(ll.StartMarker, []byte(stageID+" -start")) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Contains(ll.EndMarker, []byte(stageID+" -end")) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{942100, 942190}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(calls) != 2 || !strings.Contains(calls[0], "--project=ftw") || !strings.Contains(calls[0], config.DefaultCloudLoggingFilter) {
+		t.Errorf("unexpected gcloud calls %q", calls)
+	}
+}
+
+func TestCloudArmorLines(t *testing.T) {
+	entry := `{"insertId":"a1","httpRequest":{"requestUrl":"http://localhost/?id=1"},"jsonPayload":{"enforcedSecurityPolicy":{"name":"ftw","priority":2147483647,"outcome":"ACCEPT","configuredAction":"ALLOW"},"previewSecurityPolicy":{"name":"ftw","priority":1000,"outcome":"DENY","configuredAction":"DENY","preconfiguredExprIds":["owasp-crs-v030301-id942100-sqli"]}}}`
+	lines := cloudArmorLines([]byte(entry))
+	expected := []string{
+		`Cloud Armor: ALLOW. [policy "ftw"] [priority "2147483647"] [outcome "ACCEPT"] [uri "http://localhost/?id=1"] [unique_id "a1"]`,
+		`Cloud Armor: PREVIEW DENY. [policy "ftw"] [priority "1000"] [outcome "DENY"] [rule "owasp-crs-v030301-id942100-sqli"] [id "942100"] [uri "http://localhost/?id=1"] [unique_id "a1"]`,
+	}
+	if len(lines) != 3 {
+		t.Fatalf("expected the line and 2 policy lines, got %q", lines)
+	}
+	for i, line := range expected {
+		if string(lines[i+1]) != line {
+			t.Errorf("unexpected policy line:\n%s\n%s", lines[i+1], line)
+		}
+	}
+
+	for _, line := range []string{"", "not json", `{"insertId":"a2","jsonPayload":{}}`} {
+		if lines := cloudArmorLines([]byte(line)); len(lines) != 1 {
+			t.Errorf("%q: line must be kept as it is, got %q", line, lines)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package waflog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// awsCommand is the AWS CLI, used to query CloudWatch Logs
+var awsCommand = "aws"
+
+// cloudWatchIngestionDelay is how long events can take to be ingested by CloudWatch Logs. Events
+// with a timestamp this old are queried again, so late events are not missed.
+var cloudWatchIngestionDelay = time.Minute
+
+// cloudWatchEvent is an event in the output of `aws logs filter-log-events`
+type cloudWatchEvent struct {
+	EventID   string `json:"eventId"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// cloudWatch queries the events of a log group of CloudWatch Logs
+type cloudWatch struct {
+	group        string
+	streamPrefix string
+	region       string
+	profile      string
+	interval     time.Duration
+
+	since    int64
+	latest   int64
+	lastRead time.Time
+	seen     map[string]bool
+}
+
+func (c *cloudWatch) start() error {
+	if c.group == "" {
+		return fmt.Errorf("ftw/waflog: the cloudwatch log group is not set")
+	}
+	c.since = time.Now().UnixMilli()
+	c.latest = c.since
+	c.seen = make(map[string]bool)
+	return nil
+}
+
+// awsArgs returns the arguments to query the events since the timestamp, in milliseconds
+func (c *cloudWatch) awsArgs(since int64) []string {
+	args := []string{"logs", "filter-log-events", "--output=json",
+		"--log-group-name=" + c.group, "--start-time=" + strconv.FormatInt(since, 10)}
+	if c.streamPrefix != "" {
+		args = append(args, "--log-stream-name-prefix="+c.streamPrefix)
+	}
+	if c.region != "" {
+		args = append(args, "--region="+c.region)
+	}
+	if c.profile != "" {
+		args = append(args, "--profile="+c.profile)
+	}
+	return args
+}
+
+func (c *cloudWatch) read() ([]byte, error) {
+	// CloudWatch Logs has quotas for the queries, and new events take a while to show up
+	if wait := c.interval - time.Since(c.lastRead); wait > 0 {
+		time.Sleep(wait)
+	}
+	c.lastRead = time.Now()
+
+	since := c.latest - cloudWatchIngestionDelay.Milliseconds()
+	if since < c.since {
+		since = c.since
+	}
+	args := c.awsArgs(since)
+	log.Trace().Msgf("ftw/waflog: running %s %v", awsCommand, args)
+	out, err := exec.Command(awsCommand, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("ftw/waflog: can't query the cloudwatch log group %s: %w", c.group, err)
+	}
+
+	var result struct {
+		Events []cloudWatchEvent `json:"events"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("ftw/waflog: bad output of the aws command: %w", err)
+	}
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		return result.Events[i].Timestamp < result.Events[j].Timestamp
+	})
+
+	var logs []byte
+	for _, event := range result.Events {
+		// events are queried again until they are older than the ingestion delay
+		if c.seen[event.EventID] {
+			continue
+		}
+		c.seen[event.EventID] = true
+		if event.Timestamp > c.latest {
+			c.latest = event.Timestamp
+		}
+		logs = append(logs, strings.TrimRight(event.Message, "\r\n")...)
+		logs = append(logs, '\n')
+	}
+	return logs, nil
+}
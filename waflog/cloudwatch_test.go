@@ -0,0 +1,111 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestAWSArgs(t *testing.T) {
+	c := &cloudWatch{group: "/aws/waf", streamPrefix: "i-0123", region: "eu-west-1", profile: "ftw"}
+	expected := []string{"logs", "filter-log-events", "--output=json", "--log-group-name=/aws/waf", "--start-time=1672885269000",
+		"--log-stream-name-prefix=i-0123", "--region=eu-west-1", "--profile=ftw"}
+	if args := c.awsArgs(1672885269000); !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments %v", args)
+	}
+}
+
+// fakeAWS replaces the AWS CLI with a script that prints the events given to the returned
+// function, one call of the function per query, and records its arguments
+func fakeAWS(t *testing.T) (func(events ...cloudWatchEvent), string) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "aws")
+	argsFile := filepath.Join(dir, "args")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" >> `+argsFile+`
+n=$(wc -l < `+argsFile+`)
+if [ -f `+dir+`/events-$n ]; then cat `+dir+`/events-$n; else echo '{"events": []}'; fi
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := awsCommand
+	awsCommand = script
+	t.Cleanup(func() { awsCommand = previous })
+
+	calls := 0
+	return func(events ...cloudWatchEvent) {
+		calls++
+		out, err := json.Marshal(map[string]interface{}{"events": events})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "events-"+strconv.Itoa(calls)), out, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}, argsFile
+}
+
+func TestCloudWatch(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
+	}
+	cfg, err := config.NewConfigFromString("logsource: cloudwatch\ncloudwatch:\n  loggroup: /aws/waf\n  pollinterval: 1ms\n")
+	if err != nil {
+		t.Error(err)
+	}
+	addEvents, argsFile := fakeAWS(t)
+
+	now := time.Now().UnixMilli()
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	addEvents(cloudWatchEvent{EventID: "1", Timestamp: now, Message: startMarkerLine + "\n"})
+	var events []cloudWatchEvent
+	for i, line := range strings.Split(rulesLogLines, "\n") {
+		events = append(events, cloudWatchEvent{EventID: strconv.Itoa(i + 2), Timestamp: now + int64(i) + 1, Message: line})
+	}
+	// the start marker is returned again, and events are sorted by timestamp
+	addEvents(append([]cloudWatchEvent{
+		{EventID: "10", Timestamp: now + 10, Message: endMarkerLine},
+		{EventID: "1", Timestamp: now, Message: startMarkerLine + "\n"},
+	}, events...)...)
+
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	ll.StartMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.StartMarker, bytes.ToLower([]byte(startMarkerLine))) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(calls) != 2 || !strings.Contains(calls[0], "--log-group-name=/aws/waf") {
+		t.Errorf("unexpected aws calls %q", calls)
+	}
+}
+
+func TestCloudWatchNoLogGroup(t *testing.T) {
+	if err := (&cloudWatch{}).start(); err == nil {
+		t.Error("expected an error without log group")
+	}
+}
@@ -0,0 +1,114 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// corazaSeverities are the names Coraza uses for severities in the error log
+var corazaSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// corazaLoggerFields are the fields holding the message in JSON lines of the loggers wrapping
+// the Coraza error log, like the ones of Caddy (`msg`) or Envoy and Kubernetes (`log`, `message`)
+var corazaLoggerFields = []string{"msg", "message", "log"}
+
+// corazaErrorLines returns the lines matched against the expected output for a line of the
+// Coraza error log. Servers embedding Coraza often write its messages as JSON, with quotes
+// escaped (`[id \"942100\"]`), so the message is added unescaped after the line.
+func corazaErrorLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return lines
+	}
+	for _, name := range corazaLoggerFields {
+		if message, ok := fields[name].(string); ok && strings.Contains(message, "Coraza:") {
+			lines = append(lines, []byte(message))
+		}
+	}
+	return lines
+}
+
+// corazaAuditEntry is a transaction in the Coraza JSON audit log
+type corazaAuditEntry struct {
+	Transaction struct {
+		ID      string `json:"id"`
+		Request struct {
+			URI     string              `json:"uri"`
+			Headers map[string][]string `json:"headers"`
+		} `json:"request"`
+	} `json:"transaction"`
+	Messages []struct {
+		Message string `json:"message"`
+		Data    struct {
+			File     string   `json:"file"`
+			Line     jsonText `json:"line"`
+			ID       jsonText `json:"id"`
+			Rev      string   `json:"rev"`
+			Msg      string   `json:"msg"`
+			Data     string   `json:"data"`
+			Severity jsonText `json:"severity"`
+			Ver      string   `json:"ver"`
+			Tags     []string `json:"tags"`
+		} `json:"data"`
+	} `json:"messages"`
+}
+
+// corazaAuditLines returns the lines matched against the expected output for a line of the
+// Coraza JSON audit log: the line itself, followed by every rule match of the transaction
+// serialized like in the Coraza error log, e.g. `Coraza: Warning. ... [id "942100"] [msg "..."]`.
+// Lines that are not audit log entries are returned as they are.
+func corazaAuditLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var entry corazaAuditEntry
+	if err := json.Unmarshal(trimmed, &entry); err != nil {
+		return lines
+	}
+
+	hostname := ""
+	for name, values := range entry.Transaction.Request.Headers {
+		if strings.EqualFold(name, "Host") && len(values) > 0 {
+			hostname = values[0]
+		}
+	}
+	for _, message := range entry.Messages {
+		data := message.Data
+		var b strings.Builder
+		b.WriteString("Coraza: Warning. " + data.Msg)
+		writeField(&b, "file", data.File)
+		writeField(&b, "line", string(data.Line))
+		writeField(&b, "id", string(data.ID))
+		writeField(&b, "rev", data.Rev)
+		writeField(&b, "msg", data.Msg)
+		writeField(&b, "data", data.Data)
+		writeField(&b, "severity", corazaSeverity(string(data.Severity)))
+		writeField(&b, "ver", data.Ver)
+		for _, tag := range data.Tags {
+			writeField(&b, "tag", tag)
+		}
+		writeField(&b, "hostname", hostname)
+		writeField(&b, "uri", entry.Transaction.Request.URI)
+		writeField(&b, "unique_id", entry.Transaction.ID)
+		lines = append(lines, []byte(b.String()))
+	}
+	return lines
+}
+
+// corazaSeverity returns the name of a numeric severity, as written in the Coraza error log
+func corazaSeverity(severity string) string {
+	if len(severity) == 1 && severity[0] >= '0' && int(severity[0]-'0') < len(corazaSeverities) {
+		return corazaSeverities[severity[0]-'0']
+	}
+	return severity
+}
@@ -0,0 +1,97 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var corazaStartMarkerLine = `{"level":"error","ts":1672531200.1,"logger":"http.handlers.waf","msg":"[client \"172.23.0.1\"] Coraza: Warning. X-CRS-Test dead-beaf-deadbeef-deadbeef-dead -start [file \"/etc/coraza/crs-test.conf\"] [line \"1\"] [id \"999999\"] [rev \"\"] [msg \"X-CRS-Test dead-beaf-deadbeef-deadbeef-dead -start\"] [data \"\"] [severity \"emergency\"] [ver \"\"] [maturity \"0\"] [accuracy \"0\"] [hostname \"localhost\"] [uri \"/status/200\"] [unique_id \"a1\"]"}`
+
+var corazaEndMarkerLine = strings.ReplaceAll(corazaStartMarkerLine, "-start", "-end")
+
+var corazaErrorLogLines = `{"level":"error","ts":1672531200.2,"logger":"http.handlers.waf","msg":"[client \"172.23.0.1\"] Coraza: Warning. SQL Injection Attack Detected via libinjection [file \"@owasp_crs/REQUEST-942-APPLICATION-ATTACK-SQLI.conf\"] [line \"45\"] [id \"942100\"] [rev \"\"] [msg \"SQL Injection Attack Detected via libinjection\"] [data \"Matched Data: s&1c found within ARGS:id: 1' or 1=1\"] [severity \"critical\"] [ver \"OWASP_CRS/4.0.0\"] [maturity \"0\"] [accuracy \"0\"] [tag \"attack-sqli\"] [hostname \"localhost\"] [uri \"/?id=1%27%20or%201=1\"] [unique_id \"a2\"]"}
+[client "172.23.0.1"] Coraza: Warning. Inbound Anomaly Score Exceeded (Total Score: 5) [file "@owasp_crs/REQUEST-949-BLOCKING-EVALUATION.conf"] [line "81"] [id "949110"] [rev ""] [msg "Inbound Anomaly Score Exceeded (Total Score: 5)"] [data ""] [severity "emergency"] [ver "OWASP_CRS/4.0.0"] [maturity "0"] [accuracy "0"] [hostname "localhost"] [uri "/?id=1%27%20or%201=1"] [unique_id "a2"]`
+
+var corazaAuditMarkerLine = `{"transaction":{"timestamp":"2023/01/01 00:00:00","unix_timestamp":1672531200,"id":"b1","client_ip":"172.23.0.1","client_port":58998,"request":{"method":"GET","protocol":"HTTP/1.1","uri":"/status/200","headers":{"host":["localhost"],"x-crs-test":["dead-beaf-deadbeef-deadbeef-dead"]}},"response":{"status":200},"is_interrupted":false},"messages":[{"actionset":"","message":"","data":{"file":"","line":1,"id":999999,"msg":"X-CRS-Test dead-beaf-deadbeef-deadbeef-dead","severity":0}}]}`
+
+var corazaAuditLogLine = `{"transaction":{"timestamp":"2023/01/01 00:00:00","unix_timestamp":1672531200,"id":"b2","client_ip":"172.23.0.1","client_port":58998,"request":{"method":"GET","protocol":"HTTP/1.1","uri":"/?id=1%27%20or%201=1","headers":{"host":["localhost"]}},"response":{"status":403},"is_interrupted":true},"messages":[{"actionset":"","message":"","data":{"file":"@owasp_crs/REQUEST-942-APPLICATION-ATTACK-SQLI.conf","line":45,"id":942100,"rev":"","msg":"SQL Injection Attack Detected via libinjection","data":"Matched Data: s&1c found within ARGS:id: 1' or 1=1","severity":2,"ver":"OWASP_CRS/4.0.0","maturity":0,"accuracy":0,"tags":["attack-sqli"],"raw":""}},{"actionset":"","message":"","data":{"file":"@owasp_crs/REQUEST-949-BLOCKING-EVALUATION.conf","line":81,"id":949110,"msg":"Inbound Anomaly Score Exceeded (Total Score: 5)","severity":0}}]}`
+
+func TestCorazaErrorLines(t *testing.T) {
+	wrapped := strings.Split(corazaErrorLogLines, "\n")[0]
+	lines := corazaErrorLines([]byte(wrapped))
+	if len(lines) != 2 || !bytes.HasPrefix(lines[1], []byte(`[client "172.23.0.1"] Coraza: Warning.`)) {
+		t.Fatalf("the message must be unwrapped, got %q", lines)
+	}
+	if !bytes.Contains(lines[1], []byte(`[id "942100"]`)) {
+		t.Errorf("unexpected message %s", lines[1])
+	}
+
+	for _, line := range []string{"", strings.Split(corazaErrorLogLines, "\n")[1], `{"level":"info","msg":"handled request"}`} {
+		if lines := corazaErrorLines([]byte(line)); len(lines) != 1 {
+			t.Errorf("%q: line must be kept as it is, got %q", line, lines)
+		}
+	}
+}
+
+func TestCorazaAuditLines(t *testing.T) {
+	lines := corazaAuditLines([]byte(corazaAuditLogLine))
+	if len(lines) != 3 {
+		t.Fatalf("expected the line and 2 rule matches, got %d lines", len(lines))
+	}
+	expected := `Coraza: Warning. SQL Injection Attack Detected via libinjection [file "@owasp_crs/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "45"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"] [data "Matched Data: s&1c found within ARGS:id: 1' or 1=1"] [severity "critical"] [ver "OWASP_CRS/4.0.0"] [tag "attack-sqli"] [hostname "localhost"] [uri "/?id=1%27%20or%201=1"] [unique_id "b2"]`
+	if string(lines[1]) != expected {
+		t.Errorf("unexpected message line:\n%s\n%s", lines[1], expected)
+	}
+}
+
+func TestCorazaLogs(t *testing.T) {
+	var tests = []struct {
+		format      config.LogFormat
+		startMarker string
+		lines       string
+		endMarker   string
+	}{
+		{config.CorazaLogFormat, corazaStartMarkerLine, corazaErrorLogLines, corazaEndMarkerLine},
+		{config.CorazaJSONLogFormat, corazaAuditMarkerLine, corazaAuditLogLine, strings.Replace(corazaAuditMarkerLine, `"b1"`, `"b3"`, 1)},
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	for _, tc := range tests {
+		cfg, err := config.NewConfigFromString("logformat: " + string(tc.format))
+		if err != nil {
+			t.Error(err)
+		}
+		filename, err := utils.CreateTempFileWithContent(tc.startMarker+"\n"+tc.lines+"\n"+tc.endMarker+"\n", "test-coraza-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.LogFile = filename
+		t.Cleanup(func() { os.Remove(filename) })
+
+		ll := NewFTWLogLines(cfg, WithStartMarker(bytes.ToLower([]byte(tc.startMarker))))
+		t.Cleanup(func() { _ = ll.Cleanup() })
+		ll.EndMarker = ll.CheckLogForMarker(stageID)
+		if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(tc.endMarker))) {
+			t.Fatalf("%s: marker not found, got %q", tc.format, ll.EndMarker)
+		}
+
+		if !ll.Contains(`\[id "942100"\]`) || !ll.Contains(`Coraza: Warning\. SQL Injection`) {
+			t.Errorf("%s: rule matches must be found as Coraza error log lines", tc.format)
+		}
+		if ll.Contains(`id "999999"`) {
+			t.Errorf("%s: rule matches of the markers must not be found", tc.format)
+		}
+		if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{942100, 949110}) {
+			t.Errorf("%s: unexpected rules %v", tc.format, ids)
+		}
+		if inbound, _ := ll.AnomalyScores(); inbound != 5 {
+			t.Errorf("%s: unexpected inbound score %d", tc.format, inbound)
+		}
+	}
+}
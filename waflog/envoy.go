@@ -0,0 +1,83 @@
+package waflog
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// envoyMarkerLookback is the number of lines at the end of the Envoy log searched for a marker.
+// The workers of Envoy write their logs at the same time, and the access log line of the marker
+// request comes after the lines of the filters, so the marker is not always the last line.
+const envoyMarkerLookback = 20
+
+// envoyPrefixRegex matches the prefix of the lines of the default log format of Envoy, with the
+// time, the thread, the level and the logger, e.g.
+// `[2023-05-03 12:34:56.789][23][warning][wasm] [source/extensions/common/wasm/context.cc:1151] `
+var envoyPrefixRegex = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)\]\[(\d+)\]\[(\w+)\]\[([\w.]+)\] (?:\[[^\]]*\] )?`)
+
+// envoyWasmPrefixRegex matches the prefix Envoy adds to the messages of Wasm filters like
+// coraza-proxy-wasm, with the root ID and the VM ID of the filter when they are set, e.g.
+// `wasm log coraza-filter: `
+var envoyWasmPrefixRegex = regexp.MustCompile(`^wasm log(?: ([^ :]+))?(?: ([^ :]+))?: `)
+
+// envoyEntryStartRegex matches the start of an entry of the Envoy log: a line of the default log
+// format or of the default access log format, starting with the time, or a JSON line
+var envoyEntryStartRegex = regexp.MustCompile(`^(?:\[\d{4}-\d{2}-\d{2}[ T]|\{)`)
+
+// envoyEntries joins the lines of the messages written over several lines, like the Coraza
+// messages with new lines in the matched data, to the line they started on
+func envoyEntries(lines [][]byte) [][]byte {
+	var entries [][]byte
+	var continued [][]byte
+	for _, line := range lines {
+		if !envoyEntryStartRegex.Match(line) {
+			continued = append(continued, line)
+			continue
+		}
+		for i := len(continued) - 1; i >= 0; i-- {
+			line = append(append(line, '\n'), continued[i]...)
+		}
+		continued = nil
+		entries = append(entries, line)
+	}
+	// lines before the first entry belong to an entry that started before the start marker
+	return entries
+}
+
+// envoyRuleMatch reads a rule match from an entry of the Envoy log, written by coraza-proxy-wasm, like
+//
+//	[2023-05-03 12:34:56.789][23][critical][wasm] [source/extensions/common/wasm/context.cc:1151] wasm log coraza-filter: [client "172.18.0.1"] Coraza: Warning. ... [id "942100"] ... [unique_id "ZqUFDjBIiUvdPWmEzCxb"]
+//
+// The fields of the prefix are added to the context as `time`, `thread`, `level` and `logger`,
+// with the `root_id` and `vm_id` of the filter when Envoy writes them. Coraza writes the unique ID
+// last, so matches without it are marked as truncated.
+func envoyRuleMatch(line []byte) (RuleMatch, bool) {
+	match, ok := parseRuleMatch(line)
+	if !ok {
+		return match, false
+	}
+
+	if prefix := envoyPrefixRegex.FindSubmatch(line); prefix != nil {
+		match.Context = map[string]string{
+			"time":   string(prefix[1]),
+			"thread": string(prefix[2]),
+			"level":  string(prefix[3]),
+			"logger": string(prefix[4]),
+		}
+		if wasm := envoyWasmPrefixRegex.FindSubmatch(line[len(prefix[0]):]); wasm != nil {
+			for i, name := range []string{"root_id", "vm_id"} {
+				if value := strings.TrimSpace(string(wasm[i+1])); value != "" {
+					match.Context[name] = value
+				}
+			}
+		}
+	}
+
+	if match.UniqueID == "" {
+		match.Truncated = true
+		log.Debug().Msgf("ftw/waflog: the Envoy log entry of rule %d is truncated, fields at the end may be missing", match.ID)
+	}
+	return match, true
+}
@@ -0,0 +1,98 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var envoyLogLines = `[2023-05-03 12:34:56.789][23][critical][wasm] [source/extensions/common/wasm/context.cc:1151] wasm log coraza-filter my_vm: [client "172.18.0.1"] Coraza: Warning. SQL Injection Attack Detected via libinjection [file "@owasp_crs/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "5547"] [id "942100"] [rev ""] [msg "SQL Injection Attack Detected via libinjection"] [data "Matched Data: s&1c found within ARGS:id: 1' or 1=1"] [severity "critical"] [ver "OWASP_CRS/4.0.0"] [maturity "0"] [accuracy "0"] [tag "attack-sqli"] [tag "paranoia-level/1"] [hostname "172.18.0.3"] [uri "/?id=1%27%20or%201=1"] [unique_id "ZqUFDjBIiUvdPWmEzCxb"]
+[2023-05-03 12:34:56.790][24][info][wasm] [source/extensions/common/wasm/context.cc:1151] wasm log coraza-filter my_vm: unrelated message of another worker
+[2023-05-03 12:34:56.791][23][critical][wasm] [source/extensions/common/wasm/context.cc:1151] wasm log: [client "172.18.0.1"] Coraza: Warning. Line feed in the matched data [id "921150"] [msg "HTTP Header Injection Attack via payload"] [data "Matched Data: line
+feed found within ARGS_NAMES"] [severity "critical"] [unique_id "ZqUFDjBIiUvdPWmEzCxb"]
+{"time":"2023-05-03T12:34:56.792Z","level":"critical","msg":"wasm log coraza-filter: [client \"172.18.0.1\"] Coraza: Access denied (phase 2). Inbound Anomaly Score Exceeded [id \"949110\"] [msg \"Inbound Anomaly Score Exceeded (Total Score: 10)\"] [severity \"emergency\"] [unique_id \"ZqUFDjBIiUvdPWmEzCxb\"]"}
+[2023-05-03T12:34:56.792Z] "GET /?id=1%27%20or%201=1 HTTP/1.1" 403 - 0 0 1 - "172.18.0.1" "ModSecurity CRS 3 Tests" "2b8e1ac0-3e2f-4f4d-9d0b-1f0e8b4f7c1a" "localhost" "-"`
+
+func TestEnvoyRuleMatch(t *testing.T) {
+	lines := strings.Split(envoyLogLines, "\n")
+
+	match, ok := envoyRuleMatch([]byte(lines[0]))
+	if !ok {
+		t.Fatal("rule match not found")
+	}
+	if match.ID != 942100 || match.UniqueID != "ZqUFDjBIiUvdPWmEzCxb" || match.Truncated {
+		t.Errorf("unexpected match %+v", match)
+	}
+	expected := map[string]string{
+		"time":    "2023-05-03 12:34:56.789",
+		"thread":  "23",
+		"level":   "critical",
+		"logger":  "wasm",
+		"root_id": "coraza-filter",
+		"vm_id":   "my_vm",
+	}
+	if !reflect.DeepEqual(match.Context, expected) {
+		t.Errorf("unexpected context %v", match.Context)
+	}
+
+	match, ok = envoyRuleMatch([]byte(lines[2]))
+	if !ok {
+		t.Fatal("rule match not found without filter IDs")
+	}
+	if _, found := match.Context["root_id"]; found || match.Context["level"] != "critical" || !match.Truncated {
+		t.Errorf("unexpected match %+v", match)
+	}
+
+	if _, ok := envoyRuleMatch([]byte(lines[1])); ok {
+		t.Error("lines without rule are not rule matches")
+	}
+}
+
+func TestEnvoyLog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: envoy")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	markerLine := func(thread string) string {
+		return `[2023-05-03 12:34:56.700][` + thread + `][critical][wasm] [source/extensions/common/wasm/context.cc:1151] wasm log coraza-filter my_vm: [client "172.18.0.1"] Coraza: Warning. [id "999999"] [msg "X-CRS-Test ` + stageID + `"] [unique_id "marker"]`
+	}
+	startMarkerLine := markerLine("23")
+	endMarkerLine := markerLine("25")
+	// the access log lines of the marker request and of other requests come after the end marker
+	after := `[2023-05-03T12:34:56.900Z] "GET /status/200 HTTP/1.1" 200 - 0 0 1 - "172.18.0.1" "go-ftw test agent" "-" "localhost" "-"
+[2023-05-03 12:34:56.901][24][critical][wasm] [source/extensions/common/wasm/context.cc:1151] wasm log coraza-filter my_vm: [client "172.18.0.1"] Coraza: Warning. [id "920350"] [msg "Host header is a numeric IP address"] [unique_id "other"]`
+	filename, err := utils.CreateTempFileWithContent(startMarkerLine+"\n"+envoyLogLines+"\n"+endMarkerLine+"\n"+after+"\n", "test-envoy-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg, WithStartMarker(bytes.ToLower([]byte(startMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("marker not found, got %q", ll.EndMarker)
+	}
+
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{921150, 942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	matches := ll.RuleMatches()
+	if len(matches) != 3 || matches[1].Data != "Matched Data: line\nfeed found within ARGS_NAMES" {
+		t.Errorf("unexpected rule matches %+v", matches)
+	}
+	if !ll.Contains(`\[id "949110"\]`) || !ll.Contains(`"GET /\?id=1%27%20or%201=1 HTTP/1.1" 403`) {
+		t.Error("JSON messages must be matched unescaped, and access log lines as they are")
+	}
+	if ll.Contains(`920350`) {
+		t.Error("lines after the end marker must not be matched")
+	}
+}
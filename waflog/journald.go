@@ -0,0 +1,68 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// journalctlCommand is the command used to read the journal
+var journalctlCommand = "journalctl"
+
+// journalCursorPrefix starts the line with the cursor of the last entry, written by `--show-cursor`
+var journalCursorPrefix = []byte("-- cursor: ")
+
+// journal reads the entries of the systemd journal with journalctl
+type journal struct {
+	unit       string
+	identifier string
+	since      time.Time
+	cursor     string
+}
+
+func (j *journal) start() error {
+	j.since = time.Now()
+	return nil
+}
+
+// journalctlArgs returns the arguments to read the entries after the last one copied
+func (j *journal) journalctlArgs() []string {
+	args := []string{"--no-pager", "--quiet", "--output=cat", "--show-cursor"}
+	if j.unit != "" {
+		args = append(args, "--unit="+j.unit)
+	}
+	if j.identifier != "" {
+		args = append(args, "--identifier="+j.identifier)
+	}
+	if j.cursor != "" {
+		args = append(args, "--after-cursor="+j.cursor)
+	} else {
+		args = append(args, fmt.Sprintf("--since=@%d", j.since.Unix()))
+	}
+	return args
+}
+
+func (j *journal) read() ([]byte, error) {
+	args := j.journalctlArgs()
+	log.Trace().Msgf("ftw/waflog: running %s %v", journalctlCommand, args)
+	out, err := exec.Command(journalctlCommand, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't read the journal: %w", err)
+	}
+
+	out = bytes.TrimRight(out, "\n")
+	if i := bytes.LastIndexByte(out, '\n'); bytes.HasPrefix(out[i+1:], journalCursorPrefix) {
+		j.cursor = string(out[i+1+len(journalCursorPrefix):])
+		if i < 0 {
+			i = 0
+		}
+		out = out[:i]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return append(out, '\n'), nil
+}
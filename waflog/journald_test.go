@@ -0,0 +1,109 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestJournalctlArgs(t *testing.T) {
+	j := journal{unit: "apache2.service", since: time.Unix(1672885269, 0)}
+	expected := []string{"--no-pager", "--quiet", "--output=cat", "--show-cursor", "--unit=apache2.service", "--since=@1672885269"}
+	if args := j.journalctlArgs(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments %v", args)
+	}
+
+	j = journal{identifier: "modsecurity", cursor: "s=abc;i=1"}
+	expected = []string{"--no-pager", "--quiet", "--output=cat", "--show-cursor", "--identifier=modsecurity", "--after-cursor=s=abc;i=1"}
+	if args := j.journalctlArgs(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments %v", args)
+	}
+}
+
+// fakeJournalctl replaces journalctl with a script that prints the entries of the files
+// written by the returned function, one file per call, and records its arguments
+func fakeJournalctl(t *testing.T) (func(entries string), string) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "journalctl")
+	argsFile := filepath.Join(dir, "args")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" >> `+argsFile+`
+n=$(wc -l < `+argsFile+`)
+if [ -f `+dir+`/entries-$n ]; then cat `+dir+`/entries-$n; fi
+echo "-- cursor: s=abc;i=$n"
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := journalctlCommand
+	journalctlCommand = script
+	t.Cleanup(func() { journalctlCommand = previous })
+
+	calls := 0
+	return func(entries string) {
+		calls++
+		name := filepath.Join(dir, "entries-"+strconv.Itoa(calls))
+		if err := os.WriteFile(name, []byte(entries), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}, argsFile
+}
+
+func TestJournald(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
+	}
+	cfg, err := config.NewConfigFromString("logsource: journald\njournald:\n  unit: apache2.service\n")
+	if err != nil {
+		t.Error(err)
+	}
+	addEntries, argsFile := fakeJournalctl(t)
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	addEntries(startMarkerLine + "\n")
+	addEntries(rulesLogLines + "\n" + endMarkerLine + "\n")
+
+	ll := NewFTWLogLines(cfg)
+	spool := ll.FileName
+	if _, err := os.Stat(spool); err != nil {
+		t.Fatalf("spool file not created: %s", err)
+	}
+
+	ll.StartMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.StartMarker, bytes.ToLower([]byte(startMarkerLine))) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(calls) != 2 || !strings.Contains(calls[0], "--unit=apache2.service --since=@") ||
+		!strings.HasSuffix(calls[1], "--after-cursor=s=abc;i=1") {
+		t.Errorf("unexpected journalctl calls %q", calls)
+	}
+
+	if err := ll.Cleanup(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("spool file not removed")
+	}
+}
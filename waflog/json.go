@@ -0,0 +1,106 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonText is a JSON value used as text, because the same fields are strings in some
+// versions of the audit log and numbers in others
+type jsonText string
+
+func (t *jsonText) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = jsonText(s)
+		return nil
+	}
+	*t = jsonText(bytes.Trim(data, `"`))
+	return nil
+}
+
+// jsonMessage is a rule match in the ModSecurity v3 JSON audit log
+type jsonMessage struct {
+	Message string `json:"message"`
+	Details struct {
+		Match      string   `json:"match"`
+		RuleID     jsonText `json:"ruleId"`
+		File       string   `json:"file"`
+		LineNumber jsonText `json:"lineNumber"`
+		Data       string   `json:"data"`
+		Severity   jsonText `json:"severity"`
+		Ver        string   `json:"ver"`
+		Tags       []string `json:"tags"`
+	} `json:"details"`
+}
+
+// jsonAuditEntry is a transaction in the JSON audit log. ModSecurity v3 writes the rule matches
+// as objects in `transaction.messages`, ModSecurity v2 as error log messages in `audit_data.messages`.
+type jsonAuditEntry struct {
+	Transaction struct {
+		UniqueID      string `json:"unique_id"`
+		TransactionID string `json:"transaction_id"`
+		Request       struct {
+			URI string `json:"uri"`
+		} `json:"request"`
+		Messages []jsonMessage `json:"messages"`
+	} `json:"transaction"`
+	AuditData struct {
+		Messages []string `json:"messages"`
+	} `json:"audit_data"`
+}
+
+// jsonAuditLines returns the lines matched against the expected output for a line of the JSON
+// audit log: the line itself, followed by every rule match of the transaction serialized like
+// in the error log, e.g. `ModSecurity: Warning. ... [id "942100"] [msg "..."]`, so the same
+// tests work with both log formats. Lines that are not audit log entries are returned as they are.
+func jsonAuditLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var entry jsonAuditEntry
+	if err := json.Unmarshal(trimmed, &entry); err != nil {
+		return lines
+	}
+
+	for _, message := range entry.AuditData.Messages {
+		lines = append(lines, []byte("ModSecurity: "+message))
+	}
+
+	uniqueID := entry.Transaction.UniqueID
+	if uniqueID == "" {
+		uniqueID = entry.Transaction.TransactionID
+	}
+	for _, message := range entry.Transaction.Messages {
+		var b strings.Builder
+		details := message.Details
+		fmt.Fprintf(&b, "ModSecurity: Warning. %s", details.Match)
+		writeField(&b, "file", details.File)
+		writeField(&b, "line", string(details.LineNumber))
+		writeField(&b, "id", string(details.RuleID))
+		writeField(&b, "msg", message.Message)
+		writeField(&b, "data", details.Data)
+		writeField(&b, "severity", string(details.Severity))
+		writeField(&b, "ver", details.Ver)
+		for _, tag := range details.Tags {
+			writeField(&b, "tag", tag)
+		}
+		writeField(&b, "uri", entry.Transaction.Request.URI)
+		writeField(&b, "unique_id", uniqueID)
+		lines = append(lines, []byte(b.String()))
+	}
+	return lines
+}
+
+// writeField writes a field like in the ModSecurity error log, e.g. ` [id "942100"]`
+func writeField(b *strings.Builder, name string, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(b, " [%s %q]", name, value)
+}
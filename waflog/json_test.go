@@ -0,0 +1,91 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+// markers are logged because of the rule writing the X-CRS-Test header to the log
+var jsonStartMarkerLine = `{"transaction":{"client_ip":"172.23.0.1","time_stamp":"Tue Jan  5 02:21:09 2021","unique_id":"161181246962.001","request":{"method":"GET","http_version":1.1,"uri":"/status/200","headers":{"Host":"localhost","X-CRS-Test":"dead-beaf-deadbeef-deadbeef-dead"}},"messages":[{"message":"X-CRS-Test dead-beaf-deadbeef-deadbeef-dead","details":{"match":"Matched \"Operator ` + "`Rx'" + ` with parameter ` + "`^.*$'" + ` against variable ` + "`REQUEST_HEADERS:X-CRS-Test'" + `","ruleId":"999999","file":"/etc/modsecurity.d/crs-test.conf","lineNumber":"1","data":"","severity":"0","ver":"","tags":[]}}]}}`
+
+var jsonEndMarkerLine = strings.Replace(jsonStartMarkerLine, "161181246962.001", "161181246962.003", 1)
+
+var jsonV3LogLine = `{"transaction":{"client_ip":"172.23.0.1","time_stamp":"Tue Jan  5 02:21:09 2021","unique_id":"161181246962.002","request":{"method":"GET","http_version":1.1,"uri":"/?id=1%27%20or%201=1","headers":{"Host":"localhost"}},"response":{"http_code":403},"messages":[{"message":"SQL Injection Attack Detected via libinjection","details":{"match":"detected SQLi using libinjection.","reference":"v5,13","ruleId":"942100","file":"/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf","lineNumber":"45","data":"Matched Data: s&1c found within ARGS:id: 1' or 1=1","severity":"2","ver":"OWASP_CRS/3.3.0","rev":"","tags":["attack-sqli","paranoia-level/1"],"maturity":"0","accuracy":"0"}},{"message":"Inbound Anomaly Score Exceeded (Total Score: 5)","details":{"match":"Matched \"Operator ` + "`Ge'" + ` with parameter ` + "`5'" + ` against variable ` + "`TX:ANOMALY_SCORE'" + ` (Value: ` + "`5'" + ` )","ruleId":"949110","file":"/etc/modsecurity.d/owasp-crs/rules/REQUEST-949-BLOCKING-EVALUATION.conf","lineNumber":"80","data":"","severity":"2","ver":"OWASP_CRS/3.3.0","tags":["anomaly-evaluation"]}}]}}`
+
+var jsonV2LogLine = `{"transaction":{"time":"05/Jan/2021:02:21:09.637165 +0000","transaction_id":"X-PNFSe1VwjCgYRI9FsbHgAAAIY","remote_address":"172.23.0.1","remote_port":58998,"local_address":"172.23.0.2","local_port":80},"request":{"request_line":"GET / HTTP/1.1","headers":{"Host":"localhost"}},"response":{"protocol":"HTTP/1.1","status":403},"audit_data":{"messages":["Warning. Match of \"pm AppleWebKit Android\" against \"REQUEST_HEADERS:User-Agent\" required. [file \"/etc/modsecurity.d/owasp-crs/rules/REQUEST-920-PROTOCOL-ENFORCEMENT.conf\"] [line \"1230\"] [id \"920300\"] [msg \"Request Missing an Accept Header\"] [severity \"NOTICE\"]"]}}`
+
+func TestJSONAuditLines(t *testing.T) {
+	lines := jsonAuditLines([]byte(jsonV3LogLine))
+	if len(lines) != 3 {
+		t.Fatalf("expected the line and 2 rule matches, got %d lines", len(lines))
+	}
+	expected := `ModSecurity: Warning. detected SQLi using libinjection. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "45"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"] [data "Matched Data: s&1c found within ARGS:id: 1' or 1=1"] [severity "2"] [ver "OWASP_CRS/3.3.0"] [tag "attack-sqli"] [tag "paranoia-level/1"] [uri "/?id=1%27%20or%201=1"] [unique_id "161181246962.002"]`
+	if string(lines[1]) != expected {
+		t.Errorf("unexpected message line:\n%s\n%s", lines[1], expected)
+	}
+
+	lines = jsonAuditLines([]byte(jsonV2LogLine))
+	if len(lines) != 2 || !strings.Contains(string(lines[1]), `[id "920300"] [msg "Request Missing an Accept Header"]`) {
+		t.Errorf("unexpected lines %q", lines)
+	}
+
+	for _, line := range []string{"", "X-CRS-Test: 1234", "{not json"} {
+		if lines := jsonAuditLines([]byte(line)); len(lines) != 1 || string(lines[0]) != line {
+			t.Errorf("%q: line must be kept as it is, got %q", line, lines)
+		}
+	}
+}
+
+func TestJSONAuditLog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: json")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	logLines := strings.Join([]string{jsonStartMarkerLine, jsonV3LogLine, jsonV2LogLine, jsonEndMarkerLine}, "\n")
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-auditlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	endMarker := ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(endMarker, bytes.ToLower([]byte(jsonEndMarkerLine))) {
+		t.Fatalf("marker not found in the JSON audit log, got %q", endMarker)
+	}
+	ll.StartMarker = bytes.ToLower([]byte(jsonStartMarkerLine))
+	ll.EndMarker = endMarker
+
+	if !ll.Contains(`id "942100"`) || !ll.Contains(`\[id "920300"\]`) {
+		t.Error("rule matches must be found as error log lines")
+	}
+	if !ll.Contains(`"uri":"/\?id=1%27`) {
+		t.Error("the serialized transaction must be matched")
+	}
+	if ll.Contains(`id "999999"`) {
+		t.Error("rule matches of the markers must not be found")
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	if inbound, _ := ll.AnomalyScores(); inbound != 5 {
+		t.Errorf("unexpected inbound score %d", inbound)
+	}
+
+	// the same log, read as error log, has no rule matches
+	native := NewFTWLogLines(cfg, WithLogFormat(config.NativeLogFormat), WithStartMarker(ll.StartMarker), WithEndMarker(ll.EndMarker))
+	t.Cleanup(func() { _ = native.Cleanup() })
+	if native.Contains(`id "942100"`) {
+		t.Error("JSON audit log lines must only be parsed with the json log format")
+	}
+}
@@ -0,0 +1,104 @@
+package waflog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// azCommand is the Azure CLI, used to query Log Analytics workspaces
+var azCommand = "az"
+
+// logAnalyticsIngestionDelay is how long rows can take to be ingested by Log Analytics. Rows
+// generated this long ago are queried again, so late rows are not missed.
+var logAnalyticsIngestionDelay = 5 * time.Minute
+
+// logAnalytics queries the rows of a Log Analytics workspace with the WAF logs
+type logAnalytics struct {
+	workspace string
+	query     string
+	interval  time.Duration
+
+	since    time.Time
+	latest   time.Time
+	lastRead time.Time
+	seen     map[string]bool
+}
+
+func (l *logAnalytics) start() error {
+	if l.workspace == "" {
+		return fmt.Errorf("ftw/waflog: the log analytics workspace is not set")
+	}
+	l.since = time.Now()
+	l.latest = l.since
+	l.seen = make(map[string]bool)
+	return nil
+}
+
+// azArgs returns the arguments to query the rows generated since the time
+func (l *logAnalytics) azArgs(since time.Time) []string {
+	query := fmt.Sprintf("%s | where TimeGenerated >= datetime(%s) | order by TimeGenerated asc",
+		l.query, since.UTC().Format("2006-01-02T15:04:05.000Z"))
+	return []string{"monitor", "log-analytics", "query", "--output=json",
+		"--workspace=" + l.workspace, "--analytics-query=" + query}
+}
+
+func (l *logAnalytics) read() ([]byte, error) {
+	// Log Analytics has quotas for the queries, and new rows take a while to show up
+	if wait := l.interval - time.Since(l.lastRead); wait > 0 {
+		time.Sleep(wait)
+	}
+	l.lastRead = time.Now()
+
+	since := l.latest.Add(-logAnalyticsIngestionDelay)
+	if since.Before(l.since) {
+		since = l.since
+	}
+	args := l.azArgs(since)
+	log.Trace().Msgf("ftw/waflog: running %s %v", azCommand, args)
+	out, err := exec.Command(azCommand, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("ftw/waflog: can't query the log analytics workspace %s: %w", l.workspace, err)
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, fmt.Errorf("ftw/waflog: bad output of the az command: %w", err)
+	}
+	generated := func(row map[string]interface{}) time.Time {
+		value, _ := row["TimeGenerated"].(string)
+		ts, _ := time.Parse(time.RFC3339Nano, value)
+		return ts
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return generated(rows[i]).Before(generated(rows[j]))
+	})
+
+	var logs []byte
+	for _, row := range rows {
+		// the keys of the rows are sorted, so the same row is always the same line
+		line, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		// rows are queried again until they are older than the ingestion delay
+		if l.seen[string(line)] {
+			continue
+		}
+		l.seen[string(line)] = true
+		if ts := generated(row); ts.After(l.latest) {
+			l.latest = ts
+		}
+		logs = append(logs, line...)
+		logs = append(logs, '\n')
+	}
+	return logs, nil
+}
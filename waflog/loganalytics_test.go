@@ -0,0 +1,135 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestAzArgs(t *testing.T) {
+	l := &logAnalytics{workspace: "ws", query: "AGWFirewallLogs"}
+	since := time.Date(2023, time.January, 1, 0, 0, 0, 123456789, time.UTC)
+	expected := []string{"monitor", "log-analytics", "query", "--output=json", "--workspace=ws",
+		"--analytics-query=AGWFirewallLogs | where TimeGenerated >= datetime(2023-01-01T00:00:00.123Z) | order by TimeGenerated asc"}
+	if args := l.azArgs(since); !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments %v", args)
+	}
+}
+
+// fakeAz replaces the Azure CLI with a script that prints the rows given to the returned
+// function, one call of the function per query, and records its arguments
+func fakeAz(t *testing.T) (func(rows string), string) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "az")
+	argsFile := filepath.Join(dir, "args")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" >> `+argsFile+`
+n=$(wc -l < `+argsFile+`)
+if [ -f `+dir+`/rows-$n ]; then cat `+dir+`/rows-$n; else echo '[]'; fi
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := azCommand
+	azCommand = script
+	t.Cleanup(func() { azCommand = previous })
+
+	calls := 0
+	return func(rows string) {
+		calls++
+		if err := os.WriteFile(filepath.Join(dir, "rows-"+strconv.Itoa(calls)), []byte(rows), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}, argsFile
+}
+
+func TestLogAnalytics(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
+	}
+	cfg, err := config.NewConfigFromString("logsource: loganalytics\nloganalytics:\n  workspace: ws\n  pollinterval: 1ms\n")
+	if err != nil {
+		t.Error(err)
+	}
+	addRows, argsFile := fakeAz(t)
+
+	now := time.Now().UTC()
+	generated := func(ms int) string {
+		return now.Add(time.Duration(ms) * time.Millisecond).Format(time.RFC3339Nano)
+	}
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	marker := func(suffix string, ms int) string {
+		return `{"TimeGenerated":"` + generated(ms) + `","ruleId_s":"ftw-marker","action_s":"Matched","details_data_s":"Matched Data: ` + stageID + ` found within REQUEST_HEADERS:X-CRS-Test: ` + stageID + suffix + `"}`
+	}
+	addRows("[" + marker(" -start", 0) + "]")
+	// the start marker is returned again, and rows are sorted by the time they were generated
+	addRows("[" + marker(" -end", 10) + "," + marker(" -start", 0) + `,
+{"TimeGenerated":"` + generated(1) + `","ruleId_s":"942100","action_s":"Matched","Message":"SQL Injection Attack Detected via libinjection","details_data_s":"Matched Data: s&1c found within ARGS:id: 1' or 1=1","ruleGroup_s":"REQUEST-942-APPLICATION-ATTACK-SQLI","requestUri_s":"/?id=1%27%20or%201=1","transactionId_g":"a1"},
+{"TimeGenerated":"` + generated(2) + `","ruleId_s":"949110","action_s":"Blocked","Message":"Mandatory rule. Cannot be disabled. Inbound Anomaly Score Exceeded (Total Score: 5)","ruleGroup_s":"BLOCKING-EVALUATION","requestUri_s":"/?id=1%27%20or%201=1","transactionId_g":"a1"}]`)
+
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if ll.Format != config.AzureWAFLogFormat {
+		t.Errorf("unexpected default log format %s", ll.Format)
+	}
+
+	ll.StartMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Contains(ll.StartMarker, []byte(stageID+" -start")) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Contains(ll.EndMarker, []byte(stageID+" -end")) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	if inbound, _ := ll.AnomalyScores(); inbound != 5 {
+		t.Errorf("unexpected inbound anomaly score %d", inbound)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(calls) != 2 || !strings.Contains(calls[0], "--workspace=ws") || !strings.Contains(calls[0], config.DefaultLogAnalyticsQuery) {
+		t.Errorf("unexpected az calls %q", calls)
+	}
+}
+
+func TestLogAnalyticsNoWorkspace(t *testing.T) {
+	if err := (&logAnalytics{}).start(); err == nil {
+		t.Error("expected an error without workspace")
+	}
+}
+
+func TestAzureWAFLines(t *testing.T) {
+	frontDoor := `{"TimeGenerated":"2023-01-01T00:00:00Z","Category":"FrontDoorWebApplicationFirewallLog","ruleName_s":"Microsoft_DefaultRuleSet-2.1-SQLI-942100","action_s":"Block","requestUri_s":"https://example.com:443/?id=1%27%20or%201=1","trackingReference_s":"0c3T1ZAAAAA"}`
+	lines := azureWAFLines([]byte(frontDoor))
+	expected := `Azure WAF: Block. [rule "Microsoft_DefaultRuleSet-2.1-SQLI-942100"] [id "942100"] [uri "https://example.com:443/?id=1%27%20or%201=1"] [unique_id "0c3T1ZAAAAA"]`
+	if len(lines) != 2 || string(lines[1]) != expected {
+		t.Errorf("unexpected lines %q", lines)
+	}
+
+	// resource-specific table of Application Gateway
+	appGateway := `{"TimeGenerated":"2023-01-01T00:00:00Z","RuleId":"920350","Action":"Matched","Message":"Host header is a numeric IP address","RequestUri":"/","TransactionId":"b2"}`
+	lines = azureWAFLines([]byte(appGateway))
+	expected = `Azure WAF: Matched. [rule "920350"] [id "920350"] [msg "Host header is a numeric IP address"] [uri "/"] [unique_id "b2"]`
+	if len(lines) != 2 || string(lines[1]) != expected {
+		t.Errorf("unexpected lines %q", lines)
+	}
+
+	for _, line := range []string{"", "not json", `{"TimeGenerated":"2023-01-01T00:00:00Z","Category":"ApplicationGatewayAccessLog"}`} {
+		if lines := azureWAFLines([]byte(line)); len(lines) != 1 {
+			t.Errorf("%q: line must be kept as it is, got %q", line, lines)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package waflog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+// ruleMatchFieldRegex matches the fields of a rule match in the error log, e.g. `[id "942100"]`.
+// Quotes in values are escaped by ModSecurity and Coraza.
+var ruleMatchFieldRegex = regexp.MustCompile(`\[([a-z_]+) "((?:[^"\\]|\\.)*)"\]`)
+
+// RuleMatch is a rule match found in the logs, with the fields of the error log line
+type RuleMatch struct {
+	ID       int
+	Message  string
+	Data     string
+	Severity string
+	Tags     []string
+	File     string
+	Line     int
+	URI      string
+	UniqueID string
+	// Context has the information the server adds to the line, like `client` or `request`
+	Context map[string]string
+	// Truncated is true if the server cut the line, so some fields may be missing
+	Truncated bool
+}
+
+// ruleMatchParsers parse the rule matches of the log formats that need more than the fields
+var ruleMatchParsers = map[config.LogFormat]func([]byte) (RuleMatch, bool){
+	config.NginxLogFormat:      nginxRuleMatch,
+	config.ApacheLogFormat:     apacheRuleMatch,
+	config.EnvoyLogFormat:      envoyRuleMatch,
+	config.CorazaSPOALogFormat: spoaRuleMatch,
+	config.NaxsiLogFormat:      naxsiRuleMatch,
+}
+
+// RuleMatches returns the rule matches found in the logs between the markers, in the order
+// they were logged
+func (ll *FTWLogLines) RuleMatches() []RuleMatch {
+	parse, ok := ruleMatchParsers[ll.Format]
+	if !ok {
+		parse = parseRuleMatch
+	}
+
+	lines := ll.getEntries()
+	var matches []RuleMatch
+	// lines are read backwards
+	for i := len(lines) - 1; i >= 0; i-- {
+		for _, line := range ll.expandLine(lines[i]) {
+			if match, ok := parse(line); ok {
+				matches = append(matches, match)
+			}
+		}
+	}
+	return matches
+}
+
+// parseRuleMatch reads the fields of an error log line. Lines without a rule ID are not rule matches.
+func parseRuleMatch(line []byte) (RuleMatch, bool) {
+	var match RuleMatch
+	found := false
+	for _, field := range ruleMatchFieldRegex.FindAllSubmatch(line, -1) {
+		value := strings.ReplaceAll(string(field[2]), `\"`, `"`)
+		switch string(field[1]) {
+		case "id":
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return match, false
+			}
+			match.ID = id
+			found = true
+		case "msg":
+			match.Message = value
+		case "data":
+			match.Data = value
+		case "severity":
+			match.Severity = value
+		case "tag":
+			match.Tags = append(match.Tags, value)
+		case "file":
+			match.File = value
+		case "line":
+			match.Line, _ = strconv.Atoi(value)
+		case "uri":
+			match.URI = value
+		case "unique_id":
+			match.UniqueID = value
+		}
+	}
+	return match, found
+}
@@ -0,0 +1,102 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+func TestParseRuleMatch(t *testing.T) {
+	line := `[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76] [client 172.23.0.1] ModSecurity: Warning. Pattern match "\\"" at ARGS:id. [file "/etc/crs/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "45"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"] [data "Matched Data: \"1\" or 1=1"] [severity "CRITICAL"] [tag "attack-sqli"] [tag "paranoia-level/1"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]`
+
+	match, ok := parseRuleMatch([]byte(line))
+	if !ok {
+		t.Fatal("rule match not found")
+	}
+	expected := RuleMatch{
+		ID:       942100,
+		Message:  "SQL Injection Attack Detected via libinjection",
+		Data:     `Matched Data: "1" or 1=1`,
+		Severity: "CRITICAL",
+		Tags:     []string{"attack-sqli", "paranoia-level/1"},
+		File:     "/etc/crs/REQUEST-942-APPLICATION-ATTACK-SQLI.conf",
+		Line:     45,
+		URI:      "/",
+		UniqueID: "X-PNFSe1VwjCgYRI9FsbHgAAAIY",
+	}
+	if !reflect.DeepEqual(match, expected) {
+		t.Errorf("got %+v\nwant %+v", match, expected)
+	}
+
+	for _, line := range []string{"", "X-CRS-Test: 1234", `[msg "no id"]`, `[id "not-a-number"]`} {
+		if _, ok := parseRuleMatch([]byte(line)); ok {
+			t.Errorf("%q: unexpected rule match", line)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	logLines := fmt.Sprintf("%s\n%s\n%s", startMarkerLine, rulesLogLines, endMarkerLine)
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg,
+		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
+		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	var ids []int
+	for _, match := range ll.RuleMatches() {
+		ids = append(ids, match.ID)
+	}
+	// in the order they were logged, with repetitions
+	if !reflect.DeepEqual(ids, []int{942100, 920300, 942100, 949110}) {
+		t.Errorf("unexpected rule matches %v", ids)
+	}
+}
+
+func TestRuleMatchesJSON(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: json")
+	if err != nil {
+		t.Error(err)
+	}
+
+	logLines := strings.Join([]string{jsonStartMarkerLine, jsonV3LogLine, jsonV2LogLine, jsonEndMarkerLine}, "\n")
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-auditlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg,
+		WithStartMarker(bytes.ToLower([]byte(jsonStartMarkerLine))),
+		WithEndMarker(bytes.ToLower([]byte(jsonEndMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	matches := ll.RuleMatches()
+	if len(matches) != 3 || matches[0].ID != 942100 || matches[1].ID != 949110 || matches[2].ID != 920300 {
+		t.Fatalf("unexpected rule matches %+v", matches)
+	}
+	if !reflect.DeepEqual(matches[0].Tags, []string{"attack-sqli", "paranoia-level/1"}) || matches[0].Severity != "2" {
+		t.Errorf("unexpected fields %+v", matches[0])
+	}
+}
@@ -0,0 +1,89 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tailedFile is a local log file, with the size already copied and the last line if it's not complete
+type tailedFile struct {
+	name    string
+	offset  int64
+	partial []byte
+}
+
+// multiFile tails several local log files, like the error and the audit log, or the logs of
+// several WAF nodes, and copies their complete lines
+type multiFile struct {
+	files []*tailedFile
+}
+
+func newMultiFile(names []string) *multiFile {
+	m := &multiFile{}
+	for _, name := range names {
+		m.files = append(m.files, &tailedFile{name: name})
+	}
+	return m
+}
+
+func (m *multiFile) start() error {
+	for _, f := range m.files {
+		fi, err := os.Stat(f.name)
+		if err != nil {
+			return fmt.Errorf("ftw/waflog: can't read the log file: %w", err)
+		}
+		f.offset = fi.Size()
+	}
+	return nil
+}
+
+func (m *multiFile) read() ([]byte, error) {
+	var out []byte
+	for _, f := range m.files {
+		lines, err := f.read()
+		if err != nil {
+			return out, err
+		}
+		out = append(out, lines...)
+	}
+	return out, nil
+}
+
+// read returns the complete lines written since the last call
+func (f *tailedFile) read() ([]byte, error) {
+	file, err := os.Open(f.name)
+	if err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't read the log file: %w", err)
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < f.offset {
+		// the file was rotated, read the new one from the start
+		log.Debug().Msgf("ftw/waflog: %s was rotated", f.name)
+		f.offset = 0
+		f.partial = nil
+	}
+	if fi.Size() == f.offset {
+		return nil, nil
+	}
+
+	chunk := make([]byte, fi.Size()-f.offset)
+	n, err := file.ReadAt(chunk, f.offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	f.offset += int64(n)
+
+	data := append(f.partial, chunk[:n]...)
+	end := bytes.LastIndexByte(data, '\n') + 1
+	f.partial = append([]byte(nil), data[end:]...)
+	return data[:end], nil
+}
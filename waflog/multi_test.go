@@ -0,0 +1,116 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestTailedFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "error.log")
+	if err := os.WriteFile(name, []byte("before\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := newMultiFile([]string{name})
+	if err := m.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(data string) {
+		f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("one\ntw")
+	if out, _ := m.read(); string(out) != "one\n" {
+		t.Errorf("only complete lines must be read, got %q", out)
+	}
+	write("o\n")
+	if out, _ := m.read(); string(out) != "two\n" {
+		t.Errorf("the rest of the line must be read, got %q", out)
+	}
+	if out, _ := m.read(); out != nil {
+		t.Errorf("nothing new, got %q", out)
+	}
+
+	// rotated
+	if err := os.WriteFile(name, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := m.read(); string(out) != "new\n" {
+		t.Errorf("the rotated file must be read from the start, got %q", out)
+	}
+
+	if err := newMultiFile([]string{filepath.Join(t.TempDir(), "missing.log")}).start(); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestMultipleLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	errorLog := filepath.Join(dir, "error.log")
+	auditLog := filepath.Join(dir, "audit.log")
+	for _, name := range []string{errorLog, auditLog} {
+		if err := os.WriteFile(name, []byte("[id \"911100\"]\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := config.NewConfigFromString("logfile: " + errorLog + "\nlogfiles: [" + auditLog + "]\n")
+	if err != nil {
+		t.Error(err)
+	}
+	ll := NewFTWLogLines(cfg, WithLogFile(errorLog))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if _, ok := ll.spooler.(*multiFile); !ok || ll.CanWatch() {
+		t.Fatalf("unexpected log source %+v", ll.spooler)
+	}
+
+	appendLog := func(name string, lines ...string) {
+		f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	rules := strings.Split(rulesLogLines, "\n")
+
+	// the marker is only written to the error log, and the audit log is copied after it
+	appendLog(errorLog, startMarkerLine)
+	appendLog(auditLog, "audit log of the marker request")
+	ll.StartMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.StartMarker, bytes.ToLower([]byte(startMarkerLine))) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	if marker := ll.CheckLogForMarker(stageID); marker != nil {
+		t.Errorf("the start marker must only be found once, got %q", marker)
+	}
+
+	appendLog(errorLog, rules[:2]...)
+	appendLog(auditLog, rules[2:]...)
+	appendLog(errorLog, endMarkerLine)
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 942100, 949110}) {
+		t.Errorf("rules of both files expected, got %v", ids)
+	}
+}
@@ -0,0 +1,141 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// naxsiFormatPrefix starts the summary NAXSI writes to the nginx error log for every request
+// matching its rules
+const naxsiFormatPrefix = "NAXSI_FMT: "
+
+// naxsiIndexedFieldRegex matches the fields of the NAXSI summary numbered after the score or the
+// rule they belong to, e.g. `cscore0` or `var_name1`
+var naxsiIndexedFieldRegex = regexp.MustCompile(`^([a-z_]+?)(\d+)$`)
+
+// naxsiIndexed are the fields of the NAXSI summary with the same number: the category and the
+// value of a score, and the rule matching the request. Scores and rules are numbered separately.
+type naxsiIndexed struct {
+	category string
+	score    string
+	id       string
+	zone     string
+	varName  string
+}
+
+// naxsiLines returns the lines matched against the expected output for a line of the nginx error
+// log with NAXSI: the line itself and, for the `NAXSI_FMT` summaries like
+//
+//	2023/05/03 12:34:56 [error] 76#76: *1 NAXSI_FMT: ip=172.18.0.1&server=localhost&uri=/&config=block&cscore0=$SQL&score0=8&zone0=ARGS&id0=1001&var_name0=q, client: 172.18.0.1, server: localhost, request: "GET /?q=%22 HTTP/1.1", host: "localhost"
+//
+// a line with the total score and the scores of the request, e.g.
+// `NAXSI: Total Score: 8 [config "block"] [score "$SQL:8"] [uri "/"]`, followed by every rule
+// matching the request like in the error log, e.g. `NAXSI: [id "1001"] [zone "ARGS"] [var_name "q"] [uri "/"]`.
+// The nginx context of the line is kept after them.
+func naxsiLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	start := bytes.Index(line, []byte(naxsiFormatPrefix))
+	if start < 0 {
+		return lines
+	}
+	summary := string(line[start+len(naxsiFormatPrefix):])
+	context := ""
+	if end := strings.Index(summary, ", client: "); end >= 0 {
+		summary, context = summary[:end], summary[end:]
+	}
+
+	fields := make(map[string]string)
+	indexed := make(map[int]*naxsiIndexed)
+	for _, pair := range strings.Split(summary, "&") {
+		name, value, _ := strings.Cut(pair, "=")
+		parts := naxsiIndexedFieldRegex.FindStringSubmatch(name)
+		if parts == nil {
+			fields[name] = value
+			continue
+		}
+		index, _ := strconv.Atoi(parts[2])
+		entry, ok := indexed[index]
+		if !ok {
+			entry = &naxsiIndexed{}
+			indexed[index] = entry
+		}
+		switch parts[1] {
+		case "cscore":
+			entry.category = value
+		case "score":
+			entry.score = value
+		case "id":
+			entry.id = value
+		case "zone":
+			entry.zone = value
+		case "var_name":
+			entry.varName = value
+		default:
+			fields[name] = value
+		}
+	}
+	indexes := make([]int, 0, len(indexed))
+	for index := range indexed {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var b strings.Builder
+	total := 0
+	for _, index := range indexes {
+		if score, err := strconv.Atoi(indexed[index].score); err == nil {
+			total += score
+		}
+	}
+	fmt.Fprintf(&b, "NAXSI: Total Score: %d", total)
+	writeField(&b, "config", fields["config"])
+	for _, index := range indexes {
+		if entry := indexed[index]; entry.category != "" {
+			writeField(&b, "score", entry.category+":"+entry.score)
+		}
+	}
+	writeField(&b, "uri", fields["uri"])
+	lines = append(lines, []byte(b.String()+context))
+
+	for _, index := range indexes {
+		entry := indexed[index]
+		if entry.id == "" {
+			continue
+		}
+		b.Reset()
+		b.WriteString("NAXSI:")
+		writeField(&b, "id", entry.id)
+		writeField(&b, "zone", entry.zone)
+		writeField(&b, "var_name", entry.varName)
+		writeField(&b, "uri", fields["uri"])
+		lines = append(lines, []byte(b.String()+context))
+	}
+	return lines
+}
+
+// naxsiRuleMatch reads a rule match from a line naxsiLines writes for a rule of the NAXSI summary.
+// The zone and the name of the variable matched are added to the nginx context of the line.
+func naxsiRuleMatch(line []byte) (RuleMatch, bool) {
+	if !bytes.HasPrefix(line, []byte("NAXSI: [id ")) {
+		return RuleMatch{}, false
+	}
+	match, ok := nginxRuleMatch(line)
+	if !ok {
+		return match, false
+	}
+	for _, field := range ruleMatchFieldRegex.FindAllSubmatch(line, -1) {
+		name := string(field[1])
+		if name != "zone" && name != "var_name" {
+			continue
+		}
+		if match.Context == nil {
+			match.Context = make(map[string]string)
+		}
+		match.Context[name] = strings.ReplaceAll(string(field[2]), `\"`, `"`)
+	}
+	return match, true
+}
@@ -0,0 +1,89 @@
+package waflog
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var naxsiLogLine = `2023/05/03 12:34:56 [error] 76#76: *1 NAXSI_FMT: ip=172.18.0.1&server=localhost&uri=/search&vers=1.3&total_processed=1&total_blocked=1&config=block&cscore0=$SQL&score0=8&cscore1=$XSS&score1=16&zone0=ARGS&id0=1001&var_name0=q&zone1=ARGS&id1=1302&var_name1=q&zone2=HEADERS&id2=1010&var_name2=user-agent, client: 172.18.0.1, server: localhost, request: "GET /search?q=%22%3C HTTP/1.1", host: "localhost"`
+
+func TestNaxsiLines(t *testing.T) {
+	lines := naxsiLines([]byte(naxsiLogLine))
+	expected := []string{
+		naxsiLogLine,
+		`NAXSI: Total Score: 24 [config "block"] [score "$SQL:8"] [score "$XSS:16"] [uri "/search"], client: 172.18.0.1, server: localhost, request: "GET /search?q=%22%3C HTTP/1.1", host: "localhost"`,
+		`NAXSI: [id "1001"] [zone "ARGS"] [var_name "q"] [uri "/search"], client: 172.18.0.1, server: localhost, request: "GET /search?q=%22%3C HTTP/1.1", host: "localhost"`,
+		`NAXSI: [id "1302"] [zone "ARGS"] [var_name "q"] [uri "/search"], client: 172.18.0.1, server: localhost, request: "GET /search?q=%22%3C HTTP/1.1", host: "localhost"`,
+		`NAXSI: [id "1010"] [zone "HEADERS"] [var_name "user-agent"] [uri "/search"], client: 172.18.0.1, server: localhost, request: "GET /search?q=%22%3C HTTP/1.1", host: "localhost"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	for i := range expected {
+		if string(lines[i]) != expected[i] {
+			t.Errorf("unexpected line %d: %s", i, lines[i])
+		}
+	}
+
+	other := `2023/05/03 12:34:56 [error] 76#76: *1 open() "/usr/share/nginx/html/favicon.ico" failed`
+	if lines := naxsiLines([]byte(other)); len(lines) != 1 {
+		t.Errorf("lines without NAXSI summary must be kept as they are, got %q", lines)
+	}
+}
+
+func TestNaxsiRuleMatch(t *testing.T) {
+	lines := naxsiLines([]byte(naxsiLogLine))
+
+	if _, ok := naxsiRuleMatch(lines[1]); ok {
+		t.Error("the line of the scores is not a rule match")
+	}
+	match, ok := naxsiRuleMatch(lines[4])
+	if !ok {
+		t.Fatal("rule match not found")
+	}
+	if match.ID != 1010 || match.URI != "/search" || match.Truncated {
+		t.Errorf("unexpected match %+v", match)
+	}
+	if match.Context["zone"] != "HEADERS" || match.Context["var_name"] != "user-agent" || match.Context["client"] != "172.18.0.1" {
+		t.Errorf("unexpected context %v", match.Context)
+	}
+}
+
+func TestNaxsiLog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: naxsi")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	// nginx writes the access log lines of the markers to the error log
+	markerLine := `X-CRS-Test: ` + stageID
+	filename, err := utils.CreateTempFileWithContent(strings.Join([]string{"start " + markerLine, naxsiLogLine, "end " + markerLine}, "\n")+"\n", "test-naxsi-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg, WithStartMarker([]byte(strings.ToLower("start "+markerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if ll.EndMarker == nil {
+		t.Fatal("marker not found")
+	}
+
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{1001, 1010, 1302}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	if inbound, _ := ll.AnomalyScores(); inbound != 24 {
+		t.Errorf("the inbound score must be the total of the scores, got %d", inbound)
+	}
+	if !ll.Contains(`\[id "1302"\] \[zone "ARGS"\]`) || !ll.Contains(`\[score "\$XSS:16"\]`) {
+		t.Error("the rules and the scores must be matched like error log fields")
+	}
+}
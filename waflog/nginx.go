@@ -0,0 +1,41 @@
+package waflog
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// nginxContextRegex matches the information nginx adds after the message of an error log line,
+// e.g. `, client: 172.23.0.1, server: localhost, request: "GET / HTTP/1.1", host: "localhost"`
+var nginxContextRegex = regexp.MustCompile(`, ([a-z_]+): ("(?:[^"\\]|\\.)*"|[^,]*)`)
+
+// nginxRuleMatch reads a rule match from a line of the nginx error log, like
+//
+//	2023/01/05 02:21:09 [error] 76#76: *1 [client 172.23.0.1] ModSecurity: Access denied with code 403 (phase 2). ... [id "949110"] ..., client: 172.23.0.1, server: localhost, request: "GET / HTTP/1.1", host: "localhost"
+//
+// nginx cuts error log lines at 2048 bytes, so the fields at the end of long messages (usually
+// tags) are lost. These matches are marked as truncated.
+func nginxRuleMatch(line []byte) (RuleMatch, bool) {
+	match, ok := parseRuleMatch(line)
+	if !ok {
+		return match, false
+	}
+
+	// the context comes after the last field of the message
+	if end := bytes.LastIndexByte(line, ']'); end >= 0 {
+		for _, field := range nginxContextRegex.FindAllSubmatch(line[end+1:], -1) {
+			if match.Context == nil {
+				match.Context = make(map[string]string)
+			}
+			match.Context[string(field[1])] = strings.ReplaceAll(strings.Trim(string(field[2]), `"`), `\"`, `"`)
+		}
+	}
+	if _, found := match.Context["client"]; !found {
+		match.Truncated = true
+		log.Debug().Msgf("ftw/waflog: nginx truncated the log line of rule %d, fields at the end may be missing", match.ID)
+	}
+	return match, true
+}
@@ -0,0 +1,85 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var nginxLogLines = `2023/01/05 02:21:09 [info] 76#76: *1 [client 172.23.0.1] ModSecurity: Warning. Matched "Operator ` + "`DetectSQLi'" + ` with parameter ` + "`'" + ` against variable ` + "`ARGS:id'" + ` (Value: ` + "`1' or 1=1'" + ` ) [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "45"] [id "942100"] [rev ""] [msg "SQL Injection Attack Detected via libinjection"] [data "Matched Data: s&1c found within ARGS:id: 1' or 1=1"] [severity "2"] [ver "OWASP_CRS/3.3.2"] [maturity "0"] [accuracy "0"] [tag "attack-sqli"] [tag "paranoia-level/1"] [hostname "172.23.0.2"] [uri "/"] [unique_id "167289966933.592034"] [ref "v8,9"], client: 172.23.0.1, server: localhost, request: "GET /?id=1%27%20or%201=1 HTTP/1.1", host: "localhost"
+2023/01/05 02:21:09 [error] 76#76: *1 [client 172.23.0.1] ModSecurity: Access denied with code 403 (phase 2). Matched "Operator ` + "`Ge'" + ` with parameter ` + "`5'" + ` against variable ` + "`TX:ANOMALY_SCORE'" + ` (Value: ` + "`5'" + ` ) [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-949-BLOCKING-EVALUATION.conf"] [line "80"] [id "949110"] [rev ""] [msg "Inbound Anomaly Score Exceeded (Total Score: 5)"] [data ""] [severity "2"] [ver "OWASP_CRS/3.3.2"] [maturity "0"] [accuracy "0"] [tag "application-multi"] [tag "langu`
+
+func TestNginxRuleMatch(t *testing.T) {
+	lines := strings.Split(nginxLogLines, "\n")
+
+	match, ok := nginxRuleMatch([]byte(lines[0]))
+	if !ok {
+		t.Fatal("rule match not found")
+	}
+	if match.ID != 942100 || match.Severity != "2" || match.Truncated {
+		t.Errorf("unexpected match %+v", match)
+	}
+	if !reflect.DeepEqual(match.Tags, []string{"attack-sqli", "paranoia-level/1"}) {
+		t.Errorf("unexpected tags %v", match.Tags)
+	}
+	expected := map[string]string{
+		"client":  "172.23.0.1",
+		"server":  "localhost",
+		"request": "GET /?id=1%27%20or%201=1 HTTP/1.1",
+		"host":    "localhost",
+	}
+	if !reflect.DeepEqual(match.Context, expected) {
+		t.Errorf("unexpected context %v", match.Context)
+	}
+
+	match, ok = nginxRuleMatch([]byte(lines[1]))
+	if !ok {
+		t.Fatal("rule match not found in truncated line")
+	}
+	if match.ID != 949110 || !match.Truncated || !reflect.DeepEqual(match.Tags, []string{"application-multi"}) {
+		t.Errorf("unexpected match %+v", match)
+	}
+}
+
+func TestNginxLog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: nginx")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := `2023/01/05 02:21:09 [info] 76#76: *1 [client 172.23.0.1] ModSecurity: Warning. Matched "Operator ` + "`Rx'" + ` with parameter ` + "`^.*$'" + ` against variable ` + "`REQUEST_HEADERS:X-CRS-Test'" + ` [id "999999"] [msg "X-CRS-Test ` + stageID + `"], client: 172.23.0.1, server: localhost, request: "GET /status/200 HTTP/1.1", host: "localhost"`
+	endMarkerLine := strings.Replace(startMarkerLine, "*1", "*3", 1)
+	filename, err := utils.CreateTempFileWithContent(startMarkerLine+"\n"+nginxLogLines+"\n"+endMarkerLine+"\n", "test-nginx-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg, WithStartMarker(bytes.ToLower([]byte(startMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("marker not found, got %q", ll.EndMarker)
+	}
+
+	matches := ll.RuleMatches()
+	if len(matches) != 2 || matches[0].ID != 942100 || matches[1].ID != 949110 {
+		t.Fatalf("unexpected rule matches %+v", matches)
+	}
+	if matches[0].Context["request"] != "GET /?id=1%27%20or%201=1 HTTP/1.1" || !matches[1].Truncated {
+		t.Errorf("nginx fields were not parsed: %+v", matches)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	if !ll.Contains(`id "942100"`) {
+		t.Error("lines must be matched as they are")
+	}
+}
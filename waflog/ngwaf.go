@@ -0,0 +1,186 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ngwafIngestionDelay is how long the requests can take to show up in the Fastly Next-Gen WAF
+// API. Requests with a timestamp this old are queried again, so late requests are not missed.
+var ngwafIngestionDelay = time.Minute
+
+// ngwafTag is a signal the agent tagged a request with
+type ngwafTag struct {
+	Type     string `json:"type"`
+	Location string `json:"location"`
+	Value    string `json:"value"`
+	Detector string `json:"detector"`
+}
+
+// ngwafRequest is a request in the Fastly Next-Gen WAF API
+type ngwafRequest struct {
+	ID                string     `json:"id"`
+	Timestamp         time.Time  `json:"timestamp"`
+	URI               string     `json:"uri"`
+	AgentResponseCode int        `json:"agentResponseCode"`
+	Tags              []ngwafTag `json:"tags"`
+}
+
+// ngwaf queries the requests of a site of the Fastly Next-Gen WAF. Only the requests tagged with
+// a signal are recorded.
+type ngwaf struct {
+	endpoint string
+	corp     string
+	site     string
+	email    string
+	token    string
+	interval time.Duration
+	client   *http.Client
+
+	since    time.Time
+	latest   time.Time
+	lastRead time.Time
+	seen     map[string]bool
+}
+
+func (n *ngwaf) start() error {
+	if n.corp == "" || n.site == "" {
+		return fmt.Errorf("ftw/waflog: the ngwaf corp and site are not set")
+	}
+	n.since = time.Now()
+	n.latest = n.since
+	n.seen = make(map[string]bool)
+	return nil
+}
+
+// requestsURL returns the URL of the requests of the site since the time
+func (n *ngwaf) requestsURL(since time.Time) string {
+	query := url.Values{}
+	query.Set("q", "from:"+strconv.FormatInt(since.Unix(), 10))
+	query.Set("limit", "1000")
+	return fmt.Sprintf("%s/corps/%s/sites/%s/requests?%s", strings.TrimSuffix(n.endpoint, "/"),
+		url.PathEscape(n.corp), url.PathEscape(n.site), query.Encode())
+}
+
+func (n *ngwaf) read() ([]byte, error) {
+	// the API has rate limits, and new requests take a while to show up
+	if wait := n.interval - time.Since(n.lastRead); wait > 0 {
+		time.Sleep(wait)
+	}
+	n.lastRead = time.Now()
+
+	since := n.latest.Add(-ngwafIngestionDelay)
+	if since.Before(n.since) {
+		since = n.since
+	}
+	req, err := http.NewRequest(http.MethodGet, n.requestsURL(since), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-user", n.email)
+	req.Header.Set("x-api-token", n.token)
+	log.Trace().Msgf("ftw/waflog: querying %s", req.URL)
+
+	client := n.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't query the ngwaf requests: %w", err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't read the ngwaf requests: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ftw/waflog: can't query the ngwaf requests: %s: %s", resp.Status, strings.TrimSpace(string(out)))
+	}
+
+	var result struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("ftw/waflog: bad response of the ngwaf API: %w", err)
+	}
+	type request struct {
+		ngwafRequest
+		line bytes.Buffer
+	}
+	requests := make([]request, len(result.Data))
+	for i, raw := range result.Data {
+		if err := json.Unmarshal(raw, &requests[i].ngwafRequest); err != nil {
+			return nil, fmt.Errorf("ftw/waflog: bad request in the response of the ngwaf API: %w", err)
+		}
+		// requests are written on a single line
+		if err := json.Compact(&requests[i].line, raw); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Timestamp.Before(requests[j].Timestamp)
+	})
+
+	var logs []byte
+	for i := range requests {
+		r := &requests[i]
+		// requests are queried again until they are older than the ingestion delay
+		if n.seen[r.ID] {
+			continue
+		}
+		n.seen[r.ID] = true
+		if r.Timestamp.After(n.latest) {
+			n.latest = r.Timestamp
+		}
+		logs = append(logs, r.line.Bytes()...)
+		logs = append(logs, '\n')
+	}
+	return logs, nil
+}
+
+// ngwafLines returns the lines matched against the expected output for a request of the Fastly
+// Next-Gen WAF: the request itself, followed by every signal it was tagged with like in the error
+// log, e.g. `Fastly NGWAF: Blocked. [signal "SQLI"] [location "QUERYSTRING"] [agent_response "406"]`.
+// Requests are blocked when the agent answered anything but 200.
+func ngwafLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var r ngwafRequest
+	if err := json.Unmarshal(trimmed, &r); err != nil {
+		return lines
+	}
+	decision := "Allowed"
+	if r.AgentResponseCode != 0 && r.AgentResponseCode != http.StatusOK {
+		decision = "Blocked"
+	}
+	for _, tag := range r.Tags {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Fastly NGWAF: %s.", decision)
+		writeField(&b, "signal", tag.Type)
+		writeField(&b, "location", tag.Location)
+		writeField(&b, "data", tag.Value)
+		writeField(&b, "detector", tag.Detector)
+		if r.AgentResponseCode != 0 {
+			writeField(&b, "agent_response", strconv.Itoa(r.AgentResponseCode))
+		}
+		writeField(&b, "uri", r.URI)
+		writeField(&b, "unique_id", r.ID)
+		lines = append(lines, []byte(b.String()))
+	}
+	return lines
+}
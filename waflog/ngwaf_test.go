@@ -0,0 +1,112 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestNGWAFRequestsURL(t *testing.T) {
+	n := &ngwaf{endpoint: "https://dashboard.signalsciences.net/api/v0/", corp: "acme", site: "www"}
+	expected := "https://dashboard.signalsciences.net/api/v0/corps/acme/sites/www/requests?limit=1000&q=from%3A1672531200"
+	if u := n.requestsURL(time.Unix(1672531200, 0)); u != expected {
+		t.Errorf("unexpected URL %s", u)
+	}
+}
+
+func TestNGWAF(t *testing.T) {
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	now := time.Now().UTC()
+	request := func(id string, ms int, uri string, agentResponse int, tags string) string {
+		return fmt.Sprintf(`{"id":%q,"timestamp":%q,"uri":%q,"agentResponseCode":%d,"headersIn":[["X-CRS-Test",%q]],"tags":%s}`,
+			id, now.Add(time.Duration(ms)*time.Millisecond).Format(time.RFC3339Nano), uri, agentResponse, stageID+" "+id, tags)
+	}
+	marker := `[{"type":"site.ftw-marker","location":"REQUEST_HEADERS","value":"X-CRS-Test"}]`
+	responses := []string{
+		"[" + request("start", 0, "/status/200", 200, marker) + "]",
+		// the start marker is returned again, and requests are sorted by timestamp
+		"[" + request("end", 10, "/status/200", 200, marker) + "," + request("start", 0, "/status/200", 200, marker) + "," +
+			request("a1", 1, "/?id=1%27%20or%201=1", 406, `[{"type":"SQLI","location":"QUERYSTRING","value":"id=1' or 1=1","detector":"SQLiRule"}]`) + "]",
+	}
+	var queries int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-user") != "ftw@example.com" || r.Header.Get("x-api-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/corps/acme/sites/www/requests" || !strings.HasPrefix(r.URL.Query().Get("q"), "from:") {
+			t.Errorf("unexpected query %s", r.URL)
+		}
+		n := atomic.AddInt32(&queries, 1)
+		data := "[]"
+		if int(n) <= len(responses) {
+			data = responses[n-1]
+		}
+		fmt.Fprintf(w, `{"totalCount":1,"next":{"uri":""},"data":%s}`, data)
+	}))
+	t.Cleanup(api.Close)
+
+	cfg, err := config.NewConfigFromString(fmt.Sprintf("logsource: ngwaf\nngwaf:\n  corp: acme\n  site: www\n  email: ftw@example.com\n  token: token\n  endpoint: %s\n  pollinterval: 1ms\n", api.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if ll.Format != config.NGWAFLogFormat {
+		t.Errorf("unexpected default log format %s", ll.Format)
+	}
+
+	ll.StartMarker = ll.CheckLogForMarker(stageID + " start")
+	if !bytes.Contains(ll.StartMarker, []byte(`"id":"start"`)) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	ll.EndMarker = ll.CheckLogForMarker(stageID + " end")
+	if !bytes.Contains(ll.EndMarker, []byte(`"id":"end"`)) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if !ll.Contains(`Fastly NGWAF: Blocked\. \[signal "SQLI"\]`) || ll.Contains(`signal "XSS"`) {
+		t.Errorf("unexpected logs %q", ll.getMatchedLines())
+	}
+	if queries != 2 {
+		t.Errorf("expected 2 queries, got %d", queries)
+	}
+
+	// errors of the API are reported
+	n := &ngwaf{endpoint: api.URL, corp: "acme", site: "www", email: "ftw@example.com", token: "bad"}
+	if err := n.start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.read(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected the error of the API, got %v", err)
+	}
+}
+
+func TestNGWAFLines(t *testing.T) {
+	line := `{"id":"a1","uri":"/?q=<script>","agentResponseCode":200,"tags":[{"type":"XSS","location":"QUERYSTRING","value":"q=<script>","detector":"XSSRule"},{"type":"site.watch","location":"","value":""}]}`
+	expected := []string{
+		line,
+		`Fastly NGWAF: Allowed. [signal "XSS"] [location "QUERYSTRING"] [data "q=<script>"] [detector "XSSRule"] [agent_response "200"] [uri "/?q=<script>"] [unique_id "a1"]`,
+		`Fastly NGWAF: Allowed. [signal "site.watch"] [agent_response "200"] [uri "/?q=<script>"] [unique_id "a1"]`,
+	}
+	var lines []string
+	for _, l := range ngwafLines([]byte(line)) {
+		lines = append(lines, string(l))
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("unexpected lines %q", lines)
+	}
+
+	for _, line := range []string{"", "not json", `{"id":"a2","tags":[]}`} {
+		if lines := ngwafLines([]byte(line)); len(lines) != 1 {
+			t.Errorf("%q: line must be kept as it is, got %q", line, lines)
+		}
+	}
+}
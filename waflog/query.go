@@ -0,0 +1,66 @@
+package waflog
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+// requestQuerier queries the logs of a request by its ID, for the sources that don't log the
+// marker requests, like the firewall events of Cloudflare that only have the requests matching
+// a rule
+type requestQuerier interface {
+	// requestID returns the ID of the request in the headers of its response, or an empty string
+	requestID(header http.Header) string
+	// query returns the logs of the request sent between since and until, one entry per line
+	query(id string, since time.Time, until time.Time) ([][]byte, error)
+}
+
+// newRequestQuerier returns the querier for the log source, or nil if the logs are found with
+// the markers
+func newRequestQuerier(source config.LogSource, c *config.FTWConfiguration) requestQuerier {
+	if source != config.CloudflareLogSource {
+		return nil
+	}
+	return &cloudflare{
+		endpoint: c.Cloudflare.Endpoint,
+		zoneID:   c.Cloudflare.ZoneID,
+		token:    c.Cloudflare.APIToken,
+		interval: c.Cloudflare.PollInterval,
+		timeout:  c.Cloudflare.Timeout,
+	}
+}
+
+// QueriesRequests returns true when the logs of each request are queried by its ID instead of
+// being found between the markers
+func (ll *FTWLogLines) QueriesRequests() bool {
+	return ll.querier != nil && ll.readsLogs()
+}
+
+// RequestID returns the ID of the request answered with the response headers, used to query its
+// logs. It's empty when the response doesn't have one, e.g. when it didn't go through the WAF.
+func (ll *FTWLogLines) RequestID(header http.Header) string {
+	if ll.querier == nil {
+		return ""
+	}
+	return ll.querier.requestID(header)
+}
+
+// QueryRequest returns the logs of the request with the ID, sent between since and until
+func (ll *FTWLogLines) QueryRequest(id string, since time.Time, until time.Time) ([][]byte, error) {
+	if ll.querier == nil {
+		return nil, fmt.Errorf("ftw/waflog: the logs of the %s log source can't be queried by request", ll.Source)
+	}
+	return ll.querier.query(id, since, until)
+}
+
+// SetRequestLines sets the logs of the requests of a stage, used instead of the logs between the
+// markers
+func (ll *FTWLogLines) SetRequestLines(lines [][]byte) {
+	if lines == nil {
+		lines = [][]byte{}
+	}
+	ll.RequestLines = lines
+}
@@ -2,6 +2,7 @@ package waflog
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"regexp"
@@ -15,7 +16,7 @@ import (
 // Contains looks in logfile for regex
 func (ll *FTWLogLines) Contains(match string) bool {
 	// this should be a flag
-	lines := ll.getMarkedLines()
+	lines := ll.getMatchedLines()
 	log.Trace().Msgf("ftw/waflog: got %d lines", len(lines))
 
 	result := false
@@ -34,9 +35,151 @@ func (ll *FTWLogLines) Contains(match string) bool {
 	return result
 }
 
+// Capture returns the values of the named capture groups of the regex, from the first line of
+// the logs that matches it
+func (ll *FTWLogLines) Capture(match string) map[string]string {
+	re, err := regexp.Compile(match)
+	if err != nil {
+		log.Fatal().Msgf("ftw/waflog: bad regexp %s", err.Error())
+	}
+	if re.NumSubexp() == 0 {
+		return nil
+	}
+	lines := ll.getMatchedLines()
+	// lines are read backwards
+	for i := len(lines) - 1; i >= 0; i-- {
+		found := re.FindSubmatch(lines[i])
+		if found == nil {
+			continue
+		}
+		var captures map[string]string
+		for n, name := range re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			if captures == nil {
+				captures = map[string]string{}
+			}
+			captures[name] = string(found[n])
+		}
+		return captures
+	}
+	return nil
+}
+
+// CountMatches returns the number of times the regex matches the logs
+func (ll *FTWLogLines) CountMatches(match string) int {
+	re, err := regexp.Compile(match)
+	if err != nil {
+		log.Fatal().Msgf("ftw/waflog: bad regexp %s", err.Error())
+	}
+	count := 0
+	for _, line := range ll.getMatchedLines() {
+		count += len(re.FindAllIndex(line, -1))
+	}
+	log.Trace().Msgf("ftw/waflog: found %s %d times", match, count)
+	return count
+}
+
+// HasWindow returns true when the logs of a stage can be told apart from the rest, either by the
+// markers, by the time window, or because they were queried for its requests
+func (ll *FTWLogLines) HasWindow() bool {
+	return ll.RequestLines != nil || (ll.StartMarker != nil && ll.EndMarker != nil) || ll.inTimeWindow()
+}
+
+// Excerpt returns the log entries between the markers, in the order they were logged and without
+// empty lines, so they can be shown when a test fails. It's empty if the markers were not found,
+// e.g. in cloud mode.
+func (ll *FTWLogLines) Excerpt() []string {
+	if !ll.HasWindow() {
+		return nil
+	}
+	entries := ll.getEntries()
+	excerpt := make([]string, 0, len(entries))
+	// entries are read backwards
+	for i := len(entries) - 1; i >= 0; i-- {
+		if len(bytes.TrimSpace(entries[i])) > 0 {
+			excerpt = append(excerpt, string(entries[i]))
+		}
+	}
+	return excerpt
+}
+
+// lineParsers return the lines that the expected output is matched against for a line of the log,
+// for the log formats that are not read as they are
+var lineParsers = map[config.LogFormat]func([]byte) [][]byte{
+	config.JSONLogFormat:       jsonAuditLines,
+	config.CorazaLogFormat:     corazaErrorLines,
+	config.EnvoyLogFormat:      corazaErrorLines,
+	config.TraefikLogFormat:    corazaErrorLines,
+	config.NaxsiLogFormat:      naxsiLines,
+	config.CorazaSPOALogFormat: spoaLines,
+	config.CorazaJSONLogFormat: corazaAuditLines,
+	config.AWSWAFLogFormat:     awsWAFLines,
+	config.CloudflareLogFormat: cloudflareLines,
+	config.AzureWAFLogFormat:   azureWAFLines,
+	config.CloudArmorLogFormat: cloudArmorLines,
+	config.NGWAFLogFormat:      ngwafLines,
+}
+
+// getMatchedLines returns the lines between the markers that the expected output is matched
+// against. For JSON logs, rule matches are added as error log lines.
+func (ll *FTWLogLines) getMatchedLines() [][]byte {
+	lines := ll.getEntries()
+	if _, ok := lineParsers[ll.Format]; !ok {
+		return lines
+	}
+
+	var matched [][]byte
+	for _, line := range lines {
+		matched = append(matched, ll.expandLine(line)...)
+	}
+	return matched
+}
+
+// expandLine returns the lines that the expected output is matched against for a line of the log
+func (ll *FTWLogLines) expandLine(line []byte) [][]byte {
+	if parse, ok := lineParsers[ll.Format]; ok {
+		return parse(line)
+	}
+	return [][]byte{line}
+}
+
+// entryJoiners join the lines of the log formats where an entry can span several lines
+var entryJoiners = map[config.LogFormat]func([][]byte) [][]byte{
+	config.ApacheLogFormat: apacheEntries,
+	config.AuditLogFormat:  nativeAuditLines,
+	config.EnvoyLogFormat:  envoyEntries,
+}
+
+// markerLookbacks are the number of lines at the end of the log searched for a marker, for the
+// formats where the servers write the lines of concurrent requests at the same time
+var markerLookbacks = map[config.LogFormat]int{
+	config.EnvoyLogFormat:      envoyMarkerLookback,
+	config.CorazaSPOALogFormat: spoaMarkerLookback,
+	config.TraefikLogFormat:    traefikMarkerLookback,
+}
+
+// getEntries returns the entries of the log between the markers, in reverse order
+func (ll *FTWLogLines) getEntries() [][]byte {
+	lines := ll.getMarkedLines()
+	if join, ok := entryJoiners[ll.Format]; ok {
+		return join(lines)
+	}
+	return lines
+}
+
 func (ll *FTWLogLines) getMarkedLines() [][]byte {
 	var found [][]byte
 
+	if ll.RequestLines != nil {
+		// lines are returned backwards, like when reading the log file
+		for i := len(ll.RequestLines) - 1; i >= 0; i-- {
+			found = append(found, ll.RequestLines[i])
+		}
+		return found
+	}
+
 	if err := ll.openLogFile(); err != nil {
 		log.Error().Caller().Msgf("cannot open log file: %s", err)
 	}
@@ -47,34 +190,48 @@ func (ll *FTWLogLines) getMarkedLines() [][]byte {
 		return found
 	}
 
-	// Lines in modsec logging can be quite large
-	backscannerOptions := &backscanner.Options{
-		ChunkSize: 4096,
-	}
-	scanner := backscanner.NewOptions(ll.logFile, int(fi.Size()), backscannerOptions)
-	endFound := false
-	// end marker is the *first* marker when reading backwards,
-	// start marker is the *last* marker
-	for {
+	scanner := ll.newBackScanner(fi.Size())
+	nextLine := func() ([]byte, bool) {
 		line, _, err := scanner.LineBytes()
 		if err != nil {
 			if err != io.EOF {
 				log.Trace().Err(err)
 			}
+			return nil, false
+		}
+		saneCopy := make([]byte, len(line))
+		copy(saneCopy, line)
+		return saneCopy, true
+	}
+	if ll.inTimeWindow() {
+		return ll.getTimeWindowLines(nextLine)
+	}
+
+	endFound := false
+	// end marker is the *first* marker when reading backwards,
+	// start marker is the *last* marker
+	for {
+		line, ok := nextLine()
+		if !ok {
 			break
 		}
 		lineLower := bytes.ToLower(line)
 		if !endFound && bytes.Equal(lineLower, ll.EndMarker) {
 			endFound = true
+			if ll.Format == config.AuditLogFormat {
+				// the end marker is in the transaction of the marker request, not at its end
+				found = nil
+			}
+			if _, ok := markerLookbacks[ll.Format]; ok {
+				// the lines written after the end marker are the ones of the next requests
+				found = nil
+			}
 			continue
 		}
 		if endFound && bytes.Equal(lineLower, ll.StartMarker) {
 			break
 		}
-
-		saneCopy := make([]byte, len(line))
-		copy(saneCopy, line)
-		found = append(found, saneCopy)
+		found = append(found, line)
 	}
 	return found
 }
@@ -83,22 +240,33 @@ func (ll *FTWLogLines) getMarkedLines() [][]byte {
 // logFile is the file to search
 // stageID is the ID of the current stage, which is part of the marker line
 func (ll *FTWLogLines) CheckLogForMarker(stageID string) []byte {
-	if config.FTWConfig.RunMode == config.DefaultRunMode && ll.logFile == nil {
+	if ll.readsLogs() && ll.logFile == nil {
 		log.Fatal().Caller().Msg("No log file supplied")
 	}
+	isMarker := ll.markerMatcher(stageID)
+	if ll.spooler != nil {
+		// logs from several sources can be copied at once, so the marker is not always the last line
+		spooled, err := ll.syncSpool()
+		if err != nil {
+			log.Error().Caller().Err(err).Msgf("failed to copy the logs")
+			return nil
+		}
+		lines := bytes.Split(spooled, []byte("\n"))
+		for i := len(lines) - 1; i >= 0; i-- {
+			line := bytes.ToLower(lines[i])
+			if isMarker(line) {
+				return line
+			}
+		}
+		return nil
+	}
 	offset, err := ll.logFile.Seek(0, os.SEEK_END)
 	if err != nil {
 		log.Error().Caller().Err(err).Msgf("failed to seek end of log file")
 		return nil
 	}
 
-	// Lines in modsec logging can be quite large
-	backscannerOptions := &backscanner.Options{
-		ChunkSize: 4096,
-	}
-	scanner := backscanner.NewOptions(ll.logFile, int(offset), backscannerOptions)
-	stageIDBytes := []byte(stageID)
-	crsHeaderBytes := bytes.ToLower([]byte(config.FTWConfig.LogMarkerHeaderName))
+	scanner := ll.newBackScanner(offset)
 
 	line := []byte{}
 	// find the last non-empty line
@@ -112,9 +280,65 @@ func (ll *FTWLogLines) CheckLogForMarker(stageID string) []byte {
 		log.Trace().Err(err)
 	}
 	line = bytes.ToLower(line)
-	if bytes.Contains(line, crsHeaderBytes) && bytes.Contains(line, stageIDBytes) {
+	if isMarker(line) {
 		return line
 	}
+	if lookback, ok := markerLookbacks[ll.Format]; ok {
+		for i := 1; i < lookback; i++ {
+			line, _, err = scanner.LineBytes()
+			if err != nil {
+				return nil
+			}
+			line = bytes.ToLower(line)
+			if isMarker(line) {
+				return line
+			}
+		}
+		return nil
+	}
+	if ll.Format != config.AuditLogFormat {
+		return nil
+	}
 
+	// the marker is in the parts of the last transaction of the native audit log, which ends with part Z
+	for {
+		line, _, err = scanner.LineBytes()
+		if err != nil || isAuditBoundary(line, "A") {
+			return nil
+		}
+		line = bytes.ToLower(line)
+		if isMarker(line) {
+			return line
+		}
+	}
+}
+
+// newBackScanner returns a scanner that reads the log file backwards, from end to the checkpoint
+func (ll *FTWLogLines) newBackScanner(end int64) *backscanner.Scanner {
+	start := ll.StartOffset
+	// the log was rotated or truncated after the checkpoint
+	if start > end {
+		start = 0
+	}
+	// Lines in modsec logging can be quite large
+	backscannerOptions := &backscanner.Options{
+		ChunkSize: 4096,
+	}
+	return backscanner.NewOptions(io.NewSectionReader(ll.logFile, start, end-start), int(end-start), backscannerOptions)
+}
+
+// Checkpoint records the current size of the log file, so the logs written before, like the
+// ones of previous runs, are not read anymore when looking for markers and matches
+func (ll *FTWLogLines) Checkpoint() error {
+	if ll.spooler != nil || ll.logFile == nil {
+		// spooled logs only contain the logs written after the start
+		return nil
+	}
+	fi, err := ll.logFile.Stat()
+	if err != nil {
+		return fmt.Errorf("ftw/waflog: cannot read the size of %s: %w", ll.FileName, err)
+	}
+	ll.StartOffset = fi.Size()
+	log.Debug().Msgf("ftw/waflog: reading %s from offset %d", ll.FileName, ll.StartOffset)
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -12,7 +13,8 @@ import (
 )
 
 func TestReadCheckLogForMarkerNoMarkerAtEnd(t *testing.T) {
-	if err := config.NewConfigFromEnv(); err != nil {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
 		t.Error(err)
 	}
 
@@ -28,10 +30,10 @@ func TestReadCheckLogForMarkerNoMarkerAtEnd(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	config.FTWConfig.LogFile = filename
+	cfg.LogFile = filename
 	t.Cleanup(func() { os.Remove(filename) })
 
-	ll := NewFTWLogLines(WithStartMarker(bytes.ToLower([]byte(markerLine))))
+	ll := NewFTWLogLines(cfg, WithStartMarker(bytes.ToLower([]byte(markerLine))))
 
 	marker := ll.CheckLogForMarker(stageID)
 	if marker != nil {
@@ -40,7 +42,8 @@ func TestReadCheckLogForMarkerNoMarkerAtEnd(t *testing.T) {
 }
 
 func TestReadCheckLogForMarkerWithMarkerAtEnd(t *testing.T) {
-	if err := config.NewConfigFromEnv(); err != nil {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
 		t.Error(err)
 	}
 
@@ -55,10 +58,10 @@ func TestReadCheckLogForMarkerWithMarkerAtEnd(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	config.FTWConfig.LogFile = filename
+	cfg.LogFile = filename
 	t.Cleanup(func() { os.Remove(filename) })
 
-	ll := NewFTWLogLines(WithStartMarker(bytes.ToLower([]byte(markerLine))))
+	ll := NewFTWLogLines(cfg, WithStartMarker(bytes.ToLower([]byte(markerLine))))
 
 	marker := ll.CheckLogForMarker(stageID)
 	if marker == nil {
@@ -70,6 +73,11 @@ func TestReadCheckLogForMarkerWithMarkerAtEnd(t *testing.T) {
 }
 
 func TestReadGetMarkedLines(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
 	stageID := "dead-beaf-deadbeef-deadbeef-dead"
 	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
 	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
@@ -82,10 +90,10 @@ func TestReadGetMarkedLines(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	config.FTWConfig.LogFile = filename
+	cfg.LogFile = filename
 	t.Cleanup(func() { os.Remove(filename) })
 
-	ll := NewFTWLogLines(
+	ll := NewFTWLogLines(cfg,
 		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
 		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
 
@@ -107,6 +115,11 @@ func TestReadGetMarkedLines(t *testing.T) {
 }
 
 func TestReadGetMarkedLinesWithTrailingEmptyLines(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
 	stageID := "dead-beaf-deadbeef-deadbeef-dead"
 	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
 	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
@@ -119,10 +132,10 @@ func TestReadGetMarkedLinesWithTrailingEmptyLines(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	config.FTWConfig.LogFile = filename
+	cfg.LogFile = filename
 	t.Cleanup(func() { os.Remove(filename) })
 
-	ll := NewFTWLogLines(
+	ll := NewFTWLogLines(cfg,
 		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
 		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
 
@@ -144,6 +157,11 @@ func TestReadGetMarkedLinesWithTrailingEmptyLines(t *testing.T) {
 }
 
 func TestReadGetMarkedLinesWithPrecedingLines(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
 	stageID := "dead-beaf-deadbeef-deadbeef-dead"
 	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
 	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
@@ -159,10 +177,10 @@ func TestReadGetMarkedLinesWithPrecedingLines(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	config.FTWConfig.LogFile = filename
+	cfg.LogFile = filename
 	t.Cleanup(func() { os.Remove(filename) })
 
-	ll := NewFTWLogLines(
+	ll := NewFTWLogLines(cfg,
 		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
 		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
 
@@ -182,3 +200,119 @@ func TestReadGetMarkedLinesWithPrecedingLines(t *testing.T) {
 		}
 	}
 }
+
+func TestReadExcerpt(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	logLines := fmt.Sprintf("before\n%s\n%s\n\n%s\n", startMarkerLine, rulesLogLines, endMarkerLine)
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if excerpt := ll.Excerpt(); excerpt != nil {
+		t.Errorf("no excerpt expected without markers, got %d lines", len(excerpt))
+	}
+
+	ll.StartMarker = bytes.ToLower([]byte(startMarkerLine))
+	ll.EndMarker = bytes.ToLower([]byte(endMarkerLine))
+	if excerpt := ll.Excerpt(); !reflect.DeepEqual(excerpt, strings.Split(rulesLogLines, "\n")) {
+		t.Errorf("unexpected excerpt %q", excerpt)
+	}
+}
+
+func TestReadCheckpoint(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	// a previous run left a start marker without end marker in the log
+	filename, err := utils.CreateTempFileWithContent(startMarkerLine+"\nprevious run\n", "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg,
+		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
+		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if err := ll.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	appendLog := func(lines string) {
+		file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.WriteString(lines); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendLog("this run\n" + endMarkerLine + "\n")
+
+	if excerpt := ll.Excerpt(); !reflect.DeepEqual(excerpt, []string{"this run"}) {
+		t.Errorf("the logs before the checkpoint must not be read, got %q", excerpt)
+	}
+	if marker := ll.CheckLogForMarker(stageID); !bytes.Equal(marker, ll.EndMarker) {
+		t.Errorf("unexpected marker %q", marker)
+	}
+
+	// after the log was truncated, it's read from the start again
+	if err := os.Truncate(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLog("rotated\n" + endMarkerLine + "\n")
+	if excerpt := ll.Excerpt(); !reflect.DeepEqual(excerpt, []string{"rotated"}) {
+		t.Errorf("unexpected excerpt after truncation %q", excerpt)
+	}
+}
+
+func TestReadCapture(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	logLines := fmt.Sprintf("%s\n%s\n%s\n", startMarkerLine, rulesLogLines, endMarkerLine)
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg,
+		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
+		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	// the first line that matches is captured
+	captures := ll.Capture(`\[id "(?P<rule>\d+)"\].*\[unique_id "(?P<transaction>[^"]+)"\]`)
+	if !reflect.DeepEqual(captures, map[string]string{"rule": "942100", "transaction": "X-PNFSe1VwjCgYRI9FsbHgAAAIY"}) {
+		t.Errorf("unexpected captures %v", captures)
+	}
+	if captures := ll.Capture(`\[id "(\d+)"\]`); captures != nil {
+		t.Errorf("only named groups are captured, got %v", captures)
+	}
+	if captures := ll.Capture(`\[id "(?P<rule>941\d+)"\]`); captures != nil {
+		t.Errorf("nothing to capture, got %v", captures)
+	}
+}
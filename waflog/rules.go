@@ -0,0 +1,74 @@
+package waflog
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/test"
+)
+
+// Anomaly scores as logged by the CRS blocking evaluation and correlation rules, e.g.
+// `Inbound Anomaly Score Exceeded (Total Score: 5)`, or `Inbound Scores: blocking=5` in CRS 4.
+// The inbound score of NAXSI is the total of the scores of its summary.
+var (
+	inboundScoreRegex  = regexp.MustCompile(`(?:Inbound Anomaly Score Exceeded \(Total (?:Inbound )?Score: |Inbound Scores: blocking=|NAXSI: Total Score: )(\d+)`)
+	outboundScoreRegex = regexp.MustCompile(`(?:Outbound Anomaly Score Exceeded \(Total (?:Outbound )?Score: |Outbound Scores: blocking=)(\d+)`)
+)
+
+// TriggeredRules returns the sorted IDs of the rules found in the logs between the markers,
+// without duplicates
+func (ll *FTWLogLines) TriggeredRules() []int {
+	seen := make(map[int]bool)
+	var ids []int
+
+	for _, match := range ll.RuleMatches() {
+		if !seen[match.ID] {
+			seen[match.ID] = true
+			ids = append(ids, match.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// MaxSeverity returns the level of the highest severity of the rules found in the logs between
+// the markers, 0 being EMERGENCY, and false if no rule with a severity was found
+func (ll *FTWLogLines) MaxSeverity() (int, bool) {
+	highest, found := 0, false
+	for _, match := range ll.RuleMatches() {
+		if match.Severity == "" {
+			continue
+		}
+		level, err := test.ParseSeverity(match.Severity)
+		if err != nil {
+			log.Trace().Msgf("ftw/waflog: unknown severity %q of rule %d", match.Severity, match.ID)
+			continue
+		}
+		if !found || level < highest {
+			highest, found = level, true
+		}
+	}
+	return highest, found
+}
+
+// AnomalyScores returns the highest inbound and outbound anomaly scores found in the logs
+// between the markers. Scores are 0 when not logged.
+func (ll *FTWLogLines) AnomalyScores() (inbound int, outbound int) {
+	for _, line := range ll.getMatchedLines() {
+		inbound = maxScore(inboundScoreRegex, line, inbound)
+		outbound = maxScore(outboundScoreRegex, line, outbound)
+	}
+	return inbound, outbound
+}
+
+func maxScore(re *regexp.Regexp, line []byte, current int) int {
+	for _, match := range re.FindAllSubmatch(line, -1) {
+		if score, err := strconv.Atoi(string(match[1])); err == nil && score > current {
+			current = score
+		}
+	}
+	return current
+}
@@ -0,0 +1,124 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var rulesLogLines = `[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Pattern match "(?i:(?:[\\"'\\\\x60]\\\\s*?(?:or|and)))" at ARGS:id. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "1234"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"] [severity "CRITICAL"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+[Tue Jan 05 02:21:09.637731 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Match of "pm AppleWebKit Android" against "REQUEST_HEADERS:User-Agent" required. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-920-PROTOCOL-ENFORCEMENT.conf"] [line "1230"] [id "920300"] [msg "Request Missing an Accept Header"] [severity "NOTICE"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+[Tue Jan 05 02:21:09.637731 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Pattern match "(?i:(?:[\\"'\\\\x60]\\\\s*?(?:or|and)))" at ARGS:name. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-942-APPLICATION-ATTACK-SQLI.conf"] [line "1234"] [id "942100"] [msg "SQL Injection Attack Detected via libinjection"] [severity "CRITICAL"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+[Tue Jan 05 02:21:09.638572 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Operator GE matched 5 at TX:anomaly_score. [file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-949-BLOCKING-EVALUATION.conf"] [line "91"] [id "949110"] [msg "Inbound Anomaly Score Exceeded (Total Score: 10)"] [severity "CRITICAL"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]`
+
+func TestTriggeredRules(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+	// the rule before the start marker must not be reported
+	logLines := fmt.Sprintf("[id \"911100\"]\n%s\n%s\n%s", startMarkerLine, rulesLogLines, endMarkerLine)
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg,
+		WithStartMarker(bytes.ToLower([]byte(startMarkerLine))),
+		WithEndMarker(bytes.ToLower([]byte(endMarkerLine))))
+
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 942100, 949110}) {
+		t.Errorf("unexpected rule IDs %v", ids)
+	}
+}
+
+func TestAnomalyScores(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
+	logLines := rulesLogLines + `
+[Tue Jan 05 02:21:09.647668 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Operator GE matched 5 at TX:inbound_anomaly_score. [file "/etc/modsecurity.d/owasp-crs/rules/RESPONSE-980-CORRELATION.conf"] [line "87"] [id "980130"] [msg "Inbound Anomaly Score Exceeded (Total Inbound Score: 8 - SQLI=5,XSS=0,RFI=0,LFI=0,RCE=0,PHPI=0,HTTP=0,SESS=0): individual paranoia level scores: 8, 0, 0, 0"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+[Tue Jan 05 02:21:09.647668 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] [client 172.23.0.1] ModSecurity: Warning. Operator GE matched 4 at TX:blocking_outbound_anomaly_score. [file "/etc/modsecurity.d/owasp-crs/rules/RESPONSE-959-BLOCKING-EVALUATION.conf"] [line "126"] [id "959100"] [msg "Outbound Anomaly Score Exceeded (Total Score: 4)"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+`
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg)
+
+	inbound, outbound := ll.AnomalyScores()
+	if inbound != 10 || outbound != 4 {
+		t.Errorf("unexpected anomaly scores %d, %d", inbound, outbound)
+	}
+}
+
+func TestAnomalyScoresCRS4(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
+	logLines := `[Tue Jan 05 02:21:09.647668 2021] [:error] [pid 76:tid 139683434571520] [client 172.23.0.1:58998] ModSecurity: Warning. Unconditional match in SecAction. [file "/etc/modsecurity.d/owasp-crs/rules/RESPONSE-980-CORRELATION.conf"] [line "98"] [id "980170"] [msg "Anomaly Scores: (Inbound Scores: blocking=15, detection=15, per_pl=15-0-0-0, threshold=5) - (Outbound Scores: blocking=0, detection=0, per_pl=0-0-0-0, threshold=4) - (SQLI=15, XSS=0, RFI=0, LFI=0, RCE=0, PHPI=0, HTTP=0, SESS=0, COMBINED_SCORE=15)"] [hostname "localhost"] [uri "/"] [unique_id "X-PNFSe1VwjCgYRI9FsbHgAAAIY"]
+`
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg)
+
+	inbound, outbound := ll.AnomalyScores()
+	if inbound != 15 || outbound != 0 {
+		t.Errorf("unexpected anomaly scores %d, %d", inbound, outbound)
+	}
+}
+
+func TestMaxSeverity(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+
+	tests := []struct {
+		logLines string
+		level    int
+		found    bool
+	}{
+		{rulesLogLines, 2, true},
+		{`ModSecurity: Warning. [id "920300"] [severity "NOTICE"]` + "\n" + `ModSecurity: Warning. [id "920350"] [severity "warning"]`, 4, true},
+		// ModSecurity v3 writes the levels
+		{`ModSecurity: Warning. [id "942100"] [severity "2"]` + "\n" + `ModSecurity: Warning. [id "920350"] [severity "unknown"]`, 2, true},
+		{`ModSecurity: Warning. [id "949110"]`, 0, false},
+	}
+	for _, tt := range tests {
+		filename, err := utils.CreateTempFileWithContent(tt.logLines, "test-errorlog-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.LogFile = filename
+		ll := NewFTWLogLines(cfg)
+		if level, found := ll.MaxSeverity(); level != tt.level || found != tt.found {
+			t.Errorf("unexpected severity %d (%t) for %q", level, found, tt.logLines)
+		}
+		_ = ll.Cleanup()
+		os.Remove(filename)
+	}
+}
@@ -0,0 +1,124 @@
+package waflog
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// spoaMarkerLookback is the number of lines at the end of the Coraza SPOA log searched for a marker.
+// The agent handles the frames HAProxy sends in parallel, so the messages of the next requests
+// can be written before the marker.
+const spoaMarkerLookback = 20
+
+// spoaLevels are the names zerolog gives to the levels in JSON lines, with the ones of its
+// console layout
+var spoaLevels = map[string]string{
+	"trace": "TRC",
+	"debug": "DBG",
+	"info":  "INF",
+	"warn":  "WRN",
+	"error": "ERR",
+	"fatal": "FTL",
+	"panic": "PNC",
+}
+
+// spoaConsoleRegex matches the start of a line of the console layout of zerolog, with the time
+// when it is written, e.g. `2023-05-03T12:34:56Z WRN `
+var spoaConsoleRegex = regexp.MustCompile(`^(?:(\S+) )?(TRC|DBG|INF|WRN|ERR|FTL|PNC|\?\?\?) `)
+
+// spoaFieldRegex matches the fields zerolog writes after the message in its console layout,
+// e.g. `app=sample transaction_id="a b"`
+var spoaFieldRegex = regexp.MustCompile(`\s([\w.-]+)=("(?:[^"\\]|\\.)*"|\S*)`)
+
+// spoaLines returns the lines matched against the expected output for a line of the Coraza SPOA
+// log. JSON lines with a Coraza message are followed by the same line in the console layout,
+// so the messages are matched unescaped and rule matches are read the same way in both layouts.
+func spoaLines(line []byte) [][]byte {
+	lines := [][]byte{line}
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return lines
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return lines
+	}
+	message, ok := fields["message"].(string)
+	if !ok || !strings.Contains(message, "Coraza:") {
+		return lines
+	}
+
+	var console []string
+	if t, ok := fields["time"].(string); ok {
+		console = append(console, t)
+	}
+	level, _ := fields["level"].(string)
+	if short, ok := spoaLevels[level]; ok {
+		console = append(console, short)
+	} else {
+		console = append(console, "???")
+	}
+	console = append(console, message)
+
+	var names []string
+	for name := range fields {
+		if name != "time" && name != "level" && name != "message" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := fields[name].(string)
+		if !ok {
+			encoded, _ := json.Marshal(fields[name])
+			value = string(encoded)
+		}
+		if value == "" || strings.ContainsAny(value, " \"\\") {
+			value = strconv.Quote(value)
+		}
+		console = append(console, name+"="+value)
+	}
+	return append(lines, []byte(strings.Join(console, " ")))
+}
+
+// spoaRuleMatch reads a rule match from a line of the Coraza SPOA log in the console layout, like
+//
+//	2023-05-03T12:34:56Z WRN [client "172.18.0.1"] Coraza: Warning. ... [id "942100"] ... [unique_id "0a1b2c3d"] app=sample
+//
+// The time, the level and the fields written after the message are added to the context.
+// JSON lines are read from the line spoaLines adds after them.
+func spoaRuleMatch(line []byte) (RuleMatch, bool) {
+	console := spoaConsoleRegex.FindSubmatch(line)
+	if console == nil {
+		return RuleMatch{}, false
+	}
+	match, ok := parseRuleMatch(line)
+	if !ok {
+		return match, false
+	}
+
+	match.Context = map[string]string{}
+	if len(console[1]) > 0 {
+		match.Context["time"] = string(console[1])
+	}
+	for name, short := range spoaLevels {
+		if short == string(console[2]) {
+			match.Context["level"] = name
+		}
+	}
+	// the fields come after the last field of the message
+	end := bytes.LastIndex(line, []byte(`"]`))
+	for _, field := range spoaFieldRegex.FindAllSubmatch(line[end+2:], -1) {
+		value := string(field[2])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		match.Context[string(field[1])] = value
+	}
+	return match, true
+}
@@ -0,0 +1,113 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+var spoaLogLines = `{"level":"error","app":"sample_app","transaction_id":"0a1b2c3d","time":"2023-05-03T12:34:56Z","message":"[client \"172.18.0.1\"] Coraza: Warning. SQL Injection Attack Detected via libinjection [file \"@owasp_crs/REQUEST-942-APPLICATION-ATTACK-SQLI.conf\"] [line \"5547\"] [id \"942100\"] [msg \"SQL Injection Attack Detected via libinjection\"] [data \"Matched Data: s&1c found within ARGS:id: 1' or 1=1\"] [severity \"critical\"] [tag \"attack-sqli\"] [hostname \"172.18.0.3\"] [uri \"/?id=1%27%20or%201=1\"] [unique_id \"0a1b2c3d\"]"}
+{"level":"info","time":"2023-05-03T12:34:56Z","message":"unrelated message of the agent"}
+2023-05-03T12:34:57Z ERR [client "172.18.0.1"] Coraza: Access denied (phase 2). Inbound Anomaly Score Exceeded [id "949110"] [msg "Inbound Anomaly Score Exceeded (Total Score: 5)"] [severity "emergency"] [unique_id "0a1b2c3d"] app=sample_app transaction_id=0a1b2c3d`
+
+func TestSPOALines(t *testing.T) {
+	lines := strings.Split(spoaLogLines, "\n")
+
+	expanded := spoaLines([]byte(lines[0]))
+	if len(expanded) != 2 {
+		t.Fatalf("the line in the console layout must be added, got %q", expanded)
+	}
+	if !strings.HasPrefix(string(expanded[1]), `2023-05-03T12:34:56Z ERR [client "172.18.0.1"] Coraza: Warning.`) ||
+		!strings.HasSuffix(string(expanded[1]), `[unique_id "0a1b2c3d"] app=sample_app transaction_id=0a1b2c3d`) {
+		t.Errorf("unexpected console line %q", expanded[1])
+	}
+
+	for _, line := range lines[1:] {
+		if expanded := spoaLines([]byte(line)); len(expanded) != 1 {
+			t.Errorf("lines without Coraza message must be kept as they are, got %q", expanded)
+		}
+	}
+}
+
+func TestSPOARuleMatch(t *testing.T) {
+	lines := strings.Split(spoaLogLines, "\n")
+
+	if _, ok := spoaRuleMatch([]byte(lines[0])); ok {
+		t.Error("JSON lines are read from their console line")
+	}
+
+	match, ok := spoaRuleMatch(spoaLines([]byte(lines[0]))[1])
+	if !ok {
+		t.Fatal("rule match not found")
+	}
+	if match.ID != 942100 || match.Data != "Matched Data: s&1c found within ARGS:id: 1' or 1=1" || match.UniqueID != "0a1b2c3d" {
+		t.Errorf("unexpected match %+v", match)
+	}
+	expected := map[string]string{
+		"time":           "2023-05-03T12:34:56Z",
+		"level":          "error",
+		"app":            "sample_app",
+		"transaction_id": "0a1b2c3d",
+	}
+	if !reflect.DeepEqual(match.Context, expected) {
+		t.Errorf("unexpected context %v", match.Context)
+	}
+
+	match, ok = spoaRuleMatch([]byte(`WRN [id "920350"] [msg "Host header is a numeric IP address"] app="my app"`))
+	if !ok {
+		t.Fatal("rule match not found without time")
+	}
+	expected = map[string]string{"level": "warn", "app": "my app"}
+	if !reflect.DeepEqual(match.Context, expected) {
+		t.Errorf("unexpected context %v", match.Context)
+	}
+}
+
+func TestSPOALog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: coraza-spoa")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	// HAProxy sends the header names in lowercase to the agent
+	markerLine := func(id string) string {
+		return `{"level":"warn","app":"sample_app","time":"2023-05-03T12:34:55Z","message":"[client \"172.18.0.1\"] Coraza: Warning. [id \"999999\"] [msg \"` + stageID + `\"] [data \"Matched Data: ` + stageID + ` found within REQUEST_HEADERS:x-crs-test\"] [unique_id \"` + id + `\"]"}`
+	}
+	startMarkerLine := markerLine("start")
+	endMarkerLine := markerLine("end")
+	// the agent handles the next request before writing the end marker
+	after := `{"level":"warn","app":"sample_app","time":"2023-05-03T12:34:58Z","message":"[client \"172.18.0.1\"] Coraza: Warning. [id \"920350\"] [msg \"Host header is a numeric IP address\"] [unique_id \"other\"]"}`
+	filename, err := utils.CreateTempFileWithContent(startMarkerLine+"\n"+spoaLogLines+"\n"+endMarkerLine+"\n"+after+"\n", "test-spoa-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg, WithStartMarker(bytes.ToLower([]byte(startMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("marker not found, got %q", ll.EndMarker)
+	}
+
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	matches := ll.RuleMatches()
+	if len(matches) != 2 || matches[0].Context["app"] != "sample_app" || matches[1].Context["level"] != "error" {
+		t.Errorf("unexpected rule matches %+v", matches)
+	}
+	if !ll.Contains(`\[id "942100"\]`) || !ll.Contains(`\[id "949110"\]`) {
+		t.Error("JSON messages must be matched unescaped")
+	}
+	if ll.Contains(`920350`) {
+		t.Error("lines after the end marker must not be matched")
+	}
+}
@@ -0,0 +1,103 @@
+package waflog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+// spooler reads the logs from a source that is not a local file, like the systemd journal or
+// a file on a remote host. The logs are copied to a local spool file, so they can be read like
+// a log file. Logs are only copied when looking for a marker: once the end marker is found,
+// all the logs of the stage are in the spool file.
+type spooler interface {
+	// start is called when the spool file is created. Only logs written after it are copied.
+	start() error
+	// read returns the logs written since the last call
+	read() ([]byte, error)
+}
+
+// newSpooler returns the spooler for the log source, or nil if the logs are read from a file
+func newSpooler(source config.LogSource, c *config.FTWConfiguration) (spooler, error) {
+	switch {
+	case source == config.JournaldLogSource:
+		return &journal{unit: c.Journald.Unit, identifier: c.Journald.Identifier}, nil
+	case source == config.SyslogLogSource:
+		return &syslogListener{protocol: c.Syslog.Protocol, address: c.Syslog.Listen}, nil
+	case source == config.CloudWatchLogSource:
+		return &cloudWatch{
+			group:        c.CloudWatch.LogGroup,
+			streamPrefix: c.CloudWatch.StreamPrefix,
+			region:       c.CloudWatch.Region,
+			profile:      c.CloudWatch.Profile,
+			interval:     c.CloudWatch.PollInterval,
+		}, nil
+	case source == config.LogAnalyticsLogSource:
+		return &logAnalytics{
+			workspace: c.LogAnalytics.Workspace,
+			query:     c.LogAnalytics.Query,
+			interval:  c.LogAnalytics.PollInterval,
+		}, nil
+	case source == config.CloudLoggingLogSource:
+		return &cloudLogging{
+			project:  c.CloudLogging.Project,
+			filter:   c.CloudLogging.Filter,
+			interval: c.CloudLogging.PollInterval,
+		}, nil
+	case source == config.NGWAFLogSource:
+		return &ngwaf{
+			endpoint: c.NGWAF.Endpoint,
+			corp:     c.NGWAF.Corp,
+			site:     c.NGWAF.Site,
+			email:    c.NGWAF.Email,
+			token:    c.NGWAF.Token,
+			interval: c.NGWAF.PollInterval,
+		}, nil
+	case source == config.CloudflareLogSource:
+		// the logs are queried for each request instead
+		return nil, nil
+	case strings.HasPrefix(string(source), config.SSHLogSourceScheme):
+		return newSSHTail(string(source))
+	case source == "" || source == config.FileLogSource:
+		if len(c.LogFiles) == 0 {
+			return nil, nil
+		}
+		names := c.LogFiles
+		if c.LogFile != "" {
+			names = append([]string{c.LogFile}, names...)
+		}
+		return newMultiFile(names), nil
+	}
+	return nil, fmt.Errorf("unknown log source %q", source)
+}
+
+// openSpool creates the spool file
+func (ll *FTWLogLines) openSpool() error {
+	spool, err := os.CreateTemp("", "ftw-spool-*.log")
+	if err != nil {
+		return err
+	}
+	ll.logFile = spool
+	ll.FileName = spool.Name()
+	return ll.spooler.start()
+}
+
+// syncSpool appends the new logs of the source to the spool file, and returns them
+func (ll *FTWLogLines) syncSpool() ([]byte, error) {
+	if ll.logFile == nil {
+		return nil, nil
+	}
+	out, err := ll.spooler.read()
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+
+	if _, err := ll.logFile.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	_, err = ll.logFile.Write(out)
+	return out, err
+}
@@ -0,0 +1,114 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+// sshCommand is the command used to connect to the remote host. Keys, agents and host options
+// are taken from the SSH configuration of the user.
+var sshCommand = "ssh"
+
+// sshSourceRegex matches `[user@]host:[port]/path` in the ssh log source
+var sshSourceRegex = regexp.MustCompile(`^([^:/]+):(\d*)(/.*)$`)
+
+// sshTail tails a log file on a remote host, keeping the size already copied
+type sshTail struct {
+	target string
+	port   string
+	path   string
+	offset int64
+}
+
+// newSSHTail reads the target host and the path of the log file from the log source
+func newSSHTail(source string) (*sshTail, error) {
+	m := sshSourceRegex.FindStringSubmatch(strings.TrimPrefix(source, config.SSHLogSourceScheme))
+	if m == nil {
+		return nil, fmt.Errorf("bad ssh log source %q, expected %s[user@]host:[port]/path", source, config.SSHLogSourceScheme)
+	}
+	return &sshTail{target: m[1], port: m[2], path: m[3]}, nil
+}
+
+// shellQuote quotes the value for the shell of the remote host
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// sshArgs returns the arguments to run the command on the remote host
+func (s *sshTail) sshArgs(command string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	if s.port != "" {
+		args = append(args, "-p", s.port)
+	}
+	return append(args, s.target, command)
+}
+
+// run runs the command on the remote host, returning its output
+func (s *sshTail) run(command string) ([]byte, error) {
+	args := s.sshArgs(command)
+	log.Trace().Msgf("ftw/waflog: running %s %v", sshCommand, args)
+	out, err := exec.Command(sshCommand, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("ftw/waflog: can't read %s on %s: %w", s.path, s.target, err)
+	}
+	return out, nil
+}
+
+// parseSize reads the size written by `wc -c` on the first line of the output, returning the rest
+func (s *sshTail) parseSize(out []byte) (int64, []byte, error) {
+	sizeLine, rest, _ := bytes.Cut(out, []byte("\n"))
+	size, err := strconv.ParseInt(string(bytes.TrimSpace(sizeLine)), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ftw/waflog: bad size of %s on %s: %q", s.path, s.target, sizeLine)
+	}
+	return size, rest, nil
+}
+
+// readFrom returns the size of the remote file, and its contents after the offset
+func (s *sshTail) readFrom(offset int64) (int64, []byte, error) {
+	path := shellQuote(s.path)
+	out, err := s.run(fmt.Sprintf("wc -c < %s && tail -c +%d %s", path, offset+1, path))
+	if err != nil {
+		return 0, nil, err
+	}
+	return s.parseSize(out)
+}
+
+func (s *sshTail) start() error {
+	out, err := s.run("wc -c < " + shellQuote(s.path))
+	if err != nil {
+		return err
+	}
+	s.offset, _, err = s.parseSize(out)
+	return err
+}
+
+func (s *sshTail) read() ([]byte, error) {
+	from := s.offset
+	size, contents, err := s.readFrom(from)
+	if err != nil {
+		return nil, err
+	}
+	if size < from {
+		// the file was rotated, read the new one from the start
+		log.Debug().Msgf("ftw/waflog: %s on %s was rotated", s.path, s.target)
+		from = 0
+		if _, contents, err = s.readFrom(from); err != nil {
+			return nil, err
+		}
+	}
+	// the file can grow between wc and tail, so the size is not used as the offset
+	s.offset = from + int64(len(contents))
+	return contents, nil
+}
@@ -0,0 +1,122 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestNewSSHTail(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected *sshTail
+	}{
+		{"ssh://user@waf:/var/log/modsec_audit.log", &sshTail{target: "user@waf", path: "/var/log/modsec_audit.log"}},
+		{"ssh://waf.example.com:2222/var/log/nginx/error.log", &sshTail{target: "waf.example.com", port: "2222", path: "/var/log/nginx/error.log"}},
+		{"ssh://user@waf", nil},
+		{"ssh://user@waf:var/log/error.log", nil},
+	}
+	for _, tc := range tests {
+		tail, err := newSSHTail(tc.source)
+		if tc.expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.source)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(tail, tc.expected) {
+			t.Errorf("%s: unexpected result %+v, %v", tc.source, tail, err)
+		}
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	tail := &sshTail{target: "user@waf", port: "2222", path: "/var/log/it's.log"}
+	expected := []string{"-o", "BatchMode=yes", "-p", "2222", "user@waf", `wc -c < '/var/log/it'\''s.log'`}
+	if args := tail.sshArgs("wc -c < " + shellQuote(tail.path)); !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments %q", args)
+	}
+}
+
+// fakeSSH replaces ssh with a script that runs the command locally
+func fakeSSH(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ssh")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+for arg; do command=$arg; done
+exec sh -c "$command"
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := sshCommand
+	sshCommand = script
+	t.Cleanup(func() { sshCommand = previous })
+}
+
+func TestSSHLog(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
+	}
+	fakeSSH(t)
+
+	remote := filepath.Join(t.TempDir(), "error.log")
+	if err := os.WriteFile(remote, []byte("written before the run [id \"911100\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	appendRemote := func(lines ...string) {
+		f, err := os.OpenFile(remote, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := config.NewConfigFromString("logsource: ssh://user@waf:" + remote)
+	if err != nil {
+		t.Error(err)
+	}
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+
+	appendRemote(startMarkerLine)
+	ll.StartMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.StartMarker, bytes.ToLower([]byte(startMarkerLine))) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	appendRemote(rulesLogLines, endMarkerLine)
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+
+	// after a rotation, the new file is read from the start
+	if err := os.WriteFile(remote, []byte(startMarkerLine+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if marker := ll.CheckLogForMarker(stageID); !bytes.Equal(marker, bytes.ToLower([]byte(startMarkerLine))) {
+		t.Errorf("rotated file not read, got %q", marker)
+	}
+
+	spool, err := os.ReadFile(ll.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(spool, []byte("before the run")) {
+		t.Error("logs written before the run must not be copied")
+	}
+}
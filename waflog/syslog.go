@@ -0,0 +1,208 @@
+package waflog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// syslogPriRegex matches the priority that starts every syslog message, e.g. `<11>`
+var syslogPriRegex = regexp.MustCompile(`^<\d{1,3}>`)
+
+// syslogBSDHeaderRegex matches the header of RFC 3164 messages after the priority:
+// timestamp, optional hostname and tag, e.g. `Jan  5 02:21:09 waf apache2[76]: `
+var syslogBSDHeaderRegex = regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d (?:[^\s:]+ )?(?:[^\s:\[\]]+(?:\[\d+\])?: )?`)
+
+// syslogHeaderRegex matches the header of RFC 5424 messages after the priority: version,
+// timestamp, hostname, app name, process ID and message ID
+var syslogHeaderRegex = regexp.MustCompile(`^1 \S+ \S+ \S+ \S+ \S+ `)
+
+// syslogListener receives the logs sent by the WAF over syslog. Only the messages are kept,
+// without the syslog header, so they can be read like the log file the WAF would write.
+type syslogListener struct {
+	protocol string
+	address  string
+
+	mu       sync.Mutex
+	received []byte
+	conn     net.PacketConn
+	listener net.Listener
+}
+
+// addr returns the address the listener is bound to
+func (s *syslogListener) addr() net.Addr {
+	if s.conn != nil {
+		return s.conn.LocalAddr()
+	}
+	return s.listener.Addr()
+}
+
+func (s *syslogListener) start() error {
+	var err error
+	switch s.protocol {
+	case "udp":
+		if s.conn, err = net.ListenPacket("udp", s.address); err != nil {
+			return err
+		}
+		go s.receivePackets()
+	case "tcp":
+		if s.listener, err = net.Listen("tcp", s.address); err != nil {
+			return err
+		}
+		go s.acceptConnections()
+	default:
+		return fmt.Errorf("ftw/waflog: unknown syslog protocol %q, expected udp or tcp", s.protocol)
+	}
+	log.Debug().Msgf("ftw/waflog: receiving syslog messages on %s/%s", s.addr(), s.protocol)
+	return nil
+}
+
+func (s *syslogListener) read() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	received := s.received
+	s.received = nil
+	return received, nil
+}
+
+// Close stops the listener
+func (s *syslogListener) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// add keeps the message of a syslog packet or frame
+func (s *syslogListener) add(packet []byte) {
+	message := syslogMessage(packet)
+	if len(message) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(append(s.received, message...), '\n')
+}
+
+func (s *syslogListener) receivePackets() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error().Err(err).Msg("ftw/waflog: can't receive syslog messages")
+			}
+			return
+		}
+		s.add(buf[:n])
+	}
+}
+
+func (s *syslogListener) acceptConnections() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error().Err(err).Msg("ftw/waflog: can't accept syslog connections")
+			}
+			return
+		}
+		go s.receiveFrames(conn)
+	}
+}
+
+// receiveFrames reads the messages of a TCP connection, framed by octet counting
+// (`<length> <message>`, RFC 6587) or by new lines
+func (s *syslogListener) receiveFrames(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+		var frame []byte
+		if first[0] >= '0' && first[0] <= '9' {
+			frame, err = readCountedFrame(r)
+		} else {
+			frame, err = r.ReadBytes('\n')
+		}
+		if len(frame) > 0 {
+			s.add(frame)
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Error().Err(err).Msg("ftw/waflog: can't receive syslog messages")
+			}
+			return
+		}
+	}
+}
+
+// readCountedFrame reads a frame that starts with the length of the message
+func readCountedFrame(r *bufio.Reader) ([]byte, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(length[:len(length)-1])
+	if err != nil {
+		return nil, fmt.Errorf("bad syslog frame length %q", length)
+	}
+	frame := make([]byte, n)
+	_, err = io.ReadFull(r, frame)
+	return frame, err
+}
+
+// syslogMessage removes the syslog header of the packet, in the RFC 3164 or RFC 5424 format,
+// and the new lines at the end
+func syslogMessage(packet []byte) []byte {
+	message := bytes.TrimRight(packet, "\r\n\x00")
+	pri := syslogPriRegex.Find(message)
+	if pri == nil {
+		return message
+	}
+	message = message[len(pri):]
+
+	if header := syslogHeaderRegex.Find(message); header != nil {
+		return syslogStructuredDataEnd(message[len(header):])
+	}
+	return message[len(syslogBSDHeaderRegex.Find(message)):]
+}
+
+// syslogStructuredDataEnd skips the structured data of RFC 5424 messages, `-` or a list of
+// `[id name="value"]` elements, and the byte order mark of the message
+func syslogStructuredDataEnd(message []byte) []byte {
+	if bytes.HasPrefix(message, []byte("-")) {
+		message = message[1:]
+	} else {
+		inValue := false
+		i := 0
+	loop:
+		for ; i < len(message); i++ {
+			switch c := message[i]; {
+			case c == '\\' && inValue:
+				i++
+			case c == '"':
+				inValue = !inValue
+			case c == ']' && !inValue && (i+1 == len(message) || message[i+1] != '['):
+				i++
+				break loop
+			}
+		}
+		message = message[i:]
+	}
+	message = bytes.TrimPrefix(message, []byte(" "))
+	return bytes.TrimPrefix(message, []byte("\xef\xbb\xbf"))
+}
@@ -0,0 +1,129 @@
+package waflog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
+
+func TestSyslogMessage(t *testing.T) {
+	tests := []struct {
+		packet   string
+		expected string
+	}{
+		// RFC 3164, with and without hostname
+		{"<11>Jan  5 02:21:09 waf apache2[76]: [Tue Jan 05 02:21:09 2021] [error] ModSecurity: [id \"942100\"]\n", `[Tue Jan 05 02:21:09 2021] [error] ModSecurity: [id "942100"]`},
+		{"<11>Jan 15 02:21:09 nginx: ModSecurity: Warning. [id \"942100\"]", `ModSecurity: Warning. [id "942100"]`},
+		// RFC 5424, with and without structured data
+		{"<11>1 2021-01-05T02:21:09.637Z waf apache2 76 - - [Tue Jan 05 02:21:09 2021] [error] ModSecurity", "[Tue Jan 05 02:21:09 2021] [error] ModSecurity"},
+		{"<11>1 2021-01-05T02:21:09.637Z waf coraza - ID47 [meta seq=\"1\" msg=\"a \\\"]\\\" b\"][origin ip=\"10.0.0.1\"] \xef\xbb\xbfCoraza: Warning.", "Coraza: Warning."},
+		// no syslog header
+		{"X-CRS-Test: 1234\r\n", "X-CRS-Test: 1234"},
+	}
+	for _, tc := range tests {
+		if message := string(syslogMessage([]byte(tc.packet))); message != tc.expected {
+			t.Errorf("%q: got %q, expected %q", tc.packet, message, tc.expected)
+		}
+	}
+}
+
+// checkSyslogLog sends the markers and the logs to the listener, and checks they are read
+func checkSyslogLog(t *testing.T, ll *FTWLogLines, send func(message string)) {
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	startMarkerLine := "X-cRs-TeSt: " + stageID + " -start"
+	endMarkerLine := "X-cRs-TeSt: " + stageID + " -end"
+
+	waitForMarker := func(previous []byte) []byte {
+		for i := 0; i < 100; i++ {
+			if marker := ll.CheckLogForMarker(stageID); marker != nil && !bytes.Equal(marker, previous) {
+				return marker
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	}
+
+	send("<11>Jan  5 02:21:09 waf apache2[76]: " + startMarkerLine)
+	ll.StartMarker = waitForMarker(nil)
+	if !bytes.Equal(ll.StartMarker, bytes.ToLower([]byte(startMarkerLine))) {
+		t.Fatalf("start marker not found, got %q", ll.StartMarker)
+	}
+	for _, line := range bytes.Split([]byte(rulesLogLines), []byte("\n")) {
+		send("<11>Jan  5 02:21:09 waf apache2[76]: " + string(line))
+	}
+	send("<11>1 2021-01-05T02:21:09.637Z waf apache2 76 - - " + endMarkerLine)
+	ll.EndMarker = waitForMarker(ll.StartMarker)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("end marker not found, got %q", ll.EndMarker)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 942100, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logsource: syslog\nsyslog:\n  listen: 127.0.0.1:0\n")
+	if err != nil {
+		t.Error(err)
+	}
+	ll := NewFTWLogLines(cfg)
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	listener, ok := ll.spooler.(*syslogListener)
+	if !ok || listener.protocol != "udp" || ll.logFile == nil {
+		t.Fatalf("unexpected syslog listener %+v", ll.spooler)
+	}
+	conn, err := net.Dial("udp", listener.addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	checkSyslogLog(t, ll, func(message string) {
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		// keep the order of the datagrams
+		time.Sleep(time.Millisecond)
+	})
+}
+
+func TestSyslogTCP(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	ll := NewFTWLogLines(cfg, WithSyslog("tcp", "127.0.0.1:0"))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	conn, err := net.Dial("tcp", ll.spooler.(*syslogListener).addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	framed := false
+	checkSyslogLog(t, ll, func(message string) {
+		// mix octet counting and new line framing
+		if framed {
+			message = fmt.Sprintf("%d %s", len(message), message)
+		} else {
+			message += "\n"
+		}
+		framed = !framed
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSyslogBadProtocol(t *testing.T) {
+	if err := (&syslogListener{protocol: "sctp", address: "127.0.0.1:0"}).start(); err == nil {
+		t.Error("expected an error for an unknown protocol")
+	}
+}
@@ -0,0 +1,90 @@
+package waflog
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// unixMillisLayout is the layout of the timestamps written as milliseconds since the epoch
+const unixMillisLayout = "unix-ms"
+
+// timestampLayout finds the time an entry was logged at, and the layout to parse it with
+type timestampLayout struct {
+	regex  *regexp.Regexp
+	layout string
+}
+
+// timestampLayouts are tried in order: the JSON audit logs first, because their entries can
+// contain timestamps of the request, then the prefixes of the error logs
+var timestampLayouts = []timestampLayout{
+	// libmodsecurity JSON audit log: "time_stamp":"Tue Jan  5 02:21:09 2021"
+	{regexp.MustCompile(`"time_stamp":\s*"([^"]+)"`), "Mon Jan _2 15:04:05 2006"},
+	// ModSecurity v2 JSON audit log: "time":"05/Jan/2021:02:21:09.637165 +0000"
+	{regexp.MustCompile(`"time":\s*"(\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2}(?:\.\d+)? [+-]\d{4})"`), "02/Jan/2006:15:04:05 -0700"},
+	// Coraza JSON audit log: "timestamp":"2021/01/05 02:21:09"
+	{regexp.MustCompile(`"timestamp":\s*"(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})"`), "2006/01/02 15:04:05"},
+	// AWS WAF log: "timestamp":1576280412771
+	{regexp.MustCompile(`"timestamp":\s*(\d{13})\b`), unixMillisLayout},
+	// Apache error log: [Tue Jan 05 02:21:09.637165 2021]
+	{regexp.MustCompile(`^\[(\w{3} \w{3} \d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? \d{4})\]`), "Mon Jan 02 15:04:05 2006"},
+	// Envoy log: [2021-01-05 02:21:09.637]
+	{regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)\]`), "2006-01-02 15:04:05"},
+	// nginx error log: 2021/01/05 02:21:09
+	{regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})`), "2006/01/02 15:04:05"},
+	// any other log with RFC 3339 timestamps, like the ones of journald or syslog
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2}))`), time.RFC3339Nano},
+}
+
+// entryTimestamp returns the time an entry of the log was written at. Timestamps without a time
+// zone are in the local time zone, like the ones written by a web server on the same host.
+func entryTimestamp(entry []byte) (time.Time, bool) {
+	for _, t := range timestampLayouts {
+		match := t.regex.FindSubmatch(entry)
+		if match == nil {
+			continue
+		}
+		if t.layout == unixMillisLayout {
+			if ms, err := strconv.ParseInt(string(match[1]), 10, 64); err == nil {
+				return time.UnixMilli(ms), true
+			}
+			continue
+		}
+		if ts, err := time.ParseInLocation(t.layout, string(match[1]), time.Local); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// inTimeWindow returns true when the time window is set instead of the markers
+func (ll *FTWLogLines) inTimeWindow() bool {
+	return (ll.StartMarker == nil || ll.EndMarker == nil) && !ll.Since.IsZero() && !ll.Until.IsZero()
+}
+
+// getTimeWindowLines returns the lines logged between Since and Until, in reverse order, when the
+// markers are not available. Lines without a timestamp, like the continuation lines of an entry,
+// belong to the timestamp that precedes them.
+func (ll *FTWLogLines) getTimeWindowLines(nextLine func() ([]byte, bool)) [][]byte {
+	var found, pending [][]byte
+	for {
+		line, ok := nextLine()
+		if !ok {
+			break
+		}
+		ts, ok := entryTimestamp(line)
+		if !ok {
+			pending = append(pending, line)
+			continue
+		}
+		if ts.Before(ll.Since) {
+			break
+		}
+		if !ts.After(ll.Until) {
+			found = append(found, pending...)
+			found = append(found, line)
+		}
+		pending = nil
+	}
+	return found
+}
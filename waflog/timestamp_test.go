@@ -0,0 +1,82 @@
+package waflog
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+func TestEntryTimestamp(t *testing.T) {
+	local := func(year int, month time.Month, day, hour, min, sec, nsec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, nsec, time.Local)
+	}
+	tests := map[string]time.Time{
+		`[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76:tid 139683434571520] ModSecurity: Warning.`:          local(2021, time.January, 5, 2, 21, 9, 637165000),
+		`2021/01/05 02:21:09 [error] 11#11: *1 [client 172.23.0.1] ModSecurity: Access denied with code 403`:     local(2021, time.January, 5, 2, 21, 9, 0),
+		`{"transaction":{"client_ip":"172.23.0.1","time_stamp":"Tue Jan  5 02:21:09 2021"}}`:                     local(2021, time.January, 5, 2, 21, 9, 0),
+		`{"transaction":{"time":"05/Jan/2021:02:21:09.637165 +0000"}}`:                                           time.Date(2021, time.January, 5, 2, 21, 9, 637165000, time.UTC),
+		`{"transaction":{"timestamp":"2021/01/05 02:21:09","id":"X-PNFSe1VwjCgYRI9FsbHgAAAIY"}}`:                 local(2021, time.January, 5, 2, 21, 9, 0),
+		`2021-01-05T02:21:09.5Z waf modsecurity: ModSecurity: Warning.`:                                          time.Date(2021, time.January, 5, 2, 21, 9, 500000000, time.UTC),
+		`{"timestamp":1609813269637,"formatVersion":1,"webaclId":"arn:aws:wafv2"}`:                               time.UnixMilli(1609813269637),
+		`[2021-01-05 02:21:09.637][23][critical][wasm] [source/extensions/common/wasm/context.cc:1151] wasm log`: local(2021, time.January, 5, 2, 21, 9, 637000000),
+	}
+	for line, expected := range tests {
+		ts, ok := entryTimestamp([]byte(line))
+		if !ok || !ts.Equal(expected) {
+			t.Errorf("unexpected timestamp %s for %q, expected %s", ts, line, expected)
+		}
+	}
+
+	if _, ok := entryTimestamp([]byte(`[file "/etc/modsecurity.d/owasp-crs/rules/REQUEST-920-PROTOCOL-ENFORCEMENT.conf"]`)); ok {
+		t.Errorf("line without timestamp")
+	}
+}
+
+func TestReadTimeWindow(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: apache")
+	if err != nil {
+		t.Error(err)
+	}
+
+	logLines := `[Tue Jan 05 02:21:08.100000 2021] [:error] [pid 76] ModSecurity: Warning. [id "942100"]
+[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76] ModSecurity: Warning. [id "920300"]
+  continued message
+[Tue Jan 05 02:21:09.638572 2021] [:error] [pid 76] ModSecurity: Warning. [id "949110"]
+[Tue Jan 05 02:21:11.000000 2021] [:error] [pid 76] ModSecurity: Warning. [id "942100"]
+`
+	filename, err := utils.CreateTempFileWithContent(logLines, "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	since := time.Date(2021, time.January, 5, 2, 21, 9, 0, time.Local)
+	ll := NewFTWLogLines(cfg, WithTimeWindow(since, since.Add(time.Second)))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	if !ll.HasWindow() {
+		t.Errorf("the time window must select the logs")
+	}
+	expected := []string{
+		"[Tue Jan 05 02:21:09.637165 2021] [:error] [pid 76] ModSecurity: Warning. [id \"920300\"]\n  continued message",
+		`[Tue Jan 05 02:21:09.638572 2021] [:error] [pid 76] ModSecurity: Warning. [id "949110"]`,
+	}
+	if excerpt := ll.Excerpt(); !reflect.DeepEqual(excerpt, expected) {
+		t.Errorf("unexpected entries %q", excerpt)
+	}
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{920300, 949110}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+
+	// the markers take precedence
+	ll.StartMarker = []byte("x-crs-test: dead-beef")
+	ll.EndMarker = []byte("x-crs-test: dead-beef")
+	if ll.inTimeWindow() {
+		t.Errorf("the markers must be used when they are found")
+	}
+}
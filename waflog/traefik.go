@@ -0,0 +1,6 @@
+package waflog
+
+// traefikMarkerLookback is the number of lines at the end of the Traefik log searched for a marker.
+// Traefik writes the messages of the plugins and the access log lines from different goroutines,
+// and buffers the access log when `bufferingSize` is set, so the marker is not always the last line.
+const traefikMarkerLookback = 20
@@ -0,0 +1,83 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+func TestTraefikLog(t *testing.T) {
+	cfg, err := config.NewConfigFromString("logformat: traefik")
+	if err != nil {
+		t.Error(err)
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	accessLine := func(path string, status string, marker string) string {
+		return `{"ClientHost":"172.18.0.1","DownstreamStatus":` + status + `,"RequestMethod":"GET","RequestPath":"` + path + `","StartUTC":"2023-05-03T12:34:56Z","request_X-Crs-Test":"` + marker + `","level":"info","msg":"","time":"2023-05-03T12:34:56Z"}`
+	}
+	// the Coraza message of the marker rule has the header name and the stage ID, but isn't the marker
+	corazaMarkerLine := `{"level":"warn","plugin":"plugin-coraza","time":"2023-05-03T12:34:56Z","message":"[client \"172.18.0.1\"] Coraza: Warning. [id \"999999\"] [msg \"X-CRS-Test ` + stageID + `\"] [unique_id \"marker\"]"}`
+	startMarkerLine := accessLine("/start", "200", stageID)
+	endMarkerLine := accessLine("/status/200", "200", stageID)
+	lines := []string{
+		corazaMarkerLine,
+		startMarkerLine,
+		`{"level":"error","plugin":"plugin-coraza","time":"2023-05-03T12:34:56Z","message":"[client \"172.18.0.1\"] Coraza: Warning. SQL Injection Attack Detected via libinjection [id \"942100\"] [severity \"critical\"] [unique_id \"0a1b2c3d\"]"}`,
+		`{"level":"error","plugin":"plugin-coraza","time":"2023-05-03T12:34:56Z","msg":"[client \"172.18.0.1\"] Coraza: Access denied (phase 2). Inbound Anomaly Score Exceeded [id \"949110\"] [unique_id \"0a1b2c3d\"]"}`,
+		accessLine("/?id=1%27%20or%201=1", "403", ""),
+		corazaMarkerLine,
+		endMarkerLine,
+		// the messages of the next request can be written before the access log
+		`{"level":"warn","plugin":"plugin-coraza","time":"2023-05-03T12:34:57Z","message":"[client \"172.18.0.1\"] Coraza: Warning. [id \"920350\"] [unique_id \"other\"]"}`,
+	}
+	filename, err := utils.CreateTempFileWithContent(strings.Join(lines, "\n")+"\n", "test-traefik-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogFile = filename
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg, WithStartMarker(bytes.ToLower([]byte(startMarkerLine))))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if marker := ll.CheckLogForMarker("other-stage"); marker != nil {
+		t.Errorf("marker of another stage found: %q", marker)
+	}
+	ll.EndMarker = ll.CheckLogForMarker(stageID)
+	if !bytes.Equal(ll.EndMarker, bytes.ToLower([]byte(endMarkerLine))) {
+		t.Fatalf("marker not found, got %q", ll.EndMarker)
+	}
+
+	if ids := ll.TriggeredRules(); !reflect.DeepEqual(ids, []int{942100, 949110, 999999}) {
+		t.Errorf("unexpected rules %v", ids)
+	}
+	if !ll.Contains(`\[id "949110"\]`) || !ll.Contains(`"DownstreamStatus":403`) {
+		t.Error("JSON messages must be matched unescaped, and access log lines as they are")
+	}
+	if ll.Contains(`920350`) {
+		t.Error("lines after the end marker must not be matched")
+	}
+}
+
+func TestMarkerMatcherField(t *testing.T) {
+	ll := &FTWLogLines{LogMarkerField: "request_X-Crs-Test"}
+	isMarker := ll.markerMatcher("Dead-Beef")
+
+	for line, expected := range map[string]bool{
+		`{"request_x-crs-test":"dead-beef"}`:                   true,
+		`{"request_x-crs-test":"dead-beef-2"}`:                 false,
+		`{"requestpath":"/dead-beef","request_x-crs-test":""}`: false,
+		`{"msg":"x-crs-test dead-beef"}`:                       false,
+		`x-crs-test dead-beef`:                                 false,
+		`{"request_x-crs-test":["dead-beef"]}`:                 false,
+	} {
+		if isMarker([]byte(line)) != expected {
+			t.Errorf("expected %t for %s", expected, line)
+		}
+	}
+}
@@ -1,14 +1,40 @@
 // Package waflog encapsulates getting logs from a WAF to compare with expected results
 package waflog
 
-import "os"
+import (
+	"os"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+)
 
 // FTWLogLines represents the filename to search for logs in a certain timespan
 type FTWLogLines struct {
 	logFile     *os.File
 	FileName    string
+	Format      config.LogFormat
+	Source      config.LogSource
+	spooler     spooler
+	querier     requestQuerier
 	StartMarker []byte
 	EndMarker   []byte
+	// StartOffset is the size of the log file at the start of the run, where reading stops
+	StartOffset int64
+	// Since and Until select the entries by their timestamps when the markers are missing
+	Since time.Time
+	Until time.Time
+	// RequestLines are the logs of the requests of a stage, queried by their ID from the sources
+	// that can't find the markers, instead of the logs between the markers. They are nil for the
+	// other sources, and empty when the requests have no logs.
+	RequestLines [][]byte
+	// RunMode is the mode of the run. The logs are not read in cloud mode.
+	RunMode config.RunMode
+	// LogMarkerHeaderName is the header of the marker requests, found in the marker lines.
+	// It's the default header when empty.
+	LogMarkerHeaderName string
+	// LogMarkerField is the field of the JSON marker lines with the stage ID. Markers are found
+	// from the header name anywhere in the lines when empty.
+	LogMarkerField string
 }
 
 // FTWLogOption follows the option pattern for FTWLogLines
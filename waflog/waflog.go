@@ -1,20 +1,31 @@
 package waflog
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/coreruleset/go-ftw/config"
 )
 
-// NewFTWLogLines is the base struct for reading the log file
-func NewFTWLogLines(opts ...FTWLogOption) *FTWLogLines {
+// NewFTWLogLines is the base struct for reading the log file, with the log settings of the
+// configuration
+func NewFTWLogLines(cfg *config.FTWConfiguration, opts ...FTWLogOption) *FTWLogLines {
 	ll := &FTWLogLines{
-		logFile:     nil,
-		FileName:    config.FTWConfig.LogFile,
-		StartMarker: nil,
-		EndMarker:   nil,
+		logFile:             nil,
+		FileName:            cfg.LogFile,
+		Format:              cfg.LogFormat,
+		Source:              cfg.LogSource,
+		StartMarker:         nil,
+		EndMarker:           nil,
+		RunMode:             cfg.RunMode,
+		LogMarkerHeaderName: cfg.LogMarkerHeaderName,
+		LogMarkerField:      cfg.LogMarkerField,
 	}
 
 	// Loop through each option
@@ -24,6 +35,17 @@ func NewFTWLogLines(opts ...FTWLogOption) *FTWLogLines {
 		opt(ll)
 	}
 
+	if ll.spooler == nil {
+		var err error
+		if ll.spooler, err = newSpooler(ll.Source, cfg); err != nil {
+			log.Error().Caller().Msgf("cannot read the logs: %s", err)
+		}
+	}
+
+	if ll.querier == nil {
+		ll.querier = newRequestQuerier(ll.Source, cfg)
+	}
+
 	if err := ll.openLogFile(); err != nil {
 		log.Error().Caller().Msgf("cannot open log file: %s", err)
 	}
@@ -45,6 +67,21 @@ func WithEndMarker(marker []byte) FTWLogOption {
 	}
 }
 
+// WithTimeWindow selects the entries logged between since and until, when there are no markers
+func WithTimeWindow(since time.Time, until time.Time) FTWLogOption {
+	return func(ll *FTWLogLines) {
+		ll.Since = since
+		ll.Until = until
+	}
+}
+
+// WithStartOffset sets the offset of the log file before which the logs are not read
+func WithStartOffset(offset int64) FTWLogOption {
+	return func(ll *FTWLogLines) {
+		ll.StartOffset = offset
+	}
+}
+
 // WithLogFile sets the log file to read
 func WithLogFile(fileName string) FTWLogOption {
 	return func(ll *FTWLogLines) {
@@ -52,17 +89,67 @@ func WithLogFile(fileName string) FTWLogOption {
 	}
 }
 
-// Cleanup closes the log file
+// WithLogFormat sets the format of the log file
+func WithLogFormat(format config.LogFormat) FTWLogOption {
+	return func(ll *FTWLogLines) {
+		ll.Format = format
+	}
+}
+
+// WithJournald reads the logs from the systemd journal, selecting the entries of the unit and
+// the syslog identifier when they are not empty
+func WithJournald(unit string, identifier string) FTWLogOption {
+	return func(ll *FTWLogLines) {
+		ll.Source = config.JournaldLogSource
+		ll.spooler = &journal{unit: unit, identifier: identifier}
+	}
+}
+
+// WithSyslog receives the logs with a syslog listener on the address, for the `udp` or `tcp` protocol
+func WithSyslog(protocol string, address string) FTWLogOption {
+	return func(ll *FTWLogLines) {
+		ll.Source = config.SyslogLogSource
+		ll.spooler = &syslogListener{protocol: protocol, address: address}
+	}
+}
+
+// WithSSH tails the log file on a remote host over SSH. The source is written as
+// `ssh://user@host:/path/to/file`, or `ssh://user@host:port/path/to/file` to use a different port.
+func WithSSH(source string) FTWLogOption {
+	return func(ll *FTWLogLines) {
+		ll.Source = config.LogSource(source)
+		ll.spooler = nil
+	}
+}
+
+// Cleanup closes the log file, and removes the spool file of sources that are not local files
 func (ll *FTWLogLines) Cleanup() error {
-	if ll.logFile != nil {
-		return ll.logFile.Close()
+	if ll.logFile == nil {
+		return nil
 	}
-	return nil
+	err := ll.logFile.Close()
+	if closer, ok := ll.spooler.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if ll.spooler != nil {
+		if rmErr := os.Remove(ll.logFile.Name()); err == nil {
+			err = rmErr
+		}
+	}
+	return err
 }
 
 func (ll *FTWLogLines) openLogFile() error {
 	// Using a log file is not required in cloud mode
-	if config.FTWConfig.RunMode == config.DefaultRunMode {
+	if ll.readsLogs() {
+		if ll.spooler != nil {
+			if ll.logFile == nil {
+				return ll.openSpool()
+			}
+			return nil
+		}
 		if ll.FileName != "" && ll.logFile == nil {
 			var err error
 			ll.logFile, err = os.Open(ll.FileName)
@@ -71,3 +158,44 @@ func (ll *FTWLogLines) openLogFile() error {
 	}
 	return nil
 }
+
+// readsLogs returns false in cloud mode, where the logs are not available, and in embedded mode,
+// where the WAF returns the logs of each request
+func (ll *FTWLogLines) readsLogs() bool {
+	return ll.RunMode != config.CloudRunMode && ll.RunMode != config.EmbeddedRunMode
+}
+
+// markerHeaderName returns the name of the header of the marker requests
+func (ll *FTWLogLines) markerHeaderName() string {
+	if ll.LogMarkerHeaderName == "" {
+		return config.DefaultLogMarkerHeaderName
+	}
+	return ll.LogMarkerHeaderName
+}
+
+// markerMatcher returns the function telling if a line, in lowercase, is the marker of the stage.
+// Marker lines have the header name and the stage ID, or, when LogMarkerField is set, are JSON
+// lines where the field has the stage ID as value.
+func (ll *FTWLogLines) markerMatcher(stageID string) func([]byte) bool {
+	stageIDBytes := bytes.ToLower([]byte(stageID))
+	if ll.LogMarkerField == "" {
+		crsHeaderBytes := bytes.ToLower([]byte(ll.markerHeaderName()))
+		return func(line []byte) bool {
+			return bytes.Contains(line, crsHeaderBytes) && bytes.Contains(line, stageIDBytes)
+		}
+	}
+
+	field := strings.ToLower(ll.LogMarkerField)
+	return func(line []byte) bool {
+		// skip the lines that can't be markers without parsing them
+		if !bytes.Contains(line, stageIDBytes) {
+			return false
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &fields); err != nil {
+			return false
+		}
+		value, ok := fields[field].(string)
+		return ok && value == string(stageIDBytes)
+	}
+}
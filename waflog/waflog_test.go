@@ -7,11 +7,12 @@ import (
 )
 
 func TestNewFTWLogLines(t *testing.T) {
-	if err := config.NewConfigFromEnv(); err != nil {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
 		t.Error(err)
 	}
 
-	ll := NewFTWLogLines()
+	ll := NewFTWLogLines(cfg)
 	// Loop through each option
 	for _, opt := range []FTWLogOption{
 		WithStartMarker([]byte("#")),
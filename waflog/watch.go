@@ -0,0 +1,60 @@
+package waflog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// CanWatch returns true if the writes to the log file can be watched, which is only possible
+// for local log files
+func (ll *FTWLogLines) CanWatch() bool {
+	return ll.spooler == nil && ll.logFile != nil
+}
+
+// WaitForMarker watches the log file until the marker line of the stage is written, instead of
+// sending requests until the web server flushes its logs. Returns an error if the marker is
+// not written before the timeout.
+func (ll *FTWLogLines) WaitForMarker(stageID string, timeout time.Duration) ([]byte, error) {
+	if !ll.CanWatch() {
+		return nil, fmt.Errorf("ftw/waflog: can't watch the log source %q", ll.Source)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't watch the log file: %w", err)
+	}
+	defer watcher.Close()
+	// watch before looking for the marker, so writes are not missed
+	if err := watcher.Add(ll.FileName); err != nil {
+		return nil, fmt.Errorf("ftw/waflog: can't watch the log file %s: %w", ll.FileName, err)
+	}
+
+	if marker := ll.CheckLogForMarker(stageID); marker != nil {
+		return marker, nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil, fmt.Errorf("ftw/waflog: stopped watching the log file %s", ll.FileName)
+			}
+			if event.Op&fsnotify.Write == 0 {
+				continue
+			}
+			if marker := ll.CheckLogForMarker(stageID); marker != nil {
+				return marker, nil
+			}
+		case err, ok := <-watcher.Errors:
+			if ok {
+				log.Debug().Err(err).Msgf("ftw/waflog: error watching the log file %s", ll.FileName)
+			}
+		case <-timer.C:
+			return nil, fmt.Errorf("ftw/waflog: marker not written to %s after %s", ll.FileName, timeout)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package waflog
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coreruleset/go-ftw/config"
+	"github.com/coreruleset/go-ftw/utils"
+)
+
+func TestWaitForMarker(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	filename, err := utils.CreateTempFileWithContent("[id \"911100\"]\n", "test-errorlog-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(filename) })
+
+	ll := NewFTWLogLines(cfg, WithLogFile(filename))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+	if !ll.CanWatch() {
+		t.Fatal("local log files can be watched")
+	}
+
+	stageID := "dead-beaf-deadbeef-deadbeef-dead"
+	markerLine := "X-cRs-TeSt: " + stageID
+	go func() {
+		f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		// other logs first
+		time.Sleep(20 * time.Millisecond)
+		_, _ = f.WriteString(rulesLogLines + "\n")
+		time.Sleep(20 * time.Millisecond)
+		_, _ = f.WriteString(markerLine + "\n")
+	}()
+
+	marker, err := ll.WaitForMarker(stageID, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marker, bytes.ToLower([]byte(markerLine))) {
+		t.Errorf("unexpected marker %q", marker)
+	}
+
+	// already written
+	if _, err := ll.WaitForMarker(stageID, 0); err != nil {
+		t.Error(err)
+	}
+
+	start := time.Now()
+	if _, err := ll.WaitForMarker("not-written", 50*time.Millisecond); err == nil {
+		t.Error("expected a timeout")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("returned before the timeout")
+	}
+}
+
+func TestWaitForMarkerSpool(t *testing.T) {
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	ll := NewFTWLogLines(cfg, WithSyslog("udp", "127.0.0.1:0"))
+	t.Cleanup(func() { _ = ll.Cleanup() })
+
+	if ll.CanWatch() {
+		t.Error("logs from a syslog listener can't be watched")
+	}
+	if _, err := ll.WaitForMarker("dead-beaf", time.Second); err == nil {
+		t.Error("expected an error")
+	}
+}